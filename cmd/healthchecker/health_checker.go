@@ -44,13 +44,30 @@ func main() {
 		os.Exit(int(types.Unknown))
 	}
 
+	if hco.Report != "" {
+		problem, message, err := healthchecker.Report(hco.Report, hco.ConfigFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(int(types.Unknown))
+		}
+		if problem {
+			fmt.Println(message)
+			os.Exit(int(types.NonOK))
+		}
+		os.Exit(int(types.OK))
+	}
+
 	hc, err := healthchecker.NewHealthChecker(hco)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(int(types.Unknown))
 	}
 	if !hc.CheckHealth() {
-		fmt.Printf("%v:%v was found unhealthy; repair flag : %v\n", hco.Component, hco.SystemdService, hco.EnableRepair)
+		component := fmt.Sprintf("%v:%v", hco.Component, hco.SystemdService)
+		if hco.ConfigFile != "" {
+			component = hco.ConfigFile
+		}
+		fmt.Printf("%v was found unhealthy; repair flag : %v\n", component, hco.EnableRepair)
 		os.Exit(int(types.NonOK))
 	}
 	os.Exit(int(types.OK))
@@ -24,6 +24,7 @@ import (
 	"github.com/spf13/pflag"
 
 	"k8s.io/node-problem-detector/pkg/healthchecker/types"
+	"k8s.io/node-problem-detector/pkg/util/cri"
 )
 
 // NewHealthCheckerOptions returns an empty health check options struct.
@@ -33,6 +34,8 @@ func NewHealthCheckerOptions() *HealthCheckerOptions {
 
 // HealthCheckerOptions are the options used to configure the health checker.
 type HealthCheckerOptions struct {
+	ConfigFile         string
+	Report             string
 	Component          string
 	SystemdService     string
 	EnableRepair       bool
@@ -44,6 +47,12 @@ type HealthCheckerOptions struct {
 
 // AddFlags adds health checker command line options to pflag.
 func (hco *HealthCheckerOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&hco.ConfigFile, "config", "",
+		"The configuration file of the component to check health for, checking any systemd service, HTTP or gRPC health endpoint, "+
+			"or TCP port. Overrides component, systemd-service, crictl-path and cri-socket-path.")
+	fs.StringVar(&hco.Report, "report", "",
+		"Report the repairs of the component of the config instead of checking its health: repair-attempts reports each repair "+
+			"attempt once, and repairs-exhausted reports the component unhealthy after the max repair attempts.")
 	fs.StringVar(&hco.Component, "component", types.KubeletComponent,
 		"The component to check health for. Supports kubelet, docker and cri")
 	fs.StringVar(&hco.SystemdService, "systemd-service", "",
@@ -51,8 +60,10 @@ func (hco *HealthCheckerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&hco.EnableRepair, "enable-repair", true, "Flag to enable/disable repair attempt for the component.")
 	fs.StringVar(&hco.CriCtlPath, "crictl-path", types.DefaultCriCtl,
 		"The path to the crictl binary. This is used to check health of cri component.")
-	fs.StringVar(&hco.CriSocketPath, "cri-socket-path", types.DefaultCriSocketPath,
-		"The path to the cri socket. Used with crictl to specify the socket path.")
+	fs.StringVar(&hco.CriSocketPath, "cri-socket-path", "",
+		"The cri endpoint, e.g. unix:///run/containerd/containerd.sock, npipe:////./pipe/containerd-containerd or tcp://127.0.0.1:3735. "+
+			"Absolute socket paths are also accepted. Used with crictl to specify the runtime endpoint. "+
+			"Default to the first served endpoint of the common container runtimes.")
 	fs.DurationVar(&hco.CoolDownTime, "cooldown-time", types.DefaultCoolDownTime,
 		"The duration to wait for the service to be up before attempting repair.")
 	fs.DurationVar(&hco.HealthCheckTimeout, "health-check-timeout", types.DefaultHealthCheckTimeout,
@@ -62,6 +73,18 @@ func (hco *HealthCheckerOptions) AddFlags(fs *pflag.FlagSet) {
 // IsValid validates health checker command line options.
 // Returns error if invalid, nil otherwise.
 func (hco *HealthCheckerOptions) IsValid() error {
+	if hco.Report != "" {
+		if hco.Report != types.RepairAttemptsReport && hco.Report != types.RepairsExhaustedReport {
+			return fmt.Errorf("the report specified is not supported. Supported reports are : <%s/%s>", types.RepairAttemptsReport, types.RepairsExhaustedReport)
+		}
+		if hco.ConfigFile == "" {
+			return fmt.Errorf("report requires config")
+		}
+	}
+	// The configuration file is validated when it is loaded.
+	if hco.ConfigFile != "" {
+		return nil
+	}
 	// Make sure the component specified is valid.
 	if hco.Component != types.KubeletComponent && hco.Component != types.DockerComponent && hco.Component != types.CRIComponent {
 		return fmt.Errorf("the component specified is not supported. Supported components are : <kubelet/docker/cri>")
@@ -82,11 +105,20 @@ func (hco *HealthCheckerOptions) IsValid() error {
 	if hco.Component == types.CRIComponent && hco.CriSocketPath == "" {
 		return fmt.Errorf("the cri-socket-path cannot be empty for cri component")
 	}
+	if _, err := cri.ParseEndpoint(hco.CriSocketPath); err != nil {
+		return fmt.Errorf("invalid cri-socket-path: %v", err)
+	}
 	return nil
 }
 
 // SetDefaults sets the defaults values for the dependent flags.
 func (hco *HealthCheckerOptions) SetDefaults() {
+	if hco.ConfigFile != "" {
+		return
+	}
+	if hco.Component == types.CRIComponent && hco.CriSocketPath == "" {
+		hco.CriSocketPath = defaultCriSocketPath()
+	}
 	if hco.SystemdService != "" {
 		return
 	}
@@ -97,6 +129,17 @@ func (hco *HealthCheckerOptions) SetDefaults() {
 	hco.SystemdService = types.ContainerdService
 }
 
+// defaultCriSocketPath returns the first served endpoint of the common container runtimes.
+// When none is served, e.g. the runtime is down, it returns the first default endpoint, so
+// that the runtime is reported unhealthy.
+func defaultCriSocketPath() string {
+	endpoint, err := cri.DetectEndpoint(types.CmdTimeout)
+	if err != nil {
+		return cri.DefaultEndpoints[0]
+	}
+	return endpoint.String()
+}
+
 func init() {
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 }
@@ -53,6 +53,57 @@ func TestIsValid(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "valid cri endpoint",
+			hco: HealthCheckerOptions{
+				Component:     types.CRIComponent,
+				CriCtlPath:    types.DefaultCriCtl,
+				CriSocketPath: "/run/containerd/containerd.sock",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid cri endpoint",
+			hco: HealthCheckerOptions{
+				Component:     types.CRIComponent,
+				CriCtlPath:    types.DefaultCriCtl,
+				CriSocketPath: "http://127.0.0.1:3735",
+			},
+			expectError: true,
+		},
+		{
+			name: "config file",
+			hco: HealthCheckerOptions{
+				ConfigFile:   "/etc/node-problem-detector/health-checker/kube-proxy.json",
+				Component:    "kube-proxy",
+				EnableRepair: true,
+			},
+			expectError: false,
+		},
+		{
+			name: "repair report",
+			hco: HealthCheckerOptions{
+				ConfigFile: "/etc/node-problem-detector/health-checker/kube-proxy.json",
+				Report:     types.RepairsExhaustedReport,
+			},
+			expectError: false,
+		},
+		{
+			name: "report without config file",
+			hco: HealthCheckerOptions{
+				Component: types.KubeletComponent,
+				Report:    types.RepairAttemptsReport,
+			},
+			expectError: true,
+		},
+		{
+			name: "unknown report",
+			hco: HealthCheckerOptions{
+				ConfigFile: "/etc/node-problem-detector/health-checker/kube-proxy.json",
+				Report:     "repairs",
+			},
+			expectError: true,
+		},
 		{
 			name: "empty systemd-service and repair enabled",
 			hco: HealthCheckerOptions{
@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+
+	"k8s.io/node-problem-detector/cmd/options"
+	"k8s.io/node-problem-detector/pkg/aggregator"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
+	"k8s.io/node-problem-detector/pkg/exporters/prometheusexporter"
+)
+
+// aggregateCommand is the name of the subcommand summarizing the problems of all nodes of
+// the cluster.
+const aggregateCommand = "aggregate"
+
+// runAggregateCommand runs the aggregate subcommand with the arguments after its name. It
+// only returns the exit code if the arguments are invalid.
+func runAggregateCommand(args []string, out io.Writer) int {
+	fs := pflag.NewFlagSet(aggregateCommand, pflag.ContinueOnError)
+	fs.SetOutput(out)
+	npdo := &options.NodeProblemDetectorOptions{}
+	config := aggregator.Config{}
+	fs.StringVar(&npdo.ApiServerOverride, "apiserver-override", "",
+		"Custom URI used to connect to Kubernetes ApiServer.")
+	fs.StringSliceVar(&config.ConditionTypes, "condition-types", nil,
+		"The types of the conditions set by node-problem-detector, e.g. KernelDeadlock,ReadonlyFilesystem. Their instances, e.g. DiskReadonly[sdb], are included too.")
+	fs.StringVar(&config.ConditionTypePrefix, "condition-type-prefix", "",
+		"Include all conditions whose type has the prefix, e.g. the --condition-type-prefix of node-problem-detector.")
+	fs.StringVar(&config.Namespace, "configmap-namespace", "kube-system",
+		"The namespace of the ConfigMap the unhealthy nodes are written to.")
+	fs.StringVar(&config.ConfigMap, "configmap", "node-problem-detector-summary",
+		"The name of the ConfigMap the unhealthy nodes are written to. Set to empty string to disable.")
+	fs.DurationVar(&config.SyncPeriod, "sync-period", 30*time.Second,
+		"The period at which the nodes are summarized.")
+	fs.StringVar(&npdo.PrometheusServerAddress, "prometheus-address", "127.0.0.1",
+		"The address to bind the Prometheus scrape endpoint.")
+	fs.IntVar(&npdo.PrometheusServerPort, "prometheus-port", 20257,
+		"The port to bind the Prometheus scrape endpoint. Use 0 to disable.")
+	fs.Usage = func() {
+		fmt.Fprintf(out, "Usage: %s %s --condition-types=<types> [--configmap=<name>]\n\n", os.Args[0], aggregateCommand)
+		fmt.Fprintln(out, "Summarizes the conditions set by node-problem-detector on all nodes of the cluster into cluster-scoped metrics and a ConfigMap listing the unhealthy nodes. Run it in a single replica Deployment.")
+		fmt.Fprintln(out)
+		fs.PrintDefaults()
+	}
+	// The flags of glog are registered to the default flag set.
+	fs.AddGoFlagSet(flag.CommandLine)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(out, err)
+		fs.Usage()
+		return 2
+	}
+	if _, err := url.Parse(npdo.ApiServerOverride); err != nil {
+		fmt.Fprintf(out, "apiserver-override %q is not a valid HTTP URI: %v\n", npdo.ApiServerOverride, err)
+		return 2
+	}
+
+	prometheusexporter.NewExporterOrDie(npdo)
+	a := aggregator.NewAggregatorOrDie(config, aggregator.NewClusterClient(problemclient.NewClientsetOrDie(npdo)))
+	glog.Infof("Aggregating the problems of the nodes every %v", config.SyncPeriod)
+	a.Run()
+	return 0
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/node-problem-detector/pkg/configdiff"
+)
+
+// configCommand is the name of the subcommand dumping and comparing problem daemon
+// configs.
+const configCommand = "config"
+
+// runConfigCommand runs the config subcommand with the arguments after its name, and
+// returns the exit code.
+func runConfigCommand(args []string, out io.Writer) int {
+	usage := func() {
+		fmt.Fprintf(out, "Usage: %s %s dump [--resolve] <config>\n", os.Args[0], configCommand)
+		fmt.Fprintf(out, "       %s %s diff <old config> <new config>\n", os.Args[0], configCommand)
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	switch args[0] {
+	case "dump":
+		return runConfigDump(args[1:], out)
+	case "diff":
+		return runConfigDiff(args[1:], out)
+	default:
+		fmt.Fprintf(out, "Unknown %s subcommand %q\n", configCommand, args[0])
+		usage()
+		return 2
+	}
+}
+
+// addMonitorFlags adds the flags selecting how configs are loaded.
+func addMonitorFlags(fs *pflag.FlagSet, resolve bool) (*string, *bool) {
+	monitor := fs.String("monitor", "", fmt.Sprintf("The monitor of the config: %s, %s or %s. Default to detect it from the config.",
+		configdiff.SystemLogMonitor, configdiff.CustomPluginMonitor, configdiff.SystemStatsMonitor))
+	resolved := fs.Bool("resolve", resolve, "Apply the defaults of the monitor to the config.")
+	return monitor, resolved
+}
+
+// runConfigDump prints a config as indented JSON.
+func runConfigDump(args []string, out io.Writer) int {
+	fs := pflag.NewFlagSet(configCommand+" dump", pflag.ContinueOnError)
+	fs.SetOutput(out)
+	monitor, resolve := addMonitorFlags(fs, false)
+	fs.Usage = func() {
+		fmt.Fprintf(out, "Usage: %s %s dump [--resolve] <config>\n\n", os.Args[0], configCommand)
+		fmt.Fprintln(out, "Prints a problem daemon config, optionally with the defaults of its monitor applied.")
+		fmt.Fprintln(out)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	config, err := configdiff.Load(fs.Arg(0), *monitor, *resolve)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	fmt.Fprintln(out, string(data))
+	return 0
+}
+
+// runConfigDiff prints the semantic differences between two configs. Like diff, it exits
+// with 0 when they are the same, 1 when they differ and 2 on trouble.
+func runConfigDiff(args []string, out io.Writer) int {
+	fs := pflag.NewFlagSet(configCommand+" diff", pflag.ContinueOnError)
+	fs.SetOutput(out)
+	monitor, resolve := addMonitorFlags(fs, true)
+	fs.Usage = func() {
+		fmt.Fprintf(out, "Usage: %s %s diff <old config> <new config>\n\n", os.Args[0], configCommand)
+		fmt.Fprintln(out, "Prints the rules added, removed and changed between two problem daemon configs, and the other changed settings with the deltas of numbers.")
+		fmt.Fprintln(out)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var configs [2]interface{}
+	for i := range configs {
+		var err error
+		if configs[i], err = configdiff.Load(fs.Arg(i), *monitor, *resolve); err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+	}
+	changes := configdiff.Diff(configs[0], configs[1])
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "No changes.")
+		return 0
+	}
+	for _, change := range changes {
+		fmt.Fprintln(out, change)
+	}
+	added, removed, changed := configdiff.Summarize(changes, "rules")
+	fmt.Fprintf(out, "\n%d rules added, %d removed, %d changed.\n", added, removed, changed)
+	return 1
+}
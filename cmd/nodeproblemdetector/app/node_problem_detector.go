@@ -0,0 +1,297 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package app is the node problem detector command. It is importable so that custom
+// builds linking in out-of-tree problem daemons and exporters run the same command, see
+// docs/exporters.md.
+package app
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+	"go.opencensus.io/trace"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	_ "k8s.io/node-problem-detector/cmd/nodeproblemdetector/exporterplugins"
+	_ "k8s.io/node-problem-detector/cmd/nodeproblemdetector/problemdaemonplugins"
+	"k8s.io/node-problem-detector/cmd/options"
+	"k8s.io/node-problem-detector/pkg/correlation"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	"k8s.io/node-problem-detector/pkg/exporters/dryrunexporter"
+	"k8s.io/node-problem-detector/pkg/exporters/egressbudget"
+	"k8s.io/node-problem-detector/pkg/exporters/enrichment"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
+	"k8s.io/node-problem-detector/pkg/exporters/problembudget"
+	"k8s.io/node-problem-detector/pkg/exporters/prometheusexporter"
+	"k8s.io/node-problem-detector/pkg/exporters/socketexporter"
+	"k8s.io/node-problem-detector/pkg/exporters/suppression"
+	"k8s.io/node-problem-detector/pkg/flapdamping"
+	"k8s.io/node-problem-detector/pkg/healthscore"
+	"k8s.io/node-problem-detector/pkg/journal"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemdaemon/configmap"
+	"k8s.io/node-problem-detector/pkg/problemdetector"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/problemsummary"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/version"
+)
+
+// exporterStopTimeout is the time the exporters are given to flush their problems on
+// termination.
+const exporterStopTimeout = 10 * time.Second
+
+// Main runs node problem detector with the problem daemons and exporters registered by
+// the imported packages.
+func Main() {
+	if len(os.Args) > 1 && os.Args[1] == testCommand {
+		os.Exit(runTestCommand(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == aggregateCommand {
+		os.Exit(runAggregateCommand(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == configCommand {
+		os.Exit(runConfigCommand(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == validateCommand {
+		os.Exit(runValidateCommand(os.Args[2:], os.Stdout))
+	}
+
+	npdo := options.NewNodeProblemDetectorOptions()
+	npdo.AddFlags(pflag.CommandLine)
+
+	pflag.Parse()
+
+	if npdo.PrintVersion {
+		version.PrintVersion()
+		os.Exit(0)
+	}
+
+	npdo.SetNodeNameOrDie()
+	util.SetNodeName(npdo.NodeName)
+	npdo.SetConfigFromDeprecatedOptionsOrDie()
+	npdo.ValidOrDie()
+
+	// The naming scheme must be set before any metric is created. Problem metrics
+	// are created at init time, so they are re-created under the new scheme.
+	if err := metrics.SetNamingScheme(metrics.NamingScheme(npdo.MetricsNamingScheme)); err != nil {
+		glog.Fatalf("Invalid metrics naming scheme: %v", err)
+	}
+	if metrics.GetNamingScheme() != metrics.LegacyNaming || len(npdo.ProblemMetricsLabels) > 0 {
+		problemmetrics.GlobalProblemMetricsManager = problemmetrics.NewProblemMetricsManagerOrDie(npdo.ProblemMetricsLabels...)
+	}
+
+	// OpenCensus samples a fraction of the spans by default, tracing is only enabled
+	// explicitly.
+	sampler := trace.NeverSample()
+	if npdo.TracingSampleProbability > 0 {
+		sampler = trace.ProbabilitySampler(npdo.TracingSampleProbability)
+	}
+	trace.ApplyConfig(trace.Config{DefaultSampler: sampler})
+
+	// Initialize problem daemons.
+	problemDaemonsByConfig := problemdaemon.NewProblemDaemonsByConfig(npdo.MonitorConfigPaths)
+	if len(problemDaemonsByConfig) == 0 && npdo.ConfigMapSelector == "" {
+		glog.Fatalf("No problem daemon is configured")
+	}
+	problemDaemons := []types.Monitor{}
+	for _, problemDaemon := range problemDaemonsByConfig {
+		problemDaemons = append(problemDaemons, problemDaemon)
+	}
+	var listers []problemdaemon.Lister
+	if npdo.ConfigMapSelector != "" {
+		client := configmap.NewClient(problemclient.NewClientsetOrDie(npdo), npdo.ConfigMapNamespace, npdo.ConfigMapSelector)
+		source := configmap.NewSourceOrDie(client, npdo.ConfigMapDir, npdo.ConfigMapAllowedExecutables)
+		problemDaemons = append(problemDaemons, source)
+		listers = append(listers, source)
+		glog.Infof("Loading problem daemon configurations from ConfigMaps %q in namespace %s.",
+			npdo.ConfigMapSelector, npdo.ConfigMapNamespace)
+	}
+	if npdo.AdminAddress != "" {
+		problemdaemon.StartAdminServerOrDie(npdo.AdminAddress, npdo.Serving, problemDaemonsByConfig, listers...)
+		glog.Infof("Admin API started at %s.", npdo.AdminAddress)
+	}
+
+	// Initialize exporters.
+	defaultExporters := []types.Exporter{}
+	if ke := k8sexporter.NewExporterOrDie(npdo); ke != nil {
+		defaultExporters = append(defaultExporters, ke)
+		glog.Info("K8s exporter started.")
+	}
+	if pe := prometheusexporter.NewExporterOrDie(npdo); pe != nil {
+		defaultExporters = append(defaultExporters, pe)
+		glog.Info("Prometheus exporter started.")
+	}
+	if de := dryrunexporter.NewExporterOrDie(npdo); de != nil {
+		defaultExporters = append(defaultExporters, de)
+		glog.Info("Dry run exporter started.")
+	}
+	if se := socketexporter.NewExporterOrDie(npdo); se != nil {
+		defaultExporters = append(defaultExporters, se)
+		glog.Infof("Problem socket started at %s.", npdo.ProblemSocket)
+	}
+
+	exporters.SetDryRun(npdo.DryRun)
+	plugableExporters := exporters.NewExporters()
+
+	npdExporters := []types.Exporter{}
+	npdExporters = append(npdExporters, defaultExporters...)
+	npdExporters = append(npdExporters, plugableExporters...)
+
+	if len(npdExporters) == 0 {
+		glog.Fatalf("No exporter is successfully setup")
+	}
+	if npdo.NodeEnrichmentConfigPath != "" {
+		config, err := enrichment.LoadConfig(npdo.NodeEnrichmentConfigPath)
+		if err != nil {
+			glog.Fatalf("Failed to load node enrichment config: %v", err)
+		}
+		client := problemclient.NewClientsetOrDie(npdo)
+		enricher := enrichment.NewEnricher(config, func() (*v1.Node, error) {
+			return client.CoreV1().Nodes().Get(npdo.NodeName, metav1.GetOptions{})
+		})
+		// The other wrappers build new statuses without the node metadata.
+		npdExporters = enrichment.WrapExporters(npdExporters, enricher)
+	}
+	if npdo.EgressBudgetBytesPerMinute > 0 {
+		npdExporters = egressbudget.WrapPushExporters(npdExporters, egressbudget.NewBudget(npdo.EgressBudgetBytesPerMinute))
+	}
+	if npdo.ProblemBudgetConfigPath != "" {
+		config, err := problembudget.LoadConfig(npdo.ProblemBudgetConfigPath)
+		if err != nil {
+			glog.Fatalf("Failed to load problem budget config: %v", err)
+		}
+		npdExporters = problembudget.WrapExporters(npdExporters, config)
+	}
+
+	if npdo.SuppressionConfigPath != "" {
+		config, err := suppression.LoadConfig(npdo.SuppressionConfigPath)
+		if err != nil {
+			glog.Fatalf("Failed to load suppression config: %v", err)
+		}
+		var nodeLabels suppression.NodeLabelsFunc
+		if config.HasNodeSelectors() {
+			client := problemclient.NewClientsetOrDie(npdo)
+			nodeLabels = func() (map[string]string, error) {
+				node, err := client.CoreV1().Nodes().Get(npdo.NodeName, metav1.GetOptions{})
+				if err != nil {
+					return nil, err
+				}
+				return node.Labels, nil
+			}
+		}
+		suppressor := suppression.NewSuppressor(config, nodeLabels)
+		problemmetrics.GlobalProblemMetricsManager.SetSuppressor(suppressor.Suppressed)
+		npdExporters = suppression.WrapExporters(npdExporters, suppressor)
+	}
+
+	var correlator *correlation.Correlator
+	if npdo.ConditionCorrelationConfigPath != "" {
+		var err error
+		correlator, err = correlation.NewCorrelator(npdo.ConditionCorrelationConfigPath)
+		if err != nil {
+			glog.Fatalf("Failed to initialize condition correlation: %v", err)
+		}
+	}
+
+	var summarizer *problemsummary.Summarizer
+	if npdo.ProblemSummaryConfigPath != "" {
+		var err error
+		summarizer, err = problemsummary.NewSummarizer(npdo.ProblemSummaryConfigPath)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem summary: %v", err)
+		}
+	}
+
+	var scorer *healthscore.Scorer
+	if npdo.HealthScoreConfigPath != "" {
+		// The wrappers of the exporters do not annotate the node, the exporters themselves do.
+		var annotators []types.NodeAnnotator
+		for _, exporter := range append(defaultExporters, plugableExporters...) {
+			if annotator, ok := exporter.(types.NodeAnnotator); ok {
+				annotators = append(annotators, annotator)
+			}
+		}
+		var err error
+		scorer, err = healthscore.NewScorer(npdo.HealthScoreConfigPath, annotators)
+		if err != nil {
+			glog.Fatalf("Failed to initialize health score: %v", err)
+		}
+	}
+
+	var damper *flapdamping.Damper
+	if npdo.FlapDampingConfigPath != "" {
+		var err error
+		damper, err = flapdamping.NewDamper(npdo.FlapDampingConfigPath)
+		if err != nil {
+			glog.Fatalf("Failed to initialize flap damping: %v", err)
+		}
+	}
+
+	var eventJournal *journal.Journal
+	if npdo.EventJournalConfigPath != "" {
+		// The wrappers of the exporters do not deliver the problems, the exporters
+		// themselves do.
+		var acknowledgers []types.AcknowledgingExporter
+		for _, exporter := range append(defaultExporters, plugableExporters...) {
+			if acknowledger, ok := exporter.(types.AcknowledgingExporter); ok {
+				acknowledgers = append(acknowledgers, acknowledger)
+			}
+		}
+		var err error
+		eventJournal, err = journal.Open(npdo.EventJournalConfigPath, acknowledgers)
+		if err != nil {
+			glog.Fatalf("Failed to initialize event journal: %v", err)
+		}
+	}
+
+	// The exporters implementing types.StoppableExporter, e.g. the problem socket and the
+	// notification exporter, flush the problems which are not sent yet on termination. The
+	// other problems which are not delivered yet are replayed by the event journal, if any,
+	// on the next start.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		glog.Infof("Received %v, stopping exporters", sig)
+		exporters.StopExporters(append(defaultExporters, plugableExporters...), exporterStopTimeout)
+		os.Exit(0)
+	}()
+
+	// Initialize NPD core.
+	p := problemdetector.NewProblemDetector(problemDaemons, npdExporters, problemdetector.Options{
+		FullSyncPeriod:  npdo.ExporterFullSyncPeriod,
+		HeartbeatPeriod: npdo.HeartbeatPeriod,
+		Correlator:      correlator,
+		Summarizer:      summarizer,
+		Scorer:          scorer,
+		Damper:          damper,
+		Journal:         eventJournal,
+	})
+	if err := p.Run(); err != nil {
+		glog.Fatalf("Problem detector failed with error: %v", err)
+	}
+}
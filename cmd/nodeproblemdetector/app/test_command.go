@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// testCommand is the name of the subcommand replaying sample logs through the rules of a
+// system log monitor config.
+const testCommand = "test"
+
+// runTestCommand runs the test subcommand with the arguments after its name, prints the
+// matched rules and the resulting events and conditions, and returns the exit code.
+func runTestCommand(args []string, out io.Writer) int {
+	fs := pflag.NewFlagSet(testCommand, pflag.ContinueOnError)
+	fs.SetOutput(out)
+	configPath := fs.String("config", "", "Path to the system log monitor config file.")
+	logPath := fs.String("log", "-", "Path to the sample log file, or - for stdin. filelog logs are translated with the pluginConfig of the config, journald logs are read in the journal export format (journalctl -o export), kmsg logs are read one message per line, optionally prefixed with the dmesg timestamp.")
+	startString := fs.String("start", "", "The RFC3339 timestamp of the first kmsg log, default to now.")
+	fs.Usage = func() {
+		fmt.Fprintf(out, "Usage: %s %s --config=<config> [--log=<log>]\n\n", os.Args[0], testCommand)
+		fmt.Fprintln(out, "Replays sample logs through the rules of a system log monitor config, and prints the matched rules and the resulting events and conditions.")
+		fmt.Fprintln(out)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *configPath == "" {
+		fmt.Fprintln(out, "--config is required")
+		fs.Usage()
+		return 2
+	}
+	start := time.Now()
+	if *startString != "" {
+		var err error
+		if start, err = time.Parse(time.RFC3339, *startString); err != nil {
+			fmt.Fprintf(out, "Invalid --start %q: %v\n", *startString, err)
+			return 2
+		}
+	}
+
+	config, err := systemlogmonitor.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	var r io.Reader = os.Stdin
+	if *logPath != "-" {
+		f, err := os.Open(*logPath)
+		if err != nil {
+			fmt.Fprintf(out, "Failed to open sample log: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+	logs, errs := systemlogmonitor.ReadLogs(config.WatcherConfig, r, start)
+	for _, err := range errs {
+		fmt.Fprintf(out, "Skipped: %v\n", err)
+	}
+
+	matches, conditions := systemlogmonitor.Replay(config, logs)
+	fmt.Fprintf(out, "Replayed %d logs through %d rules of %s.\n", len(logs), len(config.Rules), *configPath)
+	matchedReasons := map[string]bool{}
+	for _, match := range matches {
+		matchedReasons[match.Rule.Reason] = true
+		fmt.Fprintf(out, "\nLog %d at %s matched %s rule %s:\n", match.Index+1,
+			logs[match.Index].Timestamp.Format(time.RFC3339), match.Rule.Type, match.Rule.Reason)
+		for _, log := range match.Logs {
+			fmt.Fprintf(out, "  | %s\n", log.Message)
+		}
+		for _, event := range match.Status.Events {
+			fmt.Fprintf(out, "  event: %s %s: %s\n", event.Severity, event.Reason, firstLine(event.Message))
+		}
+		if match.Rule.Type != types.Temp {
+			for _, condition := range match.Status.Conditions {
+				if condition.Type == match.Rule.Condition {
+					fmt.Fprintf(out, "  condition: %s=%s (%s)\n", condition.Type, condition.Status, condition.Reason)
+				}
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "\nFinal conditions:")
+	for _, condition := range conditions {
+		fmt.Fprintf(out, "  %s=%s (%s) since %s\n", condition.Type, condition.Status, condition.Reason,
+			condition.Transition.Format(time.RFC3339))
+	}
+	var unmatched []string
+	for _, rule := range config.Rules {
+		if !matchedReasons[rule.Reason] {
+			unmatched = append(unmatched, rule.Reason)
+			// Rules sharing a reason are listed once.
+			matchedReasons[rule.Reason] = true
+		}
+	}
+	if len(unmatched) > 0 {
+		fmt.Fprintf(out, "\nRules never matched: %s\n", strings.Join(unmatched, ", "))
+	}
+	return 0
+}
+
+// firstLine returns the first line of a possibly multi-line message.
+func firstLine(message string) string {
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		return message[:i] + " ..."
+	}
+	return message
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/node-problem-detector/pkg/configvalidation"
+)
+
+// validateCommand is the name of the subcommand validating configuration files.
+const validateCommand = "validate"
+
+// runValidateCommand runs the validate subcommand with the arguments after its name, and
+// returns the exit code: 0 when all configuration files are valid, 1 when some are not,
+// and 2 on usage errors.
+func runValidateCommand(args []string, out io.Writer) int {
+	fs := pflag.NewFlagSet(validateCommand, pflag.ContinueOnError)
+	fs.SetOutput(out)
+	kind := fs.String("kind", "", fmt.Sprintf("The kind of the configuration files: %s. Default to detect it from each configuration file.",
+		strings.Join(configvalidation.Kinds(), ", ")))
+	checkPaths := fs.Bool("check-paths", false, "Check that the plugins referenced by custom plugin monitor configuration files exist, e.g. when validating on a node.")
+	fs.Usage = func() {
+		fmt.Fprintf(out, "Usage: %s %s [--kind=<kind>] <file or directory>...\n\n", os.Args[0], validateCommand)
+		fmt.Fprintln(out, "Validates problem daemon and exporter configuration files, rejecting unknown fields. The .json files under directories are validated recursively.")
+		fmt.Fprintln(out)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var paths []string
+	for _, arg := range fs.Args() {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			// Files named explicitly are validated whatever their extension.
+			if path == arg || filepath.Ext(path) == ".json" {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+	}
+
+	invalid := 0
+	for _, path := range paths {
+		detected, err := configvalidation.ValidateFile(path, *kind, *checkPaths)
+		if err != nil {
+			invalid++
+			fmt.Fprintf(out, "%s: INVALID (%s): %v\n", path, detected, err)
+			continue
+		}
+		fmt.Fprintf(out, "%s: OK (%s)\n", path, detected)
+	}
+	fmt.Fprintf(out, "\n%d configuration files validated, %d invalid.\n", len(paths), invalid)
+	if invalid > 0 {
+		return 1
+	}
+	return 0
+}
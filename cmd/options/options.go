@@ -19,16 +19,23 @@ package options
 import (
 	"flag"
 	"fmt"
-	"os"
+	"net"
 	"time"
 
 	"net/url"
 
+	"github.com/golang/glog"
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"k8s.io/node-problem-detector/pkg/exporters"
 	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
 	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/util/nodeidentity"
+	"k8s.io/node-problem-detector/pkg/util/serving"
 )
 
 // NodeProblemDetectorOptions contains node problem detector command line and application options.
@@ -39,10 +46,19 @@ type NodeProblemDetectorOptions struct {
 	PrintVersion bool
 	// HostnameOverride specifies custom node name used to override hostname.
 	HostnameOverride string
+	// NodeIdentityProviders are the providers identifying the node, in the order of
+	// precedence. The default providers are used if it is empty.
+	NodeIdentityProviders []string
+	// NodeIdentityKubeletEndpoint is the base URL of the kubelet API used by the kubelet
+	// node identity provider.
+	NodeIdentityKubeletEndpoint string
 	// ServerPort is the port to bind the node problem detector server. Use 0 to disable.
 	ServerPort int
 	// ServerAddress is the address to bind the node problem detector server.
 	ServerAddress string
+	// Serving is the TLS and authentication configuration of the node problem detector
+	// server and the Prometheus scrape endpoint.
+	Serving serving.Config
 
 	// exporter options
 
@@ -61,6 +77,55 @@ type NodeProblemDetectorOptions struct {
 	APIServerWaitInterval time.Duration
 	// K8sExporterHeartbeatPeriod is the period at which the k8s exporter does forcibly sync with apiserver.
 	K8sExporterHeartbeatPeriod time.Duration
+	// K8sExporterPodSignalConfigPath is the path to the config of annotating or evicting
+	// pods that problems are attributed to. Empty disables it.
+	K8sExporterPodSignalConfigPath string
+	// K8sExporterConditionUpdateStrategy is how node conditions are updated: "patch" with a
+	// strategic merge patch, or "apply" with server-side apply.
+	K8sExporterConditionUpdateStrategy string
+	// K8sExporterFieldManager is the field manager owning the node conditions with server-side apply.
+	K8sExporterFieldManager string
+	// K8sExporterApplyConflictPolicy decides what happens when conditions applied with server-side
+	// apply are owned by another field manager: "fail" or "force".
+	K8sExporterApplyConflictPolicy string
+	// K8sExporterEventAPI is the API events are written with: "v1", "events.k8s.io/v1beta1"
+	// or "events.k8s.io/v1".
+	K8sExporterEventAPI string
+	// K8sExporterEventTargetConfigPath is the path to the config of the objects events
+	// are attached to. Empty attaches all events to the Node.
+	K8sExporterEventTargetConfigPath string
+	// ConditionTypePrefix is prepended to the types of all node conditions set by the k8s
+	// exporter, e.g. "npd.k8s.io/".
+	ConditionTypePrefix string
+	// MigrateUnprefixedConditions removes the unprefixed conditions of the types set with
+	// ConditionTypePrefix from the node.
+	MigrateUnprefixedConditions bool
+	// K8sExporterConditionProvenance is how the node-problem-detector version and config
+	// hash are attached to the node conditions: "none", "message" or "annotation".
+	K8sExporterConditionProvenance string
+	// K8sExporterNoiseAnalysis is the flag determining whether the problems are scored by
+	// noise and served on /noise/report.
+	K8sExporterNoiseAnalysis bool
+	// K8sExporterNoiseAnalysisWindow is the period the noise report covers.
+	K8sExporterNoiseAnalysisWindow time.Duration
+	// K8sExporterProblemHistorySize is the number of the last problems served on
+	// /problems/history. Use 0 to disable.
+	K8sExporterProblemHistorySize int
+	// K8sExporterDrainStuckDeadline is how long pods may terminate while the node is drained
+	// before they are reported as stuck. Use 0 to disable.
+	K8sExporterDrainStuckDeadline time.Duration
+	// K8sExporterNodeReadyTimeout is how long the k8s exporter defers exporting problems
+	// until the node is registered and Ready. 0 disables the deferral.
+	K8sExporterNodeReadyTimeout time.Duration
+	// K8sExporterRetryInitialBackoff is the delay before retrying a write failing because the
+	// apiserver is unavailable. The delay doubles after each failure up to K8sExporterRetryMaxBackoff.
+	K8sExporterRetryInitialBackoff time.Duration
+	// K8sExporterRetryMaxBackoff is the maximum delay between the retries of a write.
+	K8sExporterRetryMaxBackoff time.Duration
+	// K8sExporterResyncCheckPeriod is the period at which the k8s exporter gets the node to
+	// re-assert all conditions after the apiserver connection recovers or the node object
+	// is re-created. 0 disables the checks.
+	K8sExporterResyncCheckPeriod time.Duration
 
 	// prometheusExporter options
 	// PrometheusServerPort is the port to bind the Prometheus scrape endpoint. Use 0 to disable.
@@ -68,6 +133,79 @@ type NodeProblemDetectorOptions struct {
 	// PrometheusServerAddress is the address to bind the Prometheus scrape endpoint.
 	PrometheusServerAddress string
 
+	// ExporterFullSyncPeriod is the period at which the full state of all problem daemons
+	// is synced to the exporters. Between full syncs only changes are exported.
+	ExporterFullSyncPeriod time.Duration
+
+	// HeartbeatPeriod is the period at which the NPDHealthy heartbeat condition is
+	// exported. Use 0 to disable.
+	HeartbeatPeriod time.Duration
+
+	// EgressBudgetBytesPerMinute is the number of bytes of problems push exporters may
+	// send per minute. Use 0 to disable the limit.
+	EgressBudgetBytesPerMinute int64
+
+	// AdminAddress is the address to serve the admin API operating the problem daemons
+	// at runtime. Empty disables it. It must be a loopback address unless clients are
+	// authenticated.
+	AdminAddress string
+
+	// ConditionCorrelationConfigPath is the path to the rules deriving conditions from the
+	// combinations of other conditions. Empty disables it.
+	ConditionCorrelationConfigPath string
+
+	// ProblemSummaryConfigPath is the path to the config of the problem summary metrics.
+	// Empty disables them.
+	ProblemSummaryConfigPath string
+
+	// HealthScoreConfigPath is the path to the config of the node health score. Empty
+	// disables it.
+	HealthScoreConfigPath string
+
+	// ProblemBudgetConfigPath is the path to the config of the budgets of condition
+	// transitions whose events are exported. Empty disables them.
+	ProblemBudgetConfigPath string
+
+	// FlapDampingConfigPath is the path to the config of the damping of the flapping
+	// conditions. Empty disables it.
+	FlapDampingConfigPath string
+
+	// EventJournalConfigPath is the path to the config of the journal of the exported
+	// problems, which are replayed after a restart if they were not delivered. Empty
+	// disables it.
+	EventJournalConfigPath string
+
+	// NodeEnrichmentConfigPath is the path to the config of the node labels and annotations
+	// the exported problems are enriched with.
+	NodeEnrichmentConfigPath string
+	// SuppressionConfigPath is the path to the config of the maintenance windows
+	// suppressing problems. Empty disables them.
+	SuppressionConfigPath string
+
+	// DryRun runs all problem daemons without writing node conditions or events to
+	// Kubernetes. Problems are logged, and written to DryRunOutputPath if it is set.
+	DryRun bool
+	// DryRunOutputPath is the path to the file problems are appended to as JSON lines in
+	// dry run mode. Empty only logs them.
+	DryRunOutputPath string
+
+	// ProblemSocket is the path to the Unix domain socket streaming the problems as
+	// newline delimited JSON to local consumers. Empty disables it.
+	ProblemSocket string
+
+	// metrics options
+
+	// MetricsNamingScheme decides which names metrics are exported under: legacy, v2 or compat.
+	MetricsNamingScheme string
+	// ProblemMetricsLabels are the keys of the rule labels which label the problem metrics.
+	ProblemMetricsLabels []string
+
+	// tracing options
+
+	// TracingSampleProbability is the probability at which the detection of problems is
+	// traced, from reading a log line to exporting the problems. 0 disables tracing.
+	TracingSampleProbability float64
+
 	// problem daemon options
 
 	// SystemLogMonitorConfigPaths specifies the list of paths to system log monitor configuration
@@ -82,11 +220,25 @@ type NodeProblemDetectorOptions struct {
 	CustomPluginMonitorConfigPaths []string
 	// MonitorConfigPaths specifies the list of paths to configuration files for each monitor.
 	MonitorConfigPaths types.ProblemDaemonConfigPathMap
+	// ConfigMapSelector is the label selector of the ConfigMaps carrying problem daemon
+	// configurations. Empty disables loading configurations from ConfigMaps.
+	ConfigMapSelector string
+	// ConfigMapNamespace is the namespace of the ConfigMaps carrying problem daemon
+	// configurations.
+	ConfigMapNamespace string
+	// ConfigMapDir is the directory the configurations in ConfigMaps are written to.
+	ConfigMapDir string
+	// ConfigMapAllowedExecutables are the paths of the commands the configurations in
+	// ConfigMaps may run, e.g. custom plugins. Empty allows none.
+	ConfigMapAllowedExecutables []string
 
 	// application options
 
 	// NodeName is the node name used to communicate with Kubernetes ApiServer.
 	NodeName string
+	// NodeUID is the UID of the node, or empty if the node identity provider does not
+	// know it.
+	NodeUID string
 }
 
 func NewNodeProblemDetectorOptions() *NodeProblemDetectorOptions {
@@ -109,22 +261,115 @@ func (npdo *NodeProblemDetectorOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&npdo.EnableK8sExporter, "enable-k8s-exporter", true, "Enables reporting to Kubernetes API server.")
 	fs.StringVar(&npdo.EventNamespace, "event-namespace", "", "Namespace for recorded Kubernetes events.")
 	fs.StringVar(&npdo.ApiServerOverride, "apiserver-override",
-		"", "Custom URI used to connect to Kubernetes ApiServer. This is ignored if --enable-k8s-exporter is false.")
+		"", "Custom URI used to connect to Kubernetes ApiServer. This is ignored if --enable-k8s-exporter is false and --config-map-selector is empty.")
 	fs.DurationVar(&npdo.APIServerWaitTimeout, "apiserver-wait-timeout", time.Duration(5)*time.Minute, "The timeout on waiting for kube-apiserver to be ready. This is ignored if --enable-k8s-exporter is false.")
 	fs.DurationVar(&npdo.APIServerWaitInterval, "apiserver-wait-interval", time.Duration(5)*time.Second, "The interval between the checks on the readiness of kube-apiserver. This is ignored if --enable-k8s-exporter is false.")
 	fs.DurationVar(&npdo.K8sExporterHeartbeatPeriod, "k8s-exporter-heartbeat-period", 5*time.Minute, "The period at which k8s-exporter does forcibly sync with apiserver.")
+	fs.StringVar(&npdo.K8sExporterPodSignalConfigPath, "k8s-exporter-pod-signal-config", "",
+		"Path to the config of annotating or evicting the pods that problems are attributed to. Set to empty string to disable. This is ignored if --enable-k8s-exporter is false.")
+	fs.StringVar(&npdo.K8sExporterConditionUpdateStrategy, "k8s-exporter-condition-update-strategy", "patch",
+		"How node conditions are updated. Supported: patch (strategic merge patch) and apply (server-side apply with --k8s-exporter-field-manager). This is ignored if --enable-k8s-exporter is false.")
+	fs.StringVar(&npdo.K8sExporterFieldManager, "k8s-exporter-field-manager", "node-problem-detector",
+		"The field manager owning the node conditions when --k8s-exporter-condition-update-strategy is apply.")
+	fs.StringVar(&npdo.K8sExporterApplyConflictPolicy, "k8s-exporter-apply-conflict-policy", "fail",
+		"What to do when conditions applied with server-side apply are owned by another field manager. Supported: fail (do not update them) and force (take over their ownership).")
+	fs.StringVar(&npdo.K8sExporterEventAPI, "k8s-exporter-event-api", "v1",
+		"The API events are written with. Supported: v1, events.k8s.io/v1beta1 and events.k8s.io/v1. With events.k8s.io, repeated events are counted in the series of their first occurrence. This is ignored if --enable-k8s-exporter is false.")
+	fs.StringVar(&npdo.K8sExporterEventTargetConfigPath, "k8s-exporter-event-target-config", "",
+		"Path to the config of the objects events are attached to. Set to empty string to attach all events to the Node. This is ignored if --enable-k8s-exporter is false.")
+	fs.StringVar(&npdo.ConditionTypePrefix, "condition-type-prefix", "",
+		"The prefix of the types of all node conditions set by the k8s exporter, e.g. npd.k8s.io/ to set npd.k8s.io/KernelDeadlock, so that multiple detectors on the same node do not overwrite each other's conditions. Set to empty string to disable.")
+	fs.BoolVar(&npdo.MigrateUnprefixedConditions, "migrate-unprefixed-conditions", false,
+		"Remove the unprefixed conditions of the types set with --condition-type-prefix from the node, e.g. KernelDeadlock set before the prefix was configured. Only enable it if no other detector sets these conditions.")
+	fs.StringVar(&npdo.K8sExporterConditionProvenance, "k8s-exporter-condition-provenance", "none",
+		"How the node-problem-detector version and config hash are attached to the node conditions, to tell which version and config produced them. Supported: none, message (a suffix of the condition messages) and annotation (a node annotation). This is ignored if --enable-k8s-exporter is false.")
+	fs.BoolVar(&npdo.K8sExporterNoiseAnalysis, "k8s-exporter-noise-analysis", false,
+		"Score the problems by how often they churn without the node becoming NotReady, and serve the scores and tuning suggestions on /noise/report. Requires permission to get the node. This is ignored if --enable-k8s-exporter is false.")
+	fs.DurationVar(&npdo.K8sExporterNoiseAnalysisWindow, "k8s-exporter-noise-analysis-window", 24*time.Hour,
+		"The period the noise report covers.")
+	fs.IntVar(&npdo.K8sExporterProblemHistorySize, "k8s-exporter-problem-history-size", 100,
+		"The number of the last events and condition transitions served on /problems/history. Use 0 to disable. This is ignored if --enable-k8s-exporter is false.")
+	fs.DurationVar(&npdo.K8sExporterDrainStuckDeadline, "k8s-exporter-drain-stuck-deadline", 0,
+		"How long pods may be terminating past their deletion timestamp while the node is cordoned before a DrainStuck event reports them. Requires permission to list pods. Use 0 to disable. This is ignored if --enable-k8s-exporter is false.")
+	fs.DurationVar(&npdo.K8sExporterNodeReadyTimeout, "k8s-exporter-node-ready-timeout", 0,
+		"How long to defer exporting problems until the node is registered and Ready, so that problems detected on boot before the kubelet registers the node are not exported as failed patches and misleading events. Problems detected meanwhile are exported once the node is Ready or the timeout passes. Use 0 to disable. This is ignored if --enable-k8s-exporter is false.")
+	fs.DurationVar(&npdo.K8sExporterRetryInitialBackoff, "k8s-exporter-retry-initial-backoff", time.Second,
+		"The delay before retrying condition updates and events which failed because the apiserver is unavailable. The delay doubles after each failed retry. Events recorded meanwhile are buffered, up to 1000 per event source. This is ignored if --enable-k8s-exporter is false.")
+	fs.DurationVar(&npdo.K8sExporterRetryMaxBackoff, "k8s-exporter-retry-max-backoff", 2*time.Minute,
+		"The maximum delay between the retries of condition updates and events. This is ignored if --enable-k8s-exporter is false.")
+	fs.DurationVar(&npdo.K8sExporterResyncCheckPeriod, "k8s-exporter-resync-check-period", 0,
+		"The period at which the node is got to re-assert all conditions right away when the apiserver connection recovers or the node object is re-created, instead of at the next heartbeat. Use 0 to disable. This is ignored if --enable-k8s-exporter is false.")
 	fs.BoolVar(&npdo.PrintVersion, "version", false, "Print version information and quit")
 	fs.StringVar(&npdo.HostnameOverride, "hostname-override",
 		"", "Custom node name used to override hostname")
+	fs.StringSliceVar(&npdo.NodeIdentityProviders, "node-identity-providers", nodeidentity.DefaultProviders,
+		"The providers identifying the node, comma separated in the order of precedence. Supported providers are override (--hostname-override), env (NODE_NAME and NODE_UID env), hostname, cloud-metadata (GCE or AWS instance metadata) and kubelet (kubelet summary API).")
+	fs.StringVar(&npdo.NodeIdentityKubeletEndpoint, "node-identity-kubelet-endpoint", "http://127.0.0.1:10255",
+		"The base URL of the kubelet API used by the kubelet node identity provider.")
 	fs.IntVar(&npdo.ServerPort, "port",
 		20256, "The port to bind the node problem detector server. Use 0 to disable.")
 	fs.StringVar(&npdo.ServerAddress, "address",
 		"127.0.0.1", "The address to bind the node problem detector server.")
+	fs.StringVar(&npdo.Serving.CertFile, "tls-cert-file", "",
+		"Path to the certificate serving the node problem detector server and the Prometheus scrape endpoint with TLS. The certificate is reloaded when the file changes. Set to empty string to serve plain HTTP.")
+	fs.StringVar(&npdo.Serving.KeyFile, "tls-private-key-file", "",
+		"Path to the private key of --tls-cert-file.")
+	fs.StringVar(&npdo.Serving.ClientCAFile, "client-ca-file", "",
+		"Path to the CA bundle authenticating clients of the node problem detector server and the Prometheus scrape endpoint by their certificates. Requires --tls-cert-file.")
+	fs.StringVar(&npdo.Serving.TokenFile, "auth-token-file", "",
+		"Path to the file of the bearer tokens authenticating clients of the node problem detector server and the Prometheus scrape endpoint, one per line. Requires --tls-cert-file.")
+	fs.StringVar(&npdo.Serving.BasicAuthFile, "auth-basic-file", "",
+		"Path to the file of the user:password credentials authenticating clients of the node problem detector server and the Prometheus scrape endpoint with basic auth, one per line. Requires --tls-cert-file.")
 
 	fs.IntVar(&npdo.PrometheusServerPort, "prometheus-port",
 		20257, "The port to bind the Prometheus scrape endpoint. Prometheus exporter is enabled by default at port 20257. Use 0 to disable.")
 	fs.StringVar(&npdo.PrometheusServerAddress, "prometheus-address",
 		"127.0.0.1", "The address to bind the Prometheus scrape endpoint.")
+	fs.DurationVar(&npdo.ExporterFullSyncPeriod, "exporter-full-sync-period", 5*time.Minute,
+		"The period at which the full state of all problem daemons is synced to the exporters. Between full syncs only changed conditions and new events are exported. Use 0 to disable.")
+	fs.DurationVar(&npdo.HeartbeatPeriod, "heartbeat-period", 0,
+		"The period at which the NPDHealthy heartbeat condition is exported. The condition is true as long as the goroutines of node-problem-detector make progress. Use 0 to disable.")
+	fs.Int64Var(&npdo.EgressBudgetBytesPerMinute, "egress-budget-bytes-per-minute", 0,
+		"The number of bytes of problems push exporters (e.g. the k8s exporter) may send per minute, shared by all push exporters. When exceeded, conditions are sent before warning events, and warning events before info events. Use 0 to disable.")
+	fs.StringVar(&npdo.AdminAddress, "admin-address", "",
+		"The address to serve the admin API pausing, resuming, triggering and reloading problem daemons at, e.g. 127.0.0.1:20259. It is served with --tls-cert-file and authenticated like the node problem detector server, and must be a loopback address unless clients are authenticated. Set to empty string to disable.")
+	fs.StringVar(&npdo.ConditionCorrelationConfigPath, "config.condition-correlation", "",
+		"Path to the config of the rules deriving conditions from the combinations of other conditions. Set to empty string to disable.")
+	fs.StringVar(&npdo.ProblemSummaryConfigPath, "config.problem-summary", "",
+		"Path to the config of the problem summary metrics, which roll up the problems of all problem daemons for SLO dashboards. Set to empty string to disable.")
+	fs.StringVar(&npdo.HealthScoreConfigPath, "config.health-score", "",
+		"Path to the config of the node health score, which combines the configured conditions and metrics into a 0-100 score exported as a metric and a node annotation. Set to empty string to disable.")
+	fs.StringVar(&npdo.ProblemBudgetConfigPath, "config.problem-budget", "",
+		"Path to the config of the budgets of condition transitions per day. Beyond its budget, the conditions are still exported but the events of their transitions are collapsed into periodic summary events. Set to empty string to disable.")
+	fs.StringVar(&npdo.FlapDampingConfigPath, "config.flap-damping", "",
+		"Path to the config of the flap damping, which holds the conditions toggling too often in their problem state, or sets a separate <Condition>Flapping condition, until they are stable, to prevent alert storms. Set to empty string to disable.")
+	fs.StringVar(&npdo.EventJournalConfigPath, "config.event-journal", "",
+		"Path to the config of the event journal, which writes the exported problems to an append-only file on the host and replays the ones not delivered to the apiserver after a restart, so that condition transitions are delivered at least once. Set to empty string to disable.")
+	fs.StringVar(&npdo.NodeEnrichmentConfigPath, "config.node-enrichment", "",
+		"Path to the config of the node labels and annotations, e.g. the topology zone, the exported events and notifications are enriched with, so that they can be routed without joining them with the nodes. Requires permission to get the node. Set to empty string to disable.")
+	fs.StringVar(&npdo.SuppressionConfigPath, "config.suppression", "",
+		"Path to the config of the maintenance windows, which suppress the matching problems so that planned maintenance does not flip node conditions and page on-call. Suppressed problems are still counted in the problem metrics with the suppressed=\"true\" label. Set to empty string to disable.")
+	fs.BoolVar(&npdo.DryRun, "dry-run", false,
+		"Run all problem daemons without writing node conditions or events to Kubernetes, which disables the k8s exporter. Problems are logged, written to --dry-run-output, and exported as metrics, so that new rules can be validated safely.")
+	fs.StringVar(&npdo.DryRunOutputPath, "dry-run-output", "",
+		"Path to the file problems are appended to as JSON lines in dry run mode. Set to empty string to only log them. This is ignored if --dry-run is false.")
+	fs.StringVar(&npdo.ProblemSocket, "problem-socket", "",
+		"Path to the Unix domain socket streaming the problems as newline delimited JSON to local consumers, e.g. a node-local remediation agent. Consumers are sent the full state on connect. Set to empty string to disable.")
+	fs.StringVar(&npdo.MetricsNamingScheme, "metrics-naming-scheme", string(metrics.LegacyNaming),
+		"The names metrics are exported under. Supported: legacy, v2 and compat. compat exports both the v2 and the legacy names, to migrate dashboards without a gap.")
+	fs.StringSliceVar(&npdo.ProblemMetricsLabels, "problem-metrics-labels", []string{},
+		"The keys of the rule labels, e.g. runbook, added as labels to problem_counter and problem_gauge. The other rule labels only annotate the events. Keep the values of these labels low-cardinality.")
+	fs.Float64Var(&npdo.TracingSampleProbability, "tracing-sample-probability", 0,
+		"The probability in [0, 1] at which the detection of problems is traced, from reading a log line through matching the rules to exporting the problems. The traces are exported by the OTLP exporter with exportTraces. Set to 0 to disable tracing.")
+
+	fs.StringVar(&npdo.ConfigMapSelector, "config-map-selector", "",
+		"The label selector of the ConfigMaps carrying problem daemon configurations, e.g. node-problem-detector.k8s.io/config=true. Each key of the ConfigMaps configures a problem daemon, which is re-created when the key changes. Requires permission to list and watch ConfigMaps. Set to empty string to disable.")
+	fs.StringVar(&npdo.ConfigMapNamespace, "config-map-namespace", "kube-system",
+		"The namespace of the ConfigMaps selected by --config-map-selector.")
+	fs.StringVar(&npdo.ConfigMapDir, "config-map-dir", "/var/lib/node-problem-detector/config-maps",
+		"The directory the configurations in the ConfigMaps selected by --config-map-selector are written to, so that the problem daemons read them like configuration files.")
+	fs.StringSliceVar(&npdo.ConfigMapAllowedExecutables, "config-map-allowed-executables", nil,
+		"The paths of the commands the configurations in the ConfigMaps selected by --config-map-selector may run, e.g. the plugins of custom plugin monitors. Configurations running other commands are skipped, since they would run as root on the node. Empty allows none.")
 
 	for _, exporterName := range exporters.GetExporterNames() {
 		exporterHandler := exporters.GetExporterHandlerOrDie(exporterName)
@@ -143,11 +388,58 @@ func (npdo *NodeProblemDetectorOptions) AddFlags(fs *pflag.FlagSet) {
 
 // ValidOrDie validates node problem detector command line options.
 func (npdo *NodeProblemDetectorOptions) ValidOrDie() {
-	if _, err := url.Parse(npdo.ApiServerOverride); npdo.EnableK8sExporter && err != nil {
+	if _, err := url.Parse(npdo.ApiServerOverride); (npdo.EnableK8sExporter || npdo.ConfigMapSelector != "") && err != nil {
 		panic(fmt.Sprintf("apiserver-override %q is not a valid HTTP URI: %v",
 			npdo.ApiServerOverride, err))
 	}
 
+	if npdo.EnableK8sExporter && npdo.K8sExporterNodeReadyTimeout < 0 {
+		panic(fmt.Sprintf("k8s-exporter-node-ready-timeout %v must not be negative", npdo.K8sExporterNodeReadyTimeout))
+	}
+	if npdo.EnableK8sExporter && npdo.K8sExporterRetryInitialBackoff <= 0 {
+		panic(fmt.Sprintf("k8s-exporter-retry-initial-backoff %v must be positive", npdo.K8sExporterRetryInitialBackoff))
+	}
+	if npdo.EnableK8sExporter && npdo.K8sExporterRetryMaxBackoff < npdo.K8sExporterRetryInitialBackoff {
+		panic(fmt.Sprintf("k8s-exporter-retry-max-backoff %v must not be less than k8s-exporter-retry-initial-backoff %v",
+			npdo.K8sExporterRetryMaxBackoff, npdo.K8sExporterRetryInitialBackoff))
+	}
+
+	if npdo.EnableK8sExporter && npdo.K8sExporterResyncCheckPeriod < 0 {
+		panic(fmt.Sprintf("k8s-exporter-resync-check-period %v must not be negative", npdo.K8sExporterResyncCheckPeriod))
+	}
+
+	if err := npdo.Serving.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid TLS or authentication options: %v", err))
+	}
+
+	if npdo.AdminAddress != "" {
+		host, _, err := net.SplitHostPort(npdo.AdminAddress)
+		if err != nil {
+			panic(fmt.Sprintf("admin-address %q is not a valid address: %v", npdo.AdminAddress, err))
+		}
+		if ip := net.ParseIP(host); !npdo.Serving.Authenticates() && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			panic(fmt.Sprintf("admin-address %q must be a loopback address unless clients are authenticated", npdo.AdminAddress))
+		}
+	}
+
+	if npdo.TracingSampleProbability < 0 || npdo.TracingSampleProbability > 1 {
+		panic(fmt.Sprintf("tracing-sample-probability %v must be in [0, 1]", npdo.TracingSampleProbability))
+	}
+
+	if npdo.ConditionTypePrefix != "" {
+		// The prefix must form valid condition types, check it with a sample condition type.
+		if errs := validation.IsQualifiedName(npdo.ConditionTypePrefix + "KernelDeadlock"); len(errs) != 0 {
+			panic(fmt.Sprintf("condition-type-prefix %q does not form valid condition types: %v",
+				npdo.ConditionTypePrefix, errs))
+		}
+	}
+	if npdo.MigrateUnprefixedConditions && npdo.ConditionTypePrefix == "" {
+		panic("migrate-unprefixed-conditions requires condition-type-prefix")
+	}
+	if err := problemmetrics.ValidateRuleLabels(npdo.ProblemMetricsLabels); err != nil {
+		panic(fmt.Sprintf("invalid problem-metrics-labels: %v", err))
+	}
+
 	if len(npdo.SystemLogMonitorConfigPaths) != 0 {
 		panic("SystemLogMonitorConfigPaths is deprecated. It should have been reassigned to MonitorConfigPaths. This should not happen.")
 	}
@@ -159,7 +451,14 @@ func (npdo *NodeProblemDetectorOptions) ValidOrDie() {
 	for _, problemDaemonConfigPaths := range npdo.MonitorConfigPaths {
 		configCount += len(*problemDaemonConfigPaths)
 	}
-	if configCount == 0 {
+	if npdo.ConfigMapSelector != "" {
+		if _, err := labels.Parse(npdo.ConfigMapSelector); err != nil {
+			panic(fmt.Sprintf("config-map-selector %q is not a valid label selector: %v", npdo.ConfigMapSelector, err))
+		}
+		if npdo.ConfigMapNamespace == "" {
+			panic("config-map-namespace must be set with config-map-selector")
+		}
+	} else if configCount == 0 {
 		panic("No configuration option for any problem daemon is specified.")
 	}
 }
@@ -211,34 +510,32 @@ func (npdo *NodeProblemDetectorOptions) SetConfigFromDeprecatedOptionsOrDie() {
 	}
 }
 
-// SetNodeNameOrDie sets `NodeName` field with valid value.
+// SetNodeNameOrDie sets `NodeName` and `NodeUID` fields with the identity of the first node
+// identity provider which identifies the node.
+//
+// By default, the hostname override is checked first for customized node name, then the
+// NODE_NAME env, which should have been set with downward api or user defined exported
+// environment variable. We prefer it because sometimes the hostname returned by os.Hostname
+// is not right because:
+// 1. User may override the hostname.
+// 2. For some cloud providers, os.Hostname is different from the real hostname.
+// For backward compatibility, the hostname is used if neither is set. This may not work for
+// all configurations and environments, which configure the providers instead.
 func (npdo *NodeProblemDetectorOptions) SetNodeNameOrDie() {
-	// Check hostname override first for customized node name.
-	if npdo.HostnameOverride != "" {
-		npdo.NodeName = npdo.HostnameOverride
-		return
-	}
-
-	// Get node name from environment variable NODE_NAME
-	// By default, assume that the NODE_NAME env should have been set with
-	// downward api or user defined exported environment variable. We prefer it because sometimes
-	// the hostname returned by os.Hostname is not right because:
-	// 1. User may override the hostname.
-	// 2. For some cloud providers, os.Hostname is different from the real hostname.
-	npdo.NodeName = os.Getenv("NODE_NAME")
-	if npdo.NodeName != "" {
-		return
-	}
-
-	// For backward compatibility. If the env is not set, get the hostname
-	// from os.Hostname(). This may not work for all configurations and
-	// environments.
-	nodeName, err := os.Hostname()
+	providers, err := nodeidentity.NewProviders(npdo.NodeIdentityProviders, nodeidentity.Config{
+		HostnameOverride: npdo.HostnameOverride,
+		KubeletEndpoint:  npdo.NodeIdentityKubeletEndpoint,
+	})
 	if err != nil {
-		panic(fmt.Sprintf("Failed to get host name: %v", err))
+		panic(fmt.Sprintf("Invalid node identity providers: %v", err))
 	}
-
-	npdo.NodeName = nodeName
+	identity, err := nodeidentity.Identify(providers)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to identify the node: %v", err))
+	}
+	glog.Infof("Node identified as %q by node identity provider %q", identity.Name, identity.Provider)
+	npdo.NodeName = identity.Name
+	npdo.NodeUID = identity.UID
 }
 
 func init() {
@@ -19,11 +19,14 @@ package options
 import (
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/serving"
 )
 
 func equalMonitorConfigPaths(npdoX NodeProblemDetectorOptions, npdoY NodeProblemDetectorOptions) bool {
@@ -60,6 +63,7 @@ func equalMonitorConfigPaths(npdoX NodeProblemDetectorOptions, npdoY NodeProblem
 type options struct {
 	Nodename         string
 	HostnameOverride string
+	Providers        []string
 }
 
 // TestSetNodeNameOrDie tests for permutations of nodename, hostname and hostnameoverride.
@@ -88,12 +92,20 @@ func TestSetNodeNameOrDie(t *testing.T) {
 			},
 		},
 		"Check hostname override, NODE_NAME env and hostname": {
-			WantedNodeName: hostName,
+			WantedNodeName: strings.ToLower(hostName),
 			Meta: options{
 				Nodename:         "",
 				HostnameOverride: "",
 			},
 		},
+		"Check NODE_NAME env before hostname override": {
+			WantedNodeName: "node-name-env",
+			Meta: options{
+				Nodename:         "node-name-env",
+				HostnameOverride: "hostname-override",
+				Providers:        []string{"env", "override"},
+			},
+		},
 	}
 
 	for desc, ut := range uts {
@@ -111,6 +123,7 @@ func TestSetNodeNameOrDie(t *testing.T) {
 
 		npdOpts := NewNodeProblemDetectorOptions()
 		npdOpts.HostnameOverride = ut.Meta.HostnameOverride
+		npdOpts.NodeIdentityProviders = ut.Meta.Providers
 		npdOpts.SetNodeNameOrDie()
 
 		if npdOpts.NodeName != ut.WantedNodeName {
@@ -140,30 +153,95 @@ func TestValidOrDie(t *testing.T) {
 		{
 			name: "enables k8s exporter config",
 			npdo: NodeProblemDetectorOptions{
-				ApiServerOverride:  "",
-				EnableK8sExporter:  true,
-				MonitorConfigPaths: fooMonitorConfigMap,
+				ApiServerOverride:              "",
+				EnableK8sExporter:              true,
+				MonitorConfigPaths:             fooMonitorConfigMap,
+				K8sExporterRetryInitialBackoff: time.Second,
+				K8sExporterRetryMaxBackoff:     time.Minute,
 			},
 			expectPanic: false,
 		},
 		{
 			name: "k8s exporter config with valid ApiServerOverride",
 			npdo: NodeProblemDetectorOptions{
-				ApiServerOverride:  "127.0.0.1",
-				EnableK8sExporter:  true,
-				MonitorConfigPaths: fooMonitorConfigMap,
+				ApiServerOverride:              "127.0.0.1",
+				EnableK8sExporter:              true,
+				MonitorConfigPaths:             fooMonitorConfigMap,
+				K8sExporterRetryInitialBackoff: time.Second,
+				K8sExporterRetryMaxBackoff:     time.Minute,
 			},
 			expectPanic: false,
 		},
 		{
 			name: "k8s exporter config with invalid ApiServerOverride",
 			npdo: NodeProblemDetectorOptions{
-				ApiServerOverride:  ":foo",
+				ApiServerOverride:              ":foo",
+				EnableK8sExporter:              true,
+				MonitorConfigPaths:             fooMonitorConfigMap,
+				K8sExporterRetryInitialBackoff: time.Second,
+				K8sExporterRetryMaxBackoff:     time.Minute,
+			},
+			expectPanic: true,
+		},
+		{
+			name: "k8s exporter config without retry backoff",
+			npdo: NodeProblemDetectorOptions{
 				EnableK8sExporter:  true,
 				MonitorConfigPaths: fooMonitorConfigMap,
 			},
 			expectPanic: true,
 		},
+		{
+			name: "k8s exporter config with max retry backoff less than initial",
+			npdo: NodeProblemDetectorOptions{
+				EnableK8sExporter:              true,
+				MonitorConfigPaths:             fooMonitorConfigMap,
+				K8sExporterRetryInitialBackoff: time.Minute,
+				K8sExporterRetryMaxBackoff:     time.Second,
+			},
+			expectPanic: true,
+		},
+		{
+			name: "tracing sample probability",
+			npdo: NodeProblemDetectorOptions{
+				TracingSampleProbability: 0.01,
+				MonitorConfigPaths:       fooMonitorConfigMap,
+			},
+			expectPanic: false,
+		},
+		{
+			name: "tracing sample probability above 1",
+			npdo: NodeProblemDetectorOptions{
+				TracingSampleProbability: 2,
+				MonitorConfigPaths:       fooMonitorConfigMap,
+			},
+			expectPanic: true,
+		},
+		{
+			name: "valid condition type prefix",
+			npdo: NodeProblemDetectorOptions{
+				ConditionTypePrefix:         "npd.k8s.io/",
+				MigrateUnprefixedConditions: true,
+				MonitorConfigPaths:          fooMonitorConfigMap,
+			},
+			expectPanic: false,
+		},
+		{
+			name: "invalid condition type prefix",
+			npdo: NodeProblemDetectorOptions{
+				ConditionTypePrefix: "npd k8s io/",
+				MonitorConfigPaths:  fooMonitorConfigMap,
+			},
+			expectPanic: true,
+		},
+		{
+			name: "migrate unprefixed conditions without prefix",
+			npdo: NodeProblemDetectorOptions{
+				MigrateUnprefixedConditions: true,
+				MonitorConfigPaths:          fooMonitorConfigMap,
+			},
+			expectPanic: true,
+		},
 		{
 			name: "non-empty MonitorConfigPaths",
 			npdo: NodeProblemDetectorOptions{
@@ -178,6 +256,57 @@ func TestValidOrDie(t *testing.T) {
 			},
 			expectPanic: true,
 		},
+		{
+			name: "ConfigMapSelector with empty MonitorConfigPaths",
+			npdo: NodeProblemDetectorOptions{
+				MonitorConfigPaths: emptyMonitorConfigMap,
+				ConfigMapSelector:  "node-problem-detector.k8s.io/config=true",
+				ConfigMapNamespace: "kube-system",
+			},
+			expectPanic: false,
+		},
+		{
+			name: "invalid ConfigMapSelector",
+			npdo: NodeProblemDetectorOptions{
+				MonitorConfigPaths: fooMonitorConfigMap,
+				ConfigMapSelector:  "node-problem-detector.k8s.io/config==(",
+				ConfigMapNamespace: "kube-system",
+			},
+			expectPanic: true,
+		},
+		{
+			name: "authentication without TLS",
+			npdo: NodeProblemDetectorOptions{
+				MonitorConfigPaths: fooMonitorConfigMap,
+				Serving:            serving.Config{TokenFile: "/etc/npd/tokens"},
+			},
+			expectPanic: true,
+		},
+		{
+			name: "admin address on localhost",
+			npdo: NodeProblemDetectorOptions{
+				MonitorConfigPaths: fooMonitorConfigMap,
+				AdminAddress:       "127.0.0.1:20259",
+			},
+			expectPanic: false,
+		},
+		{
+			name: "unauthenticated admin address on the node network",
+			npdo: NodeProblemDetectorOptions{
+				MonitorConfigPaths: fooMonitorConfigMap,
+				AdminAddress:       "0.0.0.0:20259",
+			},
+			expectPanic: true,
+		},
+		{
+			name: "authenticated admin address on the node network",
+			npdo: NodeProblemDetectorOptions{
+				MonitorConfigPaths: fooMonitorConfigMap,
+				AdminAddress:       "0.0.0.0:20259",
+				Serving:            serving.Config{CertFile: "/etc/npd/tls.crt", KeyFile: "/etc/npd/tls.key", TokenFile: "/etc/npd/tokens"},
+			},
+			expectPanic: false,
+		},
 		{
 			name:        "un-initialized MonitorConfigPaths",
 			npdo:        NodeProblemDetectorOptions{},
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook is an example of an exporter developed out of tree. It posts the
+// problems of node problem detector as JSON to an HTTP endpoint, and only uses the public
+// API of the exporters package.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/exporters"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+func init() {
+	exporters.RegisterWithConfigFile(exporterName, "Configuration for the webhook exporter, which posts the problems as JSON.", NewExporterOrDie)
+}
+
+const (
+	exporterName = "webhook"
+	// queueSize is the number of payloads waiting to be posted, beyond which payloads are
+	// dropped.
+	queueSize = 100
+)
+
+// Config is the config of the webhook exporter.
+type Config struct {
+	// URL is the URL the problems are posted to.
+	URL string `json:"url"`
+	// Headers are the headers added to the requests, e.g. for authorization.
+	Headers map[string]string `json:"headers"`
+	// Timeout is the timeout of the requests. Default to 10s.
+	Timeout         string `json:"timeout"`
+	TimeoutDuration time.Duration
+}
+
+// ApplyConfiguration implements exporters.Config.
+func (c *Config) ApplyConfiguration() error {
+	if c.Timeout == "" {
+		c.Timeout = (10 * time.Second).String()
+	}
+	var err error
+	c.TimeoutDuration, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q: %v", c.Timeout, err)
+	}
+	return nil
+}
+
+// Validate implements exporters.Config.
+func (c *Config) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q, expect an http or https URL", c.URL)
+	}
+	if c.TimeoutDuration <= 0 {
+		return fmt.Errorf("timeout must be positive, got %v", c.TimeoutDuration)
+	}
+	return nil
+}
+
+// Payload is the JSON body of the requests.
+type Payload struct {
+	Node       string            `json:"node"`
+	Source     string            `json:"source"`
+	Events     []types.Event     `json:"events,omitempty"`
+	Conditions []types.Condition `json:"conditions,omitempty"`
+}
+
+type webhookExporter struct {
+	config   Config
+	nodeName string
+	client   *http.Client
+	queue    chan *Payload
+	// stopOnce closes the queue once, done is closed when the queue is drained.
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewExporterOrDie creates a webhook exporter from the config file, panics if error occurs.
+func NewExporterOrDie(configPath string) types.Exporter {
+	config := Config{}
+	if err := exporters.LoadConfig(configPath, &config); err != nil {
+		glog.Fatalf("Failed to load webhook exporter config: %v", err)
+	}
+	glog.Infof("Starting webhook exporter %s", configPath)
+	return newWebhookExporter(config, util.GetNodeName())
+}
+
+func newWebhookExporter(config Config, nodeName string) *webhookExporter {
+	we := &webhookExporter{
+		config:   config,
+		nodeName: nodeName,
+		client:   &http.Client{Timeout: config.TimeoutDuration},
+		queue:    make(chan *Payload, queueSize),
+		done:     make(chan struct{}),
+	}
+	go we.postPayloads()
+	return we
+}
+
+// ExportProblems posts the new events and the changed conditions.
+func (we *webhookExporter) ExportProblems(status *types.Status) {
+	if len(status.Events) == 0 && len(status.Conditions) == 0 {
+		return
+	}
+	payload := &Payload{
+		Node:       we.nodeName,
+		Source:     status.Source,
+		Events:     status.Events,
+		Conditions: status.Conditions,
+	}
+	// The requests are posted asynchronously, so that a slow endpoint does not block
+	// the other exporters.
+	select {
+	case we.queue <- payload:
+	default:
+		glog.Errorf("Dropped problems of %s, too many problems are waiting to be posted", status.Source)
+		exporters.RecordFailure(exporterName, "problems")
+	}
+}
+
+// SyncProblems does nothing, the changes of the conditions are posted by ExportProblems.
+func (we *webhookExporter) SyncProblems(status *types.Status) {}
+
+// PushesProblems implements types.PushExporter, so that the webhook shares the egress
+// budget of the exporters pushing problems.
+func (we *webhookExporter) PushesProblems() bool {
+	return true
+}
+
+// Stop implements types.StoppableExporter, it posts the queued problems before returning.
+func (we *webhookExporter) Stop() {
+	we.stopOnce.Do(func() { close(we.queue) })
+	<-we.done
+}
+
+func (we *webhookExporter) postPayloads() {
+	defer close(we.done)
+	for payload := range we.queue {
+		if err := we.post(payload); err != nil {
+			glog.Errorf("Failed to post problems of %s to webhook: %v", payload.Source, err)
+			exporters.RecordFailure(exporterName, "problems")
+		}
+	}
+}
+
+func (we *webhookExporter) post(payload *Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, we.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range we.config.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := we.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestConfig(t *testing.T) {
+	config := Config{URL: "https://example.com/problems"}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, 10*time.Second, config.TimeoutDuration)
+
+	config = Config{URL: "example.com/problems"}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.Error(t, config.Validate())
+}
+
+func TestExportProblems(t *testing.T) {
+	payloads := make(chan Payload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		var payload Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	config := Config{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	assert.NoError(t, config.ApplyConfiguration())
+	we := newWebhookExporter(config, "node-1")
+
+	transition := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	condition := types.Condition{
+		Type:       "KernelDeadlock",
+		Status:     types.True,
+		Transition: transition,
+		Reason:     "DockerHung",
+		Message:    "task docker:7 blocked for more than 120 seconds.",
+	}
+	we.ExportProblems(&types.Status{Source: "kernel-monitor"})
+	we.ExportProblems(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{condition}})
+	we.SyncProblems(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{condition}})
+	// Stop posts the queued problems.
+	we.Stop()
+
+	close(payloads)
+	var got []Payload
+	for payload := range payloads {
+		got = append(got, payload)
+	}
+	assert.Equal(t, []Payload{{Node: "node-1", Source: "kernel-monitor", Conditions: []types.Condition{condition}}}, got)
+}
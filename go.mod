@@ -7,13 +7,15 @@ require (
 	code.cloudfoundry.org/clock v0.0.0-20180518195852-02e53af36e6c
 	contrib.go.opencensus.io/exporter/prometheus v0.0.0-20190427222117-f6cda26f80a3
 	contrib.go.opencensus.io/exporter/stackdriver v0.12.5
-	github.com/StackExchange/wmi v0.0.0-20181212234831-e0a55b97c705 // indirect
+	github.com/StackExchange/wmi v0.0.0-20181212234831-e0a55b97c705
 	github.com/avast/retry-go v2.4.1+incompatible
+	github.com/aws/aws-sdk-go v1.22.1
 	github.com/cobaugh/osrelease v0.0.0-20181218015638-a93a0a55a249
 	github.com/coreos/go-systemd v0.0.0-20190321100706-95778dfbb74e
 	github.com/euank/go-kmsg-parser v2.0.1+incompatible
 	github.com/go-ole/go-ole v1.2.4 // indirect
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
+	github.com/golang/protobuf v1.3.2
 	github.com/google/cadvisor v0.33.0
 	github.com/onsi/ginkgo v1.8.0
 	github.com/onsi/gomega v1.7.0
@@ -30,6 +32,8 @@ require (
 	go.opencensus.io v0.22.0
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
 	google.golang.org/api v0.7.0
+	google.golang.org/grpc v1.22.1
+	gopkg.in/fsnotify.v1 v1.4.7
 	k8s.io/api v0.0.0-20190816222004-e3a6b8045b0b
 	k8s.io/apimachinery v0.0.0-20190816221834-a9f1d8a9c101
 	k8s.io/client-go v11.0.1-0.20190805182717-6502b5e7b1b5+incompatible
@@ -0,0 +1,270 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package aggregator summarizes the node conditions set by node-problem-detector on all
+// nodes of the cluster, for fleet-level dashboards. It runs in a single Deployment replica
+// instead of the DaemonSet, and needs no leader election: replicas write the same summary.
+package aggregator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+// SummaryKey is the key of the summary in the data of the ConfigMap.
+const SummaryKey = "summary.json"
+
+// Config is the configuration of the aggregator.
+type Config struct {
+	// ConditionTypes are the types of the conditions set by node-problem-detector. The
+	// instances of the conditions, e.g. "DiskReadonly[sdb]", are included too.
+	ConditionTypes []string
+	// ConditionTypePrefix includes all conditions whose type has the prefix, e.g. the
+	// --condition-type-prefix of node-problem-detector.
+	ConditionTypePrefix string
+	// Namespace and ConfigMap are the ConfigMap the summary is written to. Empty ConfigMap
+	// disables it.
+	Namespace string
+	ConfigMap string
+	// SyncPeriod is the period at which the nodes are summarized.
+	SyncPeriod time.Duration
+}
+
+// Validate verifies whether the settings are valid.
+func (c *Config) Validate() error {
+	if len(c.ConditionTypes) == 0 && c.ConditionTypePrefix == "" {
+		return fmt.Errorf("no condition type or condition type prefix is configured")
+	}
+	if c.ConfigMap != "" && c.Namespace == "" {
+		return fmt.Errorf("namespace of ConfigMap %q is not set", c.ConfigMap)
+	}
+	if c.SyncPeriod <= 0 {
+		return fmt.Errorf("sync period %v must be positive", c.SyncPeriod)
+	}
+	return nil
+}
+
+// Problem is a condition set by node-problem-detector which is True on a node.
+type Problem struct {
+	Type    string      `json:"type"`
+	Reason  string      `json:"reason"`
+	Message string      `json:"message"`
+	Since   metav1.Time `json:"since"`
+}
+
+// UnhealthyNode is a node with problems.
+type UnhealthyNode struct {
+	Name     string    `json:"name"`
+	Problems []Problem `json:"problems"`
+}
+
+// Summary is the summary of the problems of the cluster.
+type Summary struct {
+	// Nodes is the number of nodes of the cluster.
+	Nodes int `json:"nodes"`
+	// UnhealthyNodes are the nodes with problems, sorted by name.
+	UnhealthyNodes []UnhealthyNode `json:"unhealthyNodes"`
+}
+
+// Aggregator summarizes the problems of the nodes of the cluster into metrics and a
+// ConfigMap.
+type Aggregator struct {
+	config Config
+	client ClusterClient
+	// nodes, unhealthyNodes and conditionNodes are the cluster-scoped metrics.
+	nodes          metrics.Int64MetricInterface
+	unhealthyNodes metrics.Int64MetricInterface
+	conditionNodes metrics.Int64MetricInterface
+	// conditionTypes are the condition types reported in the metrics, so that they are
+	// reported as 0 after their last node recovers.
+	conditionTypes map[string]bool
+	// written is the summary last written to the ConfigMap.
+	written string
+}
+
+// NewAggregatorOrDie creates an aggregator, panics if error occurs.
+func NewAggregatorOrDie(config Config, client ClusterClient) *Aggregator {
+	if err := config.Validate(); err != nil {
+		glog.Fatalf("Invalid aggregator config: %v", err)
+	}
+	a := newAggregator(config, client)
+	var err error
+	a.nodes, err = metrics.NewInt64Metric(
+		metrics.ClusterNodesID,
+		string(metrics.ClusterNodesID),
+		"Number of nodes of the cluster.",
+		"1",
+		metrics.LastValue,
+		[]string{})
+	if err != nil {
+		glog.Fatalf("Failed to create %s metric: %v", metrics.ClusterNodesID, err)
+	}
+	a.unhealthyNodes, err = metrics.NewInt64Metric(
+		metrics.ClusterUnhealthyNodesID,
+		string(metrics.ClusterUnhealthyNodesID),
+		"Number of nodes with at least one problem condition set by node-problem-detector.",
+		"1",
+		metrics.LastValue,
+		[]string{})
+	if err != nil {
+		glog.Fatalf("Failed to create %s metric: %v", metrics.ClusterUnhealthyNodesID, err)
+	}
+	a.conditionNodes, err = metrics.NewInt64Metric(
+		metrics.ClusterConditionNodesID,
+		string(metrics.ClusterConditionNodesID),
+		"Number of nodes on which the condition set by node-problem-detector is True.",
+		"1",
+		metrics.LastValue,
+		[]string{"type"})
+	if err != nil {
+		glog.Fatalf("Failed to create %s metric: %v", metrics.ClusterConditionNodesID, err)
+	}
+	return a
+}
+
+func newAggregator(config Config, client ClusterClient) *Aggregator {
+	return &Aggregator{
+		config:         config,
+		client:         client,
+		conditionTypes: make(map[string]bool),
+	}
+}
+
+// Run summarizes the nodes every sync period, it never returns.
+func (a *Aggregator) Run() {
+	ticker := time.NewTicker(a.config.SyncPeriod)
+	defer ticker.Stop()
+	for {
+		if err := a.sync(); err != nil {
+			glog.Errorf("Failed to aggregate node problems: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// sync summarizes the nodes, and updates the metrics and the ConfigMap.
+func (a *Aggregator) sync() error {
+	nodes, err := a.client.ListNodes()
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+	summary := a.summarize(nodes)
+	a.updateMetrics(summary)
+	if a.config.ConfigMap == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if string(data) == a.written {
+		return nil
+	}
+	if err := a.client.WriteConfigMap(a.config.Namespace, a.config.ConfigMap, map[string]string{SummaryKey: string(data)}); err != nil {
+		return fmt.Errorf("failed to write ConfigMap %s/%s: %v", a.config.Namespace, a.config.ConfigMap, err)
+	}
+	glog.V(2).Infof("Wrote %d unhealthy nodes of %d to ConfigMap %s/%s", len(summary.UnhealthyNodes), summary.Nodes,
+		a.config.Namespace, a.config.ConfigMap)
+	a.written = string(data)
+	return nil
+}
+
+// summarize collects the problems of the nodes.
+func (a *Aggregator) summarize(nodes []v1.Node) Summary {
+	summary := Summary{Nodes: len(nodes), UnhealthyNodes: []UnhealthyNode{}}
+	for _, node := range nodes {
+		var problems []Problem
+		for _, condition := range node.Status.Conditions {
+			if condition.Status != v1.ConditionTrue || !a.owned(string(condition.Type)) {
+				continue
+			}
+			problems = append(problems, Problem{
+				Type:    string(condition.Type),
+				Reason:  condition.Reason,
+				Message: condition.Message,
+				Since:   condition.LastTransitionTime,
+			})
+		}
+		if len(problems) == 0 {
+			continue
+		}
+		sort.Slice(problems, func(i, j int) bool { return problems[i].Type < problems[j].Type })
+		summary.UnhealthyNodes = append(summary.UnhealthyNodes, UnhealthyNode{Name: node.Name, Problems: problems})
+	}
+	sort.Slice(summary.UnhealthyNodes, func(i, j int) bool {
+		return summary.UnhealthyNodes[i].Name < summary.UnhealthyNodes[j].Name
+	})
+	return summary
+}
+
+// owned returns whether the condition is set by node-problem-detector.
+func (a *Aggregator) owned(conditionType string) bool {
+	if a.config.ConditionTypePrefix != "" && strings.HasPrefix(conditionType, a.config.ConditionTypePrefix) {
+		return true
+	}
+	for _, t := range a.config.ConditionTypes {
+		if conditionType == t || strings.HasPrefix(conditionType, t+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// updateMetrics records the summary in the metrics. The instances of a condition are
+// counted under the condition type, once per node.
+func (a *Aggregator) updateMetrics(summary Summary) {
+	counts := map[string]int64{}
+	for _, node := range summary.UnhealthyNodes {
+		types := map[string]bool{}
+		for _, problem := range node.Problems {
+			types[baseConditionType(problem.Type)] = true
+		}
+		for t := range types {
+			counts[t]++
+			a.conditionTypes[t] = true
+		}
+	}
+	if err := a.nodes.Record(map[string]string{}, int64(summary.Nodes)); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.ClusterNodesID, err)
+	}
+	if err := a.unhealthyNodes.Record(map[string]string{}, int64(len(summary.UnhealthyNodes))); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.ClusterUnhealthyNodesID, err)
+	}
+	for t := range a.conditionTypes {
+		if err := a.conditionNodes.Record(map[string]string{"type": t}, counts[t]); err != nil {
+			glog.Errorf("Failed to update %s metric: %v", metrics.ClusterConditionNodesID, err)
+		}
+	}
+}
+
+// baseConditionType returns the condition type without the instance, e.g. "DiskReadonly"
+// for "DiskReadonly[sdb]".
+func baseConditionType(conditionType string) string {
+	if i := strings.Index(conditionType, "["); i > 0 && strings.HasSuffix(conditionType, "]") {
+		return conditionType[:i]
+	}
+	return conditionType
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregator
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+type fakeClusterClient struct {
+	nodes      []v1.Node
+	configMaps map[string]map[string]string
+	writes     int
+}
+
+func (c *fakeClusterClient) ListNodes() ([]v1.Node, error) {
+	return c.nodes, nil
+}
+
+func (c *fakeClusterClient) WriteConfigMap(namespace, name string, data map[string]string) error {
+	c.configMaps[namespace+"/"+name] = data
+	c.writes++
+	return nil
+}
+
+func newTestAggregator(config Config) (*Aggregator, *fakeClusterClient) {
+	client := &fakeClusterClient{configMaps: map[string]map[string]string{}}
+	a := newAggregator(config, client)
+	a.nodes = metrics.NewFakeInt64Metric(string(metrics.ClusterNodesID), metrics.LastValue, []string{})
+	a.unhealthyNodes = metrics.NewFakeInt64Metric(string(metrics.ClusterUnhealthyNodesID), metrics.LastValue, []string{})
+	a.conditionNodes = metrics.NewFakeInt64Metric(string(metrics.ClusterConditionNodesID), metrics.LastValue, []string{"type"})
+	return a, client
+}
+
+func newTestNode(name string, conditions ...v1.NodeCondition) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     v1.NodeStatus{Conditions: conditions},
+	}
+}
+
+func newTestCondition(conditionType string, status v1.ConditionStatus) v1.NodeCondition {
+	return v1.NodeCondition{
+		Type:               v1.NodeConditionType(conditionType),
+		Status:             status,
+		Reason:             conditionType + "Reason",
+		Message:            conditionType + " message",
+		LastTransitionTime: metav1.NewTime(time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      Config
+		expectError bool
+	}{
+		{
+			name:   "condition types",
+			config: Config{ConditionTypes: []string{"KernelDeadlock"}, SyncPeriod: time.Minute},
+		},
+		{
+			name:   "condition type prefix with ConfigMap",
+			config: Config{ConditionTypePrefix: "npd.k8s.io/", Namespace: "kube-system", ConfigMap: "npd-summary", SyncPeriod: time.Minute},
+		},
+		{
+			name:        "no condition type",
+			config:      Config{SyncPeriod: time.Minute},
+			expectError: true,
+		},
+		{
+			name:        "ConfigMap without namespace",
+			config:      Config{ConditionTypes: []string{"KernelDeadlock"}, ConfigMap: "npd-summary", SyncPeriod: time.Minute},
+			expectError: true,
+		},
+		{
+			name:        "zero sync period",
+			config:      Config{ConditionTypes: []string{"KernelDeadlock"}},
+			expectError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	a, _ := newTestAggregator(Config{ConditionTypes: []string{"KernelDeadlock", "DiskReadonly"}, ConditionTypePrefix: "npd.k8s.io/"})
+	summary := a.summarize([]v1.Node{
+		newTestNode("node-c",
+			newTestCondition("npd.k8s.io/FrequentKubeletRestart", v1.ConditionTrue),
+			newTestCondition("KernelDeadlock", v1.ConditionTrue)),
+		newTestNode("node-a",
+			newTestCondition("DiskReadonly[sdb]", v1.ConditionTrue),
+			// Conditions not set by node-problem-detector are ignored.
+			newTestCondition("MemoryPressure", v1.ConditionTrue),
+			newTestCondition("KernelDeadlockage", v1.ConditionTrue)),
+		newTestNode("node-b",
+			newTestCondition("KernelDeadlock", v1.ConditionFalse),
+			newTestCondition("MemoryPressure", v1.ConditionTrue)),
+	})
+	assert.Equal(t, 3, summary.Nodes)
+	if assert.Len(t, summary.UnhealthyNodes, 2) {
+		assert.Equal(t, "node-a", summary.UnhealthyNodes[0].Name)
+		assert.Equal(t, []Problem{{
+			Type:    "DiskReadonly[sdb]",
+			Reason:  "DiskReadonly[sdb]Reason",
+			Message: "DiskReadonly[sdb] message",
+			Since:   metav1.NewTime(time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)),
+		}}, summary.UnhealthyNodes[0].Problems)
+		assert.Equal(t, "node-c", summary.UnhealthyNodes[1].Name)
+		if assert.Len(t, summary.UnhealthyNodes[1].Problems, 2) {
+			assert.Equal(t, "KernelDeadlock", summary.UnhealthyNodes[1].Problems[0].Type)
+			assert.Equal(t, "npd.k8s.io/FrequentKubeletRestart", summary.UnhealthyNodes[1].Problems[1].Type)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	a, client := newTestAggregator(Config{
+		ConditionTypes: []string{"KernelDeadlock", "DiskReadonly"},
+		Namespace:      "kube-system",
+		ConfigMap:      "npd-summary",
+	})
+	client.nodes = []v1.Node{
+		newTestNode("node-a",
+			newTestCondition("DiskReadonly[sda]", v1.ConditionTrue),
+			newTestCondition("DiskReadonly[sdb]", v1.ConditionTrue)),
+		newTestNode("node-b", newTestCondition("KernelDeadlock", v1.ConditionTrue)),
+		newTestNode("node-c", newTestCondition("KernelDeadlock", v1.ConditionFalse)),
+	}
+	assert.NoError(t, a.sync())
+
+	assert.Equal(t, []metrics.Int64MetricRepresentation{{Name: string(metrics.ClusterNodesID), Labels: map[string]string{}, Value: 3}},
+		a.nodes.(*metrics.FakeInt64Metric).ListMetrics())
+	assert.Equal(t, []metrics.Int64MetricRepresentation{{Name: string(metrics.ClusterUnhealthyNodesID), Labels: map[string]string{}, Value: 2}},
+		a.unhealthyNodes.(*metrics.FakeInt64Metric).ListMetrics())
+	// The instances of a condition on a node are counted once.
+	assert.ElementsMatch(t, []metrics.Int64MetricRepresentation{
+		{Name: string(metrics.ClusterConditionNodesID), Labels: map[string]string{"type": "DiskReadonly"}, Value: 1},
+		{Name: string(metrics.ClusterConditionNodesID), Labels: map[string]string{"type": "KernelDeadlock"}, Value: 1},
+	}, a.conditionNodes.(*metrics.FakeInt64Metric).ListMetrics())
+
+	var summary Summary
+	assert.NoError(t, json.Unmarshal([]byte(client.configMaps["kube-system/npd-summary"][SummaryKey]), &summary))
+	assert.Equal(t, 3, summary.Nodes)
+	assert.Len(t, summary.UnhealthyNodes, 2)
+	assert.Equal(t, 1, client.writes)
+
+	// An unchanged summary is not written again.
+	assert.NoError(t, a.sync())
+	assert.Equal(t, 1, client.writes)
+
+	// Recovered conditions are reported as 0.
+	client.nodes = client.nodes[2:]
+	assert.NoError(t, a.sync())
+	assert.Equal(t, 2, client.writes)
+	assert.ElementsMatch(t, []metrics.Int64MetricRepresentation{
+		{Name: string(metrics.ClusterConditionNodesID), Labels: map[string]string{"type": "DiskReadonly"}, Value: 0},
+		{Name: string(metrics.ClusterConditionNodesID), Labels: map[string]string{"type": "KernelDeadlock"}, Value: 0},
+	}, a.conditionNodes.(*metrics.FakeInt64Metric).ListMetrics())
+	assert.NoError(t, json.Unmarshal([]byte(client.configMaps["kube-system/npd-summary"][SummaryKey]), &summary))
+	assert.Equal(t, Summary{Nodes: 1, UnhealthyNodes: []UnhealthyNode{}}, summary)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregator
+
+import (
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// ClusterClient is the interface to the cluster objects read and written by the aggregator.
+type ClusterClient interface {
+	// ListNodes lists all nodes of the cluster.
+	ListNodes() ([]v1.Node, error)
+	// WriteConfigMap creates the ConfigMap with the data, or replaces the data of the
+	// existing one.
+	WriteConfigMap(namespace, name string, data map[string]string) error
+}
+
+type clusterClient struct {
+	client clientset.Interface
+}
+
+// NewClusterClient creates a ClusterClient.
+func NewClusterClient(client clientset.Interface) ClusterClient {
+	return &clusterClient{client: client}
+}
+
+func (c *clusterClient) ListNodes() ([]v1.Node, error) {
+	nodes, err := c.client.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return nodes.Items, nil
+}
+
+func (c *clusterClient) WriteConfigMap(namespace, name string, data map[string]string) error {
+	configMaps := c.client.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       data,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	configMap.Data = data
+	_, err = configMaps.Update(configMap)
+	return err
+}
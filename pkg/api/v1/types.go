@@ -0,0 +1,167 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 contains the stable, versioned schema of the problems exported by
+// node-problem-detector. Exporters and local APIs should convert the internal
+// types to these types instead of serializing the internal types directly, so
+// that internal changes don't break consumers.
+//
+// The types mirror the messages of problem.proto in this directory, which documents
+// the schema for consumers in other languages. They are written by hand, not generated
+// from it, so unlike the proto3 JSON mapping they marshal some empty fields, e.g. an
+// empty message.
+package v1
+
+import (
+	"time"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// APIVersion is the version of this schema.
+const APIVersion = "nodeproblemdetector.k8s.io/v1"
+
+// ProblemReport is the problems reported by a problem daemon on a node.
+type ProblemReport struct {
+	APIVersion string `json:"apiVersion"`
+	Node       string `json:"node"`
+	// NodeMetadata is the metadata of the node selected by the node enrichment, e.g.
+	// its topology zone, by name.
+	NodeMetadata map[string]string `json:"nodeMetadata,omitempty"`
+	Source       string            `json:"source"`
+	Events       []Event           `json:"events,omitempty"`
+	Conditions   []Condition       `json:"conditions,omitempty"`
+}
+
+// Event is a temporary problem.
+type Event struct {
+	// Severity is one of "info", "warn" or "critical".
+	Severity  string    `json:"severity"`
+	Timestamp time.Time `json:"timestamp"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	// Annotations are structured details of the event, e.g. the named capture groups
+	// of the log pattern, or the team and labels of the rule.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Condition is a permanent problem, reported as a node condition.
+type Condition struct {
+	Type string `json:"type"`
+	// Status is one of "True", "False" or "Unknown".
+	Status     string    `json:"status"`
+	Transition time.Time `json:"transition"`
+	Reason     string    `json:"reason"`
+	Message    string    `json:"message"`
+	// Severity is the severity of the problem while the condition is True, if the
+	// monitor classifies its problems.
+	Severity string `json:"severity,omitempty"`
+}
+
+// ConditionList is a list of conditions of a node.
+type ConditionList struct {
+	APIVersion string      `json:"apiVersion"`
+	Node       string      `json:"node"`
+	Conditions []Condition `json:"conditions"`
+}
+
+// NewProblemReport converts a status reported by a problem daemon to a ProblemReport.
+func NewProblemReport(node string, status *types.Status) *ProblemReport {
+	r := &ProblemReport{
+		APIVersion:   APIVersion,
+		Node:         node,
+		NodeMetadata: status.Node,
+		Source:       status.Source,
+	}
+	for _, e := range status.Events {
+		r.Events = append(r.Events, NewEvent(e))
+	}
+	for _, c := range status.Conditions {
+		r.Conditions = append(r.Conditions, NewCondition(c))
+	}
+	return r
+}
+
+// NewConditionList converts conditions to a ConditionList.
+func NewConditionList(node string, conditions []types.Condition) *ConditionList {
+	l := &ConditionList{
+		APIVersion: APIVersion,
+		Node:       node,
+		Conditions: []Condition{},
+	}
+	for _, c := range conditions {
+		l.Conditions = append(l.Conditions, NewCondition(c))
+	}
+	return l
+}
+
+// NewEvent converts an internal event.
+func NewEvent(e types.Event) Event {
+	return Event{
+		Severity:    string(e.Severity),
+		Timestamp:   e.Timestamp.UTC(),
+		Reason:      e.Reason,
+		Message:     e.Message,
+		Annotations: e.Annotations,
+	}
+}
+
+// NewCondition converts an internal condition.
+func NewCondition(c types.Condition) Condition {
+	return Condition{
+		Type:       c.Type,
+		Status:     string(c.Status),
+		Transition: c.Transition.UTC(),
+		Reason:     c.Reason,
+		Message:    c.Message,
+		Severity:   string(c.Severity),
+	}
+}
+
+// ToStatus converts the ProblemReport back to a status, e.g. to export it again.
+func (r *ProblemReport) ToStatus() *types.Status {
+	status := &types.Status{Source: r.Source, Node: r.NodeMetadata}
+	for _, e := range r.Events {
+		status.Events = append(status.Events, e.ToEvent())
+	}
+	for _, c := range r.Conditions {
+		status.Conditions = append(status.Conditions, c.ToCondition())
+	}
+	return status
+}
+
+// ToEvent converts the event back to an internal event.
+func (e Event) ToEvent() types.Event {
+	return types.Event{
+		Severity:    types.Severity(e.Severity),
+		Timestamp:   e.Timestamp,
+		Reason:      e.Reason,
+		Message:     e.Message,
+		Annotations: e.Annotations,
+	}
+}
+
+// ToCondition converts the condition back to an internal condition.
+func (c Condition) ToCondition() types.Condition {
+	return types.Condition{
+		Type:       c.Type,
+		Status:     types.ConditionStatus(c.Status),
+		Transition: c.Transition,
+		Reason:     c.Reason,
+		Message:    c.Message,
+		Severity:   types.Severity(c.Severity),
+	}
+}
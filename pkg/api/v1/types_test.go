@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// TestProblemReportJSON pins the JSON shape of the schema. Changing the expected
+// output here is a breaking change for consumers.
+func TestProblemReportJSON(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	status := &types.Status{
+		Source: "kernel-monitor",
+		Node:   map[string]string{"zone": "us-central1-a"},
+		Events: []types.Event{
+			{Severity: types.Warn, Timestamp: ts, Reason: "OOMKilling", Message: "Killed process 1234", Annotations: map[string]string{"team": "node"}},
+		},
+		Conditions: []types.Condition{
+			{Type: "KernelDeadlock", Status: types.False, Transition: ts, Reason: "KernelHasNoDeadlock", Message: "kernel has no deadlock"},
+			{Type: "ReadonlyFilesystem", Status: types.True, Transition: ts, Reason: "FilesystemIsReadOnly", Message: "remounted read-only", Severity: types.Critical},
+		},
+	}
+
+	b, err := json.Marshal(NewProblemReport("node-1", status))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"apiVersion": "nodeproblemdetector.k8s.io/v1",
+		"node": "node-1",
+		"nodeMetadata": {"zone": "us-central1-a"},
+		"source": "kernel-monitor",
+		"events": [
+			{"severity": "warn", "timestamp": "2020-01-02T03:04:05Z", "reason": "OOMKilling", "message": "Killed process 1234", "annotations": {"team": "node"}}
+		],
+		"conditions": [
+			{"type": "KernelDeadlock", "status": "False", "transition": "2020-01-02T03:04:05Z", "reason": "KernelHasNoDeadlock", "message": "kernel has no deadlock"},
+			{"type": "ReadonlyFilesystem", "status": "True", "transition": "2020-01-02T03:04:05Z", "reason": "FilesystemIsReadOnly", "message": "remounted read-only", "severity": "critical"}
+		]
+	}`, string(b))
+}
+
+func TestToStatus(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	status := &types.Status{
+		Source:     "kernel-monitor",
+		Node:       map[string]string{"zone": "us-central1-a"},
+		Events:     []types.Event{{Severity: types.Warn, Timestamp: ts, Reason: "OOMKilling", Message: "Killed process 1234", Annotations: map[string]string{"pid": "1234"}}},
+		Conditions: []types.Condition{{Type: "ReadonlyFilesystem", Status: types.True, Transition: ts, Reason: "FilesystemIsReadOnly", Severity: types.Critical}},
+	}
+	assert.Equal(t, status, NewProblemReport("node-1", status).ToStatus())
+}
+
+func TestConditionListJSON(t *testing.T) {
+	b, err := json.Marshal(NewConditionList("node-1", nil))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"apiVersion": "nodeproblemdetector.k8s.io/v1", "node": "node-1", "conditions": []}`, string(b))
+}
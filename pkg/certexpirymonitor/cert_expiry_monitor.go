@@ -0,0 +1,323 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certexpirymonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	cetypes "k8s.io/node-problem-detector/pkg/certexpirymonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const CertExpiryMonitorName = "cert-expiry-monitor"
+
+const (
+	healthyReason  = "CertificatesAreValid"
+	healthyMessage = "no certificate expires soon"
+	expiringReason = "CertificateExpiring"
+	expiredReason  = "CertificateExpired"
+)
+
+func init() {
+	problemdaemon.Register(CertExpiryMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewCertExpiryMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type certExpiryMonitor struct {
+	configPath string
+	config     cetypes.CertExpiryConfig
+	// readCerts reads the certificates, and the errors of the files which can not be read.
+	readCerts func() ([]*certificate, map[string]error)
+	// warned records when the warning event of each expiring certificate was last
+	// reported, keyed by path.
+	warned     map[string]time.Time
+	expiry     metrics.Int64MetricInterface
+	condition  types.Condition
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewCertExpiryMonitorOrDie creates a certificate expiry monitor, panics if error occurs.
+func NewCertExpiryMonitorOrDie(configPath string) types.Monitor {
+	cem := certExpiryMonitor{
+		configPath: configPath,
+		warned:     make(map[string]time.Time),
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &cem.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = cem.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = cem.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, cem.config, err)
+	}
+	cem.readCerts = func() ([]*certificate, map[string]error) {
+		return readCertificates(cem.config.Certificates)
+	}
+
+	// A 1000 size channel should be big enough.
+	cem.statusChan = make(chan *types.Status, 1000)
+
+	if *cem.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(cem.config.ConditionType)
+		cem.expiry = expiryMetricOrDie()
+	}
+	return &cem
+}
+
+var (
+	expiry     metrics.Int64MetricInterface
+	expiryOnce sync.Once
+)
+
+// expiryMetricOrDie returns the metric of the seconds until the expiry of each
+// certificate, panic if error occurs. The metric is shared by all certificate expiry
+// monitors.
+func expiryMetricOrDie() metrics.Int64MetricInterface {
+	expiryOnce.Do(func() {
+		metric, err := metrics.NewInt64Metric(
+			metrics.CertificateExpirySecondsID,
+			string(metrics.CertificateExpirySecondsID),
+			"Number of seconds until the expiry of each certificate, negative once expired.",
+			"s",
+			metrics.LastValue,
+			[]string{"path"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.CertificateExpirySecondsID, err)
+		}
+		expiry = metric
+	})
+	return expiry
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for the condition and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	for _, reason := range []string{expiringReason, expiredReason} {
+		err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, reason, false)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+				conditionType, reason, err)
+		}
+		err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+		}
+	}
+}
+
+func (cem *certExpiryMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start certificate expiry monitor %s", cem.configPath)
+	problemdaemon.Go(cem, cem.monitorLoop)
+	return cem.statusChan, nil
+}
+
+func (cem *certExpiryMonitor) Stop() {
+	glog.Infof("Stop certificate expiry monitor %s", cem.configPath)
+	cem.tomb.Stop()
+}
+
+func (cem *certExpiryMonitor) monitorLoop() {
+	defer cem.tomb.Done()
+
+	runTicker := time.NewTicker(cem.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	cem.initializeStatus()
+	if status := cem.check(time.Now()); status != nil {
+		cem.statusChan <- status
+	}
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := cem.check(now); status != nil {
+				cem.statusChan <- status
+			}
+		case <-cem.tomb.Stopping():
+			glog.Infof("Certificate expiry monitor stopped: %s", cem.configPath)
+			return
+		}
+	}
+}
+
+func (cem *certExpiryMonitor) initializeStatus() {
+	cem.condition = types.Condition{
+		Type:       cem.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     healthyReason,
+		Message:    healthyMessage,
+	}
+	cem.statusChan <- &types.Status{
+		Source:     cem.config.Source,
+		Conditions: []types.Condition{cem.condition},
+	}
+}
+
+// check reads the certificates, and returns a new status if the condition changes or
+// expiring certificates are due a warning event.
+func (cem *certExpiryMonitor) check(now time.Time) *types.Status {
+	certs, errs := cem.readCerts()
+	for path, err := range errs {
+		glog.Errorf("Failed to read certificate %s: %v", path, err)
+	}
+	cem.recordMetrics(certs, now)
+
+	var expiring []*certificate
+	for _, cert := range certs {
+		if cert.notAfter.Sub(now) <= cem.config.ExpiryThreshold {
+			expiring = append(expiring, cert)
+		}
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		if !expiring[i].notAfter.Equal(expiring[j].notAfter) {
+			return expiring[i].notAfter.Before(expiring[j].notAfter)
+		}
+		return expiring[i].path < expiring[j].path
+	})
+
+	var events []types.Event
+	var problems []string
+	reason := expiringReason
+	warned := make(map[string]time.Time)
+	for _, cert := range expiring {
+		certReason := expiringReason
+		if !cert.notAfter.After(now) {
+			certReason, reason = expiredReason, expiredReason
+		}
+		problems = append(problems, describe(cert))
+		last, ok := cem.warned[cert.path]
+		warned[cert.path] = last
+		if ok && now.Sub(last) < cem.config.WarningPeriod {
+			continue
+		}
+		warned[cert.path] = now
+		events = append(events, types.Event{
+			Severity:  types.Warn,
+			Timestamp: now,
+			Reason:    certReason,
+			Message:   warningMessage(cert, now),
+		})
+	}
+	// The certificates which are renewed or removed are warned again once expiring.
+	cem.warned = warned
+
+	status, message := types.False, healthyMessage
+	if len(problems) > 0 {
+		status, message = types.True, strings.Join(problems, "; ")
+	} else {
+		reason = healthyReason
+	}
+	transitioned := status != cem.condition.Status
+	if !transitioned && reason == cem.condition.Reason && message == cem.condition.Message && len(events) == 0 {
+		return nil
+	}
+	if transitioned {
+		cem.condition.Transition = now
+	}
+	cem.condition.Status = status
+	cem.condition.Reason = reason
+	cem.condition.Message = message
+
+	if *cem.config.EnableMetricsReporting {
+		cem.updateProblemMetrics(transitioned)
+	}
+	return &types.Status{
+		Source:     cem.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{cem.condition},
+	}
+}
+
+// describe returns the certificate with its expiry, which does not change until the
+// certificate is renewed.
+func describe(cert *certificate) string {
+	return fmt.Sprintf("%s (%s) expires at %s", cert.path, cert.subject, cert.notAfter.UTC().Format(time.RFC3339))
+}
+
+func warningMessage(cert *certificate, now time.Time) string {
+	left := cert.notAfter.Sub(now)
+	if left <= 0 {
+		return fmt.Sprintf("Certificate %s (%s) expired %s ago, at %s", cert.path, cert.subject,
+			formatDays(-left), cert.notAfter.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("Certificate %s (%s) expires in %s, at %s", cert.path, cert.subject,
+		formatDays(left), cert.notAfter.UTC().Format(time.RFC3339))
+}
+
+// formatDays formats the duration in days, or in hours below a day.
+func formatDays(d time.Duration) string {
+	if days := int(d.Hours() / 24); days > 1 {
+		return fmt.Sprintf("%d days", days)
+	} else if days == 1 {
+		return "1 day"
+	}
+	return d.Truncate(time.Minute).String()
+}
+
+func (cem *certExpiryMonitor) recordMetrics(certs []*certificate, now time.Time) {
+	if cem.expiry == nil {
+		return
+	}
+	for _, cert := range certs {
+		err := cem.expiry.Record(map[string]string{"path": cert.path}, int64(cert.notAfter.Sub(now).Seconds()))
+		if err != nil {
+			glog.Errorf("Failed to record expiry of certificate %q: %v", cert.path, err)
+		}
+	}
+}
+
+func (cem *certExpiryMonitor) updateProblemMetrics(transitioned bool) {
+	active := cem.condition.Status == types.True
+	if active && transitioned {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(cem.condition.Reason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", cem.condition.Reason, err)
+		}
+	}
+	for _, reason := range []string{expiringReason, expiredReason} {
+		err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(cem.condition.Type, reason, active && cem.condition.Reason == reason)
+		if err != nil {
+			glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+				cem.condition.Type, reason, err)
+		}
+	}
+}
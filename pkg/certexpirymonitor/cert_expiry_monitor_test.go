@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certexpirymonitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cetypes "k8s.io/node-problem-detector/pkg/certexpirymonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// writeCertificate writes a PEM file with a self-signed certificate expiring at notAfter,
+// followed by its private key.
+func writeCertificate(t *testing.T, path, commonName string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})...)
+	assert.NoError(t, ioutil.WriteFile(path, data, 0600))
+}
+
+func TestReadCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	notAfter := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	writeCertificate(t, filepath.Join(dir, "kubelet-client-current.pem"), "system:node:node-1", notAfter)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "registry"), 0755))
+	writeCertificate(t, filepath.Join(dir, "registry", "client.cert"), "registry", notAfter.Add(time.Hour))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "registry", "ca.cert"), []byte("not a certificate"), 0600))
+
+	certs, errs := readCertificates([]string{
+		filepath.Join(dir, "kubelet-client-current.pem"),
+		filepath.Join(dir, "*.pem"),
+		filepath.Join(dir, "registry", "*.cert"),
+		filepath.Join(dir, "missing.crt"),
+	})
+	assert.Equal(t, []*certificate{
+		{path: filepath.Join(dir, "kubelet-client-current.pem"), subject: "CN=system:node:node-1", notAfter: notAfter},
+		{path: filepath.Join(dir, "registry", "client.cert"), subject: "CN=registry", notAfter: notAfter.Add(time.Hour)},
+	}, certs)
+	assert.Len(t, errs, 1)
+	assert.Error(t, errs[filepath.Join(dir, "registry", "ca.cert")])
+}
+
+func TestCheck(t *testing.T) {
+	disabled := false
+	config := cetypes.CertExpiryConfig{
+		InvokeIntervalString:   "1h",
+		ExpiryThresholdString:  "720h",
+		EnableMetricsReporting: &disabled,
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	client := &certificate{path: "/var/lib/kubelet/pki/kubelet-client-current.pem", subject: "CN=system:node:node-1", notAfter: now.Add(60 * 24 * time.Hour)}
+	serving := &certificate{path: "/var/lib/kubelet/pki/kubelet.crt", subject: "CN=node-1@1590969600", notAfter: now.Add(90 * 24 * time.Hour)}
+	certs := []*certificate{client, serving}
+	cem := &certExpiryMonitor{
+		config:    config,
+		readCerts: func() ([]*certificate, map[string]error) { return certs, nil },
+		warned:    make(map[string]time.Time),
+		condition: types.Condition{Type: config.ConditionType, Status: types.False, Reason: healthyReason, Message: healthyMessage},
+	}
+	assert.Nil(t, cem.check(now), "no certificate expires soon")
+
+	// The condition is set once a certificate expires within the threshold.
+	now = now.Add(31 * 24 * time.Hour)
+	status := cem.check(now)
+	if assert.NotNil(t, status) {
+		assert.Equal(t, []types.Condition{{
+			Type:       "CertificateExpiring",
+			Status:     types.True,
+			Transition: now,
+			Reason:     expiringReason,
+			Message:    "/var/lib/kubelet/pki/kubelet-client-current.pem (CN=system:node:node-1) expires at 2020-07-31T00:00:00Z",
+		}}, status.Conditions)
+		assert.Equal(t, []types.Event{{
+			Severity:  types.Warn,
+			Timestamp: now,
+			Reason:    expiringReason,
+			Message:   "Certificate /var/lib/kubelet/pki/kubelet-client-current.pem (CN=system:node:node-1) expires in 29 days, at 2020-07-31T00:00:00Z",
+		}}, status.Events)
+	}
+	assert.Nil(t, cem.check(now.Add(time.Hour)), "the warning event is reported daily")
+
+	// The warning event is reported again a day later.
+	now = now.Add(24 * time.Hour)
+	status = cem.check(now)
+	if assert.NotNil(t, status) && assert.Len(t, status.Events, 1) {
+		assert.Contains(t, status.Events[0].Message, "expires in 28 days")
+	}
+
+	// An expired certificate changes the reason.
+	now = client.notAfter.Add(time.Hour)
+	status = cem.check(now)
+	if assert.NotNil(t, status) && assert.Len(t, status.Events, 2) {
+		assert.Equal(t, expiredReason, status.Conditions[0].Reason)
+		assert.Equal(t, expiredReason, status.Events[0].Reason)
+		assert.Equal(t, "Certificate /var/lib/kubelet/pki/kubelet-client-current.pem (CN=system:node:node-1) expired 1h0m0s ago, at 2020-07-31T00:00:00Z",
+			status.Events[0].Message)
+		assert.Equal(t, expiringReason, status.Events[1].Reason)
+	}
+
+	// The condition is cleared once the certificates are renewed.
+	client.notAfter = now.Add(365 * 24 * time.Hour)
+	serving.notAfter = now.Add(365 * 24 * time.Hour)
+	status = cem.check(now.Add(time.Hour))
+	if assert.NotNil(t, status) {
+		assert.Equal(t, types.False, status.Conditions[0].Status)
+		assert.Equal(t, healthyReason, status.Conditions[0].Reason)
+		assert.Empty(t, status.Events)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certexpirymonitor
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// certificate is the first certificate of a PEM file.
+type certificate struct {
+	path     string
+	subject  string
+	notAfter time.Time
+}
+
+// readCertificates reads the certificates of the files matching the glob patterns. The
+// files which can not be parsed are returned as errors, keyed by path.
+func readCertificates(patterns []string) ([]*certificate, map[string]error) {
+	var certs []*certificate
+	errs := make(map[string]error)
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			errs[pattern] = err
+			continue
+		}
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			cert, err := readCertificate(path)
+			if err != nil {
+				errs[path] = err
+				continue
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, errs
+}
+
+// readCertificate reads the first certificate of a PEM file, i.e. the leaf certificate of
+// a chain. The other blocks, e.g. the private key of the kubelet client certificate, are
+// skipped.
+func readCertificate(path string) (*certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate found in %s", path)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate of %s: %v", path, err)
+		}
+		return &certificate{
+			path:     path,
+			subject:  cert.Subject.String(),
+			notAfter: cert.NotAfter,
+		}, nil
+	}
+}
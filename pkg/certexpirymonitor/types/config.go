@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+var (
+	defaultSource               = "cert-expiry-monitor"
+	defaultInvokeIntervalString = (1 * time.Hour).String()
+	defaultCertificates         = []string{
+		"/var/lib/kubelet/pki/kubelet-client-current.pem",
+		"/var/lib/kubelet/pki/kubelet-server-current.pem",
+		"/var/lib/kubelet/pki/kubelet.crt",
+		"/etc/containerd/certs.d/*/*.crt",
+		"/etc/containerd/certs.d/*/*.cert",
+	}
+	defaultExpiryThresholdString = (30 * 24 * time.Hour).String()
+	defaultWarningPeriodString   = (24 * time.Hour).String()
+	defaultEnableMetrics         = true
+	defaultConditionType         = "CertificateExpiring"
+)
+
+type CertExpiryConfig struct {
+	// Source is the source name of the certificate expiry monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which the certificates are checked.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// Certificates are the glob patterns of the PEM certificate files checked. Default to
+	// the kubelet client and serving certificates and the containerd registry
+	// certificates.
+	Certificates []string `json:"certificates"`
+	// ExpiryThresholdString is the time before the expiry of a certificate at which the
+	// condition is set.
+	ExpiryThresholdString string        `json:"expiryThreshold"`
+	ExpiryThreshold       time.Duration `json:"-"`
+	// WarningPeriodString is the period at which the warning event of each expiring
+	// certificate is reported again.
+	WarningPeriodString string        `json:"warningPeriod"`
+	WarningPeriod       time.Duration `json:"-"`
+	// ConditionType is the type of the condition. Default to "CertificateExpiring".
+	ConditionType string `json:"conditionType"`
+	// EnableMetricsReporting describes whether to report problems and the time until the
+	// expiry of each certificate as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (cec *CertExpiryConfig) ApplyConfiguration() error {
+	if cec.Source == "" {
+		cec.Source = defaultSource
+	}
+	if cec.InvokeIntervalString == "" {
+		cec.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if cec.Certificates == nil {
+		cec.Certificates = defaultCertificates
+	}
+	if cec.ExpiryThresholdString == "" {
+		cec.ExpiryThresholdString = defaultExpiryThresholdString
+	}
+	if cec.WarningPeriodString == "" {
+		cec.WarningPeriodString = defaultWarningPeriodString
+	}
+	if cec.ConditionType == "" {
+		cec.ConditionType = defaultConditionType
+	}
+	if cec.EnableMetricsReporting == nil {
+		cec.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	cec.InvokeInterval, err = time.ParseDuration(cec.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", cec.InvokeIntervalString, err)
+	}
+	cec.ExpiryThreshold, err = time.ParseDuration(cec.ExpiryThresholdString)
+	if err != nil {
+		return fmt.Errorf("error in parsing ExpiryThresholdString %q: %v", cec.ExpiryThresholdString, err)
+	}
+	cec.WarningPeriod, err = time.ParseDuration(cec.WarningPeriodString)
+	if err != nil {
+		return fmt.Errorf("error in parsing WarningPeriodString %q: %v", cec.WarningPeriodString, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (cec *CertExpiryConfig) Validate() error {
+	if cec.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", cec.InvokeInterval)
+	}
+	if cec.ExpiryThreshold <= time.Duration(0) {
+		return fmt.Errorf("ExpiryThreshold %v must be above 0s", cec.ExpiryThreshold)
+	}
+	if cec.WarningPeriod < cec.InvokeInterval {
+		return fmt.Errorf("WarningPeriod %v must not be less than InvokeInterval %v", cec.WarningPeriod, cec.InvokeInterval)
+	}
+	if len(cec.Certificates) == 0 {
+		return fmt.Errorf("at least one certificate must be set")
+	}
+	for _, pattern := range cec.Certificates {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid certificate pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
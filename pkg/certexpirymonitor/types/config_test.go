@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    CertExpiryConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: CertExpiryConfig{},
+		},
+		{
+			name:   "custom certificates",
+			config: CertExpiryConfig{Certificates: []string{"/etc/kubernetes/pki/*.crt"}, ExpiryThresholdString: "168h"},
+		},
+		{
+			name:      "no certificate",
+			config:    CertExpiryConfig{Certificates: []string{}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid pattern",
+			config:    CertExpiryConfig{Certificates: []string{"/etc/pki/[.crt"}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid expiry threshold",
+			config:    CertExpiryConfig{ExpiryThresholdString: "30 days"},
+			expectErr: true,
+		},
+		{
+			name:      "warning period shorter than invoke interval",
+			config:    CertExpiryConfig{InvokeIntervalString: "1h", WarningPeriodString: "10m"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
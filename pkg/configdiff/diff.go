@@ -0,0 +1,235 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of a change.
+type Kind string
+
+const (
+	// Added means the value is only in the new configuration.
+	Added Kind = "+"
+	// Removed means the value is only in the old configuration.
+	Removed Kind = "-"
+	// Changed means the value differs between the configurations.
+	Changed Kind = "~"
+)
+
+// listKeys are the fields identifying the elements of lists, by list name. Elements of
+// other lists are identified by "name", or by index.
+var listKeys = map[string][]string{
+	"rules":      {"name", "reason"},
+	"conditions": {"type"},
+}
+
+// Change is a difference between two configurations.
+type Change struct {
+	Kind Kind
+	// Path is the path of the value, e.g. "rules[OOMKilling].pattern". List elements are
+	// identified by their key fields, and by index when they have none. Elements
+	// sharing a key are numbered, e.g. "rules[KernelOops#2]".
+	Path string
+	// Old is the old value, nil when added.
+	Old interface{}
+	// New is the new value, nil when removed.
+	New interface{}
+}
+
+// Delta returns the difference between the new and old value of a changed number, and
+// whether both are numbers.
+func (c Change) Delta() (float64, bool) {
+	o, ok := c.Old.(float64)
+	if !ok {
+		return 0, false
+	}
+	n, ok := c.New.(float64)
+	if !ok {
+		return 0, false
+	}
+	return n - o, true
+}
+
+// String formats the change as a line of the diff.
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", c.Path, format(c.New))
+	case Removed:
+		return fmt.Sprintf("- %s: %s", c.Path, format(c.Old))
+	}
+	s := fmt.Sprintf("~ %s: %s -> %s", c.Path, format(c.Old), format(c.New))
+	if delta, ok := c.Delta(); ok {
+		sign := ""
+		if delta > 0 {
+			sign = "+"
+		}
+		s += fmt.Sprintf(" (%s%s)", sign, strconv.FormatFloat(delta, 'g', -1, 64))
+	}
+	return s
+}
+
+func format(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// Diff returns the changes from the old to the new configuration, both decoded from JSON.
+// Object fields are compared in sorted order, list elements in the order of the old
+// list followed by the elements added to the new one.
+func Diff(old, new interface{}) []Change {
+	var changes []Change
+	diff("", "", old, new, &changes)
+	return changes
+}
+
+func diff(path, name string, old, new interface{}, changes *[]Change) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			diffObjects(path, o, n, changes)
+			return
+		}
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			oldKeys, oldElements, oldOK := keyElements(name, o)
+			newKeys, newElements, newOK := keyElements(name, n)
+			if oldOK && newOK {
+				diffLists(path, oldKeys, oldElements, newKeys, newElements, changes)
+				return
+			}
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, Change{Kind: Changed, Path: path, Old: old, New: new})
+	}
+}
+
+func diffObjects(path string, old, new map[string]interface{}, changes *[]Change) {
+	keys := make([]string, 0, len(old)+len(new))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range new {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		o, inOld := old[key]
+		n, inNew := new[key]
+		switch {
+		case !inOld:
+			*changes = append(*changes, Change{Kind: Added, Path: fieldPath, New: n})
+		case !inNew:
+			*changes = append(*changes, Change{Kind: Removed, Path: fieldPath, Old: o})
+		default:
+			diff(fieldPath, key, o, n, changes)
+		}
+	}
+}
+
+func diffLists(path string, oldKeys []string, old map[string]interface{}, newKeys []string, new map[string]interface{}, changes *[]Change) {
+	for _, key := range oldKeys {
+		elementPath := path + "[" + key + "]"
+		if n, ok := new[key]; ok {
+			diff(elementPath, "", old[key], n, changes)
+		} else {
+			*changes = append(*changes, Change{Kind: Removed, Path: elementPath, Old: old[key]})
+		}
+	}
+	for _, key := range newKeys {
+		if _, ok := old[key]; !ok {
+			*changes = append(*changes, Change{Kind: Added, Path: path + "[" + key + "]", New: new[key]})
+		}
+	}
+}
+
+// keyElements returns the keys of the elements of a list in order, and the elements by
+// key. It fails unless all elements are objects.
+func keyElements(name string, list []interface{}) ([]string, map[string]interface{}, bool) {
+	fields, ok := listKeys[name]
+	if !ok {
+		fields = []string{"name"}
+	}
+	keys := make([]string, 0, len(list))
+	elements := make(map[string]interface{}, len(list))
+	seen := map[string]int{}
+	for i, element := range list {
+		object, ok := element.(map[string]interface{})
+		if !ok {
+			return nil, nil, false
+		}
+		key := strconv.Itoa(i)
+		for _, field := range fields {
+			if value, ok := object[field].(string); ok && value != "" {
+				key = value
+				break
+			}
+		}
+		seen[key]++
+		if seen[key] > 1 {
+			key = fmt.Sprintf("%s#%d", key, seen[key])
+		}
+		keys = append(keys, key)
+		elements[key] = element
+	}
+	return keys, elements, true
+}
+
+// Summarize counts the elements of a top level list, e.g. "rules", which are added,
+// removed or changed.
+func Summarize(changes []Change, list string) (added, removed, changed int) {
+	prefix := list + "["
+	changedElements := map[string]bool{}
+	for _, change := range changes {
+		if !strings.HasPrefix(change.Path, prefix) {
+			continue
+		}
+		end := strings.Index(change.Path, "]")
+		if end < 0 {
+			continue
+		}
+		if end == len(change.Path)-1 {
+			switch change.Kind {
+			case Added:
+				added++
+				continue
+			case Removed:
+				removed++
+				continue
+			}
+		}
+		changedElements[change.Path[:end+1]] = true
+	}
+	return added, removed, len(changedElements)
+}
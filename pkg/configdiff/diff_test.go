@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configdiff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("Failed to decode %q: %v", s, err)
+	}
+	return v
+}
+
+func TestDiff(t *testing.T) {
+	old := decode(t, `{
+		"source": "kernel-monitor",
+		"bufferSize": 10,
+		"conditions": [{"type": "KernelDeadlock", "reason": "KernelHasNoDeadlock"}],
+		"rules": [
+			{"type": "temporary", "reason": "OOMKilling", "pattern": "Killed process .*"},
+			{"type": "temporary", "reason": "KernelOops", "pattern": "BUG: unable to handle .*"},
+			{"type": "temporary", "reason": "KernelOops", "pattern": "divide error: .*"},
+			{"type": "temporary", "reason": "TaskHung", "pattern": "task .* blocked"}
+		]
+	}`)
+	new := decode(t, `{
+		"source": "kernel-monitor",
+		"bufferSize": 20,
+		"lookback": "5m",
+		"conditions": [{"type": "KernelDeadlock", "reason": "KernelHasNoDeadlock"}],
+		"rules": [
+			{"type": "temporary", "reason": "OOMKilling", "pattern": "Killed process .*"},
+			{"type": "temporary", "reason": "KernelOops", "pattern": "BUG: unable to handle .*"},
+			{"type": "temporary", "reason": "KernelOops", "pattern": "divide error: \\d+"},
+			{"type": "permanent", "condition": "KernelDeadlock", "reason": "DockerHung", "pattern": "task docker:\\w+ blocked"}
+		]
+	}`)
+
+	changes := Diff(old, new)
+	var lines []string
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+	assert.Equal(t, []string{
+		`~ bufferSize: 10 -> 20 (+10)`,
+		`+ lookback: "5m"`,
+		`~ rules[KernelOops#2].pattern: "divide error: .*" -> "divide error: \\d+"`,
+		`- rules[TaskHung]: {"pattern":"task .* blocked","reason":"TaskHung","type":"temporary"}`,
+		`+ rules[DockerHung]: {"condition":"KernelDeadlock","pattern":"task docker:\\w+ blocked","reason":"DockerHung","type":"permanent"}`,
+	}, lines)
+
+	added, removed, changed := Summarize(changes, "rules")
+	assert.Equal(t, []int{1, 1, 1}, []int{added, removed, changed})
+	assert.Empty(t, Diff(old, old))
+}
+
+func TestDiffValues(t *testing.T) {
+	for _, test := range []struct {
+		old, new string
+		expected []string
+	}{
+		{old: `{"threshold": 80}`, new: `{"threshold": 75.5}`, expected: []string{"~ threshold: 80 -> 75.5 (-4.5)"}},
+		// Lists of other values are compared as a whole.
+		{old: `{"args": ["-a"]}`, new: `{"args": ["-a", "-b"]}`, expected: []string{`~ args: ["-a"] -> ["-a","-b"]`}},
+		// Elements without key fields are identified by index.
+		{old: `{"exitCodes": [{"exitCode": 2}]}`, new: `{"exitCodes": [{"exitCode": 3}]}`, expected: []string{"~ exitCodes[0].exitCode: 2 -> 3 (+1)"}},
+		{old: `{"rules": [{"name": "check", "reason": "Old"}]}`, new: `{"rules": [{"name": "check", "reason": "New"}]}`, expected: []string{`~ rules[check].reason: "Old" -> "New"`}},
+		{old: `{"pluginConfig": {"timeout": "5s"}}`, new: `{"pluginConfig": null}`, expected: []string{`~ pluginConfig: {"timeout":"5s"} -> null`}},
+	} {
+		var lines []string
+		for _, change := range Diff(decode(t, test.old), decode(t, test.new)) {
+			lines = append(lines, change.String())
+		}
+		assert.Equal(t, test.expected, lines, "diff of %s and %s", test.old, test.new)
+	}
+}
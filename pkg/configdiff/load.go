@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configdiff resolves the configurations of problem daemons, and compares them
+// semantically for config reviews.
+package configdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor"
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+)
+
+// The monitors whose configurations can be resolved.
+const (
+	SystemLogMonitor    = "system-log-monitor"
+	CustomPluginMonitor = "custom-plugin-monitor"
+	SystemStatsMonitor  = "system-stats-monitor"
+)
+
+// Load reads a configuration file as decoded JSON. With resolve, the configuration is
+// decoded as the configuration of the monitor, and the defaults are applied. It is not
+// validated, since the plugins it references usually only exist on the nodes. An empty
+// monitor is detected from the configuration.
+func Load(path, monitor string, resolve bool) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", path, err)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", path, err)
+	}
+	if !resolve {
+		return raw, nil
+	}
+	if monitor == "" {
+		if monitor = Detect(raw); monitor == "" {
+			return nil, fmt.Errorf("failed to detect the monitor of configuration file %q", path)
+		}
+	}
+
+	var config interface{}
+	switch monitor {
+	case SystemLogMonitor:
+		var c systemlogmonitor.MonitorConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", path, err)
+		}
+		c.ApplyDefaultConfiguration()
+		config = c
+	case CustomPluginMonitor:
+		var c cpmtypes.CustomPluginConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", path, err)
+		}
+		if err := c.ApplyConfiguration(); err != nil {
+			return nil, fmt.Errorf("failed to apply configuration for %q: %v", path, err)
+		}
+		config = c
+	case SystemStatsMonitor:
+		var c ssmtypes.SystemStatsConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", path, err)
+		}
+		if err := c.ApplyConfiguration(); err != nil {
+			return nil, fmt.Errorf("failed to apply configuration for %q: %v", path, err)
+		}
+		config = c
+	default:
+		return nil, fmt.Errorf("unsupported monitor %q, expected one of %q, %q or %q", monitor,
+			SystemLogMonitor, CustomPluginMonitor, SystemStatsMonitor)
+	}
+
+	// The resolved configuration is decoded again, so that it compares like a raw one.
+	data, err = json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var resolved interface{}
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// Detect returns the monitor of a decoded configuration, or an empty string if it is
+// unknown.
+func Detect(raw interface{}) string {
+	config, ok := raw.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if plugin, ok := config["plugin"].(string); ok && plugin != "" {
+		if plugin == "custom" {
+			return CustomPluginMonitor
+		}
+		return SystemLogMonitor
+	}
+	if _, ok := config["logPath"]; ok {
+		return SystemLogMonitor
+	}
+	for _, key := range []string{"cpu", "disk", "host", "memory", "os", "invokeInterval"} {
+		if _, ok := config[key]; ok {
+			return SystemStatsMonitor
+		}
+	}
+	return ""
+}
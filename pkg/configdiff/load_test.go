@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configdiff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configdiff")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logConfig := writeConfig(t, dir, "kernel-monitor.json", `{
+		"plugin": "kmsg",
+		"source": "kernel-monitor",
+		"rules": [{"type": "temporary", "reason": "OOMKilling", "pattern": "Killed process .*"}]
+	}`)
+	raw, err := Load(logConfig, "", false)
+	assert.NoError(t, err)
+	assert.NotContains(t, raw, "bufferSize")
+
+	resolved, err := Load(logConfig, "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), resolved.(map[string]interface{})["bufferSize"])
+	assert.Equal(t, "0", resolved.(map[string]interface{})["lookback"])
+
+	pluginConfig := writeConfig(t, dir, "custom-plugin-monitor.json", `{
+		"plugin": "custom",
+		"source": "ntp-custom-plugin-monitor",
+		"rules": [{"type": "temporary", "reason": "NTPIsDown", "path": "./config/plugin/check_ntp.sh"}]
+	}`)
+	resolved, err = Load(pluginConfig, "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "30s", resolved.(map[string]interface{})["pluginConfig"].(map[string]interface{})["invoke_interval"])
+
+	statsConfig := writeConfig(t, dir, "system-stats-monitor.json", `{"cpu": {"metricsConfigs": {}}}`)
+	resolved, err = Load(statsConfig, "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "1m0s", resolved.(map[string]interface{})["invokeInterval"])
+
+	invalid := writeConfig(t, dir, "invalid.json", `{"plugin": "custom", "pluginConfig": {"timeout": "5 seconds"}}`)
+	_, err = Load(invalid, "", true)
+	assert.Error(t, err)
+	_, err = Load(invalid, "", false)
+	assert.NoError(t, err, "raw configurations are not resolved")
+
+	unknown := writeConfig(t, dir, "unknown.json", `{"source": "unknown"}`)
+	_, err = Load(unknown, "", true)
+	assert.Error(t, err)
+	_, err = Load(unknown, SystemStatsMonitor, true)
+	assert.NoError(t, err)
+}
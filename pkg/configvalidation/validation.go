@@ -0,0 +1,326 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configvalidation validates the configuration files of the problem daemons and
+// the exporters off the nodes, rejecting unknown fields, so that a misspelled field does
+// not silently disable a rule.
+package configvalidation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cetypes "k8s.io/node-problem-detector/pkg/certexpirymonitor/types"
+	"k8s.io/node-problem-detector/pkg/configdiff"
+	"k8s.io/node-problem-detector/pkg/correlation"
+	cltypes "k8s.io/node-problem-detector/pkg/crashloopmonitor/types"
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	dlmtypes "k8s.io/node-problem-detector/pkg/disklatencymonitor/types"
+	dutypes "k8s.io/node-problem-detector/pkg/diskusagemonitor/types"
+	emtypes "k8s.io/node-problem-detector/pkg/evictionmonitor/types"
+	awsconfig "k8s.io/node-problem-detector/pkg/exporters/aws/config"
+	azureconfig "k8s.io/node-problem-detector/pkg/exporters/azure/config"
+	"k8s.io/node-problem-detector/pkg/exporters/enrichment"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/podsignal"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
+	nodeproblemconfig "k8s.io/node-problem-detector/pkg/exporters/nodeproblem/config"
+	notificationconfig "k8s.io/node-problem-detector/pkg/exporters/notification/config"
+	otlpconfig "k8s.io/node-problem-detector/pkg/exporters/otlp/config"
+	"k8s.io/node-problem-detector/pkg/exporters/problembudget"
+	seconfig "k8s.io/node-problem-detector/pkg/exporters/stackdriver/config"
+	"k8s.io/node-problem-detector/pkg/exporters/suppression"
+	syslogconfig "k8s.io/node-problem-detector/pkg/exporters/syslog/config"
+	fstypes "k8s.io/node-problem-detector/pkg/filesystemerrormonitor/types"
+	"k8s.io/node-problem-detector/pkg/flapdamping"
+	hctypes "k8s.io/node-problem-detector/pkg/healthchecker/types"
+	"k8s.io/node-problem-detector/pkg/healthscore"
+	igmtypes "k8s.io/node-problem-detector/pkg/imagegcmonitor/types"
+	"k8s.io/node-problem-detector/pkg/journal"
+	kmtypes "k8s.io/node-problem-detector/pkg/kdumpmonitor/types"
+	kttypes "k8s.io/node-problem-detector/pkg/kerneltaintmonitor/types"
+	memtypes "k8s.io/node-problem-detector/pkg/memoryerrormonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemsummary"
+	rtypes "k8s.io/node-problem-detector/pkg/rebootmonitor/types"
+	rhmtypes "k8s.io/node-problem-detector/pkg/runtimehangmonitor/types"
+	scrubtypes "k8s.io/node-problem-detector/pkg/scrubmonitor/types"
+	shtypes "k8s.io/node-problem-detector/pkg/securityhygienemonitor/types"
+	sptypes "k8s.io/node-problem-detector/pkg/securitypolicymonitor/types"
+	selftypes "k8s.io/node-problem-detector/pkg/selfmonitor/types"
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor"
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+// validateFunc decodes and validates a configuration. With checkPaths, the plugins the
+// configuration references must exist.
+type validateFunc func(data []byte, checkPaths bool) error
+
+// kinds are the validations of the kinds of configuration files, by the problem daemon
+// type or the flag the configuration file is passed with.
+var kinds = map[string]validateFunc{
+	configdiff.SystemLogMonitor: func(data []byte, _ bool) error {
+		var c systemlogmonitor.MonitorConfig
+		if err := util.UnmarshalStrict(data, &c); err != nil {
+			return err
+		}
+		c.ApplyDefaultConfiguration()
+		return c.ValidateRules()
+	},
+	configdiff.CustomPluginMonitor: func(data []byte, checkPaths bool) error {
+		var c cpmtypes.CustomPluginConfig
+		if err := util.UnmarshalStrict(data, &c); err != nil {
+			return err
+		}
+		// The rules directory is on the node, like the plugins.
+		if checkPaths {
+			if err := c.DiscoverRules(); err != nil {
+				return err
+			}
+		}
+		if err := c.ApplyConfiguration(); err != nil {
+			return err
+		}
+		if checkPaths {
+			return c.Validate()
+		}
+		return c.ValidateSettings()
+	},
+	configdiff.SystemStatsMonitor: func(data []byte, _ bool) error {
+		var c ssmtypes.SystemStatsConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"cert-expiry-monitor": func(data []byte, _ bool) error {
+		var c cetypes.CertExpiryConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"crash-loop-monitor": func(data []byte, _ bool) error {
+		var c cltypes.CrashLoopConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"disk-latency-monitor": func(data []byte, _ bool) error {
+		var c dlmtypes.DiskLatencyConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"disk-usage-monitor": func(data []byte, _ bool) error {
+		var c dutypes.DiskUsageConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"eviction-monitor": func(data []byte, _ bool) error {
+		var c emtypes.EvictionConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"filesystem-error-monitor": func(data []byte, _ bool) error {
+		var c fstypes.FilesystemErrorConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"image-gc-monitor": func(data []byte, _ bool) error {
+		var c igmtypes.ImageGCConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"kernel-taint-monitor": func(data []byte, _ bool) error {
+		var c kttypes.KernelTaintConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"kdump-monitor": func(data []byte, _ bool) error {
+		var c kmtypes.KdumpConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"memory-error-monitor": func(data []byte, _ bool) error {
+		var c memtypes.MemoryErrorConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"reboot-monitor": func(data []byte, _ bool) error {
+		var c rtypes.RebootConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"runtime-hang-monitor": func(data []byte, _ bool) error {
+		var c rhmtypes.RuntimeHangConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"scrub-monitor": func(data []byte, _ bool) error {
+		var c scrubtypes.ScrubConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"security-hygiene-monitor": func(data []byte, _ bool) error {
+		var c shtypes.SecurityHygieneConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"security-policy-monitor": func(data []byte, _ bool) error {
+		var c sptypes.SecurityPolicyConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"self-monitor": func(data []byte, _ bool) error {
+		var c selftypes.SelfMonitorConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"health-checker-component": func(data []byte, _ bool) error {
+		var c hctypes.ComponentConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"condition-correlation": func(data []byte, _ bool) error {
+		var c correlation.Config
+		return decode(data, &c, noError(c.ApplyConfiguration), c.Validate)
+	},
+	"problem-summary": func(data []byte, _ bool) error {
+		var c problemsummary.Config
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"health-score": func(data []byte, _ bool) error {
+		var c healthscore.Config
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"flap-damping": func(data []byte, _ bool) error {
+		var c flapdamping.Config
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"event-journal": func(data []byte, _ bool) error {
+		var c journal.Config
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"problem-budget": func(data []byte, _ bool) error {
+		var c problembudget.Config
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"node-enrichment": func(data []byte, _ bool) error {
+		var c enrichment.Config
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"suppression": func(data []byte, _ bool) error {
+		var c suppression.Config
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"pod-signal": func(data []byte, _ bool) error {
+		var c podsignal.Config
+		return decode(data, &c, noError(c.ApplyConfiguration), c.Validate)
+	},
+	"event-target": func(data []byte, _ bool) error {
+		var c problemclient.EventTargetConfig
+		return decode(data, &c, noError(func() {}), c.Validate)
+	},
+	"aws-exporter": func(data []byte, _ bool) error {
+		var c awsconfig.AWSExporterConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"azure-exporter": func(data []byte, _ bool) error {
+		var c azureconfig.AzureExporterConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"nodeproblem-exporter": func(data []byte, _ bool) error {
+		var c nodeproblemconfig.NodeProblemExporterConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"notification-exporter": func(data []byte, _ bool) error {
+		var c notificationconfig.NotificationExporterConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"otlp-exporter": func(data []byte, _ bool) error {
+		var c otlpconfig.OTLPExporterConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+	"stackdriver-exporter": func(data []byte, _ bool) error {
+		var c seconfig.StackdriverExporterConfig
+		return decode(data, &c, noError(c.ApplyConfiguration), c.Validate)
+	},
+	"syslog-exporter": func(data []byte, _ bool) error {
+		var c syslogconfig.SyslogExporterConfig
+		return decode(data, &c, c.ApplyConfiguration, c.Validate)
+	},
+}
+
+// decode strictly decodes the configuration into config, applies its defaults and
+// validates it. apply and validate are the methods of config, which must have pointer
+// receivers so that they see the decoded configuration.
+func decode(data []byte, config interface{}, apply, validate func() error) error {
+	if err := util.UnmarshalStrict(data, config); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	return validate()
+}
+
+func noError(f func()) func() error {
+	return func() error {
+		f()
+		return nil
+	}
+}
+
+// Kinds returns the names of the kinds of configuration files, sorted.
+func Kinds() []string {
+	var names []string
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Detect returns the kind of a configuration file, or an empty string if it is unknown.
+// The kind is detected from the source of the configuration, the file name, e.g.
+// "problem-budget.json", or the fields of the configuration, in this order.
+func Detect(path string, data []byte) string {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return ""
+	}
+	if config, ok := raw.(map[string]interface{}); ok {
+		if source, ok := config["source"].(string); ok && kinds[source] != nil {
+			return source
+		}
+	}
+	if name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)); kinds[name] != nil {
+		return name
+	}
+	if kind := configdiff.Detect(raw); kind != "" {
+		return kind
+	}
+	// The health checker components are not problem daemons, they only have a check.
+	if config, ok := raw.(map[string]interface{}); ok && config["check"] != nil {
+		return "health-checker-component"
+	}
+	return ""
+}
+
+// Validate validates the configuration of the kind. With checkPaths, the plugins the
+// configuration references must exist.
+func Validate(kind string, data []byte, checkPaths bool) error {
+	validate, ok := kinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %q, expected one of %s", kind, strings.Join(Kinds(), ", "))
+	}
+	return validate(data, checkPaths)
+}
+
+// ValidateFile validates a configuration file, and returns its kind. An empty kind is
+// detected from the configuration file.
+func ValidateFile(path, kind string, checkPaths bool) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return kind, fmt.Errorf("failed to read configuration file %q: %v", path, err)
+	}
+	if kind == "" {
+		if kind = Detect(path, data); kind == "" {
+			return "", fmt.Errorf("failed to detect the kind of configuration file %q, set it explicitly", path)
+		}
+	}
+	return kind, Validate(kind, data, checkPaths)
+}
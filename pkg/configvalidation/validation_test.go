@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configvalidation
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRepoConfigs(t *testing.T) {
+	paths, err := filepath.Glob("../../config/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporterPaths, err := filepath.Glob("../../config/exporter/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthCheckerPaths, err := filepath.Glob("../../config/health-checker/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths = append(paths, exporterPaths...)
+	for _, path := range append(paths, healthCheckerPaths...) {
+		kind, err := ValidateFile(path, "", false)
+		if err != nil {
+			t.Errorf("Invalid config %q of kind %q: %v", path, kind, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := map[string]struct {
+		path string
+		data string
+		kind string
+		err  string
+	}{
+		"detected from the source": {
+			path: "reboot.json",
+			data: `{"source": "reboot-monitor", "rebootThreshold": 2}`,
+			kind: "reboot-monitor",
+		},
+		"detected from the file name": {
+			path: "config/problem-budget.json",
+			data: `{"budgets": []}`,
+			kind: "problem-budget",
+		},
+		"detected from the fields": {
+			path: "kernel.json",
+			data: `{"plugin": "kmsg", "source": "kernel-monitor", "rules": []}`,
+			kind: "system-log-monitor",
+		},
+		"health checker component": {
+			path: "config/health-checker/kube-proxy.json",
+			data: `{"name": "kube-proxy", "check": {"type": "tcp", "endpoint": "127.0.0.1:10256"}}`,
+			kind: "health-checker-component",
+		},
+		"misspelled field": {
+			path: "kernel.json",
+			data: `{"plugin": "kmsg", "source": "kernel-monitor", "conditio": [], "rules": [{"type": "temporary", "reason": "OOMKilling", "patern": "Killed process"}]}`,
+			kind: "system-log-monitor",
+			err:  `unknown field "conditio", did you mean "conditions"?; unknown field "rules[0].patern", did you mean "pattern"?`,
+		},
+		"invalid setting": {
+			path: "reboot.json",
+			data: `{"source": "reboot-monitor", "rebootThreshold": -1}`,
+			kind: "reboot-monitor",
+			err:  "RebootThreshold",
+		},
+		"unknown kind": {
+			path: "unknown.json",
+			data: `{"foo": "bar"}`,
+		},
+	}
+	for desc, test := range testCases {
+		t.Run(desc, func(t *testing.T) {
+			kind := Detect(test.path, []byte(test.data))
+			if kind != test.kind {
+				t.Fatalf("Expected kind %q, got %q", test.kind, kind)
+			}
+			if kind == "" {
+				return
+			}
+			err := Validate(kind, []byte(test.data), false)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
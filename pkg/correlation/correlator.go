@@ -0,0 +1,196 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package correlation derives higher level conditions from the combinations of
+// the conditions reported by the problem daemons.
+package correlation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+const defaultSource = "condition-correlator"
+
+// Rule derives a condition from a boolean expression over condition states.
+type Rule struct {
+	// Condition is the type of the derived condition.
+	Condition string `json:"condition"`
+	// Expression is a boolean expression over condition types, e.g.
+	// "KernelDeadlock || (ReadonlyFilesystem && !CorruptDockerOverlay2)". A condition
+	// type is true when the condition has status True.
+	Expression string `json:"expression"`
+	// Reason is the reason of the derived condition when the expression is true.
+	Reason string `json:"reason"`
+	// DefaultReason is the reason of the derived condition when the expression is false.
+	DefaultReason string `json:"defaultReason"`
+	// DefaultMessage is the message of the derived condition when the expression is false.
+	// When the expression is true, the message lists the true conditions it refers to.
+	DefaultMessage string `json:"defaultMessage"`
+
+	expression expression
+}
+
+// Config is the configuration of the correlator.
+type Config struct {
+	// Source is the source of the derived conditions. Default to "condition-correlator".
+	Source string `json:"source"`
+	// Rules are the rules deriving conditions.
+	Rules []*Rule `json:"rules"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() {
+	if c.Source == "" {
+		c.Source = defaultSource
+	}
+	for _, rule := range c.Rules {
+		if rule.Reason == "" {
+			rule.Reason = rule.Condition
+		}
+		if rule.DefaultReason == "" {
+			rule.DefaultReason = "No" + rule.Condition
+		}
+		if rule.DefaultMessage == "" {
+			rule.DefaultMessage = fmt.Sprintf("%s is false", rule.Expression)
+		}
+	}
+}
+
+// Validate verifies whether the settings are valid, and parses the expressions.
+func (c *Config) Validate() error {
+	derived := map[string]bool{}
+	for _, rule := range c.Rules {
+		if rule.Condition == "" {
+			return fmt.Errorf("rule %+v has no condition", rule)
+		}
+		if derived[rule.Condition] {
+			return fmt.Errorf("condition %q is derived by more than one rule", rule.Condition)
+		}
+		derived[rule.Condition] = true
+		e, err := parseExpression(rule.Expression)
+		if err != nil {
+			return fmt.Errorf("invalid expression %q of condition %q: %v", rule.Expression, rule.Condition, err)
+		}
+		rule.expression = e
+	}
+	return nil
+}
+
+// Correlator derives conditions according to the rules.
+type Correlator struct {
+	config Config
+	// conditions is the latest derived conditions, keyed by condition type.
+	conditions map[string]types.Condition
+}
+
+// NewCorrelator creates a correlator from a config file.
+func NewCorrelator(configPath string) (*Correlator, error) {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	var config Config
+	if err := util.UnmarshalStrict(f, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	config.ApplyConfiguration()
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", configPath, err)
+	}
+	return newCorrelator(config), nil
+}
+
+func newCorrelator(config Config) *Correlator {
+	return &Correlator{
+		config:     config,
+		conditions: map[string]types.Condition{},
+	}
+}
+
+// Source returns the source of the derived conditions.
+func (c *Correlator) Source() string {
+	return c.config.Source
+}
+
+// Correlate evaluates the rules against the latest conditions of all sources, keyed by
+// source and condition type. It returns all derived conditions, and an event for each
+// derived condition whose status changed. The derived conditions themselves are not
+// used as inputs.
+func (c *Correlator) Correlate(conditions map[string]map[string]types.Condition, now time.Time) *types.Status {
+	active := map[string]bool{}
+	for source, byType := range conditions {
+		if source == c.config.Source {
+			continue
+		}
+		for conditionType, condition := range byType {
+			if condition.Status == types.True {
+				active[conditionType] = true
+			}
+		}
+	}
+
+	status := &types.Status{Source: c.config.Source}
+	for _, rule := range c.config.Rules {
+		condition := types.Condition{
+			Type:    rule.Condition,
+			Status:  types.False,
+			Reason:  rule.DefaultReason,
+			Message: rule.DefaultMessage,
+		}
+		if rule.expression.eval(active) {
+			condition.Status = types.True
+			condition.Reason = rule.Reason
+			condition.Message = activeMessage(rule.expression, active)
+		}
+
+		last, ok := c.conditions[rule.Condition]
+		if ok && last.Status == condition.Status {
+			condition.Transition = last.Transition
+		} else {
+			condition.Transition = now
+			// Like other problem daemons, no event is generated for the initial false condition.
+			if ok || condition.Status == types.True {
+				status.Events = append(status.Events,
+					util.GenerateConditionChangeEvent(condition.Type, condition.Status, condition.Reason, now))
+			}
+		}
+		c.conditions[rule.Condition] = condition
+		status.Conditions = append(status.Conditions, condition)
+	}
+	return status
+}
+
+// activeMessage lists the true conditions the expression refers to.
+func activeMessage(e expression, active map[string]bool) string {
+	var trueTypes []string
+	seen := map[string]bool{}
+	for _, t := range e.conditionTypes(nil) {
+		if active[t] && !seen[t] {
+			seen[t] = true
+			trueTypes = append(trueTypes, t)
+		}
+	}
+	if len(trueTypes) == 0 {
+		return "derived from conditions with no true status"
+	}
+	return fmt.Sprintf("derived from true conditions: %s", strings.Join(trueTypes, ", "))
+}
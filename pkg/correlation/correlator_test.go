@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package correlation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestParseExpression(t *testing.T) {
+	active := map[string]bool{"KernelDeadlock": true, "ReadonlyFilesystem": false}
+	testCases := []struct {
+		expression string
+		expected   bool
+		isError    bool
+	}{
+		{expression: "KernelDeadlock", expected: true},
+		{expression: "!KernelDeadlock", expected: false},
+		{expression: "KernelDeadlock && ReadonlyFilesystem", expected: false},
+		{expression: "KernelDeadlock || ReadonlyFilesystem", expected: true},
+		{expression: "ReadonlyFilesystem || KernelDeadlock && !Unknown", expected: true},
+		{expression: "(ReadonlyFilesystem || KernelDeadlock) && Unknown", expected: false},
+		{expression: "!(ReadonlyFilesystem) && true", expected: true},
+		{expression: "false || !!KernelDeadlock", expected: true},
+		{expression: "", isError: true},
+		{expression: "KernelDeadlock &", isError: true},
+		{expression: "KernelDeadlock ||", isError: true},
+		{expression: "(KernelDeadlock", isError: true},
+		{expression: "KernelDeadlock)", isError: true},
+		{expression: "KernelDeadlock ReadonlyFilesystem", isError: true},
+		{expression: "KernelDeadlock == True", isError: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.expression, func(t *testing.T) {
+			e, err := parseExpression(test.expression)
+			if test.isError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, e.eval(active))
+		})
+	}
+}
+
+func TestCorrelate(t *testing.T) {
+	config := Config{Rules: []*Rule{{
+		Condition:  "NodeDegraded",
+		Expression: "KernelDeadlock || ReadonlyFilesystem || FrequentKubeletRestart",
+	}}}
+	config.ApplyConfiguration()
+	assert.NoError(t, config.Validate())
+	c := newCorrelator(config)
+
+	now := time.Now()
+	conditions := map[string]map[string]types.Condition{
+		"kernel-monitor": {
+			"KernelDeadlock":     {Type: "KernelDeadlock", Status: types.False},
+			"ReadonlyFilesystem": {Type: "ReadonlyFilesystem", Status: types.False},
+		},
+	}
+
+	// The initial false condition has no event.
+	status := c.Correlate(conditions, now)
+	assert.Equal(t, defaultSource, status.Source)
+	assert.Empty(t, status.Events)
+	assert.Equal(t, []types.Condition{{
+		Type:       "NodeDegraded",
+		Status:     types.False,
+		Transition: now,
+		Reason:     "NoNodeDegraded",
+		Message:    "KernelDeadlock || ReadonlyFilesystem || FrequentKubeletRestart is false",
+	}}, status.Conditions)
+
+	later := now.Add(time.Minute)
+	conditions["kernel-monitor"]["ReadonlyFilesystem"] = types.Condition{Type: "ReadonlyFilesystem", Status: types.True}
+	conditions["kubelet-monitor"] = map[string]types.Condition{
+		"FrequentKubeletRestart": {Type: "FrequentKubeletRestart", Status: types.True},
+	}
+	status = c.Correlate(conditions, later)
+	assert.Len(t, status.Events, 1)
+	assert.Equal(t, []types.Condition{{
+		Type:       "NodeDegraded",
+		Status:     types.True,
+		Transition: later,
+		Reason:     "NodeDegraded",
+		Message:    "derived from true conditions: ReadonlyFilesystem, FrequentKubeletRestart",
+	}}, status.Conditions)
+
+	// The derived conditions are not used as inputs.
+	conditions[defaultSource] = map[string]types.Condition{"KernelDeadlock": {Type: "KernelDeadlock", Status: types.True}}
+	delete(conditions, "kubelet-monitor")
+	conditions["kernel-monitor"]["ReadonlyFilesystem"] = types.Condition{Type: "ReadonlyFilesystem", Status: types.False}
+	status = c.Correlate(conditions, later.Add(time.Minute))
+	assert.Len(t, status.Events, 1)
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+}
+
+func TestValidate(t *testing.T) {
+	config := Config{Rules: []*Rule{
+		{Condition: "NodeDegraded", Expression: "KernelDeadlock"},
+		{Condition: "NodeDegraded", Expression: "ReadonlyFilesystem"},
+	}}
+	config.ApplyConfiguration()
+	assert.Error(t, config.Validate())
+
+	config = Config{Rules: []*Rule{{Condition: "NodeDegraded", Expression: "KernelDeadlock &&"}}}
+	config.ApplyConfiguration()
+	assert.Error(t, config.Validate())
+}
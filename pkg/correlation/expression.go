@@ -0,0 +1,218 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package correlation
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// expression is a boolean expression over the states of conditions. The grammar is:
+//
+//	expr    = or
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | primary
+//	primary = "(" expr ")" | "true" | "false" | ConditionType
+//
+// A ConditionType is true when the condition of that type has status True.
+type expression interface {
+	// eval evaluates the expression against the condition types with status True.
+	eval(active map[string]bool) bool
+	// conditionTypes appends the condition types referred by the expression.
+	conditionTypes(types []string) []string
+}
+
+type orExpr struct{ left, right expression }
+type andExpr struct{ left, right expression }
+type notExpr struct{ operand expression }
+type literalExpr struct{ value bool }
+type conditionExpr struct{ conditionType string }
+
+func (e *orExpr) eval(active map[string]bool) bool {
+	return e.left.eval(active) || e.right.eval(active)
+}
+
+func (e *orExpr) conditionTypes(types []string) []string {
+	return e.right.conditionTypes(e.left.conditionTypes(types))
+}
+
+func (e *andExpr) eval(active map[string]bool) bool {
+	return e.left.eval(active) && e.right.eval(active)
+}
+
+func (e *andExpr) conditionTypes(types []string) []string {
+	return e.right.conditionTypes(e.left.conditionTypes(types))
+}
+
+func (e *notExpr) eval(active map[string]bool) bool {
+	return !e.operand.eval(active)
+}
+
+func (e *notExpr) conditionTypes(types []string) []string {
+	return e.operand.conditionTypes(types)
+}
+
+func (e *literalExpr) eval(map[string]bool) bool {
+	return e.value
+}
+
+func (e *literalExpr) conditionTypes(types []string) []string {
+	return types
+}
+
+func (e *conditionExpr) eval(active map[string]bool) bool {
+	return active[e.conditionType]
+}
+
+func (e *conditionExpr) conditionTypes(types []string) []string {
+	return append(types, e.conditionType)
+}
+
+// parseExpression parses a boolean expression.
+func parseExpression(s string) (expression, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression %q", p.tokens[p.pos], s)
+	}
+	return e, nil
+}
+
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '!':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '&' || r == '|':
+			if i+1 >= len(runes) || runes[i+1] != r {
+				return nil, fmt.Errorf("invalid operator %q at position %d, expected %q", r, i, string([]rune{r, r}))
+			}
+			tokens = append(tokens, string([]rune{r, r}))
+			i += 2
+		case isIdentifierRune(r):
+			start := i
+			for i < len(runes) && isIdentifierRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			return nil, fmt.Errorf("invalid character %q at position %d", r, i)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' || r == '/'
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) parseOr() (expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expression, error) {
+	if p.peek() == "!" {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expression, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "(":
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return e, nil
+	case ")", "!", "&&", "||":
+		return nil, fmt.Errorf("unexpected %q", token)
+	case "true", "false":
+		p.pos++
+		return &literalExpr{value: token == "true"}, nil
+	default:
+		p.pos++
+		return &conditionExpr{conditionType: token}, nil
+	}
+}
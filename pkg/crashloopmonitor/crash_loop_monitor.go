@@ -0,0 +1,331 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crashloopmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	cltypes "k8s.io/node-problem-detector/pkg/crashloopmonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const CrashLoopMonitorName = "crash-loop-monitor"
+
+const (
+	healthyReason      = "NodeIsNotCrashLooping"
+	healthyMessage     = "node is not crash looping"
+	crashLoopReason    = "NodeCrashLooping"
+	abnormalBootReason = "AbnormalBoot"
+)
+
+func init() {
+	problemdaemon.Register(CrashLoopMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewCrashLoopMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type crashLoopMonitor struct {
+	configPath string
+	config     cltypes.CrashLoopConfig
+	// bootTime returns the time the node booted.
+	bootTime func() (time.Time, error)
+	// state is the persisted state, nil if the current boot could not be recorded.
+	state      *state
+	condition  types.Condition
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewCrashLoopMonitorOrDie creates a crash loop monitor, panics if error occurs.
+func NewCrashLoopMonitorOrDie(configPath string) types.Monitor {
+	clm := crashLoopMonitor{
+		configPath: configPath,
+		bootTime:   util.GetBootTime,
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &clm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = clm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = clm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, clm.config, err)
+	}
+
+	// A 1000 size channel should be big enough.
+	clm.statusChan = make(chan *types.Status, 1000)
+
+	if *clm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(clm.config.ConditionType)
+	}
+	return &clm
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for all problems and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, crashLoopReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			conditionType, crashLoopReason, err)
+	}
+	for _, reason := range []string{abnormalBootReason, crashLoopReason} {
+		err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+		}
+	}
+}
+
+func (clm *crashLoopMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start crash loop monitor %s", clm.configPath)
+	problemdaemon.Go(clm, clm.monitorLoop)
+	return clm.statusChan, nil
+}
+
+func (clm *crashLoopMonitor) Stop() {
+	glog.Infof("Stop crash loop monitor %s", clm.configPath)
+	clm.tomb.Stop()
+}
+
+func (clm *crashLoopMonitor) monitorLoop() {
+	defer clm.tomb.Done()
+
+	runTicker := time.NewTicker(clm.config.CheckInterval)
+	defer runTicker.Stop()
+
+	clm.initializeStatus()
+	if event := clm.recordBoot(); event != nil {
+		clm.statusChan <- &types.Status{
+			Source: clm.config.Source,
+			Events: []types.Event{*event},
+		}
+	}
+	if status := clm.check(time.Now()); status != nil {
+		clm.statusChan <- status
+	}
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := clm.check(now); status != nil {
+				clm.statusChan <- status
+			}
+		case <-clm.tomb.Stopping():
+			glog.Infof("Crash loop monitor stopped: %s", clm.configPath)
+			return
+		}
+	}
+}
+
+func (clm *crashLoopMonitor) initializeStatus() {
+	clm.condition = types.Condition{
+		Type:       clm.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     healthyReason,
+		Message:    healthyMessage,
+	}
+	clm.statusChan <- &types.Status{
+		Source:     clm.config.Source,
+		Conditions: []types.Condition{clm.condition},
+	}
+}
+
+// recordBoot records the current boot if it is not recorded yet, and returns an event if
+// it followed a crash. A boot follows a crash when crash records appeared since the
+// previous boot. When there is no previous boot record, the existing crash records are
+// taken as the baseline.
+func (clm *crashLoopMonitor) recordBoot() *types.Event {
+	s := &state{}
+	if err := util.LoadState(clm.config.StatePath, s); err != nil {
+		glog.Errorf("Failed to load boot records from %q, start over: %v", clm.config.StatePath, err)
+		s = &state{}
+	}
+	bootID, err := util.ReadBootID(clm.config.BootIDPath)
+	if err != nil {
+		glog.Errorf("Failed to read boot id: %v", err)
+		return nil
+	}
+	bootTime, err := clm.bootTime()
+	if err != nil {
+		glog.Errorf("Failed to get boot time: %v", err)
+		return nil
+	}
+	evidence, err := listEvidence(clm.config.EvidencePaths)
+	if err != nil {
+		glog.Errorf("Failed to list crash records: %v", err)
+		return nil
+	}
+	clm.state = s
+	for _, boot := range s.Boots {
+		if boot.BootID == bootID {
+			// Node problem detector restarted, the boot is already recorded.
+			return nil
+		}
+	}
+
+	boot := bootRecord{BootID: bootID, BootTime: bootTime}
+	if len(s.Boots) > 0 {
+		seen := make(map[string]bool)
+		for _, e := range s.Seen {
+			seen[e] = true
+		}
+		for _, e := range evidence {
+			if !seen[e] {
+				boot.Evidence = append(boot.Evidence, e)
+			}
+		}
+		boot.Abnormal = len(boot.Evidence) > 0
+	}
+	s.Boots = append(s.Boots, boot)
+	if len(s.Boots) > *clm.config.MaxBootRecords {
+		s.Boots = s.Boots[len(s.Boots)-*clm.config.MaxBootRecords:]
+	}
+	// Crash records which were removed are forgotten.
+	s.Seen = evidence
+	if err := util.SaveState(clm.config.StatePath, s); err != nil {
+		glog.Errorf("Failed to save boot records to %q: %v", clm.config.StatePath, err)
+	}
+	glog.Infof("Recorded boot %+v", boot)
+
+	if !boot.Abnormal {
+		return nil
+	}
+	if *clm.config.EnableMetricsReporting {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(abnormalBootReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", abnormalBootReason, err)
+		}
+	}
+	return &types.Event{
+		Severity:  types.Warn,
+		Timestamp: bootTime,
+		Reason:    abnormalBootReason,
+		Message:   fmt.Sprintf("Node booted after a crash, crash records: %s", strings.Join(boot.Evidence, ", ")),
+	}
+}
+
+// check attributes the crash records which appeared during the current boot to it, e.g.
+// pstore records archived after the boot, and returns a new status if the condition
+// changes. The condition is set when the latest CrashThreshold boots in the crash window
+// all followed crashes.
+func (clm *crashLoopMonitor) check(now time.Time) *types.Status {
+	if clm.state == nil {
+		return nil
+	}
+	clm.attributeEvidence()
+
+	consecutive := 0
+	var latest bootRecord
+	for i := len(clm.state.Boots) - 1; i >= 0; i-- {
+		boot := clm.state.Boots[i]
+		if !boot.Abnormal || now.Sub(boot.BootTime) > clm.config.CrashWindow {
+			break
+		}
+		if consecutive == 0 {
+			latest = boot
+		}
+		consecutive++
+	}
+
+	status, reason, message := types.False, healthyReason, healthyMessage
+	if consecutive >= *clm.config.CrashThreshold {
+		status, reason = types.True, crashLoopReason
+		message = fmt.Sprintf("Node booted after a crash %d consecutive times in %v, latest crash records: %s",
+			consecutive, clm.config.CrashWindow, strings.Join(latest.Evidence, ", "))
+	}
+	if clm.condition.Status == status && clm.condition.Message == message {
+		return nil
+	}
+
+	var events []types.Event
+	if clm.condition.Status != status {
+		clm.condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(clm.condition.Type, status, reason, now))
+		if *clm.config.EnableMetricsReporting {
+			clm.updateProblemMetrics(status == types.True)
+		}
+	}
+	clm.condition.Status = status
+	clm.condition.Reason = reason
+	clm.condition.Message = message
+	return &types.Status{
+		Source:     clm.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{clm.condition},
+	}
+}
+
+// attributeEvidence marks the crash records which appeared during the current boot as
+// seen, so that they do not make the next boot abnormal.
+func (clm *crashLoopMonitor) attributeEvidence() {
+	evidence, err := listEvidence(clm.config.EvidencePaths)
+	if err != nil {
+		glog.Errorf("Failed to list crash records: %v", err)
+		return
+	}
+	seen := make(map[string]bool)
+	for _, e := range clm.state.Seen {
+		seen[e] = true
+	}
+	changed := false
+	for _, e := range evidence {
+		if !seen[e] {
+			clm.state.Seen = append(clm.state.Seen, e)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := util.SaveState(clm.config.StatePath, clm.state); err != nil {
+		glog.Errorf("Failed to save boot records to %q: %v", clm.config.StatePath, err)
+	}
+}
+
+func (clm *crashLoopMonitor) updateProblemMetrics(active bool) {
+	if active {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(crashLoopReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", crashLoopReason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(clm.config.ConditionType, crashLoopReason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			clm.config.ConditionType, crashLoopReason, err)
+	}
+}
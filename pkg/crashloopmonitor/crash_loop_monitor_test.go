@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crashloopmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cltypes "k8s.io/node-problem-detector/pkg/crashloopmonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(CrashLoopMonitorName) },
+		"Crash loop monitor failed to register itself as a problem daemon.")
+}
+
+// testNode simulates the boots of a node.
+type testNode struct {
+	t        *testing.T
+	dir      string
+	pstore   string
+	bootTime time.Time
+}
+
+func newTestNode(t *testing.T) *testNode {
+	dir, err := ioutil.TempDir("", "crash-loop")
+	assert.NoError(t, err)
+	pstore := filepath.Join(dir, "pstore")
+	assert.NoError(t, os.MkdirAll(pstore, 0755))
+	return &testNode{t: t, dir: dir, pstore: pstore}
+}
+
+func (n *testNode) crash(record string) {
+	assert.NoError(n.t, ioutil.WriteFile(filepath.Join(n.pstore, record), []byte("Kernel panic"), 0644))
+}
+
+// boot boots the node, and starts a crash loop monitor, which records the boot.
+func (n *testNode) boot(bootID string, bootTime time.Time) (*crashLoopMonitor, *types.Event) {
+	assert.NoError(n.t, ioutil.WriteFile(filepath.Join(n.dir, "boot_id"), []byte(bootID+"\n"), 0644))
+	n.bootTime = bootTime
+	disabled := false
+	threshold := 3
+	clm := &crashLoopMonitor{
+		config: cltypes.CrashLoopConfig{
+			StatePath:              filepath.Join(n.dir, "state", "boot-records.json"),
+			BootIDPath:             filepath.Join(n.dir, "boot_id"),
+			EvidencePaths:          []string{n.pstore, filepath.Join(n.dir, "non-exist")},
+			CrashWindowString:      "1h",
+			CrashThreshold:         &threshold,
+			EnableMetricsReporting: &disabled,
+		},
+		bootTime:   func() (time.Time, error) { return n.bootTime, nil },
+		statusChan: make(chan *types.Status, 1000),
+	}
+	assert.NoError(n.t, clm.config.ApplyConfiguration())
+	assert.NoError(n.t, clm.config.Validate())
+	clm.initializeStatus()
+	<-clm.statusChan
+	return clm, clm.recordBoot()
+}
+
+func TestCrashLoop(t *testing.T) {
+	n := newTestNode(t)
+	defer os.RemoveAll(n.dir)
+	start := time.Now()
+
+	// Crash records existing before the first boot record are the baseline.
+	n.crash("dmesg-ramoops-0")
+	clm, event := n.boot("boot-1", start)
+	assert.Nil(t, event)
+	assert.Nil(t, clm.check(start))
+
+	// Three consecutive crashes set the condition.
+	var status *types.Status
+	for i, id := range []string{"boot-2", "boot-3", "boot-4"} {
+		n.crash("dmesg-ramoops-" + id)
+		bootTime := start.Add(time.Duration(i+1) * 10 * time.Minute)
+		clm, event = n.boot(id, bootTime)
+		assert.NotNil(t, event)
+		assert.Equal(t, "AbnormalBoot", event.Reason)
+		assert.Equal(t, "Node booted after a crash, crash records: "+filepath.Join(n.pstore, "dmesg-ramoops-"+id), event.Message)
+		status = clm.check(bootTime)
+	}
+	assert.NotNil(t, status)
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+	assert.Equal(t, "NodeCrashLooping", status.Conditions[0].Reason)
+	assert.Equal(t, "Node booted after a crash 3 consecutive times in 1h0m0s, latest crash records: "+
+		filepath.Join(n.pstore, "dmesg-ramoops-boot-4"), status.Conditions[0].Message)
+
+	// A restart of node problem detector does not record the boot again.
+	clm, event = n.boot("boot-4", start.Add(30*time.Minute))
+	assert.Nil(t, event)
+	status = clm.check(start.Add(35 * time.Minute))
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+
+	// The condition is cleared when the crashes age out of the window.
+	status = clm.check(start.Add(75 * time.Minute))
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+
+	// Crash records appearing during a boot, e.g. archived pstore records, are attributed
+	// to it, and a normal boot resets the crash loop.
+	n.crash("archived-boot-4")
+	assert.Nil(t, clm.check(start.Add(80*time.Minute)))
+	clm, event = n.boot("boot-5", start.Add(90*time.Minute))
+	assert.Nil(t, event)
+	for i, id := range []string{"boot-6", "boot-7"} {
+		n.crash("dmesg-ramoops-" + id)
+		clm, event = n.boot(id, start.Add(time.Duration(i+10)*10*time.Minute))
+		assert.NotNil(t, event)
+	}
+	assert.Nil(t, clm.check(start.Add(110*time.Minute)))
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crashloopmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// bootRecord is the record of a boot of the node.
+type bootRecord struct {
+	BootID   string    `json:"bootID"`
+	BootTime time.Time `json:"bootTime"`
+	// Abnormal is whether the boot followed a crash.
+	Abnormal bool `json:"abnormal"`
+	// Evidence are the crash records which appeared since the previous boot.
+	Evidence []string `json:"evidence,omitempty"`
+}
+
+// state is the state of the crash loop monitor persisted across boots.
+type state struct {
+	// Boots are the records of the latest boots, oldest first.
+	Boots []bootRecord `json:"boots"`
+	// Seen are the crash records already attributed to a boot.
+	Seen []string `json:"seen"`
+}
+
+// listEvidence lists the crash records in the evidence directories, sorted. Directories
+// which do not exist are skipped.
+func listEvidence(paths []string) ([]string, error) {
+	var evidence []string
+	for _, path := range paths {
+		files, err := ioutil.ReadDir(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			evidence = append(evidence, filepath.Join(path, file.Name()))
+		}
+	}
+	sort.Strings(evidence)
+	return evidence, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	defaultSource              = "crash-loop-monitor"
+	defaultConditionType       = "NodeCrashLooping"
+	defaultStatePath           = "/var/lib/node-problem-detector/boot-records.json"
+	defaultBootIDPath          = "/proc/sys/kernel/random/boot_id"
+	defaultEvidencePaths       = []string{"/sys/fs/pstore", "/var/lib/systemd/pstore", "/var/crash"}
+	defaultCheckIntervalString = (10 * time.Minute).String()
+	defaultCrashWindowString   = (24 * time.Hour).String()
+	defaultCrashThreshold      = 3
+	defaultMaxBootRecords      = 100
+	defaultEnableMetrics       = true
+)
+
+type CrashLoopConfig struct {
+	// Source is the source name of the crash loop monitor.
+	Source string `json:"source"`
+	// ConditionType is the type of the condition set when the node is crash looping.
+	ConditionType string `json:"conditionType"`
+	// StatePath is the file the boot records are persisted to. It must be on the host, so
+	// that it survives reboots.
+	StatePath string `json:"statePath"`
+	// BootIDPath is the file with the unique id of the current boot.
+	BootIDPath string `json:"bootIDPath"`
+	// EvidencePaths are the directories crash records are saved to, e.g. pstore and kdump
+	// directories. A boot is abnormal when new entries appear in them since the last boot.
+	EvidencePaths []string `json:"evidencePaths"`
+	// CheckIntervalString is the interval at which crash boots aging out of the window
+	// are checked.
+	CheckIntervalString string        `json:"checkInterval"`
+	CheckInterval       time.Duration `json:"-"`
+	// CrashWindowString is the window in which CrashThreshold consecutive abnormal boots
+	// set the condition.
+	CrashWindowString string        `json:"crashWindow"`
+	CrashWindow       time.Duration `json:"-"`
+	// CrashThreshold is the number of consecutive abnormal boots in the crash window
+	// setting the condition.
+	CrashThreshold *int `json:"crashThreshold,omitempty"`
+	// MaxBootRecords is the maximum number of boot records kept.
+	MaxBootRecords *int `json:"maxBootRecords,omitempty"`
+	// EnableMetricsReporting describes whether to count the abnormal boots and report the
+	// NodeCrashLooping condition as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (clc *CrashLoopConfig) ApplyConfiguration() error {
+	if clc.Source == "" {
+		clc.Source = defaultSource
+	}
+	if clc.ConditionType == "" {
+		clc.ConditionType = defaultConditionType
+	}
+	if clc.StatePath == "" {
+		clc.StatePath = defaultStatePath
+	}
+	if clc.BootIDPath == "" {
+		clc.BootIDPath = defaultBootIDPath
+	}
+	if clc.EvidencePaths == nil {
+		clc.EvidencePaths = defaultEvidencePaths
+	}
+	if clc.CheckIntervalString == "" {
+		clc.CheckIntervalString = defaultCheckIntervalString
+	}
+	if clc.CrashWindowString == "" {
+		clc.CrashWindowString = defaultCrashWindowString
+	}
+	if clc.CrashThreshold == nil {
+		clc.CrashThreshold = &defaultCrashThreshold
+	}
+	if clc.MaxBootRecords == nil {
+		clc.MaxBootRecords = &defaultMaxBootRecords
+	}
+	if clc.EnableMetricsReporting == nil {
+		clc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	clc.CheckInterval, err = time.ParseDuration(clc.CheckIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing CheckIntervalString %q: %v", clc.CheckIntervalString, err)
+	}
+	clc.CrashWindow, err = time.ParseDuration(clc.CrashWindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing CrashWindowString %q: %v", clc.CrashWindowString, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (clc *CrashLoopConfig) Validate() error {
+	if clc.CheckInterval <= time.Duration(0) {
+		return fmt.Errorf("CheckInterval %v must be above 0s", clc.CheckInterval)
+	}
+	if clc.CrashWindow <= time.Duration(0) {
+		return fmt.Errorf("CrashWindow %v must be above 0s", clc.CrashWindow)
+	}
+	if *clc.CrashThreshold < 1 {
+		return fmt.Errorf("CrashThreshold %d must be at least 1", *clc.CrashThreshold)
+	}
+	if *clc.MaxBootRecords < *clc.CrashThreshold {
+		return fmt.Errorf("MaxBootRecords %d must not be less than CrashThreshold %d", *clc.MaxBootRecords, *clc.CrashThreshold)
+	}
+	if len(clc.EvidencePaths) == 0 {
+		return fmt.Errorf("EvidencePaths must not be empty")
+	}
+	return nil
+}
@@ -17,8 +17,9 @@ limitations under the License.
 package custompluginmonitor
 
 import (
-	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -29,6 +30,7 @@ import (
 	"k8s.io/node-problem-detector/pkg/problemmetrics"
 	"k8s.io/node-problem-detector/pkg/types"
 	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/liveness"
 	"k8s.io/node-problem-detector/pkg/util/tomb"
 )
 
@@ -46,37 +48,39 @@ type customPluginMonitor struct {
 	configPath string
 	config     cpmtypes.CustomPluginConfig
 	conditions []types.Condition
+	// plugin and config are replaced on reload, pluginLock guards them against the admin
+	// API.
+	pluginLock sync.Mutex
 	plugin     *plugin.Plugin
-	resultChan <-chan cpmtypes.Result
+	reloadChan chan cpmtypes.CustomPluginConfig
+	// reported is the last reported result of each rule, used when only changed results
+	// are reported.
+	reported   map[*cpmtypes.CustomRule]reportedResult
 	statusChan chan *types.Status
 	tomb       *tomb.Tomb
 }
 
+// reportedResult is a reported plugin result, and the time it was reported.
+type reportedResult struct {
+	exitStatus cpmtypes.Status
+	reason     string
+	message    string
+	time       time.Time
+}
+
 // NewCustomPluginMonitorOrDie create a new customPluginMonitor, panic if error occurs.
 func NewCustomPluginMonitorOrDie(configPath string) types.Monitor {
 	c := &customPluginMonitor{
 		configPath: configPath,
+		reloadChan: make(chan cpmtypes.CustomPluginConfig),
+		reported:   make(map[*cpmtypes.CustomRule]reportedResult),
 		tomb:       tomb.NewTomb(),
 	}
-	f, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
-	}
-	err = json.Unmarshal(f, &c.config)
-	if err != nil {
-		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
-	}
-	// Apply configurations
-	err = (&c.config).ApplyConfiguration()
-	if err != nil {
-		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
-	}
-
-	// Validate configurations
-	err = c.config.Validate()
+	config, err := loadConfig(configPath)
 	if err != nil {
-		glog.Fatalf("Failed to validate custom plugin config %+v: %v", c.config, err)
+		glog.Fatal(err)
 	}
+	c.config = config
 
 	glog.Infof("Finish parsing custom plugin monitor config file %s: %+v", c.configPath, c.config)
 
@@ -90,55 +94,217 @@ func NewCustomPluginMonitorOrDie(configPath string) types.Monitor {
 	return c
 }
 
+// loadConfig reads, applies and validates the custom plugin monitor configuration file.
+func loadConfig(configPath string) (cpmtypes.CustomPluginConfig, error) {
+	var config cpmtypes.CustomPluginConfig
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return config, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &config)
+	if err != nil {
+		return config, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	if err := (&config).DiscoverRules(); err != nil {
+		return config, fmt.Errorf("failed to discover rules for %q: %v", configPath, err)
+	}
+	// Apply configurations
+	err = (&config).ApplyConfiguration()
+	if err != nil {
+		return config, fmt.Errorf("failed to apply configuration for %q: %v", configPath, err)
+	}
+
+	// Validate configurations
+	err = config.Validate()
+	if err != nil {
+		return config, fmt.Errorf("failed to validate custom plugin config %+v: %v", config, err)
+	}
+	return config, nil
+}
+
 // initializeProblemMetricsOrDie creates problem metrics for all problems and set the value to 0,
 // panic if error occurs.
 func initializeProblemMetricsOrDie(rules []*cpmtypes.CustomRule) {
 	for _, rule := range rules {
-		if rule.Type == types.Perm {
-			err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(rule.Condition, rule.Reason, false)
-			if err != nil {
-				glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
-					rule.Condition, rule.Reason, err)
+		reasons := []string{rule.Reason}
+		for _, mapping := range rule.ExitCodes {
+			if mapping.Reason != "" {
+				reasons = append(reasons, mapping.Reason)
 			}
 		}
-		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(rule.Reason, 0)
-		if err != nil {
-			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", rule.Reason, err)
+		for _, reason := range reasons {
+			if rule.Type == types.Perm {
+				err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(rule.Condition, reason, false)
+				if err != nil {
+					glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+						rule.Condition, reason, err)
+				}
+			}
+			err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+			if err != nil {
+				glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+			}
 		}
 	}
 }
 
 func (c *customPluginMonitor) Start() (<-chan *types.Status, error) {
 	glog.Infof("Start custom plugin monitor %s", c.configPath)
-	go c.plugin.Run()
-	go c.monitorLoop()
+	// A panic of the plugin runner restarts the problem daemon like a panic of the loop.
+	problemdaemon.Go(c, c.getPlugin().Run)
+	problemdaemon.Go(c, c.monitorLoop)
 	return c.statusChan, nil
 }
 
+func (c *customPluginMonitor) getPlugin() *plugin.Plugin {
+	c.pluginLock.Lock()
+	defer c.pluginLock.Unlock()
+	return c.plugin
+}
+
+// Pause stops running the plugins every invoke interval. The liveness of the monitor is
+// not checked while it is paused.
+func (c *customPluginMonitor) Pause() {
+	glog.Infof("Pause custom plugin monitor %s", c.configPath)
+	c.getPlugin().Pause()
+	liveness.Forget(c.livenessName())
+}
+
+// Resume restarts running the plugins every invoke interval.
+func (c *customPluginMonitor) Resume() {
+	glog.Infof("Resume custom plugin monitor %s", c.configPath)
+	c.getPlugin().Resume()
+	// The configuration is replaced with the plugin on reloads.
+	c.pluginLock.Lock()
+	timeout := c.livenessTimeout()
+	c.pluginLock.Unlock()
+	liveness.Beat(c.livenessName(), timeout)
+}
+
+// Paused returns whether the monitor is paused.
+func (c *customPluginMonitor) Paused() bool {
+	return c.getPlugin().Paused()
+}
+
+// Trigger runs all plugins which are not already running immediately.
+func (c *customPluginMonitor) Trigger() {
+	glog.Infof("Trigger custom plugin monitor %s", c.configPath)
+	c.getPlugin().Trigger()
+}
+
+// Reload re-reads the configuration file, and restarts the plugins with it. The
+// conditions which are still configured keep their current status.
+func (c *customPluginMonitor) Reload() error {
+	config, err := loadConfig(c.configPath)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Reload custom plugin monitor %s: %+v", c.configPath, config)
+	select {
+	case c.reloadChan <- config:
+		return nil
+	case <-c.tomb.Stopping():
+		return fmt.Errorf("custom plugin monitor %s is stopped", c.configPath)
+	}
+}
+
 func (c *customPluginMonitor) Stop() {
 	glog.Infof("Stop custom plugin monitor %s", c.configPath)
 	c.tomb.Stop()
+	liveness.Forget(c.livenessName())
+}
+
+// beat reports the monitor alive, unless it is paused.
+func (c *customPluginMonitor) beat() {
+	if c.Paused() {
+		return
+	}
+	liveness.Beat(c.livenessName(), c.livenessTimeout())
+}
+
+func (c *customPluginMonitor) livenessName() string {
+	return CustomPluginMonitorName + ":" + c.configPath
+}
+
+// livenessTimeout is twice the longest time a round of plugin runs may take: the
+// shortest invoke period of the rules and the jitter, plus the timeout of each batch
+// of concurrent plugins.
+func (c *customPluginMonitor) livenessTimeout() time.Duration {
+	concurrency := *c.config.PluginGlobalConfig.Concurrency
+	batches := (len(c.config.Rules) + concurrency - 1) / concurrency
+	timeout := c.shortestInvokePeriod(time.Now()) + time.Duration(batches)*(*c.config.PluginGlobalConfig.Timeout)
+	if jitter := c.config.PluginGlobalConfig.InvokeJitter; jitter != nil {
+		timeout += *jitter
+	}
+	return 2 * timeout
+}
+
+// shortestInvokePeriod returns the shortest time in which a rule is invoked after now.
+// The global invoke interval applies to the rules without their own invoke interval or
+// schedule. As the runs of a cron schedule are not evenly spaced, a scheduled rule is
+// expected to be invoked twice after now.
+func (c *customPluginMonitor) shortestInvokePeriod(now time.Time) time.Duration {
+	var shortest time.Duration
+	for _, rule := range c.config.Rules {
+		period := *c.config.PluginGlobalConfig.InvokeInterval
+		switch {
+		case rule.InvokeInterval != nil:
+			period = *rule.InvokeInterval
+		case rule.Schedule != nil:
+			next := rule.Schedule.Next(now)
+			if next.IsZero() {
+				continue
+			}
+			if second := rule.Schedule.Next(next); !second.IsZero() {
+				next = second
+			}
+			period = next.Sub(now)
+		}
+		if shortest == 0 || period < shortest {
+			shortest = period
+		}
+	}
+	if shortest == 0 {
+		return *c.config.PluginGlobalConfig.InvokeInterval
+	}
+	return shortest
 }
 
 // monitorLoop is the main loop of log monitor.
 func (c *customPluginMonitor) monitorLoop() {
 	c.initializeStatus()
+	c.beat()
 
-	resultChan := c.plugin.GetResultChan()
+	resultChan := c.getPlugin().GetResultChan()
+	// Rounds deferred because the node is overloaded report no result, but the plugin is
+	// alive.
+	deferredChan := c.getPlugin().GetDeferredChan()
 
 	for {
 		select {
+		case config := <-c.reloadChan:
+			c.reload(config)
+			resultChan = c.getPlugin().GetResultChan()
+			deferredChan = c.getPlugin().GetDeferredChan()
+			c.beat()
+		case <-deferredChan:
+			c.beat()
 		case result, ok := <-resultChan:
 			if !ok {
 				glog.Errorf("Result channel closed: %s", c.configPath)
 				return
 			}
 			glog.V(3).Infof("Receive new plugin result for %s: %+v", c.configPath, result)
+			c.beat()
+			if !c.shouldReport(result, time.Now()) {
+				glog.V(3).Infof("Skip unchanged plugin result for %s: %+v", c.configPath, result)
+				continue
+			}
 			status := c.generateStatus(result)
 			glog.Infof("New status generated: %+v", status)
 			c.statusChan <- status
 		case <-c.tomb.Stopping():
-			c.plugin.Stop()
+			c.getPlugin().Stop()
 			glog.Infof("Custom plugin monitor stopped: %s", c.configPath)
 			c.tomb.Done()
 			return
@@ -146,6 +312,70 @@ func (c *customPluginMonitor) monitorLoop() {
 	}
 }
 
+// reload replaces the plugin with one running the new configuration, and reports the
+// conditions of the new configuration.
+func (c *customPluginMonitor) reload(config cpmtypes.CustomPluginConfig) {
+	old := c.getPlugin()
+	// Drain the results of the old plugin, so that its workers can finish.
+	go func() {
+		for range old.GetResultChan() {
+		}
+	}()
+	old.Stop()
+
+	if *config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(config.Rules)
+	}
+	p := plugin.NewPlugin(config)
+	if old.Paused() {
+		p.Pause()
+	}
+	c.pluginLock.Lock()
+	c.plugin = p
+	c.config = config
+	c.pluginLock.Unlock()
+	c.reported = make(map[*cpmtypes.CustomRule]reportedResult)
+
+	conditions := initialConditions(config.DefaultConditions)
+	for i := range conditions {
+		for _, condition := range c.conditions {
+			if condition.Type == conditions[i].Type {
+				conditions[i] = condition
+				break
+			}
+		}
+	}
+	c.conditions = conditions
+	c.statusChan <- &types.Status{
+		Source:     c.config.Source,
+		Conditions: c.copyConditions(),
+	}
+	problemdaemon.Go(c, p.Run)
+	glog.Infof("Custom plugin monitor reloaded: %s", c.configPath)
+}
+
+// shouldReport returns whether the result should be reported. When only changed results
+// are reported, a result which is the same as the last reported result of its rule is
+// skipped, unless the force refresh interval passed since it was reported.
+func (c *customPluginMonitor) shouldReport(result cpmtypes.Result, now time.Time) bool {
+	onlyOnChange := c.config.PluginGlobalConfig.ReportOnlyOnChange
+	if onlyOnChange == nil || !*onlyOnChange {
+		return true
+	}
+	last, ok := c.reported[result.Rule]
+	if ok && last.exitStatus == result.ExitStatus && last.reason == result.Reason && last.message == result.Message &&
+		now.Sub(last.time) < *c.config.PluginGlobalConfig.ForceRefreshInterval {
+		return false
+	}
+	c.reported[result.Rule] = reportedResult{
+		exitStatus: result.ExitStatus,
+		reason:     result.Reason,
+		message:    result.Message,
+		time:       now,
+	}
+	return true
+}
+
 // generateStatus generates status from the plugin check result.
 func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Status {
 	timestamp := time.Now()
@@ -154,11 +384,16 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 	if result.Rule.Type == types.Temp {
 		// For temporary error only generate event when exit status is above warning
 		if result.ExitStatus >= cpmtypes.NonOK {
+			severity := result.Rule.Severity
+			if severity == "" {
+				severity = types.Warn
+			}
 			activeProblemEvents = append(activeProblemEvents, types.Event{
-				Severity:  types.Warn,
-				Timestamp: timestamp,
-				Reason:    result.Rule.Reason,
-				Message:   result.Message,
+				Severity:    severity,
+				Timestamp:   timestamp,
+				Reason:      result.Reason,
+				Message:     result.Message,
+				Annotations: result.Rule.Ownership.Annotate(result.Labels),
 			})
 		}
 	} else {
@@ -195,7 +430,7 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 					}
 				} else if condition.Status != types.True && status == types.True {
 					// Scenario 2: Condition status changes from False/Unknown to True
-					newReason = result.Rule.Reason
+					newReason = result.Reason
 					newMessage = result.Message
 				} else if condition.Status != status {
 					// Scenario 3: Condition status changes from False to Unknown or vice versa
@@ -206,12 +441,12 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 						newMessage = result.Message
 					}
 				} else if condition.Status == types.True && status == types.True &&
-					(condition.Reason != result.Rule.Reason ||
+					(condition.Reason != result.Reason ||
 						(*c.config.PluginGlobalConfig.EnableMessageChangeBasedConditionUpdate && condition.Message != result.Message)) {
 					// Scenario 4: Condition status does not change and it stays true.
 					// condition reason changes or
 					// condition message changes when message based condition update is enabled.
-					newReason = result.Rule.Reason
+					newReason = result.Reason
 					newMessage = result.Message
 				} else {
 					// Scenario 5: Condition status does not change and it stays False/Unknown.
@@ -225,6 +460,10 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 					condition.Status = status
 					condition.Reason = newReason
 					condition.Message = newMessage
+					condition.Severity = ""
+					if status == types.True {
+						condition.Severity = result.Rule.Severity
+					}
 
 					updateEvent := util.GenerateConditionChangeEvent(
 						condition.Type,
@@ -232,6 +471,7 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 						newReason,
 						timestamp,
 					)
+					updateEvent.Annotations = result.Rule.Ownership.Annotate(result.Labels)
 
 					if status == types.True {
 						activeProblemEvents = append(activeProblemEvents, updateEvent)
@@ -245,6 +485,8 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 		}
 	}
 	if *c.config.EnableMetricsReporting {
+		problemmetrics.GlobalProblemMetricsManager.SetOwnership(result.Reason, result.Rule.Ownership)
+		problemmetrics.GlobalProblemMetricsManager.SetSeverity(result.Reason, result.Rule.Severity)
 		// Increment problem counter only for active problems which just got detected.
 		for _, event := range activeProblemEvents {
 			err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(
@@ -267,10 +509,16 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 		Source: c.config.Source,
 		// TODO(random-liu): Aggregate events and conditions and then do periodically report.
 		Events:     append(activeProblemEvents, inactiveProblemEvents...),
-		Conditions: c.conditions,
+		Conditions: c.copyConditions(),
 	}
 }
 
+// copyConditions copies the conditions sent in a status, so that they are not changed
+// by later results while the status is being exported.
+func (c *customPluginMonitor) copyConditions() []types.Condition {
+	return append([]types.Condition(nil), c.conditions...)
+}
+
 func toConditionStatus(s cpmtypes.Status) types.ConditionStatus {
 	switch s {
 	case cpmtypes.OK:
@@ -290,7 +538,7 @@ func (c *customPluginMonitor) initializeStatus() {
 	// Update the initial status
 	c.statusChan <- &types.Status{
 		Source:     c.config.Source,
-		Conditions: c.conditions,
+		Conditions: c.copyConditions(),
 	}
 }
 
@@ -17,11 +17,19 @@ limitations under the License.
 package custompluginmonitor
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
 	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/liveness"
 )
 
 func TestRegistration(t *testing.T) {
@@ -29,3 +37,124 @@ func TestRegistration(t *testing.T) {
 		func() { problemdaemon.GetProblemDaemonHandlerOrDie("custom-plugin-monitor") },
 		"Custom plugin monitor failed to register itself as a problem daemon.")
 }
+
+const reloadTestConfig = `{
+  "plugin": "custom",
+  "pluginConfig": {"invoke_interval": "1h"},
+  "source": "test-custom-plugin-monitor",
+  "metricsReporting": false,
+  "conditions": [%s],
+  "rules": [%s]
+}`
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "custom-plugin-monitor")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config.json")
+	okScript, err := filepath.Abs("plugin/test-data/ok.sh")
+	assert.NoError(t, err)
+	nonOKScript, err := filepath.Abs("plugin/test-data/non-ok.sh")
+	assert.NoError(t, err)
+	writeConfig := func(conditions, rules string) {
+		config := fmt.Sprintf(reloadTestConfig, conditions, rules)
+		assert.NoError(t, ioutil.WriteFile(configPath, []byte(config), 0644))
+	}
+	fooCondition := `{"type": "FooProblem", "reason": "FooIsOK", "message": "foo is ok"}`
+	barCondition := `{"type": "BarProblem", "reason": "BarIsOK", "message": "bar is ok"}`
+	fooRule := fmt.Sprintf(`{"type": "permanent", "condition": "FooProblem", "reason": "FooIsBroken", "path": %q}`, nonOKScript)
+	barRule := fmt.Sprintf(`{"type": "permanent", "condition": "BarProblem", "reason": "BarIsBroken", "path": %q}`, okScript)
+
+	writeConfig(fooCondition, fooRule)
+	m := NewCustomPluginMonitorOrDie(configPath).(types.ControllableMonitor)
+	statusChan, err := m.Start()
+	assert.NoError(t, err)
+	defer m.Stop()
+	waitForCondition := func(conditionType string, status types.ConditionStatus) *types.Status {
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case s := <-statusChan:
+				for _, condition := range s.Conditions {
+					if condition.Type == conditionType && condition.Status == status {
+						return s
+					}
+				}
+			case <-timeout:
+				t.Fatalf("Condition %s did not become %s", conditionType, status)
+				return nil
+			}
+		}
+	}
+	waitForCondition("FooProblem", types.True)
+
+	// An invalid configuration is rejected, and the monitor keeps running.
+	writeConfig(fooCondition, `{"type": "permanent", "condition": "UnknownProblem", "reason": "Unknown", "path": "/bin/true"}`)
+	assert.Error(t, m.Reload())
+
+	m.Pause()
+	writeConfig(fooCondition+","+barCondition, fooRule+","+barRule)
+	assert.NoError(t, m.Reload())
+	assert.True(t, m.Paused(), "paused state should survive reload")
+
+	// The new condition is reported, and the existing condition keeps its status.
+	status := waitForCondition("BarProblem", types.False)
+	assert.Len(t, status.Conditions, 2)
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+	assert.Equal(t, "FooIsBroken", status.Conditions[0].Reason)
+
+	// The liveness of a paused monitor is not checked.
+	name := m.(*customPluginMonitor).livenessName()
+	assert.NotContains(t, liveness.Stalled(time.Now().Add(24*time.Hour)), name)
+	m.Resume()
+	assert.Contains(t, liveness.Stalled(time.Now().Add(24*time.Hour)), name)
+}
+
+func TestShouldReport(t *testing.T) {
+	reportOnlyOnChange := true
+	forceRefreshInterval := 10 * time.Minute
+	c := &customPluginMonitor{reported: make(map[*cpmtypes.CustomRule]reportedResult)}
+	c.config.PluginGlobalConfig.ReportOnlyOnChange = &reportOnlyOnChange
+	c.config.PluginGlobalConfig.ForceRefreshInterval = &forceRefreshInterval
+	foo := &cpmtypes.CustomRule{Reason: "Foo"}
+	bar := &cpmtypes.CustomRule{Reason: "Bar"}
+	now := time.Now()
+
+	ok := cpmtypes.Result{Rule: foo, ExitStatus: cpmtypes.OK, Reason: "Foo", Message: "ok"}
+	assert.True(t, c.shouldReport(ok, now), "first result should be reported")
+	assert.False(t, c.shouldReport(ok, now.Add(time.Minute)), "unchanged result should be skipped")
+	assert.True(t, c.shouldReport(cpmtypes.Result{Rule: bar, ExitStatus: cpmtypes.OK, Reason: "Bar", Message: "ok"}, now.Add(time.Minute)),
+		"results are cached per rule")
+
+	changed := ok
+	changed.Message = "still ok"
+	assert.True(t, c.shouldReport(changed, now.Add(2*time.Minute)), "changed message should be reported")
+	changed.ExitStatus = cpmtypes.NonOK
+	assert.True(t, c.shouldReport(changed, now.Add(3*time.Minute)), "changed status should be reported")
+	assert.False(t, c.shouldReport(changed, now.Add(12*time.Minute)))
+	assert.True(t, c.shouldReport(changed, now.Add(13*time.Minute)), "unchanged result should be refreshed")
+
+	reportOnlyOnChange = false
+	assert.True(t, c.shouldReport(changed, now.Add(14*time.Minute)), "all results should be reported when disabled")
+}
+
+func TestShortestInvokePeriod(t *testing.T) {
+	globalInterval := 30 * time.Second
+	ruleInterval := 2 * time.Hour
+	hourly, err := cpmtypes.ParseSchedule("@hourly")
+	assert.NoError(t, err)
+	never, err := cpmtypes.ParseSchedule("0 0 30 2 *")
+	assert.NoError(t, err)
+	now := time.Date(2020, 6, 1, 10, 45, 0, 0, time.UTC)
+
+	c := &customPluginMonitor{}
+	c.config.PluginGlobalConfig.InvokeInterval = &globalInterval
+	c.config.Rules = []*cpmtypes.CustomRule{{InvokeInterval: &ruleInterval}, {}}
+	assert.Equal(t, globalInterval, c.shortestInvokePeriod(now), "global interval applies to rules without their own")
+
+	c.config.Rules = []*cpmtypes.CustomRule{{InvokeInterval: &ruleInterval}, {Schedule: hourly}}
+	assert.Equal(t, 75*time.Minute, c.shortestInvokePeriod(now), "scheduled rule should be invoked twice")
+
+	c.config.Rules = []*cpmtypes.CustomRule{{Schedule: never}}
+	assert.Equal(t, globalInterval, c.shortestInvokePeriod(now), "rule which is never invoked is ignored")
+}
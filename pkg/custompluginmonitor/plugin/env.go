@@ -0,0 +1,86 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+// ruleEnv returns the environment variables passed to the plugin of the rule: the rule
+// metadata, the env of the rule and the secret env read from the files.
+func ruleEnv(rule cpmtypes.CustomRule) (map[string]string, error) {
+	env := rule.RuleEnv(util.GetNodeName())
+	for name, value := range rule.Env {
+		env[name] = value
+	}
+	for name, path := range rule.SecretEnv {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret environment variable %q: %v", name, err)
+		}
+		env[name] = strings.TrimRight(string(data), "\r\n")
+	}
+	return env, nil
+}
+
+// commandEnv returns the environment of node problem detector with the variables added.
+func commandEnv(env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := os.Environ()
+	for _, name := range names {
+		result = append(result, name+"="+env[name])
+	}
+	return result
+}
+
+var argVarRegexp = regexp.MustCompile(`\$\$|\$\(([A-Za-z_][A-Za-z0-9_]*)\)`)
+
+// expandArgs expands "$(VAR)" in the args to the value of the variable, like Kubernetes
+// does for container args. References to unknown variables are kept, and "$$" escapes
+// "$". The secret variables are not expanded, since any process on the node can read
+// the args of the plugin.
+func expandArgs(args []string, env map[string]string, secretEnv map[string]string) []string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = argVarRegexp.ReplaceAllStringFunc(arg, func(ref string) string {
+			if ref == "$$" {
+				return "$"
+			}
+			name := ref[2 : len(ref)-1]
+			if _, ok := secretEnv[name]; ok {
+				return ref
+			}
+			if value, ok := env[name]; ok {
+				return value
+			}
+			return ref
+		})
+	}
+	return expanded
+}
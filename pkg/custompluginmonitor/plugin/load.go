@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/procfs"
+	"github.com/shirou/gopsutil/load"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+// pressureResources are the resources whose pressure stall information is checked.
+var pressureResources = []string{"cpu", "memory", "io"}
+
+var (
+	checksDeferred     metrics.Int64MetricInterface
+	checksDeferredOnce sync.Once
+)
+
+// checksDeferredMetricOrDie returns the metric counting the rules deferred because the
+// node is overloaded, panic if error occurs.
+func checksDeferredMetricOrDie() metrics.Int64MetricInterface {
+	checksDeferredOnce.Do(func() {
+		metric, err := metrics.NewInt64Metric(
+			metrics.CustomPluginChecksDeferredID,
+			string(metrics.CustomPluginChecksDeferredID),
+			"Number of custom plugin checks deferred because the node is overloaded.",
+			"1",
+			metrics.Sum,
+			[]string{"source", "reason"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.CustomPluginChecksDeferredID, err)
+		}
+		checksDeferred = metric
+	})
+	return checksDeferred
+}
+
+// nodeLoad is a snapshot of the load of the node.
+type nodeLoad struct {
+	// loadPerCPU is the 1-minute load average per CPU.
+	loadPerCPU float64
+	// pressure is the pressure stall information "some" avg10 percentage of each resource.
+	// Resources whose pressure is not available are missing.
+	pressure map[string]float64
+}
+
+// getNodeLoad reads the load of the node.
+func getNodeLoad() (nodeLoad, error) {
+	loadAvg, err := load.Avg()
+	if err != nil {
+		return nodeLoad{}, fmt.Errorf("failed to retrieve load average: %v", err)
+	}
+	l := nodeLoad{
+		loadPerCPU: loadAvg.Load1 / float64(runtime.NumCPU()),
+		pressure:   make(map[string]float64),
+	}
+
+	fs, err := procfs.NewDefaultFS()
+	if err != nil {
+		return l, nil
+	}
+	for _, resource := range pressureResources {
+		// Pressure stall information is only available since Linux 4.20.
+		psi, err := fs.PSIStatsForResource(resource)
+		if err != nil || psi.Some == nil {
+			continue
+		}
+		l.pressure[resource] = psi.Some.Avg10
+	}
+	return l, nil
+}
+
+// overloaded returns why the node is overloaded according to the plugin config, or empty
+// string if it is not.
+func overloaded(config cpmtypes.CustomPluginConfig, l nodeLoad) string {
+	if maxLoad := config.PluginGlobalConfig.MaxLoadPerCPU; maxLoad != nil && l.loadPerCPU > *maxLoad {
+		return fmt.Sprintf("load per CPU %.2f is above %.2f", l.loadPerCPU, *maxLoad)
+	}
+	if maxPressure := config.PluginGlobalConfig.MaxPressure; maxPressure != nil {
+		for _, resource := range pressureResources {
+			if pressure, ok := l.pressure[resource]; ok && pressure > *maxPressure {
+				return fmt.Sprintf("%s pressure %.2f%% is above %.2f%%", resource, pressure, *maxPressure)
+			}
+		}
+	}
+	return ""
+}
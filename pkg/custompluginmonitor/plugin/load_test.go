@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+func TestOverloaded(t *testing.T) {
+	maxLoad := 2.0
+	maxPressure := 40.0
+
+	testCases := []struct {
+		name        string
+		maxLoad     *float64
+		maxPressure *float64
+		load        nodeLoad
+		overloaded  bool
+	}{
+		{
+			name: "no limit",
+			load: nodeLoad{loadPerCPU: 100, pressure: map[string]float64{"cpu": 100}},
+		},
+		{
+			name:    "load below limit",
+			maxLoad: &maxLoad,
+			load:    nodeLoad{loadPerCPU: 1.5},
+		},
+		{
+			name:       "load above limit",
+			maxLoad:    &maxLoad,
+			load:       nodeLoad{loadPerCPU: 2.5},
+			overloaded: true,
+		},
+		{
+			name:        "pressure below limit",
+			maxPressure: &maxPressure,
+			load:        nodeLoad{pressure: map[string]float64{"cpu": 10, "memory": 30, "io": 39.9}},
+		},
+		{
+			name:        "io pressure above limit",
+			maxPressure: &maxPressure,
+			load:        nodeLoad{pressure: map[string]float64{"cpu": 10, "io": 50}},
+			overloaded:  true,
+		},
+		{
+			name:        "pressure not available",
+			maxPressure: &maxPressure,
+			load:        nodeLoad{pressure: map[string]float64{}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			config := cpmtypes.CustomPluginConfig{}
+			config.PluginGlobalConfig.MaxLoadPerCPU = test.maxLoad
+			config.PluginGlobalConfig.MaxPressure = test.maxPressure
+			reason := overloaded(config, test.load)
+			if test.overloaded != (reason != "") {
+				t.Errorf("Expected overloaded %v, got reason %q", test.overloaded, reason)
+			}
+		})
+	}
+}
+
+func TestScheduleRulesUnderLoad(t *testing.T) {
+	maxLoad := 2.0
+	critical := &cpmtypes.CustomRule{Reason: "Critical", Path: "./test-data/ok.sh", Critical: true}
+	other := &cpmtypes.CustomRule{Reason: "Other", Path: "./test-data/ok.sh"}
+	conf := cpmtypes.CustomPluginConfig{
+		Source: "test-plugin-monitor",
+		Rules:  []*cpmtypes.CustomRule{critical, other},
+	}
+	conf.PluginGlobalConfig.MaxLoadPerCPU = &maxLoad
+	(&conf).ApplyConfiguration()
+
+	p := NewPlugin(conf)
+	deferred := metrics.NewFakeInt64Metric("checks_deferred", metrics.Sum, []string{"source", "reason"})
+	p.checksDeferred = deferred
+	load := nodeLoad{loadPerCPU: 3}
+	var loadErr error
+	p.getNodeLoad = func() (nodeLoad, error) { return load, loadErr }
+
+	scheduled := func() []*cpmtypes.CustomRule {
+		var rules []*cpmtypes.CustomRule
+		for len(p.jobs) > 0 {
+			rule := <-p.jobs
+			p.unmarkInFlight(rule)
+			rules = append(rules, rule)
+		}
+		return rules
+	}
+	check := func(name string, got []*cpmtypes.CustomRule, want ...*cpmtypes.CustomRule) {
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %d scheduled rules, got %+v", name, len(want), got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: expected rule %+v, got %+v", name, want[i], got[i])
+			}
+		}
+	}
+
+	p.scheduleRules(p.config.Rules, true)
+	check("overloaded", scheduled(), critical)
+	select {
+	case <-p.GetDeferredChan():
+	default:
+		t.Errorf("Expected the deferral to be notified")
+	}
+	metricsGot := deferred.ListMetrics()
+	if len(metricsGot) != 1 || metricsGot[0].Value != 1 || metricsGot[0].Labels["reason"] != "Other" {
+		t.Errorf("Unexpected checks deferred metrics: %+v", metricsGot)
+	}
+
+	// A trigger ignores the load.
+	p.scheduleRules(p.config.Rules, false)
+	check("triggered", scheduled(), critical, other)
+
+	load = nodeLoad{loadPerCPU: 1}
+	p.scheduleRules(p.config.Rules, true)
+	check("not overloaded", scheduled(), critical, other)
+	select {
+	case <-p.GetDeferredChan():
+		t.Errorf("Unexpected deferral notified when no rule is deferred")
+	default:
+	}
+
+	// All rules run when the load can not be read.
+	load = nodeLoad{loadPerCPU: 3}
+	loadErr = errors.New("no load average")
+	p.scheduleRules(p.config.Rules, true)
+	check("load unknown", scheduled(), critical, other)
+}
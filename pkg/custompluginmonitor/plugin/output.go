@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+// OutputVersion is the version of the JSON output schema supported.
+const OutputVersion = "v1"
+
+// Output is the JSON output of a plugin, see cpmtypes.JSONOutput. Either Status or
+// Checks is set.
+type Output struct {
+	// Version is the version of the schema, must be OutputVersion.
+	Version string `json:"version"`
+	// Status is the status of the result: "ok", "nonok" or "unknown". Default to the worst
+	// status of the checks: nonok, unknown, then ok.
+	Status string `json:"status,omitempty"`
+	// Reason overrides the reason of the rule when it is not empty.
+	Reason string `json:"reason,omitempty"`
+	// Message is the problem message. Default to the messages of the checks which are
+	// not ok.
+	Message string `json:"message,omitempty"`
+	// Metrics are numeric values measured by the plugin, keyed by name.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// Labels are attached to the events of the result as annotations. They do not
+	// override the ownership of the rule.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Checks are the sub-checks the plugin ran in one invocation.
+	Checks []OutputCheck `json:"checks,omitempty"`
+}
+
+// OutputCheck is a sub-check in the JSON output of a plugin.
+type OutputCheck struct {
+	// Name is the name of the check, unique in the output.
+	Name string `json:"name"`
+	// Status is the status of the check: "ok", "nonok" or "unknown".
+	Status string `json:"status"`
+	// Message is the message of the check.
+	Message string `json:"message,omitempty"`
+}
+
+// parseOutput parses and validates the JSON output of a plugin.
+func parseOutput(data []byte) (*Output, error) {
+	var output Output
+	if err := util.UnmarshalStrict(data, &output); err != nil {
+		return nil, err
+	}
+	if output.Version != OutputVersion {
+		return nil, fmt.Errorf("unsupported version %q, expected %q", output.Version, OutputVersion)
+	}
+	if output.Status == "" && len(output.Checks) == 0 {
+		return nil, fmt.Errorf("neither status nor checks is set")
+	}
+	if output.Status != "" {
+		if _, err := cpmtypes.ParseStatus(output.Status); err != nil {
+			return nil, err
+		}
+	}
+	if err := (types.Ownership{Labels: output.Labels}).Validate(); err != nil {
+		return nil, err
+	}
+	for name := range output.Metrics {
+		if name == "" {
+			return nil, fmt.Errorf("metric name must not be empty")
+		}
+	}
+	names := map[string]bool{}
+	for _, check := range output.Checks {
+		if check.Name == "" {
+			return nil, fmt.Errorf("check name must not be empty")
+		}
+		if names[check.Name] {
+			return nil, fmt.Errorf("check %q is reported more than once", check.Name)
+		}
+		names[check.Name] = true
+		if _, err := cpmtypes.ParseStatus(check.Status); err != nil {
+			return nil, fmt.Errorf("invalid status of check %q: %v", check.Name, err)
+		}
+	}
+	return &output, nil
+}
+
+// result returns the status and message of the output, which is validated.
+func (o *Output) result() (cpmtypes.Status, string) {
+	status := cpmtypes.OK
+	var problems []string
+	for _, check := range o.Checks {
+		s, _ := cpmtypes.ParseStatus(check.Status)
+		if s != cpmtypes.OK {
+			problems = append(problems, fmt.Sprintf("%s: %s", check.Name, check.Message))
+		}
+		status = worse(status, s)
+	}
+	if o.Status != "" {
+		status, _ = cpmtypes.ParseStatus(o.Status)
+	}
+	message := o.Message
+	if message == "" {
+		message = strings.Join(problems, "; ")
+	}
+	return status, message
+}
+
+// worse returns the worse of the statuses: nonok, unknown, then ok.
+func worse(a, b cpmtypes.Status) cpmtypes.Status {
+	if a == cpmtypes.NonOK || b == cpmtypes.NonOK {
+		return cpmtypes.NonOK
+	}
+	if a == cpmtypes.Unknown || b == cpmtypes.Unknown {
+		return cpmtypes.Unknown
+	}
+	return cpmtypes.OK
+}
+
+var (
+	outputValue     *metrics.Float64Metric
+	outputValueOnce sync.Once
+)
+
+// outputValueMetricOrDie returns the gauge of the metrics reported by the plugins with
+// JSON output, panic if error occurs.
+func outputValueMetricOrDie() *metrics.Float64Metric {
+	outputValueOnce.Do(func() {
+		metric, err := metrics.NewFloat64Metric(
+			metrics.CustomPluginOutputValueID,
+			string(metrics.CustomPluginOutputValueID),
+			"Numeric values reported by the custom plugins with JSON output.",
+			"1",
+			metrics.LastValue,
+			[]string{"source", "reason", "name"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.CustomPluginOutputValueID, err)
+		}
+		outputValue = metric
+	})
+	return outputValue
+}
+
+func (p *Plugin) recordOutputValues(rule cpmtypes.CustomRule, values map[string]float64) {
+	if p.outputValue == nil {
+		return
+	}
+	for name, value := range values {
+		err := p.outputValue.Record(map[string]string{"source": p.config.Source, "reason": rule.Reason, "name": name}, value)
+		if err != nil {
+			glog.Errorf("Failed to update output value metric %q for rule %+v: %v", name, rule, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+)
+
+func TestParseOutput(t *testing.T) {
+	testCases := map[string]struct {
+		output  string
+		isError bool
+		status  cpmtypes.Status
+		message string
+	}{
+		"status": {
+			output:  `{"version": "v1", "status": "nonok", "message": "disk is slow"}`,
+			status:  cpmtypes.NonOK,
+			message: "disk is slow",
+		},
+		"worst status of checks": {
+			output: `{"version": "v1", "checks": [
+				{"name": "a", "status": "ok"},
+				{"name": "b", "status": "unknown", "message": "not applicable"},
+				{"name": "c", "status": "nonok", "message": "failed"}]}`,
+			status:  cpmtypes.NonOK,
+			message: "b: not applicable; c: failed",
+		},
+		"unknown check": {
+			output:  `{"version": "v1", "checks": [{"name": "a", "status": "ok"}, {"name": "b", "status": "unknown"}]}`,
+			status:  cpmtypes.Unknown,
+			message: "b: ",
+		},
+		"status overrides checks": {
+			output:  `{"version": "v1", "status": "ok", "message": "tolerated", "checks": [{"name": "a", "status": "nonok"}]}`,
+			status:  cpmtypes.OK,
+			message: "tolerated",
+		},
+		"not json": {
+			output:  "OK",
+			isError: true,
+		},
+		"unknown field": {
+			output:  `{"version": "v1", "status": "ok", "severity": "critical"}`,
+			isError: true,
+		},
+		"missing version": {
+			output:  `{"status": "ok"}`,
+			isError: true,
+		},
+		"neither status nor checks": {
+			output:  `{"version": "v1", "message": "OK"}`,
+			isError: true,
+		},
+		"invalid status": {
+			output:  `{"version": "v1", "status": "warning"}`,
+			isError: true,
+		},
+		"invalid check status": {
+			output:  `{"version": "v1", "checks": [{"name": "a", "status": "warning"}]}`,
+			isError: true,
+		},
+		"duplicate check": {
+			output:  `{"version": "v1", "checks": [{"name": "a", "status": "ok"}, {"name": "a", "status": "ok"}]}`,
+			isError: true,
+		},
+		"check without name": {
+			output:  `{"version": "v1", "checks": [{"status": "ok"}]}`,
+			isError: true,
+		},
+		"invalid label": {
+			output:  `{"version": "v1", "status": "ok", "labels": {"team": "storage"}}`,
+			isError: true,
+		},
+		"empty metric name": {
+			output:  `{"version": "v1", "status": "ok", "metrics": {"": 1}}`,
+			isError: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			output, err := parseOutput([]byte(tc.output))
+			if tc.isError {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			status, message := output.result()
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.message, message)
+		})
+	}
+}
+
+func TestRunJSONOutput(t *testing.T) {
+	conf := cpmtypes.CustomPluginConfig{}
+	(&conf).ApplyConfiguration()
+	p := Plugin{config: conf}
+	status, reason, message, labels := p.run(cpmtypes.CustomRule{
+		Reason:       "DiskProblem",
+		Path:         "./test-data/json-output.sh",
+		OutputFormat: cpmtypes.JSONOutput,
+	})
+	assert.Equal(t, cpmtypes.NonOK, status)
+	assert.Equal(t, "DiskSlow", reason)
+	assert.Equal(t, "latency: latency is 250ms", message)
+	assert.Equal(t, map[string]string{"device": "sda"}, labels)
+}
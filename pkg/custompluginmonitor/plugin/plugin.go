@@ -19,6 +19,7 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"os/exec"
 	"strings"
 	"sync"
@@ -27,95 +28,298 @@ import (
 
 	"github.com/golang/glog"
 	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
 	"k8s.io/node-problem-detector/pkg/util/tomb"
 )
 
 type Plugin struct {
 	config     cpmtypes.CustomPluginConfig
-	syncChan   chan struct{}
+	jobs       chan *cpmtypes.CustomRule
+	trigger    chan struct{}
 	resultChan chan cpmtypes.Result
 	tomb       *tomb.Tomb
 	sync.WaitGroup
+
+	// inFlight records the rules which are scheduled or running, so that a
+	// slow rule is not scheduled again before its previous invocation finishes.
+	inFlightLock sync.Mutex
+	inFlight     map[*cpmtypes.CustomRule]bool
+
+	pausedLock sync.Mutex
+	paused     bool
+
+	// getNodeLoad and checksDeferred are only set when the plugin config limits the node
+	// load under which non-critical rules run.
+	getNodeLoad    func() (nodeLoad, error)
+	checksDeferred metrics.Int64MetricInterface
+	// deferredChan is notified when rules are deferred because the node is overloaded,
+	// as the plugin is still alive although they report no result.
+	deferredChan chan struct{}
+
+	// problems records the last problem of each rule with recovery verification, whose
+	// recovery is not verified yet.
+	problemsLock sync.Mutex
+	problems     map[*cpmtypes.CustomRule]problem
+	verify       func(*cpmtypes.Verification) error
+
+	// executionDuration and outputValue are nil when metrics reporting is disabled.
+	executionDuration *metrics.Float64Metric
+	outputValue       *metrics.Float64Metric
 }
 
 func NewPlugin(config cpmtypes.CustomPluginConfig) *Plugin {
-	return &Plugin{
-		config:   config,
-		syncChan: make(chan struct{}, *config.PluginGlobalConfig.Concurrency),
+	p := &Plugin{
+		config: config,
+		// Each rule is in flight at most once, so the job channel never blocks.
+		jobs: make(chan *cpmtypes.CustomRule, len(config.Rules)),
+		// Triggers coming while one is pending are merged.
+		trigger: make(chan struct{}, 1),
 		// A 1000 size channel should be big enough.
 		resultChan: make(chan cpmtypes.Result, 1000),
 		tomb:       tomb.NewTomb(),
+		inFlight:   make(map[*cpmtypes.CustomRule]bool),
+		problems:   make(map[*cpmtypes.CustomRule]problem),
+		verify:     verify,
+		// Deferrals coming while one is pending are merged.
+		deferredChan: make(chan struct{}, 1),
+	}
+	if config.PluginGlobalConfig.MaxLoadPerCPU != nil || config.PluginGlobalConfig.MaxPressure != nil {
+		p.getNodeLoad = getNodeLoad
+		p.checksDeferred = checksDeferredMetricOrDie()
 	}
+	if config.EnableMetricsReporting != nil && *config.EnableMetricsReporting {
+		p.executionDuration = executionDurationMetricOrDie()
+		p.outputValue = outputValueMetricOrDie()
+	}
+	return p
+}
+
+// executionDurationBounds are the bucket bounds of the plugin execution durations in
+// seconds.
+var executionDurationBounds = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	executionDuration     *metrics.Float64Metric
+	executionDurationOnce sync.Once
+)
+
+// executionDurationMetricOrDie returns the histogram of the plugin execution durations,
+// panic if error occurs.
+func executionDurationMetricOrDie() *metrics.Float64Metric {
+	executionDurationOnce.Do(func() {
+		metric, err := metrics.NewFloat64DistributionMetric(
+			metrics.CustomPluginExecutionDurationID,
+			string(metrics.CustomPluginExecutionDurationID),
+			"Duration of the custom plugin executions, including the recovery verification.",
+			"s",
+			executionDurationBounds,
+			[]string{"source", "reason"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.CustomPluginExecutionDurationID, err)
+		}
+		executionDuration = metric
+	})
+	return executionDuration
 }
 
 func (p *Plugin) GetResultChan() <-chan cpmtypes.Result {
 	return p.resultChan
 }
 
+// GetDeferredChan returns the channel notified when rules are deferred because the node
+// is overloaded.
+func (p *Plugin) GetDeferredChan() <-chan struct{} {
+	return p.deferredChan
+}
+
 func (p *Plugin) Run() {
 	defer func() {
 		glog.Info("Stopping plugin execution")
+		// Wait for the workers, so that nothing is sent to the closed result channel.
+		p.Wait()
 		close(p.resultChan)
 		p.tomb.Done()
 	}()
 
+	for i := 0; i < *p.config.PluginGlobalConfig.Concurrency; i++ {
+		p.Add(1)
+		go p.worker()
+	}
+
 	runTicker := time.NewTicker(*p.config.PluginGlobalConfig.InvokeInterval)
 	defer runTicker.Stop()
+	global := globalRules(p.config.Rules)
+	scheduler := newRuleScheduler(p.config.Rules, time.Now())
+	scheduled := scheduler.wait(time.Now())
 
 	// on boot run once
 	select {
 	case <-p.tomb.Stopping():
 		return
 	default:
-		p.runRules()
+		if !p.Paused() {
+			p.scheduleRules(global, true)
+		}
 	}
 
-	// run every InvokeInterval
+	// run every InvokeInterval, and the rules with their own schedule when they are due
 	for {
 		select {
 		case <-runTicker.C:
-			p.runRules()
+			if p.Paused() {
+				glog.V(3).Info("Skip scheduling custom plugins, plugin execution is paused")
+				continue
+			}
+			p.scheduleRules(global, true)
+		case now := <-scheduled:
+			due := scheduler.due(now)
+			scheduled = scheduler.wait(now)
+			if p.Paused() {
+				glog.V(3).Info("Skip scheduling custom plugins, plugin execution is paused")
+				continue
+			}
+			p.scheduleRules(due, true)
+		case <-p.trigger:
+			p.scheduleRules(p.config.Rules, false)
 		case <-p.tomb.Stopping():
 			return
 		}
 	}
 }
 
-// run each rule in parallel and wait for them to complete
-func (p *Plugin) runRules() {
-	glog.Info("Start to run custom plugins")
+// scheduleRules hands every rule which is not in flight to the worker pool. Rules
+// are delayed by a random jitter when invoke jitter is configured. When checkLoad is
+// true and the node is overloaded, non-critical rules are deferred to the next round.
+func (p *Plugin) scheduleRules(rules []*cpmtypes.CustomRule, checkLoad bool) {
+	if len(rules) == 0 {
+		return
+	}
+	glog.Info("Start to schedule custom plugins")
 
-	for _, rule := range p.config.Rules {
-		p.syncChan <- struct{}{}
-		p.Add(1)
-		go func(rule *cpmtypes.CustomRule) {
-			defer p.Done()
-			defer func() {
-				<-p.syncChan
-			}()
+	overload := ""
+	if checkLoad {
+		overload = p.overloaded()
+	}
+	for _, rule := range rules {
+		if overload != "" && !rule.Critical {
+			glog.Warningf("Defer rule %+v, node is overloaded: %s", rule, overload)
+			p.recordDeferred(rule)
+			select {
+			case p.deferredChan <- struct{}{}:
+			default:
+			}
+			continue
+		}
+		if !p.markInFlight(rule) {
+			glog.Warningf("Skip rule %+v, its previous invocation has not finished", rule)
+			continue
+		}
+		delay := p.jitter()
+		if delay == 0 {
+			p.jobs <- rule
+			continue
+		}
+		rule := rule
+		time.AfterFunc(delay, func() {
+			p.jobs <- rule
+		})
+	}
+}
 
-			start := time.Now()
-			exitStatus, message := p.run(*rule)
+// overloaded returns why the node is overloaded, or empty string if it is not or the
+// load is not limited.
+func (p *Plugin) overloaded() string {
+	if p.getNodeLoad == nil {
+		return ""
+	}
+	l, err := p.getNodeLoad()
+	if err != nil {
+		glog.Errorf("Failed to get node load, run all rules: %v", err)
+		return ""
+	}
+	return overloaded(p.config, l)
+}
 
-			glog.V(3).Infof("Rule: %+v. Start time: %v. End time: %v. Duration: %v", rule, start, time.Now(), time.Since(start))
+func (p *Plugin) recordDeferred(rule *cpmtypes.CustomRule) {
+	err := p.checksDeferred.Record(map[string]string{"source": p.config.Source, "reason": rule.Reason}, 1)
+	if err != nil {
+		glog.Errorf("Failed to update checks deferred metric for rule %+v: %v", rule, err)
+	}
+}
 
-			result := cpmtypes.Result{
-				Rule:       rule,
-				ExitStatus: exitStatus,
-				Message:    message,
-			}
+func (p *Plugin) recordExecutionDuration(rule *cpmtypes.CustomRule, duration time.Duration) {
+	if p.executionDuration == nil {
+		return
+	}
+	err := p.executionDuration.Record(map[string]string{"source": p.config.Source, "reason": rule.Reason}, duration.Seconds())
+	if err != nil {
+		glog.Errorf("Failed to update execution duration metric for rule %+v: %v", rule, err)
+	}
+}
 
-			p.resultChan <- result
+func (p *Plugin) jitter() time.Duration {
+	maxJitter := p.config.PluginGlobalConfig.InvokeJitter
+	if maxJitter == nil || *maxJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(*maxJitter)))
+}
+
+func (p *Plugin) markInFlight(rule *cpmtypes.CustomRule) bool {
+	p.inFlightLock.Lock()
+	defer p.inFlightLock.Unlock()
+	if p.inFlight[rule] {
+		return false
+	}
+	p.inFlight[rule] = true
+	return true
+}
+
+func (p *Plugin) unmarkInFlight(rule *cpmtypes.CustomRule) {
+	p.inFlightLock.Lock()
+	defer p.inFlightLock.Unlock()
+	delete(p.inFlight, rule)
+}
+
+// worker runs rules from the job channel one at a time until the plugin is stopped.
+func (p *Plugin) worker() {
+	defer p.Done()
+	for {
+		select {
+		case rule := <-p.jobs:
+			p.runRule(rule)
+		case <-p.tomb.Stopping():
+			return
+		}
+	}
+}
+
+func (p *Plugin) runRule(rule *cpmtypes.CustomRule) {
+	defer p.unmarkInFlight(rule)
+
+	start := time.Now()
+	exitStatus, reason, message, labels := p.run(*rule)
+	exitStatus, reason, message = p.verifyRecovery(rule, exitStatus, reason, message)
+
+	glog.V(3).Infof("Rule: %+v. Start time: %v. End time: %v. Duration: %v", rule, start, time.Now(), time.Since(start))
+	p.recordExecutionDuration(rule, time.Since(start))
 
-			glog.Infof("Add check result %+v for rule %+v", result, rule)
-		}(rule)
+	result := cpmtypes.Result{
+		Rule:       rule,
+		ExitStatus: exitStatus,
+		Reason:     reason,
+		Message:    message,
+		Labels:     labels,
 	}
 
-	p.Wait()
-	glog.Info("Finish running custom plugins")
+	p.resultChan <- result
+
+	glog.Infof("Add check result %+v for rule %+v", result, rule)
 }
 
-func (p *Plugin) run(rule cpmtypes.CustomRule) (exitStatus cpmtypes.Status, output string) {
+// run runs the plugin of the rule, and returns the status, reason, message and labels of the
+// result.
+func (p *Plugin) run(rule cpmtypes.CustomRule) (exitStatus cpmtypes.Status, reason string, output string, labels map[string]string) {
 	var ctx context.Context
 	var cancel context.CancelFunc
 
@@ -126,12 +330,18 @@ func (p *Plugin) run(rule cpmtypes.CustomRule) (exitStatus cpmtypes.Status, outp
 	}
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, rule.Path, rule.Args...)
+	env, err := ruleEnv(rule)
+	if err != nil {
+		glog.Errorf("Error in preparing plugin %q: %v", rule.Path, err)
+		return cpmtypes.Unknown, rule.Reason, "Error in running plugin. Please check the error log", nil
+	}
+	cmd := exec.CommandContext(ctx, rule.Path, expandArgs(rule.Args, env, rule.SecretEnv)...)
+	cmd.Env = commandEnv(env)
 	stdout, err := cmd.Output()
 	if err != nil {
 		if _, ok := err.(*exec.ExitError); !ok {
 			glog.Errorf("Error in running plugin %q: error - %v. output - %q", rule.Path, err, string(stdout))
-			return cpmtypes.Unknown, "Error in running plugin. Please check the error log"
+			return cpmtypes.Unknown, rule.Reason, "Error in running plugin. Please check the error log", nil
 		}
 	}
 
@@ -141,21 +351,86 @@ func (p *Plugin) run(rule cpmtypes.CustomRule) (exitStatus cpmtypes.Status, outp
 
 	if cmd.ProcessState.Sys().(syscall.WaitStatus).Signaled() {
 		output = fmt.Sprintf("Timeout when running plugin %q: state - %s. output - %q", rule.Path, cmd.ProcessState.String(), output)
+	} else if rule.OutputFormat == cpmtypes.JSONOutput {
+		return p.parseJSON(rule, output)
 	}
-
-	// cut at position max_output_length if stdout is longer than max_output_length bytes
-	if len(output) > *p.config.PluginGlobalConfig.MaxOutputLength {
-		output = output[:*p.config.PluginGlobalConfig.MaxOutputLength]
-	}
+	output = p.truncate(output)
 
 	exitCode := cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+	if mapping := rule.ExitCodeMapping(exitCode); mapping != nil {
+		reason = rule.Reason
+		if mapping.Reason != "" {
+			reason = mapping.Reason
+		}
+		if mapping.Message != "" {
+			output = mapping.Message
+		}
+		return mapping.Status, reason, output, nil
+	}
 	switch exitCode {
 	case 0:
-		return cpmtypes.OK, output
+		return cpmtypes.OK, rule.Reason, output, nil
 	case 1:
-		return cpmtypes.NonOK, output
+		return cpmtypes.NonOK, rule.Reason, output, nil
+	default:
+		return cpmtypes.Unknown, rule.Reason, output, nil
+	}
+}
+
+// parseJSON returns the result of the JSON output of the plugin, recording its metrics.
+// Invalid output is unknown.
+func (p *Plugin) parseJSON(rule cpmtypes.CustomRule, stdout string) (cpmtypes.Status, string, string, map[string]string) {
+	output, err := parseOutput([]byte(stdout))
+	if err != nil {
+		glog.Errorf("Invalid output of plugin %q: error - %v. output - %q", rule.Path, err, stdout)
+		return cpmtypes.Unknown, rule.Reason, p.truncate(fmt.Sprintf("Invalid output of plugin: %v", err)), nil
+	}
+	p.recordOutputValues(rule, output.Metrics)
+	reason := rule.Reason
+	if output.Reason != "" {
+		reason = output.Reason
+	}
+	status, message := output.result()
+	return status, reason, p.truncate(message), output.Labels
+}
+
+// truncate cuts the message at position max_output_length if it is longer than
+// max_output_length bytes.
+func (p *Plugin) truncate(message string) string {
+	if len(message) > *p.config.PluginGlobalConfig.MaxOutputLength {
+		return message[:*p.config.PluginGlobalConfig.MaxOutputLength]
+	}
+	return message
+}
+
+// Pause stops scheduling rules every invoke interval until Resume is called.
+// Rules already scheduled still run.
+func (p *Plugin) Pause() {
+	p.pausedLock.Lock()
+	defer p.pausedLock.Unlock()
+	p.paused = true
+}
+
+// Resume restarts scheduling rules every invoke interval.
+func (p *Plugin) Resume() {
+	p.pausedLock.Lock()
+	defer p.pausedLock.Unlock()
+	p.paused = false
+}
+
+// Paused returns whether the plugin is paused.
+func (p *Plugin) Paused() bool {
+	p.pausedLock.Lock()
+	defer p.pausedLock.Unlock()
+	return p.paused
+}
+
+// Trigger schedules all rules which are not in flight immediately, even when paused or
+// when the node is overloaded.
+func (p *Plugin) Trigger() {
+	select {
+	case p.trigger <- struct{}{}:
 	default:
-		return cpmtypes.Unknown, output
 	}
 }
 
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util"
 )
 
 func TestNewPluginRun(t *testing.T) {
@@ -29,6 +30,7 @@ func TestNewPluginRun(t *testing.T) {
 	utMetas := map[string]struct {
 		Rule       cpmtypes.CustomRule
 		ExitStatus cpmtypes.Status
+		Reason     string
 		Output     string
 	}{
 		"ok": {
@@ -79,6 +81,93 @@ func TestNewPluginRun(t *testing.T) {
 			ExitStatus: cpmtypes.Unknown,
 			Output:     "NON-DEFINED-EXIT-STATUS",
 		},
+		"mapped exit status": {
+			Rule: cpmtypes.CustomRule{
+				Reason:  "NonDefined",
+				Path:    "./test-data/non-defined-exit-status.sh",
+				Timeout: &ruleTimeout,
+				ExitCodes: []*cpmtypes.ExitCodeMapping{
+					{ExitCode: 100, Status: cpmtypes.NonOK, Reason: "Critical"},
+				},
+			},
+			ExitStatus: cpmtypes.NonOK,
+			Reason:     "Critical",
+			Output:     "NON-DEFINED-EXIT-STATUS",
+		},
+		"mapped exit status with message": {
+			Rule: cpmtypes.CustomRule{
+				Reason:  "NonOK",
+				Path:    "./test-data/non-ok.sh",
+				Timeout: &ruleTimeout,
+				ExitCodes: []*cpmtypes.ExitCodeMapping{
+					{ExitCode: 1, Status: cpmtypes.Unknown, Message: "check is not applicable"},
+				},
+			},
+			ExitStatus: cpmtypes.Unknown,
+			Reason:     "NonOK",
+			Output:     "check is not applicable",
+		},
+		"unmapped exit status falls back to default": {
+			Rule: cpmtypes.CustomRule{
+				Reason:  "NonOK",
+				Path:    "./test-data/non-ok.sh",
+				Timeout: &ruleTimeout,
+				ExitCodes: []*cpmtypes.ExitCodeMapping{
+					{ExitCode: 2, Status: cpmtypes.NonOK, Reason: "Critical"},
+				},
+			},
+			ExitStatus: cpmtypes.NonOK,
+			Reason:     "NonOK",
+			Output:     "NonOK",
+		},
+		"rule metadata and env": {
+			Rule: cpmtypes.CustomRule{
+				Name:      "check-endpoint",
+				Condition: "EndpointProblem",
+				Reason:    "EndpointDown",
+				Path:      "./test-data/env.sh",
+				Args:      []string{"--url=$(ENDPOINT)/$(NPD_RULE_NAME)", "$(UNKNOWN)", "$$(ENDPOINT)", "$(TOKEN)"},
+				Env:       map[string]string{"ENDPOINT": "https://example.com"},
+				SecretEnv: map[string]string{"TOKEN": "./test-data/token"},
+				Timeout:   &ruleTimeout,
+			},
+			ExitStatus: cpmtypes.OK,
+			Reason:     "EndpointDown",
+			Output:     "check-endpoint EndpointProblem test-node https://example.com secret-token --url=https://example.com/check-endpoint $(UNKNOWN) $(ENDPOINT) $(TOKEN)",
+		},
+		"missing secret file": {
+			Rule: cpmtypes.CustomRule{
+				Reason:    "EndpointDown",
+				Path:      "./test-data/env.sh",
+				SecretEnv: map[string]string{"TOKEN": "./test-data/non-exist-token"},
+				Timeout:   &ruleTimeout,
+			},
+			ExitStatus: cpmtypes.Unknown,
+			Reason:     "EndpointDown",
+			Output:     "Error in running plugin. Please check the error log",
+		},
+		"json output": {
+			Rule: cpmtypes.CustomRule{
+				Reason:       "DiskProblem",
+				Path:         "./test-data/json-output.sh",
+				OutputFormat: cpmtypes.JSONOutput,
+				Timeout:      &ruleTimeout,
+			},
+			ExitStatus: cpmtypes.NonOK,
+			Reason:     "DiskSlow",
+			Output:     "latency: latency is 250ms",
+		},
+		"invalid json output": {
+			Rule: cpmtypes.CustomRule{
+				Reason:       "DiskProblem",
+				Path:         "./test-data/invalid-json-output.sh",
+				OutputFormat: cpmtypes.JSONOutput,
+				Timeout:      &ruleTimeout,
+			},
+			ExitStatus: cpmtypes.Unknown,
+			Reason:     "DiskProblem",
+			Output:     `Invalid output of plugin: unsupported version "v2", expected "v1"`,
+		},
 		"sleep 3 second with ok exit status": {
 			Rule: cpmtypes.CustomRule{
 				Path:    "./test-data/sleep-3-second-with-ok-exit-status.sh",
@@ -89,21 +178,110 @@ func TestNewPluginRun(t *testing.T) {
 		},
 	}
 
+	util.SetNodeName("test-node")
+	defer util.SetNodeName("")
+
 	conf := cpmtypes.CustomPluginConfig{}
 	(&conf).ApplyConfiguration()
 	p := Plugin{config: conf}
 	for desp, utMeta := range utMetas {
-		gotExitStatus, gotOutput := p.run(utMeta.Rule)
+		gotExitStatus, gotReason, gotOutput, _ := p.run(utMeta.Rule)
 		// cut at position max_output_length if expected output is longer than max_output_length bytes
 		if len(utMeta.Output) > *p.config.PluginGlobalConfig.MaxOutputLength {
 			utMeta.Output = utMeta.Output[:*p.config.PluginGlobalConfig.MaxOutputLength]
 		}
-		if gotExitStatus != utMeta.ExitStatus || gotOutput != utMeta.Output {
+		if gotExitStatus != utMeta.ExitStatus || gotReason != utMeta.Reason || gotOutput != utMeta.Output {
 			t.Errorf("%s", desp)
 			t.Errorf("Error in run plugin and get exit status and output for %q. "+
 				"Got exit status: %v, Expected exit status: %v. "+
+				"Got reason: %q, Expected reason: %q. "+
 				"Got output: %q, Expected output: %q",
-				utMeta.Rule.Path, gotExitStatus, utMeta.ExitStatus, gotOutput, utMeta.Output)
+				utMeta.Rule.Path, gotExitStatus, utMeta.ExitStatus, gotReason, utMeta.Reason, gotOutput, utMeta.Output)
 		}
 	}
 }
+
+func TestSlowRuleDoesNotBlockOtherRules(t *testing.T) {
+	invokeInterval := "500ms"
+	concurrency := 2
+	slowRule := &cpmtypes.CustomRule{Path: "./test-data/sleep-3-second-with-ok-exit-status.sh"}
+	fastRule := &cpmtypes.CustomRule{Path: "./test-data/ok.sh"}
+
+	conf := cpmtypes.CustomPluginConfig{
+		Rules: []*cpmtypes.CustomRule{slowRule, fastRule},
+	}
+	conf.PluginGlobalConfig.InvokeIntervalString = &invokeInterval
+	conf.PluginGlobalConfig.Concurrency = &concurrency
+	(&conf).ApplyConfiguration()
+
+	p := NewPlugin(conf)
+	go p.Run()
+
+	fastResults := 0
+	timeout := time.After(2500 * time.Millisecond)
+	for fastResults < 3 {
+		select {
+		case result := <-p.GetResultChan():
+			if result.Rule == slowRule {
+				t.Fatalf("Unexpected result of the slow rule: %+v", result)
+			}
+			fastResults++
+		case <-timeout:
+			t.Fatalf("Fast rule was only run %d times while the slow rule was running", fastResults)
+		}
+	}
+
+	p.Stop()
+	for range p.GetResultChan() {
+	}
+}
+
+func TestPauseAndTrigger(t *testing.T) {
+	invokeInterval := "100ms"
+	rule := &cpmtypes.CustomRule{Path: "./test-data/ok.sh"}
+
+	conf := cpmtypes.CustomPluginConfig{
+		Rules: []*cpmtypes.CustomRule{rule},
+	}
+	conf.PluginGlobalConfig.InvokeIntervalString = &invokeInterval
+	(&conf).ApplyConfiguration()
+
+	p := NewPlugin(conf)
+	p.Pause()
+	if !p.Paused() {
+		t.Fatal("Plugin is not paused after Pause")
+	}
+	go p.Run()
+
+	// Nothing runs while paused, not even on boot.
+	select {
+	case result := <-p.GetResultChan():
+		t.Fatalf("Unexpected result while paused: %+v", result)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Trigger runs the rule even when paused.
+	p.Trigger()
+	select {
+	case result := <-p.GetResultChan():
+		if result.ExitStatus != cpmtypes.OK {
+			t.Errorf("Unexpected exit status %v of the triggered rule", result.ExitStatus)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rule was not run after trigger")
+	}
+
+	p.Resume()
+	if p.Paused() {
+		t.Fatal("Plugin is paused after Resume")
+	}
+	select {
+	case <-p.GetResultChan():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rule was not run after resume")
+	}
+
+	p.Stop()
+	for range p.GetResultChan() {
+	}
+}
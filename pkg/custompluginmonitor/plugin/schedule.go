@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"time"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+)
+
+// ruleScheduler tracks when the rules with their own invoke interval or schedule are due.
+// The other rules are invoked at the global invoke interval.
+type ruleScheduler struct {
+	rules []*cpmtypes.CustomRule
+	next  map[*cpmtypes.CustomRule]time.Time
+}
+
+// newRuleScheduler schedules the rules with their own invoke interval or schedule from now.
+// Unlike the rules invoked at the global invoke interval, they are not invoked on boot.
+func newRuleScheduler(rules []*cpmtypes.CustomRule, now time.Time) *ruleScheduler {
+	s := &ruleScheduler{next: make(map[*cpmtypes.CustomRule]time.Time)}
+	for _, rule := range rules {
+		if !rule.HasOwnSchedule() {
+			continue
+		}
+		s.rules = append(s.rules, rule)
+		s.advance(rule, now)
+	}
+	return s
+}
+
+// advance schedules the next invocation of the rule after now. A schedule without any
+// next time, e.g. February 30, is never due.
+func (s *ruleScheduler) advance(rule *cpmtypes.CustomRule, now time.Time) {
+	if rule.InvokeInterval != nil {
+		s.next[rule] = now.Add(*rule.InvokeInterval)
+		return
+	}
+	if next := rule.Schedule.Next(now); !next.IsZero() {
+		s.next[rule] = next
+		return
+	}
+	delete(s.next, rule)
+}
+
+// due returns the rules due at now in the order of the config, and schedules their next
+// invocations.
+func (s *ruleScheduler) due(now time.Time) []*cpmtypes.CustomRule {
+	var due []*cpmtypes.CustomRule
+	for _, rule := range s.rules {
+		next, ok := s.next[rule]
+		if !ok || next.After(now) {
+			continue
+		}
+		due = append(due, rule)
+		s.advance(rule, now)
+	}
+	return due
+}
+
+// wait returns a channel receiving the time when the next rule is due, nil if no rule is
+// scheduled.
+func (s *ruleScheduler) wait(now time.Time) <-chan time.Time {
+	var earliest time.Time
+	for _, next := range s.next {
+		if earliest.IsZero() || next.Before(earliest) {
+			earliest = next
+		}
+	}
+	if earliest.IsZero() {
+		return nil
+	}
+	return time.After(earliest.Sub(now))
+}
+
+// globalRules returns the rules invoked at the global invoke interval.
+func globalRules(rules []*cpmtypes.CustomRule) []*cpmtypes.CustomRule {
+	var global []*cpmtypes.CustomRule
+	for _, rule := range rules {
+		if !rule.HasOwnSchedule() {
+			global = append(global, rule)
+		}
+	}
+	return global
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+)
+
+func TestRuleScheduler(t *testing.T) {
+	interval := 10 * time.Minute
+	schedule, err := cpmtypes.ParseSchedule("0 * * * *")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing schedule: %v", err)
+	}
+	global := &cpmtypes.CustomRule{Path: "global.sh"}
+	everyTenMinutes := &cpmtypes.CustomRule{Path: "interval.sh", InvokeInterval: &interval}
+	hourly := &cpmtypes.CustomRule{Path: "hourly.sh", Schedule: schedule}
+	rules := []*cpmtypes.CustomRule{global, hourly, everyTenMinutes}
+
+	if got := globalRules(rules); len(got) != 1 || got[0] != global {
+		t.Errorf("Expected only %q to be invoked at the global invoke interval, got %+v", global.Path, got)
+	}
+
+	start := time.Date(2020, 6, 1, 10, 55, 0, 0, time.UTC)
+	s := newRuleScheduler(rules, start)
+	for _, test := range []struct {
+		now  time.Time
+		want []*cpmtypes.CustomRule
+	}{
+		{now: start, want: nil},
+		{now: start.Add(5 * time.Minute), want: []*cpmtypes.CustomRule{hourly}},
+		{now: start.Add(10 * time.Minute), want: []*cpmtypes.CustomRule{everyTenMinutes}},
+		{now: start.Add(15 * time.Minute), want: nil},
+		{now: start.Add(65 * time.Minute), want: []*cpmtypes.CustomRule{hourly, everyTenMinutes}},
+	} {
+		got := s.due(test.now)
+		if len(got) != len(test.want) {
+			t.Errorf("At %v, expected due rules %+v, got %+v", test.now, test.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("At %v, expected due rules %+v, got %+v", test.now, test.want, got)
+				break
+			}
+		}
+	}
+
+	if newRuleScheduler([]*cpmtypes.CustomRule{global}, start).wait(start) != nil {
+		t.Errorf("Expected no wait without rules with their own schedule")
+	}
+}
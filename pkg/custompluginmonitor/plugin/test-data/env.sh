@@ -0,0 +1,4 @@
+#!/usr/bin/env bash
+
+echo "$NPD_RULE_NAME $NPD_CONDITION_TYPE $NPD_NODE_NAME $ENDPOINT $TOKEN $@"
+exit 0
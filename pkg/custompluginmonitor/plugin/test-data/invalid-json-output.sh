@@ -0,0 +1,4 @@
+#!/usr/bin/env bash
+
+echo '{"version": "v2", "status": "ok"}'
+exit 0
@@ -0,0 +1,15 @@
+#!/usr/bin/env bash
+
+cat <<JSON
+{
+  "version": "v1",
+  "reason": "DiskSlow",
+  "metrics": {"latency_ms": 250},
+  "labels": {"device": "sda"},
+  "checks": [
+    {"name": "latency", "status": "nonok", "message": "latency is 250ms"},
+    {"name": "errors", "status": "ok"}
+  ]
+}
+JSON
+exit 1
@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/golang/glog"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+)
+
+// problem is the last problem reported by a rule with recovery verification.
+type problem struct {
+	reason  string
+	message string
+}
+
+// verifyRecovery returns the result of a rule after recovery verification. When the rule
+// reports OK after a problem, the problem keeps being reported until its verification
+// passes.
+func (p *Plugin) verifyRecovery(rule *cpmtypes.CustomRule, exitStatus cpmtypes.Status, reason, message string) (cpmtypes.Status, string, string) {
+	if rule.Verification == nil {
+		return exitStatus, reason, message
+	}
+	p.problemsLock.Lock()
+	defer p.problemsLock.Unlock()
+	last, ok := p.problems[rule]
+	switch {
+	case exitStatus == cpmtypes.NonOK:
+		p.problems[rule] = problem{reason: reason, message: message}
+		return exitStatus, reason, message
+	case exitStatus == cpmtypes.OK && ok:
+		if err := p.verify(rule.Verification); err != nil {
+			glog.Warningf("Recovery of rule %+v is not verified, keep reporting problem %q: %v", rule, last.reason, err)
+			return cpmtypes.NonOK, last.reason, last.message
+		}
+		glog.Infof("Recovery of rule %+v from problem %q is verified", rule, last.reason)
+	}
+	delete(p.problems, rule)
+	return exitStatus, reason, message
+}
+
+// verify runs the verification plugin or probe, and returns an error if it does not pass.
+func verify(v *cpmtypes.Verification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *v.Timeout)
+	defer cancel()
+	if v.Path != "" {
+		output, err := exec.CommandContext(ctx, v.Path, v.Args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("verification plugin %q failed: %v, output: %q", v.Path, err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	return probe(ctx, v.Probe)
+}
+
+// probe runs a built-in probe, see Verification.Probe.
+func probe(ctx context.Context, probe string) error {
+	u, err := url.Parse(probe)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "tcp":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return fmt.Errorf("probe %q failed: %v", probe, err)
+		}
+		conn.Close()
+		return nil
+	case "http", "https":
+		req, err := http.NewRequest(http.MethodGet, probe, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("probe %q failed: %v", probe, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("probe %q returned status %d", probe, resp.StatusCode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported probe %q", probe)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+)
+
+func TestVerifyRecovery(t *testing.T) {
+	rule := &cpmtypes.CustomRule{Verification: &cpmtypes.Verification{Probe: "tcp://127.0.0.1:1"}}
+	p := NewPlugin(cpmtypes.CustomPluginConfig{Rules: []*cpmtypes.CustomRule{rule}})
+	var verifyErr error
+	verified := 0
+	p.verify = func(*cpmtypes.Verification) error {
+		verified++
+		return verifyErr
+	}
+
+	steps := []struct {
+		exitStatus cpmtypes.Status
+		reason     string
+		message    string
+		verifyErr  error
+
+		expectedStatus  cpmtypes.Status
+		expectedReason  string
+		expectedMessage string
+		expectedVerify  int
+	}{
+		// OK without a previous problem is not verified.
+		{cpmtypes.OK, "Healthy", "ok", nil, cpmtypes.OK, "Healthy", "ok", 0},
+		{cpmtypes.NonOK, "Broken", "broken", nil, cpmtypes.NonOK, "Broken", "broken", 0},
+		// The recovery is not verified, the last problem is kept.
+		{cpmtypes.OK, "Healthy", "ok", errors.New("still broken"), cpmtypes.NonOK, "Broken", "broken", 1},
+		{cpmtypes.OK, "Healthy", "ok", errors.New("still broken"), cpmtypes.NonOK, "Broken", "broken", 2},
+		// The recovery is verified.
+		{cpmtypes.OK, "Healthy", "ok", nil, cpmtypes.OK, "Healthy", "ok", 3},
+		{cpmtypes.OK, "Healthy", "ok", nil, cpmtypes.OK, "Healthy", "ok", 3},
+		// Unknown forgets the problem.
+		{cpmtypes.NonOK, "Broken", "broken", nil, cpmtypes.NonOK, "Broken", "broken", 3},
+		{cpmtypes.Unknown, "Broken", "timeout", nil, cpmtypes.Unknown, "Broken", "timeout", 3},
+		{cpmtypes.OK, "Healthy", "ok", nil, cpmtypes.OK, "Healthy", "ok", 3},
+	}
+	for i, step := range steps {
+		verifyErr = step.verifyErr
+		status, reason, message := p.verifyRecovery(rule, step.exitStatus, step.reason, step.message)
+		if status != step.expectedStatus || reason != step.expectedReason || message != step.expectedMessage {
+			t.Errorf("Step %d: expected (%v, %q, %q), got (%v, %q, %q)", i,
+				step.expectedStatus, step.expectedReason, step.expectedMessage, status, reason, message)
+		}
+		if verified != step.expectedVerify {
+			t.Errorf("Step %d: expected %d verifications, got %d", i, step.expectedVerify, verified)
+		}
+	}
+
+	// Rules without verification are not changed.
+	status, _, _ := p.verifyRecovery(&cpmtypes.CustomRule{}, cpmtypes.OK, "Healthy", "ok")
+	if status != cpmtypes.OK {
+		t.Errorf("Expected OK for rule without verification, got %v", status)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	timeout := time.Second
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	tcpAddress := listener.Addr().String()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedAddress := closed.Addr().String()
+	closed.Close()
+
+	utMetas := map[string]struct {
+		Verification cpmtypes.Verification
+		Pass         bool
+	}{
+		"passing plugin": {
+			Verification: cpmtypes.Verification{Path: "./test-data/ok.sh"},
+			Pass:         true,
+		},
+		"failing plugin": {
+			Verification: cpmtypes.Verification{Path: "./test-data/non-ok.sh"},
+		},
+		"passing http probe": {
+			Verification: cpmtypes.Verification{Probe: server.URL + "/healthz"},
+			Pass:         true,
+		},
+		"failing http probe": {
+			Verification: cpmtypes.Verification{Probe: server.URL + "/unhealthy"},
+		},
+		"passing tcp probe": {
+			Verification: cpmtypes.Verification{Probe: "tcp://" + tcpAddress},
+			Pass:         true,
+		},
+		"failing tcp probe": {
+			Verification: cpmtypes.Verification{Probe: "tcp://" + closedAddress},
+		},
+	}
+	for desp, utMeta := range utMetas {
+		v := utMeta.Verification
+		v.Timeout = &timeout
+		err := verify(&v)
+		if utMeta.Pass && err != nil {
+			t.Errorf("Expect %q to pass, got error: %v", desp, err)
+		}
+		if !utMeta.Pass && err == nil {
+			t.Errorf("Expect %q to fail", desp)
+		}
+	}
+}
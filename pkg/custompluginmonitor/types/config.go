@@ -18,7 +18,9 @@ package types
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
 	"time"
 
 	"k8s.io/node-problem-detector/pkg/types"
@@ -33,6 +35,8 @@ var (
 	defaultConcurrency                       = 3
 	defaultMessageChangeBasedConditionUpdate = false
 	defaultEnableMetricsReporting            = true
+	defaultForceRefreshInterval              = 10 * time.Minute
+	defaultForceRefreshIntervalString        = defaultForceRefreshInterval.String()
 
 	customPluginName = "custom"
 )
@@ -50,8 +54,29 @@ type pluginGlobalConfig struct {
 	MaxOutputLength *int `json:"max_output_length,omitempty"`
 	// Concurrency is the number of concurrent running plugins.
 	Concurrency *int `json:"concurrency,omitempty"`
+	// InvokeJitterString is the maximum random delay string added to each plugin invocation.
+	InvokeJitterString *string `json:"invoke_jitter,omitempty"`
+	// InvokeJitter is the maximum random delay added to each plugin invocation, so that
+	// plugins scheduled at the same time do not all start at once.
+	InvokeJitter *time.Duration `json:"-"`
 	// EnableMessageChangeBasedConditionUpdate indicates whether NPD should enable message change based condition update.
 	EnableMessageChangeBasedConditionUpdate *bool `json:"enable_message_change_based_condition_update,omitempty"`
+	// MaxLoadPerCPU is the 1-minute load average per CPU above which non-critical rules are
+	// deferred to the next invoke interval. Not set means no limit.
+	MaxLoadPerCPU *float64 `json:"max_load_per_cpu,omitempty"`
+	// MaxPressure is the pressure stall information (PSI) "some" avg10 percentage of cpu,
+	// memory or io above which non-critical rules are deferred to the next invoke interval.
+	// Not set means no limit.
+	MaxPressure *float64 `json:"max_pressure,omitempty"`
+	// ReportOnlyOnChange indicates whether a rule result is only reported when it differs
+	// from the last reported result of the rule, or when the force refresh interval passed.
+	ReportOnlyOnChange *bool `json:"report_only_on_change,omitempty"`
+	// ForceRefreshIntervalString is the interval string at which unchanged results are
+	// reported again when ReportOnlyOnChange is set.
+	ForceRefreshIntervalString *string `json:"force_refresh_interval,omitempty"`
+	// ForceRefreshInterval is the interval at which unchanged results are reported again
+	// when ReportOnlyOnChange is set.
+	ForceRefreshInterval *time.Duration `json:"-"`
 }
 
 // Custom plugin config is the configuration of custom plugin monitor.
@@ -67,6 +92,8 @@ type CustomPluginConfig struct {
 	DefaultConditions []types.Condition `json:"conditions"`
 	// Rules are the rules custom plugin monitor will follow to parse and invoke plugins.
 	Rules []*CustomRule `json:"rules"`
+	// RulesDir is a directory every executable in which becomes a rule, see DiscoverRules.
+	RulesDir string `json:"rulesDir,omitempty"`
 	// EnableMetricsReporting describes whether to report problems as metrics or not.
 	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
 }
@@ -101,9 +128,26 @@ func (cpc *CustomPluginConfig) ApplyConfiguration() error {
 	if cpc.PluginGlobalConfig.Concurrency == nil {
 		cpc.PluginGlobalConfig.Concurrency = &defaultConcurrency
 	}
+	if cpc.PluginGlobalConfig.InvokeJitterString != nil {
+		invokeJitter, err := time.ParseDuration(*cpc.PluginGlobalConfig.InvokeJitterString)
+		if err != nil {
+			return fmt.Errorf("error in parsing invoke jitter %q: %v", *cpc.PluginGlobalConfig.InvokeJitterString, err)
+		}
+		cpc.PluginGlobalConfig.InvokeJitter = &invokeJitter
+	}
 	if cpc.PluginGlobalConfig.EnableMessageChangeBasedConditionUpdate == nil {
 		cpc.PluginGlobalConfig.EnableMessageChangeBasedConditionUpdate = &defaultMessageChangeBasedConditionUpdate
 	}
+	if cpc.PluginGlobalConfig.ReportOnlyOnChange != nil && *cpc.PluginGlobalConfig.ReportOnlyOnChange {
+		if cpc.PluginGlobalConfig.ForceRefreshIntervalString == nil {
+			cpc.PluginGlobalConfig.ForceRefreshIntervalString = &defaultForceRefreshIntervalString
+		}
+		forceRefreshInterval, err := time.ParseDuration(*cpc.PluginGlobalConfig.ForceRefreshIntervalString)
+		if err != nil {
+			return fmt.Errorf("error in parsing force refresh interval %q: %v", *cpc.PluginGlobalConfig.ForceRefreshIntervalString, err)
+		}
+		cpc.PluginGlobalConfig.ForceRefreshInterval = &forceRefreshInterval
+	}
 
 	for _, rule := range cpc.Rules {
 		if rule.TimeoutString != nil {
@@ -113,6 +157,47 @@ func (cpc *CustomPluginConfig) ApplyConfiguration() error {
 			}
 			rule.Timeout = &timeout
 		}
+		if rule.InvokeIntervalString != nil {
+			invokeInterval, err := time.ParseDuration(*rule.InvokeIntervalString)
+			if err != nil {
+				return fmt.Errorf("error in parsing rule invoke interval %+v: %v", rule, err)
+			}
+			rule.InvokeInterval = &invokeInterval
+		}
+		if rule.ScheduleString != "" {
+			schedule, err := ParseSchedule(rule.ScheduleString)
+			if err != nil {
+				return fmt.Errorf("error in parsing rule schedule %+v: %v", rule, err)
+			}
+			rule.Schedule = schedule
+		}
+		if v := rule.Verification; v != nil {
+			if v.TimeoutString != nil {
+				timeout, err := time.ParseDuration(*v.TimeoutString)
+				if err != nil {
+					return fmt.Errorf("error in parsing verification timeout of rule %+v: %v", rule, err)
+				}
+				v.Timeout = &timeout
+			} else if rule.Timeout != nil {
+				v.Timeout = rule.Timeout
+			} else {
+				v.Timeout = cpc.PluginGlobalConfig.Timeout
+			}
+		}
+		for _, mapping := range rule.ExitCodes {
+			status, err := ParseStatus(mapping.StatusString)
+			if err != nil {
+				return fmt.Errorf("error in parsing exit code %d mapping of rule %+v: %v", mapping.ExitCode, rule, err)
+			}
+			mapping.Status = status
+		}
+		if rule.Severity != "" {
+			severity, err := types.ParseSeverity(string(rule.Severity))
+			if err != nil {
+				return fmt.Errorf("error in parsing severity of rule %+v: %v", rule, err)
+			}
+			rule.Severity = severity
+		}
 	}
 
 	if cpc.EnableMetricsReporting == nil {
@@ -122,12 +207,45 @@ func (cpc *CustomPluginConfig) ApplyConfiguration() error {
 	return nil
 }
 
-// Validate verifies whether the settings in CustomPluginConfig are valid.
+// Validate verifies whether the settings in CustomPluginConfig are valid, and the plugins
+// exist.
 func (cpc CustomPluginConfig) Validate() error {
+	if err := cpc.ValidateSettings(); err != nil {
+		return err
+	}
+	return cpc.validatePaths()
+}
+
+// ValidateSettings verifies whether the settings in CustomPluginConfig are valid, without
+// checking that the plugins exist, so that configs can be validated off the nodes.
+func (cpc CustomPluginConfig) ValidateSettings() error {
 	if cpc.Plugin != customPluginName {
 		return fmt.Errorf("NPD does not support %q plugin for now. Only support \"custom\"", cpc.Plugin)
 	}
 
+	if *cpc.PluginGlobalConfig.Concurrency < 1 {
+		return fmt.Errorf("plugin concurrency must be at least 1, got %d", *cpc.PluginGlobalConfig.Concurrency)
+	}
+
+	if jitter := cpc.PluginGlobalConfig.InvokeJitter; jitter != nil &&
+		(*jitter < 0 || *jitter >= *cpc.PluginGlobalConfig.InvokeInterval) {
+		return fmt.Errorf("invoke jitter %v must be non-negative and less than invoke interval %v",
+			*jitter, *cpc.PluginGlobalConfig.InvokeInterval)
+	}
+
+	if maxLoad := cpc.PluginGlobalConfig.MaxLoadPerCPU; maxLoad != nil && *maxLoad <= 0 {
+		return fmt.Errorf("max load per CPU must be positive, got %v", *maxLoad)
+	}
+
+	if maxPressure := cpc.PluginGlobalConfig.MaxPressure; maxPressure != nil && (*maxPressure <= 0 || *maxPressure > 100) {
+		return fmt.Errorf("max pressure must be a percentage in (0, 100], got %v", *maxPressure)
+	}
+
+	if refresh := cpc.PluginGlobalConfig.ForceRefreshInterval; refresh != nil && *refresh < *cpc.PluginGlobalConfig.InvokeInterval {
+		return fmt.Errorf("force refresh interval %v must not be less than invoke interval %v",
+			*refresh, *cpc.PluginGlobalConfig.InvokeInterval)
+	}
+
 	for _, rule := range cpc.Rules {
 		if rule.Timeout != nil && *rule.Timeout > *cpc.PluginGlobalConfig.Timeout {
 			return fmt.Errorf("plugin timeout is greater than global timeout. "+
@@ -136,8 +254,53 @@ func (cpc CustomPluginConfig) Validate() error {
 	}
 
 	for _, rule := range cpc.Rules {
-		if _, err := os.Stat(rule.Path); os.IsNotExist(err) {
-			return fmt.Errorf("rule path %q does not exist. Rule: %+v", rule.Path, rule)
+		if rule.InvokeInterval != nil && rule.Schedule != nil {
+			return fmt.Errorf("invoke interval and schedule can not both be set. Rule: %+v", rule)
+		}
+		if rule.InvokeInterval != nil && *rule.InvokeInterval <= 0 {
+			return fmt.Errorf("rule invoke interval %v must be positive. Rule: %+v", *rule.InvokeInterval, rule)
+		}
+	}
+
+	for _, rule := range cpc.Rules {
+		if err := validateEnv(rule); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range cpc.Rules {
+		switch rule.OutputFormat {
+		case "", TextOutput:
+		case JSONOutput:
+			if len(rule.ExitCodes) > 0 {
+				return fmt.Errorf("exit codes can not be mapped for JSON output. Rule: %+v", rule)
+			}
+		default:
+			return fmt.Errorf("unknown output format %q, expected %q or %q. Rule: %+v", rule.OutputFormat, TextOutput, JSONOutput, rule)
+		}
+	}
+
+	for _, rule := range cpc.Rules {
+		exitCodes := map[int]bool{}
+		for _, mapping := range rule.ExitCodes {
+			if exitCodes[mapping.ExitCode] {
+				return fmt.Errorf("exit code %d is mapped more than once. Rule: %+v", mapping.ExitCode, rule)
+			}
+			exitCodes[mapping.ExitCode] = true
+		}
+	}
+
+	for _, rule := range cpc.Rules {
+		if err := rule.Ownership.Validate(); err != nil {
+			return fmt.Errorf("invalid ownership: %v. Rule: %+v", err, rule)
+		}
+	}
+
+	for _, rule := range cpc.Rules {
+		if rule.Verification != nil {
+			if err := rule.Verification.validate(rule, *cpc.PluginGlobalConfig.Timeout); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -160,3 +323,79 @@ func (cpc CustomPluginConfig) Validate() error {
 
 	return nil
 }
+
+// validatePaths verifies whether the plugins of the rules and their verifications exist.
+func (cpc CustomPluginConfig) validatePaths() error {
+	for _, rule := range cpc.Rules {
+		if _, err := os.Stat(rule.Path); os.IsNotExist(err) {
+			return fmt.Errorf("rule path %q does not exist. Rule: %+v", rule.Path, rule)
+		}
+		if v := rule.Verification; v != nil && v.Path != "" {
+			if _, err := os.Stat(v.Path); os.IsNotExist(err) {
+				return fmt.Errorf("verification path %q does not exist. Rule: %+v", v.Path, rule)
+			}
+		}
+	}
+	return nil
+}
+
+// validate verifies whether the verification of the rule is valid.
+func (v *Verification) validate(rule *CustomRule, globalTimeout time.Duration) error {
+	if rule.Type != types.Perm {
+		return fmt.Errorf("verification is only supported by permanent problems. Rule: %+v", rule)
+	}
+	if (v.Path == "") == (v.Probe == "") {
+		return fmt.Errorf("verification must set exactly one of path and probe. Rule: %+v", rule)
+	}
+	if *v.Timeout > globalTimeout {
+		return fmt.Errorf("verification timeout %v is greater than global timeout %v. Rule: %+v", *v.Timeout, globalTimeout, rule)
+	}
+	if v.Path != "" {
+		return nil
+	}
+	u, err := url.Parse(v.Probe)
+	if err != nil {
+		return fmt.Errorf("invalid verification probe %q: %v. Rule: %+v", v.Probe, err, rule)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return fmt.Errorf("verification probe %q has no address. Rule: %+v", v.Probe, rule)
+		}
+	case "http", "https":
+	default:
+		return fmt.Errorf("unsupported verification probe %q, supported schemes: tcp, http, https. Rule: %+v", v.Probe, rule)
+	}
+	return nil
+}
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEnv verifies the environment variables of the rule, which must not override the
+// rule metadata or each other.
+func validateEnv(rule *CustomRule) error {
+	reserved := rule.RuleEnv("")
+	for name := range rule.Env {
+		if !envNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q. Rule: %+v", name, rule)
+		}
+		if _, ok := reserved[name]; ok {
+			return fmt.Errorf("environment variable %q is reserved for the rule metadata. Rule: %+v", name, rule)
+		}
+	}
+	for name, path := range rule.SecretEnv {
+		if !envNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q. Rule: %+v", name, rule)
+		}
+		if _, ok := reserved[name]; ok {
+			return fmt.Errorf("environment variable %q is reserved for the rule metadata. Rule: %+v", name, rule)
+		}
+		if _, ok := rule.Env[name]; ok {
+			return fmt.Errorf("environment variable %q is set by both env and secretEnv. Rule: %+v", name, rule)
+		}
+		if path == "" {
+			return fmt.Errorf("secret environment variable %q has no file. Rule: %+v", name, rule)
+		}
+	}
+	return nil
+}
@@ -33,6 +33,9 @@ func TestCustomPluginConfigApplyConfiguration(t *testing.T) {
 	concurrency := 2
 	messageChangeBasedConditionUpdate := true
 	disableMetricsReporting := false
+	invokeJitter := 5 * time.Second
+	invokeJitterString := invokeJitter.String()
+	reportOnlyOnChange := true
 
 	ruleTimeout := 1 * time.Second
 	ruleTimeoutString := ruleTimeout.String()
@@ -188,6 +191,107 @@ func TestCustomPluginConfigApplyConfiguration(t *testing.T) {
 				EnableMetricsReporting: &disableMetricsReporting,
 			},
 		},
+		"exit code mappings": {
+			Orig: CustomPluginConfig{
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/unknown.sh",
+						ExitCodes: []*ExitCodeMapping{
+							{ExitCode: 2, StatusString: "NonOK", Reason: "Critical"},
+							{ExitCode: 3, StatusString: "unknown"},
+						},
+					},
+				},
+			},
+			Wanted: CustomPluginConfig{
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeIntervalString:                    &defaultInvokeIntervalString,
+					InvokeInterval:                          &defaultInvokeInterval,
+					TimeoutString:                           &defaultGlobalTimeoutString,
+					Timeout:                                 &defaultGlobalTimeout,
+					MaxOutputLength:                         &defaultMaxOutputLength,
+					Concurrency:                             &defaultConcurrency,
+					EnableMessageChangeBasedConditionUpdate: &defaultMessageChangeBasedConditionUpdate,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/unknown.sh",
+						ExitCodes: []*ExitCodeMapping{
+							{ExitCode: 2, StatusString: "NonOK", Status: NonOK, Reason: "Critical"},
+							{ExitCode: 3, StatusString: "unknown", Status: Unknown},
+						},
+					},
+				},
+				EnableMetricsReporting: &defaultEnableMetricsReporting,
+			},
+		},
+		"rule severity": {
+			Orig: CustomPluginConfig{
+				Rules: []*CustomRule{
+					{Path: "../plugin/test-data/ok.sh", Severity: "warning"},
+					{Path: "../plugin/test-data/ok.sh", Severity: types.Critical},
+				},
+			},
+			Wanted: CustomPluginConfig{
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeIntervalString:                    &defaultInvokeIntervalString,
+					InvokeInterval:                          &defaultInvokeInterval,
+					TimeoutString:                           &defaultGlobalTimeoutString,
+					Timeout:                                 &defaultGlobalTimeout,
+					MaxOutputLength:                         &defaultMaxOutputLength,
+					Concurrency:                             &defaultConcurrency,
+					EnableMessageChangeBasedConditionUpdate: &defaultMessageChangeBasedConditionUpdate,
+				},
+				Rules: []*CustomRule{
+					{Path: "../plugin/test-data/ok.sh", Severity: types.Warn},
+					{Path: "../plugin/test-data/ok.sh", Severity: types.Critical},
+				},
+				EnableMetricsReporting: &defaultEnableMetricsReporting,
+			},
+		},
+		"custom invoke jitter": {
+			Orig: CustomPluginConfig{
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeJitterString: &invokeJitterString,
+				},
+			},
+			Wanted: CustomPluginConfig{
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeIntervalString:                    &defaultInvokeIntervalString,
+					InvokeInterval:                          &defaultInvokeInterval,
+					TimeoutString:                           &defaultGlobalTimeoutString,
+					Timeout:                                 &defaultGlobalTimeout,
+					MaxOutputLength:                         &defaultMaxOutputLength,
+					Concurrency:                             &defaultConcurrency,
+					InvokeJitterString:                      &invokeJitterString,
+					InvokeJitter:                            &invokeJitter,
+					EnableMessageChangeBasedConditionUpdate: &defaultMessageChangeBasedConditionUpdate,
+				},
+				EnableMetricsReporting: &defaultEnableMetricsReporting,
+			},
+		},
+		"report only on change": {
+			Orig: CustomPluginConfig{
+				PluginGlobalConfig: pluginGlobalConfig{
+					ReportOnlyOnChange: &reportOnlyOnChange,
+				},
+			},
+			Wanted: CustomPluginConfig{
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeIntervalString:                    &defaultInvokeIntervalString,
+					InvokeInterval:                          &defaultInvokeInterval,
+					TimeoutString:                           &defaultGlobalTimeoutString,
+					Timeout:                                 &defaultGlobalTimeout,
+					MaxOutputLength:                         &defaultMaxOutputLength,
+					Concurrency:                             &defaultConcurrency,
+					EnableMessageChangeBasedConditionUpdate: &defaultMessageChangeBasedConditionUpdate,
+					ReportOnlyOnChange:                      &reportOnlyOnChange,
+					ForceRefreshIntervalString:              &defaultForceRefreshIntervalString,
+					ForceRefreshInterval:                    &defaultForceRefreshInterval,
+				},
+				EnableMetricsReporting: &defaultEnableMetricsReporting,
+			},
+		},
 	}
 
 	for desp, utMeta := range utMetas {
@@ -202,6 +306,16 @@ func TestCustomPluginConfigApplyConfiguration(t *testing.T) {
 func TestCustomPluginConfigValidate(t *testing.T) {
 	normalRuleTimeout := defaultGlobalTimeout - 1*time.Second
 	exceededRuleTimeout := defaultGlobalTimeout + 1*time.Second
+	normalInvokeJitter := defaultInvokeInterval / 2
+	exceededInvokeJitter := defaultInvokeInterval
+	zeroConcurrency := 0
+	maxLoadPerCPU := 2.0
+	maxPressure := 40.0
+	invalidMaxPressure := 120.0
+	shortForceRefreshInterval := time.Second
+	hourlyInvokeInterval := time.Hour
+	zeroInvokeInterval := time.Duration(0)
+	hourlySchedule, _ := ParseSchedule("@hourly")
 
 	utMetas := map[string]struct {
 		Conf    CustomPluginConfig
@@ -330,6 +444,343 @@ func TestCustomPluginConfigValidate(t *testing.T) {
 			},
 			IsError: true,
 		},
+		"normal invoke jitter": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+					InvokeJitter:    &normalInvokeJitter,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/ok.sh",
+					},
+				},
+			},
+			IsError: false,
+		},
+		"invoke jitter not less than invoke interval": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+					InvokeJitter:    &exceededInvokeJitter,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/ok.sh",
+					},
+				},
+			},
+			IsError: true,
+		},
+		"load limits": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+					MaxLoadPerCPU:   &maxLoadPerCPU,
+					MaxPressure:     &maxPressure,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/ok.sh",
+					},
+				},
+			},
+			IsError: false,
+		},
+		"max pressure above 100%": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+					MaxPressure:     &invalidMaxPressure,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/ok.sh",
+					},
+				},
+			},
+			IsError: true,
+		},
+		"force refresh interval less than invoke interval": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:       &defaultInvokeInterval,
+					Timeout:              &defaultGlobalTimeout,
+					MaxOutputLength:      &defaultMaxOutputLength,
+					Concurrency:          &defaultConcurrency,
+					ForceRefreshInterval: &shortForceRefreshInterval,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/ok.sh",
+					},
+				},
+			},
+			IsError: true,
+		},
+		"duplicate exit code mapping": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/unknown.sh",
+						ExitCodes: []*ExitCodeMapping{
+							{ExitCode: 3, Status: Unknown},
+							{ExitCode: 3, Status: NonOK},
+						},
+					},
+				},
+			},
+			IsError: true,
+		},
+		"json output": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:         "../plugin/test-data/json-output.sh",
+						OutputFormat: JSONOutput,
+					},
+				},
+			},
+			IsError: false,
+		},
+		"exit code mapping with json output": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:         "../plugin/test-data/json-output.sh",
+						OutputFormat: JSONOutput,
+						ExitCodes: []*ExitCodeMapping{
+							{ExitCode: 1, Status: NonOK},
+						},
+					},
+				},
+			},
+			IsError: true,
+		},
+		"unknown output format": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:         "../plugin/test-data/ok.sh",
+						OutputFormat: "yaml",
+					},
+				},
+			},
+			IsError: true,
+		},
+		"zero concurrency": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &zeroConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/ok.sh",
+					},
+				},
+			},
+			IsError: true,
+		},
+		"env and secret env": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:      "../plugin/test-data/ok.sh",
+						Env:       map[string]string{"ENDPOINT": "https://example.com"},
+						SecretEnv: map[string]string{"TOKEN": "/etc/npd/token"},
+					},
+				},
+			},
+			IsError: false,
+		},
+		"invalid env name": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/ok.sh",
+						Env:  map[string]string{"END-POINT": "https://example.com"},
+					},
+				},
+			},
+			IsError: true,
+		},
+		"env overriding rule metadata": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path: "../plugin/test-data/ok.sh",
+						Env:  map[string]string{"NPD_NODE_NAME": "node"},
+					},
+				},
+			},
+			IsError: true,
+		},
+		"env set by env and secret env": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:      "../plugin/test-data/ok.sh",
+						Env:       map[string]string{"TOKEN": "token"},
+						SecretEnv: map[string]string{"TOKEN": "/etc/npd/token"},
+					},
+				},
+			},
+			IsError: true,
+		},
+		"rule invoke interval and schedule": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:           "../plugin/test-data/ok.sh",
+						InvokeInterval: &hourlyInvokeInterval,
+					},
+					{
+						Path:     "../plugin/test-data/ok.sh",
+						Schedule: hourlySchedule,
+					},
+				},
+			},
+			IsError: false,
+		},
+		"rule with both invoke interval and schedule": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:           "../plugin/test-data/ok.sh",
+						InvokeInterval: &hourlyInvokeInterval,
+						Schedule:       hourlySchedule,
+					},
+				},
+			},
+			IsError: true,
+		},
+		"zero rule invoke interval": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:           "../plugin/test-data/ok.sh",
+						InvokeInterval: &zeroInvokeInterval,
+					},
+				},
+			},
+			IsError: true,
+		},
+		"secret env without file": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:      "../plugin/test-data/ok.sh",
+						SecretEnv: map[string]string{"TOKEN": ""},
+					},
+				},
+			},
+			IsError: true,
+		},
 	}
 
 	for desp, utMeta := range utMetas {
@@ -344,3 +795,103 @@ func TestCustomPluginConfigValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestVerification(t *testing.T) {
+	ruleTimeout := "2s"
+	verificationTimeout := "3s"
+	exceededTimeout := "1m"
+
+	utMetas := map[string]struct {
+		Type            types.Type
+		RuleTimeout     *string
+		Verification    Verification
+		ExpectedTimeout time.Duration
+		IsError         bool
+	}{
+		"plugin with default timeout": {
+			Type:            types.Perm,
+			Verification:    Verification{Path: "../plugin/test-data/ok.sh"},
+			ExpectedTimeout: defaultGlobalTimeout,
+		},
+		"probe with rule timeout": {
+			Type:            types.Perm,
+			RuleTimeout:     &ruleTimeout,
+			Verification:    Verification{Probe: "tcp://127.0.0.1:10250"},
+			ExpectedTimeout: 2 * time.Second,
+		},
+		"http probe with own timeout": {
+			Type:            types.Perm,
+			RuleTimeout:     &ruleTimeout,
+			Verification:    Verification{Probe: "http://127.0.0.1:10248/healthz", TimeoutString: &verificationTimeout},
+			ExpectedTimeout: 3 * time.Second,
+		},
+		"temporary problem": {
+			Type:         types.Temp,
+			Verification: Verification{Path: "../plugin/test-data/ok.sh"},
+			IsError:      true,
+		},
+		"both path and probe": {
+			Type:         types.Perm,
+			Verification: Verification{Path: "../plugin/test-data/ok.sh", Probe: "tcp://127.0.0.1:10250"},
+			IsError:      true,
+		},
+		"neither path nor probe": {
+			Type:    types.Perm,
+			IsError: true,
+		},
+		"non exist path": {
+			Type:         types.Perm,
+			Verification: Verification{Path: "../plugin/test-data/non-exist-plugin-path.sh"},
+			IsError:      true,
+		},
+		"unsupported probe": {
+			Type:         types.Perm,
+			Verification: Verification{Probe: "udp://127.0.0.1:53"},
+			IsError:      true,
+		},
+		"tcp probe without address": {
+			Type:         types.Perm,
+			Verification: Verification{Probe: "tcp:10250"},
+			IsError:      true,
+		},
+		"exceed global timeout": {
+			Type:         types.Perm,
+			Verification: Verification{Path: "../plugin/test-data/ok.sh", TimeoutString: &exceededTimeout},
+			IsError:      true,
+		},
+	}
+
+	for desp, utMeta := range utMetas {
+		verification := utMeta.Verification
+		conf := CustomPluginConfig{
+			Plugin:            customPluginName,
+			DefaultConditions: []types.Condition{{Type: "TestCondition"}},
+			Rules: []*CustomRule{
+				{
+					Type:          utMeta.Type,
+					Condition:     "TestCondition",
+					Path:          "../plugin/test-data/ok.sh",
+					TimeoutString: utMeta.RuleTimeout,
+					Verification:  &verification,
+				},
+			},
+		}
+		err := (&conf).ApplyConfiguration()
+		if err == nil {
+			err = conf.Validate()
+		}
+		if utMeta.IsError {
+			if err == nil {
+				t.Errorf("Expect error for %q", desp)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", desp, err)
+			continue
+		}
+		if *verification.Timeout != utMeta.ExpectedTimeout {
+			t.Errorf("Expect verification timeout %v for %q, got %v", utMeta.ExpectedTimeout, desp, *verification.Timeout)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+const (
+	// headerPrefix marks the lines of the header comment of a plugin holding the rule
+	// metadata, e.g. "# npd: reason: NTPIsDown".
+	headerPrefix = "npd:"
+	// maxHeaderLines is the number of lines at the top of a plugin searched for the rule
+	// metadata.
+	maxHeaderLines = 50
+)
+
+// sidecarExtensions are the extensions of the files holding the rule metadata of the plugin
+// with the same name.
+var sidecarExtensions = []string{".yaml", ".yml"}
+
+// discoveredRule is the metadata of a rule discovered in the rules directory.
+type discoveredRule struct {
+	CustomRule
+	// DefaultCondition is the default state of the condition of a permanent rule. It is
+	// added to the conditions of the config, unless they have the condition already.
+	DefaultCondition *types.Condition `json:"defaultCondition,omitempty"`
+}
+
+// DiscoverRules adds a rule for every executable in the rules directory. The rule metadata,
+// i.e. the fields of a rule except the path, is read in YAML from the sidecar file named
+// after the plugin with a ".yaml" or ".yml" extension, or else from the lines of the header
+// comment of the plugin starting with "npd:". Hidden files, directories and non-executable
+// files are skipped.
+func (cpc *CustomPluginConfig) DiscoverRules() error {
+	if cpc.RulesDir == "" {
+		return nil
+	}
+	files, err := ioutil.ReadDir(cpc.RulesDir)
+	if err != nil {
+		return fmt.Errorf("failed to read rules directory %q: %v", cpc.RulesDir, err)
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") || isSidecar(file.Name()) {
+			continue
+		}
+		path := filepath.Join(cpc.RulesDir, file.Name())
+		// Follow the symlinks of the files projected from ConfigMaps.
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat plugin %q: %v", path, err)
+		}
+		if !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+			continue
+		}
+		rule, err := readRuleMetadata(path)
+		if err != nil {
+			return err
+		}
+		if rule.Path != "" {
+			return fmt.Errorf("rule metadata of plugin %q must not set the path", path)
+		}
+		if rule.Type == "" || rule.Reason == "" {
+			return fmt.Errorf("rule metadata of plugin %q must set the type and the reason", path)
+		}
+		rule.Path = path
+		if rule.DefaultCondition != nil {
+			cpc.addDefaultCondition(*rule.DefaultCondition)
+		}
+		cpc.Rules = append(cpc.Rules, &rule.CustomRule)
+	}
+	return nil
+}
+
+// addDefaultCondition adds a default condition, unless the config has the condition already.
+func (cpc *CustomPluginConfig) addDefaultCondition(condition types.Condition) {
+	for _, c := range cpc.DefaultConditions {
+		if c.Type == condition.Type {
+			return
+		}
+	}
+	cpc.DefaultConditions = append(cpc.DefaultConditions, condition)
+}
+
+func isSidecar(name string) bool {
+	for _, ext := range sidecarExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// readRuleMetadata reads the rule metadata of the plugin from its sidecar file, or else from
+// its header comment.
+func readRuleMetadata(path string) (*discoveredRule, error) {
+	var data []byte
+	for _, ext := range sidecarExtensions {
+		sidecar, err := ioutil.ReadFile(path + ext)
+		if err == nil {
+			data = sidecar
+			break
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read rule metadata %q: %v", path+ext, err)
+		}
+	}
+	if data == nil {
+		header, err := readHeader(path)
+		if err != nil {
+			return nil, err
+		}
+		data = header
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, fmt.Errorf("plugin %q has no rule metadata", path)
+	}
+	data, err := yaml.ToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rule metadata of plugin %q: %v", path, err)
+	}
+	var rule discoveredRule
+	if err := util.UnmarshalStrict(data, &rule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rule metadata of plugin %q: %v", path, err)
+	}
+	return &rule, nil
+}
+
+// readHeader returns the YAML of the lines of the header comment of the plugin starting
+// with "npd:", e.g. "# npd: reason: NTPIsDown" or "// npd: reason: NTPIsDown".
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin %q: %v", path, err)
+	}
+	defer f.Close()
+
+	var header []string
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < maxHeaderLines && scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		for _, comment := range []string{"#", "//", "::", "REM"} {
+			if strings.HasPrefix(line, comment) {
+				line = strings.TrimSpace(strings.TrimPrefix(line, comment))
+				break
+			}
+		}
+		if strings.HasPrefix(line, headerPrefix) {
+			header = append(header, strings.TrimPrefix(strings.TrimPrefix(line, headerPrefix), " "))
+		}
+	}
+	// Binary plugins have no header, and may have no lines shorter than the buffer.
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return nil, fmt.Errorf("failed to read plugin %q: %v", path, err)
+	}
+	return []byte(strings.Join(header, "\n")), nil
+}
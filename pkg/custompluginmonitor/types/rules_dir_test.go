@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestDiscoverRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]struct {
+		content string
+		mode    os.FileMode
+	}{
+		"ntp.sh": {`#!/bin/bash
+# npd: type: permanent
+# npd: condition: NTPProblem
+# npd: reason: NTPIsDown
+# npd: timeout: 10s
+# npd: defaultCondition:
+# npd:   type: NTPProblem
+# npd:   reason: NTPIsUp
+# npd:   message: ntp service is up
+systemctl -q is-active ntp.service
+`, 0755},
+		"disk": {"\x7fELF", 0755},
+		"disk.yaml": {`type: temporary
+reason: DiskSlow
+args: ["--device=sda"]
+`, 0644},
+		"README":     {"# npd: type: temporary\n", 0644},
+		".hidden.sh": {"# npd: type: temporary\n", 0755},
+	}
+	for name, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(file.content), file.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	timeout := "30s"
+	config := CustomPluginConfig{
+		Plugin:             customPluginName,
+		PluginGlobalConfig: pluginGlobalConfig{TimeoutString: &timeout},
+		DefaultConditions:  []types.Condition{{Type: "KernelProblem"}},
+		Rules:              []*CustomRule{{Type: types.Temp, Reason: "KernelOops", Path: "/bin/true"}},
+		RulesDir:           dir,
+	}
+	assert.NoError(t, config.DiscoverRules())
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.ValidateSettings())
+
+	if assert.Len(t, config.Rules, 3) {
+		assert.Equal(t, "KernelOops", config.Rules[0].Reason)
+		disk := config.Rules[1]
+		assert.Equal(t, filepath.Join(dir, "disk"), disk.Path)
+		assert.Equal(t, types.Temp, disk.Type)
+		assert.Equal(t, []string{"--device=sda"}, disk.Args)
+		ntp := config.Rules[2]
+		assert.Equal(t, filepath.Join(dir, "ntp.sh"), ntp.Path)
+		assert.Equal(t, types.Perm, ntp.Type)
+		assert.Equal(t, "NTPProblem", ntp.Condition)
+		assert.Equal(t, "NTPIsDown", ntp.Reason)
+		assert.Equal(t, "10s", ntp.Timeout.String())
+	}
+	assert.Equal(t, []types.Condition{
+		{Type: "KernelProblem"},
+		{Type: "NTPProblem", Reason: "NTPIsUp", Message: "ntp service is up"},
+	}, config.DefaultConditions)
+}
+
+func TestDiscoverRulesErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"no metadata":   "#!/bin/bash\nexit 0\n",
+		"path":          "# npd: type: temporary\n# npd: reason: Check\n# npd: path: /bin/false\n",
+		"no reason":     "# npd: type: temporary\n",
+		"unknown field": "# npd: type: temporary\n# npd: reason: Check\n# npd: reasn: Check\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rules")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(dir, "check.sh"), []byte(content), 0755); err != nil {
+				t.Fatal(err)
+			}
+			config := CustomPluginConfig{RulesDir: dir}
+			assert.Error(t, config.DiscoverRules())
+		})
+	}
+	config := CustomPluginConfig{RulesDir: "/does/not/exist"}
+	assert.Error(t, config.DiscoverRules())
+}
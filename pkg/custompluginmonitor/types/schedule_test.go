@@ -0,0 +1,63 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "a * * * *", "* * * FOO *", "@reboot"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) expected error, got nil", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// 2020-06-01 is a Monday.
+	from := time.Date(2020, 6, 1, 10, 17, 30, 0, time.UTC)
+	testCases := []struct {
+		spec string
+		want time.Time
+	}{
+		{spec: "* * * * *", want: time.Date(2020, 6, 1, 10, 18, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", want: time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC)},
+		{spec: "5/20 * * * *", want: time.Date(2020, 6, 1, 10, 25, 0, 0, time.UTC)},
+		{spec: "@hourly", want: time.Date(2020, 6, 1, 11, 0, 0, 0, time.UTC)},
+		{spec: "0 3 * * *", want: time.Date(2020, 6, 2, 3, 0, 0, 0, time.UTC)},
+		{spec: "0 3 * * SUN", want: time.Date(2020, 6, 7, 3, 0, 0, 0, time.UTC)},
+		{spec: "0 3 * * 7", want: time.Date(2020, 6, 7, 3, 0, 0, 0, time.UTC)},
+		{spec: "30 2 1-7 * 6", want: time.Date(2020, 6, 2, 2, 30, 0, 0, time.UTC)},
+		{spec: "0 0 1 jan,jul *", want: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "@yearly", want: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 30 2 *", want: time.Time{}},
+	}
+	for _, test := range testCases {
+		s, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) unexpected error: %v", test.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(test.want) {
+			t.Errorf("Next(%v) of %q = %v, want %v", from, test.spec, got, test.want)
+		}
+	}
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package types
 
 import (
-	"k8s.io/node-problem-detector/pkg/types"
+	"fmt"
+	"strings"
 	"time"
+
+	"k8s.io/node-problem-detector/pkg/types"
 )
 
 type Status int
@@ -29,15 +32,63 @@ const (
 	Unknown Status = 2
 )
 
+// ParseStatus parses the status name used in configurations, i.e., "ok", "nonok" or "unknown".
+func ParseStatus(s string) (Status, error) {
+	switch strings.ToLower(s) {
+	case "ok":
+		return OK, nil
+	case "nonok":
+		return NonOK, nil
+	case "unknown":
+		return Unknown, nil
+	default:
+		return Unknown, fmt.Errorf("unknown status %q, expected one of \"ok\", \"nonok\" or \"unknown\"", s)
+	}
+}
+
 // Result is the custom plugin check result returned by plugin.
 type Result struct {
 	Rule       *CustomRule
 	ExitStatus Status
-	Message    string
+	// Reason is the reason of the problem, which is the rule reason unless overridden
+	// by the exit code mapping.
+	Reason  string
+	Message string
+	// Labels are the labels reported by a plugin with JSON output, which are attached to
+	// the events of the result as annotations.
+	Labels map[string]string
+}
+
+// OutputFormat is the format of the plugin output.
+type OutputFormat string
+
+const (
+	// TextOutput is plain text output, which is the problem message, while the exit code
+	// is the status.
+	TextOutput OutputFormat = "text"
+	// JSONOutput is a JSON object of the plugin output schema, see the plugin package.
+	JSONOutput OutputFormat = "json"
+)
+
+// ExitCodeMapping maps an exit code of a plugin to a status, and optionally overrides the
+// reason and message of the problem.
+type ExitCodeMapping struct {
+	// ExitCode is the exit code of the plugin.
+	ExitCode int `json:"exitCode"`
+	// StatusString is the status the exit code maps to: "ok", "nonok" or "unknown".
+	StatusString string `json:"status"`
+	// Status is the status the exit code maps to.
+	Status Status `json:"-"`
+	// Reason overrides the reason of the rule when it is not empty.
+	Reason string `json:"reason"`
+	// Message overrides the plugin output as the problem message when it is not empty.
+	Message string `json:"message"`
 }
 
 // CustomRule describes how custom plugin monitor should invoke and analyze plugins.
 type CustomRule struct {
+	// Name is the name of the rule passed to the plugin. Default to the reason.
+	Name string `json:"name"`
 	// Type is the type of the problem.
 	Type types.Type `json:"type"`
 	// Condition is the type of the condition the problem triggered. Notice that
@@ -48,11 +99,110 @@ type CustomRule struct {
 	Reason string `json:"reason"`
 	// Path is the path to the custom plugin.
 	Path string `json:"path"`
-	// Args is the args passed to the custom plugin.
+	// Args is the args passed to the custom plugin. "$(VAR)" is expanded to the value of
+	// the environment variable VAR passed to the plugin, unless it is a secret env.
 	Args []string `json:"args"`
+	// Env is the environment variables passed to the custom plugin, in addition to the
+	// environment of node problem detector and the rule metadata, see RuleEnv.
+	Env map[string]string `json:"env"`
+	// SecretEnv maps environment variables passed to the custom plugin to files whose
+	// content is the value, e.g. mounted Kubernetes secrets. The files are read on each
+	// invocation, so that rotated secrets are picked up.
+	SecretEnv map[string]string `json:"secretEnv"`
 	// Timeout is the timeout string for the custom plugin to execute.
 	TimeoutString *string `json:"timeout"`
 	// Timeout is the timeout for the custom plugin to execute.
 	Timeout *time.Duration `json:"-"`
-	// TODO(andyxning) Add support for per-rule interval.
+	// ExitCodes maps exit codes of the custom plugin to statuses. Exit codes which are
+	// not mapped follow the default convention: 0 is OK, 1 is NonOK, others are Unknown.
+	ExitCodes []*ExitCodeMapping `json:"exitCodes"`
+	// OutputFormat is the format of the plugin output: "text" or "json". Default to "text".
+	// The exit code of a plugin with JSON output is ignored, invalid output is unknown.
+	OutputFormat OutputFormat `json:"outputFormat,omitempty"`
+	// Critical indicates that the rule still runs when the node is overloaded, see
+	// max_load_per_cpu and max_pressure of the plugin config.
+	Critical bool `json:"critical"`
+	// Verification is the check which must pass before the condition of a permanent
+	// problem is cleared. Nil clears the condition as soon as the plugin reports OK.
+	Verification *Verification `json:"verification,omitempty"`
+	// Severity is the severity of the problem: "info", "warning" or "critical". It is the
+	// severity of the events of a temporary problem, default to "warning", and of the
+	// condition set by a permanent problem. It labels the problem metrics when set.
+	Severity types.Severity `json:"severity,omitempty"`
+	// Ownership is the team, escalation and labels of the rule, attached to its events
+	// as annotations and to its problem metrics as labels.
+	types.Ownership
+	// InvokeIntervalString is the interval string at which the rule is invoked instead of
+	// the global invoke interval, e.g. "1h" for an expensive check.
+	InvokeIntervalString *string `json:"invokeInterval,omitempty"`
+	// InvokeInterval is the interval at which the rule is invoked, nil for the global
+	// invoke interval.
+	InvokeInterval *time.Duration `json:"-"`
+	// ScheduleString is the cron expression, in local time, at which the rule is invoked
+	// instead of the global invoke interval, e.g. "0 3 * * SUN". See Schedule.
+	ScheduleString string `json:"schedule,omitempty"`
+	// Schedule is the parsed cron expression, nil when not set.
+	Schedule *Schedule `json:"-"`
+}
+
+// HasOwnSchedule returns whether the rule is invoked at its own interval or schedule
+// instead of the global invoke interval.
+func (r *CustomRule) HasOwnSchedule() bool {
+	return r.InvokeInterval != nil || r.Schedule != nil
+}
+
+// Verification verifies that a permanent problem has recovered, so that its condition is
+// not cleared just because the plugin stopped detecting it. Either Path or Probe is set.
+type Verification struct {
+	// Path is the path to a plugin verifying the recovery, which passes when it exits
+	// with 0.
+	Path string `json:"path,omitempty"`
+	// Args is the args passed to the plugin.
+	Args []string `json:"args,omitempty"`
+	// Probe is a built-in probe verifying the recovery: "tcp://host:port" passes when the
+	// address accepts connections, "http://..." or "https://..." passes when a GET returns
+	// a 2xx or 3xx status code.
+	Probe string `json:"probe,omitempty"`
+	// TimeoutString is the timeout string of the verification.
+	TimeoutString *string `json:"timeout,omitempty"`
+	// Timeout is the timeout of the verification. Default to the timeout of the rule.
+	Timeout *time.Duration `json:"-"`
+}
+
+// The environment variables passing the rule metadata to the custom plugins.
+const (
+	RuleNameEnv      = "NPD_RULE_NAME"
+	RuleReasonEnv    = "NPD_RULE_REASON"
+	RuleTypeEnv      = "NPD_RULE_TYPE"
+	ConditionTypeEnv = "NPD_CONDITION_TYPE"
+	NodeNameEnv      = "NPD_NODE_NAME"
+)
+
+// RuleName returns the name of the rule, which defaults to the reason.
+func (r *CustomRule) RuleName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Reason
+}
+
+// RuleEnv returns the environment variables passing the metadata of the rule.
+func (r *CustomRule) RuleEnv(nodeName string) map[string]string {
+	return map[string]string{
+		RuleNameEnv:      r.RuleName(),
+		RuleReasonEnv:    r.Reason,
+		RuleTypeEnv:      string(r.Type),
+		ConditionTypeEnv: r.Condition,
+		NodeNameEnv:      nodeName,
+	}
+}
+
+// ExitCodeMapping returns the mapping of the exit code, or nil if the exit code is not mapped.
+func (r *CustomRule) ExitCodeMapping(exitCode int) *ExitCodeMapping {
+	for _, mapping := range r.ExitCodes {
+		if mapping.ExitCode == exitCode {
+			return mapping
+		}
+	}
+	return nil
 }
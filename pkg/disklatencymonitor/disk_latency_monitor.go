@@ -0,0 +1,266 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disklatencymonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/shirou/gopsutil/disk"
+
+	dlmtypes "k8s.io/node-problem-detector/pkg/disklatencymonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const DiskLatencyMonitorName = "disk-latency-monitor"
+
+const (
+	normalReason   = "DiskLatencyIsNormal"
+	normalMessage  = "disk latency is within SLO"
+	violatedReason = "DiskLatencyExceedsSLO"
+)
+
+func init() {
+	problemdaemon.Register(DiskLatencyMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewDiskLatencyMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type diskLatencyMonitor struct {
+	configPath string
+	config     dlmtypes.DiskLatencyConfig
+	// ioCounters reads the IO counters of all devices from /proc/diskstats.
+	ioCounters func() (map[string]disk.IOCountersStat, error)
+	// lastCounters is the IO counters of the last sample.
+	lastCounters map[string]disk.IOCountersStat
+	// violations is the number of consecutive intervals each device violates its SLO.
+	violations map[string]int
+	condition  types.Condition
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewDiskLatencyMonitorOrDie creates a disk latency monitor, panics if error occurs.
+func NewDiskLatencyMonitorOrDie(configPath string) types.Monitor {
+	dlm := diskLatencyMonitor{
+		configPath:   configPath,
+		ioCounters:   func() (map[string]disk.IOCountersStat, error) { return disk.IOCounters() },
+		lastCounters: map[string]disk.IOCountersStat{},
+		violations:   map[string]int{},
+		tomb:         tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &dlm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = dlm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = dlm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, dlm.config, err)
+	}
+
+	// A 1000 size channel should be big enough.
+	dlm.statusChan = make(chan *types.Status, 1000)
+
+	if *dlm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(dlm.config.ConditionType)
+	}
+	return &dlm
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for the condition and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, violatedReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			conditionType, violatedReason, err)
+	}
+	err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(violatedReason, 0)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", violatedReason, err)
+	}
+}
+
+func (dlm *diskLatencyMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start disk latency monitor %s", dlm.configPath)
+	problemdaemon.Go(dlm, dlm.monitorLoop)
+	return dlm.statusChan, nil
+}
+
+func (dlm *diskLatencyMonitor) Stop() {
+	glog.Infof("Stop disk latency monitor %s", dlm.configPath)
+	dlm.tomb.Stop()
+}
+
+func (dlm *diskLatencyMonitor) monitorLoop() {
+	defer dlm.tomb.Done()
+
+	runTicker := time.NewTicker(dlm.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	dlm.initializeStatus()
+	// Take the first sample, latency is only known from the next one.
+	dlm.check(time.Now())
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := dlm.check(now); status != nil {
+				dlm.statusChan <- status
+			}
+		case <-dlm.tomb.Stopping():
+			glog.Infof("Disk latency monitor stopped: %s", dlm.configPath)
+			return
+		}
+	}
+}
+
+func (dlm *diskLatencyMonitor) initializeStatus() {
+	dlm.condition = types.Condition{
+		Type:       dlm.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     normalReason,
+		Message:    normalMessage,
+	}
+	dlm.statusChan <- &types.Status{
+		Source:     dlm.config.Source,
+		Conditions: []types.Condition{dlm.condition},
+	}
+}
+
+// check samples the IO counters, and returns a new status if the condition changes.
+func (dlm *diskLatencyMonitor) check(now time.Time) *types.Status {
+	counters, err := dlm.ioCounters()
+	if err != nil {
+		glog.Errorf("Failed to retrieve disk IO counters: %v", err)
+		return nil
+	}
+
+	var violations []string
+	for device, current := range counters {
+		if !dlm.config.DevicePatternRegexp.MatchString(device) {
+			continue
+		}
+		last, ok := dlm.lastCounters[device]
+		dlm.lastCounters[device] = current
+		if !ok {
+			continue
+		}
+		violation := dlm.checkDevice(device, last, current)
+		if violation == "" {
+			delete(dlm.violations, device)
+			continue
+		}
+		dlm.violations[device]++
+		if dlm.violations[device] >= *dlm.config.ConsecutiveViolations {
+			violations = append(violations, violation)
+		}
+	}
+	sort.Strings(violations)
+
+	status, reason, message := types.False, normalReason, normalMessage
+	if len(violations) > 0 {
+		status, reason, message = types.True, violatedReason, strings.Join(violations, "; ")
+	}
+	if status == dlm.condition.Status && message == dlm.condition.Message {
+		return nil
+	}
+
+	var events []types.Event
+	if status != dlm.condition.Status {
+		dlm.condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(dlm.condition.Type, status, reason, now))
+	}
+	dlm.condition.Status = status
+	dlm.condition.Reason = reason
+	dlm.condition.Message = message
+
+	if *dlm.config.EnableMetricsReporting {
+		dlm.updateProblemMetrics(len(events) > 0)
+	}
+	return &types.Status{
+		Source:     dlm.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{dlm.condition},
+	}
+}
+
+func (dlm *diskLatencyMonitor) updateProblemMetrics(transitioned bool) {
+	active := dlm.condition.Status == types.True
+	if active && transitioned {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(violatedReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", violatedReason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(dlm.condition.Type, violatedReason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			dlm.condition.Type, violatedReason, err)
+	}
+}
+
+// checkDevice returns a message describing the SLO violation of the device in the
+// last interval, or an empty string if the SLO is met.
+func (dlm *diskLatencyMonitor) checkDevice(device string, last, current disk.IOCountersStat) string {
+	slo := dlm.config.GetSLO(device)
+	var violations []string
+	if latency, ok := dlm.averageLatency(last.ReadCount, current.ReadCount, last.ReadTime, current.ReadTime); ok &&
+		slo.ReadLatency > 0 && latency > slo.ReadLatency {
+		violations = append(violations, fmt.Sprintf("read latency %v exceeds SLO %v", latency, slo.ReadLatency))
+	}
+	if latency, ok := dlm.averageLatency(last.WriteCount, current.WriteCount, last.WriteTime, current.WriteTime); ok &&
+		slo.WriteLatency > 0 && latency > slo.WriteLatency {
+		violations = append(violations, fmt.Sprintf("write latency %v exceeds SLO %v", latency, slo.WriteLatency))
+	}
+	if len(violations) == 0 {
+		return ""
+	}
+	return device + ": " + strings.Join(violations, ", ")
+}
+
+// averageLatency calculates the average latency of the operations completed in the
+// interval from the operation count and the time spent in ms. It returns false if
+// there are too few operations, or if the counters were reset.
+func (dlm *diskLatencyMonitor) averageLatency(lastCount, count, lastTimeMs, timeMs uint64) (time.Duration, bool) {
+	if count < lastCount || timeMs < lastTimeMs {
+		return 0, false
+	}
+	ops := count - lastCount
+	if ops == 0 || ops < *dlm.config.MinOpsCount {
+		return 0, false
+	}
+	return time.Duration(timeMs-lastTimeMs) * time.Millisecond / time.Duration(ops), true
+}
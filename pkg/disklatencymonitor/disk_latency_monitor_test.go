@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disklatencymonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/stretchr/testify/assert"
+
+	dlmtypes "k8s.io/node-problem-detector/pkg/disklatencymonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func newTestMonitor(t *testing.T, config dlmtypes.DiskLatencyConfig) *diskLatencyMonitor {
+	disabled := false
+	config.EnableMetricsReporting = &disabled
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+
+	dlm := &diskLatencyMonitor{
+		config:       config,
+		lastCounters: map[string]disk.IOCountersStat{},
+		violations:   map[string]int{},
+		statusChan:   make(chan *types.Status, 10),
+	}
+	dlm.initializeStatus()
+	<-dlm.statusChan
+	return dlm
+}
+
+// sample returns the cumulative counters of a device after the given number of reads
+// and writes, each taking the given latency in ms.
+func sample(name string, reads, readLatencyMs, writes, writeLatencyMs uint64) disk.IOCountersStat {
+	return disk.IOCountersStat{
+		Name:       name,
+		ReadCount:  reads,
+		ReadTime:   reads * readLatencyMs,
+		WriteCount: writes,
+		WriteTime:  writes * writeLatencyMs,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	two := 2
+	config := dlmtypes.DiskLatencyConfig{
+		SLO:                   dlmtypes.LatencySLO{ReadLatencyString: "100ms", WriteLatencyString: "200ms"},
+		DeviceSLOs:            map[string]*dlmtypes.LatencySLO{"sdb": {ReadLatencyString: "10ms"}},
+		ConsecutiveViolations: &two,
+	}
+	idle := map[string]disk.IOCountersStat{"sda": sample("sda", 100, 150, 0, 0), "sdb": sample("sdb", 100, 20, 0, 0)}
+	slowReads := map[string]disk.IOCountersStat{"sda": sample("sda", 200, 150, 0, 0), "sdb": sample("sdb", 100, 20, 0, 0)}
+	sdaViolation := "sda: read latency 150ms exceeds SLO 100ms"
+
+	for _, test := range []struct {
+		desc string
+		// violated is the initial message of the condition, empty if it is not violated.
+		violated   string
+		violations map[string]int
+		last       map[string]disk.IOCountersStat
+		current    map[string]disk.IOCountersStat
+		// expected is the message of the condition reported, empty if no status is reported.
+		expected string
+		events   int
+	}{
+		{
+			desc:    "the first sample of a device only records its counters",
+			current: slowReads,
+		},
+		{
+			desc:    "a single violation does not set the condition",
+			last:    idle,
+			current: slowReads,
+		},
+		{
+			desc:       "consecutive violations set the condition",
+			violations: map[string]int{"sda": 1},
+			last:       idle,
+			current:    slowReads,
+			expected:   sdaViolation,
+			events:     1,
+		},
+		{
+			desc:       "the device SLO overrides the default SLO",
+			violations: map[string]int{"sdb": 1},
+			last:       map[string]disk.IOCountersStat{"sdb": sample("sdb", 0, 0, 0, 0)},
+			current:    map[string]disk.IOCountersStat{"sdb": sample("sdb", 100, 20, 0, 0)},
+			expected:   "sdb: read latency 20ms exceeds SLO 10ms",
+			events:     1,
+		},
+		{
+			desc:       "read and write violations of a device are reported together",
+			violations: map[string]int{"sda": 1},
+			last:       map[string]disk.IOCountersStat{"sda": sample("sda", 0, 0, 0, 0)},
+			current:    map[string]disk.IOCountersStat{"sda": sample("sda", 100, 150, 100, 300)},
+			expected:   "sda: read latency 150ms exceeds SLO 100ms, write latency 300ms exceeds SLO 200ms",
+			events:     1,
+		},
+		{
+			desc:       "devices not matching the device pattern are ignored",
+			violations: map[string]int{"sda1": 1},
+			last:       map[string]disk.IOCountersStat{"sda1": sample("sda1", 0, 0, 0, 0)},
+			current:    map[string]disk.IOCountersStat{"sda1": sample("sda1", 100, 500, 0, 0)},
+		},
+		{
+			desc:       "intervals with too few operations are ignored",
+			violations: map[string]int{"sda": 1},
+			last:       map[string]disk.IOCountersStat{"sda": sample("sda", 0, 0, 0, 0)},
+			current:    map[string]disk.IOCountersStat{"sda": sample("sda", 5, 150, 0, 0)},
+		},
+		{
+			desc:       "reset counters are ignored",
+			violations: map[string]int{"sda": 1},
+			last:       slowReads,
+			current:    idle,
+		},
+		{
+			desc:       "another violating device changes the message without an event",
+			violated:   sdaViolation,
+			violations: map[string]int{"sda": 2, "sdb": 1},
+			last:       map[string]disk.IOCountersStat{"sda": sample("sda", 0, 0, 0, 0), "sdb": sample("sdb", 0, 0, 0, 0)},
+			current:    map[string]disk.IOCountersStat{"sda": sample("sda", 100, 150, 0, 0), "sdb": sample("sdb", 100, 20, 0, 0)},
+			expected:   sdaViolation + "; sdb: read latency 20ms exceeds SLO 10ms",
+		},
+		{
+			desc:       "the condition recovers once the SLO is met",
+			violated:   sdaViolation,
+			violations: map[string]int{"sda": 2},
+			last:       map[string]disk.IOCountersStat{"sda": sample("sda", 0, 0, 0, 0)},
+			current:    map[string]disk.IOCountersStat{"sda": sample("sda", 100, 50, 0, 0)},
+			expected:   normalMessage,
+			events:     1,
+		},
+	} {
+		dlm := newTestMonitor(t, config)
+		if test.violated != "" {
+			dlm.condition.Status = types.True
+			dlm.condition.Reason = violatedReason
+			dlm.condition.Message = test.violated
+		}
+		for device, count := range test.violations {
+			dlm.violations[device] = count
+		}
+		for device, counters := range test.last {
+			dlm.lastCounters[device] = counters
+		}
+		dlm.ioCounters = func() (map[string]disk.IOCountersStat, error) { return test.current, nil }
+
+		status := dlm.check(time.Now())
+		if test.expected == "" {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if !assert.NotNil(t, status, test.desc) {
+			continue
+		}
+		assert.Len(t, status.Events, test.events, test.desc)
+		condition := status.Conditions[0]
+		assert.Equal(t, test.expected, condition.Message, test.desc)
+		if test.expected == normalMessage {
+			assert.Equal(t, types.False, condition.Status, test.desc)
+			assert.Equal(t, normalReason, condition.Reason, test.desc)
+		} else {
+			assert.Equal(t, types.True, condition.Status, test.desc)
+			assert.Equal(t, violatedReason, condition.Reason, test.desc)
+		}
+	}
+}
+
+func TestAverageLatency(t *testing.T) {
+	dlm := newTestMonitor(t, dlmtypes.DiskLatencyConfig{})
+
+	for _, test := range []struct {
+		desc                                 string
+		lastCount, count, lastTimeMs, timeMs uint64
+		latency                              time.Duration
+		ok                                   bool
+	}{
+		{
+			desc:    "average of the operations completed in the interval",
+			count:   20,
+			timeMs:  100,
+			latency: 5 * time.Millisecond,
+			ok:      true,
+		},
+		{
+			desc:   "too few operations",
+			count:  5,
+			timeMs: 100,
+		},
+		{
+			desc:      "reset operation count",
+			lastCount: 100,
+			count:     20,
+			timeMs:    100,
+		},
+		{
+			desc:       "reset time",
+			count:      20,
+			lastTimeMs: 200,
+			timeMs:     100,
+		},
+	} {
+		latency, ok := dlm.averageLatency(test.lastCount, test.count, test.lastTimeMs, test.timeMs)
+		assert.Equal(t, test.ok, ok, test.desc)
+		assert.Equal(t, test.latency, latency, test.desc)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	defaultSource                = "disk-latency-monitor"
+	defaultInvokeIntervalString  = (60 * time.Second).String()
+	defaultDevicePattern         = "^(sd[a-z]+|vd[a-z]+|xvd[a-z]+|nvme[0-9]+n[0-9]+)$"
+	defaultMinOpsCount           = uint64(10)
+	defaultConsecutiveViolations = 3
+	defaultEnableMetrics         = true
+	defaultConditionType         = "DiskLatencyHigh"
+)
+
+// LatencySLO is the latency SLO of a device.
+type LatencySLO struct {
+	// ReadLatencyString is the maximum average latency of read operations, e.g. "100ms".
+	// Empty means no SLO on reads.
+	ReadLatencyString string        `json:"readLatency"`
+	ReadLatency       time.Duration `json:"-"`
+	// WriteLatencyString is the maximum average latency of write operations. Empty means
+	// no SLO on writes.
+	WriteLatencyString string        `json:"writeLatency"`
+	WriteLatency       time.Duration `json:"-"`
+}
+
+type DiskLatencyConfig struct {
+	// Source is the source name of the disk latency monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which /proc/diskstats is sampled. The
+	// latency is averaged over the interval.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// DevicePattern selects the devices to monitor by name, e.g. "sda". Default to
+	// whole disks, excluding partitions.
+	DevicePattern       string         `json:"devicePattern"`
+	DevicePatternRegexp *regexp.Regexp `json:"-"`
+	// SLO is the default SLO of all devices.
+	SLO LatencySLO `json:"slo"`
+	// DeviceSLOs overrides the SLO of specific devices, keyed by device name.
+	DeviceSLOs map[string]*LatencySLO `json:"deviceSLOs"`
+	// MinOpsCount is the minimum number of operations in an interval for the latency to
+	// be checked, so that a few slow operations on an idle device are ignored.
+	MinOpsCount *uint64 `json:"minOpsCount,omitempty"`
+	// ConsecutiveViolations is the number of consecutive intervals violating the SLO
+	// before the condition is set.
+	ConsecutiveViolations *int `json:"consecutiveViolations,omitempty"`
+	// ConditionType is the type of the condition. Default to "DiskLatencyHigh".
+	ConditionType string `json:"conditionType"`
+	// EnableMetricsReporting describes whether to count the latency SLO violations and
+	// report the condition as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (dlc *DiskLatencyConfig) ApplyConfiguration() error {
+	if dlc.Source == "" {
+		dlc.Source = defaultSource
+	}
+	if dlc.InvokeIntervalString == "" {
+		dlc.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if dlc.DevicePattern == "" {
+		dlc.DevicePattern = defaultDevicePattern
+	}
+	if dlc.MinOpsCount == nil {
+		dlc.MinOpsCount = &defaultMinOpsCount
+	}
+	if dlc.ConsecutiveViolations == nil {
+		dlc.ConsecutiveViolations = &defaultConsecutiveViolations
+	}
+	if dlc.ConditionType == "" {
+		dlc.ConditionType = defaultConditionType
+	}
+	if dlc.EnableMetricsReporting == nil {
+		dlc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	dlc.InvokeInterval, err = time.ParseDuration(dlc.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", dlc.InvokeIntervalString, err)
+	}
+	dlc.DevicePatternRegexp, err = regexp.Compile(dlc.DevicePattern)
+	if err != nil {
+		return fmt.Errorf("error in compiling DevicePattern %q: %v", dlc.DevicePattern, err)
+	}
+	if err := dlc.SLO.applyConfiguration(); err != nil {
+		return err
+	}
+	for device, slo := range dlc.DeviceSLOs {
+		if err := slo.applyConfiguration(); err != nil {
+			return fmt.Errorf("error in SLO of device %q: %v", device, err)
+		}
+	}
+	return nil
+}
+
+func (s *LatencySLO) applyConfiguration() error {
+	var err error
+	if s.ReadLatencyString != "" {
+		s.ReadLatency, err = time.ParseDuration(s.ReadLatencyString)
+		if err != nil {
+			return fmt.Errorf("error in parsing ReadLatencyString %q: %v", s.ReadLatencyString, err)
+		}
+	}
+	if s.WriteLatencyString != "" {
+		s.WriteLatency, err = time.ParseDuration(s.WriteLatencyString)
+		if err != nil {
+			return fmt.Errorf("error in parsing WriteLatencyString %q: %v", s.WriteLatencyString, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (dlc *DiskLatencyConfig) Validate() error {
+	if dlc.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", dlc.InvokeInterval)
+	}
+	if *dlc.ConsecutiveViolations <= 0 {
+		return fmt.Errorf("ConsecutiveViolations %d must be above 0", *dlc.ConsecutiveViolations)
+	}
+	if dlc.SLO.ReadLatency < 0 || dlc.SLO.WriteLatency < 0 {
+		return fmt.Errorf("SLO %+v must not be negative", dlc.SLO)
+	}
+	for device, slo := range dlc.DeviceSLOs {
+		if slo.ReadLatency < 0 || slo.WriteLatency < 0 {
+			return fmt.Errorf("SLO %+v of device %q must not be negative", *slo, device)
+		}
+	}
+	return nil
+}
+
+// GetSLO returns the SLO of the device.
+func (dlc *DiskLatencyConfig) GetSLO(device string) LatencySLO {
+	if slo, ok := dlc.DeviceSLOs[device]; ok {
+		return *slo
+	}
+	return dlc.SLO
+}
@@ -0,0 +1,426 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskusagemonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/shirou/gopsutil/disk"
+	"gopkg.in/fsnotify.v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	dutypes "k8s.io/node-problem-detector/pkg/diskusagemonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const DiskUsageMonitorName = "disk-usage-monitor"
+
+func init() {
+	problemdaemon.Register(DiskUsageMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewDiskUsageMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+// usageKind is a kind of usage of a filesystem with its own condition.
+type usageKind int
+
+const (
+	spaceUsage usageKind = iota
+	inodesUsage
+)
+
+// kindReasons are the reasons and the healthy message of the condition of each kind of
+// usage.
+var kindReasons = []struct {
+	lowReason      string
+	healthyReason  string
+	healthyMessage string
+}{
+	spaceUsage:  {lowReason: "DiskSpaceIsLow", healthyReason: "DiskHasEnoughSpace", healthyMessage: "filesystems have enough space"},
+	inodesUsage: {lowReason: "DiskInodesAreLow", healthyReason: "DiskHasEnoughInodes", healthyMessage: "filesystems have enough inodes"},
+}
+
+// exceededKey is a kind of usage of a mountpoint.
+type exceededKey struct {
+	mountpoint string
+	kind       usageKind
+}
+
+type diskUsageMonitor struct {
+	configPath string
+	config     dutypes.DiskUsageConfig
+	// partitions lists the mounted filesystems with a device.
+	partitions func() ([]disk.PartitionStat, error)
+	// usage reads the usage of the filesystem of a path.
+	usage func(path string) (*disk.UsageStat, error)
+	// exceeded records since when the thresholds of each kind of usage of each mountpoint
+	// are exceeded.
+	exceeded map[exceededKey]time.Time
+	// conditions are the conditions of the kinds of usage.
+	conditions []types.Condition
+	lastCheck  time.Time
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewDiskUsageMonitorOrDie creates a disk usage monitor, panics if error occurs.
+func NewDiskUsageMonitorOrDie(configPath string) types.Monitor {
+	dum := diskUsageMonitor{
+		configPath: configPath,
+		partitions: func() ([]disk.PartitionStat, error) { return disk.Partitions(false) },
+		usage:      disk.Usage,
+		exceeded:   map[exceededKey]time.Time{},
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &dum.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = dum.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = dum.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, dum.config, err)
+	}
+
+	// A 1000 size channel should be big enough.
+	dum.statusChan = make(chan *types.Status, 1000)
+
+	if *dum.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(dum.conditionTypes())
+	}
+	return &dum
+}
+
+// conditionTypes returns the condition type of each kind of usage.
+func (dum *diskUsageMonitor) conditionTypes() []string {
+	return []string{
+		spaceUsage:  dum.config.SpaceConditionType,
+		inodesUsage: dum.config.InodesConditionType,
+	}
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for the conditions and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionTypes []string) {
+	for r, conditionType := range conditionTypes {
+		reason := kindReasons[r].lowReason
+		err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, reason, false)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+				conditionType, reason, err)
+		}
+		err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+		}
+	}
+}
+
+func (dum *diskUsageMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start disk usage monitor %s", dum.configPath)
+	watcher := dum.watch()
+	problemdaemon.Go(dum, func() { dum.monitorLoop(watcher) })
+	return dum.statusChan, nil
+}
+
+func (dum *diskUsageMonitor) Stop() {
+	glog.Infof("Stop disk usage monitor %s", dum.configPath)
+	dum.tomb.Stop()
+}
+
+// watch watches the watch paths with inotify, and returns nil if none can be watched.
+// The paths which can not be watched, e.g. because they do not exist yet, are only
+// checked periodically.
+func (dum *diskUsageMonitor) watch() *fsnotify.Watcher {
+	if len(dum.config.WatchPaths) == 0 {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		glog.Errorf("Failed to create inotify watcher, filesystems are only checked every %v: %v", dum.config.InvokeInterval, err)
+		return nil
+	}
+	watched := 0
+	for _, path := range dum.config.WatchPaths {
+		if err := watcher.Add(path); err != nil {
+			glog.Errorf("Failed to watch %q, it is only checked every %v: %v", path, dum.config.InvokeInterval, err)
+			continue
+		}
+		watched++
+	}
+	if watched == 0 {
+		watcher.Close()
+		return nil
+	}
+	return watcher
+}
+
+func (dum *diskUsageMonitor) monitorLoop(watcher *fsnotify.Watcher) {
+	defer dum.tomb.Done()
+
+	runTicker := time.NewTicker(dum.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if watcher != nil {
+		defer watcher.Close()
+		events, watchErrors = watcher.Events, watcher.Errors
+	}
+	// triggered fires the check triggered by the inotify events, at most once per
+	// minimum check interval.
+	var triggered <-chan time.Time
+
+	dum.initializeStatus()
+	if status := dum.check(time.Now()); status != nil {
+		dum.statusChan <- status
+	}
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := dum.check(now); status != nil {
+				dum.statusChan <- status
+			}
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 || triggered != nil {
+				continue
+			}
+			delay := dum.config.MinCheckInterval - time.Since(dum.lastCheck)
+			if delay < 0 {
+				delay = 0
+			}
+			triggered = time.After(delay)
+		case now := <-triggered:
+			triggered = nil
+			if status := dum.check(now); status != nil {
+				dum.statusChan <- status
+			}
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			glog.Errorf("Failed to watch disk usage: %v", err)
+		case <-dum.tomb.Stopping():
+			glog.Infof("Disk usage monitor stopped: %s", dum.configPath)
+			return
+		}
+	}
+}
+
+func (dum *diskUsageMonitor) initializeStatus() {
+	now := time.Now()
+	for r, conditionType := range dum.conditionTypes() {
+		dum.conditions = append(dum.conditions, types.Condition{
+			Type:       conditionType,
+			Status:     types.False,
+			Transition: now,
+			Reason:     kindReasons[r].healthyReason,
+			Message:    kindReasons[r].healthyMessage,
+		})
+	}
+	dum.statusChan <- &types.Status{
+		Source:     dum.config.Source,
+		Conditions: append([]types.Condition{}, dum.conditions...),
+	}
+}
+
+// mountpoints returns the mountpoints to check: the mountpoints of the filesystems not
+// excluded, and the mountpoints with thresholds.
+func (dum *diskUsageMonitor) mountpoints(partitions []disk.PartitionStat) []string {
+	set := map[string]bool{}
+	for _, p := range partitions {
+		if !dum.config.IsExcluded(p.Fstype) {
+			set[p.Mountpoint] = true
+		}
+	}
+	for mountpoint := range dum.config.MountThresholds {
+		set[mountpoint] = true
+	}
+	var mountpoints []string
+	for mountpoint := range set {
+		mountpoints = append(mountpoints, mountpoint)
+	}
+	sort.Strings(mountpoints)
+	return mountpoints
+}
+
+// check reads the usage of the filesystems, and returns a new status if a condition
+// changes. A condition is set when the thresholds of its kind of usage are exceeded on a
+// filesystem for the grace period.
+func (dum *diskUsageMonitor) check(now time.Time) *types.Status {
+	dum.lastCheck = time.Now()
+	partitions, err := dum.partitions()
+	if err != nil {
+		glog.Errorf("Failed to list the mounted filesystems: %v", err)
+		return nil
+	}
+
+	violations := make([][]string, len(kindReasons))
+	checked := map[exceededKey]bool{}
+	for _, mountpoint := range dum.mountpoints(partitions) {
+		usage, err := dum.usage(mountpoint)
+		if err != nil {
+			glog.Errorf("Failed to read the usage of %q: %v", mountpoint, err)
+			// The thresholds stay exceeded until the usage can be read again.
+			checked[exceededKey{mountpoint, spaceUsage}] = true
+			checked[exceededKey{mountpoint, inodesUsage}] = true
+			continue
+		}
+		thresholds := dum.config.GetThresholds(mountpoint)
+		for r, violation := range []string{
+			spaceUsage:  spaceViolation(usage, thresholds),
+			inodesUsage: inodesViolation(usage, thresholds),
+		} {
+			key := exceededKey{mountpoint, usageKind(r)}
+			if violation == "" {
+				continue
+			}
+			checked[key] = true
+			since, ok := dum.exceeded[key]
+			if !ok {
+				since = now
+				dum.exceeded[key] = now
+			}
+			if now.Sub(since) >= thresholds.GracePeriod {
+				violations[r] = append(violations[r], mountpoint+": "+violation)
+			}
+		}
+	}
+	for key := range dum.exceeded {
+		if !checked[key] {
+			delete(dum.exceeded, key)
+		}
+	}
+
+	var events []types.Event
+	changed := false
+	for r := range dum.conditions {
+		event, updated := dum.updateCondition(usageKind(r), violations[r], now)
+		if event != nil {
+			events = append(events, *event)
+		}
+		changed = changed || updated
+	}
+	if !changed {
+		return nil
+	}
+	return &types.Status{
+		Source:     dum.config.Source,
+		Events:     events,
+		Conditions: append([]types.Condition{}, dum.conditions...),
+	}
+}
+
+// updateCondition updates the condition of the kind of usage with the violations, and
+// returns the event of its transition, and whether it changed.
+func (dum *diskUsageMonitor) updateCondition(r usageKind, violations []string, now time.Time) (*types.Event, bool) {
+	condition := &dum.conditions[r]
+	status, reason, message := types.False, kindReasons[r].healthyReason, kindReasons[r].healthyMessage
+	if len(violations) > 0 {
+		status, reason, message = types.True, kindReasons[r].lowReason, strings.Join(violations, "; ")
+	}
+	if status == condition.Status && message == condition.Message {
+		return nil, false
+	}
+
+	var event *types.Event
+	transitioned := status != condition.Status
+	if transitioned {
+		condition.Transition = now
+		e := util.GenerateConditionChangeEvent(condition.Type, status, reason, now)
+		event = &e
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+
+	if *dum.config.EnableMetricsReporting {
+		dum.updateProblemMetrics(r, transitioned)
+	}
+	return event, true
+}
+
+func (dum *diskUsageMonitor) updateProblemMetrics(r usageKind, transitioned bool) {
+	condition := dum.conditions[r]
+	reason := kindReasons[r].lowReason
+	active := condition.Status == types.True
+	if active && transitioned {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", reason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(condition.Type, reason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			condition.Type, reason, err)
+	}
+}
+
+// spaceViolation returns a message describing the space thresholds the usage exceeds, or
+// an empty string if it exceeds none.
+func spaceViolation(usage *disk.UsageStat, t dutypes.Thresholds) string {
+	var violations []string
+	if t.MaxUsedPercent != nil && *t.MaxUsedPercent > 0 && usage.UsedPercent > *t.MaxUsedPercent {
+		violations = append(violations, fmt.Sprintf("%.1f%% used is above %v%%", usage.UsedPercent, *t.MaxUsedPercent))
+	}
+	if t.MinAvailable > 0 && int64(usage.Free) < t.MinAvailable {
+		violations = append(violations, fmt.Sprintf("%s available is below %s",
+			resource.NewQuantity(int64(usage.Free), resource.BinarySI), t.MinAvailableString))
+	}
+	return strings.Join(violations, ", ")
+}
+
+// inodesViolation returns a message describing the inode thresholds the usage exceeds, or
+// an empty string if it exceeds none. The filesystems without a fixed number of inodes,
+// e.g. btrfs, report none and are never checked.
+func inodesViolation(usage *disk.UsageStat, t dutypes.Thresholds) string {
+	if usage.InodesTotal == 0 {
+		return ""
+	}
+	var violations []string
+	if t.MaxInodesUsedPercent != nil && *t.MaxInodesUsedPercent > 0 && usage.InodesUsedPercent > *t.MaxInodesUsedPercent {
+		violations = append(violations, fmt.Sprintf("%.1f%% of inodes used is above %v%%", usage.InodesUsedPercent, *t.MaxInodesUsedPercent))
+	}
+	if t.MinInodesFree != nil && *t.MinInodesFree > 0 && usage.InodesFree < *t.MinInodesFree {
+		violations = append(violations, fmt.Sprintf("%d inodes free is below %d", usage.InodesFree, *t.MinInodesFree))
+	}
+	return strings.Join(violations, ", ")
+}
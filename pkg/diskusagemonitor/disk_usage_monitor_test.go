@@ -0,0 +1,241 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskusagemonitor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/stretchr/testify/assert"
+
+	dutypes "k8s.io/node-problem-detector/pkg/diskusagemonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const gi = 1 << 30
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(DiskUsageMonitorName) },
+		"Disk usage monitor failed to register itself as a problem daemon.")
+}
+
+func newTestMonitor(t *testing.T, usages map[string]*disk.UsageStat) *diskUsageMonitor {
+	disabled := false
+	zero := 0.0
+	config := dutypes.DiskUsageConfig{
+		MountThresholds: map[string]*dutypes.Thresholds{
+			// The kubelet evicts pods below 10% available, warn earlier with more room.
+			"/var/lib/kubelet": {MaxUsedPercent: &zero, MinAvailableString: "20Gi", GracePeriodString: "0s"},
+		},
+		EnableMetricsReporting: &disabled,
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+
+	partitions := []disk.PartitionStat{
+		{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+		{Device: "/dev/sdb1", Mountpoint: "/var/lib/kubelet", Fstype: "xfs"},
+		{Device: "/dev/loop0", Mountpoint: "/snap/core", Fstype: "squashfs"},
+	}
+	dum := &diskUsageMonitor{
+		config:     config,
+		partitions: func() ([]disk.PartitionStat, error) { return partitions, nil },
+		usage: func(path string) (*disk.UsageStat, error) {
+			if usage, ok := usages[path]; ok {
+				return usage, nil
+			}
+			return nil, errors.New("no such filesystem")
+		},
+		exceeded:   map[exceededKey]time.Time{},
+		statusChan: make(chan *types.Status, 10),
+	}
+	dum.initializeStatus()
+	<-dum.statusChan
+	return dum
+}
+
+// usage returns the usage of a filesystem of 100Gi and 1M inodes.
+func usage(usedGi uint64, inodesUsed uint64) *disk.UsageStat {
+	return &disk.UsageStat{
+		Total:             100 * gi,
+		Used:              usedGi * gi,
+		Free:              (100 - usedGi) * gi,
+		UsedPercent:       float64(usedGi),
+		InodesTotal:       1000000,
+		InodesUsed:        inodesUsed,
+		InodesFree:        1000000 - inodesUsed,
+		InodesUsedPercent: float64(inodesUsed) / 10000,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	const kubeletLow = "/var/lib/kubelet: 15Gi available is below 20Gi"
+	now := time.Now()
+	for _, test := range []struct {
+		desc   string
+		usages map[string]*disk.UsageStat
+		// exceeded records how long ago the thresholds were first exceeded.
+		exceeded map[exceededKey]time.Duration
+		// violated are the messages of the space and inodes conditions before the check,
+		// empty if the condition is not set.
+		violated [2]string
+		// expected are the expected messages of the space and inodes conditions, nil if no
+		// status is expected.
+		expected []string
+		events   []string
+		// remaining is the number of thresholds still exceeded after the check.
+		remaining int
+	}{
+		{
+			desc: "excluded filesystems are not checked",
+			usages: map[string]*disk.UsageStat{
+				"/":                usage(50, 1000),
+				"/var/lib/kubelet": usage(50, 1000),
+				"/snap/core":       usage(100, 1000000),
+			},
+		},
+		{
+			desc: "filesystem without grace period",
+			usages: map[string]*disk.UsageStat{
+				"/":                usage(50, 1000),
+				"/var/lib/kubelet": usage(85, 1000),
+			},
+			expected:  []string{kubeletLow, "filesystems have enough inodes"},
+			events:    []string{"DiskSpaceIsLow"},
+			remaining: 1,
+		},
+		{
+			desc: "filesystem within the default grace period",
+			usages: map[string]*disk.UsageStat{
+				"/":                usage(90, 1000),
+				"/var/lib/kubelet": usage(50, 1000),
+			},
+			exceeded:  map[exceededKey]time.Duration{{"/", spaceUsage}: time.Minute},
+			remaining: 1,
+		},
+		{
+			desc: "space low for the default grace period",
+			usages: map[string]*disk.UsageStat{
+				"/":                usage(90, 1000),
+				"/var/lib/kubelet": usage(50, 1000),
+			},
+			exceeded:  map[exceededKey]time.Duration{{"/", spaceUsage}: 2 * time.Minute},
+			expected:  []string{"/: 90.0% used is above 85%", "filesystems have enough inodes"},
+			events:    []string{"DiskSpaceIsLow"},
+			remaining: 1,
+		},
+		{
+			desc: "inodes low for the default grace period",
+			usages: map[string]*disk.UsageStat{
+				"/":                usage(50, 950000),
+				"/var/lib/kubelet": usage(50, 1000),
+			},
+			exceeded:  map[exceededKey]time.Duration{{"/", inodesUsage}: 2 * time.Minute},
+			expected:  []string{"filesystems have enough space", "/: 95.0% of inodes used is above 90%"},
+			events:    []string{"DiskInodesAreLow"},
+			remaining: 1,
+		},
+		{
+			desc: "another filesystem low updates the message without an event",
+			usages: map[string]*disk.UsageStat{
+				"/":                usage(90, 1000),
+				"/var/lib/kubelet": usage(85, 1000),
+			},
+			exceeded: map[exceededKey]time.Duration{
+				{"/", spaceUsage}:                2 * time.Minute,
+				{"/var/lib/kubelet", spaceUsage}: 2 * time.Minute,
+			},
+			violated:  [2]string{kubeletLow, ""},
+			expected:  []string{"/: 90.0% used is above 85%; " + kubeletLow, "filesystems have enough inodes"},
+			remaining: 2,
+		},
+		{
+			desc: "filesystems cleaned up",
+			usages: map[string]*disk.UsageStat{
+				"/":                usage(50, 1000),
+				"/var/lib/kubelet": usage(50, 1000),
+			},
+			exceeded: map[exceededKey]time.Duration{
+				{"/", inodesUsage}:               time.Hour,
+				{"/var/lib/kubelet", spaceUsage}: time.Hour,
+			},
+			violated: [2]string{kubeletLow, "/: 95.0% of inodes used is above 90%"},
+			expected: []string{"filesystems have enough space", "filesystems have enough inodes"},
+			events:   []string{"DiskHasEnoughSpace", "DiskHasEnoughInodes"},
+		},
+		{
+			desc: "spike cleaned up within the grace period resets it",
+			usages: map[string]*disk.UsageStat{
+				"/":                usage(50, 1000),
+				"/var/lib/kubelet": usage(50, 1000),
+			},
+			exceeded: map[exceededKey]time.Duration{{"/", spaceUsage}: time.Minute},
+		},
+		{
+			desc: "usage which can not be read keeps the grace period running",
+			usages: map[string]*disk.UsageStat{
+				"/var/lib/kubelet": usage(50, 1000),
+			},
+			exceeded:  map[exceededKey]time.Duration{{"/", spaceUsage}: time.Minute},
+			remaining: 1,
+		},
+	} {
+		dum := newTestMonitor(t, test.usages)
+		for key, ago := range test.exceeded {
+			dum.exceeded[key] = now.Add(-ago)
+		}
+		for r, message := range test.violated {
+			if message != "" {
+				dum.conditions[r].Status = types.True
+				dum.conditions[r].Reason = kindReasons[r].lowReason
+				dum.conditions[r].Message = message
+			}
+		}
+
+		status := dum.check(now)
+		assert.Len(t, dum.exceeded, test.remaining, test.desc)
+		if test.expected == nil {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if !assert.NotNil(t, status, test.desc) {
+			continue
+		}
+		for r, message := range test.expected {
+			assert.Equal(t, message, status.Conditions[r].Message, test.desc)
+			expected := types.False
+			if message != kindReasons[r].healthyMessage {
+				expected = types.True
+			}
+			assert.Equal(t, expected, status.Conditions[r].Status, test.desc)
+		}
+		var reasons []string
+		for _, event := range status.Events {
+			reasons = append(reasons, event.Reason)
+		}
+		assert.Equal(t, test.events, reasons, test.desc)
+	}
+}
+
+func TestInodesViolationWithoutInodes(t *testing.T) {
+	// btrfs reports no inodes.
+	assert.Empty(t, inodesViolation(&disk.UsageStat{}, dutypes.Thresholds{}))
+}
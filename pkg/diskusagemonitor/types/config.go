@@ -0,0 +1,249 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	defaultSource                 = "disk-usage-monitor"
+	defaultInvokeIntervalString   = (60 * time.Second).String()
+	defaultMinCheckIntervalString = (10 * time.Second).String()
+	defaultExcludedFilesystems    = []string{"squashfs", "iso9660"}
+	defaultMaxUsedPercent         = 85.0
+	defaultMaxInodesUsedPercent   = 90.0
+	defaultGracePeriodString      = (2 * time.Minute).String()
+	defaultEnableMetrics          = true
+	defaultSpaceConditionType     = "DiskSpaceLow"
+	defaultInodesConditionType    = "DiskInodesLow"
+)
+
+// Thresholds are the usage thresholds of a filesystem. A threshold of 0 is disabled.
+type Thresholds struct {
+	// MaxUsedPercent is the percentage of the space used above which the space is low.
+	MaxUsedPercent *float64 `json:"maxUsedPercent,omitempty"`
+	// MinAvailableString is the space available to unprivileged users below which the
+	// space is low, e.g. "10Gi".
+	MinAvailableString string `json:"minAvailable"`
+	MinAvailable       int64  `json:"-"`
+	// MaxInodesUsedPercent is the percentage of the inodes used above which the inodes
+	// are low.
+	MaxInodesUsedPercent *float64 `json:"maxInodesUsedPercent,omitempty"`
+	// MinInodesFree is the number of free inodes below which the inodes are low.
+	MinInodesFree *uint64 `json:"minInodesFree,omitempty"`
+	// GracePeriodString is how long a threshold must be exceeded before the condition is
+	// set, so that short spikes, e.g. a large download cleaned up right away, are ignored.
+	GracePeriodString string        `json:"gracePeriod"`
+	GracePeriod       time.Duration `json:"-"`
+}
+
+type DiskUsageConfig struct {
+	// Source is the source name of the disk usage monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which the usage of the filesystems is checked.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// MinCheckIntervalString is the minimum interval between the checks triggered by the
+	// inotify events of the watched paths.
+	MinCheckIntervalString string        `json:"minCheckInterval"`
+	MinCheckInterval       time.Duration `json:"-"`
+	// ExcludedFilesystems are the filesystem types which are not checked, e.g. read-only
+	// images which are always full. The filesystems without a device, e.g. tmpfs, are never
+	// checked unless their mountpoint has thresholds.
+	ExcludedFilesystems []string `json:"excludedFilesystems"`
+	// Thresholds are the default thresholds of all filesystems.
+	Thresholds Thresholds `json:"thresholds"`
+	// MountThresholds overrides the thresholds of specific mountpoints, keyed by
+	// mountpoint. The thresholds not set are inherited from the default thresholds. The
+	// mountpoints are checked even if their filesystems are excluded.
+	MountThresholds map[string]*Thresholds `json:"mountThresholds"`
+	// WatchPaths are the directories whose changes trigger a check right away, e.g. the
+	// directories the pod logs are written to. Default to the mountpoints with thresholds.
+	WatchPaths []string `json:"watchPaths"`
+	// SpaceConditionType is the type of the condition of low space. Default to
+	// "DiskSpaceLow".
+	SpaceConditionType string `json:"spaceConditionType"`
+	// InodesConditionType is the type of the condition of low inodes. Default to
+	// "DiskInodesLow".
+	InodesConditionType string `json:"inodesConditionType"`
+	// EnableMetricsReporting describes whether to report the low space and low inodes
+	// conditions of the filesystems as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (duc *DiskUsageConfig) ApplyConfiguration() error {
+	if duc.Source == "" {
+		duc.Source = defaultSource
+	}
+	if duc.InvokeIntervalString == "" {
+		duc.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if duc.MinCheckIntervalString == "" {
+		duc.MinCheckIntervalString = defaultMinCheckIntervalString
+	}
+	if duc.ExcludedFilesystems == nil {
+		duc.ExcludedFilesystems = defaultExcludedFilesystems
+	}
+	if duc.Thresholds.MaxUsedPercent == nil {
+		duc.Thresholds.MaxUsedPercent = &defaultMaxUsedPercent
+	}
+	if duc.Thresholds.MaxInodesUsedPercent == nil {
+		duc.Thresholds.MaxInodesUsedPercent = &defaultMaxInodesUsedPercent
+	}
+	if duc.Thresholds.GracePeriodString == "" {
+		duc.Thresholds.GracePeriodString = defaultGracePeriodString
+	}
+	if duc.WatchPaths == nil {
+		for mountpoint := range duc.MountThresholds {
+			duc.WatchPaths = append(duc.WatchPaths, mountpoint)
+		}
+		sort.Strings(duc.WatchPaths)
+	}
+	if duc.SpaceConditionType == "" {
+		duc.SpaceConditionType = defaultSpaceConditionType
+	}
+	if duc.InodesConditionType == "" {
+		duc.InodesConditionType = defaultInodesConditionType
+	}
+	if duc.EnableMetricsReporting == nil {
+		duc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	duc.InvokeInterval, err = time.ParseDuration(duc.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", duc.InvokeIntervalString, err)
+	}
+	duc.MinCheckInterval, err = time.ParseDuration(duc.MinCheckIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing MinCheckIntervalString %q: %v", duc.MinCheckIntervalString, err)
+	}
+	if err := duc.Thresholds.applyConfiguration(); err != nil {
+		return err
+	}
+	for mountpoint, t := range duc.MountThresholds {
+		if err := t.applyConfiguration(); err != nil {
+			return fmt.Errorf("error in thresholds of mountpoint %q: %v", mountpoint, err)
+		}
+	}
+	return nil
+}
+
+func (t *Thresholds) applyConfiguration() error {
+	if t.MinAvailableString != "" {
+		quantity, err := resource.ParseQuantity(t.MinAvailableString)
+		if err != nil {
+			return fmt.Errorf("error in parsing MinAvailableString %q: %v", t.MinAvailableString, err)
+		}
+		t.MinAvailable = quantity.Value()
+	}
+	if t.GracePeriodString != "" {
+		var err error
+		t.GracePeriod, err = time.ParseDuration(t.GracePeriodString)
+		if err != nil {
+			return fmt.Errorf("error in parsing GracePeriodString %q: %v", t.GracePeriodString, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (duc *DiskUsageConfig) Validate() error {
+	if duc.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", duc.InvokeInterval)
+	}
+	if duc.MinCheckInterval < time.Duration(0) {
+		return fmt.Errorf("MinCheckInterval %v must not be negative", duc.MinCheckInterval)
+	}
+	if duc.SpaceConditionType == duc.InodesConditionType {
+		return fmt.Errorf("SpaceConditionType and InodesConditionType must differ, both are %q", duc.SpaceConditionType)
+	}
+	if err := duc.Thresholds.validate(); err != nil {
+		return err
+	}
+	for mountpoint, t := range duc.MountThresholds {
+		if !filepath.IsAbs(mountpoint) {
+			return fmt.Errorf("mountpoint %q must be an absolute path", mountpoint)
+		}
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("invalid thresholds of mountpoint %q: %v", mountpoint, err)
+		}
+	}
+	for _, path := range duc.WatchPaths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("watch path %q must be an absolute path", path)
+		}
+	}
+	return nil
+}
+
+func (t *Thresholds) validate() error {
+	for name, percent := range map[string]*float64{"MaxUsedPercent": t.MaxUsedPercent, "MaxInodesUsedPercent": t.MaxInodesUsedPercent} {
+		if percent != nil && (*percent < 0 || *percent > 100) {
+			return fmt.Errorf("%s %v must be between 0 and 100", name, *percent)
+		}
+	}
+	if t.MinAvailable < 0 {
+		return fmt.Errorf("MinAvailable %v must not be negative", t.MinAvailableString)
+	}
+	if t.GracePeriod < 0 {
+		return fmt.Errorf("GracePeriod %v must not be negative", t.GracePeriod)
+	}
+	return nil
+}
+
+// GetThresholds returns the thresholds of the mountpoint.
+func (duc *DiskUsageConfig) GetThresholds(mountpoint string) Thresholds {
+	thresholds := duc.Thresholds
+	override, ok := duc.MountThresholds[mountpoint]
+	if !ok {
+		return thresholds
+	}
+	if override.MaxUsedPercent != nil {
+		thresholds.MaxUsedPercent = override.MaxUsedPercent
+	}
+	if override.MinAvailableString != "" {
+		thresholds.MinAvailableString, thresholds.MinAvailable = override.MinAvailableString, override.MinAvailable
+	}
+	if override.MaxInodesUsedPercent != nil {
+		thresholds.MaxInodesUsedPercent = override.MaxInodesUsedPercent
+	}
+	if override.MinInodesFree != nil {
+		thresholds.MinInodesFree = override.MinInodesFree
+	}
+	if override.GracePeriodString != "" {
+		thresholds.GracePeriodString, thresholds.GracePeriod = override.GracePeriodString, override.GracePeriod
+	}
+	return thresholds
+}
+
+// IsExcluded returns whether the filesystem type is excluded.
+func (duc *DiskUsageConfig) IsExcluded(fstype string) bool {
+	for _, excluded := range duc.ExcludedFilesystems {
+		if fstype == excluded {
+			return true
+		}
+	}
+	return false
+}
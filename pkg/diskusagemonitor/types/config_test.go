@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	negative := -1.0
+	above := 101.0
+	testCases := []struct {
+		name      string
+		config    DiskUsageConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: DiskUsageConfig{},
+		},
+		{
+			name: "mount thresholds",
+			config: DiskUsageConfig{MountThresholds: map[string]*Thresholds{
+				"/var/lib/kubelet": {MinAvailableString: "10Gi", GracePeriodString: "30s"},
+			}},
+		},
+		{
+			name:      "invalid invoke interval",
+			config:    DiskUsageConfig{InvokeIntervalString: "1 minute"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid min available",
+			config:    DiskUsageConfig{Thresholds: Thresholds{MinAvailableString: "10 GB"}},
+			expectErr: true,
+		},
+		{
+			name:      "negative percentage",
+			config:    DiskUsageConfig{Thresholds: Thresholds{MaxUsedPercent: &negative}},
+			expectErr: true,
+		},
+		{
+			name: "percentage above 100",
+			config: DiskUsageConfig{MountThresholds: map[string]*Thresholds{
+				"/var/lib/kubelet": {MaxInodesUsedPercent: &above},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "relative mountpoint",
+			config: DiskUsageConfig{MountThresholds: map[string]*Thresholds{
+				"var/lib/kubelet": {},
+			}},
+			expectErr: true,
+		},
+		{
+			name:      "same condition types",
+			config:    DiskUsageConfig{SpaceConditionType: "DiskFilling", InodesConditionType: "DiskFilling"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
+
+func TestGetThresholds(t *testing.T) {
+	disabled := 0.0
+	config := DiskUsageConfig{
+		MountThresholds: map[string]*Thresholds{
+			"/var/lib/kubelet": {MaxUsedPercent: &disabled, MinAvailableString: "10Gi"},
+			"/var/log":         {GracePeriodString: "0s"},
+		},
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.WatchPaths, []string{"/var/lib/kubelet", "/var/log"}) {
+		t.Errorf("Expect the mountpoints with thresholds to be watched, got %v", config.WatchPaths)
+	}
+
+	kubelet := config.GetThresholds("/var/lib/kubelet")
+	if *kubelet.MaxUsedPercent != 0 || kubelet.MinAvailable != 10<<30 || kubelet.GracePeriod != 2*time.Minute {
+		t.Errorf("Unexpected thresholds %+v of /var/lib/kubelet", kubelet)
+	}
+	if log := config.GetThresholds("/var/log"); *log.MaxUsedPercent != 85 || log.GracePeriod != 0 {
+		t.Errorf("Unexpected thresholds %+v of /var/log", log)
+	}
+	if root := config.GetThresholds("/"); !reflect.DeepEqual(root, config.Thresholds) {
+		t.Errorf("Expect the default thresholds of /, got %+v", root)
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evictionmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/shirou/gopsutil/disk"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	emtypes "k8s.io/node-problem-detector/pkg/evictionmonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const EvictionMonitorName = "eviction-monitor"
+
+const (
+	imminentReason = "EvictionImminent"
+	meminfoPath    = "/proc/meminfo"
+)
+
+func init() {
+	problemdaemon.Register(EvictionMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewEvictionMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type evictionMonitor struct {
+	configPath string
+	config     emtypes.EvictionConfig
+	// readMemory observes memory.available.
+	readMemory func() (observation, error)
+	// diskUsage reads the usage of the filesystem of a path.
+	diskUsage func(path string) (*disk.UsageStat, error)
+	// imminent records the signals whose eviction is reported imminent, so that they
+	// are only reported again after leaving the warning zone.
+	imminent   map[string]bool
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewEvictionMonitorOrDie creates an eviction monitor, panics if error occurs.
+func NewEvictionMonitorOrDie(configPath string) types.Monitor {
+	em := evictionMonitor{
+		configPath: configPath,
+		diskUsage:  disk.Usage,
+		imminent:   map[string]bool{},
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &em.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = em.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = em.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, em.config, err)
+	}
+	em.readMemory = func() (observation, error) { return readMemory(em.config.CgroupRoot, meminfoPath) }
+
+	// A 1000 size channel should be big enough.
+	em.statusChan = make(chan *types.Status, 1000)
+
+	if *em.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie()
+	}
+	return &em
+}
+
+// initializeProblemMetricsOrDie creates the problem counter of imminent evictions and
+// set the value to 0, panic if error occurs.
+func initializeProblemMetricsOrDie() {
+	err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(imminentReason, 0)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", imminentReason, err)
+	}
+}
+
+func (em *evictionMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start eviction monitor %s", em.configPath)
+	problemdaemon.Go(em, em.monitorLoop)
+	return em.statusChan, nil
+}
+
+func (em *evictionMonitor) Stop() {
+	glog.Infof("Stop eviction monitor %s", em.configPath)
+	em.tomb.Stop()
+}
+
+func (em *evictionMonitor) monitorLoop() {
+	defer em.tomb.Done()
+
+	runTicker := time.NewTicker(em.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	if status := em.check(time.Now()); status != nil {
+		em.statusChan <- status
+	}
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := em.check(now); status != nil {
+				em.statusChan <- status
+			}
+		case <-em.tomb.Stopping():
+			glog.Infof("Eviction monitor stopped: %s", em.configPath)
+			return
+		}
+	}
+}
+
+// check observes the eviction signals, and returns a status with an event for each
+// signal which newly gets close to its eviction threshold.
+func (em *evictionMonitor) check(now time.Time) *types.Status {
+	thresholds, err := loadThresholds(em.config.KubeletConfigPath)
+	if err != nil {
+		glog.Errorf("Failed to load eviction thresholds: %v", err)
+		return nil
+	}
+
+	var events []types.Event
+	for _, signal := range signals {
+		if len(thresholds[signal]) == 0 {
+			delete(em.imminent, signal)
+			continue
+		}
+		o, err := em.observe(signal)
+		if err != nil {
+			glog.Errorf("Failed to observe eviction signal %s: %v", signal, err)
+			continue
+		}
+		message := em.checkSignal(signal, o, thresholds[signal])
+		if message == "" {
+			delete(em.imminent, signal)
+			continue
+		}
+		if em.imminent[signal] {
+			continue
+		}
+		em.imminent[signal] = true
+		glog.Warningf("Eviction imminent: %s", message)
+		events = append(events, types.Event{
+			Severity:  types.Warn,
+			Timestamp: now,
+			Reason:    imminentReason,
+			Message:   message,
+		})
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	if *em.config.EnableMetricsReporting {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(imminentReason, int64(len(events)))
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", imminentReason, err)
+		}
+	}
+	return &types.Status{
+		Source: em.config.Source,
+		Events: events,
+	}
+}
+
+// checkSignal returns a message describing how close the signal is to the highest of
+// its eviction thresholds, or an empty string if it is not within the warning margin.
+func (em *evictionMonitor) checkSignal(signal string, o observation, thresholds []threshold) string {
+	highest := thresholds[0]
+	for _, t := range thresholds[1:] {
+		if t.value(o.capacity) > highest.value(o.capacity) {
+			highest = t
+		}
+	}
+	margin := int64(float64(o.capacity) * *em.config.WarningMargin / 100)
+	if o.available >= highest.value(o.capacity)+margin {
+		return ""
+	}
+	return fmt.Sprintf("%s is %s of %s, kubelet evicts pods below the %s eviction threshold %s",
+		signal, formatAmount(signal, o.available), formatAmount(signal, o.capacity), highest.kind, highest.raw)
+}
+
+// observe returns the current observation of the signal.
+func (em *evictionMonitor) observe(signal string) (observation, error) {
+	if signal == memoryAvailable {
+		return em.readMemory()
+	}
+	path := em.config.NodefsPath
+	if signal == imagefsAvailable || signal == imagefsInodesFree {
+		path = em.config.ImagefsPath
+	}
+	usage, err := em.diskUsage(path)
+	if err != nil {
+		return observation{}, err
+	}
+	if signal == nodefsInodesFree || signal == imagefsInodesFree {
+		return observation{available: int64(usage.InodesFree), capacity: int64(usage.InodesTotal)}, nil
+	}
+	return observation{available: int64(usage.Free), capacity: int64(usage.Total)}, nil
+}
+
+// formatAmount formats bytes as a quantity, and inodes as a plain number.
+func formatAmount(signal string, amount int64) string {
+	if signal == nodefsInodesFree || signal == imagefsInodesFree {
+		return strconv.FormatInt(amount, 10)
+	}
+	return resource.NewQuantity(amount, resource.BinarySI).String()
+}
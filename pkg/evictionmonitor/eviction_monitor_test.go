@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evictionmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/stretchr/testify/assert"
+
+	emtypes "k8s.io/node-problem-detector/pkg/evictionmonitor/types"
+)
+
+func TestCheck(t *testing.T) {
+	disabled := false
+	config := emtypes.EvictionConfig{
+		KubeletConfigPath:      disabledConfigPath,
+		ImagefsPath:            "/var/lib/containerd",
+		EnableMetricsReporting: &disabled,
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+
+	memory := observation{available: 1 << 30, capacity: 4 << 30}
+	usages := map[string]*disk.UsageStat{
+		config.NodefsPath:  {Total: 1000, Free: 500, InodesTotal: 1000, InodesFree: 500},
+		config.ImagefsPath: {Total: 1000, Free: 500, InodesTotal: 1000, InodesFree: 500},
+	}
+	em := &evictionMonitor{
+		config:     config,
+		readMemory: func() (observation, error) { return memory, nil },
+		diskUsage:  func(path string) (*disk.UsageStat, error) { return usages[path], nil },
+		imminent:   map[string]bool{},
+	}
+
+	now := time.Now()
+	assert.Nil(t, em.check(now), "no signal is close to its threshold")
+
+	// The default imagefs.available threshold is 15%, warned below 20%.
+	usages[config.ImagefsPath].Free = 190
+	status := em.check(now)
+	if assert.NotNil(t, status) && assert.Len(t, status.Events, 1) {
+		assert.Equal(t, imminentReason, status.Events[0].Reason)
+		assert.Equal(t, "imagefs.available is 190 of 1k, kubelet evicts pods below the hard eviction threshold 15%",
+			status.Events[0].Message)
+	}
+	assert.Nil(t, em.check(now), "imminent eviction is only reported once")
+
+	// The default memory.available threshold is 100Mi, warned below 100Mi + 5% of 4Gi.
+	memory.available = 300 << 20
+	status = em.check(now)
+	if assert.NotNil(t, status) && assert.Len(t, status.Events, 1) {
+		assert.Equal(t, "memory.available is 300Mi of 4Gi, kubelet evicts pods below the hard eviction threshold 100Mi",
+			status.Events[0].Message)
+	}
+
+	// Leaving the warning zone resets the signal.
+	usages[config.ImagefsPath].Free = 500
+	assert.Nil(t, em.check(now))
+	usages[config.ImagefsPath].Free = 100
+	status = em.check(now)
+	if assert.NotNil(t, status) && assert.Len(t, status.Events, 1) {
+		assert.Contains(t, status.Events[0].Message, "imagefs.available is 100 of")
+	}
+}
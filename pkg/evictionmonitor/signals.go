@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evictionmonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	memoryAvailable    = "memory.available"
+	nodefsAvailable    = "nodefs.available"
+	nodefsInodesFree   = "nodefs.inodesFree"
+	imagefsAvailable   = "imagefs.available"
+	imagefsInodesFree  = "imagefs.inodesFree"
+	hardThreshold      = "hard"
+	softThreshold      = "soft"
+	disabledConfigPath = "-"
+)
+
+// signals are the eviction signals observed, in the order they are checked. Other
+// signals of kubelet, e.g. pid.available, are ignored.
+var signals = []string{memoryAvailable, nodefsAvailable, nodefsInodesFree, imagefsAvailable, imagefsInodesFree}
+
+// defaultEvictionHard are the default hard eviction thresholds of kubelet.
+var defaultEvictionHard = map[string]string{
+	memoryAvailable:  "100Mi",
+	nodefsAvailable:  "10%",
+	nodefsInodesFree: "5%",
+	imagefsAvailable: "15%",
+}
+
+// kubeletConfig is the part of the kubelet config file with the eviction thresholds.
+type kubeletConfig struct {
+	EvictionHard map[string]string `json:"evictionHard"`
+	EvictionSoft map[string]string `json:"evictionSoft"`
+}
+
+// threshold is an eviction threshold, either a quantity or a percentage of the capacity.
+type threshold struct {
+	signal string
+	// kind is either "hard" or "soft".
+	kind       string
+	raw        string
+	quantity   *resource.Quantity
+	percentage float64
+}
+
+// value returns the amount the threshold is at for the capacity.
+func (t threshold) value(capacity int64) int64 {
+	if t.quantity != nil {
+		return t.quantity.Value()
+	}
+	return int64(float64(capacity) * t.percentage / 100)
+}
+
+func parseThreshold(signal, kind, raw string) (threshold, error) {
+	t := threshold{signal: signal, kind: kind, raw: raw}
+	if strings.HasSuffix(raw, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(raw, "%"), 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			return t, fmt.Errorf("invalid percentage %q of %s", raw, signal)
+		}
+		t.percentage = percentage
+		return t, nil
+	}
+	quantity, err := resource.ParseQuantity(raw)
+	if err != nil {
+		return t, fmt.Errorf("invalid quantity %q of %s: %v", raw, signal, err)
+	}
+	t.quantity = &quantity
+	return t, nil
+}
+
+// loadThresholds reads the eviction thresholds of the observed signals from the kubelet
+// config file. The kubelet default hard thresholds are used when the file has none.
+func loadThresholds(path string) (map[string][]threshold, error) {
+	var config kubeletConfig
+	if path != disabledConfigPath {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kubelet config %q: %v", path, err)
+		}
+		defer f.Close()
+		if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal kubelet config %q: %v", path, err)
+		}
+	}
+	if config.EvictionHard == nil {
+		config.EvictionHard = defaultEvictionHard
+	}
+
+	thresholds := map[string][]threshold{}
+	for _, c := range []struct {
+		kind       string
+		thresholds map[string]string
+	}{{hardThreshold, config.EvictionHard}, {softThreshold, config.EvictionSoft}} {
+		for _, signal := range signals {
+			raw, ok := c.thresholds[signal]
+			if !ok {
+				continue
+			}
+			t, err := parseThreshold(signal, c.kind, raw)
+			if err != nil {
+				return nil, err
+			}
+			thresholds[signal] = append(thresholds[signal], t)
+		}
+	}
+	return thresholds, nil
+}
+
+// observation is the observed value of a signal.
+type observation struct {
+	available int64
+	capacity  int64
+}
+
+// readMemory observes memory.available like kubelet: the capacity minus the working set
+// of the root cgroup, which is its usage minus the inactive file pages. When the root
+// cgroup does not report its usage (cgroup v2), the usage is read from /proc/meminfo.
+func readMemory(cgroupRoot, meminfoPath string) (observation, error) {
+	meminfo, err := readKeyValues(meminfoPath, ":")
+	if err != nil {
+		return observation{}, err
+	}
+	total, free, inactiveFile := meminfo["MemTotal"]*1024, meminfo["MemFree"]*1024, meminfo["Inactive(file)"]*1024
+	if total == 0 {
+		return observation{}, fmt.Errorf("no MemTotal in %q", meminfoPath)
+	}
+
+	usage := total - free
+	if data, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "memory", "memory.usage_in_bytes")); err == nil {
+		if usage, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return observation{}, fmt.Errorf("invalid root cgroup memory usage %q: %v", data, err)
+		}
+		if stat, err := readKeyValues(filepath.Join(cgroupRoot, "memory", "memory.stat"), " "); err == nil {
+			inactiveFile = stat["total_inactive_file"]
+		}
+	} else if stat, err := readKeyValues(filepath.Join(cgroupRoot, "memory.stat"), " "); err == nil {
+		inactiveFile = stat["inactive_file"]
+	}
+
+	workingSet := usage - inactiveFile
+	if workingSet < 0 {
+		workingSet = 0
+	}
+	return observation{available: total - workingSet, capacity: total}, nil
+}
+
+// readKeyValues reads the lines of "key<separator> value [unit]" of a file.
+func readKeyValues(path, separator string) (map[string]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := map[string]int64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), separator, 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSpace(parts[0])] = value
+	}
+	return values, scanner.Err()
+}
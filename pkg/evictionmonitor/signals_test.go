@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evictionmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestLoadThresholds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eviction")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name     string
+		config   string
+		expected map[string][]string
+		err      bool
+	}{
+		{
+			name:   "kubelet defaults",
+			config: "kind: KubeletConfiguration\n",
+			expected: map[string][]string{
+				memoryAvailable:  {"hard 100Mi"},
+				nodefsAvailable:  {"hard 10%"},
+				nodefsInodesFree: {"hard 5%"},
+				imagefsAvailable: {"hard 15%"},
+			},
+		},
+		{
+			name: "hard and soft thresholds",
+			config: "evictionHard:\n  memory.available: 200Mi\n  pid.available: 10%\n" +
+				"evictionSoft:\n  memory.available: 1Gi\n  nodefs.available: 20%\n",
+			expected: map[string][]string{
+				memoryAvailable: {"hard 200Mi", "soft 1Gi"},
+				nodefsAvailable: {"soft 20%"},
+			},
+		},
+		{
+			name:   "invalid percentage",
+			config: "evictionHard:\n  nodefs.available: 120%\n",
+			err:    true,
+		},
+		{
+			name:   "invalid quantity",
+			config: "evictionHard:\n  memory.available: lots\n",
+			err:    true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config.yaml")
+			writeFile(t, path, test.config)
+			thresholds, err := loadThresholds(path)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			actual := map[string][]string{}
+			for signal, ts := range thresholds {
+				for _, th := range ts {
+					actual[signal] = append(actual[signal], th.kind+" "+th.raw)
+				}
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestThresholdValue(t *testing.T) {
+	quantity, err := parseThreshold(memoryAvailable, hardThreshold, "1Ki")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), quantity.value(1<<20))
+
+	percentage, err := parseThreshold(nodefsAvailable, hardThreshold, "10%")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), percentage.value(1000))
+}
+
+func TestReadMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eviction")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	meminfo := filepath.Join(dir, "meminfo")
+	writeFile(t, meminfo, "MemTotal:       1000 kB\nMemFree:         200 kB\nInactive(file):  300 kB\n")
+
+	// Without cgroup files the working set is read from /proc/meminfo.
+	o, err := readMemory(filepath.Join(dir, "none"), meminfo)
+	assert.NoError(t, err)
+	assert.Equal(t, observation{available: 500 * 1024, capacity: 1000 * 1024}, o)
+
+	// cgroup v1 root cgroup.
+	v1 := filepath.Join(dir, "v1")
+	writeFile(t, filepath.Join(v1, "memory", "memory.usage_in_bytes"), "716800\n")
+	writeFile(t, filepath.Join(v1, "memory", "memory.stat"), "cache 1000\ntotal_inactive_file 102400\n")
+	o, err = readMemory(v1, meminfo)
+	assert.NoError(t, err)
+	assert.Equal(t, observation{available: 400 * 1024, capacity: 1000 * 1024}, o)
+
+	// cgroup v2 root cgroup.
+	v2 := filepath.Join(dir, "v2")
+	writeFile(t, filepath.Join(v2, "memory.stat"), "anon 1000\ninactive_file 409600\n")
+	o, err = readMemory(v2, meminfo)
+	assert.NoError(t, err)
+	assert.Equal(t, observation{available: 600 * 1024, capacity: 1000 * 1024}, o)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	defaultSource               = "eviction-monitor"
+	defaultInvokeIntervalString = (30 * time.Second).String()
+	defaultKubeletConfigPath    = "/var/lib/kubelet/config.yaml"
+	defaultNodefsPath           = "/var/lib/kubelet"
+	defaultCgroupRoot           = "/sys/fs/cgroup"
+	defaultWarningMargin        = 5.0
+	defaultEnableMetrics        = true
+)
+
+type EvictionConfig struct {
+	// Source is the source name of the eviction monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which the eviction signals are observed.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// KubeletConfigPath is the kubelet config file the eviction thresholds are read from.
+	// It is read on each check, so that threshold changes are picked up. When it is set
+	// to "-" or has no hard eviction thresholds, the kubelet default thresholds are used.
+	KubeletConfigPath string `json:"kubeletConfigPath"`
+	// NodefsPath is a path on the filesystem of the kubelet, the nodefs of the eviction
+	// signals.
+	NodefsPath string `json:"nodefsPath"`
+	// ImagefsPath is a path on the filesystem of the container images, e.g.
+	// "/var/lib/containerd". Default to the nodefs.
+	ImagefsPath string `json:"imagefsPath"`
+	// CgroupRoot is the root of the cgroup filesystem, the working set of the memory is
+	// read from the root cgroup like kubelet does.
+	CgroupRoot string `json:"cgroupRoot"`
+	// WarningMargin is the percentage of the capacity above an eviction threshold within
+	// which eviction is reported imminent.
+	WarningMargin *float64 `json:"warningMargin,omitempty"`
+	// EnableMetricsReporting describes whether to count the EvictionImminent events as
+	// metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (ec *EvictionConfig) ApplyConfiguration() error {
+	if ec.Source == "" {
+		ec.Source = defaultSource
+	}
+	if ec.InvokeIntervalString == "" {
+		ec.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if ec.KubeletConfigPath == "" {
+		ec.KubeletConfigPath = defaultKubeletConfigPath
+	}
+	if ec.NodefsPath == "" {
+		ec.NodefsPath = defaultNodefsPath
+	}
+	if ec.ImagefsPath == "" {
+		ec.ImagefsPath = ec.NodefsPath
+	}
+	if ec.CgroupRoot == "" {
+		ec.CgroupRoot = defaultCgroupRoot
+	}
+	if ec.WarningMargin == nil {
+		ec.WarningMargin = &defaultWarningMargin
+	}
+	if ec.EnableMetricsReporting == nil {
+		ec.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	ec.InvokeInterval, err = time.ParseDuration(ec.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", ec.InvokeIntervalString, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (ec *EvictionConfig) Validate() error {
+	if ec.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", ec.InvokeInterval)
+	}
+	if *ec.WarningMargin <= 0 || *ec.WarningMargin >= 100 {
+		return fmt.Errorf("WarningMargin %v must be above 0 and below 100", *ec.WarningMargin)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	zero, full := 0.0, 100.0
+	testCases := []struct {
+		name      string
+		config    EvictionConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: EvictionConfig{},
+		},
+		{
+			name:   "separate imagefs",
+			config: EvictionConfig{ImagefsPath: "/var/lib/containerd"},
+		},
+		{
+			name:      "invalid invoke interval",
+			config:    EvictionConfig{InvokeIntervalString: "1 minute"},
+			expectErr: true,
+		},
+		{
+			name:      "zero warning margin",
+			config:    EvictionConfig{WarningMargin: &zero},
+			expectErr: true,
+		},
+		{
+			name:      "full warning margin",
+			config:    EvictionConfig{WarningMargin: &full},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package awsexporter writes the problem metrics to CloudWatch and sends the condition
+// transitions to EventBridge, the AWS counterpart of the Stackdriver exporter.
+package awsexporter
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/golang/glog"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	awsconfig "k8s.io/node-problem-detector/pkg/exporters/aws/config"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+func init() {
+	exporters.RegisterWithConfigFile(exporterName,
+		"Configuration for the AWS exporter, which writes metrics to CloudWatch and condition transitions to EventBridge.", NewExporterOrDie)
+}
+
+const exporterName = "aws"
+
+type awsExporter struct {
+	// Mutex protects conditions, the exporter may be called by the periodic sync while
+	// exporting problems.
+	sync.Mutex
+	config   awsconfig.AWSExporterConfig
+	nodeName string
+	// cloudWatch and eventBridge are nil when they are not configured.
+	cloudWatch  *cloudWatch
+	eventBridge *eventBridge
+	// conditions are the statuses of the conditions last seen, by source and type.
+	conditions map[string]types.ConditionStatus
+}
+
+// NewExporterOrDie creates an exporter to export metrics to CloudWatch and problems to
+// EventBridge, panics if error occurs.
+func NewExporterOrDie(configPath string) types.Exporter {
+	config := awsconfig.AWSExporterConfig{}
+	if err := exporters.LoadConfig(configPath, &config); err != nil {
+		glog.Fatalf("Failed to load AWS exporter config: %v", err)
+	}
+
+	// The session resolves the credentials of the environment, the instance profile or
+	// the web identity of the service account.
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(config.Region)})
+	if err != nil {
+		glog.Fatalf("Failed to create AWS session: %v", err)
+	}
+	metadata := ec2metadata.New(sess)
+	region := config.Region
+	if region == "" {
+		region = aws.StringValue(sess.Config.Region)
+	}
+	if region == "" {
+		region, err = metadata.Region()
+		if err != nil {
+			glog.Fatalf("Failed to get the region from the EC2 instance metadata, set it in the config: %v", err)
+		}
+	}
+	creds := sess.Config.Credentials
+	if config.RoleARN != "" {
+		creds = stscreds.NewCredentials(sess.Copy(&aws.Config{Region: aws.String(region)}), config.RoleARN)
+	}
+	var instanceID string
+	if config.CloudWatch != nil && usesInstanceID(config.CloudWatch.Dimensions) {
+		instanceID, err = metadata.GetMetadata("instance-id")
+		if err != nil {
+			glog.Errorf("Failed to get the instance ID from the EC2 instance metadata: %v", err)
+		}
+	}
+
+	glog.Infof("Starting AWS exporter %s in region %s", configPath, region)
+	ae := newAWSExporter(config, util.GetNodeName(), instanceID, region, creds)
+	if ae.cloudWatch != nil {
+		metrics.RegisterViewExporter(exporterName, ae.cloudWatch, config.CloudWatch.ExportPeriodDuration)
+	}
+	if ae.eventBridge != nil {
+		go ae.eventBridge.sendEntries()
+	}
+	return ae
+}
+
+func usesInstanceID(dimensions map[string]string) bool {
+	for _, value := range dimensions {
+		if strings.Contains(value, "{instanceId}") {
+			return true
+		}
+	}
+	return false
+}
+
+func newAWSExporter(config awsconfig.AWSExporterConfig, nodeName, instanceID, region string, creds *credentials.Credentials) *awsExporter {
+	ae := &awsExporter{
+		config:     config,
+		nodeName:   nodeName,
+		conditions: make(map[string]types.ConditionStatus),
+	}
+	if cw := config.CloudWatch; cw != nil {
+		dimensions := make(map[string]string)
+		for name, value := range cw.Dimensions {
+			dimensions[name] = awsconfig.Expand(value, nodeName, instanceID, region)
+		}
+		c := newClient(cloudWatchService, region, cw.Endpoint, creds, config.TimeoutDuration)
+		ae.cloudWatch = newCloudWatch(c, cw.Namespace, cw.Metrics, dimensions)
+	}
+	if eb := config.EventBridge; eb != nil {
+		c := newClient(eventBridgeService, region, eb.Endpoint, creds, config.TimeoutDuration)
+		ae.eventBridge = newEventBridge(c, eb)
+	}
+	return ae
+}
+
+// ExportProblems sends the condition transitions to EventBridge, and the problem events
+// if configured.
+func (ae *awsExporter) ExportProblems(status *types.Status) {
+	if ae.eventBridge == nil {
+		return
+	}
+	ae.Lock()
+	defer ae.Unlock()
+	if ae.config.EventBridge.IncludeEvents {
+		for _, event := range status.Events {
+			if !event.Severity.IsProblem() {
+				continue
+			}
+			ae.eventBridge.send(npdapiv1.NewProblemReport(ae.nodeName, &types.Status{
+				Source: status.Source,
+				Events: []types.Event{event},
+				Node:   status.Node,
+			}), event.Timestamp)
+		}
+	}
+	ae.exportConditions(status)
+}
+
+// SyncProblems sends the condition transitions missed by ExportProblems, if any.
+func (ae *awsExporter) SyncProblems(status *types.Status) {
+	if ae.eventBridge == nil {
+		return
+	}
+	ae.Lock()
+	defer ae.Unlock()
+	ae.exportConditions(status)
+}
+
+// PushesProblems returns whether the problems are sent to EventBridge.
+func (ae *awsExporter) PushesProblems() bool {
+	return ae.eventBridge != nil
+}
+
+// exportConditions sends the conditions whose status changed. A condition seen for the
+// first time is only sent if it is True.
+func (ae *awsExporter) exportConditions(status *types.Status) {
+	for _, condition := range status.Conditions {
+		key := status.Source + "/" + condition.Type
+		last, seen := ae.conditions[key]
+		ae.conditions[key] = condition.Status
+		if last == condition.Status || (!seen && condition.Status != types.True) {
+			continue
+		}
+		ae.eventBridge.send(npdapiv1.NewProblemReport(ae.nodeName, &types.Status{
+			Source:     status.Source,
+			Conditions: []types.Condition{condition},
+			Node:       status.Node,
+		}), condition.Transition)
+	}
+}
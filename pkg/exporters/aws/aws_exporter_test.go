@@ -0,0 +1,210 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsexporter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	awsconfig "k8s.io/node-problem-detector/pkg/exporters/aws/config"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// request is a request received by the fake AWS endpoint.
+type request struct {
+	header http.Header
+	body   string
+}
+
+// serveAWS serves a fake AWS endpoint, which answers the requests with the response.
+func serveAWS(response string) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{header: r.Header, body: string(body)}
+		w.Write([]byte(response))
+	}))
+	return server, requests
+}
+
+func newTestExporter(t *testing.T, config awsconfig.AWSExporterConfig) *awsExporter {
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	creds := credentials.NewStaticCredentials("AKID", "SECRET", "")
+	return newAWSExporter(config, "node-1", "i-0123", "us-west-2", creds)
+}
+
+func TestExportView(t *testing.T) {
+	server, requests := serveAWS("")
+	defer server.Close()
+	ae := newTestExporter(t, awsconfig.AWSExporterConfig{
+		CloudWatch: &awsconfig.CloudWatchConfig{
+			Endpoint:   server.URL,
+			Dimensions: map[string]string{"NodeName": "{nodeName}", "InstanceId": "{instanceId}"},
+		},
+	})
+
+	reasonKey, _ := tag.NewKey("reason")
+	end := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	data := func(value float64) *view.Data {
+		return &view.Data{
+			View: &view.View{
+				Name:        "problem_counter",
+				Measure:     stats.Int64("problem_counter", "", "1"),
+				Aggregation: view.Sum(),
+			},
+			End: end,
+			Rows: []*view.Row{
+				{Tags: []tag.Tag{{Key: reasonKey, Value: "OOMKilling"}}, Data: &view.SumData{Value: value}},
+			},
+		}
+	}
+
+	// The counters are written as the increments since the last export.
+	for _, test := range []struct {
+		value float64
+		want  string
+	}{
+		{value: 3, want: "3"},
+		{value: 5, want: "2"},
+		{value: 1, want: "1"},
+	} {
+		ae.cloudWatch.ExportView(data(test.value))
+		r := <-requests
+		assert.Contains(t, r.header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/20")
+		assert.Contains(t, r.header.Get("Authorization"), "/us-west-2/monitoring/aws4_request")
+		form, err := url.ParseQuery(r.body)
+		assert.NoError(t, err)
+		assert.Equal(t, url.Values{
+			"Action":                         {"PutMetricData"},
+			"Version":                        {"2010-08-01"},
+			"Namespace":                      {"NodeProblemDetector"},
+			"MetricData.member.1.MetricName": {"problem_counter"},
+			"MetricData.member.1.Value":      {test.want},
+			"MetricData.member.1.Unit":       {"None"},
+			"MetricData.member.1.Timestamp":  {"2020-06-01T02:00:00Z"},
+			"MetricData.member.1.Dimensions.member.1.Name":  {"InstanceId"},
+			"MetricData.member.1.Dimensions.member.1.Value": {"i-0123"},
+			"MetricData.member.1.Dimensions.member.2.Name":  {"NodeName"},
+			"MetricData.member.1.Dimensions.member.2.Value": {"node-1"},
+			"MetricData.member.1.Dimensions.member.3.Name":  {"reason"},
+			"MetricData.member.1.Dimensions.member.3.Value": {"OOMKilling"},
+		}, form)
+	}
+
+	// The metrics which are not configured are not written.
+	ae.cloudWatch.ExportView(&view.Data{
+		View: &view.View{Name: "host/uptime", Measure: stats.Float64("host/uptime", "", "s"), Aggregation: view.LastValue()},
+		Rows: []*view.Row{{Data: &view.LastValueData{Value: 10}}},
+	})
+	select {
+	case r := <-requests:
+		t.Errorf("Unexpected request %q", r.body)
+	default:
+	}
+}
+
+func TestExportProblems(t *testing.T) {
+	server, requests := serveAWS(`{"FailedEntryCount":0,"Entries":[{"EventId":"1"}]}`)
+	defer server.Close()
+	ae := newTestExporter(t, awsconfig.AWSExporterConfig{
+		EventBridge: &awsconfig.EventBridgeConfig{Endpoint: server.URL},
+	})
+	assert.True(t, ae.PushesProblems())
+
+	transition := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	status := func(conditionStatus types.ConditionStatus) *types.Status {
+		return &types.Status{
+			Source: "kernel-monitor",
+			Events: []types.Event{{Severity: types.Warn, Reason: "TaskHung", Timestamp: transition}},
+			Conditions: []types.Condition{{
+				Type:       "KernelDeadlock",
+				Status:     conditionStatus,
+				Severity:   types.Critical,
+				Transition: transition,
+				Reason:     "DockerHung",
+				Message:    "task docker:7 blocked for more than 120 seconds.",
+			}},
+		}
+	}
+
+	// A condition first seen False is not sent, nor are the events by default.
+	ae.ExportProblems(status(types.False))
+	ae.SyncProblems(status(types.False))
+	assert.Empty(t, ae.eventBridge.queue)
+
+	ae.ExportProblems(status(types.True))
+	ae.SyncProblems(status(types.True))
+	if assert.Len(t, ae.eventBridge.queue, 1) {
+		go ae.eventBridge.sendEntries()
+		defer close(ae.eventBridge.queue)
+	}
+
+	r := <-requests
+	assert.Equal(t, "AWSEvents.PutEvents", r.header.Get("X-Amz-Target"))
+	assert.Contains(t, r.header.Get("Authorization"), "/us-west-2/events/aws4_request")
+	var put putEventsRequest
+	assert.NoError(t, json.Unmarshal([]byte(r.body), &put))
+	if assert.Len(t, put.Entries, 1) {
+		e := put.Entries[0]
+		assert.Equal(t, "node-problem-detector", e.Source)
+		assert.Equal(t, "Node Problem", e.DetailType)
+		assert.Equal(t, "default", e.EventBusName)
+		assert.Equal(t, transition.Unix(), e.Time)
+		var report npdapiv1.ProblemReport
+		assert.NoError(t, json.Unmarshal([]byte(e.Detail), &report))
+		assert.Equal(t, npdapiv1.ProblemReport{
+			APIVersion: npdapiv1.APIVersion,
+			Node:       "node-1",
+			Source:     "kernel-monitor",
+			Conditions: []npdapiv1.Condition{{
+				Type:       "KernelDeadlock",
+				Status:     "True",
+				Transition: transition,
+				Reason:     "DockerHung",
+				Message:    "task docker:7 blocked for more than 120 seconds.",
+				Severity:   "critical",
+			}},
+		}, report)
+	}
+}
+
+func TestPutFailedEntries(t *testing.T) {
+	server, _ := serveAWS(`{"FailedEntryCount":1,"Entries":[{"ErrorCode":"AccessDeniedException","ErrorMessage":"not authorized"}]}`)
+	defer server.Close()
+	ae := newTestExporter(t, awsconfig.AWSExporterConfig{
+		EventBridge: &awsconfig.EventBridgeConfig{Endpoint: server.URL},
+	})
+
+	err := ae.eventBridge.put([]entry{{Source: "node-problem-detector", Detail: "{}"}})
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "AccessDeniedException: not authorized"), err.Error())
+	}
+}
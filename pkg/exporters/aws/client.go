@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsexporter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// client sends requests to an AWS service, signed with Signature Version 4. The service
+// APIs are spoken without their SDK clients, which are not vendored.
+type client struct {
+	// service is the signing name of the service, e.g. "monitoring" for CloudWatch.
+	service  string
+	region   string
+	endpoint string
+	signer   *v4.Signer
+	http     *http.Client
+}
+
+func newClient(service, region, endpoint string, creds *credentials.Credentials, timeout time.Duration) *client {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+	}
+	return &client{
+		service:  service,
+		region:   region,
+		endpoint: endpoint,
+		signer:   v4.NewSigner(creds),
+		http:     &http.Client{Timeout: timeout},
+	}
+}
+
+// post posts the signed body with the headers, and returns the response body.
+func (c *client) post(body []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	// Sign sets the body of the request, but not its length.
+	req.ContentLength = int64(len(body))
+	if _, err := c.signer.Sign(req, bytes.NewReader(body), c.service, c.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %v", err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %q: %s", resp.Status, data)
+	}
+	return data, nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsexporter
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats/view"
+
+	"k8s.io/node-problem-detector/pkg/exporters"
+)
+
+const (
+	// cloudWatchService is the signing name of CloudWatch.
+	cloudWatchService = "monitoring"
+	// maxMetricData is the number of metric data written per PutMetricData request.
+	maxMetricData = 500
+	// maxDimensions is the maximum number of dimensions of a CloudWatch metric.
+	maxDimensions = 30
+)
+
+// cloudWatchUnits maps the OpenCensus units to the CloudWatch units.
+var cloudWatchUnits = map[string]string{
+	"s":  "Seconds",
+	"ms": "Milliseconds",
+	"By": "Bytes",
+	"%":  "Percent",
+}
+
+// dimension is a dimension of a CloudWatch metric.
+type dimension struct {
+	name  string
+	value string
+}
+
+// metricDatum is a value of a CloudWatch metric.
+type metricDatum struct {
+	name       string
+	dimensions []dimension
+	value      float64
+	unit       string
+	timestamp  time.Time
+}
+
+// cloudWatch writes the selected OpenCensus metrics to CloudWatch. Cumulative metrics are
+// written as the deltas since the last export, so that the CloudWatch Sum statistic
+// counts the increments in its period.
+type cloudWatch struct {
+	client     *client
+	namespace  string
+	metrics    map[string]bool
+	dimensions []dimension
+
+	// Mutex protects sums, the views may be exported concurrently.
+	sync.Mutex
+	// sums are the last values of the cumulative metrics, keyed by metric and dimensions.
+	sums map[string]float64
+}
+
+func newCloudWatch(c *client, namespace string, metrics []string, dimensions map[string]string) *cloudWatch {
+	cw := &cloudWatch{
+		client:    c,
+		namespace: namespace,
+		metrics:   make(map[string]bool),
+		sums:      make(map[string]float64),
+	}
+	for _, name := range metrics {
+		cw.metrics[name] = true
+	}
+	for name, value := range dimensions {
+		if value == "" {
+			glog.Warningf("Skipping CloudWatch dimension %q without value", name)
+			continue
+		}
+		cw.dimensions = append(cw.dimensions, dimension{name: name, value: value})
+	}
+	sort.Slice(cw.dimensions, func(i, j int) bool { return cw.dimensions[i].name < cw.dimensions[j].name })
+	return cw
+}
+
+// ExportView implements view.Exporter. It is called by OpenCensus once per view every
+// reporting period.
+func (cw *cloudWatch) ExportView(vd *view.Data) {
+	if !cw.metrics[vd.View.Name] {
+		return
+	}
+	data := cw.toMetricData(vd)
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxMetricData {
+			n = maxMetricData
+		}
+		if _, err := cw.client.post(cw.encode(data[:n]), map[string]string{
+			"Content-Type": "application/x-www-form-urlencoded; charset=utf-8",
+		}); err != nil {
+			glog.Errorf("Failed to write metric %q to CloudWatch: %v", vd.View.Name, err)
+			exporters.RecordFailure(exporterName, "metrics")
+		}
+		data = data[n:]
+	}
+}
+
+// toMetricData converts OpenCensus view data to CloudWatch metric data. Distribution
+// aggregations are not supported.
+func (cw *cloudWatch) toMetricData(vd *view.Data) []metricDatum {
+	unit := cloudWatchUnits[vd.View.Measure.Unit()]
+	if unit == "" {
+		unit = "None"
+	}
+	cw.Lock()
+	defer cw.Unlock()
+	var data []metricDatum
+	for _, row := range vd.Rows {
+		d := metricDatum{name: vd.View.Name, dimensions: cw.rowDimensions(row), unit: unit, timestamp: vd.End}
+		switch v := row.Data.(type) {
+		case *view.LastValueData:
+			d.value = v.Value
+		case *view.SumData:
+			d.value = cw.delta(d, v.Value)
+		case *view.CountData:
+			d.value = cw.delta(d, float64(v.Value))
+			d.unit = "Count"
+		default:
+			glog.V(4).Infof("Skipping unsupported aggregation %T for metric %q", row.Data, vd.View.Name)
+			return nil
+		}
+		data = append(data, d)
+	}
+	return data
+}
+
+// rowDimensions returns the dimensions of the row, which are the configured dimensions
+// and the labels of the row, sorted by name. The configured dimensions take precedence,
+// and labels without value are dropped.
+func (cw *cloudWatch) rowDimensions(row *view.Row) []dimension {
+	dimensions := append([]dimension(nil), cw.dimensions...)
+	for _, tag := range row.Tags {
+		if tag.Value == "" || cw.hasDimension(tag.Key.Name()) {
+			continue
+		}
+		dimensions = append(dimensions, dimension{name: tag.Key.Name(), value: tag.Value})
+	}
+	sort.Slice(dimensions, func(i, j int) bool { return dimensions[i].name < dimensions[j].name })
+	if len(dimensions) > maxDimensions {
+		dimensions = dimensions[:maxDimensions]
+	}
+	return dimensions
+}
+
+func (cw *cloudWatch) hasDimension(name string) bool {
+	for _, d := range cw.dimensions {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// delta returns the increment of the cumulative value since the last export. The whole
+// value is the increment when it is first seen, or after it was reset.
+func (cw *cloudWatch) delta(d metricDatum, value float64) float64 {
+	key := d.name
+	for _, dim := range d.dimensions {
+		key += "," + dim.name + "=" + dim.value
+	}
+	last, ok := cw.sums[key]
+	cw.sums[key] = value
+	if !ok || value < last {
+		return value
+	}
+	return value - last
+}
+
+// encode encodes a PutMetricData request of the query protocol.
+func (cw *cloudWatch) encode(data []metricDatum) []byte {
+	form := url.Values{}
+	form.Set("Action", "PutMetricData")
+	form.Set("Version", "2010-08-01")
+	form.Set("Namespace", cw.namespace)
+	for i, d := range data {
+		prefix := fmt.Sprintf("MetricData.member.%d.", i+1)
+		form.Set(prefix+"MetricName", d.name)
+		form.Set(prefix+"Value", strconv.FormatFloat(d.value, 'g', -1, 64))
+		form.Set(prefix+"Unit", d.unit)
+		form.Set(prefix+"Timestamp", d.timestamp.UTC().Format(time.RFC3339))
+		for j, dim := range d.dimensions {
+			dimPrefix := fmt.Sprintf("%sDimensions.member.%d.", prefix, j+1)
+			form.Set(dimPrefix+"Name", dim.name)
+			form.Set(dimPrefix+"Value", dim.value)
+		}
+	}
+	return []byte(strings.Replace(form.Encode(), "+", "%20", -1))
+}
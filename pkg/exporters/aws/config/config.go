@@ -0,0 +1,188 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	defaultTimeout      = (10 * time.Second).String()
+	defaultExportPeriod = (60 * time.Second).String()
+	defaultNamespace    = "NodeProblemDetector"
+	defaultMetrics      = []string{"problem_counter", "problem_gauge"}
+	defaultDimensions   = map[string]string{"NodeName": "{nodeName}"}
+	defaultEventBus     = "default"
+	defaultEventSource  = "node-problem-detector"
+	defaultDetailType   = "Node Problem"
+)
+
+const (
+	// maxDimensions is the maximum number of dimensions of a CloudWatch metric.
+	maxDimensions = 30
+)
+
+type AWSExporterConfig struct {
+	// Region is the AWS region the metrics and events are sent to. Default to the region
+	// of the AWS_REGION environment variable, or else of the EC2 instance metadata.
+	Region string `json:"region"`
+	// RoleARN is the IAM role assumed to send the metrics and events. Default to the
+	// credentials of the environment, e.g. the role of the EC2 instance profile or of the
+	// service account (IRSA).
+	RoleARN string `json:"roleARN"`
+	// Timeout is the timeout of each request.
+	Timeout         string        `json:"timeout"`
+	TimeoutDuration time.Duration `json:"-"`
+	// CloudWatch configures the metrics written to CloudWatch. Nil disables it.
+	CloudWatch *CloudWatchConfig `json:"cloudWatch"`
+	// EventBridge configures the problems sent to EventBridge. Nil disables it.
+	EventBridge *EventBridgeConfig `json:"eventBridge"`
+}
+
+// CloudWatchConfig configures the metrics written to CloudWatch.
+type CloudWatchConfig struct {
+	// Endpoint overrides the CloudWatch endpoint of the region, e.g. for a VPC endpoint.
+	Endpoint string `json:"endpoint"`
+	// Namespace is the namespace of the metrics. Default to "NodeProblemDetector".
+	Namespace string `json:"namespace"`
+	// Metrics are the names of the metrics written. Default to the problem metrics,
+	// "problem_counter" and "problem_gauge".
+	Metrics []string `json:"metrics"`
+	// Dimensions are added to all metrics, in addition to their labels. The values
+	// support the placeholders "{nodeName}", "{instanceId}" and "{region}". Default to
+	// {"NodeName": "{nodeName}"}.
+	Dimensions map[string]string `json:"dimensions"`
+	// ExportPeriod is the period the metrics are written at.
+	ExportPeriod         string        `json:"exportPeriod"`
+	ExportPeriodDuration time.Duration `json:"-"`
+}
+
+// EventBridgeConfig configures the problems sent to EventBridge.
+type EventBridgeConfig struct {
+	// Endpoint overrides the EventBridge endpoint of the region, e.g. for a VPC endpoint.
+	Endpoint string `json:"endpoint"`
+	// EventBus is the name or ARN of the event bus. Default to "default".
+	EventBus string `json:"eventBus"`
+	// Source is the source of the events. Default to "node-problem-detector".
+	Source string `json:"source"`
+	// DetailType is the detail type of the events. Default to "Node Problem".
+	DetailType string `json:"detailType"`
+	// IncludeEvents also sends the problem events, in addition to the condition
+	// transitions.
+	IncludeEvents bool `json:"includeEvents"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (aec *AWSExporterConfig) ApplyConfiguration() error {
+	if aec.Timeout == "" {
+		aec.Timeout = defaultTimeout
+	}
+	var err error
+	aec.TimeoutDuration, err = time.ParseDuration(aec.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to parse timeout %q: %v", aec.Timeout, err)
+	}
+
+	if cw := aec.CloudWatch; cw != nil {
+		if cw.Namespace == "" {
+			cw.Namespace = defaultNamespace
+		}
+		if cw.Metrics == nil {
+			cw.Metrics = defaultMetrics
+		}
+		if cw.Dimensions == nil {
+			cw.Dimensions = defaultDimensions
+		}
+		if cw.ExportPeriod == "" {
+			cw.ExportPeriod = defaultExportPeriod
+		}
+		cw.ExportPeriodDuration, err = time.ParseDuration(cw.ExportPeriod)
+		if err != nil {
+			return fmt.Errorf("failed to parse exportPeriod %q: %v", cw.ExportPeriod, err)
+		}
+	}
+
+	if eb := aec.EventBridge; eb != nil {
+		if eb.EventBus == "" {
+			eb.EventBus = defaultEventBus
+		}
+		if eb.Source == "" {
+			eb.Source = defaultEventSource
+		}
+		if eb.DetailType == "" {
+			eb.DetailType = defaultDetailType
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (aec *AWSExporterConfig) Validate() error {
+	if aec.TimeoutDuration <= 0 {
+		return fmt.Errorf("timeout %v must be positive", aec.TimeoutDuration)
+	}
+	if aec.CloudWatch == nil && aec.EventBridge == nil {
+		return fmt.Errorf("neither cloudWatch nor eventBridge is configured")
+	}
+	if cw := aec.CloudWatch; cw != nil {
+		if err := validateEndpoint(cw.Endpoint); err != nil {
+			return err
+		}
+		if cw.ExportPeriodDuration <= 0 {
+			return fmt.Errorf("exportPeriod %v must be positive", cw.ExportPeriodDuration)
+		}
+		if len(cw.Metrics) == 0 {
+			return fmt.Errorf("no metric is written to CloudWatch")
+		}
+		if len(cw.Dimensions) > maxDimensions {
+			return fmt.Errorf("%d dimensions exceed the CloudWatch limit of %d", len(cw.Dimensions), maxDimensions)
+		}
+		for name, value := range cw.Dimensions {
+			if name == "" || value == "" {
+				return fmt.Errorf("dimension %q=%q must have a name and a value", name, value)
+			}
+		}
+	}
+	if eb := aec.EventBridge; eb != nil {
+		if err := validateEndpoint(eb.Endpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to parse endpoint %q: %v", endpoint, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("endpoint %q must be an http or https URL", endpoint)
+	}
+	return nil
+}
+
+// Expand replaces the placeholders of the dimension value.
+func Expand(value, nodeName, instanceID, region string) string {
+	return strings.NewReplacer("{nodeName}", nodeName, "{instanceId}", instanceID, "{region}", region).Replace(value)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    AWSExporterConfig
+		wantError bool
+	}{
+		{
+			name:   "cloudwatch",
+			config: AWSExporterConfig{CloudWatch: &CloudWatchConfig{}},
+		},
+		{
+			name: "eventbridge with endpoint",
+			config: AWSExporterConfig{
+				Region:      "us-west-2",
+				RoleARN:     "arn:aws:iam::123456789012:role/npd",
+				EventBridge: &EventBridgeConfig{Endpoint: "https://vpce-0123.events.us-west-2.vpce.amazonaws.com"},
+			},
+		},
+		{
+			name:      "nothing configured",
+			config:    AWSExporterConfig{},
+			wantError: true,
+		},
+		{
+			name:      "invalid endpoint",
+			config:    AWSExporterConfig{EventBridge: &EventBridgeConfig{Endpoint: "events.us-west-2.amazonaws.com"}},
+			wantError: true,
+		},
+		{
+			name:      "no metric",
+			config:    AWSExporterConfig{CloudWatch: &CloudWatchConfig{Metrics: []string{}}},
+			wantError: true,
+		},
+		{
+			name:      "dimension without value",
+			config:    AWSExporterConfig{CloudWatch: &CloudWatchConfig{Dimensions: map[string]string{"Cluster": ""}}},
+			wantError: true,
+		},
+		{
+			name:      "negative export period",
+			config:    AWSExporterConfig{CloudWatch: &CloudWatchConfig{ExportPeriod: "-1s"}},
+			wantError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.ApplyConfiguration(); err != nil {
+				t.Fatalf("Unexpected error applying config %+v: %v", test.config, err)
+			}
+			err := test.config.Validate()
+			if test.wantError && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.wantError && err != nil {
+				t.Errorf("Unexpected error for config %+v: %v", test.config, err)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	got := Expand("{region}/{instanceId}/{nodeName}", "node-1", "i-0123", "us-west-2")
+	if want := "us-west-2/i-0123/node-1"; got != want {
+		t.Errorf("Expand() = %q, want %q", got, want)
+	}
+}
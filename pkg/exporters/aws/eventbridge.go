@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	awsconfig "k8s.io/node-problem-detector/pkg/exporters/aws/config"
+)
+
+const (
+	// eventBridgeService is the signing name of EventBridge.
+	eventBridgeService = "events"
+	// maxEntries is the maximum number of entries of a PutEvents request.
+	maxEntries = 10
+	// queueSize is the number of events waiting to be sent, beyond which events are
+	// dropped.
+	queueSize = 1000
+)
+
+// entry is an entry of a PutEvents request.
+type entry struct {
+	Source       string
+	DetailType   string
+	Detail       string
+	EventBusName string
+	// Time is in seconds since the epoch, the timestamp format of the JSON protocol.
+	Time int64
+}
+
+type putEventsRequest struct {
+	Entries []entry
+}
+
+type putEventsResponse struct {
+	FailedEntryCount int
+	Entries          []struct {
+		ErrorCode    string
+		ErrorMessage string
+	}
+}
+
+// eventBridge sends the problems to an EventBridge event bus.
+type eventBridge struct {
+	client *client
+	config *awsconfig.EventBridgeConfig
+	queue  chan *entry
+}
+
+func newEventBridge(c *client, config *awsconfig.EventBridgeConfig) *eventBridge {
+	return &eventBridge{
+		client: c,
+		config: config,
+		queue:  make(chan *entry, queueSize),
+	}
+}
+
+// send queues the report of a single event or condition transition to be sent as the
+// detail of an event at the time of the problem.
+func (eb *eventBridge) send(report *npdapiv1.ProblemReport, timestamp time.Time) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		glog.Errorf("Failed to marshal the detail of %+v: %v", report, err)
+		return
+	}
+	e := &entry{
+		Source:       eb.config.Source,
+		DetailType:   eb.config.DetailType,
+		Detail:       string(data),
+		EventBusName: eb.config.EventBus,
+		Time:         timestamp.Unix(),
+	}
+	select {
+	case eb.queue <- e:
+	default:
+		glog.Errorf("Dropped event of %s, too many events are waiting to be sent to EventBridge", report.Source)
+		exporters.RecordFailure(exporterName, "events")
+	}
+}
+
+// sendEntries sends the queued entries, batching the entries queued together.
+func (eb *eventBridge) sendEntries() {
+	for e := range eb.queue {
+		entries := []entry{*e}
+	batch:
+		for len(entries) < maxEntries {
+			select {
+			case e, ok := <-eb.queue:
+				if !ok {
+					break batch
+				}
+				entries = append(entries, *e)
+			default:
+				break batch
+			}
+		}
+		if err := eb.put(entries); err != nil {
+			glog.Errorf("Failed to send %d events to EventBridge: %v", len(entries), err)
+			exporters.RecordFailure(exporterName, "events")
+		}
+	}
+}
+
+// put sends the entries with a PutEvents request.
+func (eb *eventBridge) put(entries []entry) error {
+	body, err := json.Marshal(putEventsRequest{Entries: entries})
+	if err != nil {
+		return err
+	}
+	data, err := eb.client.post(body, map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": "AWSEvents.PutEvents",
+	})
+	if err != nil {
+		return err
+	}
+	var resp putEventsResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("failed to unmarshal response %q: %v", data, err)
+	}
+	if resp.FailedEntryCount == 0 {
+		return nil
+	}
+	// The entries of the response are in the order of the request, the failed
+	// entries have an error code.
+	for _, e := range resp.Entries {
+		if e.ErrorCode != "" {
+			return fmt.Errorf("%d of %d events failed, first error %s: %s", resp.FailedEntryCount, len(entries), e.ErrorCode, e.ErrorMessage)
+		}
+	}
+	return fmt.Errorf("%d of %d events failed", resp.FailedEntryCount, len(entries))
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package azureexporter writes the problem metrics to Azure Monitor custom metrics and
+// ingests the condition transitions into Log Analytics, the Azure counterpart of the
+// Stackdriver exporter.
+package azureexporter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	azureconfig "k8s.io/node-problem-detector/pkg/exporters/azure/config"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+func init() {
+	exporters.RegisterWithConfigFile(exporterName,
+		"Configuration for the Azure exporter, which writes metrics to Azure Monitor and condition transitions to Log Analytics.", NewExporterOrDie)
+}
+
+const exporterName = "azure"
+
+type azureExporter struct {
+	// Mutex protects conditions, the exporter may be called by the periodic sync while
+	// exporting problems.
+	sync.Mutex
+	config   azureconfig.AzureExporterConfig
+	nodeName string
+	// metrics and logs are nil when they are not configured.
+	metrics *azureMetrics
+	logs    *azureLogs
+	// conditions are the statuses of the conditions last seen, by source and type.
+	conditions map[string]types.ConditionStatus
+}
+
+// NewExporterOrDie creates an exporter to export metrics to Azure Monitor and problems to
+// Log Analytics, panics if error occurs.
+func NewExporterOrDie(configPath string) types.Exporter {
+	config := azureconfig.AzureExporterConfig{}
+	if err := exporters.LoadConfig(configPath, &config); err != nil {
+		glog.Fatalf("Failed to load Azure exporter config: %v", err)
+	}
+
+	metadata := newIMDS(defaultIMDSEndpoint, config.ClientID, config.TimeoutDuration)
+	// The instance metadata is only needed by the metrics, the logs are sent to the
+	// data collection endpoint.
+	var compute computeMetadata
+	if config.Metrics != nil && (config.ResourceID == "" || config.Region == "" || usesVMName(config.Metrics.Dimensions)) {
+		c, err := metadata.compute()
+		if err != nil {
+			glog.Fatalf("Failed to get the Azure instance metadata, set resourceID and region in the config: %v", err)
+		}
+		compute = *c
+	}
+	if config.ResourceID == "" {
+		config.ResourceID = compute.metricsResourceID()
+	}
+	if config.Region == "" {
+		config.Region = compute.Location
+	}
+
+	glog.Infof("Starting Azure exporter %s", configPath)
+	ae := newAzureExporter(config, util.GetNodeName(), compute.Name, metadata)
+	if ae.metrics != nil {
+		metrics.RegisterViewExporter(exporterName, ae.metrics, config.Metrics.ExportPeriodDuration)
+	}
+	if ae.logs != nil {
+		go ae.logs.sendRecords()
+	}
+	return ae
+}
+
+func usesVMName(dimensions map[string]string) bool {
+	for _, value := range dimensions {
+		if strings.Contains(value, "{vmName}") {
+			return true
+		}
+	}
+	return false
+}
+
+func newAzureExporter(config azureconfig.AzureExporterConfig, nodeName, vmName string, metadata *imds) *azureExporter {
+	ae := &azureExporter{
+		config:     config,
+		nodeName:   nodeName,
+		conditions: make(map[string]types.ConditionStatus),
+	}
+	if m := config.Metrics; m != nil {
+		dimensions := make(map[string]string)
+		for name, value := range m.Dimensions {
+			dimensions[name] = azureconfig.Expand(value, nodeName, vmName, config.Region)
+		}
+		endpoint := m.Endpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://%s.monitoring.azure.com", config.Region)
+		}
+		c := &client{imds: metadata, resource: metricsResource, http: &http.Client{Timeout: config.TimeoutDuration}}
+		address := strings.TrimSuffix(endpoint, "/") + config.ResourceID + "/metrics"
+		ae.metrics = newAzureMetrics(c, address, m.Namespace, m.Metrics, dimensions)
+	}
+	if l := config.Logs; l != nil {
+		c := &client{imds: metadata, resource: logsResource, http: &http.Client{Timeout: config.TimeoutDuration}}
+		ae.logs = newAzureLogs(c, l)
+	}
+	return ae
+}
+
+// ExportProblems sends the condition transitions to Log Analytics, and the problem events
+// if configured.
+func (ae *azureExporter) ExportProblems(status *types.Status) {
+	if ae.logs == nil {
+		return
+	}
+	ae.Lock()
+	defer ae.Unlock()
+	if ae.config.Logs.IncludeEvents {
+		for _, event := range status.Events {
+			if !event.Severity.IsProblem() {
+				continue
+			}
+			ae.logs.send(&record{
+				TimeGenerated: event.Timestamp,
+				Computer:      ae.nodeName,
+				Report: npdapiv1.NewProblemReport(ae.nodeName, &types.Status{
+					Source: status.Source,
+					Events: []types.Event{event},
+					Node:   status.Node,
+				}),
+			})
+		}
+	}
+	ae.exportConditions(status)
+}
+
+// SyncProblems sends the condition transitions missed by ExportProblems, if any.
+func (ae *azureExporter) SyncProblems(status *types.Status) {
+	if ae.logs == nil {
+		return
+	}
+	ae.Lock()
+	defer ae.Unlock()
+	ae.exportConditions(status)
+}
+
+// PushesProblems returns whether the problems are sent to Log Analytics.
+func (ae *azureExporter) PushesProblems() bool {
+	return ae.logs != nil
+}
+
+// exportConditions sends the conditions whose status changed. A condition seen for the
+// first time is only sent if it is True.
+func (ae *azureExporter) exportConditions(status *types.Status) {
+	for _, condition := range status.Conditions {
+		key := status.Source + "/" + condition.Type
+		last, seen := ae.conditions[key]
+		ae.conditions[key] = condition.Status
+		if last == condition.Status || (!seen && condition.Status != types.True) {
+			continue
+		}
+		ae.logs.send(&record{
+			TimeGenerated: condition.Transition,
+			Computer:      ae.nodeName,
+			Report: npdapiv1.NewProblemReport(ae.nodeName, &types.Status{
+				Source:     status.Source,
+				Conditions: []types.Condition{condition},
+				Node:       status.Node,
+			}),
+		})
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	azureconfig "k8s.io/node-problem-detector/pkg/exporters/azure/config"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const resourceID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/aks-nodepool1"
+
+// request is a request received by the fake Azure endpoints.
+type request struct {
+	path  string
+	auth  string
+	query string
+	body  string
+}
+
+// serveAzure serves a fake instance metadata service and Azure Monitor endpoints. The
+// tokens are numbered by request, to check they are cached.
+func serveAzure() (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	var tokens int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			if r.Header.Get("Metadata") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			n := atomic.AddInt32(&tokens, 1)
+			fmt.Fprintf(w, `{"access_token":"%s-%d","expires_on":"%d"}`, r.URL.Query().Get("resource"), n, time.Now().Add(time.Hour).Unix())
+		case "/metadata/instance/compute":
+			fmt.Fprintf(w, `{"resourceId":"%s/virtualMachines/3","location":"eastus","name":"aks-nodepool1_3","vmScaleSetName":"aks-nodepool1"}`, resourceID)
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			requests <- request{path: r.URL.Path, auth: r.Header.Get("Authorization"), query: r.URL.RawQuery, body: string(body)}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return server, requests
+}
+
+func newTestExporter(t *testing.T, server *httptest.Server, config azureconfig.AzureExporterConfig) *azureExporter {
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	metadata := newIMDS(server.URL, config.ClientID, config.TimeoutDuration)
+	compute, err := metadata.compute()
+	assert.NoError(t, err)
+	config.ResourceID = compute.metricsResourceID()
+	config.Region = compute.Location
+	return newAzureExporter(config, "node-1", compute.Name, metadata)
+}
+
+func TestExportView(t *testing.T) {
+	server, requests := serveAzure()
+	defer server.Close()
+	ae := newTestExporter(t, server, azureconfig.AzureExporterConfig{
+		Metrics: &azureconfig.MetricsConfig{
+			Endpoint:   server.URL,
+			Dimensions: map[string]string{"NodeName": "{nodeName}", "VMName": "{vmName}"},
+		},
+	})
+
+	reasonKey, _ := tag.NewKey("reason")
+	end := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	data := func(value float64) *view.Data {
+		return &view.Data{
+			View: &view.View{
+				Name:        "problem_counter",
+				Measure:     stats.Int64("problem_counter", "", "1"),
+				Aggregation: view.Sum(),
+				TagKeys:     []tag.Key{reasonKey},
+			},
+			End: end,
+			Rows: []*view.Row{
+				{Tags: []tag.Tag{{Key: reasonKey, Value: "OOMKilling"}}, Data: &view.SumData{Value: value}},
+			},
+		}
+	}
+
+	// The counters are written as the increments since the last export.
+	for _, test := range []struct {
+		value float64
+		want  float64
+	}{
+		{value: 3, want: 3},
+		{value: 5, want: 2},
+		{value: 1, want: 1},
+	} {
+		ae.metrics.ExportView(data(test.value))
+		r := <-requests
+		assert.Equal(t, resourceID+"/metrics", r.path)
+		// The token is requested once.
+		assert.Equal(t, "Bearer https://monitoring.azure.com/-1", r.auth)
+		var m customMetric
+		assert.NoError(t, json.Unmarshal([]byte(r.body), &m))
+		assert.Equal(t, end, m.Time)
+		assert.Equal(t, baseData{
+			Metric:    "problem_counter",
+			Namespace: "NodeProblemDetector",
+			DimNames:  []string{"NodeName", "VMName", "reason"},
+			Series: []series{
+				{DimValues: []string{"node-1", "aks-nodepool1_3", "OOMKilling"}, Min: test.want, Max: test.want, Sum: test.want, Count: 1},
+			},
+		}, m.Data.BaseData)
+	}
+
+	// The metrics which are not configured are not written.
+	ae.metrics.ExportView(&view.Data{
+		View: &view.View{Name: "host/uptime", Measure: stats.Float64("host/uptime", "", "s"), Aggregation: view.LastValue()},
+		Rows: []*view.Row{{Data: &view.LastValueData{Value: 10}}},
+	})
+	select {
+	case r := <-requests:
+		t.Errorf("Unexpected request %q", r.body)
+	default:
+	}
+}
+
+func TestExportProblems(t *testing.T) {
+	server, requests := serveAzure()
+	defer server.Close()
+	ae := newTestExporter(t, server, azureconfig.AzureExporterConfig{
+		Logs: &azureconfig.LogsConfig{
+			Endpoint:      server.URL,
+			RuleID:        "dcr-0123",
+			Stream:        "Custom-NodeProblems_CL",
+			IncludeEvents: true,
+		},
+	})
+	assert.True(t, ae.PushesProblems())
+
+	transition := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	status := func(conditionStatus types.ConditionStatus) *types.Status {
+		return &types.Status{
+			Source: "kernel-monitor",
+			Events: []types.Event{{Severity: types.Info, Reason: "KernelDeadlock", Timestamp: transition}},
+			Conditions: []types.Condition{{
+				Type:       "KernelDeadlock",
+				Status:     conditionStatus,
+				Severity:   types.Critical,
+				Transition: transition,
+				Reason:     "DockerHung",
+				Message:    "task docker:7 blocked for more than 120 seconds.",
+			}},
+			Node: map[string]string{"pool": "nodepool1"},
+		}
+	}
+
+	// A condition first seen False is not sent, nor are the info events.
+	ae.ExportProblems(status(types.False))
+	assert.Empty(t, ae.logs.queue)
+
+	ae.ExportProblems(status(types.True))
+	ae.SyncProblems(status(types.True))
+	if assert.Len(t, ae.logs.queue, 1) {
+		go ae.logs.sendRecords()
+		defer close(ae.logs.queue)
+	}
+
+	r := <-requests
+	assert.Equal(t, "/dataCollectionRules/dcr-0123/streams/Custom-NodeProblems_CL", r.path)
+	assert.Equal(t, "api-version=2023-01-01", r.query)
+	assert.Equal(t, "Bearer https://monitor.azure.com/-1", r.auth)
+	var records []record
+	assert.NoError(t, json.Unmarshal([]byte(r.body), &records))
+	assert.Equal(t, []record{{
+		TimeGenerated: transition,
+		Computer:      "node-1",
+		Report: &npdapiv1.ProblemReport{
+			APIVersion:   npdapiv1.APIVersion,
+			Node:         "node-1",
+			NodeMetadata: map[string]string{"pool": "nodepool1"},
+			Source:       "kernel-monitor",
+			Conditions: []npdapiv1.Condition{{
+				Type:       "KernelDeadlock",
+				Status:     "True",
+				Transition: transition,
+				Reason:     "DockerHung",
+				Message:    "task docker:7 blocked for more than 120 seconds.",
+				Severity:   "critical",
+			}},
+		},
+	}}, records)
+}
+
+func TestMetricsResourceID(t *testing.T) {
+	vm := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-1"
+	assert.Equal(t, vm, (&computeMetadata{ResourceID: vm}).metricsResourceID())
+	assert.Equal(t, resourceID, (&computeMetadata{ResourceID: resourceID + "/virtualMachines/3", VMScaleSetName: "aks-nodepool1"}).metricsResourceID())
+}
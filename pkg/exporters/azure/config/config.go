@@ -0,0 +1,187 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	defaultTimeout      = (10 * time.Second).String()
+	defaultExportPeriod = (60 * time.Second).String()
+	defaultNamespace    = "NodeProblemDetector"
+	defaultMetrics      = []string{"problem_counter", "problem_gauge"}
+	defaultDimensions   = map[string]string{"NodeName": "{nodeName}"}
+)
+
+const (
+	// maxDimensions is the maximum number of dimensions of an Azure Monitor custom metric.
+	maxDimensions = 10
+)
+
+type AzureExporterConfig struct {
+	// ResourceID is the ID of the Azure resource the metrics are written against. Default
+	// to the virtual machine or scale set instance of the instance metadata.
+	ResourceID string `json:"resourceID"`
+	// Region is the Azure region of the resource. Default to the region of the instance
+	// metadata.
+	Region string `json:"region"`
+	// ClientID is the client ID of the user-assigned managed identity used to write the
+	// metrics and logs. Default to the system-assigned identity, or to the only
+	// user-assigned identity of the virtual machine.
+	ClientID string `json:"clientID"`
+	// Timeout is the timeout of each request.
+	Timeout         string        `json:"timeout"`
+	TimeoutDuration time.Duration `json:"-"`
+	// Metrics configures the custom metrics written to Azure Monitor. Nil disables it.
+	Metrics *MetricsConfig `json:"metrics"`
+	// Logs configures the problems ingested into Log Analytics. Nil disables it.
+	Logs *LogsConfig `json:"logs"`
+}
+
+// MetricsConfig configures the custom metrics written to Azure Monitor.
+type MetricsConfig struct {
+	// Endpoint overrides the regional custom metrics endpoint,
+	// https://<region>.monitoring.azure.com.
+	Endpoint string `json:"endpoint"`
+	// Namespace is the namespace of the metrics. Default to "NodeProblemDetector".
+	Namespace string `json:"namespace"`
+	// Metrics are the names of the metrics written. Default to the problem metrics,
+	// "problem_counter" and "problem_gauge".
+	Metrics []string `json:"metrics"`
+	// Dimensions are added to all metrics, in addition to their labels. The values
+	// support the placeholders "{nodeName}", "{vmName}" and "{region}". Default to
+	// {"NodeName": "{nodeName}"}.
+	Dimensions map[string]string `json:"dimensions"`
+	// ExportPeriod is the period the metrics are written at.
+	ExportPeriod         string        `json:"exportPeriod"`
+	ExportPeriodDuration time.Duration `json:"-"`
+}
+
+// LogsConfig configures the problems ingested into Log Analytics with the Logs Ingestion
+// API.
+type LogsConfig struct {
+	// Endpoint is the logs ingestion endpoint of the data collection endpoint, e.g.
+	// https://my-dce-abcd.eastus-1.ingest.monitor.azure.com.
+	Endpoint string `json:"endpoint"`
+	// RuleID is the immutable ID of the data collection rule, e.g.
+	// dcr-00000000000000000000000000000000.
+	RuleID string `json:"ruleID"`
+	// Stream is the stream of the data collection rule the problems are sent to, e.g.
+	// Custom-NodeProblems_CL.
+	Stream string `json:"stream"`
+	// IncludeEvents also sends the problem events, in addition to the condition
+	// transitions.
+	IncludeEvents bool `json:"includeEvents"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (aec *AzureExporterConfig) ApplyConfiguration() error {
+	if aec.Timeout == "" {
+		aec.Timeout = defaultTimeout
+	}
+	var err error
+	aec.TimeoutDuration, err = time.ParseDuration(aec.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to parse timeout %q: %v", aec.Timeout, err)
+	}
+
+	if m := aec.Metrics; m != nil {
+		if m.Namespace == "" {
+			m.Namespace = defaultNamespace
+		}
+		if m.Metrics == nil {
+			m.Metrics = defaultMetrics
+		}
+		if m.Dimensions == nil {
+			m.Dimensions = defaultDimensions
+		}
+		if m.ExportPeriod == "" {
+			m.ExportPeriod = defaultExportPeriod
+		}
+		m.ExportPeriodDuration, err = time.ParseDuration(m.ExportPeriod)
+		if err != nil {
+			return fmt.Errorf("failed to parse exportPeriod %q: %v", m.ExportPeriod, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (aec *AzureExporterConfig) Validate() error {
+	if aec.TimeoutDuration <= 0 {
+		return fmt.Errorf("timeout %v must be positive", aec.TimeoutDuration)
+	}
+	if aec.Metrics == nil && aec.Logs == nil {
+		return fmt.Errorf("neither metrics nor logs is configured")
+	}
+	if aec.ResourceID != "" && !strings.HasPrefix(aec.ResourceID, "/subscriptions/") {
+		return fmt.Errorf("resourceID %q must start with /subscriptions/", aec.ResourceID)
+	}
+	if m := aec.Metrics; m != nil {
+		if m.Endpoint != "" {
+			if err := validateEndpoint(m.Endpoint); err != nil {
+				return err
+			}
+		}
+		if m.ExportPeriodDuration <= 0 {
+			return fmt.Errorf("exportPeriod %v must be positive", m.ExportPeriodDuration)
+		}
+		if len(m.Metrics) == 0 {
+			return fmt.Errorf("no metric is written to Azure Monitor")
+		}
+		if len(m.Dimensions) > maxDimensions {
+			return fmt.Errorf("%d dimensions exceed the Azure Monitor limit of %d", len(m.Dimensions), maxDimensions)
+		}
+		for name, value := range m.Dimensions {
+			if name == "" || value == "" {
+				return fmt.Errorf("dimension %q=%q must have a name and a value", name, value)
+			}
+		}
+	}
+	if l := aec.Logs; l != nil {
+		if err := validateEndpoint(l.Endpoint); err != nil {
+			return err
+		}
+		if l.RuleID == "" {
+			return fmt.Errorf("ruleID of the data collection rule is required")
+		}
+		if l.Stream == "" {
+			return fmt.Errorf("stream of the data collection rule is required")
+		}
+	}
+	return nil
+}
+
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to parse endpoint %q: %v", endpoint, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("endpoint %q must be an http or https URL", endpoint)
+	}
+	return nil
+}
+
+// Expand replaces the placeholders of the dimension value.
+func Expand(value, nodeName, vmName, region string) string {
+	return strings.NewReplacer("{nodeName}", nodeName, "{vmName}", vmName, "{region}", region).Replace(value)
+}
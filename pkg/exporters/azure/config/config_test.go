@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	logs := func() *LogsConfig {
+		return &LogsConfig{
+			Endpoint: "https://npd-dce-abcd.eastus-1.ingest.monitor.azure.com",
+			RuleID:   "dcr-00000000000000000000000000000000",
+			Stream:   "Custom-NodeProblems_CL",
+		}
+	}
+	testCases := []struct {
+		name      string
+		config    AzureExporterConfig
+		wantError bool
+	}{
+		{
+			name:   "metrics",
+			config: AzureExporterConfig{Metrics: &MetricsConfig{}},
+		},
+		{
+			name: "logs with user-assigned identity",
+			config: AzureExporterConfig{
+				ClientID: "00000000-0000-0000-0000-000000000000",
+				Logs:     logs(),
+			},
+		},
+		{
+			name:      "nothing configured",
+			config:    AzureExporterConfig{},
+			wantError: true,
+		},
+		{
+			name:      "invalid resource ID",
+			config:    AzureExporterConfig{ResourceID: "my-vm", Metrics: &MetricsConfig{}},
+			wantError: true,
+		},
+		{
+			name: "too many dimensions",
+			config: AzureExporterConfig{Metrics: &MetricsConfig{Dimensions: map[string]string{
+				"d0": "v", "d1": "v", "d2": "v", "d3": "v", "d4": "v", "d5": "v", "d6": "v", "d7": "v", "d8": "v", "d9": "v", "d10": "v",
+			}}},
+			wantError: true,
+		},
+		{
+			name:      "logs without endpoint",
+			config:    AzureExporterConfig{Logs: &LogsConfig{RuleID: "dcr-0", Stream: "Custom-NodeProblems_CL"}},
+			wantError: true,
+		},
+		{
+			name: "logs without stream",
+			config: func() AzureExporterConfig {
+				c := AzureExporterConfig{Logs: logs()}
+				c.Logs.Stream = ""
+				return c
+			}(),
+			wantError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.ApplyConfiguration(); err != nil {
+				t.Fatalf("Unexpected error applying config %+v: %v", test.config, err)
+			}
+			err := test.config.Validate()
+			if test.wantError && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.wantError && err != nil {
+				t.Errorf("Unexpected error for config %+v: %v", test.config, err)
+			}
+		})
+	}
+}
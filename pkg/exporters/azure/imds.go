@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureexporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIMDSEndpoint = "http://169.254.169.254"
+	// tokenRefreshMargin is how long before their expiry the tokens are refreshed.
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+// computeMetadata is the compute metadata of the virtual machine.
+type computeMetadata struct {
+	ResourceID     string `json:"resourceId"`
+	Location       string `json:"location"`
+	Name           string `json:"name"`
+	VMScaleSetName string `json:"vmScaleSetName"`
+}
+
+type token struct {
+	value  string
+	expiry time.Time
+}
+
+// imds is a client of the Azure Instance Metadata Service, which provides the metadata
+// of the virtual machine and the tokens of its managed identities.
+type imds struct {
+	endpoint string
+	// clientID selects a user-assigned managed identity, empty for the default one.
+	clientID string
+	http     *http.Client
+
+	// Mutex protects tokens, they are requested by the metrics and logs concurrently.
+	sync.Mutex
+	// tokens are the cached tokens, by resource.
+	tokens map[string]*token
+}
+
+func newIMDS(endpoint, clientID string, timeout time.Duration) *imds {
+	return &imds{
+		endpoint: endpoint,
+		clientID: clientID,
+		http:     &http.Client{Timeout: timeout},
+		tokens:   make(map[string]*token),
+	}
+}
+
+// get gets the metadata of the path into v.
+func (i *imds) get(path string, query url.Values, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, i.endpoint+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := i.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %q: %s", resp.Status, data)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// compute returns the compute metadata of the virtual machine.
+func (i *imds) compute() (*computeMetadata, error) {
+	var compute computeMetadata
+	query := url.Values{"api-version": {"2021-02-01"}, "format": {"json"}}
+	if err := i.get("/metadata/instance/compute", query, &compute); err != nil {
+		return nil, fmt.Errorf("failed to get the instance metadata: %v", err)
+	}
+	return &compute, nil
+}
+
+// metricsResourceID returns the resource the metrics of the virtual machine are written
+// against. Custom metrics are not supported by scale set instances, they are written
+// against their scale set.
+func (c *computeMetadata) metricsResourceID() string {
+	if c.VMScaleSetName == "" {
+		return c.ResourceID
+	}
+	if i := strings.Index(c.ResourceID, "/virtualMachines/"); i > 0 {
+		return c.ResourceID[:i]
+	}
+	return c.ResourceID
+}
+
+// token returns a token of the managed identity for the resource.
+func (i *imds) token(resource string) (string, error) {
+	i.Lock()
+	defer i.Unlock()
+	if t, ok := i.tokens[resource]; ok && time.Now().Add(tokenRefreshMargin).Before(t.expiry) {
+		return t.value, nil
+	}
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {resource}}
+	if i.clientID != "" {
+		query.Set("client_id", i.clientID)
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		// ExpiresOn is in seconds since the epoch.
+		ExpiresOn string `json:"expires_on"`
+	}
+	if err := i.get("/metadata/identity/oauth2/token", query, &resp); err != nil {
+		return "", fmt.Errorf("failed to get a managed identity token for %q: %v", resource, err)
+	}
+	expiresOn, err := strconv.ParseInt(resp.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the expiry %q of the token for %q: %v", resp.ExpiresOn, resource, err)
+	}
+	i.tokens[resource] = &token{value: resp.AccessToken, expiry: time.Unix(expiresOn, 0)}
+	return resp.AccessToken, nil
+}
+
+// client posts JSON to an Azure API, authenticated with the managed identity.
+type client struct {
+	imds *imds
+	// resource is the resource the tokens are requested for.
+	resource string
+	http     *http.Client
+}
+
+// post posts the body to the address, and returns an error unless the response is 2xx.
+func (c *client) post(address string, body []byte) error {
+	t, err := c.imds.token(c.resource)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %q: %s", resp.Status, data)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	azureconfig "k8s.io/node-problem-detector/pkg/exporters/azure/config"
+)
+
+const (
+	// logsResource is the resource of the tokens of the Logs Ingestion API.
+	logsResource = "https://monitor.azure.com/"
+	// maxRecords is the number of records sent per request.
+	maxRecords = 100
+	// queueSize is the number of records waiting to be sent, beyond which records are
+	// dropped.
+	queueSize = 1000
+)
+
+// record is a problem sent to Log Analytics. The fields are the columns of the stream of
+// the data collection rule: the standard time and computer columns, and the problem report
+// of a single event or condition transition as a dynamic column.
+type record struct {
+	TimeGenerated time.Time               `json:"TimeGenerated"`
+	Computer      string                  `json:"Computer"`
+	Report        *npdapiv1.ProblemReport `json:"Report"`
+}
+
+// azureLogs sends the problems to a data collection rule of Log Analytics.
+type azureLogs struct {
+	client *client
+	// address is the URL of the stream of the data collection rule.
+	address string
+	queue   chan *record
+}
+
+func newAzureLogs(c *client, config *azureconfig.LogsConfig) *azureLogs {
+	address := fmt.Sprintf("%s/dataCollectionRules/%s/streams/%s?api-version=2023-01-01",
+		strings.TrimSuffix(config.Endpoint, "/"), url.PathEscape(config.RuleID), url.PathEscape(config.Stream))
+	return &azureLogs{
+		client:  c,
+		address: address,
+		queue:   make(chan *record, queueSize),
+	}
+}
+
+// send queues the record to be sent.
+func (al *azureLogs) send(r *record) {
+	select {
+	case al.queue <- r:
+	default:
+		glog.Errorf("Dropped record of %s, too many records are waiting to be sent to Log Analytics", r.Report.Source)
+		exporters.RecordFailure(exporterName, "logs")
+	}
+}
+
+// sendRecords sends the queued records, batching the records queued together.
+func (al *azureLogs) sendRecords() {
+	for r := range al.queue {
+		records := []*record{r}
+	batch:
+		for len(records) < maxRecords {
+			select {
+			case r, ok := <-al.queue:
+				if !ok {
+					break batch
+				}
+				records = append(records, r)
+			default:
+				break batch
+			}
+		}
+		body, err := json.Marshal(records)
+		if err == nil {
+			err = al.client.post(al.address, body)
+		}
+		if err != nil {
+			glog.Errorf("Failed to send %d records to Log Analytics: %v", len(records), err)
+			exporters.RecordFailure(exporterName, "logs")
+		}
+	}
+}
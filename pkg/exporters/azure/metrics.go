@@ -0,0 +1,214 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureexporter
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats/view"
+
+	"k8s.io/node-problem-detector/pkg/exporters"
+)
+
+const (
+	// metricsResource is the resource of the tokens of the custom metrics API.
+	metricsResource = "https://monitoring.azure.com/"
+	// maxDimensions is the maximum number of dimensions of a custom metric.
+	maxDimensions = 10
+)
+
+// customMetric is a request of the custom metrics API.
+type customMetric struct {
+	Time time.Time `json:"time"`
+	Data struct {
+		BaseData baseData `json:"baseData"`
+	} `json:"data"`
+}
+
+type baseData struct {
+	Metric    string   `json:"metric"`
+	Namespace string   `json:"namespace"`
+	DimNames  []string `json:"dimNames,omitempty"`
+	Series    []series `json:"series"`
+}
+
+// series is the value of a metric for some dimension values. Custom metrics are
+// pre-aggregated, a single value has the same min, max and sum, and a count of 1.
+type series struct {
+	DimValues []string `json:"dimValues,omitempty"`
+	Min       float64  `json:"min"`
+	Max       float64  `json:"max"`
+	Sum       float64  `json:"sum"`
+	Count     int64    `json:"count"`
+}
+
+// dimension is a dimension of a custom metric.
+type dimension struct {
+	name  string
+	value string
+}
+
+// azureMetrics writes the selected OpenCensus metrics to Azure Monitor as custom metrics.
+// Cumulative metrics are written as the deltas since the last export, so that the
+// Azure Monitor Sum aggregation counts the increments in its time grain.
+type azureMetrics struct {
+	client *client
+	// address is the URL of the custom metrics of the resource.
+	address    string
+	namespace  string
+	metrics    map[string]bool
+	dimensions []dimension
+
+	// Mutex protects sums, the views may be exported concurrently.
+	sync.Mutex
+	// sums are the last values of the cumulative metrics, keyed by metric and dimensions.
+	sums map[string]float64
+}
+
+func newAzureMetrics(c *client, address, namespace string, metrics []string, dimensions map[string]string) *azureMetrics {
+	am := &azureMetrics{
+		client:    c,
+		address:   address,
+		namespace: namespace,
+		metrics:   make(map[string]bool),
+		sums:      make(map[string]float64),
+	}
+	for _, name := range metrics {
+		am.metrics[name] = true
+	}
+	for name, value := range dimensions {
+		if value == "" {
+			glog.Warningf("Skipping Azure Monitor dimension %q without value", name)
+			continue
+		}
+		am.dimensions = append(am.dimensions, dimension{name: name, value: value})
+	}
+	sort.Slice(am.dimensions, func(i, j int) bool { return am.dimensions[i].name < am.dimensions[j].name })
+	return am
+}
+
+// ExportView implements view.Exporter. It is called by OpenCensus once per view every
+// reporting period.
+func (am *azureMetrics) ExportView(vd *view.Data) {
+	if !am.metrics[vd.View.Name] {
+		return
+	}
+	m, ok := am.toCustomMetric(vd)
+	if !ok {
+		return
+	}
+	body, err := json.Marshal(m)
+	if err == nil {
+		err = am.client.post(am.address, body)
+	}
+	if err != nil {
+		glog.Errorf("Failed to write metric %q to Azure Monitor: %v", vd.View.Name, err)
+		exporters.RecordFailure(exporterName, "metrics")
+	}
+}
+
+// toCustomMetric converts OpenCensus view data to a custom metric. Distribution
+// aggregations are not supported.
+func (am *azureMetrics) toCustomMetric(vd *view.Data) (*customMetric, bool) {
+	// All series of a custom metric have the same dimensions: the configured
+	// dimensions, and the labels of the view which they do not override.
+	dimNames := make([]string, 0, len(am.dimensions)+len(vd.View.TagKeys))
+	for _, d := range am.dimensions {
+		dimNames = append(dimNames, d.name)
+	}
+	for _, key := range vd.View.TagKeys {
+		if !am.hasDimension(key.Name()) {
+			dimNames = append(dimNames, key.Name())
+		}
+	}
+	sort.Strings(dimNames)
+	if len(dimNames) > maxDimensions {
+		dimNames = dimNames[:maxDimensions]
+	}
+
+	m := &customMetric{Time: vd.End.UTC()}
+	m.Data.BaseData = baseData{Metric: vd.View.Name, Namespace: am.namespace, DimNames: dimNames}
+	am.Lock()
+	defer am.Unlock()
+	for _, row := range vd.Rows {
+		values := am.dimValues(dimNames, row)
+		var value float64
+		switch v := row.Data.(type) {
+		case *view.LastValueData:
+			value = v.Value
+		case *view.SumData:
+			value = am.delta(vd.View.Name, values, v.Value)
+		case *view.CountData:
+			value = am.delta(vd.View.Name, values, float64(v.Value))
+		default:
+			glog.V(4).Infof("Skipping unsupported aggregation %T for metric %q", row.Data, vd.View.Name)
+			return nil, false
+		}
+		m.Data.BaseData.Series = append(m.Data.BaseData.Series, series{
+			DimValues: values,
+			Min:       value,
+			Max:       value,
+			Sum:       value,
+			Count:     1,
+		})
+	}
+	return m, len(m.Data.BaseData.Series) > 0
+}
+
+// dimValues returns the values of the dimensions of the row, in the order of the names.
+func (am *azureMetrics) dimValues(names []string, row *view.Row) []string {
+	values := make([]string, len(names))
+	for i, name := range names {
+		for _, d := range am.dimensions {
+			if d.name == name {
+				values[i] = d.value
+			}
+		}
+		for _, tag := range row.Tags {
+			if tag.Key.Name() == name && !am.hasDimension(name) {
+				values[i] = tag.Value
+			}
+		}
+	}
+	return values
+}
+
+func (am *azureMetrics) hasDimension(name string) bool {
+	for _, d := range am.dimensions {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// delta returns the increment of the cumulative value since the last export. The whole
+// value is the increment when it is first seen, or after it was reset.
+func (am *azureMetrics) delta(metric string, dimValues []string, value float64) float64 {
+	key := metric + "," + strings.Join(dimValues, ",")
+	last, ok := am.sums[key]
+	am.sums[key] = value
+	if !ok || value < last {
+		return value
+	}
+	return value - last
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporters
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+// Config is the configuration of an exporter read from a config file by LoadConfig.
+type Config interface {
+	// ApplyConfiguration applies the defaults, and parses the fields which are not
+	// unmarshalled directly, e.g. durations.
+	ApplyConfiguration() error
+	// Validate verifies whether the settings are valid.
+	Validate() error
+}
+
+// LoadConfig reads the JSON config file into config, applies its defaults and validates
+// it. Unknown fields are rejected, so that misspelled settings are not silently ignored.
+func LoadConfig(path string, config Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file %q: %v", path, err)
+	}
+	if err := util.UnmarshalStrict(data, config); err != nil {
+		return fmt.Errorf("failed to unmarshal configuration file %q: %v", path, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return fmt.Errorf("failed to apply configuration for %q: %v", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("failed to validate configuration %q: %v", path, err)
+	}
+	return nil
+}
+
+// ConfigFileOptions are the command line options of an exporter enabled by the path of
+// its config file, e.g. "--exporter.syslog=/config/syslog-exporter.json".
+type ConfigFileOptions struct {
+	// Flag is the name of the flag, "exporter.<exporter type>".
+	Flag string
+	// Description is the description of the flag.
+	Description string
+	// Path is the path of the config file, empty when the exporter is not enabled.
+	Path string
+}
+
+// SetFlags implements types.CommandLineOptions.
+func (o *ConfigFileOptions) SetFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Path, o.Flag, "", o.Description+" Set to config file path.")
+}
+
+// RegisterWithConfigFile registers an exporter enabled by the path of its config file,
+// set with the --exporter.<exporter type> flag. create is only called when the flag is
+// set, with the path of the config file, and panics if error occurs.
+func RegisterWithConfigFile(exporterType types.ExporterType, description string, create func(configPath string) types.Exporter) {
+	Register(exporterType, types.ExporterHandler{
+		CreateExporterOrDie: func(clo types.CommandLineOptions) types.Exporter {
+			options, ok := clo.(*ConfigFileOptions)
+			if !ok {
+				glog.Fatalf("Wrong type for the command line options of %s exporter: %s.", exporterType, reflect.TypeOf(clo))
+			}
+			if options.Path == "" {
+				return nil
+			}
+			return create(options.Path)
+		},
+		Options: &ConfigFileOptions{
+			Flag:        "exporter." + string(exporterType),
+			Description: description,
+		},
+	})
+}
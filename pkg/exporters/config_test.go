@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporters
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+type fakeConfig struct {
+	Endpoint string `json:"endpoint"`
+	Timeout  string `json:"timeout"`
+	applied  bool
+}
+
+func (c *fakeConfig) ApplyConfiguration() error {
+	if c.Timeout == "" {
+		c.Timeout = "5s"
+	}
+	c.applied = true
+	return nil
+}
+
+func (c *fakeConfig) Validate() error {
+	if c.Endpoint == "" {
+		return errors.New("endpoint is required")
+	}
+	return nil
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(content string) string {
+		path := filepath.Join(dir, "config.json")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	config := fakeConfig{}
+	assert.NoError(t, LoadConfig(write(`{"endpoint": "https://example.com"}`), &config))
+	assert.Equal(t, fakeConfig{Endpoint: "https://example.com", Timeout: "5s", applied: true}, config)
+
+	assert.Error(t, LoadConfig(write(`{"endpoint": "https://example.com", "endpont": "typo"}`), &fakeConfig{}),
+		"unknown fields should be rejected")
+	assert.Error(t, LoadConfig(write(`{}`), &fakeConfig{}), "invalid config should be rejected")
+	assert.Error(t, LoadConfig(filepath.Join(dir, "missing.json"), &fakeConfig{}))
+}
+
+func TestRegisterWithConfigFile(t *testing.T) {
+	defer func() { handlers = make(map[types.ExporterType]types.ExporterHandler) }()
+	var created []string
+	RegisterWithConfigFile("foo", "Configuration for the foo exporter.", func(configPath string) types.Exporter {
+		created = append(created, configPath)
+		return nil
+	})
+
+	handler := GetExporterHandlerOrDie("foo")
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	handler.Options.SetFlags(fs)
+	flag := fs.Lookup("exporter.foo")
+	if assert.NotNil(t, flag) {
+		assert.Equal(t, "Configuration for the foo exporter. Set to config file path.", flag.Usage)
+	}
+
+	handler.CreateExporterOrDie(handler.Options)
+	assert.Empty(t, created, "exporter should not be created without config file")
+
+	assert.NoError(t, fs.Parse([]string{"--exporter.foo=/config/foo.json"}))
+	handler.CreateExporterOrDie(handler.Options)
+	assert.Equal(t, []string{"/config/foo.json"}, created)
+}
+
+type fakeStoppableExporter struct {
+	stopped chan struct{}
+	block   bool
+}
+
+func (e *fakeStoppableExporter) ExportProblems(*types.Status) {}
+
+func (e *fakeStoppableExporter) SyncProblems(*types.Status) {}
+
+func (e *fakeStoppableExporter) Stop() {
+	if e.block {
+		select {}
+	}
+	close(e.stopped)
+}
+
+func TestStopExporters(t *testing.T) {
+	stoppable := &fakeStoppableExporter{stopped: make(chan struct{})}
+	StopExporters([]types.Exporter{stoppable, nil}, time.Minute)
+	select {
+	case <-stoppable.stopped:
+	default:
+		t.Errorf("Expected exporter to be stopped")
+	}
+
+	// A hung exporter does not block the termination.
+	start := time.Now()
+	StopExporters([]types.Exporter{&fakeStoppableExporter{block: true}}, 10*time.Millisecond)
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package exporters is the public API for the exporters of node problem detector, which
+export the problems found by the problem daemons to a control plane or a monitoring back
+end. It allows exporters to be developed out of tree and linked into a custom build of
+node problem detector, see docs/exporters.md and the example in examples/webhookexporter.
+
+An exporter package registers a factory from its init function:
+
+	func init() {
+		exporters.RegisterWithConfigFile("webhook", "Configuration for the webhook exporter.", NewExporterOrDie)
+	}
+
+Registered exporters get a command line flag, here --exporter.webhook. Exporters with
+other flags register a types.ExporterHandler with Register instead.
+
+The lifecycle of an exporter is:
+
+ 1. The factory is called once after the command line is parsed. It returns nil if the
+    exporter is not enabled, and exits with glog.Fatalf if its configuration is invalid.
+    LoadConfig reads, defaults and validates a config file.
+ 2. ExportProblems is called with the changes of the problems of each problem daemon, and
+    SyncProblems periodically with their full state. Both are called from a single
+    goroutine, and must not block for long; slow back ends are written to asynchronously.
+ 3. Stop is called on termination if the exporter implements types.StoppableExporter.
+
+Exporters may implement the other optional interfaces of package types, e.g.
+types.PushExporter to share the egress budget of the exporters pushing problems, and
+types.NodeAnnotator to be used by the node health score. Failures are counted with
+RecordFailure. Exporters writing to Kubernetes are disabled when DryRun returns true.
+Metrics are exported by registering an OpenCensus view.Exporter, see the
+Stackdriver exporter.
+
+The API is versioned by APIVersion. Within a version, the exported identifiers of this
+package and the types.Exporter, types.ExporterHandler, types.CommandLineOptions and
+types.Status types only change in backward compatible ways; new capabilities are added
+as new optional interfaces.
+*/
+package exporters
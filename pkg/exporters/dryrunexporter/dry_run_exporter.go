@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dryrunexporter provides the exporter used in dry run mode, which logs the
+// problems and appends them to a local JSON file instead of writing them to Kubernetes.
+package dryrunexporter
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/cmd/options"
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	// exportKind marks the records of problem changes.
+	exportKind = "export"
+	// syncKind marks the records of the full state of a problem daemon.
+	syncKind = "sync"
+)
+
+// record is a line of the output file. The problems are written with the stable schema,
+// so that the tools reading the output do not depend on the internal types.
+type record struct {
+	// Time is when the status was exported.
+	Time time.Time `json:"time"`
+	// Kind is either "export" for problem changes or "sync" for the full state.
+	Kind   string                  `json:"kind"`
+	Report *npdapiv1.ProblemReport `json:"report"`
+}
+
+type dryRunExporter struct {
+	// mutex makes sure that the records are not interleaved.
+	mutex sync.Mutex
+	// encoder writes the records to the output file. It is nil when there is no output
+	// file.
+	encoder *json.Encoder
+	node    string
+	now     func() time.Time
+}
+
+// NewExporterOrDie creates the dry run exporter, panics if error occurs. It returns nil
+// when dry run mode is disabled.
+func NewExporterOrDie(npdo *options.NodeProblemDetectorOptions) types.Exporter {
+	if !npdo.DryRun {
+		return nil
+	}
+	var output io.Writer
+	if npdo.DryRunOutputPath != "" {
+		f, err := os.OpenFile(npdo.DryRunOutputPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			glog.Fatalf("Failed to open dry run output %q: %v", npdo.DryRunOutputPath, err)
+		}
+		output = f
+	}
+	return newDryRunExporter(output, npdo.NodeName)
+}
+
+func newDryRunExporter(output io.Writer, node string) *dryRunExporter {
+	de := &dryRunExporter{node: node, now: time.Now}
+	if output != nil {
+		de.encoder = json.NewEncoder(output)
+	}
+	return de
+}
+
+// ExportProblems logs the problem changes and writes them to the output file.
+func (de *dryRunExporter) ExportProblems(status *types.Status) {
+	for _, event := range status.Events {
+		glog.Infof("Dry run: would record event %+v of %q", event, status.Source)
+	}
+	for _, condition := range status.Conditions {
+		glog.Infof("Dry run: would update condition %+v of %q", condition, status.Source)
+	}
+	de.write(exportKind, status)
+}
+
+// SyncProblems writes the full state of the problem daemon to the output file.
+func (de *dryRunExporter) SyncProblems(status *types.Status) {
+	glog.V(3).Infof("Dry run: would sync conditions %+v of %q", status.Conditions, status.Source)
+	de.write(syncKind, status)
+}
+
+func (de *dryRunExporter) write(kind string, status *types.Status) {
+	if de.encoder == nil {
+		return
+	}
+	de.mutex.Lock()
+	defer de.mutex.Unlock()
+	if err := de.encoder.Encode(record{Time: de.now(), Kind: kind, Report: npdapiv1.NewProblemReport(de.node, status)}); err != nil {
+		glog.Errorf("Failed to write dry run record of %q: %v", status.Source, err)
+		exporters.RecordFailure("dry-run", "problems")
+	}
+}
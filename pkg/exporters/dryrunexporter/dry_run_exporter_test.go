@@ -0,0 +1,55 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrunexporter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestDryRunExporter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var output bytes.Buffer
+	de := newDryRunExporter(&output, "test-node")
+	de.now = func() time.Time { return now }
+
+	de.ExportProblems(&types.Status{
+		Source: "kernel-monitor",
+		Events: []types.Event{{Severity: types.Warn, Timestamp: now, Reason: "OOMKilling", Message: "killed"}},
+	})
+	de.SyncProblems(&types.Status{
+		Source:     "kernel-monitor",
+		Conditions: []types.Condition{{Type: "KernelDeadlock", Status: types.False, Transition: now, Reason: "KernelHasNoDeadlock"}},
+	})
+
+	expected := `{"time":"2020-01-02T03:04:05Z","kind":"export","report":{"apiVersion":"nodeproblemdetector.k8s.io/v1","node":"test-node","source":"kernel-monitor","events":[{"severity":"warn","timestamp":"2020-01-02T03:04:05Z","reason":"OOMKilling","message":"killed"}]}}
+{"time":"2020-01-02T03:04:05Z","kind":"sync","report":{"apiVersion":"nodeproblemdetector.k8s.io/v1","node":"test-node","source":"kernel-monitor","conditions":[{"type":"KernelDeadlock","status":"False","transition":"2020-01-02T03:04:05Z","reason":"KernelHasNoDeadlock","message":""}]}}
+`
+	assert.Equal(t, expected, output.String())
+}
+
+func TestDryRunExporterWithoutOutput(t *testing.T) {
+	de := newDryRunExporter(nil, "test-node")
+	// Nothing is written, and nothing panics.
+	de.ExportProblems(&types.Status{Source: "kernel-monitor"})
+	de.SyncProblems(&types.Status{Source: "kernel-monitor"})
+}
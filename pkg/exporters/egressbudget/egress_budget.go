@@ -0,0 +1,216 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package egressbudget limits the bytes push exporters send per minute, for nodes
+// behind constrained links. When the budget is exceeded, conditions are sent before
+// warning events, and warning events before info events. Conditions which do not fit
+// are deferred to the next export, events which do not fit are dropped.
+package egressbudget
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// Budget is a token bucket of bytes shared by all push exporters. It refills at
+// bytesPerMinute, and holds at most one minute of budget.
+type Budget struct {
+	sync.Mutex
+	bytesPerMinute float64
+	available      float64
+	last           time.Time
+	clock          clock.Clock
+}
+
+// NewBudget creates a full budget of bytesPerMinute.
+func NewBudget(bytesPerMinute int64) *Budget {
+	return newBudget(bytesPerMinute, clock.RealClock{})
+}
+
+func newBudget(bytesPerMinute int64, clock clock.Clock) *Budget {
+	return &Budget{
+		bytesPerMinute: float64(bytesPerMinute),
+		available:      float64(bytesPerMinute),
+		last:           clock.Now(),
+		clock:          clock,
+	}
+}
+
+// take takes n bytes from the budget, and returns false without taking anything if
+// there are fewer than n bytes available.
+func (b *Budget) take(n int) bool {
+	b.Lock()
+	defer b.Unlock()
+	now := b.clock.Now()
+	b.available += now.Sub(b.last).Minutes() * b.bytesPerMinute
+	if b.available > b.bytesPerMinute {
+		b.available = b.bytesPerMinute
+	}
+	b.last = now
+	if float64(n) > b.available {
+		return false
+	}
+	b.available -= float64(n)
+	return true
+}
+
+// WrapPushExporters limits the push exporters in the list by the budget, and returns
+// the other exporters as is.
+func WrapPushExporters(exporters []types.Exporter, budget *Budget) []types.Exporter {
+	wrapped := make([]types.Exporter, 0, len(exporters))
+	for _, exporter := range exporters {
+		if pe, ok := exporter.(types.PushExporter); ok && pe.PushesProblems() {
+			exporter = NewExporter(exporter, budget)
+		}
+		wrapped = append(wrapped, exporter)
+	}
+	return wrapped
+}
+
+const (
+	conditionPriority = iota
+	criticalPriority
+	warningPriority
+	infoPriority
+)
+
+// item is a condition or an event of a status.
+type item struct {
+	source    string
+	priority  int
+	size      int
+	condition *types.Condition
+	event     *types.Event
+}
+
+type budgetedExporter struct {
+	exporter types.Exporter
+	budget   *Budget
+	// pending are the conditions deferred because of the budget, keyed by source and
+	// condition type.
+	pending map[string]map[string]types.Condition
+}
+
+// NewExporter limits the exporter by the budget.
+func NewExporter(exporter types.Exporter, budget *Budget) types.Exporter {
+	return &budgetedExporter{
+		exporter: exporter,
+		budget:   budget,
+		pending:  make(map[string]map[string]types.Condition),
+	}
+}
+
+func (be *budgetedExporter) ExportProblems(status *types.Status) {
+	be.send(status, be.exporter.ExportProblems)
+}
+
+func (be *budgetedExporter) SyncProblems(status *types.Status) {
+	be.send(status, be.exporter.SyncProblems)
+}
+
+// send sends the pending conditions and the status within the budget, in the order of
+// priority.
+func (be *budgetedExporter) send(status *types.Status, export func(*types.Status)) {
+	// The conditions in the status are newer than the pending ones.
+	for _, condition := range status.Conditions {
+		delete(be.pending[status.Source], condition.Type)
+	}
+	var items []*item
+	for source, conditions := range be.pending {
+		for _, condition := range conditions {
+			condition := condition
+			items = append(items, newItem(source, conditionPriority, &condition, nil))
+		}
+	}
+	be.pending = make(map[string]map[string]types.Condition)
+	for i := range status.Conditions {
+		items = append(items, newItem(status.Source, conditionPriority, &status.Conditions[i], nil))
+	}
+	for i := range status.Events {
+		priority := infoPriority
+		switch status.Events[i].Severity {
+		case types.Critical:
+			priority = criticalPriority
+		case types.Warn:
+			priority = warningPriority
+		}
+		items = append(items, newItem(status.Source, priority, nil, &status.Events[i]))
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].priority < items[j].priority })
+
+	sent := map[string]*types.Status{}
+	var sources []string
+	droppedEvents, deferredConditions := 0, 0
+	overBudget := false
+	for _, it := range items {
+		if !overBudget && !be.budget.take(it.size) {
+			overBudget = true
+		}
+		if overBudget {
+			if it.condition != nil {
+				be.deferCondition(it.source, *it.condition)
+				deferredConditions++
+			} else {
+				droppedEvents++
+			}
+			continue
+		}
+		s, ok := sent[it.source]
+		if !ok {
+			s = &types.Status{Source: it.source}
+			sent[it.source] = s
+			sources = append(sources, it.source)
+		}
+		if it.condition != nil {
+			s.Conditions = append(s.Conditions, *it.condition)
+		} else {
+			s.Events = append(s.Events, *it.event)
+		}
+	}
+	if overBudget {
+		glog.Warningf("Egress budget exceeded: deferred %d conditions, dropped %d events", deferredConditions, droppedEvents)
+	}
+	for _, source := range sources {
+		export(sent[source])
+	}
+}
+
+func (be *budgetedExporter) deferCondition(source string, condition types.Condition) {
+	if _, ok := be.pending[source]; !ok {
+		be.pending[source] = make(map[string]types.Condition)
+	}
+	be.pending[source][condition.Type] = condition
+}
+
+// newItem creates an item, whose size is estimated by its JSON encoding.
+func newItem(source string, priority int, condition *types.Condition, event *types.Event) *item {
+	it := &item{source: source, priority: priority, condition: condition, event: event}
+	var raw []byte
+	if condition != nil {
+		raw, _ = json.Marshal(condition)
+	} else {
+		raw, _ = json.Marshal(event)
+	}
+	it.size = len(source) + len(raw)
+	return it
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package egressbudget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/exporters/memoryexporter"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// pushExporter is an in-memory exporter pushing problems.
+type pushExporter struct {
+	*memoryexporter.Exporter
+}
+
+func (p pushExporter) PushesProblems() bool { return true }
+
+func TestBudgetRefill(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	budget := newBudget(600, fakeClock)
+
+	assert.True(t, budget.take(600))
+	assert.False(t, budget.take(1))
+
+	fakeClock.Step(10 * time.Second)
+	assert.True(t, budget.take(100))
+	assert.False(t, budget.take(1))
+
+	// The budget holds at most one minute of bytes.
+	fakeClock.Step(time.Hour)
+	assert.False(t, budget.take(601))
+	assert.True(t, budget.take(600))
+}
+
+func TestExportByPriority(t *testing.T) {
+	now := time.Now()
+	condition := types.Condition{Type: "KernelDeadlock", Status: types.True, Transition: now, Reason: "DockerHung"}
+	warning := types.Event{Severity: types.Warn, Timestamp: now, Reason: "TaskHung"}
+	info := types.Event{Severity: types.Info, Timestamp: now, Reason: "Recovered"}
+	status := &types.Status{
+		Source:     "kernel-monitor",
+		Events:     []types.Event{info, warning},
+		Conditions: []types.Condition{condition},
+	}
+	size := func(it *item) int { return it.size }
+	conditionSize := size(newItem(status.Source, conditionPriority, &condition, nil))
+	warningSize := size(newItem(status.Source, warningPriority, nil, &warning))
+
+	fakeClock := clock.NewFakeClock(now)
+	fake := pushExporter{memoryexporter.NewExporter()}
+	exporter := NewExporter(fake, newBudget(int64(conditionSize+warningSize), fakeClock))
+
+	// The info event does not fit and is dropped.
+	exporter.ExportProblems(status)
+	assert.Equal(t, []*types.Status{{
+		Source:     "kernel-monitor",
+		Events:     []types.Event{warning},
+		Conditions: []types.Condition{condition},
+	}}, fake.Exported())
+
+	// The condition does not fit and is deferred, the event is dropped.
+	fake.Reset()
+	exporter.ExportProblems(&types.Status{Source: "kernel-monitor", Events: []types.Event{warning}, Conditions: []types.Condition{condition}})
+	assert.Empty(t, fake.Exported())
+
+	// The deferred condition is sent first once the budget refills.
+	fakeClock.Step(time.Minute)
+	exporter.ExportProblems(&types.Status{Source: "docker-monitor", Events: []types.Event{warning}})
+	assert.Equal(t, []*types.Status{
+		{Source: "kernel-monitor", Conditions: []types.Condition{condition}},
+		{Source: "docker-monitor", Events: []types.Event{warning}},
+	}, fake.Exported())
+}
+
+func TestWrapPushExporters(t *testing.T) {
+	push := pushExporter{memoryexporter.NewExporter()}
+	exporters := WrapPushExporters([]types.Exporter{push}, NewBudget(100))
+	_, wrapped := exporters[0].(*budgetedExporter)
+	assert.True(t, wrapped)
+}
+
+func TestExportCriticalFirst(t *testing.T) {
+	now := time.Now()
+	warning := types.Event{Severity: types.Warn, Timestamp: now, Reason: "TaskHung"}
+	critical := types.Event{Severity: types.Critical, Timestamp: now, Reason: "KernelPanic"}
+	criticalSize := newItem("kernel-monitor", criticalPriority, nil, &critical).size
+
+	fake := pushExporter{memoryexporter.NewExporter()}
+	exporter := NewExporter(fake, newBudget(int64(criticalSize), clock.NewFakeClock(now)))
+
+	// The warning event does not fit after the critical one and is dropped.
+	exporter.ExportProblems(&types.Status{Source: "kernel-monitor", Events: []types.Event{warning, critical}})
+	assert.Equal(t, []*types.Status{{Source: "kernel-monitor", Events: []types.Event{critical}}}, fake.Exported())
+}
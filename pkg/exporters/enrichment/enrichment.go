@@ -0,0 +1,241 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package enrichment enriches the exported problems with selected labels and annotations
+// of the node, e.g. its topology zone, instance type or node pool, so that downstream
+// systems can route and analyze the problems without joining them with the nodes.
+package enrichment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+// defaultRefreshPeriod is the default period at which the node is refreshed.
+const defaultRefreshPeriod = 5 * time.Minute
+
+// Config is the configuration of the node enrichment.
+type Config struct {
+	// Labels are the node labels added to the problems, keyed by the name they are added
+	// as, e.g. "zone": "topology.kubernetes.io/zone".
+	Labels map[string]string `json:"labels"`
+	// Annotations are the node annotations added to the problems, keyed by the name they
+	// are added as.
+	Annotations map[string]string `json:"annotations"`
+	// RefreshPeriodString is the period at which the node is refreshed from the apiserver.
+	// Default to 5m.
+	RefreshPeriodString string        `json:"refreshPeriod"`
+	RefreshPeriod       time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() error {
+	c.RefreshPeriod = defaultRefreshPeriod
+	if c.RefreshPeriodString != "" {
+		var err error
+		if c.RefreshPeriod, err = time.ParseDuration(c.RefreshPeriodString); err != nil {
+			return fmt.Errorf("invalid refresh period %q: %v", c.RefreshPeriodString, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *Config) Validate() error {
+	if c.RefreshPeriod <= 0 {
+		return fmt.Errorf("refresh period %v must be positive", c.RefreshPeriod)
+	}
+	if len(c.Labels) == 0 && len(c.Annotations) == 0 {
+		return fmt.Errorf("no node label or annotation is selected")
+	}
+	for name, key := range c.Labels {
+		if err := validateName(name, key, "label"); err != nil {
+			return err
+		}
+		if _, ok := c.Annotations[name]; ok {
+			return fmt.Errorf("name %q is used by both a label and an annotation", name)
+		}
+	}
+	for name, key := range c.Annotations {
+		if err := validateName(name, key, "annotation"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateName validates the name a node label or annotation is added as. The names are
+// the keys of event annotations, after the prefix of node-problem-detector.
+func validateName(name, key, kind string) error {
+	if errs := validation.IsQualifiedName(name); len(errs) > 0 || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid name %q of node %s %q: must be a qualified name without prefix", name, kind, key)
+	}
+	if key == "" {
+		return fmt.Errorf("node %s of name %q must not be empty", kind, name)
+	}
+	return nil
+}
+
+// LoadConfig loads the node enrichment config from a file.
+func LoadConfig(configPath string) (*Config, error) {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	var config Config
+	if err := util.UnmarshalStrict(f, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return nil, fmt.Errorf("failed to apply configuration file %q: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", configPath, err)
+	}
+	return &config, nil
+}
+
+// NodeFunc returns the node.
+type NodeFunc func() (*v1.Node, error)
+
+// Enricher returns the selected metadata of the node. It is thread-safe.
+type Enricher struct {
+	config  *Config
+	clock   clock.Clock
+	getNode NodeFunc
+
+	mutex sync.Mutex
+	// metadata is the last metadata of the node, refreshed every refresh period.
+	metadata  map[string]string
+	refreshed time.Time
+}
+
+// NewEnricher creates an enricher of the node got with getNode.
+func NewEnricher(config *Config, getNode NodeFunc) *Enricher {
+	return newEnricher(config, getNode, clock.RealClock{})
+}
+
+func newEnricher(config *Config, getNode NodeFunc, clock clock.Clock) *Enricher {
+	return &Enricher{
+		config:  config,
+		clock:   clock,
+		getNode: getNode,
+	}
+}
+
+// Metadata returns the selected labels and annotations of the node by name, refreshed
+// when the refresh period has passed. The last metadata is kept when the refresh fails.
+// Labels and annotations the node does not have are left out. The returned map must not
+// be modified.
+func (e *Enricher) Metadata() map[string]string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	now := e.clock.Now()
+	if !e.refreshed.IsZero() && now.Sub(e.refreshed) < e.config.RefreshPeriod {
+		return e.metadata
+	}
+	e.refreshed = now
+	node, err := e.getNode()
+	if err != nil {
+		glog.Errorf("Failed to refresh the node metadata for the enrichment of problems: %v", err)
+		return e.metadata
+	}
+	metadata := map[string]string{}
+	for name, key := range e.config.Labels {
+		if value, ok := node.Labels[key]; ok {
+			metadata[name] = value
+		}
+	}
+	for name, key := range e.config.Annotations {
+		if value, ok := node.Annotations[key]; ok {
+			metadata[name] = value
+		}
+	}
+	e.metadata = metadata
+	return e.metadata
+}
+
+// Enrich returns a copy of the status with the node metadata. The metadata is set as the
+// node of the status, and added to the annotations of the events, without overriding
+// the annotations set by the problem daemons.
+func (e *Enricher) Enrich(status *types.Status) *types.Status {
+	metadata := e.Metadata()
+	if len(metadata) == 0 {
+		return status
+	}
+	enriched := *status
+	enriched.Node = metadata
+	enriched.Events = nil
+	for _, event := range status.Events {
+		annotations := make(map[string]string, len(event.Annotations)+len(metadata))
+		for k, v := range metadata {
+			annotations[k] = v
+		}
+		for k, v := range event.Annotations {
+			annotations[k] = v
+		}
+		event.Annotations = annotations
+		enriched.Events = append(enriched.Events, event)
+	}
+	return &enriched
+}
+
+// WrapExporters enriches the problems exported by all exporters in the list. The exporters
+// must be wrapped before other wrappers, which do not copy the node of the statuses.
+func WrapExporters(exporters []types.Exporter, enricher *Enricher) []types.Exporter {
+	wrapped := make([]types.Exporter, 0, len(exporters))
+	for _, exporter := range exporters {
+		wrapped = append(wrapped, NewExporter(exporter, enricher))
+	}
+	return wrapped
+}
+
+type enrichedExporter struct {
+	exporter types.Exporter
+	enricher *Enricher
+}
+
+// NewExporter enriches the problems exported by the exporter with the node metadata.
+func NewExporter(exporter types.Exporter, enricher *Enricher) types.Exporter {
+	return &enrichedExporter{exporter: exporter, enricher: enricher}
+}
+
+func (ee *enrichedExporter) ExportProblems(status *types.Status) {
+	ee.exporter.ExportProblems(ee.enricher.Enrich(status))
+}
+
+func (ee *enrichedExporter) SyncProblems(status *types.Status) {
+	ee.exporter.SyncProblems(ee.enricher.Enrich(status))
+}
+
+// PushesProblems returns whether the wrapped exporter pushes problems, so that push
+// exporters enriched are still limited by the egress budget.
+func (ee *enrichedExporter) PushesProblems() bool {
+	pe, ok := ee.exporter.(types.PushExporter)
+	return ok && pe.PushesProblems()
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package enrichment
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/exporters/memoryexporter"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestValidate(t *testing.T) {
+	for desc, test := range map[string]struct {
+		config Config
+		valid  bool
+	}{
+		"valid": {
+			config: Config{
+				Labels:      map[string]string{"zone": "topology.kubernetes.io/zone", "node_pool": "cloud.google.com/gke-nodepool"},
+				Annotations: map[string]string{"owner": "example.com/owner"},
+			},
+			valid: true,
+		},
+		"nothing selected": {
+			config: Config{},
+		},
+		"name with prefix": {
+			config: Config{Labels: map[string]string{"topology.kubernetes.io/zone": "topology.kubernetes.io/zone"}},
+		},
+		"invalid name": {
+			config: Config{Labels: map[string]string{"zone!": "topology.kubernetes.io/zone"}},
+		},
+		"empty key": {
+			config: Config{Labels: map[string]string{"zone": ""}},
+		},
+		"duplicated name": {
+			config: Config{
+				Labels:      map[string]string{"zone": "topology.kubernetes.io/zone"},
+				Annotations: map[string]string{"zone": "example.com/zone"},
+			},
+		},
+		"invalid refresh period": {
+			config: Config{Labels: map[string]string{"zone": "topology.kubernetes.io/zone"}, RefreshPeriodString: "0s"},
+		},
+	} {
+		err := test.config.ApplyConfiguration()
+		if err == nil {
+			err = test.config.Validate()
+		}
+		assert.Equal(t, test.valid, err == nil, desc)
+	}
+}
+
+func newTestEnricher(t *testing.T, getNode NodeFunc) (*Enricher, *clock.FakeClock) {
+	config := &Config{
+		Labels:      map[string]string{"zone": "topology.kubernetes.io/zone", "node-pool": "cloud.google.com/gke-nodepool"},
+		Annotations: map[string]string{"owner": "example.com/owner"},
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	fakeClock := clock.NewFakeClock(time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC))
+	return newEnricher(config, getNode, fakeClock), fakeClock
+}
+
+func TestMetadata(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Labels:      map[string]string{"topology.kubernetes.io/zone": "us-central1-a", "kubernetes.io/os": "linux"},
+		Annotations: map[string]string{"example.com/owner": "team-a"},
+	}}
+	var err error
+	requests := 0
+	e, fakeClock := newTestEnricher(t, func() (*v1.Node, error) {
+		requests++
+		return node, err
+	})
+
+	// Labels and annotations the node does not have are left out.
+	expected := map[string]string{"zone": "us-central1-a", "owner": "team-a"}
+	assert.Equal(t, expected, e.Metadata())
+	node = node.DeepCopy()
+	node.Labels["topology.kubernetes.io/zone"] = "us-central1-b"
+	assert.Equal(t, expected, e.Metadata(), "the node is refreshed every refresh period")
+	assert.Equal(t, 1, requests)
+	fakeClock.Step(defaultRefreshPeriod)
+	expected = map[string]string{"zone": "us-central1-b", "owner": "team-a"}
+	assert.Equal(t, expected, e.Metadata())
+	assert.Equal(t, 2, requests)
+
+	// The last metadata is kept when the refresh fails.
+	err = errors.New("apiserver unavailable")
+	fakeClock.Step(defaultRefreshPeriod)
+	assert.Equal(t, expected, e.Metadata())
+	assert.Equal(t, 3, requests)
+}
+
+func TestExportProblems(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Labels: map[string]string{"topology.kubernetes.io/zone": "us-central1-a"},
+	}}
+	e, _ := newTestEnricher(t, func() (*v1.Node, error) { return node, nil })
+	fake := memoryexporter.NewExporter()
+	exporter := NewExporter(fake, e)
+
+	status := &types.Status{
+		Source: "kernel-monitor",
+		Events: []types.Event{
+			{Severity: types.Warn, Reason: "TaskHung"},
+			{Severity: types.Warn, Reason: "OOMKilling", Annotations: map[string]string{"zone": "from-rule", "process": "stress"}},
+		},
+	}
+	enriched := e.Enrich(status)
+	assert.Equal(t, map[string]string{"zone": "us-central1-a"}, enriched.Node)
+	assert.Equal(t, map[string]string{"zone": "us-central1-a"}, enriched.Events[0].Annotations)
+	// The annotations of the problem daemons are not overridden.
+	assert.Equal(t, map[string]string{"zone": "from-rule", "process": "stress"}, enriched.Events[1].Annotations)
+	assert.Nil(t, status.Node, "the exported status is not modified")
+	assert.Nil(t, status.Events[0].Annotations, "the exported status is not modified")
+
+	exporter.ExportProblems(status)
+	events := fake.Events("kernel-monitor")
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "us-central1-a", events[0].Annotations["zone"])
+	}
+}
+
+func TestEnrichWithoutMetadata(t *testing.T) {
+	e, _ := newTestEnricher(t, func() (*v1.Node, error) { return nil, errors.New("apiserver unavailable") })
+	status := &types.Status{Source: "kernel-monitor", Events: []types.Event{{Reason: "TaskHung"}}}
+	assert.Equal(t, status, e.Enrich(status))
+}
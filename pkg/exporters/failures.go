@@ -0,0 +1,51 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporters
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+var (
+	failures     metrics.Int64MetricInterface
+	failuresOnce sync.Once
+)
+
+// RecordFailure counts a failure of the exporter to export problems or metrics. The
+// operation is what failed, e.g. "conditions" or "events".
+func RecordFailure(exporter, operation string) {
+	failuresOnce.Do(func() {
+		metric, err := metrics.NewInt64Metric(
+			metrics.ExporterFailuresID,
+			string(metrics.ExporterFailuresID),
+			"Number of failures of exporters to export problems or metrics.",
+			"1",
+			metrics.Sum,
+			[]string{"exporter", "operation"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.ExporterFailuresID, err)
+		}
+		failures = metric
+	})
+	if err := failures.Record(map[string]string{"exporter": exporter, "operation": operation}, 1); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.ExporterFailuresID, err)
+	}
+}
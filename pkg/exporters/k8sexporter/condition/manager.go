@@ -17,15 +17,22 @@ limitations under the License.
 package condition
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"k8s.io/node-problem-detector/pkg/exporters"
 	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
 	"k8s.io/node-problem-detector/pkg/types"
 	problemutil "k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/liveness"
 
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/clock"
 
 	"github.com/golang/glog"
@@ -34,8 +41,18 @@ import (
 const (
 	// updatePeriod is the period at which condition manager checks update.
 	updatePeriod = 1 * time.Second
-	// resyncPeriod is the period at which condition manager does resync, only updates when needed.
-	resyncPeriod = 10 * time.Second
+	// livenessTimeout is the time after which the sync loop is considered stalled, e.g.
+	// when it is blocked on the apiserver.
+	livenessTimeout = 1 * time.Minute
+
+	// reconcileSource and reconcileReason are the source and reason of the event
+	// reporting the reconciliation after a sync recovers from failures.
+	reconcileSource = "node-problem-detector"
+	reconcileReason = "ConditionsReconciled"
+
+	// reconnectCause and recreateCause are the causes of re-asserting the conditions.
+	reconnectCause = "reconnecting to the apiserver"
+	recreateCause  = "the node object was re-created"
 )
 
 // ConditionManager synchronizes node conditions with the apiserver with problem client.
@@ -45,8 +62,16 @@ const (
 // 3) No one else could change the node conditions maintained by node problem detector.
 // ConditionManager checks every updatePeriod to see whether there is node condition update. If there are any,
 // it will synchronize with the apiserver. This addresses 1) and 2).
-// ConditionManager synchronizes with apiserver every resyncPeriod no matter there is node condition update or
+// ConditionManager synchronizes with apiserver every heartbeatPeriod no matter there is node condition update or
 // not. This addresses 3).
+// When a sync fails, ConditionManager retries it with exponential backoff. The updates received meanwhile are
+// merged into the latest condition of each type, and all of them are synchronized by the first successful retry.
+// Each retry gets the conditions on the node first, and only sets them once they can be got, so that the conditions
+// removed or changed by others during the outage are compared with the ones of ConditionManager once, and reported
+// in an event once they are repaired.
+// When a resync check period is set, ConditionManager also gets the node at that period, and re-asserts all conditions
+// right away when the node can be got again after failures, or when its UID changed, e.g. because the node object was
+// deleted and re-created during an upgrade, instead of waiting for the next heartbeat.
 type ConditionManager interface {
 	// Start starts the condition manager.
 	Start()
@@ -54,37 +79,71 @@ type ConditionManager interface {
 	UpdateCondition(types.Condition)
 	// GetConditions returns all current conditions.
 	GetConditions() []types.Condition
+	// RemoveCondition removes a condition which is not managed by the condition manager
+	// from the node, e.g. a condition set by an older configuration.
+	RemoveCondition(conditionType string)
+	// DeliveredUntil returns the time before which all updates and removals were
+	// synchronized with the apiserver.
+	DeliveredUntil() time.Time
 }
 
 type conditionManager struct {
-	// Only 2 fields will be accessed by more than one goroutines at the same time:
+	// Only 3 fields will be accessed by more than one goroutines at the same time:
 	// * `updates`: updates will be written by random caller and the sync routine,
 	// so it needs to be protected by write lock in both `UpdateCondition` and
 	// `needUpdates`.
+	// * `removals`: removals will be written by random caller and the sync routine,
+	// so it needs to be protected by write lock in both `RemoveCondition` and
+	// `takeRemovals`.
 	// * `conditions`: conditions will only be written in the sync routine, but
 	// it will be read by random caller and the sync routine. So it needs to be
 	// protected by write lock in `needUpdates` and read lock in `GetConditions`.
 	// No lock is needed in `sync`, because it is in the same goroutine with the
 	// write operation.
+	// * `delivered`: delivered will only be written in the sync routine, and read by
+	// random caller, so it is protected by write lock in `syncOnce` and read lock in
+	// `DeliveredUntil`.
 	sync.RWMutex
 	clock        clock.Clock
 	latestTry    time.Time
 	resyncNeeded bool
-	client       problemclient.Client
-	updates      map[string]types.Condition
-	conditions   map[string]types.Condition
+	// retry decides the backoff after failed syncs, backoff is the current one.
+	retry      problemclient.RetryPolicy
+	backoff    time.Duration
+	failures   int
+	client     problemclient.Client
+	updates    map[string]types.Condition
+	conditions map[string]types.Condition
+	removals   map[string]bool
 	// heartbeatPeriod is the period at which condition manager does forcibly sync with apiserver.
 	heartbeatPeriod time.Duration
+	// resyncCheckPeriod is the period at which the node is got to detect a recovered
+	// apiserver connection or a re-created node object. 0 disables the checks.
+	resyncCheckPeriod time.Duration
+	latestCheck       time.Time
+	// nodeUID is the UID of the node at the last successful check.
+	nodeUID k8stypes.UID
+	// checkFailure is the cause of re-asserting the conditions once a check succeeds
+	// after the node could not be got, empty if the last check succeeded.
+	checkFailure string
+	// reassertCause is the cause of re-asserting all conditions at the next sync, empty
+	// if they need not be re-asserted.
+	reassertCause string
+	// delivered is the time before which all updates and removals were synchronized.
+	delivered time.Time
 }
 
 // NewConditionManager creates a condition manager.
-func NewConditionManager(client problemclient.Client, clock clock.Clock, heartbeatPeriod time.Duration) ConditionManager {
+func NewConditionManager(client problemclient.Client, clock clock.Clock, heartbeatPeriod, resyncCheckPeriod time.Duration, retry problemclient.RetryPolicy) ConditionManager {
 	return &conditionManager{
-		client:          client,
-		clock:           clock,
-		updates:         make(map[string]types.Condition),
-		conditions:      make(map[string]types.Condition),
-		heartbeatPeriod: heartbeatPeriod,
+		client:            client,
+		clock:             clock,
+		retry:             retry,
+		updates:           make(map[string]types.Condition),
+		conditions:        make(map[string]types.Condition),
+		removals:          make(map[string]bool),
+		heartbeatPeriod:   heartbeatPeriod,
+		resyncCheckPeriod: resyncCheckPeriod,
 	}
 }
 
@@ -100,6 +159,12 @@ func (c *conditionManager) UpdateCondition(condition types.Condition) {
 	c.updates[condition.Type] = condition
 }
 
+func (c *conditionManager) RemoveCondition(conditionType string) {
+	c.Lock()
+	defer c.Unlock()
+	c.removals[conditionType] = true
+}
+
 func (c *conditionManager) GetConditions() []types.Condition {
 	c.RLock()
 	defer c.RUnlock()
@@ -116,13 +181,38 @@ func (c *conditionManager) syncLoop() {
 	for {
 		select {
 		case <-ticker.C():
-			if c.needUpdates() || c.needResync() || c.needHeartbeat() {
-				c.sync()
-			}
+			c.syncOnce()
+			liveness.Beat("k8s-exporter-condition-manager", livenessTimeout)
 		}
 	}
 }
 
+// syncOnce synchronizes the updates and removals received so far if needed.
+func (c *conditionManager) syncOnce() {
+	now := c.clock.Now()
+	// Updates are merged while backing off, and synchronized by the retry.
+	updated := c.needUpdates()
+	if c.needCheck() {
+		c.checkNode()
+	}
+	if !c.backingOff() && (updated || c.needRemovals() || c.needResync() || c.needReassert() || c.needHeartbeat()) {
+		c.sync()
+	}
+	// The updates and removals received before now are synchronized unless the sync
+	// failed.
+	if !c.resyncNeeded {
+		c.Lock()
+		c.delivered = now
+		c.Unlock()
+	}
+}
+
+func (c *conditionManager) DeliveredUntil() time.Time {
+	c.RLock()
+	defer c.RUnlock()
+	return c.delivered
+}
+
 // needUpdates checks whether there are recent updates.
 func (c *conditionManager) needUpdates() bool {
 	c.Lock()
@@ -138,10 +228,70 @@ func (c *conditionManager) needUpdates() bool {
 	return needUpdate
 }
 
+// needRemovals checks whether there are conditions to remove.
+func (c *conditionManager) needRemovals() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.removals) > 0
+}
+
+// takeRemovals returns the conditions to remove, and clears them.
+func (c *conditionManager) takeRemovals() []v1.NodeConditionType {
+	c.Lock()
+	defer c.Unlock()
+	var removals []v1.NodeConditionType
+	for t := range c.removals {
+		removals = append(removals, v1.NodeConditionType(t))
+		delete(c.removals, t)
+	}
+	return removals
+}
+
 // needResync checks whether a resync is needed.
 func (c *conditionManager) needResync() bool {
 	// Only update when resync is needed.
-	return c.clock.Since(c.latestTry) >= resyncPeriod && c.resyncNeeded
+	return c.resyncNeeded && !c.backingOff()
+}
+
+// backingOff checks whether the last sync failed and its backoff has not passed yet.
+func (c *conditionManager) backingOff() bool {
+	return c.resyncNeeded && c.clock.Since(c.latestTry) < c.backoff
+}
+
+// needCheck checks whether the node should be checked for a recovered apiserver connection
+// or a re-created node object.
+func (c *conditionManager) needCheck() bool {
+	return c.resyncCheckPeriod > 0 && c.clock.Since(c.latestCheck) >= c.resyncCheckPeriod
+}
+
+// checkNode gets the node, and requests re-asserting all conditions if it is got after
+// failures, or if its UID changed since the last check.
+func (c *conditionManager) checkNode() {
+	c.latestCheck = c.clock.Now()
+	node, err := c.client.GetNode()
+	if err != nil {
+		if c.checkFailure == "" {
+			glog.Warningf("failed to get node, conditions will be re-asserted once it is got: %v", err)
+		}
+		// A node which is not found is expected to be re-created.
+		c.checkFailure = reconnectCause
+		if apierrors.IsNotFound(err) {
+			c.checkFailure = recreateCause
+		}
+		return
+	}
+	if c.nodeUID != "" && node.UID != c.nodeUID {
+		c.reassertCause = recreateCause
+	} else if c.checkFailure != "" {
+		c.reassertCause = c.checkFailure
+	}
+	c.nodeUID = node.UID
+	c.checkFailure = ""
+}
+
+// needReassert checks whether all conditions need to be re-asserted.
+func (c *conditionManager) needReassert() bool {
+	return c.reassertCause != ""
 }
 
 // needHeartbeat checks whether a forcible heartbeat is needed.
@@ -153,14 +303,129 @@ func (c *conditionManager) needHeartbeat() bool {
 func (c *conditionManager) sync() {
 	c.latestTry = c.clock.Now()
 	c.resyncNeeded = false
+	// A failed sync is retried, and reconciled after reconnecting, with all conditions.
+	reassertCause := c.reassertCause
+	c.reassertCause = ""
+	removalsFailed := false
+	if removals := c.takeRemovals(); len(removals) > 0 {
+		if err := c.client.RemoveConditions(removals); err != nil {
+			glog.Errorf("failed to remove node conditions %v: %v", removals, err)
+			exporters.RecordFailure("k8s", "conditions")
+			for _, t := range removals {
+				c.RemoveCondition(string(t))
+			}
+			removalsFailed = true
+		}
+	}
 	conditions := []v1.NodeCondition{}
 	for i := range c.conditions {
 		conditions = append(conditions, problemutil.ConvertToAPICondition(c.conditions[i]))
 	}
+	var diverged *divergence
+	if c.failures > 0 || (reassertCause != "" && len(conditions) > 0) {
+		var err error
+		if diverged, err = c.diverge(conditions); err != nil {
+			glog.Errorf("failed to get node conditions to reconcile: %v", err)
+			if c.failures > 0 {
+				// The apiserver is still unreachable, the retry fails without setting the
+				// conditions.
+				exporters.RecordFailure("k8s", "conditions")
+				c.failed()
+				return
+			}
+		}
+	}
 	if err := c.client.SetConditions(conditions); err != nil {
 		// The conditions will be updated again in future sync
 		glog.Errorf("failed to update node conditions: %v", err)
-		c.resyncNeeded = true
+		exporters.RecordFailure("k8s", "conditions")
+		c.failed()
+		return
+	}
+	if removalsFailed {
+		c.failed()
 		return
 	}
+	if c.failures > 0 {
+		glog.Infof("Synchronized node conditions after %d failed attempts", c.failures)
+		reassertCause = reconnectCause
+	} else if reassertCause != "" {
+		glog.Infof("Re-asserted node conditions after %s", reassertCause)
+	}
+	if diverged != nil {
+		c.report(len(conditions), diverged, reassertCause)
+	}
+	if c.checkFailure != "" {
+		// All conditions are re-asserted already, the node is re-checked from scratch.
+		c.checkFailure = ""
+		c.nodeUID = ""
+	}
+	c.failures = 0
+	c.backoff = 0
+}
+
+// failed schedules a retry of the failed sync after the next backoff.
+func (c *conditionManager) failed() {
+	c.resyncNeeded = true
+	c.failures++
+	c.backoff = c.retry.NextBackoff(c.backoff)
+}
+
+// divergence is the difference between the conditions on the node and the ones of the
+// condition manager.
+type divergence struct {
+	// missing are the types of the conditions which are not on the node.
+	missing []string
+	// changed are the types of the conditions whose status, reason or message on the node
+	// is different.
+	changed []string
+}
+
+// diverge compares the conditions on the node with the expected ones.
+func (c *conditionManager) diverge(expected []v1.NodeCondition) (*divergence, error) {
+	var conditionTypes []v1.NodeConditionType
+	for _, condition := range expected {
+		conditionTypes = append(conditionTypes, condition.Type)
+	}
+	actual, err := c.client.GetConditions(conditionTypes)
+	if err != nil {
+		return nil, err
+	}
+	onNode := make(map[v1.NodeConditionType]*v1.NodeCondition)
+	for _, condition := range actual {
+		onNode[condition.Type] = condition
+	}
+	d := &divergence{}
+	for _, condition := range expected {
+		got, ok := onNode[condition.Type]
+		if !ok {
+			d.missing = append(d.missing, string(condition.Type))
+			continue
+		}
+		if got.Status != condition.Status || got.Reason != condition.Reason || got.Message != condition.Message {
+			d.changed = append(d.changed, string(condition.Type))
+		}
+	}
+	sort.Strings(d.missing)
+	sort.Strings(d.changed)
+	return d, nil
+}
+
+// report reports the conditions repaired after the cause in a warning event. Nothing is
+// reported when no condition was repaired.
+func (c *conditionManager) report(total int, d *divergence, cause string) {
+	if len(d.missing) == 0 && len(d.changed) == 0 {
+		glog.Infof("Reconciled %d node conditions after %s, no divergence found", total, cause)
+		return
+	}
+	var repaired []string
+	if len(d.missing) > 0 {
+		repaired = append(repaired, fmt.Sprintf("restored missing conditions %s", strings.Join(d.missing, ", ")))
+	}
+	if len(d.changed) > 0 {
+		repaired = append(repaired, fmt.Sprintf("reverted changed conditions %s", strings.Join(d.changed, ", ")))
+	}
+	glog.Warningf("Reconciled %d node conditions: %s", total, strings.Join(repaired, "; "))
+	c.client.Eventf(v1.EventTypeWarning, reconcileSource, reconcileReason,
+		"Reconciled %d node conditions after %s, %s", total, cause, strings.Join(repaired, "; "))
 }
@@ -28,15 +28,24 @@ import (
 	problemutil "k8s.io/node-problem-detector/pkg/util"
 
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/clock"
 )
 
-const heartbeatPeriod = 1 * time.Minute
+const (
+	heartbeatPeriod   = 1 * time.Minute
+	resyncCheckPeriod = 10 * time.Second
+)
+
+var testRetryPolicy = problemclient.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 4 * time.Second}
 
 func newTestManager() (*conditionManager, *problemclient.FakeProblemClient, *clock.FakeClock) {
 	fakeClient := problemclient.NewFakeProblemClient()
 	fakeClock := clock.NewFakeClock(time.Now())
-	manager := NewConditionManager(fakeClient, fakeClock, heartbeatPeriod)
+	manager := NewConditionManager(fakeClient, fakeClock, heartbeatPeriod, resyncCheckPeriod, testRetryPolicy)
 	return manager.(*conditionManager), fakeClient, fakeClock
 }
 
@@ -103,16 +112,49 @@ func TestResync(t *testing.T) {
 	expected := []v1.NodeCondition{problemutil.ConvertToAPICondition(condition)}
 	assert.Nil(t, fakeClient.AssertConditions(expected), "Condition should be updated via client")
 
-	assert.False(t, m.needResync(), "Should not resync before resync period")
-	fakeClock.Step(resyncPeriod)
-	assert.False(t, m.needResync(), "Should not resync after resync period without resync needed")
+	assert.False(t, m.needResync(), "Should not resync without resync needed")
+	fakeClock.Step(testRetryPolicy.MaxBackoff)
+	assert.False(t, m.needResync(), "Should not resync after backoff without resync needed")
 
 	fakeClient.InjectError("SetConditions", fmt.Errorf("injected error"))
 	m.sync()
 
-	assert.False(t, m.needResync(), "Should not resync before resync period")
-	fakeClock.Step(resyncPeriod)
-	assert.True(t, m.needResync(), "Should resync after resync period and resync is needed")
+	assert.False(t, m.needResync(), "Should not resync before backoff")
+	fakeClock.Step(testRetryPolicy.InitialBackoff)
+	assert.True(t, m.needResync(), "Should resync after backoff and resync is needed")
+}
+
+func TestSyncBackoff(t *testing.T) {
+	m, fakeClient, fakeClock := newTestManager()
+	fakeClient.InjectError("SetConditions", fmt.Errorf("injected error"))
+
+	// The backoff doubles after each failure up to the maximum.
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		m.sync()
+		fakeClock.Step(backoff - time.Millisecond)
+		assert.True(t, m.backingOff(), "Should back off for %v", backoff)
+		fakeClock.Step(time.Millisecond)
+		assert.False(t, m.backingOff(), "Should retry after %v", backoff)
+	}
+
+	// Updates received while backing off are merged and synced by the retry.
+	m.sync()
+	condition := newTestCondition("TestCondition")
+	m.UpdateCondition(condition)
+	assert.True(t, m.needUpdates())
+	assert.True(t, m.backingOff())
+	fakeClient.InjectError("SetConditions", nil)
+	fakeClock.Step(testRetryPolicy.MaxBackoff)
+	assert.True(t, m.needResync())
+	m.sync()
+	expected := []v1.NodeCondition{problemutil.ConvertToAPICondition(condition)}
+	assert.Nil(t, fakeClient.AssertConditions(expected), "Condition should be updated via client")
+
+	// The backoff is reset by the successful sync.
+	fakeClient.InjectError("SetConditions", fmt.Errorf("injected error"))
+	m.sync()
+	fakeClock.Step(testRetryPolicy.InitialBackoff)
+	assert.False(t, m.backingOff(), "Should retry after the initial backoff")
 }
 
 func TestHeartbeat(t *testing.T) {
@@ -128,3 +170,162 @@ func TestHeartbeat(t *testing.T) {
 	fakeClock.Step(heartbeatPeriod)
 	assert.True(t, m.needHeartbeat(), "Should heartbeat after heartbeat period")
 }
+
+func TestDeliveredUntil(t *testing.T) {
+	m, fakeClient, fakeClock := newTestManager()
+	assert.True(t, m.DeliveredUntil().IsZero())
+	m.UpdateCondition(newTestCondition("TestCondition"))
+	start := fakeClock.Now()
+	m.syncOnce()
+	assert.Equal(t, start, m.DeliveredUntil(), "Should be delivered after a successful sync")
+
+	// Nothing is delivered while the sync fails.
+	fakeClient.InjectError("SetConditions", fmt.Errorf("injected error"))
+	fakeClock.Step(time.Second)
+	m.UpdateCondition(newTestCondition("TestConditionNew"))
+	m.syncOnce()
+	assert.Equal(t, start, m.DeliveredUntil(), "Should not be delivered after a failed sync")
+
+	fakeClient.InjectError("SetConditions", nil)
+	fakeClock.Step(testRetryPolicy.InitialBackoff)
+	m.syncOnce()
+	assert.Equal(t, fakeClock.Now(), m.DeliveredUntil(), "Should be delivered by the retry")
+}
+
+func TestRemoveCondition(t *testing.T) {
+	m, fakeClient, _ := newTestManager()
+	old := newTestCondition("TestCondition")
+	assert.NoError(t, fakeClient.SetConditions([]v1.NodeCondition{problemutil.ConvertToAPICondition(old)}))
+	condition := newTestCondition("example.com/TestCondition")
+	m.conditions = map[string]types.Condition{condition.Type: condition}
+
+	m.RemoveCondition(old.Type)
+	assert.True(t, m.needRemovals(), "Should sync when there are conditions to remove")
+
+	fakeClient.InjectError("RemoveConditions", fmt.Errorf("injected error"))
+	m.sync()
+	assert.True(t, m.needRemovals(), "Failed removals should be retried")
+	assert.True(t, m.resyncNeeded, "Failed removals should be resynced")
+
+	fakeClient.InjectError("RemoveConditions", nil)
+	m.sync()
+	assert.False(t, m.needRemovals())
+	expected := []v1.NodeCondition{problemutil.ConvertToAPICondition(condition)}
+	assert.Nil(t, fakeClient.AssertConditions(expected), "Old condition should be removed via client")
+}
+
+func TestReconcileAfterReconnect(t *testing.T) {
+	m, fakeClient, fakeClock := newTestManager()
+	missing := newTestCondition("MissingCondition")
+	changed := newTestCondition("ChangedCondition")
+	kept := newTestCondition("KeptCondition")
+	m.conditions = map[string]types.Condition{missing.Type: missing, changed.Type: changed, kept.Type: kept}
+	m.sync()
+	assert.Empty(t, fakeClient.Events(), "Should not reconcile without failures")
+
+	// Others change and remove conditions while the apiserver is unreachable.
+	fakeClient.InjectError("SetConditions", fmt.Errorf("injected error"))
+	m.sync()
+	fakeClient.InjectError("SetConditions", nil)
+	assert.NoError(t, fakeClient.RemoveConditions([]v1.NodeConditionType{v1.NodeConditionType(missing.Type)}))
+	mangled := problemutil.ConvertToAPICondition(changed)
+	mangled.Status = v1.ConditionFalse
+	assert.NoError(t, fakeClient.SetConditions([]v1.NodeCondition{mangled}))
+
+	fakeClock.Step(testRetryPolicy.InitialBackoff)
+	m.sync()
+	expected := []v1.NodeCondition{
+		problemutil.ConvertToAPICondition(missing),
+		problemutil.ConvertToAPICondition(changed),
+		problemutil.ConvertToAPICondition(kept),
+	}
+	assert.Nil(t, fakeClient.AssertConditions(expected), "Conditions should be repaired via client")
+	assert.Equal(t, []string{"Warning ConditionsReconciled Reconciled 3 node conditions after reconnecting to the apiserver, " +
+		"restored missing conditions MissingCondition; reverted changed conditions ChangedCondition"}, fakeClient.Events())
+
+	// The retries do not set the conditions until they can be got, and a reconnect
+	// without divergence is not reported.
+	fakeClient.InjectError("SetConditions", fmt.Errorf("injected error"))
+	m.sync()
+	fakeClient.InjectError("SetConditions", nil)
+	fakeClient.InjectError("GetConditions", fmt.Errorf("injected error"))
+	assert.NoError(t, fakeClient.RemoveConditions([]v1.NodeConditionType{v1.NodeConditionType(kept.Type)}))
+	fakeClock.Step(testRetryPolicy.InitialBackoff)
+	m.sync()
+	assert.Equal(t, 2, m.failures)
+	assert.NotNil(t, fakeClient.AssertConditions(expected), "Conditions should not be set before they can be got")
+	assert.NoError(t, fakeClient.SetConditions([]v1.NodeCondition{problemutil.ConvertToAPICondition(kept)}))
+	fakeClient.InjectError("GetConditions", nil)
+	fakeClock.Step(2 * testRetryPolicy.InitialBackoff)
+	m.sync()
+	assert.Equal(t, 0, m.failures)
+	assert.Len(t, fakeClient.Events(), 1)
+}
+
+func TestReassertAfterNodeCheck(t *testing.T) {
+	m, fakeClient, fakeClock := newTestManager()
+	condition := newTestCondition("TestCondition")
+	m.conditions = map[string]types.Condition{condition.Type: condition}
+	expected := []v1.NodeCondition{problemutil.ConvertToAPICondition(condition)}
+	node := func(uid string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: k8stypes.UID(uid)}}
+	}
+	fakeClient.SetNode(node("uid-1"))
+	assert.True(t, m.needCheck())
+	m.checkNode()
+	m.sync()
+	assert.False(t, m.needCheck(), "Should not check before the resync check period")
+	assert.False(t, m.needReassert(), "Should not re-assert after the first check")
+
+	// The node object is deleted and re-created, e.g. during an upgrade.
+	assert.NoError(t, fakeClient.RemoveConditions([]v1.NodeConditionType{v1.NodeConditionType(condition.Type)}))
+	fakeClient.SetNode(node("uid-2"))
+	fakeClock.Step(resyncCheckPeriod)
+	assert.True(t, m.needCheck())
+	m.checkNode()
+	assert.True(t, m.needReassert(), "Should re-assert after the node is re-created")
+	m.sync()
+	assert.False(t, m.needReassert())
+	assert.Nil(t, fakeClient.AssertConditions(expected), "Conditions should be restored via client")
+	assert.Equal(t, []string{"Warning ConditionsReconciled Reconciled 1 node conditions after the node object was re-created, " +
+		"restored missing conditions TestCondition"}, fakeClient.Events())
+
+	// The node is not found while it is re-created.
+	fakeClient.InjectError("GetNode", apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "node"))
+	fakeClock.Step(resyncCheckPeriod)
+	m.checkNode()
+	assert.False(t, m.needReassert(), "Should not re-assert while the node is not found")
+	fakeClient.InjectError("GetNode", nil)
+	fakeClient.SetNode(node("uid-3"))
+	fakeClock.Step(resyncCheckPeriod)
+	m.checkNode()
+	assert.Equal(t, recreateCause, m.reassertCause)
+	m.sync()
+
+	// The apiserver is unreachable between syncs.
+	fakeClient.InjectError("GetNode", fmt.Errorf("injected error"))
+	fakeClock.Step(resyncCheckPeriod)
+	m.checkNode()
+	fakeClient.InjectError("GetNode", nil)
+	fakeClock.Step(resyncCheckPeriod)
+	m.checkNode()
+	assert.Equal(t, reconnectCause, m.reassertCause)
+	m.sync()
+	assert.Len(t, fakeClient.Events(), 1, "Should not report a reconnect without divergence")
+
+	// A successful sync after the check failed re-asserts the conditions already.
+	fakeClient.InjectError("GetNode", fmt.Errorf("injected error"))
+	fakeClock.Step(resyncCheckPeriod)
+	m.checkNode()
+	fakeClient.InjectError("GetNode", nil)
+	m.sync()
+	fakeClock.Step(resyncCheckPeriod)
+	m.checkNode()
+	assert.False(t, m.needReassert(), "Should not re-assert after a successful sync")
+}
+
+func TestNoNodeCheckWithoutPeriod(t *testing.T) {
+	m, _, _ := newTestManager()
+	m.resyncCheckPeriod = 0
+	assert.False(t, m.needCheck(), "Should not check the node without a resync check period")
+}
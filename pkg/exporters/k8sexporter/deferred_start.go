@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sexporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// maxDeferredStatuses is the maximum number of problem updates buffered while exporting is
+// deferred. Later updates are dropped, the conditions they change are restored by the next
+// full sync.
+const maxDeferredStatuses = 1000
+
+// deferral buffers the problems exported until the node is registered and Ready.
+type deferral struct {
+	// mutex protects deferring and deferred.
+	mutex     sync.Mutex
+	deferring bool
+	deferred  []*types.Status
+}
+
+// deferUntilNodeReady defers exporting problems until the node is registered and Ready, or
+// until the timeout passes. The problems exported meanwhile are buffered, and passed to
+// resume once the deferral ends.
+func deferUntilNodeReady(getNode func() (*v1.Node, error), interval, timeout time.Duration,
+	resume func(deferred []*types.Status)) *deferral {
+	d := &deferral{deferring: true}
+	go func() {
+		glog.Infof("Deferring exporting problems until the node is Ready (timeout %v)...", timeout)
+		if err := waitForNodeReady(getNode, interval, timeout); err != nil {
+			glog.Warningf("The node did not become Ready, exporting problems anyway: %v", err)
+		}
+		d.end(resume)
+	}()
+	return d
+}
+
+// buffer buffers the status if exporting is deferred, and returns whether it is.
+func (d *deferral) buffer(status *types.Status) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.deferring {
+		return false
+	}
+	if len(d.deferred) >= maxDeferredStatuses {
+		glog.Warningf("Dropped problems %+v, too many problems are deferred until the node is Ready", *status)
+		return true
+	}
+	d.deferred = append(d.deferred, status)
+	return true
+}
+
+// active returns whether exporting is deferred. Full syncs are dropped meanwhile, since
+// they are repeated after the deferral.
+func (d *deferral) active() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.deferring
+}
+
+// end passes the buffered problems to resume. The lock is held meanwhile, so that the
+// problems exported concurrently are exported after them.
+func (d *deferral) end(resume func(deferred []*types.Status)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	glog.Infof("Exporting %d problem updates deferred until the node is Ready", len(d.deferred))
+	resume(d.deferred)
+	d.deferred = nil
+	d.deferring = false
+}
+
+// waitForNodeReady waits until the node exists and its Ready condition is True.
+func waitForNodeReady(getNode func() (*v1.Node, error), interval, timeout time.Duration) error {
+	return wait.PollImmediate(interval, timeout, func() (bool, error) {
+		node, err := getNode()
+		if err != nil {
+			glog.V(2).Infof("Waiting for the node to be registered: %v", err)
+			return false, nil
+		}
+		return nodeReady(node), nil
+	})
+}
+
+// nodeReady returns whether the Ready condition of the node is True.
+func nodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package drain observes the drains of the node, and reports the pods stuck terminating,
+// since a stuck drain is operationally a node problem.
+package drain
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// Source is the source of the events of the observer.
+	Source = "drain-observer"
+	// StuckReason is the reason of the events reporting pods stuck terminating.
+	StuckReason = "DrainStuck"
+
+	// unschedulableTaint is the taint of the nodes marked unschedulable.
+	unschedulableTaint = "node.kubernetes.io/unschedulable"
+)
+
+// PodLister lists the pods on the node.
+type PodLister interface {
+	// ListPods lists all pods on the current node.
+	ListPods() ([]v1.Pod, error)
+}
+
+// Observer reports the pods stuck terminating past the deadline while the node is
+// cordoned. It is not thread-safe.
+type Observer struct {
+	getNode  func() (*v1.Node, error)
+	pods     PodLister
+	eventf   func(eventType, source, reason, messageFmt string, args ...interface{})
+	deadline time.Duration
+	clock    clock.Clock
+	// reported are the stuck pods already reported during the current drain.
+	reported map[types.UID]bool
+}
+
+// NewObserver creates an observer reporting the pods stuck terminating for more than the
+// deadline after their deletion timestamp.
+func NewObserver(getNode func() (*v1.Node, error), pods PodLister,
+	eventf func(eventType, source, reason, messageFmt string, args ...interface{}), deadline time.Duration) *Observer {
+	return &Observer{
+		getNode:  getNode,
+		pods:     pods,
+		eventf:   eventf,
+		deadline: deadline,
+		clock:    clock.RealClock{},
+		reported: make(map[types.UID]bool),
+	}
+}
+
+// Start checks the drain at the period.
+func (o *Observer) Start(period time.Duration) {
+	go wait.Forever(o.check, period)
+}
+
+// check reports the pods newly stuck terminating when the node is cordoned.
+func (o *Observer) check() {
+	node, err := o.getNode()
+	if err != nil {
+		glog.Errorf("Failed to get node for drain observer: %v", err)
+		return
+	}
+	if !cordoned(node) {
+		o.reported = make(map[types.UID]bool)
+		return
+	}
+	pods, err := o.pods.ListPods()
+	if err != nil {
+		glog.Errorf("Failed to list pods for drain observer: %v", err)
+		return
+	}
+
+	now := o.clock.Now()
+	reported := make(map[types.UID]bool)
+	var stuck []string
+	newlyStuck := false
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil || now.Before(pod.DeletionTimestamp.Add(o.deadline)) {
+			continue
+		}
+		stuck = append(stuck, pod.Namespace+"/"+pod.Name)
+		if !o.reported[pod.UID] {
+			newlyStuck = true
+		}
+		reported[pod.UID] = true
+	}
+	o.reported = reported
+	if !newlyStuck {
+		return
+	}
+	sort.Strings(stuck)
+	o.eventf(v1.EventTypeWarning, Source, StuckReason, "Node is drained but %d pods are stuck terminating for more than %v: %s",
+		len(stuck), o.deadline, strings.Join(stuck, ", "))
+}
+
+// cordoned returns whether the node is marked unschedulable, either in its spec or with
+// the unschedulable taint.
+func cordoned(node *v1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == unschedulableTaint {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+type fakePodLister struct {
+	pods []v1.Pod
+}
+
+func (f *fakePodLister) ListPods() ([]v1.Pod, error) {
+	return f.pods, nil
+}
+
+func pod(name string, deleted *time.Time) v1.Pod {
+	p := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name)}}
+	if deleted != nil {
+		t := metav1.NewTime(*deleted)
+		p.DeletionTimestamp = &t
+	}
+	return p
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now()
+	longAgo := now.Add(-time.Hour)
+	recently := now.Add(-time.Minute)
+	node := &v1.Node{}
+	pods := &fakePodLister{}
+	var events []string
+	o := NewObserver(func() (*v1.Node, error) { return node, nil }, pods,
+		func(eventType, source, reason, messageFmt string, args ...interface{}) {
+			events = append(events, fmt.Sprintf("%s %s %s: ", eventType, source, reason)+fmt.Sprintf(messageFmt, args...))
+		}, 10*time.Minute)
+	fakeClock := clock.NewFakeClock(now)
+	o.clock = fakeClock
+
+	// Pods stuck terminating are not reported when the node is not cordoned.
+	pods.pods = []v1.Pod{pod("stuck", &longAgo), pod("terminating", &recently), pod("running", nil)}
+	o.check()
+	assert.Empty(t, events)
+
+	node.Spec.Unschedulable = true
+	o.check()
+	assert.Equal(t, []string{"Warning drain-observer DrainStuck: Node is drained but 1 pods are stuck terminating for more than 10m0s: default/stuck"}, events)
+
+	// The stuck pods are reported again only when more pods are stuck.
+	o.check()
+	assert.Len(t, events, 1)
+	fakeClock.Step(10 * time.Minute)
+	o.check()
+	assert.Equal(t, "Warning drain-observer DrainStuck: Node is drained but 2 pods are stuck terminating for more than 10m0s: default/stuck, default/terminating", events[1])
+
+	// The stuck pods are reported again in the next drain.
+	node.Spec.Unschedulable = false
+	o.check()
+	node.Spec.Taints = []v1.Taint{{Key: unschedulableTaint, Effect: v1.TaintEffectNoSchedule}}
+	o.check()
+	assert.Len(t, events, 3)
+}
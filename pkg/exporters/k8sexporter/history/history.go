@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package history keeps the last problems node-problem-detector exported, so that they can
+// be inspected after the events expired on the apiserver.
+package history
+
+import (
+	"sync"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	// EventKind is the kind of the problems recorded from events.
+	EventKind = "event"
+	// ConditionKind is the kind of the problems recorded from condition transitions.
+	ConditionKind = "condition"
+)
+
+// Problem is an event or a condition transition, in the v1 schema.
+type Problem struct {
+	// Source is the problem daemon reporting the problem.
+	Source string `json:"source"`
+	// Kind is either "event" or "condition".
+	Kind string `json:"kind"`
+	// Event is the event, set if the kind is "event".
+	Event *npdapiv1.Event `json:"event,omitempty"`
+	// Condition is the condition after the transition, set if the kind is "condition".
+	Condition *npdapiv1.Condition `json:"condition,omitempty"`
+}
+
+// List is the JSON served on the history endpoint.
+type List struct {
+	APIVersion string `json:"apiVersion"`
+	Node       string `json:"node"`
+	// Capacity is the maximum number of problems kept.
+	Capacity int `json:"capacity"`
+	// Problems are the last problems, oldest first.
+	Problems []Problem `json:"problems"`
+}
+
+// History is a ring buffer of the last problems. It is thread-safe.
+type History struct {
+	sync.Mutex
+	node     string
+	problems []Problem
+	// next is the index the next problem is written to.
+	next int
+	full bool
+	// statuses is the last recorded status of each source and condition type, so that only
+	// transitions are recorded.
+	statuses map[string]map[string]types.ConditionStatus
+}
+
+// NewHistory creates a history keeping the last capacity problems of the node.
+func NewHistory(node string, capacity int) *History {
+	return &History{
+		node:     node,
+		problems: make([]Problem, capacity),
+		statuses: make(map[string]map[string]types.ConditionStatus),
+	}
+}
+
+// Record records the events and the condition transitions in the status. Conditions whose
+// status did not change are ignored.
+func (h *History) Record(status *types.Status) {
+	h.Lock()
+	defer h.Unlock()
+	for _, event := range status.Events {
+		e := npdapiv1.NewEvent(event)
+		h.add(Problem{Source: status.Source, Kind: EventKind, Event: &e})
+	}
+	if _, ok := h.statuses[status.Source]; !ok {
+		h.statuses[status.Source] = make(map[string]types.ConditionStatus)
+	}
+	for _, condition := range status.Conditions {
+		if last, ok := h.statuses[status.Source][condition.Type]; ok && last == condition.Status {
+			continue
+		}
+		h.statuses[status.Source][condition.Type] = condition.Status
+		c := npdapiv1.NewCondition(condition)
+		h.add(Problem{Source: status.Source, Kind: ConditionKind, Condition: &c})
+	}
+}
+
+func (h *History) add(problem Problem) {
+	if len(h.problems) == 0 {
+		return
+	}
+	h.problems[h.next] = problem
+	h.next = (h.next + 1) % len(h.problems)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// List returns the recorded problems, oldest first.
+func (h *History) List() List {
+	h.Lock()
+	defer h.Unlock()
+	list := List{APIVersion: npdapiv1.APIVersion, Node: h.node, Capacity: len(h.problems), Problems: []Problem{}}
+	if h.full {
+		list.Problems = append(list.Problems, h.problems[h.next:]...)
+	}
+	list.Problems = append(list.Problems, h.problems[:h.next]...)
+	return list
+}
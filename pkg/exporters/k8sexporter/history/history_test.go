@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestHistory(t *testing.T) {
+	now := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	event := func(reason string) *types.Status {
+		return &types.Status{
+			Source: "test-source",
+			Events: []types.Event{{Severity: types.Warn, Timestamp: now, Reason: reason, Annotations: map[string]string{"pid": "1234"}}},
+		}
+	}
+	condition := func(status types.ConditionStatus, reason string) *types.Status {
+		return &types.Status{
+			Source:     "test-source",
+			Conditions: []types.Condition{{Type: "TestCondition", Status: status, Transition: now, Reason: reason}},
+		}
+	}
+
+	h := NewHistory("test-node", 3)
+	assert.Equal(t, List{APIVersion: npdapiv1.APIVersion, Node: "test-node", Capacity: 3, Problems: []Problem{}}, h.List())
+
+	h.Record(event("Event1"))
+	h.Record(condition(types.True, "Condition1"))
+	// Conditions whose status did not change are not recorded.
+	h.Record(condition(types.True, "Condition2"))
+	assert.Equal(t, []Problem{
+		{
+			Source: "test-source",
+			Kind:   EventKind,
+			Event:  &npdapiv1.Event{Severity: "warn", Timestamp: now, Reason: "Event1", Annotations: map[string]string{"pid": "1234"}},
+		},
+		{
+			Source:    "test-source",
+			Kind:      ConditionKind,
+			Condition: &npdapiv1.Condition{Type: "TestCondition", Status: "True", Transition: now, Reason: "Condition1"},
+		},
+	}, h.List().Problems)
+
+	// The oldest problems are dropped when the history is full.
+	h.Record(event("Event2"))
+	h.Record(condition(types.False, "Condition3"))
+	h.Record(event("Event3"))
+	var reasons []string
+	for _, p := range h.List().Problems {
+		if p.Event != nil {
+			reasons = append(reasons, p.Event.Reason)
+		} else {
+			reasons = append(reasons, p.Condition.Reason)
+		}
+	}
+	assert.Equal(t, []string{"Event2", "Condition3", "Event3"}, reasons)
+}
+
+func TestEmptyHistory(t *testing.T) {
+	h := NewHistory("test-node", 0)
+	h.Record(&types.Status{Source: "test-source", Events: []types.Event{{Reason: "Event"}}})
+	assert.Empty(t, h.List().Problems)
+}
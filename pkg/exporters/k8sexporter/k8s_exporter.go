@@ -21,22 +21,40 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"strconv"
+	"time"
 
 	"github.com/golang/glog"
 
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	"k8s.io/node-problem-detector/cmd/options"
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
 	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/condition"
 	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
 	"k8s.io/node-problem-detector/pkg/types"
 	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/serving"
 )
 
+// eventAnnotationPrefix prefixes the keys of the event annotations, e.g. the named capture
+// groups of log patterns.
+const eventAnnotationPrefix = "node-problem-detector.k8s.io/"
+
 type k8sExporter struct {
 	client           problemclient.Client
 	conditionManager condition.ConditionManager
+	// prefixer is nil when the condition types are not prefixed.
+	prefixer *conditionPrefixer
+	// provenance is nil when the provenance is not attached to the conditions.
+	provenance *provenanceAttacher
+	// observers are the enabled features observing the exported problems, e.g. the pod
+	// signaler.
+	observers []observer
+	// deferral is nil when exporting is not deferred until the node is Ready.
+	deferral *deferral
 }
 
 // NewExporterOrDie creates a exporter for Kubernetes apiserver exporting,
@@ -48,6 +66,10 @@ func NewExporterOrDie(npdo *options.NodeProblemDetectorOptions) types.Exporter {
 	if !npdo.EnableK8sExporter {
 		return nil
 	}
+	if npdo.DryRun {
+		glog.Info("K8s exporter is disabled in dry run mode.")
+		return nil
+	}
 
 	c := problemclient.NewClientOrDie(npdo)
 
@@ -56,26 +78,123 @@ func NewExporterOrDie(npdo *options.NodeProblemDetectorOptions) types.Exporter {
 		glog.Warningf("kube-apiserver did not become ready: timed out on waiting for kube-apiserver to return the node object: %v", err)
 	}
 
+	retry := problemclient.RetryPolicy{
+		InitialBackoff: npdo.K8sExporterRetryInitialBackoff,
+		MaxBackoff:     npdo.K8sExporterRetryMaxBackoff,
+	}
 	ke := k8sExporter{
 		client:           c,
-		conditionManager: condition.NewConditionManager(c, clock.RealClock{}, npdo.K8sExporterHeartbeatPeriod),
+		conditionManager: condition.NewConditionManager(c, clock.RealClock{}, npdo.K8sExporterHeartbeatPeriod, npdo.K8sExporterResyncCheckPeriod, retry),
+		prefixer:         newConditionPrefixer(npdo.ConditionTypePrefix, npdo.MigrateUnprefixedConditions),
+		provenance:       newProvenanceAttacher(npdo, c),
+		observers:        newObservers(npdo, c),
 	}
+	startDrainObserver(npdo, c)
 
 	ke.startHTTPReporting(npdo)
-	ke.conditionManager.Start()
+	if npdo.K8sExporterNodeReadyTimeout > 0 {
+		ke.deferUntilNodeReady(c.GetNode, npdo.APIServerWaitInterval, npdo.K8sExporterNodeReadyTimeout)
+	} else {
+		ke.conditionManager.Start()
+	}
 
 	return &ke
 }
 
+// deferUntilNodeReady defers exporting problems until the node is Ready. The condition
+// manager is only started once the deferral ends.
+func (ke *k8sExporter) deferUntilNodeReady(getNode func() (*v1.Node, error), interval, timeout time.Duration) {
+	ke.deferral = deferUntilNodeReady(getNode, interval, timeout, func(deferred []*types.Status) {
+		ke.conditionManager.Start()
+		for _, status := range deferred {
+			ke.exportProblems(status)
+		}
+	})
+}
+
 func (ke *k8sExporter) ExportProblems(status *types.Status) {
+	if ke.deferral != nil && ke.deferral.buffer(status) {
+		return
+	}
+	ke.exportProblems(status)
+}
+
+func (ke *k8sExporter) exportProblems(status *types.Status) {
 	for _, event := range status.Events {
-		ke.client.Eventf(util.ConvertToAPIEventType(event.Severity), status.Source, event.Reason, event.Message)
+		ke.client.AnnotatedEventf(eventAnnotations(event), util.ConvertToAPIEventType(event.Severity), status.Source, event.Reason, event.Message)
+	}
+	ke.updateConditions(status.Conditions)
+	for _, o := range ke.observers {
+		o.exported(status)
+	}
+}
+
+// eventAnnotations returns the annotations of the event with prefixed keys, and the
+// severity of critical events, or nil if the event has none.
+func eventAnnotations(event types.Event) map[string]string {
+	if len(event.Annotations) == 0 && event.Severity != types.Critical {
+		return nil
+	}
+	annotations := map[string]string{}
+	for k, v := range event.Annotations {
+		annotations[eventAnnotationPrefix+k] = v
 	}
-	for _, cdt := range status.Conditions {
+	// Critical problems are warning events, they are told apart by the annotation.
+	if event.Severity == types.Critical {
+		annotations[eventAnnotationPrefix+types.SeverityAnnotation] = string(types.Critical)
+	}
+	return annotations
+}
+
+// SyncProblems updates all conditions of the source. The condition manager only
+// patches the node when a condition actually differs from its local copy.
+func (ke *k8sExporter) SyncProblems(status *types.Status) {
+	if ke.deferral != nil && ke.deferral.active() {
+		return
+	}
+	ke.updateConditions(status.Conditions)
+	for _, o := range ke.observers {
+		o.synced(status)
+	}
+}
+
+// updateConditions updates the conditions with the provenance and the condition type
+// prefix, when configured.
+func (ke *k8sExporter) updateConditions(conditions []types.Condition) {
+	if ke.provenance != nil {
+		ke.provenance.annotate()
+	}
+	for _, cdt := range conditions {
+		if ke.provenance != nil {
+			cdt = ke.provenance.attach(cdt)
+		}
+		if ke.prefixer != nil {
+			cdt = ke.prefixer.prefixed(cdt, ke.conditionManager)
+		}
 		ke.conditionManager.UpdateCondition(cdt)
 	}
 }
 
+// AnnotateNode sets the annotations on the node.
+func (ke *k8sExporter) AnnotateNode(annotations map[string]string) error {
+	if err := ke.client.SetAnnotations(annotations); err != nil {
+		exporters.RecordFailure("k8s", "annotations")
+		return err
+	}
+	return nil
+}
+
+// DeliveredUntil returns the time before which the conditions exported were set on the
+// node.
+func (ke *k8sExporter) DeliveredUntil() time.Time {
+	return ke.conditionManager.DeliveredUntil()
+}
+
+// PushesProblems returns true, the events and conditions are pushed to the apiserver.
+func (ke *k8sExporter) PushesProblems() bool {
+	return true
+}
+
 func (ke *k8sExporter) startHTTPReporting(npdo *options.NodeProblemDetectorOptions) {
 	if npdo.ServerPort <= 0 {
 		return
@@ -94,9 +213,22 @@ func (ke *k8sExporter) startHTTPReporting(npdo *options.NodeProblemDetectorOptio
 		util.ReturnHTTPJson(w, ke.conditionManager.GetConditions())
 	})
 
+	// Add the handler to serve conditions in the stable v1 schema. Consumers should
+	// prefer it over /conditions, whose output follows the internal types.
+	mux.HandleFunc("/v1/conditions", func(w http.ResponseWriter, r *http.Request) {
+		util.ReturnHTTPJson(w, npdapiv1.NewConditionList(npdo.NodeName, ke.conditionManager.GetConditions()))
+	})
+
+	// Add the handlers of the enabled features, e.g. the noise report and the problem
+	// history.
+	for _, o := range ke.observers {
+		o.registerHandlers(mux)
+	}
+
 	addr := net.JoinHostPort(npdo.ServerAddress, strconv.Itoa(npdo.ServerPort))
 	go func() {
-		err := http.ListenAndServe(addr, mux)
+		// The health check is public, so that liveness probes need no credentials.
+		err := serving.ListenAndServe(addr, mux, npdo.Serving, "/healthz")
 		if err != nil {
 			glog.Fatalf("Failed to start server: %v", err)
 		}
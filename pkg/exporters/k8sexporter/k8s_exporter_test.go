@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sexporter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+type fakeConditionManager struct {
+	started  bool
+	updated  []string
+	messages []string
+	removed  []string
+}
+
+func (f *fakeConditionManager) Start() { f.started = true }
+
+func (f *fakeConditionManager) UpdateCondition(condition types.Condition) {
+	f.updated = append(f.updated, condition.Type)
+	f.messages = append(f.messages, condition.Message)
+}
+
+func (f *fakeConditionManager) GetConditions() []types.Condition {
+	return nil
+}
+
+func (f *fakeConditionManager) RemoveCondition(conditionType string) {
+	f.removed = append(f.removed, conditionType)
+}
+
+func (f *fakeConditionManager) DeliveredUntil() time.Time {
+	return time.Time{}
+}
+
+func TestUpdateConditions(t *testing.T) {
+	conditions := []types.Condition{{Type: "KernelDeadlock"}, {Type: "ReadonlyFilesystem"}}
+
+	manager := &fakeConditionManager{}
+	ke := &k8sExporter{conditionManager: manager}
+	ke.SyncProblems(&types.Status{Conditions: conditions})
+	assert.Equal(t, []string{"KernelDeadlock", "ReadonlyFilesystem"}, manager.updated)
+	assert.Empty(t, manager.removed)
+
+	manager = &fakeConditionManager{}
+	ke = &k8sExporter{conditionManager: manager, prefixer: newConditionPrefixer("npd.k8s.io/", false)}
+	ke.SyncProblems(&types.Status{Conditions: conditions})
+	assert.Equal(t, []string{"npd.k8s.io/KernelDeadlock", "npd.k8s.io/ReadonlyFilesystem"}, manager.updated)
+	assert.Empty(t, manager.removed, "unprefixed conditions should not be removed without migration")
+	assert.Equal(t, "KernelDeadlock", conditions[0].Type, "the status should not be modified")
+
+	manager = &fakeConditionManager{}
+	ke = &k8sExporter{conditionManager: manager, prefixer: newConditionPrefixer("npd.k8s.io/", true)}
+	ke.SyncProblems(&types.Status{Conditions: conditions})
+	ke.SyncProblems(&types.Status{Conditions: conditions})
+	assert.Equal(t, []string{"KernelDeadlock", "ReadonlyFilesystem"}, manager.removed,
+		"unprefixed conditions should be removed once")
+}
+
+func TestDeferUntilNodeReady(t *testing.T) {
+	notReady := &v1.Node{Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}}}
+	ready := &v1.Node{Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}}}
+	registered := make(chan struct{})
+	becomeReady := make(chan struct{})
+	getNode := func() (*v1.Node, error) {
+		select {
+		case <-becomeReady:
+			return ready, nil
+		case <-registered:
+			return notReady, nil
+		default:
+			return nil, errors.New("node not found")
+		}
+	}
+
+	manager := &fakeConditionManager{}
+	ke := &k8sExporter{client: problemclient.NewFakeProblemClient(), conditionManager: manager}
+	ke.deferUntilNodeReady(getNode, time.Millisecond, time.Minute)
+	ke.ExportProblems(&types.Status{Conditions: []types.Condition{{Type: "KernelDeadlock"}}})
+	close(registered)
+	ke.SyncProblems(&types.Status{Conditions: []types.Condition{{Type: "KernelDeadlock"}, {Type: "ReadonlyFilesystem"}}})
+	ke.ExportProblems(&types.Status{Conditions: []types.Condition{{Type: "ReadonlyFilesystem"}}})
+	assert.True(t, ke.deferral.active(), "exporting should be deferred until the node is Ready")
+	close(becomeReady)
+	for ke.deferral.active() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, manager.started)
+	assert.Equal(t, []string{"KernelDeadlock", "ReadonlyFilesystem"}, manager.updated,
+		"deferred problems should be exported in order, and full syncs should be dropped")
+
+	ke.ExportProblems(&types.Status{Conditions: []types.Condition{{Type: "FrequentKubeletRestart"}}})
+	assert.Equal(t, []string{"KernelDeadlock", "ReadonlyFilesystem", "FrequentKubeletRestart"}, manager.updated)
+
+	// Problems are exported anyway once the timeout passes.
+	manager = &fakeConditionManager{}
+	ke = &k8sExporter{client: problemclient.NewFakeProblemClient(), conditionManager: manager}
+	ke.deferUntilNodeReady(func() (*v1.Node, error) { return notReady, nil }, time.Millisecond, 10*time.Millisecond)
+	ke.ExportProblems(&types.Status{Conditions: []types.Condition{{Type: "KernelDeadlock"}}})
+	for ke.deferral.active() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, manager.started)
+	assert.Equal(t, []string{"KernelDeadlock"}, manager.updated)
+}
+
+func TestProvenance(t *testing.T) {
+	p := provenance{Version: "v1.2.3", ConfigHash: "0123456789ab"}
+	conditions := []types.Condition{{Type: "KernelDeadlock", Message: "kernel has no deadlock"}}
+
+	manager := &fakeConditionManager{}
+	client := problemclient.NewFakeProblemClient()
+	ke := &k8sExporter{client: client, conditionManager: manager, provenance: &provenanceAttacher{mode: MessageProvenance, provenance: p, client: client}}
+	ke.SyncProblems(&types.Status{Conditions: conditions})
+	assert.Equal(t, []string{"kernel has no deadlock [node-problem-detector version=v1.2.3 config=0123456789ab]"}, manager.messages)
+	assert.Equal(t, "kernel has no deadlock", conditions[0].Message, "the status should not be modified")
+	assert.Empty(t, client.Annotations())
+
+	manager = &fakeConditionManager{}
+	ke = &k8sExporter{client: client, conditionManager: manager, provenance: &provenanceAttacher{mode: AnnotationProvenance, provenance: p, client: client}}
+	client.InjectError("SetAnnotations", errors.New("injected error"))
+	ke.SyncProblems(&types.Status{Conditions: conditions})
+	assert.Empty(t, client.Annotations())
+	client.InjectError("SetAnnotations", nil)
+	ke.SyncProblems(&types.Status{Conditions: conditions})
+	assert.Equal(t, map[string]string{provenanceAnnotation: `{"version":"v1.2.3","configHash":"0123456789ab"}`}, client.Annotations(),
+		"the annotation should be retried with the next update")
+	assert.Equal(t, []string{"kernel has no deadlock", "kernel has no deadlock"}, manager.messages)
+}
+
+func TestConfigHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-hash")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json")
+	assert.NoError(t, ioutil.WriteFile(a, []byte(`{"a": 1}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte(`{"b": 1}`), 0644))
+
+	hash := configHash([]string{a, b})
+	assert.Len(t, hash, configHashLength)
+	assert.Equal(t, hash, configHash([]string{b, a}), "the hash should not change with the order of the paths")
+	assert.NotEqual(t, hash, configHash([]string{a}))
+
+	assert.NoError(t, ioutil.WriteFile(b, []byte(`{"b": 2}`), 0644))
+	assert.NotEqual(t, hash, configHash([]string{a, b}), "the hash should change with the contents")
+}
+
+func TestEventAnnotations(t *testing.T) {
+	assert.Nil(t, eventAnnotations(types.Event{Reason: "OOMKilling"}))
+	assert.Equal(t, map[string]string{
+		"node-problem-detector.k8s.io/device": "sda1",
+	}, eventAnnotations(types.Event{Reason: "IOError", Annotations: map[string]string{"device": "sda1"}}))
+	assert.Equal(t, map[string]string{
+		"node-problem-detector.k8s.io/severity": "critical",
+	}, eventAnnotations(types.Event{Reason: "KernelPanic", Severity: types.Critical}))
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sexporter
+
+import (
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/condition"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// conditionPrefixer prepends the condition type prefix to the types of the conditions, and
+// removes the unprefixed conditions of the same types from the node when they are migrated.
+type conditionPrefixer struct {
+	prefix string
+	// migrated records the unprefixed condition types removed from the node. It is nil
+	// when unprefixed conditions are not migrated.
+	migrated map[string]bool
+}
+
+// newConditionPrefixer returns nil when the prefix is empty, since there is nothing to
+// migrate then.
+func newConditionPrefixer(prefix string, migrate bool) *conditionPrefixer {
+	if prefix == "" {
+		return nil
+	}
+	p := &conditionPrefixer{prefix: prefix}
+	if migrate {
+		p.migrated = make(map[string]bool)
+	}
+	return p
+}
+
+// prefixed returns the condition with the prefixed type. The first time a type is seen,
+// its unprefixed condition is removed by the manager if it is migrated.
+func (p *conditionPrefixer) prefixed(cdt types.Condition, manager condition.ConditionManager) types.Condition {
+	if p.migrated != nil && !p.migrated[cdt.Type] {
+		glog.Infof("Migrating condition %s to %s%s", cdt.Type, p.prefix, cdt.Type)
+		manager.RemoveCondition(cdt.Type)
+		p.migrated[cdt.Type] = true
+	}
+	cdt.Type = p.prefix + cdt.Type
+	return cdt
+}
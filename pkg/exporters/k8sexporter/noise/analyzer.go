@@ -0,0 +1,330 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package noise scores the problems node-problem-detector reports by how noisy they are,
+// i.e. how often they churn without the node actually becoming NotReady, and suggests how
+// to tune the rules reporting them.
+package noise
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	// ConditionKind is the kind of the scores of conditions.
+	ConditionKind = "condition"
+	// EventKind is the kind of the scores of events.
+	EventKind = "event"
+
+	// correlationWindow is how close a problem and a NotReady transition must be to be
+	// correlated.
+	correlationWindow = 10 * time.Minute
+	// churnSaturation is the fire rate per hour at which a problem is considered fully
+	// churning.
+	churnSaturation = 1.0
+	// minFires is the number of fires in the window needed to suggest tuning.
+	minFires = 3
+	// shortDuration is the median duration under which a condition is considered to
+	// clear too quickly.
+	shortDuration = 5 * time.Minute
+	// frequentEventsPerHour is the event rate per hour above which an event is
+	// considered too frequent.
+	frequentEventsPerHour = 10.0
+	// highSignalCorrelation is the correlation above which a problem is considered a
+	// good signal of NotReady.
+	highSignalCorrelation = 0.5
+)
+
+// Score is the noise score of a condition type or an event reason.
+type Score struct {
+	// Kind is either "condition" or "event".
+	Kind string `json:"kind"`
+	// Source is the problem daemon reporting the problem.
+	Source string `json:"source"`
+	// Name is the condition type or the event reason.
+	Name string `json:"name"`
+	// Fires is the number of times the condition became true or the event was reported
+	// in the window.
+	Fires int `json:"fires"`
+	// Clears is the number of times the condition became false in the window.
+	Clears int `json:"clears,omitempty"`
+	// FiresPerHour is the fire rate in the window.
+	FiresPerHour float64 `json:"firesPerHour"`
+	// MedianDuration is the median duration of the cleared conditions.
+	MedianDuration string `json:"medianDuration,omitempty"`
+	// CorrelatedFires is the number of fires close to a NotReady transition of the node.
+	CorrelatedFires int `json:"correlatedFires"`
+	// Correlation is the fraction of the fires correlated with NotReady transitions.
+	Correlation float64 `json:"correlation"`
+	// Noise is the noise score from 0 (high signal) to 100 (pure noise).
+	Noise float64 `json:"noise"`
+	// Suggestions are the suggestions to tune the rules reporting the problem.
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Report is the noise report of all problems seen in the window.
+type Report struct {
+	// Window is the period the report covers.
+	Window string `json:"window"`
+	// NotReadyTransitions is the number of NotReady transitions of the node in the window.
+	NotReadyTransitions int `json:"notReadyTransitions"`
+	// Scores are the scores of all problems, noisiest first.
+	Scores []Score `json:"scores"`
+}
+
+type key struct {
+	kind   string
+	source string
+	name   string
+}
+
+// history is what the analyzer saw of a problem.
+type history struct {
+	fires     []time.Time
+	clears    []time.Time
+	durations []time.Duration
+	// active is the transition time of the condition when it is true.
+	active *time.Time
+}
+
+// Analyzer records the problems and the NotReady transitions of the node, and scores the
+// problems. It is thread-safe.
+type Analyzer struct {
+	mutex  sync.Mutex
+	clock  clock.Clock
+	window time.Duration
+
+	histories map[key]*history
+	// notReady are the times the node became NotReady.
+	notReady []time.Time
+	// readyTransition and ready are the last seen transition time and status of the node
+	// Ready condition.
+	readyTransition time.Time
+	ready           bool
+}
+
+// NewAnalyzer creates an analyzer covering the window.
+func NewAnalyzer(window time.Duration, clock clock.Clock) *Analyzer {
+	return &Analyzer{
+		clock:     clock,
+		window:    window,
+		histories: make(map[key]*history),
+	}
+}
+
+// Start polls the node at the period to record its NotReady transitions.
+func (a *Analyzer) Start(getNode func() (*v1.Node, error), period time.Duration) {
+	go func() {
+		for {
+			node, err := getNode()
+			if err != nil {
+				glog.Errorf("Failed to get node for noise analysis: %v", err)
+			} else {
+				a.ObserveNode(node)
+			}
+			<-a.clock.After(period)
+		}
+	}()
+}
+
+// ObserveNode records the NotReady transition of the node, if any.
+func (a *Analyzer) ObserveNode(node *v1.Node) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != v1.NodeReady {
+			continue
+		}
+		transition := condition.LastTransitionTime.Time
+		if transition.Equal(a.readyTransition) {
+			return
+		}
+		first := a.readyTransition.IsZero()
+		ready := condition.Status == v1.ConditionTrue
+		if !ready {
+			a.notReady = append(a.notReady, transition)
+		} else if !first && a.ready {
+			// The node became NotReady and Ready again between two polls, the time it
+			// became Ready again is the closest known time.
+			a.notReady = append(a.notReady, transition)
+		}
+		a.readyTransition, a.ready = transition, ready
+		return
+	}
+}
+
+// ObserveStatus records the events and the condition transitions in the status.
+func (a *Analyzer) ObserveStatus(status *types.Status) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, event := range status.Events {
+		h := a.history(key{kind: EventKind, source: status.Source, name: event.Reason})
+		h.fires = append(h.fires, event.Timestamp)
+	}
+	for _, condition := range status.Conditions {
+		h := a.history(key{kind: ConditionKind, source: status.Source, name: condition.Type})
+		switch {
+		case condition.Status == types.True && h.active == nil:
+			transition := condition.Transition
+			h.active = &transition
+			h.fires = append(h.fires, transition)
+		case condition.Status != types.True && h.active != nil:
+			h.clears = append(h.clears, condition.Transition)
+			h.durations = append(h.durations, condition.Transition.Sub(*h.active))
+			h.active = nil
+		}
+	}
+}
+
+func (a *Analyzer) history(k key) *history {
+	h, ok := a.histories[k]
+	if !ok {
+		h = &history{}
+		a.histories[k] = h
+	}
+	return h
+}
+
+// Report scores the problems seen in the window.
+func (a *Analyzer) Report() Report {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.prune()
+
+	report := Report{
+		Window:              a.window.String(),
+		NotReadyTransitions: len(a.notReady),
+		Scores:              []Score{},
+	}
+	for k, h := range a.histories {
+		if len(h.fires) == 0 && len(h.clears) == 0 {
+			continue
+		}
+		report.Scores = append(report.Scores, a.score(k, h))
+	}
+	sort.Slice(report.Scores, func(i, j int) bool {
+		if report.Scores[i].Noise != report.Scores[j].Noise {
+			return report.Scores[i].Noise > report.Scores[j].Noise
+		}
+		return report.Scores[i].Fires > report.Scores[j].Fires
+	})
+	return report
+}
+
+// prune forgets everything older than the window.
+func (a *Analyzer) prune() {
+	start := a.clock.Now().Add(-a.window)
+	a.notReady = after(a.notReady, start.Add(-correlationWindow))
+	for _, h := range a.histories {
+		h.fires = after(h.fires, start)
+		var clears []time.Time
+		var durations []time.Duration
+		for i, clear := range h.clears {
+			if clear.After(start) {
+				clears = append(clears, clear)
+				durations = append(durations, h.durations[i])
+			}
+		}
+		h.clears, h.durations = clears, durations
+	}
+}
+
+func after(times []time.Time, start time.Time) []time.Time {
+	var kept []time.Time
+	for _, t := range times {
+		if t.After(start) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+func (a *Analyzer) score(k key, h *history) Score {
+	s := Score{
+		Kind:   k.kind,
+		Source: k.source,
+		Name:   k.name,
+		Fires:  len(h.fires),
+		Clears: len(h.clears),
+	}
+	s.FiresPerHour = round(float64(s.Fires) / a.window.Hours())
+	for _, fire := range h.fires {
+		if a.correlated(fire) {
+			s.CorrelatedFires++
+		}
+	}
+	if s.Fires > 0 {
+		s.Correlation = round(float64(s.CorrelatedFires) / float64(s.Fires))
+	}
+	churn := math.Min(float64(s.Fires)/a.window.Hours()/churnSaturation, 1)
+	s.Noise = round(100 * churn * (1 - s.Correlation))
+
+	var median time.Duration
+	if len(h.durations) > 0 {
+		durations := append([]time.Duration(nil), h.durations...)
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		median = durations[len(durations)/2]
+		s.MedianDuration = median.String()
+	}
+
+	if s.Fires >= minFires && s.CorrelatedFires == 0 {
+		s.Suggestions = append(s.Suggestions, fmt.Sprintf(
+			"%d fires without a NotReady transition of the node, consider raising the threshold of the rule or removing it", s.Fires))
+	}
+	if k.kind == ConditionKind && s.Clears >= minFires && median < shortDuration {
+		s.Suggestions = append(s.Suggestions, fmt.Sprintf(
+			"the condition clears after %v on median, consider requiring the problem to persist before setting the condition", median))
+	}
+	if k.kind == EventKind && s.FiresPerHour > frequentEventsPerHour {
+		s.Suggestions = append(s.Suggestions, fmt.Sprintf(
+			"the event is reported %.1f times per hour, consider reporting it as a condition instead", s.FiresPerHour))
+	}
+	if s.Fires >= minFires && s.Correlation >= highSignalCorrelation {
+		s.Suggestions = append(s.Suggestions, fmt.Sprintf(
+			"%d of %d fires are close to a NotReady transition of the node, consider alerting on it", s.CorrelatedFires, s.Fires))
+	}
+	return s
+}
+
+// correlated returns whether a NotReady transition happened close to the time.
+func (a *Analyzer) correlated(t time.Time) bool {
+	for _, notReady := range a.notReady {
+		d := notReady.Sub(t)
+		if d < 0 {
+			d = -d
+		}
+		if d <= correlationWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// round rounds to 2 decimal places to keep the report readable.
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
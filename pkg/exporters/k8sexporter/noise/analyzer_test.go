@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package noise
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func condition(t time.Time, status types.ConditionStatus) *types.Status {
+	return &types.Status{
+		Source:     "test-source",
+		Conditions: []types.Condition{{Type: "TestCondition", Status: status, Transition: t}},
+	}
+}
+
+func node(t time.Time, status v1.ConditionStatus) *v1.Node {
+	return &v1.Node{Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{
+		Type:               v1.NodeReady,
+		Status:             status,
+		LastTransitionTime: metav1.NewTime(t),
+	}}}}
+}
+
+func TestObserveStatus(t *testing.T) {
+	now := time.Now()
+	fakeClock := clock.NewFakeClock(now)
+	a := NewAnalyzer(time.Hour, fakeClock)
+
+	// The condition fires 3 times and clears after a minute each time, which is synced
+	// again in between.
+	for i := 0; i < 3; i++ {
+		fire := now.Add(time.Duration(-50+10*i) * time.Minute)
+		a.ObserveStatus(condition(fire, types.True))
+		a.ObserveStatus(condition(fire, types.True))
+		a.ObserveStatus(condition(fire.Add(time.Minute), types.False))
+	}
+	a.ObserveStatus(&types.Status{
+		Source: "test-source",
+		Events: []types.Event{{Reason: "TestEvent", Timestamp: now.Add(-time.Minute)}},
+	})
+
+	report := a.Report()
+	assert.Equal(t, "1h0m0s", report.Window)
+	assert.Equal(t, 0, report.NotReadyTransitions)
+	assert.Len(t, report.Scores, 2)
+	score := report.Scores[0]
+	assert.Equal(t, ConditionKind, score.Kind)
+	assert.Equal(t, "TestCondition", score.Name)
+	assert.Equal(t, 3, score.Fires)
+	assert.Equal(t, 3, score.Clears)
+	assert.Equal(t, "1m0s", score.MedianDuration)
+	assert.Equal(t, 100.0, score.Noise)
+	assert.Len(t, score.Suggestions, 2)
+	assert.Equal(t, EventKind, report.Scores[1].Kind)
+	assert.Equal(t, 1, report.Scores[1].Fires)
+
+	// Fires out of the window are forgotten.
+	fakeClock.Step(30 * time.Minute)
+	score = a.Report().Scores[0]
+	assert.Equal(t, 1, score.Fires)
+	assert.Empty(t, score.Suggestions)
+}
+
+func TestCorrelation(t *testing.T) {
+	now := time.Now()
+	a := NewAnalyzer(4*time.Hour, clock.NewFakeClock(now))
+
+	a.ObserveNode(node(now.Add(-3*time.Hour), v1.ConditionTrue))
+	for i := 0; i < 4; i++ {
+		fire := now.Add(time.Duration(-120+30*i) * time.Minute)
+		a.ObserveStatus(condition(fire, types.True))
+		a.ObserveStatus(condition(fire.Add(10*time.Minute), types.False))
+		if i%2 == 0 {
+			a.ObserveNode(node(fire.Add(5*time.Minute), v1.ConditionFalse))
+			a.ObserveNode(node(fire.Add(5*time.Minute), v1.ConditionFalse))
+			a.ObserveNode(node(fire.Add(8*time.Minute), v1.ConditionTrue))
+		}
+	}
+
+	report := a.Report()
+	assert.Equal(t, 2, report.NotReadyTransitions)
+	score := report.Scores[0]
+	assert.Equal(t, 4, score.Fires)
+	assert.Equal(t, 2, score.CorrelatedFires)
+	assert.Equal(t, 0.5, score.Correlation)
+	assert.Equal(t, 50.0, score.Noise)
+	assert.Len(t, score.Suggestions, 1)
+}
+
+func TestObserveNode(t *testing.T) {
+	now := time.Now()
+	for desc, test := range map[string]struct {
+		nodes    []*v1.Node
+		expected int
+	}{
+		"ready node": {
+			nodes:    []*v1.Node{node(now.Add(-time.Hour), v1.ConditionTrue), node(now.Add(-time.Hour), v1.ConditionTrue)},
+			expected: 0,
+		},
+		"not ready node": {
+			nodes:    []*v1.Node{node(now.Add(-time.Hour), v1.ConditionTrue), node(now, v1.ConditionUnknown)},
+			expected: 1,
+		},
+		"node not ready at start": {
+			nodes:    []*v1.Node{node(now.Add(-time.Hour), v1.ConditionFalse)},
+			expected: 1,
+		},
+		"not ready between polls": {
+			nodes:    []*v1.Node{node(now.Add(-time.Hour), v1.ConditionTrue), node(now, v1.ConditionTrue)},
+			expected: 1,
+		},
+	} {
+		a := NewAnalyzer(2*time.Hour, clock.NewFakeClock(now))
+		for _, n := range test.nodes {
+			a.ObserveNode(n)
+		}
+		assert.Equal(t, test.expected, a.Report().NotReadyTransitions, desc)
+	}
+}
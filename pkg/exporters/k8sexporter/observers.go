@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sexporter
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/cmd/options"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/drain"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/history"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/noise"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/podsignal"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+const (
+	// noiseNodePollPeriod is the period at which the node is polled for NotReady transitions
+	// when noise analysis is enabled.
+	noiseNodePollPeriod = time.Minute
+	// drainCheckPeriod is the period at which the drain of the node is checked when the
+	// drain observer is enabled.
+	drainCheckPeriod = time.Minute
+)
+
+// observer is an optional feature of the k8s exporter which observes the problems it
+// exports, e.g. the pod signaler.
+type observer interface {
+	// exported is called with each status exported.
+	exported(status *types.Status)
+	// synced is called with each status of a full sync.
+	synced(status *types.Status)
+	// registerHandlers adds the HTTP handlers of the feature, if any, to mux.
+	registerHandlers(mux *http.ServeMux)
+}
+
+// newObservers creates and starts the observers enabled by the options.
+func newObservers(npdo *options.NodeProblemDetectorOptions, c problemclient.Client) []observer {
+	var observers []observer
+	if npdo.K8sExporterPodSignalConfigPath != "" {
+		config, err := podsignal.LoadConfig(npdo.K8sExporterPodSignalConfigPath)
+		if err != nil {
+			glog.Fatalf("Failed to load pod signal config: %v", err)
+		}
+		podClient := podsignal.NewPodClient(problemclient.NewClientsetOrDie(npdo), npdo.NodeName)
+		signaler := podsignal.NewPodSignaler(config, podClient, npdo.NodeName)
+		signaler.Start()
+		observers = append(observers, podSignalObserver{signaler})
+	}
+	if npdo.K8sExporterNoiseAnalysis {
+		analyzer := noise.NewAnalyzer(npdo.K8sExporterNoiseAnalysisWindow, clock.RealClock{})
+		analyzer.Start(c.GetNode, noiseNodePollPeriod)
+		observers = append(observers, noiseObserver{analyzer})
+	}
+	if npdo.K8sExporterProblemHistorySize > 0 {
+		observers = append(observers, historyObserver{history.NewHistory(npdo.NodeName, npdo.K8sExporterProblemHistorySize)})
+	}
+	return observers
+}
+
+// startDrainObserver starts watching the drain of the node when it is enabled. It does not
+// observe the problems, so it is not an observer of the exporter.
+func startDrainObserver(npdo *options.NodeProblemDetectorOptions, c problemclient.Client) {
+	if npdo.K8sExporterDrainStuckDeadline <= 0 {
+		return
+	}
+	podClient := podsignal.NewPodClient(problemclient.NewClientsetOrDie(npdo), npdo.NodeName)
+	drain.NewObserver(c.GetNode, podClient, c.Eventf, npdo.K8sExporterDrainStuckDeadline).Start(drainCheckPeriod)
+}
+
+// podSignalObserver signals the pods selected by the pod signal config of the problems.
+type podSignalObserver struct {
+	signaler *podsignal.PodSignaler
+}
+
+func (o podSignalObserver) exported(status *types.Status) { o.signaler.Signal(status) }
+
+// synced does nothing, full syncs repeat the problems already signaled.
+func (o podSignalObserver) synced(*types.Status) {}
+
+func (o podSignalObserver) registerHandlers(*http.ServeMux) {}
+
+// noiseObserver scores the problems by how often they churn without the node becoming
+// NotReady.
+type noiseObserver struct {
+	analyzer *noise.Analyzer
+}
+
+func (o noiseObserver) exported(status *types.Status) { o.analyzer.ObserveStatus(status) }
+
+func (o noiseObserver) synced(status *types.Status) { o.analyzer.ObserveStatus(status) }
+
+func (o noiseObserver) registerHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/noise/report", func(w http.ResponseWriter, r *http.Request) {
+		util.ReturnHTTPJson(w, o.analyzer.Report())
+	})
+}
+
+// historyObserver keeps the last problems exported.
+type historyObserver struct {
+	history *history.History
+}
+
+func (o historyObserver) exported(status *types.Status) { o.history.Record(status) }
+
+// synced does nothing, the history only records the problems as they are reported.
+func (o historyObserver) synced(*types.Status) {}
+
+func (o historyObserver) registerHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/problems/history", func(w http.ResponseWriter, r *http.Request) {
+		util.ReturnHTTPJson(w, o.history.List())
+	})
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podsignal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+// Action is what is done to a pod affected by a problem.
+type Action string
+
+const (
+	// Annotate annotates the pod with the problem.
+	Annotate Action = "annotate"
+	// Evict annotates the pod with the problem and evicts it through the eviction API,
+	// which respects PodDisruptionBudgets. It is only done when eviction is allowed in
+	// the config, otherwise the pod is only annotated.
+	Evict Action = "evict"
+)
+
+const (
+	// uidGroup is the name of the capture group matching the pod UID.
+	uidGroup = "uid"
+	// namespaceGroup is the name of the capture group matching the pod namespace.
+	namespaceGroup = "namespace"
+	// nameGroup is the name of the capture group matching the pod name.
+	nameGroup = "name"
+)
+
+// Rule attributes problems with a reason to a pod.
+type Rule struct {
+	// Reason is the reason of the event or condition the rule applies to.
+	Reason string `json:"reason"`
+	// Pattern is matched against the problem message to identify the pod. It must
+	// have either a named group "uid", or named groups "namespace" and "name".
+	Pattern string `json:"pattern"`
+	// Action is either "annotate" or "evict". Default to "annotate".
+	Action Action `json:"action"`
+
+	patternRegexp *regexp.Regexp
+}
+
+// Config is the configuration of the pod signaler.
+type Config struct {
+	// AllowEviction gates the "evict" action. Rules with the "evict" action only
+	// annotate pods when it is false.
+	AllowEviction bool `json:"allowEviction"`
+	// Rules are the rules to attribute problems to pods.
+	Rules []*Rule `json:"rules"`
+}
+
+// LoadConfig reads, defaults and validates the config file.
+func LoadConfig(path string) (*Config, error) {
+	f, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", path, err)
+	}
+	config := &Config{}
+	if err := util.UnmarshalStrict(f, config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", path, err)
+	}
+	config.ApplyConfiguration()
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", path, err)
+	}
+	return config, nil
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() {
+	for _, rule := range c.Rules {
+		if rule.Action == "" {
+			rule.Action = Annotate
+		}
+	}
+}
+
+// Validate verifies whether the settings are valid, and compiles the patterns.
+func (c *Config) Validate() error {
+	for _, rule := range c.Rules {
+		if rule.Reason == "" {
+			return fmt.Errorf("rule %+v has no reason", rule)
+		}
+		if rule.Action != Annotate && rule.Action != Evict {
+			return fmt.Errorf("rule %q has unknown action %q, supported: %q, %q", rule.Reason, rule.Action, Annotate, Evict)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %q has invalid pattern %q: %v", rule.Reason, rule.Pattern, err)
+		}
+		groups := map[string]bool{}
+		for _, name := range re.SubexpNames() {
+			groups[name] = true
+		}
+		if !groups[uidGroup] && !(groups[namespaceGroup] && groups[nameGroup]) {
+			return fmt.Errorf("pattern %q of rule %q must have a named group %q, or named groups %q and %q",
+				rule.Pattern, rule.Reason, uidGroup, namespaceGroup, nameGroup)
+		}
+		rule.patternRegexp = re
+	}
+	return nil
+}
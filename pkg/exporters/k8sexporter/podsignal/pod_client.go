@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podsignal
+
+import (
+	"encoding/json"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// PodClient is the interface to the pods on the current node.
+type PodClient interface {
+	// ListPods lists all pods on the current node.
+	ListPods() ([]v1.Pod, error)
+	// GetPod gets a pod.
+	GetPod(namespace, name string) (*v1.Pod, error)
+	// AnnotatePod adds annotations to a pod.
+	AnnotatePod(namespace, name string, annotations map[string]string) error
+	// EvictPod evicts a pod through the eviction API.
+	EvictPod(namespace, name string) error
+}
+
+type podClient struct {
+	client   clientset.Interface
+	nodeName string
+}
+
+// NewPodClient creates a PodClient for the pods on the node.
+func NewPodClient(client clientset.Interface, nodeName string) PodClient {
+	return &podClient{client: client, nodeName: nodeName}
+}
+
+func (c *podClient) ListPods() ([]v1.Pod, error) {
+	pods, err := c.client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", c.nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+func (c *podClient) GetPod(namespace, name string) (*v1.Pod, error) {
+	return c.client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *podClient) AnnotatePod(namespace, name string, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.CoreV1().Pods(namespace).Patch(name, types.MergePatchType, patch)
+	return err
+}
+
+func (c *podClient) EvictPod(namespace, name string) error {
+	return c.client.PolicyV1beta1().Evictions(namespace).Evict(&policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+	})
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podsignal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	// ReasonAnnotation is the pod annotation holding the reason of the latest problem
+	// attributed to the pod.
+	ReasonAnnotation = "node-problem-detector.k8s.io/problem-reason"
+	// MessageAnnotation is the pod annotation holding the message of the latest problem.
+	MessageAnnotation = "node-problem-detector.k8s.io/problem-message"
+	// TimestampAnnotation is the pod annotation holding the time of the latest problem.
+	TimestampAnnotation = "node-problem-detector.k8s.io/problem-timestamp"
+)
+
+// PodSignaler annotates or evicts pods that problems are attributed to.
+type PodSignaler struct {
+	config   *Config
+	client   PodClient
+	nodeName string
+	// problems is the queue of problems to process. Pod operations are done in a
+	// separate goroutine so that they don't block the exporter.
+	problems chan problem
+}
+
+// problem is a single event, or a condition which just became true.
+type problem struct {
+	reason    string
+	message   string
+	timestamp time.Time
+}
+
+// NewPodSignaler creates a pod signaler.
+func NewPodSignaler(config *Config, client PodClient, nodeName string) *PodSignaler {
+	return &PodSignaler{
+		config:   config,
+		client:   client,
+		nodeName: nodeName,
+		// A 1000 size channel should be big enough.
+		problems: make(chan problem, 1000),
+	}
+}
+
+// Start starts processing problems.
+func (s *PodSignaler) Start() {
+	go func() {
+		for p := range s.problems {
+			s.process(p)
+		}
+	}()
+}
+
+// Signal queues the new events and the conditions in status that became true. It
+// should only be called with problem changes, not with full syncs, so that pods
+// are not signaled repeatedly for the same problem.
+func (s *PodSignaler) Signal(status *types.Status) {
+	for _, event := range status.Events {
+		s.enqueue(problem{reason: event.Reason, message: event.Message, timestamp: event.Timestamp})
+	}
+	for _, condition := range status.Conditions {
+		if condition.Status != types.True {
+			continue
+		}
+		s.enqueue(problem{reason: condition.Reason, message: condition.Message, timestamp: condition.Transition})
+	}
+}
+
+func (s *PodSignaler) enqueue(p problem) {
+	if s.findRule(p.reason) == nil {
+		return
+	}
+	select {
+	case s.problems <- p:
+	default:
+		glog.Errorf("Pod signal queue is full, dropping problem %q: %q", p.reason, p.message)
+	}
+}
+
+func (s *PodSignaler) findRule(reason string) *Rule {
+	for _, rule := range s.config.Rules {
+		if rule.Reason == reason {
+			return rule
+		}
+	}
+	return nil
+}
+
+// process annotates or evicts the pod a problem is attributed to.
+func (s *PodSignaler) process(p problem) {
+	rule := s.findRule(p.reason)
+	if rule == nil {
+		return
+	}
+	pod, err := s.findPod(rule, p.message)
+	if err != nil {
+		glog.Errorf("Failed to find pod for problem %q: %v", p.reason, err)
+		return
+	}
+	if pod == nil {
+		glog.V(3).Infof("No pod on node %q is attributed to problem %q: %q", s.nodeName, p.reason, p.message)
+		return
+	}
+
+	err = s.client.AnnotatePod(pod.Namespace, pod.Name, map[string]string{
+		ReasonAnnotation:    p.reason,
+		MessageAnnotation:   p.message,
+		TimestampAnnotation: p.timestamp.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		glog.Errorf("Failed to annotate pod %s/%s with problem %q: %v", pod.Namespace, pod.Name, p.reason, err)
+		return
+	}
+	glog.Infof("Annotated pod %s/%s with problem %q", pod.Namespace, pod.Name, p.reason)
+
+	if rule.Action != Evict {
+		return
+	}
+	if !s.config.AllowEviction {
+		glog.Infof("Not evicting pod %s/%s for problem %q: eviction is not allowed", pod.Namespace, pod.Name, p.reason)
+		return
+	}
+	if err := s.client.EvictPod(pod.Namespace, pod.Name); err != nil {
+		glog.Errorf("Failed to evict pod %s/%s for problem %q: %v", pod.Namespace, pod.Name, p.reason, err)
+		return
+	}
+	glog.Infof("Evicted pod %s/%s for problem %q", pod.Namespace, pod.Name, p.reason)
+}
+
+// findPod returns the pod on the current node identified by the message, or nil if
+// the message does not identify any pod on the node.
+func (s *PodSignaler) findPod(rule *Rule, message string) (*v1.Pod, error) {
+	match := rule.patternRegexp.FindStringSubmatch(message)
+	if match == nil {
+		return nil, nil
+	}
+	groups := map[string]string{}
+	for i, name := range rule.patternRegexp.SubexpNames() {
+		if name != "" {
+			groups[name] = match[i]
+		}
+	}
+
+	if uid := groups[uidGroup]; uid != "" {
+		pods, err := s.client.ListPods()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %v", err)
+		}
+		for i := range pods {
+			if string(pods[i].UID) == uid {
+				return &pods[i], nil
+			}
+		}
+		return nil, nil
+	}
+
+	namespace, name := groups[namespaceGroup], groups[nameGroup]
+	if namespace == "" || name == "" {
+		return nil, nil
+	}
+	pod, err := s.client.GetPod(namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s/%s: %v", namespace, name, err)
+	}
+	// Never signal pods on other nodes.
+	if pod.Spec.NodeName != s.nodeName {
+		return nil, nil
+	}
+	return pod, nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podsignal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const testNode = "node-1"
+
+type fakePodClient struct {
+	pods      []v1.Pod
+	annotated map[string]map[string]string
+	evicted   []string
+}
+
+func newFakePodClient(pods ...v1.Pod) *fakePodClient {
+	return &fakePodClient{pods: pods, annotated: map[string]map[string]string{}}
+}
+
+func (f *fakePodClient) ListPods() ([]v1.Pod, error) {
+	var pods []v1.Pod
+	for _, pod := range f.pods {
+		if pod.Spec.NodeName == testNode {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+func (f *fakePodClient) GetPod(namespace, name string) (*v1.Pod, error) {
+	for i := range f.pods {
+		if f.pods[i].Namespace == namespace && f.pods[i].Name == name {
+			return &f.pods[i], nil
+		}
+	}
+	return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+}
+
+func (f *fakePodClient) AnnotatePod(namespace, name string, annotations map[string]string) error {
+	f.annotated[namespace+"/"+name] = annotations
+	return nil
+}
+
+func (f *fakePodClient) EvictPod(namespace, name string) error {
+	f.evicted = append(f.evicted, namespace+"/"+name)
+	return nil
+}
+
+func newPod(namespace, name, uid, node string) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: apitypes.UID(uid)},
+		Spec:       v1.PodSpec{NodeName: node},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    Rule
+		isError bool
+	}{
+		{name: "uid group", rule: Rule{Reason: "OOMKilling", Pattern: "pod(?P<uid>[0-9a-f-]+)"}},
+		{name: "namespace and name groups", rule: Rule{Reason: "OOMKilling", Pattern: "(?P<namespace>\\S+)/(?P<name>\\S+)"}},
+		{name: "missing groups", rule: Rule{Reason: "OOMKilling", Pattern: "(?P<name>\\S+)"}, isError: true},
+		{name: "missing reason", rule: Rule{Pattern: "pod(?P<uid>[0-9a-f-]+)"}, isError: true},
+		{name: "unknown action", rule: Rule{Reason: "OOMKilling", Pattern: "pod(?P<uid>[0-9a-f-]+)", Action: "delete"}, isError: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{Rules: []*Rule{&test.rule}}
+			config.ApplyConfiguration()
+			err := config.Validate()
+			assert.Equal(t, test.isError, err != nil, "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestProcess(t *testing.T) {
+	uid := "0f5c1e4e-4f2b-11ea-8b8d-42010a800002"
+	timestamp := time.Date(2020, 2, 14, 1, 2, 3, 0, time.UTC)
+
+	testCases := []struct {
+		name              string
+		allowEviction     bool
+		rule              Rule
+		pods              []v1.Pod
+		message           string
+		expectedAnnotated []string
+		expectedEvicted   []string
+	}{
+		{
+			name:              "annotate pod by uid",
+			rule:              Rule{Reason: "OOMKilling", Pattern: "pod(?P<uid>[0-9a-f-]{36})"},
+			pods:              []v1.Pod{newPod("default", "web", uid, testNode)},
+			message:           "Task in /kubepods/burstable/pod" + uid + "/abc killed",
+			expectedAnnotated: []string{"default/web"},
+		},
+		{
+			name:              "annotate pod by namespace and name",
+			rule:              Rule{Reason: "OOMKilling", Pattern: "pod (?P<namespace>\\S+)/(?P<name>\\S+)"},
+			pods:              []v1.Pod{newPod("default", "web", uid, testNode)},
+			message:           "pod default/web killed",
+			expectedAnnotated: []string{"default/web"},
+		},
+		{
+			name:    "ignore pod on other node",
+			rule:    Rule{Reason: "OOMKilling", Pattern: "pod (?P<namespace>\\S+)/(?P<name>\\S+)"},
+			pods:    []v1.Pod{newPod("default", "web", uid, "node-2")},
+			message: "pod default/web killed",
+		},
+		{
+			name:    "ignore unmatched message",
+			rule:    Rule{Reason: "OOMKilling", Pattern: "pod(?P<uid>[0-9a-f-]{36})"},
+			pods:    []v1.Pod{newPod("default", "web", uid, testNode)},
+			message: "Killed process 1234",
+		},
+		{
+			name:              "evict action without allowing eviction only annotates",
+			rule:              Rule{Reason: "OOMKilling", Pattern: "pod(?P<uid>[0-9a-f-]{36})", Action: Evict},
+			pods:              []v1.Pod{newPod("default", "web", uid, testNode)},
+			message:           "pod" + uid,
+			expectedAnnotated: []string{"default/web"},
+		},
+		{
+			name:              "evict pod",
+			allowEviction:     true,
+			rule:              Rule{Reason: "OOMKilling", Pattern: "pod(?P<uid>[0-9a-f-]{36})", Action: Evict},
+			pods:              []v1.Pod{newPod("default", "web", uid, testNode)},
+			message:           "pod" + uid,
+			expectedAnnotated: []string{"default/web"},
+			expectedEvicted:   []string{"default/web"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{AllowEviction: test.allowEviction, Rules: []*Rule{&test.rule}}
+			config.ApplyConfiguration()
+			assert.NoError(t, config.Validate())
+			client := newFakePodClient(test.pods...)
+			s := NewPodSignaler(config, client, testNode)
+
+			s.process(problem{reason: "OOMKilling", message: test.message, timestamp: timestamp})
+
+			var annotated []string
+			for pod, annotations := range client.annotated {
+				annotated = append(annotated, pod)
+				assert.Equal(t, map[string]string{
+					ReasonAnnotation:    "OOMKilling",
+					MessageAnnotation:   test.message,
+					TimestampAnnotation: "2020-02-14T01:02:03Z",
+				}, annotations)
+			}
+			assert.Equal(t, test.expectedAnnotated, annotated)
+			assert.Equal(t, test.expectedEvicted, client.evicted)
+		})
+	}
+}
+
+func TestSignal(t *testing.T) {
+	config := &Config{Rules: []*Rule{{Reason: "OOMKilling", Pattern: "pod(?P<uid>[0-9a-f-]{36})"}}}
+	config.ApplyConfiguration()
+	assert.NoError(t, config.Validate())
+	s := NewPodSignaler(config, newFakePodClient(), testNode)
+
+	s.Signal(&types.Status{
+		Events: []types.Event{{Reason: "OOMKilling"}, {Reason: "TaskHung"}},
+		Conditions: []types.Condition{
+			{Type: "MemoryProblem", Status: types.True, Reason: "OOMKilling"},
+			{Type: "MemoryProblem", Status: types.False, Reason: "OOMKilling"},
+		},
+	})
+	// Only the event and the true condition with a matching rule are queued.
+	assert.Equal(t, 2, len(s.problems))
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/rest"
+
+	"k8s.io/node-problem-detector/pkg/exporters"
+)
+
+const (
+	// CoreV1EventAPI writes events with the core v1 API.
+	CoreV1EventAPI = "v1"
+	// EventsV1beta1EventAPI writes events with the events.k8s.io/v1beta1 API.
+	EventsV1beta1EventAPI = "events.k8s.io/v1beta1"
+	// EventsV1EventAPI writes events with the events.k8s.io/v1 API.
+	EventsV1EventAPI = "events.k8s.io/v1"
+
+	// seriesWindow is the time after which an event no longer repeats its previous
+	// occurrence, and starts a new event instead of extending the series.
+	seriesWindow = 6 * time.Minute
+	// noteLengthLimit is the maximum length of the note accepted by the apiserver.
+	noteLengthLimit = 1024
+	// eventAction is the action of all events, which report detected problems.
+	eventAction = "Detected"
+)
+
+// apiEvent is an events.k8s.io Event. Only the fields which are the same in v1beta1 and
+// v1 are used, so that it can be written to both.
+type apiEvent struct {
+	metav1.TypeMeta     `json:",inline"`
+	metav1.ObjectMeta   `json:"metadata"`
+	EventTime           metav1.MicroTime   `json:"eventTime"`
+	Series              *apiEventSeries    `json:"series,omitempty"`
+	ReportingController string             `json:"reportingController"`
+	ReportingInstance   string             `json:"reportingInstance"`
+	Action              string             `json:"action"`
+	Reason              string             `json:"reason"`
+	Regarding           v1.ObjectReference `json:"regarding"`
+	Note                string             `json:"note,omitempty"`
+	Type                string             `json:"type"`
+}
+
+type apiEventSeries struct {
+	Count            int32            `json:"count"`
+	LastObservedTime metav1.MicroTime `json:"lastObservedTime"`
+}
+
+// seriesKey identifies the repeated occurrences of an event.
+type seriesKey struct {
+	source    string
+	namespace string
+	kind      string
+	name      string
+	eventType string
+	reason    string
+	note      string
+}
+
+// series is the last occurrence of an event.
+type series struct {
+	name         string
+	count        int32
+	lastObserved time.Time
+}
+
+// eventRequest is an event to write.
+type eventRequest struct {
+	ref       *v1.ObjectReference
+	eventType string
+	source    string
+	reason    string
+	note      string
+	timestamp time.Time
+	// annotations are set on the created event.
+	annotations map[string]string
+}
+
+// seriesEventRecorder writes events with the events.k8s.io API. An event repeating within
+// the series window patches the series of its previous occurrence, instead of creating a
+// new event.
+type seriesEventRecorder struct {
+	nodeName string
+	clock    clock.Clock
+	// retry retries the writes while the apiserver is unavailable, the events recorded
+	// meanwhile wait in the queue.
+	retry RetryPolicy
+	queue chan *eventRequest
+	// series is only accessed in the goroutine writing the events.
+	series map[seriesKey]*series
+	// create and patch write to the apiserver.
+	create func(namespace string, event *apiEvent) error
+	patch  func(namespace, name string, patch []byte) error
+}
+
+// newSeriesEventRecorder creates a recorder writing events to the API group version, e.g.
+// "events.k8s.io/v1", with the REST client.
+func newSeriesEventRecorder(client rest.Interface, groupVersion, nodeName string, clock clock.Clock, retry RetryPolicy) *seriesEventRecorder {
+	r := &seriesEventRecorder{
+		nodeName: nodeName,
+		clock:    clock,
+		retry:    retry,
+		// A 1000 size channel should be big enough.
+		queue:  make(chan *eventRequest, 1000),
+		series: make(map[seriesKey]*series),
+	}
+	// The path is set explicitly, so that events.k8s.io/v1 can be written with a client
+	// of another version.
+	r.create = func(namespace string, event *apiEvent) error {
+		event.APIVersion = groupVersion
+		event.Kind = "Event"
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return client.Post().AbsPath("/apis", groupVersion, "namespaces", namespace, "events").
+			SetHeader("Content-Type", "application/json").Body(body).Do().Error()
+	}
+	r.patch = func(namespace, name string, patch []byte) error {
+		return client.Patch(types.MergePatchType).AbsPath("/apis", groupVersion, "namespaces", namespace, "events", name).
+			Body(patch).Do().Error()
+	}
+	return r
+}
+
+// Start starts writing the recorded events.
+func (r *seriesEventRecorder) Start() {
+	go func() {
+		for req := range r.queue {
+			if err := r.retry.Do(r.clock, func() error { return r.write(req) }); err != nil {
+				glog.Errorf("Failed to write event %+v: %v", *req, err)
+				exporters.RecordFailure("k8s", "events")
+			}
+		}
+	}()
+}
+
+// Eventf records an event on the object. The event is dropped if too many events are
+// waiting to be written.
+func (r *seriesEventRecorder) Eventf(ref *v1.ObjectReference, eventType, source, reason, messageFmt string, args ...interface{}) {
+	r.AnnotatedEventf(ref, nil, eventType, source, reason, messageFmt, args...)
+}
+
+// AnnotatedEventf is like Eventf, and sets the annotations on the event. The annotations
+// of repeated events are not updated.
+func (r *seriesEventRecorder) AnnotatedEventf(ref *v1.ObjectReference, annotations map[string]string, eventType, source, reason, messageFmt string, args ...interface{}) {
+	req := &eventRequest{
+		ref:         ref,
+		eventType:   eventType,
+		source:      source,
+		reason:      reason,
+		note:        fmt.Sprintf(messageFmt, args...),
+		timestamp:   r.clock.Now(),
+		annotations: annotations,
+	}
+	if len(req.note) > noteLengthLimit {
+		req.note = req.note[:noteLengthLimit]
+	}
+	select {
+	case r.queue <- req:
+	default:
+		glog.Errorf("Dropped event %+v, too many events are waiting to be written", *req)
+		exporters.RecordFailure("k8s", "events")
+	}
+}
+
+// write creates the event, or patches the series of its previous occurrence. The series
+// is only updated once the write succeeds, so that the write can be retried.
+func (r *seriesEventRecorder) write(req *eventRequest) error {
+	r.forgetFinishedSeries(req.timestamp)
+	namespace := req.ref.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	key := seriesKey{
+		source:    req.source,
+		namespace: namespace,
+		kind:      req.ref.Kind,
+		name:      req.ref.Name,
+		eventType: req.eventType,
+		reason:    req.reason,
+		note:      req.note,
+	}
+	if s, ok := r.series[key]; ok {
+		patch, err := json.Marshal(map[string]interface{}{
+			"series": apiEventSeries{Count: s.count + 1, LastObservedTime: metav1.NewMicroTime(req.timestamp)},
+		})
+		if err != nil {
+			return err
+		}
+		if err := r.patch(namespace, s.name, patch); err != nil {
+			return err
+		}
+		s.count++
+		s.lastObserved = req.timestamp
+		return nil
+	}
+
+	event := &apiEvent{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%v.%x", req.ref.Name, req.timestamp.UnixNano()),
+			Namespace:   namespace,
+			Annotations: req.annotations,
+		},
+		EventTime:           metav1.NewMicroTime(req.timestamp),
+		ReportingController: req.source,
+		ReportingInstance:   req.source + "-" + r.nodeName,
+		Action:              eventAction,
+		Reason:              req.reason,
+		Regarding:           *req.ref,
+		Note:                req.note,
+		Type:                req.eventType,
+	}
+	if err := r.create(namespace, event); err != nil {
+		return err
+	}
+	r.series[key] = &series{name: event.Name, count: 1, lastObserved: req.timestamp}
+	return nil
+}
+
+// forgetFinishedSeries forgets the series which did not repeat within the series window.
+func (r *seriesEventRecorder) forgetFinishedSeries(now time.Time) {
+	for key, s := range r.series {
+		if now.Sub(s.lastObserved) > seriesWindow {
+			delete(r.series, key)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+type fakeEventWriter struct {
+	created []*apiEvent
+	patched map[string][]string
+}
+
+func newTestSeriesEventRecorder(fakeClock clock.Clock) (*seriesEventRecorder, *fakeEventWriter) {
+	writer := &fakeEventWriter{patched: map[string][]string{}}
+	r := newSeriesEventRecorder(nil, EventsV1EventAPI, testNode, fakeClock, testRetryPolicy)
+	r.create = func(namespace string, event *apiEvent) error {
+		writer.created = append(writer.created, event)
+		return nil
+	}
+	r.patch = func(namespace, name string, patch []byte) error {
+		writer.patched[name] = append(writer.patched[name], string(patch))
+		return nil
+	}
+	return r, writer
+}
+
+func TestSeriesEventRecorder(t *testing.T) {
+	start := time.Date(2020, 3, 7, 0, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFakeClock(start)
+	r, writer := newTestSeriesEventRecorder(fakeClock)
+	ref := getNodeRef("", testNode)
+
+	write := func(reason, note string) {
+		r.Eventf(ref, v1.EventTypeWarning, testSource, reason, "%s", note)
+		assert.NoError(t, r.write(<-r.queue))
+	}
+
+	write("TaskHung", "task blocked")
+	assert.Len(t, writer.created, 1)
+	event := writer.created[0]
+	assert.Equal(t, "default", event.Namespace)
+	assert.Equal(t, "TaskHung", event.Reason)
+	assert.Equal(t, "task blocked", event.Note)
+	assert.Equal(t, v1.EventTypeWarning, event.Type)
+	assert.Equal(t, testSource, event.ReportingController)
+	assert.Equal(t, testSource+"-"+testNode, event.ReportingInstance)
+	assert.Equal(t, *ref, event.Regarding)
+	assert.Nil(t, event.Series)
+
+	// Repeated events extend the series of the first occurrence.
+	fakeClock.Step(time.Minute)
+	write("TaskHung", "task blocked")
+	fakeClock.Step(time.Minute)
+	write("TaskHung", "task blocked")
+	assert.Len(t, writer.created, 1)
+	assert.Equal(t, []string{
+		`{"series":{"count":2,"lastObservedTime":"2020-03-07T00:01:00.000000Z"}}`,
+		`{"series":{"count":3,"lastObservedTime":"2020-03-07T00:02:00.000000Z"}}`,
+	}, writer.patched[event.Name])
+
+	// Other events start their own series.
+	write("TaskHung", "another task blocked")
+	assert.Len(t, writer.created, 2)
+
+	// Events after the series window start a new series.
+	fakeClock.Step(seriesWindow + time.Second)
+	write("TaskHung", "task blocked")
+	assert.Len(t, writer.created, 3)
+	assert.NotEqual(t, event.Name, writer.created[2].Name)
+}
+
+func TestSeriesEventRecorderTruncatesNote(t *testing.T) {
+	r, _ := newTestSeriesEventRecorder(clock.NewFakeClock(time.Now()))
+	long := make([]byte, 2*noteLengthLimit)
+	for i := range long {
+		long[i] = 'a'
+	}
+	r.Eventf(getNodeRef("", testNode), v1.EventTypeWarning, testSource, "TaskHung", "%s", string(long))
+	assert.Len(t, (<-r.queue).note, noteLengthLimit)
+}
+
+func TestSeriesEventRecorderAnnotations(t *testing.T) {
+	r, writer := newTestSeriesEventRecorder(clock.NewFakeClock(time.Now()))
+	annotations := map[string]string{"node-problem-detector.k8s.io/device": "sda1"}
+	r.AnnotatedEventf(getNodeRef("", testNode), annotations, v1.EventTypeWarning, testSource, "IOError", "%s", "I/O error on sda1")
+	assert.NoError(t, r.write(<-r.queue))
+	if assert.Len(t, writer.created, 1) {
+		assert.Equal(t, annotations, writer.created[0].Annotations)
+	}
+}
+
+func TestSeriesEventRecorderRetriedPatch(t *testing.T) {
+	r, writer := newTestSeriesEventRecorder(clock.NewFakeClock(time.Now()))
+	ref := getNodeRef("", testNode)
+	r.Eventf(ref, v1.EventTypeWarning, testSource, "TaskHung", "%s", "task blocked")
+	assert.NoError(t, r.write(<-r.queue))
+
+	// A failed patch does not count the occurrence, so that the retry counts it once.
+	patch := r.patch
+	r.patch = func(namespace, name string, data []byte) error {
+		return apierrors.NewServiceUnavailable("apiserver is shutting down")
+	}
+	r.Eventf(ref, v1.EventTypeWarning, testSource, "TaskHung", "%s", "task blocked")
+	req := <-r.queue
+	assert.Error(t, r.write(req))
+	r.patch = patch
+	assert.NoError(t, r.write(req))
+	assert.Len(t, writer.patched[writer.created[0].Name], 1)
+	assert.Contains(t, writer.patched[writer.created[0].Name][0], `"count":2`)
+}
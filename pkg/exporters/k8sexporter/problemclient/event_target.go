@@ -0,0 +1,141 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+const (
+	// nodeNamePlaceholder is replaced by the node name in event targets.
+	nodeNamePlaceholder = "{node}"
+	// podNamePlaceholder and podNamespacePlaceholder are replaced by the name and the
+	// namespace of the node-problem-detector pod in event targets, which are read from the
+	// POD_NAME and POD_NAMESPACE environment variables.
+	podNamePlaceholder      = "{pod}"
+	podNamespacePlaceholder = "{podNamespace}"
+)
+
+// EventTarget is the object events are attached to, i.e. the involved object of the events.
+type EventTarget struct {
+	// APIVersion is the API version of the object, e.g. "v1".
+	APIVersion string `json:"apiVersion"`
+	// Kind is the kind of the object, e.g. "ConfigMap".
+	Kind string `json:"kind"`
+	// Namespace is the namespace of the object, where the events are written to. Default
+	// to the --event-namespace. "{podNamespace}" is replaced by the namespace of the
+	// node-problem-detector pod.
+	Namespace string `json:"namespace"`
+	// Name is the name of the object. "{node}" is replaced by the node name, "{pod}" by
+	// the name of the node-problem-detector pod.
+	Name string `json:"name"`
+}
+
+// EventTargetRule attaches the events of a source and reason to a target.
+type EventTargetRule struct {
+	// Source is the source of the events. Empty matches all sources.
+	Source string `json:"source"`
+	// Reason is the reason of the events. Empty matches all reasons.
+	Reason string `json:"reason"`
+	// Target is the object the events are attached to.
+	Target EventTarget `json:"target"`
+}
+
+// EventTargetConfig configures the objects events are attached to.
+type EventTargetConfig struct {
+	// Default is the target of events not matching any rule. Default to the Node.
+	Default *EventTarget `json:"default"`
+	// Rules are matched in order, the first matching rule decides the target.
+	Rules []*EventTargetRule `json:"rules"`
+}
+
+// LoadEventTargetConfig reads and validates the event target config file.
+func LoadEventTargetConfig(path string) (*EventTargetConfig, error) {
+	f, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", path, err)
+	}
+	config := &EventTargetConfig{}
+	if err := util.UnmarshalStrict(f, config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", path, err)
+	}
+	return config, nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *EventTargetConfig) Validate() error {
+	if c.Default != nil {
+		if err := c.Default.validate(); err != nil {
+			return fmt.Errorf("invalid default target: %v", err)
+		}
+	}
+	for _, rule := range c.Rules {
+		if err := rule.Target.validate(); err != nil {
+			return fmt.Errorf("invalid target of rule %+v: %v", *rule, err)
+		}
+	}
+	return nil
+}
+
+func (t *EventTarget) validate() error {
+	if t.APIVersion == "" || t.Kind == "" || t.Name == "" {
+		return fmt.Errorf("apiVersion, kind and name must be set")
+	}
+	return nil
+}
+
+// target returns the target of the events of the source and reason, or nil if the events
+// should be attached to the Node.
+func (c *EventTargetConfig) target(source, reason string) *EventTarget {
+	if c == nil {
+		return nil
+	}
+	for _, rule := range c.Rules {
+		if (rule.Source == "" || rule.Source == source) && (rule.Reason == "" || rule.Reason == reason) {
+			return &rule.Target
+		}
+	}
+	return c.Default
+}
+
+// objectReference returns the reference of the target object on the node.
+func (t *EventTarget) objectReference(defaultNamespace, nodeName string) *v1.ObjectReference {
+	replacer := strings.NewReplacer(
+		nodeNamePlaceholder, nodeName,
+		podNamePlaceholder, os.Getenv("POD_NAME"),
+		podNamespacePlaceholder, os.Getenv("POD_NAMESPACE"))
+	namespace := replacer.Replace(t.Namespace)
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return &v1.ObjectReference{
+		APIVersion: t.APIVersion,
+		Kind:       t.Kind,
+		Namespace:  namespace,
+		Name:       replacer.Replace(t.Name),
+	}
+}
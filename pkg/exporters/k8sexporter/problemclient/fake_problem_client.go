@@ -27,22 +27,32 @@ import (
 // FakeProblemClient is a fake problem client for debug.
 type FakeProblemClient struct {
 	sync.Mutex
-	conditions map[v1.NodeConditionType]v1.NodeCondition
-	errors     map[string]error
+	conditions  map[v1.NodeConditionType]v1.NodeCondition
+	annotations map[string]string
+	errors      map[string]error
+	// node is returned by GetNode, which fails if it is nil.
+	node *v1.Node
+	// events are the events recorded, formatted as "<type> <reason> <message>".
+	events []string
 }
 
 // NewFakeProblemClient creates a new fake problem client.
 func NewFakeProblemClient() *FakeProblemClient {
 	return &FakeProblemClient{
-		conditions: make(map[v1.NodeConditionType]v1.NodeCondition),
-		errors:     make(map[string]error),
+		conditions:  make(map[v1.NodeConditionType]v1.NodeCondition),
+		annotations: make(map[string]string),
+		errors:      make(map[string]error),
 	}
 }
 
-// InjectError injects error to specific function.
+// InjectError injects error to specific function. A nil error clears the injected error.
 func (f *FakeProblemClient) InjectError(fun string, err error) {
 	f.Lock()
 	defer f.Unlock()
+	if err == nil {
+		delete(f.errors, fun)
+		return
+	}
 	f.errors[fun] = err
 }
 
@@ -72,6 +82,20 @@ func (f *FakeProblemClient) SetConditions(conditions []v1.NodeCondition) error {
 	return nil
 }
 
+// RemoveConditions is a fake mimic of RemoveConditions, it only removes the conditions from
+// the internal condition cache.
+func (f *FakeProblemClient) RemoveConditions(types []v1.NodeConditionType) error {
+	f.Lock()
+	defer f.Unlock()
+	if err, ok := f.errors["RemoveConditions"]; ok {
+		return err
+	}
+	for _, t := range types {
+		delete(f.conditions, t)
+	}
+	return nil
+}
+
 // GetConditions is a fake mimic of GetConditions, it returns the conditions cached internally.
 func (f *FakeProblemClient) GetConditions(types []v1.NodeConditionType) ([]*v1.NodeCondition, error) {
 	f.Lock()
@@ -89,10 +113,64 @@ func (f *FakeProblemClient) GetConditions(types []v1.NodeConditionType) ([]*v1.N
 	return conditions, nil
 }
 
-// Eventf does nothing now.
+// SetAnnotations is a fake mimic of SetAnnotations, it only updates the internal annotation cache.
+func (f *FakeProblemClient) SetAnnotations(annotations map[string]string) error {
+	f.Lock()
+	defer f.Unlock()
+	if err, ok := f.errors["SetAnnotations"]; ok {
+		return err
+	}
+	for k, v := range annotations {
+		f.annotations[k] = v
+	}
+	return nil
+}
+
+// Annotations returns a copy of the annotations cached internally.
+func (f *FakeProblemClient) Annotations() map[string]string {
+	f.Lock()
+	defer f.Unlock()
+	annotations := map[string]string{}
+	for k, v := range f.annotations {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// Eventf is a fake mimic of Eventf, it only records the event.
 func (f *FakeProblemClient) Eventf(eventType string, source, reason, messageFmt string, args ...interface{}) {
+	f.AnnotatedEventf(nil, eventType, source, reason, messageFmt, args...)
+}
+
+// AnnotatedEventf is a fake mimic of AnnotatedEventf, it only records the event.
+func (f *FakeProblemClient) AnnotatedEventf(annotations map[string]string, eventType string, source, reason, messageFmt string, args ...interface{}) {
+	f.Lock()
+	defer f.Unlock()
+	f.events = append(f.events, fmt.Sprintf("%s %s %s", eventType, reason, fmt.Sprintf(messageFmt, args...)))
+}
+
+// Events returns a copy of the events recorded.
+func (f *FakeProblemClient) Events() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.events...)
+}
+
+// SetNode sets the node returned by GetNode.
+func (f *FakeProblemClient) SetNode(node *v1.Node) {
+	f.Lock()
+	defer f.Unlock()
+	f.node = node
 }
 
 func (f *FakeProblemClient) GetNode() (*v1.Node, error) {
-	return nil, fmt.Errorf("GetNode() not implemented")
+	f.Lock()
+	defer f.Unlock()
+	if err, ok := f.errors["GetNode"]; ok {
+		return nil, err
+	}
+	if f.node == nil {
+		return nil, fmt.Errorf("GetNode() not implemented")
+	}
+	return f.node, nil
 }
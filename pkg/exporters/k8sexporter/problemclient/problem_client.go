@@ -22,11 +22,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/kubernetes/pkg/api/legacyscheme"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/clock"
@@ -39,14 +42,32 @@ import (
 	"k8s.io/node-problem-detector/pkg/version"
 )
 
+const (
+	// PatchStrategy updates node conditions with a strategic merge patch.
+	PatchStrategy = "patch"
+	// ApplyStrategy updates node conditions with server-side apply.
+	ApplyStrategy = "apply"
+
+	// FailOnConflict does not update the conditions owned by another field manager.
+	FailOnConflict = "fail"
+	// ForceOnConflict takes over the ownership of conditions owned by another field manager.
+	ForceOnConflict = "force"
+)
+
 // Client is the interface of problem client
 type Client interface {
 	// GetConditions get all specific conditions of current node.
 	GetConditions(conditionTypes []v1.NodeConditionType) ([]*v1.NodeCondition, error)
 	// SetConditions set or update conditions of current node.
 	SetConditions(conditions []v1.NodeCondition) error
+	// RemoveConditions removes the conditions of the types from current node.
+	RemoveConditions(conditionTypes []v1.NodeConditionType) error
+	// SetAnnotations sets or updates annotations of current node.
+	SetAnnotations(annotations map[string]string) error
 	// Eventf reports the event.
 	Eventf(eventType string, source, reason, messageFmt string, args ...interface{})
+	// AnnotatedEventf reports the event with the annotations.
+	AnnotatedEventf(annotations map[string]string, eventType string, source, reason, messageFmt string, args ...interface{})
 	// GetNode returns the Node object of the node on which the
 	// node-problem-detector runs.
 	GetNode() (*v1.Node, error)
@@ -59,12 +80,81 @@ type nodeProblemClient struct {
 	recorders      map[string]record.EventRecorder
 	nodeRef        *v1.ObjectReference
 	eventNamespace string
+	// eventTargets decides the objects events are attached to. Nil attaches all
+	// events to the Node.
+	eventTargets *EventTargetConfig
+	// serverSideApply applies the conditions with server-side apply as fieldManager,
+	// forcing the conflicts if forceConflicts is set.
+	serverSideApply bool
+	fieldManager    string
+	forceConflicts  bool
+	// apply sends the apply patch of the node status.
+	apply func(patch []byte) error
+	// seriesRecorder writes events with the events.k8s.io API. Nil writes events with
+	// the core v1 API.
+	seriesRecorder *seriesEventRecorder
+	// retry retries the event writes failing because the apiserver is unavailable.
+	retry RetryPolicy
 }
 
 // NewClientOrDie creates a new problem client, panics if error occurs.
 func NewClientOrDie(npdo *options.NodeProblemDetectorOptions) Client {
 	c := &nodeProblemClient{clock: clock.RealClock{}}
+	cs := NewClientsetOrDie(npdo)
+	c.client = cs.CoreV1()
+	c.nodeName = npdo.NodeName
+	c.eventNamespace = npdo.EventNamespace
+	c.nodeRef = getNodeRef(c.eventNamespace, c.nodeName)
+	if npdo.NodeUID != "" {
+		c.nodeRef.UID = types.UID(npdo.NodeUID)
+	}
+	c.recorders = make(map[string]record.EventRecorder)
+	c.retry = RetryPolicy{InitialBackoff: npdo.K8sExporterRetryInitialBackoff, MaxBackoff: npdo.K8sExporterRetryMaxBackoff}
+	if npdo.K8sExporterEventTargetConfigPath != "" {
+		config, err := LoadEventTargetConfig(npdo.K8sExporterEventTargetConfigPath)
+		if err != nil {
+			glog.Fatalf("Failed to load event target config: %v", err)
+		}
+		c.eventTargets = config
+	}
+	switch npdo.K8sExporterEventAPI {
+	case CoreV1EventAPI:
+	case EventsV1beta1EventAPI, EventsV1EventAPI:
+		c.seriesRecorder = newSeriesEventRecorder(cs.EventsV1beta1().RESTClient(), npdo.K8sExporterEventAPI, c.nodeName, c.clock, c.retry)
+		c.seriesRecorder.Start()
+	default:
+		glog.Fatalf("Unknown event API %q, supported: %q, %q, %q",
+			npdo.K8sExporterEventAPI, CoreV1EventAPI, EventsV1beta1EventAPI, EventsV1EventAPI)
+	}
+	switch npdo.K8sExporterConditionUpdateStrategy {
+	case PatchStrategy:
+	case ApplyStrategy:
+		c.serverSideApply = true
+	default:
+		glog.Fatalf("Unknown condition update strategy %q, supported: %q, %q",
+			npdo.K8sExporterConditionUpdateStrategy, PatchStrategy, ApplyStrategy)
+	}
+	if c.serverSideApply {
+		if npdo.K8sExporterFieldManager == "" {
+			glog.Fatalf("Field manager must be set for server-side apply")
+		}
+		c.fieldManager = npdo.K8sExporterFieldManager
+		c.apply = c.applyPatch
+		switch npdo.K8sExporterApplyConflictPolicy {
+		case FailOnConflict:
+		case ForceOnConflict:
+			c.forceConflicts = true
+		default:
+			glog.Fatalf("Unknown apply conflict policy %q, supported: %q, %q",
+				npdo.K8sExporterApplyConflictPolicy, FailOnConflict, ForceOnConflict)
+		}
+	}
+	return c
+}
 
+// NewClientsetOrDie creates a Kubernetes clientset connecting to the apiserver
+// configured in the options, panics if error occurs.
+func NewClientsetOrDie(npdo *options.NodeProblemDetectorOptions) clientset.Interface {
 	// we have checked it is a valid URI after command line argument is parsed.:)
 	uri, _ := url.Parse(npdo.ApiServerOverride)
 
@@ -75,12 +165,7 @@ func NewClientOrDie(npdo *options.NodeProblemDetectorOptions) Client {
 
 	cfg.UserAgent = fmt.Sprintf("%s/%s", filepath.Base(os.Args[0]), version.Version())
 	// TODO(random-liu): Set QPS Limit
-	c.client = clientset.NewForConfigOrDie(cfg).CoreV1()
-	c.nodeName = npdo.NodeName
-	c.eventNamespace = npdo.EventNamespace
-	c.nodeRef = getNodeRef(c.eventNamespace, c.nodeName)
-	c.recorders = make(map[string]record.EventRecorder)
-	return c
+	return clientset.NewForConfigOrDie(cfg)
 }
 
 func (c *nodeProblemClient) GetConditions(conditionTypes []v1.NodeConditionType) ([]*v1.NodeCondition, error) {
@@ -90,9 +175,9 @@ func (c *nodeProblemClient) GetConditions(conditionTypes []v1.NodeConditionType)
 	}
 	conditions := []*v1.NodeCondition{}
 	for _, conditionType := range conditionTypes {
-		for _, condition := range node.Status.Conditions {
-			if condition.Type == conditionType {
-				conditions = append(conditions, &condition)
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == conditionType {
+				conditions = append(conditions, &node.Status.Conditions[i])
 			}
 		}
 	}
@@ -104,6 +189,9 @@ func (c *nodeProblemClient) SetConditions(newConditions []v1.NodeCondition) erro
 		// Each time we update the conditions, we update the heart beat time
 		newConditions[i].LastHeartbeatTime = metav1.NewTime(c.clock.Now())
 	}
+	if c.serverSideApply {
+		return c.applyConditions(newConditions)
+	}
 	patch, err := generatePatch(newConditions)
 	if err != nil {
 		return err
@@ -111,14 +199,125 @@ func (c *nodeProblemClient) SetConditions(newConditions []v1.NodeCondition) erro
 	return c.client.RESTClient().Patch(types.StrategicMergePatchType).Resource("nodes").Name(c.nodeName).SubResource("status").Body(patch).Do().Error()
 }
 
+// conflictingConditionPattern matches the field paths of the conditions in the apply
+// conflicts, e.g. `.status.conditions[type="KernelDeadlock"].status`.
+var conflictingConditionPattern = regexp.MustCompile(`^\.status\.conditions\[type="([^"]+)"\]`)
+
+// applyConditions applies the conditions with server-side apply. The conditions must be
+// all the conditions owned by the field manager, the conditions left out are removed.
+// Unless conflicts are forced, the conditions owned by another field manager are left
+// untouched, and the other conditions are applied again without them.
+func (c *nodeProblemClient) applyConditions(conditions []v1.NodeCondition) error {
+	patch, err := generateApplyPatch(c.nodeName, conditions)
+	if err != nil {
+		return err
+	}
+	err = c.apply(patch)
+	if !apierrors.IsConflict(err) || c.forceConflicts {
+		return err
+	}
+	conflicting := conflictingConditions(err)
+	if len(conflicting) == 0 {
+		return fmt.Errorf("conditions are owned by another field manager, use --k8s-exporter-apply-conflict-policy=%s to take them over: %v",
+			ForceOnConflict, err)
+	}
+	var rest []v1.NodeCondition
+	for _, condition := range conditions {
+		if !conflicting[condition.Type] {
+			rest = append(rest, condition)
+		}
+	}
+	glog.Warningf("Conditions %v are owned by another field manager and left untouched, use --k8s-exporter-apply-conflict-policy=%s to take them over",
+		sortedTypes(conflicting), ForceOnConflict)
+	if patch, err = generateApplyPatch(c.nodeName, rest); err != nil {
+		return err
+	}
+	return c.apply(patch)
+}
+
+// applyPatch sends the apply patch of the node status as the field manager.
+func (c *nodeProblemClient) applyPatch(patch []byte) error {
+	req := c.client.RESTClient().Patch(types.ApplyPatchType).Resource("nodes").Name(c.nodeName).SubResource("status").
+		Param("fieldManager", c.fieldManager)
+	if c.forceConflicts {
+		req = req.Param("force", "true")
+	}
+	return req.Body(patch).Do().Error()
+}
+
+// conflictingConditions returns the types of the conditions in the causes of an apply
+// conflict.
+func conflictingConditions(err error) map[v1.NodeConditionType]bool {
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return nil
+	}
+	conflicting := make(map[v1.NodeConditionType]bool)
+	for _, cause := range status.Status().Details.Causes {
+		if m := conflictingConditionPattern.FindStringSubmatch(cause.Field); m != nil {
+			conflicting[v1.NodeConditionType(m[1])] = true
+		}
+	}
+	return conflicting
+}
+
+func sortedTypes(conditionTypes map[v1.NodeConditionType]bool) []string {
+	var sorted []string
+	for t := range conditionTypes {
+		sorted = append(sorted, string(t))
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// RemoveConditions removes the conditions with a strategic merge patch, which works with
+// both condition update strategies, because the removed conditions are not applied any more.
+func (c *nodeProblemClient) RemoveConditions(conditionTypes []v1.NodeConditionType) error {
+	patch, err := generateRemovePatch(conditionTypes)
+	if err != nil {
+		return err
+	}
+	return c.client.RESTClient().Patch(types.StrategicMergePatchType).Resource("nodes").Name(c.nodeName).SubResource("status").Body(patch).Do().Error()
+}
+
+func (c *nodeProblemClient) SetAnnotations(annotations map[string]string) error {
+	patch, err := generateAnnotationPatch(annotations)
+	if err != nil {
+		return err
+	}
+	return c.client.RESTClient().Patch(types.StrategicMergePatchType).Resource("nodes").Name(c.nodeName).Body(patch).Do().Error()
+}
+
 func (c *nodeProblemClient) Eventf(eventType, source, reason, messageFmt string, args ...interface{}) {
-	recorder, found := c.recorders[source]
+	c.AnnotatedEventf(nil, eventType, source, reason, messageFmt, args...)
+}
+
+func (c *nodeProblemClient) AnnotatedEventf(annotations map[string]string, eventType, source, reason, messageFmt string, args ...interface{}) {
+	ref, namespace := c.nodeRef, c.eventNamespace
+	if target := c.eventTargets.target(source, reason); target != nil {
+		ref = target.objectReference(c.eventNamespace, c.nodeName)
+		namespace = ref.Namespace
+	}
+	if c.seriesRecorder != nil {
+		c.seriesRecorder.AnnotatedEventf(ref, annotations, eventType, source, reason, messageFmt, args...)
+		return
+	}
+	// Recorders only write events to their own namespace.
+	key := source
+	if namespace != c.eventNamespace {
+		key = source + "/" + namespace
+	}
+	recorder, found := c.recorders[key]
 	if !found {
 		// TODO(random-liu): If needed use separate client and QPS limit for event.
-		recorder = getEventRecorder(c.client, c.eventNamespace, c.nodeName, source)
-		c.recorders[source] = recorder
+		recorder = getEventRecorder(c.client, namespace, c.nodeName, source, c.clock, c.retry)
+		c.recorders[key] = recorder
 	}
-	recorder.Eventf(c.nodeRef, eventType, reason, messageFmt, args...)
+	if annotations == nil {
+		recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+		return
+	}
+	recorder.AnnotatedEventf(ref, annotations, eventType, reason, messageFmt, args...)
 }
 
 func (c *nodeProblemClient) GetNode() (*v1.Node, error) {
@@ -134,12 +333,46 @@ func generatePatch(conditions []v1.NodeCondition) ([]byte, error) {
 	return []byte(fmt.Sprintf(`{"status":{"conditions":%s}}`, raw)), nil
 }
 
-// getEventRecorder generates a recorder for specific node name and source.
-func getEventRecorder(c typedcorev1.CoreV1Interface, namespace, nodeName, source string) record.EventRecorder {
+// generateRemovePatch generates the patch removing the conditions of the types.
+func generateRemovePatch(conditionTypes []v1.NodeConditionType) ([]byte, error) {
+	conditions := []map[string]interface{}{}
+	for _, t := range conditionTypes {
+		conditions = append(conditions, map[string]interface{}{"$patch": "delete", "type": t})
+	}
+	return json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{"conditions": conditions},
+	})
+}
+
+// generateAnnotationPatch generates the patch setting the annotations.
+func generateAnnotationPatch(annotations map[string]string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+}
+
+// generateApplyPatch generates the apply configuration of the node conditions. It is not
+// built from v1.Node, whose zero value fields would be applied and owned as well.
+func generateApplyPatch(nodeName string, conditions []v1.NodeCondition) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata":   map[string]interface{}{"name": nodeName},
+		"status":     map[string]interface{}{"conditions": conditions},
+	})
+}
+
+// getEventRecorder generates a recorder for specific node name and source. The writes failing
+// because the apiserver is unavailable are retried with the retry policy.
+func getEventRecorder(c typedcorev1.CoreV1Interface, namespace, nodeName, source string, clock clock.Clock, retry RetryPolicy) record.EventRecorder {
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(glog.V(4).Infof)
 	recorder := eventBroadcaster.NewRecorder(legacyscheme.Scheme, v1.EventSource{Component: source, Host: nodeName})
-	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.Events(namespace)})
+	eventBroadcaster.StartRecordingToSink(&retryingEventSink{
+		sink:   &typedcorev1.EventSinkImpl{Interface: c.Events(namespace)},
+		policy: retry,
+		clock:  clock,
+	})
 	return recorder
 }
 
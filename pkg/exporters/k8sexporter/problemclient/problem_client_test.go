@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/tools/record"
@@ -75,6 +76,92 @@ func TestGeneratePatch(t *testing.T) {
 	}
 }
 
+func TestGenerateApplyPatch(t *testing.T) {
+	now := time.Date(2020, 3, 7, 0, 0, 0, 0, time.UTC)
+	update := []v1.NodeCondition{
+		{
+			Type:               "TestType1",
+			Status:             v1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(now),
+			LastHeartbeatTime:  metav1.NewTime(now),
+			Reason:             "TestReason1",
+			Message:            "TestMessage1",
+		},
+	}
+	patch, err := generateApplyPatch(testNode, update)
+	assert.NoError(t, err)
+
+	var applied map[string]interface{}
+	assert.NoError(t, json.Unmarshal(patch, &applied))
+	assert.Equal(t, "v1", applied["apiVersion"])
+	assert.Equal(t, "Node", applied["kind"])
+	assert.Equal(t, map[string]interface{}{"name": testNode}, applied["metadata"])
+	assert.Equal(t, map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{
+				"type":               "TestType1",
+				"status":             "True",
+				"lastTransitionTime": "2020-03-07T00:00:00Z",
+				"lastHeartbeatTime":  "2020-03-07T00:00:00Z",
+				"reason":             "TestReason1",
+				"message":            "TestMessage1",
+			},
+		},
+	}, applied["status"])
+	assert.Len(t, applied, 4)
+}
+
+func TestApplyConditionsWithConflict(t *testing.T) {
+	c := newFakeProblemClient()
+	var applied [][]string
+	c.apply = func(patch []byte) error {
+		var node v1.Node
+		assert.NoError(t, json.Unmarshal(patch, &node))
+		var conditionTypes []string
+		for _, condition := range node.Status.Conditions {
+			conditionTypes = append(conditionTypes, string(condition.Type))
+		}
+		applied = append(applied, conditionTypes)
+		if len(applied) > 1 {
+			return nil
+		}
+		return apierrors.NewApplyConflict([]metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "other-controller"`,
+			Field:   `.status.conditions[type="TestType2"].status`,
+		}}, "Apply failed with 1 conflict")
+	}
+	conditions := []v1.NodeCondition{
+		{Type: "TestType1", Status: v1.ConditionTrue},
+		{Type: "TestType2", Status: v1.ConditionTrue},
+	}
+
+	// The other conditions are applied again without the conflicting one.
+	assert.NoError(t, c.applyConditions(conditions))
+	assert.Equal(t, [][]string{{"TestType1", "TestType2"}, {"TestType1"}}, applied)
+
+	// The conflicts are reported when they are not about conditions.
+	applied = nil
+	c.apply = func(patch []byte) error {
+		applied = append(applied, nil)
+		return apierrors.NewApplyConflict(nil, "Apply failed")
+	}
+	assert.Error(t, c.applyConditions(conditions))
+	assert.Len(t, applied, 1)
+}
+
+func TestGenerateRemovePatch(t *testing.T) {
+	patch, err := generateRemovePatch([]v1.NodeConditionType{"TestType1", "TestType2"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"status":{"conditions":[{"$patch":"delete","type":"TestType1"},{"$patch":"delete","type":"TestType2"}]}}`, string(patch))
+}
+
+func TestGenerateAnnotationPatch(t *testing.T) {
+	patch, err := generateAnnotationPatch(map[string]string{"example.com/key": "value"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"metadata":{"annotations":{"example.com/key":"value"}}}`, string(patch))
+}
+
 func TestEvent(t *testing.T) {
 	fakeRecorder := record.NewFakeRecorder(1)
 	client := newFakeProblemClient()
@@ -86,3 +173,44 @@ func TestEvent(t *testing.T) {
 		t.Errorf("expected event %q, got %q", expected, got)
 	}
 }
+
+func TestEventTarget(t *testing.T) {
+	config := &EventTargetConfig{
+		Default: &EventTarget{APIVersion: "v1", Kind: "ConfigMap", Namespace: "node-problems", Name: "npd-{node}"},
+		Rules: []*EventTargetRule{
+			{
+				Source: "kernel-monitor",
+				Reason: "OOMKilling",
+				Target: EventTarget{APIVersion: "example.com/v1", Kind: "NodeReport", Name: "{node}-oom"},
+			},
+		},
+	}
+	assert.NoError(t, config.Validate())
+
+	ref := config.target("kernel-monitor", "OOMKilling").objectReference("team-a", testNode)
+	assert.Equal(t, &v1.ObjectReference{APIVersion: "example.com/v1", Kind: "NodeReport", Namespace: "team-a", Name: "test-node-oom"}, ref)
+
+	ref = config.target("kernel-monitor", "TaskHung").objectReference("team-a", testNode)
+	assert.Equal(t, &v1.ObjectReference{APIVersion: "v1", Kind: "ConfigMap", Namespace: "node-problems", Name: "npd-test-node"}, ref)
+
+	var noConfig *EventTargetConfig
+	assert.Nil(t, noConfig.target("kernel-monitor", "OOMKilling"))
+
+	assert.Error(t, (&EventTargetConfig{Default: &EventTarget{Kind: "ConfigMap"}}).Validate())
+}
+
+func TestEventWithTarget(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(1)
+	client := newFakeProblemClient()
+	client.eventNamespace = "default"
+	client.eventTargets = &EventTargetConfig{
+		Default: &EventTarget{APIVersion: "v1", Kind: "ConfigMap", Namespace: "node-problems", Name: "npd-{node}"},
+	}
+	client.recorders[testSource+"/node-problems"] = fakeRecorder
+	client.Eventf(v1.EventTypeWarning, testSource, "test reason", "test message")
+	expected := fmt.Sprintf("%s %s %s", v1.EventTypeWarning, "test reason", "test message")
+	got := <-fakeRecorder.Events
+	if expected != got {
+		t.Errorf("expected event %q, got %q", expected, got)
+	}
+}
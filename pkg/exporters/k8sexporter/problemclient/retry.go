@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemclient
+
+import (
+	"net"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/tools/record"
+)
+
+// RetryPolicy decides how writes failing because the apiserver is unavailable are retried.
+type RetryPolicy struct {
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between retries. The delay doubles after each failed
+	// retry until it reaches MaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// NextBackoff returns the delay after a failed attempt, given the delay before it. The
+// delay before the first retry is 0.
+func (p RetryPolicy) NextBackoff(last time.Duration) time.Duration {
+	if last <= 0 {
+		return p.InitialBackoff
+	}
+	if next := 2 * last; next < p.MaxBackoff {
+		return next
+	}
+	return p.MaxBackoff
+}
+
+// Do calls write until it succeeds or fails with an error which is not transient, and
+// returns the last error. It blocks while the apiserver is unavailable.
+func (p RetryPolicy) Do(clock clock.Clock, write func() error) error {
+	var backoff time.Duration
+	for {
+		err := write()
+		if err == nil || !IsTransientError(err) {
+			return err
+		}
+		backoff = p.NextBackoff(backoff)
+		glog.Warningf("Failed to write to the apiserver, retrying in %v: %v", backoff, err)
+		clock.Sleep(backoff)
+	}
+}
+
+// IsTransientError returns whether the error is caused by the apiserver being unreachable or
+// temporarily unavailable, so that the write may succeed later.
+func IsTransientError(err error) bool {
+	if _, ok := err.(apierrors.APIStatus); !ok {
+		if _, ok := err.(net.Error); ok {
+			return true
+		}
+		return utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+	}
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err) || apierrors.IsUnexpectedServerError(err)
+}
+
+// retryingEventSink retries the writes of the sink with the retry policy. The events
+// recorded meanwhile wait in the bounded queue of the event broadcaster.
+type retryingEventSink struct {
+	sink   record.EventSink
+	policy RetryPolicy
+	clock  clock.Clock
+}
+
+func (s *retryingEventSink) Create(event *v1.Event) (*v1.Event, error) {
+	var result *v1.Event
+	err := s.policy.Do(s.clock, func() error {
+		var err error
+		result, err = s.sink.Create(event)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingEventSink) Update(event *v1.Event) (*v1.Event, error) {
+	var result *v1.Event
+	err := s.policy.Do(s.clock, func() error {
+		var err error
+		result, err = s.sink.Update(event)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingEventSink) Patch(event *v1.Event, data []byte) (*v1.Event, error) {
+	var result *v1.Event
+	err := s.policy.Do(s.clock, func() error {
+		var err error
+		result, err = s.sink.Patch(event, data)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemclient
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+var testRetryPolicy = RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 4 * time.Second}
+
+func TestNextBackoff(t *testing.T) {
+	var backoffs []time.Duration
+	var backoff time.Duration
+	for i := 0; i < 5; i++ {
+		backoff = testRetryPolicy.NextBackoff(backoff)
+		backoffs = append(backoffs, backoff)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second}, backoffs)
+}
+
+func TestIsTransientError(t *testing.T) {
+	resource := schema.GroupResource{Resource: "nodes"}
+	testCases := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{
+			name:      "connection refused",
+			err:       &url.Error{Op: "Patch", URL: "https://apiserver", Err: errors.New("dial tcp: connection refused")},
+			transient: true,
+		},
+		{
+			name:      "service unavailable",
+			err:       apierrors.NewServiceUnavailable("apiserver is shutting down"),
+			transient: true,
+		},
+		{
+			name:      "too many requests",
+			err:       apierrors.NewTooManyRequests("too many requests", 1),
+			transient: true,
+		},
+		{
+			name:      "server timeout",
+			err:       apierrors.NewServerTimeout(resource, "patch", 1),
+			transient: true,
+		},
+		{
+			name:      "internal error",
+			err:       apierrors.NewInternalError(errors.New("etcd is unavailable")),
+			transient: true,
+		},
+		{
+			name:      "not found",
+			err:       apierrors.NewNotFound(resource, testNode),
+			transient: false,
+		},
+		{
+			name:      "forbidden",
+			err:       apierrors.NewForbidden(resource, testNode, errors.New("no permission")),
+			transient: false,
+		},
+		{
+			name:      "invalid request",
+			err:       errors.New("invalid event"),
+			transient: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.transient, IsTransientError(test.err))
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	start := time.Now()
+	fakeClock := clock.NewFakeClock(start)
+	unavailable := apierrors.NewServiceUnavailable("apiserver is shutting down")
+
+	// Transient errors are retried with backoff until the write succeeds.
+	attempts := 0
+	err := testRetryPolicy.Do(fakeClock, func() error {
+		attempts++
+		if attempts < 4 {
+			return unavailable
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, attempts)
+	assert.Equal(t, 7*time.Second, fakeClock.Since(start))
+
+	// Other errors are not retried.
+	attempts = 0
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "events"}, "", errors.New("no permission"))
+	err = testRetryPolicy.Do(fakeClock, func() error {
+		attempts++
+		return forbidden
+	})
+	assert.Equal(t, forbidden, err)
+	assert.Equal(t, 1, attempts)
+}
+
+type fakeEventSink struct {
+	errs    []error
+	created []*v1.Event
+}
+
+func (s *fakeEventSink) Create(event *v1.Event) (*v1.Event, error) {
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	s.created = append(s.created, event)
+	return event, nil
+}
+
+func (s *fakeEventSink) Update(event *v1.Event) (*v1.Event, error) {
+	return event, nil
+}
+
+func (s *fakeEventSink) Patch(event *v1.Event, data []byte) (*v1.Event, error) {
+	return event, nil
+}
+
+func TestRetryingEventSink(t *testing.T) {
+	sink := &fakeEventSink{errs: []error{
+		apierrors.NewServiceUnavailable("apiserver is shutting down"),
+		apierrors.NewTooManyRequests("too many requests", 1),
+	}}
+	s := &retryingEventSink{sink: sink, policy: testRetryPolicy, clock: clock.NewFakeClock(time.Now())}
+	event := &v1.Event{Reason: "TaskHung"}
+	created, err := s.Create(event)
+	assert.NoError(t, err)
+	assert.Equal(t, event, created)
+	assert.Equal(t, []*v1.Event{event}, sink.created)
+}
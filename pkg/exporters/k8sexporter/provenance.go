@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sexporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/cmd/options"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/version"
+)
+
+const (
+	// NoProvenance does not attach the provenance to the conditions.
+	NoProvenance = "none"
+	// MessageProvenance appends the provenance to the condition messages.
+	MessageProvenance = "message"
+	// AnnotationProvenance sets the provenance as a node annotation.
+	AnnotationProvenance = "annotation"
+
+	// provenanceAnnotation is the node annotation holding the provenance.
+	provenanceAnnotation = "node-problem-detector.kubernetes.io/provenance"
+	// configHashLength is the number of hex digits of the config hash.
+	configHashLength = 12
+)
+
+// provenance tells which node-problem-detector version and config produced the conditions.
+type provenance struct {
+	Version    string `json:"version"`
+	ConfigHash string `json:"configHash"`
+}
+
+func newProvenance(npdo *options.NodeProblemDetectorOptions) provenance {
+	return provenance{
+		Version:    version.Version(),
+		ConfigHash: configHash(configPaths(npdo)),
+	}
+}
+
+// messageSuffix returns the suffix appended to the condition messages.
+func (p provenance) messageSuffix() string {
+	return fmt.Sprintf(" [node-problem-detector version=%s config=%s]", p.Version, p.ConfigHash)
+}
+
+// annotation returns the value of the provenance annotation.
+func (p provenance) annotation() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// configPaths returns the paths of all config files node-problem-detector loads.
+func configPaths(npdo *options.NodeProblemDetectorOptions) []string {
+	var paths []string
+	for _, monitorPaths := range npdo.MonitorConfigPaths {
+		paths = append(paths, *monitorPaths...)
+	}
+	for _, path := range []string{
+		npdo.ConditionCorrelationConfigPath,
+		npdo.ProblemSummaryConfigPath,
+		npdo.K8sExporterPodSignalConfigPath,
+		npdo.K8sExporterEventTargetConfigPath,
+	} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// configHash returns a short hash of the paths and the contents of the config files. It
+// does not change with the order of the paths. Config files reloaded at runtime are not
+// hashed again.
+func configHash(paths []string) string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, path := range sorted {
+		fmt.Fprintf(h, "%s\x00", path)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			glog.Warningf("Failed to read config file %q for the config hash: %v", path, err)
+		}
+		h.Write(content)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:configHashLength]
+}
+
+// provenanceAttacher attaches the provenance to the conditions, either in their messages
+// or as a node annotation.
+type provenanceAttacher struct {
+	mode       string
+	provenance provenance
+	client     problemclient.Client
+	// annotated is set once the provenance annotation is set on the node.
+	annotated bool
+}
+
+// newProvenanceAttacher returns nil when the provenance is not attached to the conditions.
+func newProvenanceAttacher(npdo *options.NodeProblemDetectorOptions, client problemclient.Client) *provenanceAttacher {
+	switch npdo.K8sExporterConditionProvenance {
+	case NoProvenance:
+		return nil
+	case MessageProvenance, AnnotationProvenance:
+		a := &provenanceAttacher{
+			mode:       npdo.K8sExporterConditionProvenance,
+			provenance: newProvenance(npdo),
+			client:     client,
+		}
+		glog.Infof("Attaching provenance %+v to conditions with %s", a.provenance, a.mode)
+		return a
+	default:
+		glog.Fatalf("Unknown condition provenance %q, supported: %q, %q, %q",
+			npdo.K8sExporterConditionProvenance, NoProvenance, MessageProvenance, AnnotationProvenance)
+		return nil
+	}
+}
+
+// attach returns the condition with the provenance appended to its message in message
+// mode, and the condition unchanged otherwise.
+func (a *provenanceAttacher) attach(condition types.Condition) types.Condition {
+	if a.mode == MessageProvenance {
+		condition.Message += a.provenance.messageSuffix()
+	}
+	return condition
+}
+
+// annotate sets the provenance annotation on the node in annotation mode, unless it is set
+// already. It is retried with the next condition update if it fails.
+func (a *provenanceAttacher) annotate() {
+	if a.mode != AnnotationProvenance || a.annotated {
+		return
+	}
+	err := a.client.SetAnnotations(map[string]string{provenanceAnnotation: a.provenance.annotation()})
+	if err != nil {
+		glog.Errorf("Failed to set provenance annotation: %v", err)
+		exporters.RecordFailure("k8s", "annotations")
+		return
+	}
+	a.annotated = true
+}
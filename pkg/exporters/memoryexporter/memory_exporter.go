@@ -0,0 +1,273 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package memoryexporter provides an exporter recording all exported problems in memory,
+// so that tests can assert on what node-problem-detector exports.
+//
+// Unit tests use NewExporter directly. Integration tests build node-problem-detector with
+// the enable_memory_exporter build tag, enable the exporter with --exporter.memory, and
+// read the recorded problems with Registered in process, or from the HTTP endpoint set by
+// --exporter.memory.address.
+package memoryexporter
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+
+	"k8s.io/node-problem-detector/pkg/exporters"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+const exporterName = "memory"
+
+var (
+	registered     *Exporter
+	registeredLock sync.Mutex
+)
+
+func init() {
+	clo := commandLineOptions{}
+	exporters.Register(exporterName, types.ExporterHandler{
+		CreateExporterOrDie: NewExporterOrDie,
+		Options:             &clo})
+}
+
+// Exporter records the problems exported to it. It is safe for concurrent use.
+type Exporter struct {
+	sync.Mutex
+	exported []*types.Status
+	synced   []*types.Status
+	// conditions is the latest condition of each source and type.
+	conditions map[string]map[string]types.Condition
+	// changed is closed and replaced whenever a problem is recorded, to wake up waiters.
+	changed chan struct{}
+}
+
+// NewExporter creates an empty in-memory exporter.
+func NewExporter() *Exporter {
+	return &Exporter{
+		conditions: make(map[string]map[string]types.Condition),
+		changed:    make(chan struct{}),
+	}
+}
+
+// ExportProblems records the status.
+func (e *Exporter) ExportProblems(status *types.Status) {
+	e.Lock()
+	defer e.Unlock()
+	e.exported = append(e.exported, copyStatus(status))
+	e.record(status)
+}
+
+// SyncProblems records the status.
+func (e *Exporter) SyncProblems(status *types.Status) {
+	e.Lock()
+	defer e.Unlock()
+	e.synced = append(e.synced, copyStatus(status))
+	e.record(status)
+}
+
+func (e *Exporter) record(status *types.Status) {
+	if _, ok := e.conditions[status.Source]; !ok {
+		e.conditions[status.Source] = make(map[string]types.Condition)
+	}
+	for _, condition := range status.Conditions {
+		e.conditions[status.Source][condition.Type] = condition
+	}
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// Exported returns the statuses passed to ExportProblems, in order.
+func (e *Exporter) Exported() []*types.Status {
+	e.Lock()
+	defer e.Unlock()
+	return append([]*types.Status(nil), e.exported...)
+}
+
+// Synced returns the statuses passed to SyncProblems, in order.
+func (e *Exporter) Synced() []*types.Status {
+	e.Lock()
+	defer e.Unlock()
+	return append([]*types.Status(nil), e.synced...)
+}
+
+// Events returns the exported events of the source in order. Empty source returns the
+// events of all sources.
+func (e *Exporter) Events(source string) []types.Event {
+	e.Lock()
+	defer e.Unlock()
+	var events []types.Event
+	for _, status := range e.exported {
+		if source == "" || status.Source == source {
+			events = append(events, status.Events...)
+		}
+	}
+	return events
+}
+
+// Condition returns the latest condition of the source and type.
+func (e *Exporter) Condition(source, conditionType string) (types.Condition, bool) {
+	e.Lock()
+	defer e.Unlock()
+	condition, ok := e.conditions[source][conditionType]
+	return condition, ok
+}
+
+// Reset forgets all recorded problems.
+func (e *Exporter) Reset() {
+	e.Lock()
+	defer e.Unlock()
+	e.exported = nil
+	e.synced = nil
+	e.conditions = make(map[string]map[string]types.Condition)
+}
+
+// WaitForEvent waits until an event with the reason is exported, and returns it.
+func (e *Exporter) WaitForEvent(reason string, timeout time.Duration) (types.Event, error) {
+	var found types.Event
+	err := e.waitFor(timeout, func() bool {
+		for _, status := range e.exported {
+			for _, event := range status.Events {
+				if event.Reason == reason {
+					found = event
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return found, fmt.Errorf("event with reason %q: %v", reason, err)
+	}
+	return found, nil
+}
+
+// WaitForCondition waits until the latest condition of the type from any source has the
+// status, and returns it.
+func (e *Exporter) WaitForCondition(conditionType string, status types.ConditionStatus, timeout time.Duration) (types.Condition, error) {
+	var found types.Condition
+	err := e.waitFor(timeout, func() bool {
+		for _, conditions := range e.conditions {
+			if condition, ok := conditions[conditionType]; ok && condition.Status == status {
+				found = condition
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return found, fmt.Errorf("condition %q with status %q: %v", conditionType, status, err)
+	}
+	return found, nil
+}
+
+// waitFor waits until the check returns true. The check is called with the lock held.
+func (e *Exporter) waitFor(timeout time.Duration, check func() bool) error {
+	deadline := time.After(timeout)
+	for {
+		e.Lock()
+		done := check()
+		changed := e.changed
+		e.Unlock()
+		if done {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return fmt.Errorf("not exported within %v", timeout)
+		}
+	}
+}
+
+// recorded is the JSON served over HTTP.
+type recorded struct {
+	Exported []*types.Status `json:"exported"`
+	Synced   []*types.Status `json:"synced"`
+}
+
+// ServeHTTP serves the recorded problems as JSON.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	util.ReturnHTTPJson(w, recorded{Exported: e.Exported(), Synced: e.Synced()})
+}
+
+func copyStatus(status *types.Status) *types.Status {
+	copied := &types.Status{Source: status.Source, Trace: status.Trace}
+	// Keep nil slices nil, so that recorded statuses compare equal to the exported ones.
+	if status.Events != nil {
+		copied.Events = append([]types.Event{}, status.Events...)
+	}
+	if status.Conditions != nil {
+		copied.Conditions = append([]types.Condition{}, status.Conditions...)
+	}
+	return copied
+}
+
+// Registered returns the exporter created with --exporter.memory, or nil if it is not enabled.
+func Registered() *Exporter {
+	registeredLock.Lock()
+	defer registeredLock.Unlock()
+	return registered
+}
+
+type commandLineOptions struct {
+	enabled bool
+	address string
+}
+
+func (clo *commandLineOptions) SetFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&clo.enabled, "exporter.memory", false,
+		"Enables the in-memory exporter recording all exported problems, for tests only.")
+	fs.StringVar(&clo.address, "exporter.memory.address", "",
+		"The address to serve the problems recorded by the in-memory exporter at, e.g. 127.0.0.1:20258. Set to empty string to disable.")
+}
+
+// NewExporterOrDie creates the registered in-memory exporter, panics if error occurs.
+func NewExporterOrDie(clo types.CommandLineOptions) types.Exporter {
+	options, ok := clo.(*commandLineOptions)
+	if !ok {
+		glog.Fatalf("Wrong type for the command line options of memory exporter: %s.", reflect.TypeOf(clo))
+	}
+	if !options.enabled {
+		return nil
+	}
+
+	e := NewExporter()
+	registeredLock.Lock()
+	registered = e
+	registeredLock.Unlock()
+
+	if options.address != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/problems", e)
+		go func() {
+			err := http.ListenAndServe(options.address, mux)
+			if err != nil {
+				glog.Fatalf("Failed to start memory exporter server: %v", err)
+			}
+		}()
+	}
+	glog.Info("Memory exporter started.")
+	return e
+}
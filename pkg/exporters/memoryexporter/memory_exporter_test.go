@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package memoryexporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestRecordProblems(t *testing.T) {
+	now := time.Now()
+	healthy := types.Condition{Type: "KernelDeadlock", Status: types.False, Transition: now, Reason: "KernelHasNoDeadlock"}
+	deadlock := types.Condition{Type: "KernelDeadlock", Status: types.True, Transition: now, Reason: "DockerHung"}
+	event := types.Event{Severity: types.Warn, Timestamp: now, Reason: "TaskHung"}
+
+	e := NewExporter()
+	e.SyncProblems(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{healthy}})
+	status := &types.Status{Source: "kernel-monitor", Events: []types.Event{event}, Conditions: []types.Condition{deadlock}}
+	e.ExportProblems(status)
+	e.ExportProblems(&types.Status{Source: "docker-monitor", Events: []types.Event{event}})
+
+	// Changes made by the caller afterwards are not recorded.
+	status.Conditions[0] = healthy
+
+	assert.Len(t, e.Synced(), 1)
+	assert.Len(t, e.Exported(), 2)
+	assert.Equal(t, []types.Condition{deadlock}, e.Exported()[0].Conditions)
+	assert.Equal(t, []types.Event{event}, e.Events("docker-monitor"))
+	assert.Equal(t, []types.Event{event, event}, e.Events(""))
+	condition, ok := e.Condition("kernel-monitor", "KernelDeadlock")
+	assert.True(t, ok)
+	assert.Equal(t, deadlock, condition)
+	_, ok = e.Condition("docker-monitor", "KernelDeadlock")
+	assert.False(t, ok)
+
+	e.Reset()
+	assert.Empty(t, e.Exported())
+	assert.Empty(t, e.Synced())
+	_, ok = e.Condition("kernel-monitor", "KernelDeadlock")
+	assert.False(t, ok)
+}
+
+func TestWait(t *testing.T) {
+	e := NewExporter()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		e.ExportProblems(&types.Status{
+			Source:     "kernel-monitor",
+			Events:     []types.Event{{Severity: types.Warn, Reason: "TaskHung"}},
+			Conditions: []types.Condition{{Type: "KernelDeadlock", Status: types.True, Reason: "DockerHung"}},
+		})
+	}()
+
+	event, err := e.WaitForEvent("TaskHung", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "TaskHung", event.Reason)
+	condition, err := e.WaitForCondition("KernelDeadlock", types.True, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "DockerHung", condition.Reason)
+
+	_, err = e.WaitForCondition("KernelDeadlock", types.False, 10*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestServeHTTP(t *testing.T) {
+	e := NewExporter()
+	e.ExportProblems(&types.Status{Source: "kernel-monitor", Events: []types.Event{{Severity: types.Warn, Reason: "TaskHung"}}})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/problems", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got recorded
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Len(t, got.Exported, 1)
+	assert.Equal(t, "TaskHung", got.Exported[0].Events[0].Reason)
+	assert.Empty(t, got.Synced)
+}
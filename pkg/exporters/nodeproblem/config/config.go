@@ -0,0 +1,64 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+type NodeProblemExporterConfig struct {
+	// APIServerOverride is the URI used to connect to the apiserver, like
+	// --apiserver-override. Default to the in-cluster config.
+	APIServerOverride string `json:"apiServerOverride"`
+	// RemediationHints map problem reasons or condition types to hints on how to
+	// remediate the problems, which are set on the NodeProblems. The hint of the reason
+	// takes precedence. The hints of condition types apply to their instances too, e.g.
+	// "DiskReadonly" to "DiskReadonly[sdb]".
+	RemediationHints map[string]string `json:"remediationHints"`
+	// HistoryLength is the number of the last transitions of a condition recorded in the
+	// status of its NodeProblem, so that flapping conditions can be seen after their
+	// events expired. Default to 0, which records none.
+	HistoryLength int `json:"historyLength"`
+}
+
+// maxHistoryLength keeps the NodeProblems small.
+const maxHistoryLength = 100
+
+// ApplyConfiguration applies default configurations.
+func (c *NodeProblemExporterConfig) ApplyConfiguration() error {
+	if c.RemediationHints == nil {
+		c.RemediationHints = map[string]string{}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *NodeProblemExporterConfig) Validate() error {
+	if _, err := url.Parse(c.APIServerOverride); err != nil {
+		return fmt.Errorf("apiServerOverride %q is not a valid URI: %v", c.APIServerOverride, err)
+	}
+	if c.HistoryLength < 0 || c.HistoryLength > maxHistoryLength {
+		return fmt.Errorf("historyLength %d must be between 0 and %d", c.HistoryLength, maxHistoryLength)
+	}
+	for key, hint := range c.RemediationHints {
+		if key == "" {
+			return fmt.Errorf("remediation hint %q has no reason or condition type", hint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    NodeProblemExporterConfig
+		wantError bool
+	}{
+		{
+			name:   "default",
+			config: NodeProblemExporterConfig{},
+		},
+		{
+			name: "remediation hints",
+			config: NodeProblemExporterConfig{
+				APIServerOverride: "https://127.0.0.1:6443",
+				RemediationHints:  map[string]string{"KernelDeadlock": "Reboot the node."},
+			},
+		},
+		{
+			name:      "invalid apiserver override",
+			config:    NodeProblemExporterConfig{APIServerOverride: ":foo"},
+			wantError: true,
+		},
+		{
+			name:      "remediation hint without reason",
+			config:    NodeProblemExporterConfig{RemediationHints: map[string]string{"": "Reboot the node."}},
+			wantError: true,
+		},
+		{
+			name:   "history",
+			config: NodeProblemExporterConfig{HistoryLength: 10},
+		},
+		{
+			name:      "history too long",
+			config:    NodeProblemExporterConfig{HistoryLength: 1000},
+			wantError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.ApplyConfiguration(); err != nil {
+				t.Fatalf("Unexpected error applying config %+v: %v", test.config, err)
+			}
+			err := test.config.Validate()
+			if test.wantError && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.wantError && err != nil {
+				t.Errorf("Unexpected error for config %+v: %v", test.config, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeproblemexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	// groupVersion is the API group version of NodeProblems.
+	groupVersion = "npd.k8s.io/v1alpha1"
+	// nodeLabel is the label selecting the NodeProblems of a node.
+	nodeLabel = "npd.k8s.io/node"
+)
+
+// NodeProblem is a problem of a node reported by node-problem-detector. It is
+// cluster-scoped, like the node.
+type NodeProblem struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              NodeProblemSpec   `json:"spec"`
+	Status            NodeProblemStatus `json:"status"`
+}
+
+// NodeProblemSpec identifies the problem.
+type NodeProblemSpec struct {
+	// NodeName is the node with the problem.
+	NodeName string `json:"nodeName"`
+	// Source is the problem daemon reporting the problem.
+	Source string `json:"source"`
+	// Type is permanent for problems reported as conditions, and temporary for problems
+	// reported as warning events.
+	Type types.Type `json:"type"`
+	// Condition is the condition type of a permanent problem, e.g. "DiskReadonly[sdb]".
+	Condition string `json:"condition,omitempty"`
+	// Reason is the reason of a temporary problem.
+	Reason string `json:"reason,omitempty"`
+}
+
+// NodeProblemStatus is the latest state of the problem.
+type NodeProblemStatus struct {
+	// Active is whether the condition of a permanent problem is True. Temporary problems
+	// are never active.
+	Active bool `json:"active"`
+	// Reason and Message are the reason and message of the last occurrence.
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	// FirstSeen is the time of the first occurrence.
+	FirstSeen metav1.Time `json:"firstSeen"`
+	// LastSeen is the time of the last event of a temporary problem, or the last time
+	// the condition of a permanent problem was exported True.
+	LastSeen metav1.Time `json:"lastSeen"`
+	// Count is the number of events of a temporary problem, or the number of times the
+	// condition of a permanent problem became True.
+	Count int64 `json:"count"`
+	// Remediation is the configured hint on how to remediate the problem.
+	Remediation string `json:"remediation"`
+	// Severity is the severity of the last occurrence, empty if the monitor does not
+	// classify the problem.
+	Severity types.Severity `json:"severity,omitempty"`
+	// History are the last transitions of the condition of a permanent problem, oldest
+	// first. Only recorded when the exporter is configured with a history length.
+	History []npdapiv1.Condition `json:"history,omitempty"`
+	// Report is the v1 problem report of the last occurrence, with the metadata of the
+	// node.
+	Report *npdapiv1.ProblemReport `json:"report,omitempty"`
+}
+
+// newNodeProblem creates a NodeProblem of the node, identified by the key.
+func newNodeProblem(nodeName, key, display string, spec NodeProblemSpec) *NodeProblem {
+	p := &NodeProblem{
+		TypeMeta:   metav1.TypeMeta{APIVersion: groupVersion, Kind: "NodeProblem"},
+		ObjectMeta: metav1.ObjectMeta{Name: problemName(nodeName, key, display)},
+		Spec:       spec,
+	}
+	if len(validation.IsValidLabelValue(nodeName)) == 0 {
+		p.Labels = map[string]string{nodeLabel: nodeName}
+	}
+	return p
+}
+
+// problemName returns the name of the NodeProblem of the node identified by the key. It
+// is readable from the display string, and unique by the hash of the key.
+func problemName(nodeName, key, display string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+	var b strings.Builder
+	for _, r := range strings.ToLower(display) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	name := strings.Trim(nodeName+"."+strings.Trim(b.String(), "-"), ".-")
+	if max := validation.DNS1123SubdomainMaxLength - len(suffix); len(name) > max {
+		name = strings.TrimRight(name[:max], ".-")
+	}
+	return name + suffix
+}
+
+// problemClient reads and writes NodeProblems.
+type problemClient interface {
+	// Get gets a NodeProblem, or returns nil if it does not exist.
+	Get(name string) (*NodeProblem, error)
+	// Write creates the NodeProblem, or replaces the spec and status of the existing one.
+	Write(problem *NodeProblem) error
+}
+
+type restProblemClient struct {
+	client rest.Interface
+}
+
+func (c *restProblemClient) Get(name string) (*NodeProblem, error) {
+	body, err := c.client.Get().AbsPath("/apis", groupVersion, "nodeproblems", name).Do().Raw()
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	problem := &NodeProblem{}
+	if err := json.Unmarshal(body, problem); err != nil {
+		return nil, err
+	}
+	return problem, nil
+}
+
+func (c *restProblemClient) Write(problem *NodeProblem) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": problem.Labels},
+		"spec":     problem.Spec,
+		"status":   problem.Status,
+	})
+	if err != nil {
+		return err
+	}
+	err = c.client.Patch(apitypes.MergePatchType).AbsPath("/apis", groupVersion, "nodeproblems", problem.Name).
+		Body(patch).Do().Error()
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	body, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+	return c.client.Post().AbsPath("/apis", groupVersion, "nodeproblems").
+		SetHeader("Content-Type", "application/json").Body(body).Do().Error()
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nodeproblemexporter exports the problems of the node as NodeProblem custom
+// resources, one per condition and per reason of warning events, with structured fields
+// for automation.
+package nodeproblemexporter
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	npdoptions "k8s.io/node-problem-detector/cmd/options"
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	"k8s.io/node-problem-detector/pkg/exporters/k8sexporter/problemclient"
+	nodeproblemconfig "k8s.io/node-problem-detector/pkg/exporters/nodeproblem/config"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+func init() {
+	exporters.RegisterWithConfigFile(exporterName,
+		"Configuration for the NodeProblem exporter, which writes problems as NodeProblem custom resources.", NewExporterOrDie)
+}
+
+const exporterName = "nodeproblem"
+
+type nodeProblemExporter struct {
+	// Mutex protects problems, the exporter may be called by the periodic sync while
+	// exporting problems.
+	sync.Mutex
+	config   nodeproblemconfig.NodeProblemExporterConfig
+	nodeName string
+	client   problemClient
+	clock    clock.Clock
+	// problems are the NodeProblems last written, by name. A NodeProblem which is not
+	// cached is read from the apiserver, so that the counts survive restarts.
+	problems map[string]*NodeProblem
+}
+
+// NewExporterOrDie creates an exporter writing problems as NodeProblem custom resources,
+// panics if error occurs. It is disabled in dry run mode.
+func NewExporterOrDie(configPath string) types.Exporter {
+	if exporters.DryRun() {
+		glog.Info("NodeProblem exporter is disabled in dry run mode.")
+		return nil
+	}
+	config := nodeproblemconfig.NodeProblemExporterConfig{}
+	if err := exporters.LoadConfig(configPath, &config); err != nil {
+		glog.Fatalf("Failed to load NodeProblem exporter config: %v", err)
+	}
+
+	glog.Infof("Starting NodeProblem exporter %s", configPath)
+	cs := problemclient.NewClientsetOrDie(&npdoptions.NodeProblemDetectorOptions{ApiServerOverride: config.APIServerOverride})
+	return newNodeProblemExporter(config, util.GetNodeName(), &restProblemClient{client: cs.CoreV1().RESTClient()}, clock.RealClock{})
+}
+
+func newNodeProblemExporter(config nodeproblemconfig.NodeProblemExporterConfig, nodeName string, client problemClient, clock clock.Clock) *nodeProblemExporter {
+	return &nodeProblemExporter{
+		config:   config,
+		nodeName: nodeName,
+		client:   client,
+		clock:    clock,
+		problems: make(map[string]*NodeProblem),
+	}
+}
+
+// ExportProblems writes the NodeProblems of the warning events and the changed conditions.
+func (e *nodeProblemExporter) ExportProblems(status *types.Status) {
+	e.Lock()
+	defer e.Unlock()
+	for _, event := range status.Events {
+		if event.Severity.IsProblem() {
+			e.exportEvent(status, event)
+		}
+	}
+	for _, condition := range status.Conditions {
+		e.exportCondition(status, condition, false)
+	}
+}
+
+// SyncProblems writes the NodeProblems of the conditions, and refreshes the last seen
+// time of the active ones.
+func (e *nodeProblemExporter) SyncProblems(status *types.Status) {
+	e.Lock()
+	defer e.Unlock()
+	for _, condition := range status.Conditions {
+		e.exportCondition(status, condition, true)
+	}
+}
+
+// PushesProblems returns true, the NodeProblems are written to the apiserver.
+func (e *nodeProblemExporter) PushesProblems() bool {
+	return true
+}
+
+// exportEvent counts the event in the NodeProblem of its source and reason.
+func (e *nodeProblemExporter) exportEvent(status *types.Status, event types.Event) {
+	spec := NodeProblemSpec{NodeName: e.nodeName, Source: status.Source, Type: types.Temp, Reason: event.Reason}
+	p, ok := e.problem(newNodeProblem(e.nodeName, "event/"+status.Source+"/"+event.Reason, event.Reason, spec))
+	if !ok {
+		return
+	}
+	timestamp := metav1.NewTime(event.Timestamp)
+	if p.Status.Count == 0 {
+		p.Status.FirstSeen = timestamp
+	}
+	p.Status.Count++
+	p.Status.LastSeen = timestamp
+	p.Status.Reason = event.Reason
+	p.Status.Message = event.Message
+	p.Status.Remediation = e.remediation(event.Reason, "")
+	p.Status.Severity = event.Severity
+	p.Status.Report = npdapiv1.NewProblemReport(e.nodeName, &types.Status{
+		Source: status.Source,
+		Events: []types.Event{event},
+		Node:   status.Node,
+	})
+	e.write(p)
+}
+
+// exportCondition updates the NodeProblem of the condition. No NodeProblem is created
+// before the condition becomes True. With refresh, the last seen time of an active
+// problem is updated even if the condition did not change.
+func (e *nodeProblemExporter) exportCondition(status *types.Status, condition types.Condition, refresh bool) {
+	active := condition.Status == types.True
+	spec := NodeProblemSpec{NodeName: e.nodeName, Source: status.Source, Type: types.Perm, Condition: condition.Type}
+	candidate := newNodeProblem(e.nodeName, "condition/"+condition.Type, condition.Type, spec)
+	if _, cached := e.problems[candidate.Name]; !cached && !active && !refresh {
+		// The NodeProblems of inactive conditions are only looked up on syncs, most
+		// conditions never become True and have none.
+		return
+	}
+	p, ok := e.problem(candidate)
+	if !ok {
+		return
+	}
+	now := metav1.NewTime(e.clock.Now())
+	report := npdapiv1.NewProblemReport(e.nodeName, &types.Status{
+		Source:     status.Source,
+		Conditions: []types.Condition{condition},
+		Node:       status.Node,
+	})
+	switch {
+	case active && !p.Status.Active:
+		if p.Status.Count == 0 {
+			p.Status.FirstSeen = metav1.NewTime(condition.Transition)
+		}
+		p.Status.Count++
+		p.Status.Active = true
+		e.recordTransition(p, report.Conditions[0])
+	case active && (refresh || p.Status.Reason != condition.Reason || p.Status.Message != condition.Message ||
+		p.Status.Severity != condition.Severity):
+	case !active && p.Status.Active:
+		p.Status.Active = false
+		p.Status.Report = report
+		e.recordTransition(p, report.Conditions[0])
+		e.write(p)
+		return
+	default:
+		return
+	}
+	p.Status.LastSeen = now
+	p.Status.Reason = condition.Reason
+	p.Status.Message = condition.Message
+	p.Status.Remediation = e.remediation(condition.Reason, condition.Type)
+	p.Status.Severity = condition.Severity
+	p.Status.Report = report
+	e.write(p)
+}
+
+// recordTransition records the transition of the condition in the history of the
+// NodeProblem, dropping the oldest transitions beyond the history length.
+func (e *nodeProblemExporter) recordTransition(p *NodeProblem, condition npdapiv1.Condition) {
+	if e.config.HistoryLength == 0 {
+		p.Status.History = nil
+		return
+	}
+	p.Status.History = append(p.Status.History, condition)
+	if n := len(p.Status.History) - e.config.HistoryLength; n > 0 {
+		p.Status.History = p.Status.History[n:]
+	}
+}
+
+// problem returns the cached NodeProblem of the candidate, the existing one read from
+// the apiserver, or the candidate if there is none. It returns false if the NodeProblem
+// could not be read.
+func (e *nodeProblemExporter) problem(candidate *NodeProblem) (*NodeProblem, bool) {
+	if p, ok := e.problems[candidate.Name]; ok {
+		return p, true
+	}
+	existing, err := e.client.Get(candidate.Name)
+	if err != nil {
+		glog.Errorf("Failed to get NodeProblem %q: %v", candidate.Name, err)
+		exporters.RecordFailure(exporterName, "problems")
+		return nil, false
+	}
+	if existing != nil {
+		candidate.Status = existing.Status
+	}
+	e.problems[candidate.Name] = candidate
+	return candidate, true
+}
+
+// write writes the NodeProblem. A NodeProblem failing to be written is forgotten, so that
+// it is read again from the apiserver and the change is written again on the next export.
+func (e *nodeProblemExporter) write(p *NodeProblem) {
+	if err := e.client.Write(p); err != nil {
+		glog.Errorf("Failed to write NodeProblem %q: %v", p.Name, err)
+		exporters.RecordFailure(exporterName, "problems")
+		delete(e.problems, p.Name)
+	}
+}
+
+// remediation returns the remediation hint of the reason, or of the condition type.
+func (e *nodeProblemExporter) remediation(reason, conditionType string) string {
+	if hint, ok := e.config.RemediationHints[reason]; ok {
+		return hint
+	}
+	if conditionType == "" {
+		return ""
+	}
+	if hint, ok := e.config.RemediationHints[conditionType]; ok {
+		return hint
+	}
+	// The hint of a condition type applies to its instances.
+	if i := strings.Index(conditionType, "["); i > 0 {
+		return e.config.RemediationHints[conditionType[:i]]
+	}
+	return ""
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeproblemexporter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	nodeproblemconfig "k8s.io/node-problem-detector/pkg/exporters/nodeproblem/config"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	testNode   = "test-node"
+	testSource = "test-source"
+)
+
+type fakeProblemClient struct {
+	problems map[string]NodeProblem
+	gets     int
+	writes   int
+	err      error
+}
+
+func (c *fakeProblemClient) Get(name string) (*NodeProblem, error) {
+	c.gets++
+	if c.err != nil {
+		return nil, c.err
+	}
+	p, ok := c.problems[name]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (c *fakeProblemClient) Write(problem *NodeProblem) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.writes++
+	c.problems[problem.Name] = *problem
+	return nil
+}
+
+func newTestExporter(start time.Time) (*nodeProblemExporter, *fakeProblemClient, *clock.FakeClock) {
+	config := nodeproblemconfig.NodeProblemExporterConfig{RemediationHints: map[string]string{
+		"DiskReadonly":   "Replace the disk.",
+		"TaskHung":       "Check the blocked task.",
+		"KernelDeadlock": "Reboot the node.",
+	}}
+	client := &fakeProblemClient{problems: map[string]NodeProblem{}}
+	fakeClock := clock.NewFakeClock(start)
+	return newNodeProblemExporter(config, testNode, client, fakeClock), client, fakeClock
+}
+
+func conditionProblem(client *fakeProblemClient, conditionType string) NodeProblem {
+	return client.problems[problemName(testNode, "condition/"+conditionType, conditionType)]
+}
+
+func TestProblemName(t *testing.T) {
+	name := problemName(testNode, "condition/DiskReadonly[sdb]", "DiskReadonly[sdb]")
+	assert.True(t, strings.HasPrefix(name, "test-node.diskreadonly-sdb-"), name)
+	assert.Empty(t, validation.IsDNS1123Subdomain(name))
+	assert.NotEqual(t, name, problemName(testNode, "condition/DiskReadonly(sdb)", "DiskReadonly(sdb)"))
+	assert.Equal(t, name, problemName(testNode, "condition/DiskReadonly[sdb]", "DiskReadonly[sdb]"))
+
+	long := problemName(strings.Repeat("n", 250), "event/source/Reason", "Reason")
+	assert.Empty(t, validation.IsDNS1123Subdomain(long))
+}
+
+func TestDryRun(t *testing.T) {
+	exporters.SetDryRun(true)
+	defer exporters.SetDryRun(false)
+	assert.Nil(t, NewExporterOrDie("nonexistent.json"), "No NodeProblem should be written in dry run mode")
+}
+
+func TestExportEvents(t *testing.T) {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	e, client, _ := newTestExporter(start)
+	assert.True(t, e.PushesProblems())
+	for i := 0; i < 3; i++ {
+		e.ExportProblems(&types.Status{
+			Source: testSource,
+			Events: []types.Event{
+				{Severity: types.Warn, Timestamp: start.Add(time.Duration(i) * time.Minute), Reason: "TaskHung", Message: fmt.Sprintf("task %d blocked", i)},
+				// Info events are not problems.
+				{Severity: types.Info, Timestamp: start, Reason: "KernelDeadlock", Message: "condition changed"},
+			},
+			Node: map[string]string{"zone": "us-east-1a"},
+		})
+	}
+	e.ExportProblems(&types.Status{
+		Source: testSource,
+		Events: []types.Event{{Severity: types.Critical, Timestamp: start, Reason: "KernelPanic", Message: "kernel panic"}},
+	})
+	assert.Len(t, client.problems, 2)
+	assert.Equal(t, types.Critical, client.problems[problemName(testNode, "event/"+testSource+"/KernelPanic", "KernelPanic")].Status.Severity)
+	p := client.problems[problemName(testNode, "event/"+testSource+"/TaskHung", "TaskHung")]
+	assert.Equal(t, "NodeProblem", p.Kind)
+	assert.Equal(t, map[string]string{nodeLabel: testNode}, p.Labels)
+	assert.Equal(t, NodeProblemSpec{NodeName: testNode, Source: testSource, Type: types.Temp, Reason: "TaskHung"}, p.Spec)
+	assert.Equal(t, NodeProblemStatus{
+		Reason:      "TaskHung",
+		Message:     "task 2 blocked",
+		FirstSeen:   metav1.NewTime(start),
+		LastSeen:    metav1.NewTime(start.Add(2 * time.Minute)),
+		Count:       3,
+		Remediation: "Check the blocked task.",
+		Severity:    types.Warn,
+		Report: &npdapiv1.ProblemReport{
+			APIVersion:   npdapiv1.APIVersion,
+			Node:         testNode,
+			NodeMetadata: map[string]string{"zone": "us-east-1a"},
+			Source:       testSource,
+			Events: []npdapiv1.Event{
+				{Severity: "warn", Timestamp: start.Add(2 * time.Minute), Reason: "TaskHung", Message: "task 2 blocked"},
+			},
+		},
+	}, p.Status)
+}
+
+func TestExportConditions(t *testing.T) {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	e, client, fakeClock := newTestExporter(start)
+	condition := func(status types.ConditionStatus, reason string) types.Status {
+		return types.Status{Source: testSource, Conditions: []types.Condition{
+			{Type: "DiskReadonly[sdb]", Status: status, Transition: fakeClock.Now(), Reason: reason, Message: reason + " message"},
+		}}
+	}
+
+	// No NodeProblem is created for conditions which are not True.
+	e.ExportProblems(&types.Status{Source: testSource, Conditions: []types.Condition{{Type: "DiskReadonly[sdb]", Status: types.False}}})
+	assert.Empty(t, client.problems)
+	assert.Equal(t, 0, client.gets)
+
+	fakeClock.Step(time.Minute)
+	status := condition(types.True, "DiskRemountedReadonly")
+	e.ExportProblems(&status)
+	p := conditionProblem(client, "DiskReadonly[sdb]")
+	assert.Equal(t, NodeProblemSpec{NodeName: testNode, Source: testSource, Type: types.Perm, Condition: "DiskReadonly[sdb]"}, p.Spec)
+	assert.Equal(t, NodeProblemStatus{
+		Active:      true,
+		Reason:      "DiskRemountedReadonly",
+		Message:     "DiskRemountedReadonly message",
+		FirstSeen:   metav1.NewTime(start.Add(time.Minute)),
+		LastSeen:    metav1.NewTime(start.Add(time.Minute)),
+		Count:       1,
+		Remediation: "Replace the disk.",
+		Report:      npdapiv1.NewProblemReport(testNode, &status),
+	}, p.Status)
+
+	// An unchanged condition is only written on syncs.
+	fakeClock.Step(time.Minute)
+	e.ExportProblems(&status)
+	assert.Equal(t, 1, client.writes)
+	e.SyncProblems(&status)
+	assert.Equal(t, 2, client.writes)
+	assert.Equal(t, metav1.NewTime(start.Add(2*time.Minute)), conditionProblem(client, "DiskReadonly[sdb]").Status.LastSeen)
+
+	fakeClock.Step(time.Minute)
+	status = condition(types.False, "DiskIsWritable")
+	e.ExportProblems(&status)
+	p = conditionProblem(client, "DiskReadonly[sdb]")
+	assert.False(t, p.Status.Active)
+	assert.Equal(t, "DiskRemountedReadonly", p.Status.Reason)
+	assert.Equal(t, npdapiv1.NewProblemReport(testNode, &status), p.Status.Report)
+	assert.Equal(t, int64(1), p.Status.Count)
+
+	// The problem recurring is counted.
+	fakeClock.Step(time.Minute)
+	status = condition(types.True, "DiskRemountedReadonly")
+	e.ExportProblems(&status)
+	p = conditionProblem(client, "DiskReadonly[sdb]")
+	assert.True(t, p.Status.Active)
+	assert.Equal(t, int64(2), p.Status.Count)
+	assert.Equal(t, metav1.NewTime(start.Add(time.Minute)), p.Status.FirstSeen)
+	assert.Equal(t, metav1.NewTime(start.Add(4*time.Minute)), p.Status.LastSeen)
+}
+
+func TestExportConditionsAfterRestart(t *testing.T) {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	e, client, _ := newTestExporter(start)
+	status := types.Status{Source: testSource, Conditions: []types.Condition{
+		{Type: "KernelDeadlock", Status: types.True, Transition: start, Reason: "DockerHung"},
+	}}
+	e.ExportProblems(&status)
+
+	// The counts are read from the apiserver after a restart, and a problem which
+	// recovered meanwhile is resolved on the first sync.
+	restarted, _, _ := newTestExporter(start)
+	restarted.client = client
+	status.Conditions[0].Status = types.False
+	restarted.ExportProblems(&status)
+	assert.True(t, conditionProblem(client, "KernelDeadlock").Status.Active)
+	restarted.SyncProblems(&status)
+	assert.False(t, conditionProblem(client, "KernelDeadlock").Status.Active)
+
+	status.Conditions[0].Status = types.True
+	restarted.ExportProblems(&status)
+	assert.Equal(t, int64(2), conditionProblem(client, "KernelDeadlock").Status.Count)
+}
+
+func TestWriteFailure(t *testing.T) {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	e, client, _ := newTestExporter(start)
+	status := types.Status{Source: testSource, Conditions: []types.Condition{
+		{Type: "KernelDeadlock", Status: types.True, Transition: start, Reason: "DockerHung"},
+	}}
+	client.err = fmt.Errorf("injected error")
+	e.ExportProblems(&status)
+	assert.Empty(t, client.problems)
+
+	// The change is written again on the next sync.
+	client.err = nil
+	e.SyncProblems(&status)
+	p := conditionProblem(client, "KernelDeadlock")
+	assert.True(t, p.Status.Active)
+	assert.Equal(t, int64(1), p.Status.Count)
+	assert.Equal(t, "Reboot the node.", p.Status.Remediation)
+}
+
+func TestConditionHistory(t *testing.T) {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	e, client, fakeClock := newTestExporter(start)
+	e.config.HistoryLength = 3
+	export := func(status types.ConditionStatus, reason string) {
+		fakeClock.Step(time.Minute)
+		e.ExportProblems(&types.Status{Source: testSource, Conditions: []types.Condition{
+			{Type: "KernelDeadlock", Status: status, Transition: fakeClock.Now(), Reason: reason},
+		}})
+	}
+
+	// Only the transitions are recorded, and the oldest ones are dropped.
+	export(types.True, "DockerHung")
+	export(types.True, "ContainerdHung")
+	export(types.False, "KernelHasNoDeadlock")
+	export(types.True, "DockerHung")
+	export(types.False, "KernelHasNoDeadlock")
+	p := conditionProblem(client, "KernelDeadlock")
+	assert.Equal(t, []npdapiv1.Condition{
+		{Type: "KernelDeadlock", Status: "False", Transition: start.Add(3 * time.Minute), Reason: "KernelHasNoDeadlock"},
+		{Type: "KernelDeadlock", Status: "True", Transition: start.Add(4 * time.Minute), Reason: "DockerHung"},
+		{Type: "KernelDeadlock", Status: "False", Transition: start.Add(5 * time.Minute), Reason: "KernelHasNoDeadlock"},
+	}, p.Status.History)
+	assert.Equal(t, p.Status.History[2:], p.Status.Report.Conditions)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// SlackWebhook posts messages to a Slack incoming webhook.
+	SlackWebhook = "slack"
+	// TeamsWebhook posts messages to a Microsoft Teams incoming webhook.
+	TeamsWebhook = "teams"
+)
+
+var (
+	defaultNotifyRecovery  = true
+	defaultMaxMessages     = 20
+	defaultRateLimitPeriod = time.Hour.String()
+	defaultTimeout         = (10 * time.Second).String()
+)
+
+// Webhook is a webhook the notifications are posted to.
+type Webhook struct {
+	// Name is the name routes refer to the webhook by.
+	Name string `json:"name"`
+	// Type is either "slack" or "teams".
+	Type string `json:"type"`
+	// URL is the URL of the webhook.
+	URL string `json:"url"`
+	// URLFile is the path to the file containing the URL of the webhook, e.g. mounted from
+	// a Secret, so that the URL is not kept in the config.
+	URLFile string `json:"urlFile"`
+}
+
+// Route routes the notifications of some problems to webhooks.
+type Route struct {
+	// Conditions are the condition types and event reasons routed. The condition types
+	// include their instances, e.g. "DiskReadonly" includes "DiskReadonly[sdb]". Empty
+	// routes all problems.
+	Conditions []string `json:"conditions"`
+	// Webhooks are the names of the webhooks the notifications are posted to.
+	Webhooks []string `json:"webhooks"`
+	// Channel overrides the channel of Slack webhooks, e.g. "#storage-alerts". Empty
+	// posts to the channel of the webhook.
+	Channel string `json:"channel"`
+}
+
+type NotificationExporterConfig struct {
+	Webhooks []Webhook `json:"webhooks"`
+	// Routes route the notifications of each problem by the first route including it.
+	// Problems no route includes are not notified. Default to routing all problems to
+	// all webhooks.
+	Routes []Route `json:"routes"`
+	// NotifyEvents notifies the warning and critical events too, not only the condition
+	// transitions.
+	NotifyEvents bool `json:"notifyEvents"`
+	// NotifyRecovery notifies the conditions becoming False. Default to true.
+	NotifyRecovery *bool `json:"notifyRecovery,omitempty"`
+	// MaxMessages is the maximum number of messages posted to each webhook per rate limit
+	// period. Messages beyond it are dropped and counted in the next message.
+	MaxMessages     int    `json:"maxMessages"`
+	RateLimitPeriod string `json:"rateLimitPeriod"`
+	Timeout         string `json:"timeout"`
+
+	RateLimitPeriodDuration time.Duration `json:"-"`
+	TimeoutDuration         time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *NotificationExporterConfig) ApplyConfiguration() error {
+	if len(c.Routes) == 0 {
+		route := Route{}
+		for _, webhook := range c.Webhooks {
+			route.Webhooks = append(route.Webhooks, webhook.Name)
+		}
+		c.Routes = []Route{route}
+	}
+	if c.NotifyRecovery == nil {
+		c.NotifyRecovery = &defaultNotifyRecovery
+	}
+	if c.MaxMessages == 0 {
+		c.MaxMessages = defaultMaxMessages
+	}
+	if c.RateLimitPeriod == "" {
+		c.RateLimitPeriod = defaultRateLimitPeriod
+	}
+	if c.Timeout == "" {
+		c.Timeout = defaultTimeout
+	}
+
+	var err error
+	c.RateLimitPeriodDuration, err = time.ParseDuration(c.RateLimitPeriod)
+	if err != nil {
+		return fmt.Errorf("failed to parse rateLimitPeriod %q: %v", c.RateLimitPeriod, err)
+	}
+	c.TimeoutDuration, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to parse timeout %q: %v", c.Timeout, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *NotificationExporterConfig) Validate() error {
+	if len(c.Webhooks) == 0 {
+		return fmt.Errorf("no webhook is configured")
+	}
+	webhooks := make(map[string]bool)
+	for _, webhook := range c.Webhooks {
+		if webhook.Name == "" {
+			return fmt.Errorf("webhook %+v has no name", webhook)
+		}
+		if webhooks[webhook.Name] {
+			return fmt.Errorf("duplicate webhook %q", webhook.Name)
+		}
+		webhooks[webhook.Name] = true
+		if webhook.Type != SlackWebhook && webhook.Type != TeamsWebhook {
+			return fmt.Errorf("webhook %q has unsupported type %q, supported: %q, %q", webhook.Name, webhook.Type, SlackWebhook, TeamsWebhook)
+		}
+		if (webhook.URL == "") == (webhook.URLFile == "") {
+			return fmt.Errorf("webhook %q must set exactly one of url and urlFile", webhook.Name)
+		}
+		if webhook.URL != "" {
+			if u, err := url.Parse(webhook.URL); err != nil || u.Host == "" {
+				return fmt.Errorf("webhook %q has invalid url", webhook.Name)
+			}
+		}
+	}
+	for i, route := range c.Routes {
+		if len(route.Webhooks) == 0 {
+			return fmt.Errorf("route %d has no webhook", i)
+		}
+		for _, name := range route.Webhooks {
+			if !webhooks[name] {
+				return fmt.Errorf("route %d refers to unknown webhook %q", i, name)
+			}
+		}
+	}
+	if c.MaxMessages <= 0 {
+		return fmt.Errorf("maxMessages %d must be positive", c.MaxMessages)
+	}
+	if c.RateLimitPeriodDuration <= 0 {
+		return fmt.Errorf("rateLimitPeriod %v must be positive", c.RateLimitPeriodDuration)
+	}
+	if c.TimeoutDuration <= 0 {
+		return fmt.Errorf("timeout %v must be positive", c.TimeoutDuration)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    NotificationExporterConfig
+		wantError bool
+	}{
+		{
+			name: "default",
+			config: NotificationExporterConfig{
+				Webhooks: []Webhook{{Name: "oncall", Type: SlackWebhook, URL: "https://hooks.slack.com/services/T0/B0/X"}},
+			},
+		},
+		{
+			name: "routes",
+			config: NotificationExporterConfig{
+				Webhooks: []Webhook{
+					{Name: "oncall", Type: SlackWebhook, URLFile: "/etc/npd/slack-url"},
+					{Name: "storage", Type: TeamsWebhook, URL: "https://example.webhook.office.com/webhookb2/x"},
+				},
+				Routes: []Route{
+					{Conditions: []string{"ReadonlyFilesystem"}, Webhooks: []string{"storage"}},
+					{Webhooks: []string{"oncall"}, Channel: "#node-alerts"},
+				},
+			},
+		},
+		{
+			name:      "no webhook",
+			config:    NotificationExporterConfig{},
+			wantError: true,
+		},
+		{
+			name: "unsupported type",
+			config: NotificationExporterConfig{
+				Webhooks: []Webhook{{Name: "oncall", Type: "discord", URL: "https://discord.com/api/webhooks/x"}},
+			},
+			wantError: true,
+		},
+		{
+			name: "url and url file",
+			config: NotificationExporterConfig{
+				Webhooks: []Webhook{{Name: "oncall", Type: SlackWebhook, URL: "https://hooks.slack.com/x", URLFile: "/etc/npd/slack-url"}},
+			},
+			wantError: true,
+		},
+		{
+			name: "duplicate webhook",
+			config: NotificationExporterConfig{
+				Webhooks: []Webhook{
+					{Name: "oncall", Type: SlackWebhook, URL: "https://hooks.slack.com/x"},
+					{Name: "oncall", Type: TeamsWebhook, URL: "https://example.webhook.office.com/x"},
+				},
+			},
+			wantError: true,
+		},
+		{
+			name: "route to unknown webhook",
+			config: NotificationExporterConfig{
+				Webhooks: []Webhook{{Name: "oncall", Type: SlackWebhook, URL: "https://hooks.slack.com/x"}},
+				Routes:   []Route{{Webhooks: []string{"storage"}}},
+			},
+			wantError: true,
+		},
+		{
+			name: "negative max messages",
+			config: NotificationExporterConfig{
+				Webhooks:    []Webhook{{Name: "oncall", Type: SlackWebhook, URL: "https://hooks.slack.com/x"}},
+				MaxMessages: -1,
+			},
+			wantError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.ApplyConfiguration(); err != nil {
+				t.Fatalf("Unexpected error applying config %+v: %v", test.config, err)
+			}
+			err := test.config.Validate()
+			if test.wantError && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.wantError && err != nil {
+				t.Errorf("Unexpected error for config %+v: %v", test.config, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notificationexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// The colors of the Teams messages.
+const (
+	problemColor  = "D32F2F"
+	eventColor    = "F57C00"
+	recoveryColor = "2E7D32"
+)
+
+// condition returns the condition of the notification, or nil if it notifies an event.
+func (n *notification) condition() *npdapiv1.Condition {
+	if len(n.report.Conditions) == 0 {
+		return nil
+	}
+	return &n.report.Conditions[0]
+}
+
+// problem returns the condition type or the event reason of the notification.
+func (n *notification) problem() string {
+	if c := n.condition(); c != nil {
+		return c.Type
+	}
+	return n.report.Events[0].Reason
+}
+
+// title returns the title of the notification.
+func (n *notification) title() string {
+	c := n.condition()
+	if c == nil {
+		return fmt.Sprintf("%s on node %s", n.problem(), n.report.Node)
+	}
+	return fmt.Sprintf("%s is %s on node %s", c.Type, c.Status, n.report.Node)
+}
+
+// facts returns the details of the notification, by name.
+func (n *notification) facts(suppressed int) [][2]string {
+	var facts [][2]string
+	add := func(name, value string) {
+		if value != "" {
+			facts = append(facts, [2]string{name, value})
+		}
+	}
+	var message, severity string
+	var timestamp time.Time
+	if c := n.condition(); c != nil {
+		add("Reason", c.Reason)
+		message, severity, timestamp = c.Message, c.Severity, c.Transition
+	} else {
+		e := n.report.Events[0]
+		message, severity, timestamp = e.Message, e.Severity, e.Timestamp
+	}
+	add("Message", message)
+	add("Source", n.report.Source)
+	if !n.recovery() {
+		add("Severity", severity)
+	}
+	add("Time", timestamp.UTC().Format("2006-01-02 15:04:05 MST"))
+	var names []string
+	for name := range n.report.NodeMetadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, n.report.NodeMetadata[name])
+	}
+	if suppressed > 0 {
+		add("Suppressed", fmt.Sprintf("%d notifications were suppressed by the rate limit since the last one", suppressed))
+	}
+	return facts
+}
+
+// recovery returns whether the notification reports a condition recovering.
+func (n *notification) recovery() bool {
+	c := n.condition()
+	return c != nil && c.Status != string(types.True)
+}
+
+type slackMessage struct {
+	Text    string `json:"text"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// slackPayload returns the payload of the Slack webhook posting the notification to the
+// channel, or to the channel of the webhook if empty.
+func slackPayload(n *notification, channel string, suppressed int) ([]byte, error) {
+	icon := ":rotating_light:"
+	switch {
+	case n.recovery():
+		icon = ":white_check_mark:"
+	case n.condition() == nil:
+		icon = ":warning:"
+	}
+	lines := []string{fmt.Sprintf("%s *%s*", icon, slackEscape(n.title()))}
+	for _, fact := range n.facts(suppressed) {
+		lines = append(lines, fmt.Sprintf("*%s:* %s", fact[0], slackEscape(fact[1])))
+	}
+	return json.Marshal(slackMessage{Text: strings.Join(lines, "\n"), Channel: channel})
+}
+
+// slackEscape escapes the control characters of Slack messages.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// teamsMessage is a Teams message card.
+type teamsMessage struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// teamsPayload returns the payload of the Teams webhook posting the notification.
+func teamsPayload(n *notification, suppressed int) ([]byte, error) {
+	color := problemColor
+	switch {
+	case n.recovery():
+		color = recoveryColor
+	case n.condition() == nil:
+		color = eventColor
+	}
+	section := teamsSection{Facts: []teamsFact{}}
+	for _, fact := range n.facts(suppressed) {
+		section.Facts = append(section.Facts, teamsFact{Name: fact[0], Value: fact[1]})
+	}
+	return json.Marshal(teamsMessage{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: color,
+		Summary:    n.title(),
+		Title:      n.title(),
+		Sections:   []teamsSection{section},
+	})
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notificationexporter posts notifications of node problems to Slack and
+// Microsoft Teams webhooks, for small clusters without an alerting stack.
+package notificationexporter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	notificationconfig "k8s.io/node-problem-detector/pkg/exporters/notification/config"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+func init() {
+	exporters.RegisterWithConfigFile(exporterName,
+		"Configuration for the notification exporter, which posts condition transitions to Slack or Microsoft Teams webhooks.", NewExporterOrDie)
+}
+
+const (
+	exporterName = "notification"
+	// queueSize is the number of messages waiting to be posted, beyond which messages are
+	// dropped.
+	queueSize = 1000
+)
+
+// notification is a condition transition or an event to notify.
+type notification struct {
+	// report is the problem report of the single condition or event.
+	report *npdapiv1.ProblemReport
+}
+
+// message is a notification to post to a webhook.
+type message struct {
+	webhook      *webhook
+	channel      string
+	notification *notification
+}
+
+// webhook posts messages to a webhook, limiting their rate.
+type webhook struct {
+	name        string
+	webhookType string
+	url         string
+	// sent are the times messages were posted in the last rate limit period.
+	sent []time.Time
+	// suppressed is the number of messages dropped by the rate limit since the last
+	// message posted.
+	suppressed int
+}
+
+type notificationExporter struct {
+	// Mutex protects conditions, the exporter may be called by the periodic sync while
+	// exporting problems.
+	sync.Mutex
+	config   notificationconfig.NotificationExporterConfig
+	nodeName string
+	clock    clock.Clock
+	client   *http.Client
+	webhooks map[string]*webhook
+	// conditions are the statuses of the conditions last seen, by source and type.
+	conditions map[string]types.ConditionStatus
+	queue      chan *message
+	// stopped is set once the queue is closed, the notifications are dropped after it.
+	stopped bool
+	// done is closed once the queued messages are posted after the queue is closed.
+	done chan struct{}
+}
+
+// NewExporterOrDie creates an exporter posting notifications of problems to webhooks,
+// panics if error occurs.
+func NewExporterOrDie(configPath string) types.Exporter {
+	config := notificationconfig.NotificationExporterConfig{}
+	if err := exporters.LoadConfig(configPath, &config); err != nil {
+		glog.Fatalf("Failed to load notification exporter config: %v", err)
+	}
+	for i, w := range config.Webhooks {
+		if w.URLFile == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(w.URLFile)
+		if err != nil {
+			glog.Fatalf("Failed to read the url of webhook %q: %v", w.Name, err)
+		}
+		config.Webhooks[i].URL = strings.TrimSpace(string(data))
+	}
+
+	glog.Infof("Starting notification exporter %s", configPath)
+	ne := newNotificationExporter(config, util.GetNodeName(), clock.RealClock{})
+	go ne.postMessages()
+	return ne
+}
+
+func newNotificationExporter(config notificationconfig.NotificationExporterConfig, nodeName string, clock clock.Clock) *notificationExporter {
+	ne := &notificationExporter{
+		config:     config,
+		nodeName:   nodeName,
+		clock:      clock,
+		client:     &http.Client{Timeout: config.TimeoutDuration},
+		webhooks:   make(map[string]*webhook),
+		conditions: make(map[string]types.ConditionStatus),
+		queue:      make(chan *message, queueSize),
+		done:       make(chan struct{}),
+	}
+	for _, w := range config.Webhooks {
+		ne.webhooks[w.Name] = &webhook{name: w.Name, webhookType: w.Type, url: w.URL}
+	}
+	return ne
+}
+
+// ExportProblems notifies the condition transitions, and the problem events if
+// configured.
+func (ne *notificationExporter) ExportProblems(status *types.Status) {
+	ne.Lock()
+	defer ne.Unlock()
+	if ne.config.NotifyEvents {
+		for _, event := range status.Events {
+			if !event.Severity.IsProblem() {
+				continue
+			}
+			ne.notify(&notification{report: npdapiv1.NewProblemReport(ne.nodeName, &types.Status{
+				Source: status.Source,
+				Events: []types.Event{event},
+				Node:   status.Node,
+			})})
+		}
+	}
+	ne.exportConditions(status)
+}
+
+// SyncProblems notifies the condition transitions missed by ExportProblems, if any.
+func (ne *notificationExporter) SyncProblems(status *types.Status) {
+	ne.Lock()
+	defer ne.Unlock()
+	ne.exportConditions(status)
+}
+
+// Stop posts the notifications waiting in the queue, and returns once they are posted.
+func (ne *notificationExporter) Stop() {
+	ne.Lock()
+	if !ne.stopped {
+		ne.stopped = true
+		close(ne.queue)
+	}
+	ne.Unlock()
+	<-ne.done
+}
+
+// PushesProblems returns whether notifications are posted to webhooks.
+func (ne *notificationExporter) PushesProblems() bool {
+	return len(ne.webhooks) > 0
+}
+
+// exportConditions notifies the conditions whose status changed. A condition seen for
+// the first time is only notified if it is True.
+func (ne *notificationExporter) exportConditions(status *types.Status) {
+	for _, condition := range status.Conditions {
+		key := status.Source + "/" + condition.Type
+		last, seen := ne.conditions[key]
+		ne.conditions[key] = condition.Status
+		if last == condition.Status || (!seen && condition.Status != types.True) {
+			continue
+		}
+		if condition.Status != types.True && !*ne.config.NotifyRecovery {
+			continue
+		}
+		ne.notify(&notification{report: npdapiv1.NewProblemReport(ne.nodeName, &types.Status{
+			Source:     status.Source,
+			Conditions: []types.Condition{condition},
+			Node:       status.Node,
+		})})
+	}
+}
+
+// notify queues the messages of the notification to the webhooks of the first route
+// including its problem.
+func (ne *notificationExporter) notify(n *notification) {
+	route, ok := ne.route(n.problem())
+	if !ok || ne.stopped {
+		return
+	}
+	for _, name := range route.Webhooks {
+		select {
+		case ne.queue <- &message{webhook: ne.webhooks[name], channel: route.Channel, notification: n}:
+		default:
+			glog.Errorf("Dropped notification of %s to webhook %q, too many notifications are waiting to be posted", n.problem(), name)
+			exporters.RecordFailure(exporterName, "notifications")
+		}
+	}
+}
+
+// route returns the first route including the problem.
+func (ne *notificationExporter) route(problem string) (notificationconfig.Route, bool) {
+	base := problem
+	// The condition types include their instances.
+	if i := strings.Index(problem, "["); i > 0 {
+		base = problem[:i]
+	}
+	for _, route := range ne.config.Routes {
+		if len(route.Conditions) == 0 {
+			return route, true
+		}
+		for _, c := range route.Conditions {
+			if c == problem || c == base {
+				return route, true
+			}
+		}
+	}
+	return notificationconfig.Route{}, false
+}
+
+// postMessages posts the queued messages until the queue is closed.
+func (ne *notificationExporter) postMessages() {
+	defer close(ne.done)
+	for m := range ne.queue {
+		ne.post(m)
+	}
+}
+
+// post posts the message unless the webhook exceeded its rate limit.
+func (ne *notificationExporter) post(m *message) {
+	w := m.webhook
+	now := ne.clock.Now()
+	for len(w.sent) > 0 && now.Sub(w.sent[0]) >= ne.config.RateLimitPeriodDuration {
+		w.sent = w.sent[1:]
+	}
+	if len(w.sent) >= ne.config.MaxMessages {
+		w.suppressed++
+		glog.V(2).Infof("Suppressed notification of %s to webhook %q by the rate limit", m.notification.problem(), w.name)
+		return
+	}
+	w.sent = append(w.sent, now)
+
+	var payload []byte
+	var err error
+	switch w.webhookType {
+	case notificationconfig.SlackWebhook:
+		payload, err = slackPayload(m.notification, m.channel, w.suppressed)
+	case notificationconfig.TeamsWebhook:
+		payload, err = teamsPayload(m.notification, w.suppressed)
+	}
+	if err == nil {
+		err = ne.send(w.url, payload)
+	}
+	if err != nil {
+		glog.Errorf("Failed to post notification of %s to webhook %q: %v", m.notification.problem(), w.name, err)
+		exporters.RecordFailure(exporterName, "notifications")
+		return
+	}
+	w.suppressed = 0
+}
+
+func (ne *notificationExporter) send(address string, payload []byte) error {
+	resp, err := ne.client.Post(address, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		// The URL of the webhook is a secret, only its error is logged.
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %q: %s", resp.Status, body)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notificationexporter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	notificationconfig "k8s.io/node-problem-detector/pkg/exporters/notification/config"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// fakeWebhooks records the payloads posted, by path.
+type fakeWebhooks struct {
+	sync.Mutex
+	payloads map[string][]string
+}
+
+func (f *fakeWebhooks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.Lock()
+	defer f.Unlock()
+	f.payloads[r.URL.Path] = append(f.payloads[r.URL.Path], string(body))
+}
+
+func newTestExporter(t *testing.T, config notificationconfig.NotificationExporterConfig) (*notificationExporter, *fakeWebhooks, *clock.FakeClock) {
+	webhooks := &fakeWebhooks{payloads: make(map[string][]string)}
+	server := httptest.NewServer(webhooks)
+	t.Cleanup(server.Close)
+	for i := range config.Webhooks {
+		config.Webhooks[i].URL = server.URL + "/" + config.Webhooks[i].Name
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		t.Fatalf("Failed to apply configuration: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+	fakeClock := clock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	return newNotificationExporter(config, "node-1", fakeClock), webhooks, fakeClock
+}
+
+// postQueued posts the queued messages.
+func postQueued(ne *notificationExporter) {
+	for {
+		select {
+		case m := <-ne.queue:
+			ne.post(m)
+		default:
+			return
+		}
+	}
+}
+
+func conditionStatus(conditionType string, status types.ConditionStatus, reason string) *types.Status {
+	return &types.Status{
+		Source: "kernel-monitor",
+		Conditions: []types.Condition{{
+			Type:       conditionType,
+			Status:     status,
+			Transition: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Reason:     reason,
+			Message:    "task docker:1234 blocked for more than 120 seconds",
+			Severity:   types.Critical,
+		}},
+	}
+}
+
+func TestExportConditions(t *testing.T) {
+	ne, webhooks, _ := newTestExporter(t, notificationconfig.NotificationExporterConfig{
+		Webhooks: []notificationconfig.Webhook{
+			{Name: "slack", Type: notificationconfig.SlackWebhook},
+			{Name: "teams", Type: notificationconfig.TeamsWebhook},
+		},
+		Routes: []notificationconfig.Route{
+			{Conditions: []string{"KernelDeadlock"}, Webhooks: []string{"slack", "teams"}, Channel: "#kernel"},
+			{Conditions: []string{"DiskReadonly"}, Webhooks: []string{"slack"}},
+		},
+	})
+	assert.True(t, ne.PushesProblems())
+
+	ne.ExportProblems(conditionStatus("KernelDeadlock", types.False, "KernelHasNoDeadlock"))
+	ne.ExportProblems(conditionStatus("KernelDeadlock", types.True, "DockerHung"))
+	// A changed message of a True condition is not notified again.
+	ne.SyncProblems(conditionStatus("KernelDeadlock", types.True, "DockerHung"))
+	ne.ExportProblems(conditionStatus("KernelDeadlock", types.False, "KernelHasNoDeadlock"))
+	// Instances are routed by their condition type, unrouted problems are not notified.
+	ne.ExportProblems(conditionStatus("DiskReadonly[sdb]", types.True, "FilesystemIsReadOnly"))
+	ne.ExportProblems(conditionStatus("FrequentKubeletRestart", types.True, "FrequentKubeletRestart"))
+	postQueued(ne)
+
+	slack := webhooks.payloads["/slack"]
+	if assert.Len(t, slack, 3) {
+		var m slackMessage
+		assert.NoError(t, json.Unmarshal([]byte(slack[0]), &m))
+		assert.Equal(t, "#kernel", m.Channel)
+		assert.Equal(t, ":rotating_light: *KernelDeadlock is True on node node-1*\n"+
+			"*Reason:* DockerHung\n"+
+			"*Message:* task docker:1234 blocked for more than 120 seconds\n"+
+			"*Source:* kernel-monitor\n"+
+			"*Severity:* critical\n"+
+			"*Time:* 2020-01-01 00:00:00 UTC", m.Text)
+		assert.NoError(t, json.Unmarshal([]byte(slack[1]), &m))
+		assert.True(t, strings.HasPrefix(m.Text, ":white_check_mark: *KernelDeadlock is False on node node-1*"), m.Text)
+		assert.NotContains(t, m.Text, "Severity")
+		m = slackMessage{}
+		assert.NoError(t, json.Unmarshal([]byte(slack[2]), &m))
+		assert.Empty(t, m.Channel)
+		assert.True(t, strings.HasPrefix(m.Text, ":rotating_light: *DiskReadonly[sdb] is True on node node-1*"), m.Text)
+	}
+	teams := webhooks.payloads["/teams"]
+	if assert.Len(t, teams, 2) {
+		var m teamsMessage
+		assert.NoError(t, json.Unmarshal([]byte(teams[0]), &m))
+		assert.Equal(t, "MessageCard", m.Type)
+		assert.Equal(t, problemColor, m.ThemeColor)
+		assert.Equal(t, "KernelDeadlock is True on node node-1", m.Title)
+		assert.Equal(t, teamsFact{Name: "Reason", Value: "DockerHung"}, m.Sections[0].Facts[0])
+		assert.NoError(t, json.Unmarshal([]byte(teams[1]), &m))
+		assert.Equal(t, recoveryColor, m.ThemeColor)
+	}
+}
+
+func TestExportEvents(t *testing.T) {
+	notifyRecovery := false
+	ne, webhooks, _ := newTestExporter(t, notificationconfig.NotificationExporterConfig{
+		Webhooks:       []notificationconfig.Webhook{{Name: "slack", Type: notificationconfig.SlackWebhook}},
+		NotifyEvents:   true,
+		NotifyRecovery: &notifyRecovery,
+	})
+
+	ne.ExportProblems(&types.Status{
+		Source: "kernel-monitor",
+		Events: []types.Event{
+			{Severity: types.Info, Reason: "KernelBooted", Message: "kernel booted"},
+			{Severity: types.Warn, Reason: "OOMKilling", Message: "Killed process 1234 (stress) <oom>"},
+		},
+	})
+	ne.ExportProblems(conditionStatus("KernelDeadlock", types.True, "DockerHung"))
+	ne.ExportProblems(conditionStatus("KernelDeadlock", types.False, "KernelHasNoDeadlock"))
+	postQueued(ne)
+
+	slack := webhooks.payloads["/slack"]
+	if assert.Len(t, slack, 2) {
+		var m slackMessage
+		assert.NoError(t, json.Unmarshal([]byte(slack[0]), &m))
+		assert.True(t, strings.HasPrefix(m.Text, ":warning: *OOMKilling on node node-1*\n"+
+			"*Message:* Killed process 1234 (stress) &lt;oom&gt;"), m.Text)
+		assert.NoError(t, json.Unmarshal([]byte(slack[1]), &m))
+		assert.True(t, strings.HasPrefix(m.Text, ":rotating_light: *KernelDeadlock is True"), m.Text)
+	}
+}
+
+func TestExportNodeMetadata(t *testing.T) {
+	ne, webhooks, _ := newTestExporter(t, notificationconfig.NotificationExporterConfig{
+		Webhooks: []notificationconfig.Webhook{{Name: "slack", Type: notificationconfig.SlackWebhook}},
+	})
+
+	status := conditionStatus("KernelDeadlock", types.True, "DockerHung")
+	status.Node = map[string]string{"zone": "us-central1-a", "instance-type": "n1-standard-4"}
+	ne.ExportProblems(status)
+	postQueued(ne)
+
+	slack := webhooks.payloads["/slack"]
+	if assert.Len(t, slack, 1) {
+		var m slackMessage
+		assert.NoError(t, json.Unmarshal([]byte(slack[0]), &m))
+		assert.True(t, strings.HasSuffix(m.Text, "*Time:* 2020-01-01 00:00:00 UTC\n"+
+			"*instance-type:* n1-standard-4\n"+
+			"*zone:* us-central1-a"), m.Text)
+	}
+}
+
+func TestStop(t *testing.T) {
+	ne, webhooks, _ := newTestExporter(t, notificationconfig.NotificationExporterConfig{
+		Webhooks: []notificationconfig.Webhook{{Name: "slack", Type: notificationconfig.SlackWebhook}},
+	})
+
+	// The queued notifications are posted on stop, the later ones are dropped.
+	ne.ExportProblems(conditionStatus("KernelDeadlock", types.True, "DockerHung"))
+	go ne.postMessages()
+	ne.Stop()
+	ne.ExportProblems(conditionStatus("KernelDeadlock", types.False, "KernelHasNoDeadlock"))
+	ne.Stop()
+	assert.Len(t, webhooks.payloads["/slack"], 1)
+}
+
+func TestRateLimit(t *testing.T) {
+	ne, webhooks, fakeClock := newTestExporter(t, notificationconfig.NotificationExporterConfig{
+		Webhooks:        []notificationconfig.Webhook{{Name: "slack", Type: notificationconfig.SlackWebhook}},
+		MaxMessages:     2,
+		RateLimitPeriod: "1h",
+	})
+
+	for i := 0; i < 3; i++ {
+		ne.ExportProblems(conditionStatus("KernelDeadlock", types.True, "DockerHung"))
+		ne.ExportProblems(conditionStatus("KernelDeadlock", types.False, "KernelHasNoDeadlock"))
+	}
+	postQueued(ne)
+	assert.Len(t, webhooks.payloads["/slack"], 2)
+
+	fakeClock.Step(time.Hour)
+	ne.ExportProblems(conditionStatus("KernelDeadlock", types.True, "DockerHung"))
+	postQueued(ne)
+	slack := webhooks.payloads["/slack"]
+	if assert.Len(t, slack, 3) {
+		assert.Contains(t, slack[2], "4 notifications were suppressed by the rate limit")
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlpexporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	otlpconfig "k8s.io/node-problem-detector/pkg/exporters/otlp/config"
+)
+
+const (
+	grpcMetricsExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	grpcTracesExportMethod  = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+)
+
+// exportClient sends encoded export requests to an OTLP receiver.
+type exportClient interface {
+	export(ctx context.Context, request []byte) error
+}
+
+// newMetricsClient creates a client sending ExportMetricsServiceRequest.
+func newMetricsClient(config otlpconfig.OTLPExporterConfig) (exportClient, error) {
+	return newExportClient(config, grpcMetricsExportMethod, config.Endpoint)
+}
+
+// newTracesClient creates a client sending ExportTraceServiceRequest.
+func newTracesClient(config otlpconfig.OTLPExporterConfig) (exportClient, error) {
+	return newExportClient(config, grpcTracesExportMethod, config.TracesEndpoint)
+}
+
+func newExportClient(config otlpconfig.OTLPExporterConfig, grpcMethod, endpoint string) (exportClient, error) {
+	switch config.Protocol {
+	case otlpconfig.ProtocolGRPC:
+		return newGRPCClient(config, endpoint, grpcMethod)
+	case otlpconfig.ProtocolHTTP:
+		return &httpClient{
+			url:     endpoint,
+			headers: config.Headers,
+			client:  &http.Client{Timeout: config.TimeoutDuration},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", config.Protocol)
+	}
+}
+
+type grpcClient struct {
+	conn    *grpc.ClientConn
+	method  string
+	headers metadata.MD
+}
+
+func newGRPCClient(config otlpconfig.OTLPExporterConfig, endpoint, method string) (*grpcClient, error) {
+	dialOption := grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+	if config.Insecure {
+		dialOption = grpc.WithInsecure()
+	}
+	// Dial is non-blocking, the connection is established on the first export.
+	conn, err := grpc.Dial(endpoint, dialOption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %q: %v", endpoint, err)
+	}
+	return &grpcClient{conn: conn, method: method, headers: metadata.New(config.Headers)}, nil
+}
+
+func (c *grpcClient) export(ctx context.Context, request []byte) error {
+	ctx = metadata.NewOutgoingContext(ctx, c.headers)
+	var response rawMessage
+	return c.conn.Invoke(ctx, c.method, rawMessage(request), &response, grpc.ForceCodec(rawCodec{}))
+}
+
+// rawMessage is an already encoded protobuf message.
+type rawMessage []byte
+
+// rawCodec passes already encoded protobuf messages through to gRPC.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(rawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return m, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(*rawMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*m = append((*m)[:0], data...)
+	return nil
+}
+
+// Name returns "proto" as the payload is protobuf on the wire.
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+type httpClient struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (c *httpClient) export(ctx context.Context, request []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(request))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so that the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %q from %q", resp.Status, c.url)
+	}
+	return nil
+}
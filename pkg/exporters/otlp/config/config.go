@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// ProtocolGRPC exports metrics with OTLP over gRPC.
+	ProtocolGRPC = "grpc"
+	// ProtocolHTTP exports metrics with OTLP over HTTP, using protobuf encoding.
+	ProtocolHTTP = "http"
+)
+
+var (
+	defaultExportPeriod = (60 * time.Second).String()
+	defaultTimeout      = (10 * time.Second).String()
+	defaultGRPCEndpoint = "localhost:4317"
+	defaultHTTPEndpoint = "http://localhost:4318/v1/metrics"
+	defaultTracesPath   = "/v1/traces"
+)
+
+type OTLPExporterConfig struct {
+	// Protocol is either "grpc" or "http". Default to "grpc".
+	Protocol string `json:"protocol"`
+	// Endpoint is the address of the OTLP receiver. For gRPC it is host:port,
+	// for HTTP it is the full URL of the metrics endpoint.
+	Endpoint string `json:"endpoint"`
+	// Insecure disables TLS for gRPC connections. It is ignored for HTTP, where
+	// the URL scheme decides.
+	Insecure bool `json:"insecure"`
+	// Headers are sent with every export request, e.g. for authentication.
+	Headers map[string]string `json:"headers"`
+	// ResourceAttributes are attached to the resource of all exported metrics.
+	ResourceAttributes map[string]string `json:"resourceAttributes"`
+	ExportPeriod       string            `json:"exportPeriod"`
+	Timeout            string            `json:"timeout"`
+	// ExportTraces exports the traces of the detection of problems, which are sampled
+	// with --tracing-sample-probability.
+	ExportTraces bool `json:"exportTraces"`
+	// TracesEndpoint is the address traces are exported to, like Endpoint. Default to the
+	// endpoint for gRPC, and to the endpoint with the path /v1/traces for HTTP.
+	TracesEndpoint string `json:"tracesEndpoint"`
+
+	ExportPeriodDuration time.Duration `json:"-"`
+	TimeoutDuration      time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (oec *OTLPExporterConfig) ApplyConfiguration() error {
+	if oec.Protocol == "" {
+		oec.Protocol = ProtocolGRPC
+	}
+	if oec.Endpoint == "" {
+		if oec.Protocol == ProtocolHTTP {
+			oec.Endpoint = defaultHTTPEndpoint
+		} else {
+			oec.Endpoint = defaultGRPCEndpoint
+		}
+	}
+	if oec.ExportTraces && oec.TracesEndpoint == "" {
+		oec.TracesEndpoint = oec.Endpoint
+		if oec.Protocol == ProtocolHTTP {
+			u, err := url.Parse(oec.Endpoint)
+			if err != nil {
+				return fmt.Errorf("failed to parse endpoint %q: %v", oec.Endpoint, err)
+			}
+			u.Path = defaultTracesPath
+			oec.TracesEndpoint = u.String()
+		}
+	}
+	if oec.ExportPeriod == "" {
+		oec.ExportPeriod = defaultExportPeriod
+	}
+	if oec.Timeout == "" {
+		oec.Timeout = defaultTimeout
+	}
+
+	var err error
+	oec.ExportPeriodDuration, err = time.ParseDuration(oec.ExportPeriod)
+	if err != nil {
+		return fmt.Errorf("failed to parse exportPeriod %q: %v", oec.ExportPeriod, err)
+	}
+	oec.TimeoutDuration, err = time.ParseDuration(oec.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to parse timeout %q: %v", oec.Timeout, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (oec *OTLPExporterConfig) Validate() error {
+	if oec.Protocol != ProtocolGRPC && oec.Protocol != ProtocolHTTP {
+		return fmt.Errorf("unsupported protocol %q, supported: %q, %q", oec.Protocol, ProtocolGRPC, ProtocolHTTP)
+	}
+	if oec.ExportPeriodDuration <= 0 {
+		return fmt.Errorf("exportPeriod %v must be positive", oec.ExportPeriodDuration)
+	}
+	if oec.TimeoutDuration <= 0 {
+		return fmt.Errorf("timeout %v must be positive", oec.TimeoutDuration)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlpexporter
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"go.opencensus.io/trace"
+
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+// The OTLP protobuf messages are encoded by hand, so that no generated code or
+// OpenTelemetry SDK is needed. Only the subset of the OTLP metrics data model
+// used by NPD is supported: gauges and cumulative sums of number data points, and
+// the exemplars of the sums.
+// See https://github.com/open-telemetry/opentelemetry-proto for the schema.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// Field numbers of the OTLP messages.
+const (
+	// ExportMetricsServiceRequest
+	fieldRequestResourceMetrics = 1
+	// ResourceMetrics
+	fieldResourceMetricsResource     = 1
+	fieldResourceMetricsScopeMetrics = 2
+	// Resource
+	fieldResourceAttributes = 1
+	// KeyValue
+	fieldKeyValueKey   = 1
+	fieldKeyValueValue = 2
+	// AnyValue
+	fieldAnyValueString = 1
+	// ScopeMetrics
+	fieldScopeMetricsScope   = 1
+	fieldScopeMetricsMetrics = 2
+	// InstrumentationScope
+	fieldScopeName    = 1
+	fieldScopeVersion = 2
+	// Metric
+	fieldMetricName        = 1
+	fieldMetricDescription = 2
+	fieldMetricUnit        = 3
+	fieldMetricGauge       = 5
+	fieldMetricSum         = 7
+	// Gauge and Sum
+	fieldDataPoints             = 1
+	fieldSumAggregationTemporal = 2
+	fieldSumIsMonotonic         = 3
+	// NumberDataPoint
+	fieldPointStartTime  = 2
+	fieldPointTime       = 3
+	fieldPointAsDouble   = 4
+	fieldPointExemplars  = 5
+	fieldPointAsInt      = 6
+	fieldPointAttributes = 7
+	// Exemplar
+	fieldExemplarTime       = 2
+	fieldExemplarAsDouble   = 3
+	fieldExemplarSpanID     = 4
+	fieldExemplarTraceID    = 5
+	fieldExemplarAttributes = 7
+
+	aggregationTemporalityCumulative = 2
+)
+
+// metricKind is the kind of an OTLP metric.
+type metricKind int
+
+const (
+	gaugeKind metricKind = iota
+	cumulativeSumKind
+)
+
+// dataPoint is a single OTLP NumberDataPoint.
+type dataPoint struct {
+	attributes map[string]string
+	start      time.Time
+	time       time.Time
+	isInt      bool
+	intValue   int64
+	floatValue float64
+	// exemplar is the exemplar of the point, if any.
+	exemplar *metrics.Exemplar
+}
+
+// metric is a single OTLP Metric.
+type metric struct {
+	name        string
+	description string
+	unit        string
+	kind        metricKind
+	points      []dataPoint
+}
+
+// encodeRequest encodes an ExportMetricsServiceRequest with a single resource
+// and instrumentation scope.
+func encodeRequest(resourceAttributes map[string]string, scopeName, scopeVersion string, metrics []metric) []byte {
+	resource := proto.NewBuffer(nil)
+	encodeAttributes(resource, fieldResourceAttributes, resourceAttributes)
+
+	scope := proto.NewBuffer(nil)
+	encodeString(scope, fieldScopeName, scopeName)
+	encodeString(scope, fieldScopeVersion, scopeVersion)
+
+	scopeMetrics := proto.NewBuffer(nil)
+	encodeMessage(scopeMetrics, fieldScopeMetricsScope, scope.Bytes())
+	for _, m := range metrics {
+		encodeMessage(scopeMetrics, fieldScopeMetricsMetrics, encodeMetric(m))
+	}
+
+	resourceMetrics := proto.NewBuffer(nil)
+	encodeMessage(resourceMetrics, fieldResourceMetricsResource, resource.Bytes())
+	encodeMessage(resourceMetrics, fieldResourceMetricsScopeMetrics, scopeMetrics.Bytes())
+
+	request := proto.NewBuffer(nil)
+	encodeMessage(request, fieldRequestResourceMetrics, resourceMetrics.Bytes())
+	return request.Bytes()
+}
+
+func encodeMetric(m metric) []byte {
+	data := proto.NewBuffer(nil)
+	for _, p := range m.points {
+		encodeMessage(data, fieldDataPoints, encodeDataPoint(p))
+	}
+
+	b := proto.NewBuffer(nil)
+	encodeString(b, fieldMetricName, m.name)
+	encodeString(b, fieldMetricDescription, m.description)
+	encodeString(b, fieldMetricUnit, m.unit)
+	switch m.kind {
+	case gaugeKind:
+		encodeMessage(b, fieldMetricGauge, data.Bytes())
+	case cumulativeSumKind:
+		encodeVarint(data, fieldSumAggregationTemporal, aggregationTemporalityCumulative)
+		encodeVarint(data, fieldSumIsMonotonic, 1)
+		encodeMessage(b, fieldMetricSum, data.Bytes())
+	}
+	return b.Bytes()
+}
+
+func encodeDataPoint(p dataPoint) []byte {
+	b := proto.NewBuffer(nil)
+	if !p.start.IsZero() {
+		encodeFixed64(b, fieldPointStartTime, uint64(p.start.UnixNano()))
+	}
+	encodeFixed64(b, fieldPointTime, uint64(p.time.UnixNano()))
+	if p.isInt {
+		encodeFixed64(b, fieldPointAsInt, uint64(p.intValue))
+	} else {
+		encodeFixed64(b, fieldPointAsDouble, math.Float64bits(p.floatValue))
+	}
+	encodeAttributes(b, fieldPointAttributes, p.attributes)
+	if p.exemplar != nil {
+		encodeMessage(b, fieldPointExemplars, encodeExemplar(p.exemplar))
+	}
+	return b.Bytes()
+}
+
+// encodeExemplar encodes an Exemplar, with the trace and span IDs when the problem was
+// traced.
+func encodeExemplar(e *metrics.Exemplar) []byte {
+	b := proto.NewBuffer(nil)
+	encodeFixed64(b, fieldExemplarTime, uint64(e.Timestamp.UnixNano()))
+	encodeFixed64(b, fieldExemplarAsDouble, math.Float64bits(e.Value))
+	if e.Trace.TraceID != (trace.TraceID{}) {
+		encodeMessage(b, fieldExemplarSpanID, e.Trace.SpanID[:])
+		encodeMessage(b, fieldExemplarTraceID, e.Trace.TraceID[:])
+	}
+	encodeAttributes(b, fieldExemplarAttributes, e.Attributes)
+	return b.Bytes()
+}
+
+// encodeAttributes encodes string attributes as repeated KeyValue, sorted by
+// key so that the output is deterministic.
+func encodeAttributes(b *proto.Buffer, field int, attributes map[string]string) {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value := proto.NewBuffer(nil)
+		encodeString(value, fieldAnyValueString, attributes[k])
+
+		kv := proto.NewBuffer(nil)
+		encodeString(kv, fieldKeyValueKey, k)
+		encodeMessage(kv, fieldKeyValueValue, value.Bytes())
+		encodeMessage(b, field, kv.Bytes())
+	}
+}
+
+// The encode* helpers below never fail: proto.Buffer only returns errors when
+// decoding.
+
+func encodeTag(b *proto.Buffer, field, wireType int) {
+	b.EncodeVarint(uint64(field<<3 | wireType))
+}
+
+func encodeString(b *proto.Buffer, field int, s string) {
+	if s == "" {
+		return
+	}
+	encodeTag(b, field, wireBytes)
+	b.EncodeStringBytes(s)
+}
+
+func encodeMessage(b *proto.Buffer, field int, m []byte) {
+	encodeTag(b, field, wireBytes)
+	b.EncodeRawBytes(m)
+}
+
+func encodeVarint(b *proto.Buffer, field int, v uint64) {
+	encodeTag(b, field, wireVarint)
+	b.EncodeVarint(v)
+}
+
+func encodeFixed64(b *proto.Buffer, field int, v uint64) {
+	encodeTag(b, field, wireFixed64)
+	b.EncodeFixed64(v)
+}
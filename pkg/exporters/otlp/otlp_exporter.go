@@ -0,0 +1,169 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlpexporter
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+
+	"k8s.io/node-problem-detector/pkg/exporters"
+	otlpconfig "k8s.io/node-problem-detector/pkg/exporters/otlp/config"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/version"
+)
+
+func init() {
+	exporters.RegisterWithConfigFile(exporterName,
+		"Configuration for OpenTelemetry (OTLP) metrics exporter.", NewExporterOrDie)
+}
+
+const (
+	exporterName = "otlp"
+	scopeName    = "k8s.io/node-problem-detector"
+)
+
+type otlpExporter struct {
+	config otlpconfig.OTLPExporterConfig
+	client exportClient
+	// tracesClient and spans are only set when traces are exported.
+	tracesClient exportClient
+	spans        chan *trace.SpanData
+}
+
+// defaultResourceAttributes returns the resource attributes used when they are
+// not specified in the config.
+func defaultResourceAttributes() map[string]string {
+	attributes := map[string]string{
+		"service.name":    "node-problem-detector",
+		"service.version": version.Version(),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attributes["host.name"] = hostname
+	}
+	return attributes
+}
+
+// ExportView implements view.Exporter. It is called by OpenCensus once per
+// view every reporting period.
+func (oe *otlpExporter) ExportView(vd *view.Data) {
+	m, ok := toMetric(vd)
+	if !ok {
+		return
+	}
+	request := encodeRequest(oe.config.ResourceAttributes, scopeName, version.Version(), []metric{m})
+
+	ctx, cancel := context.WithTimeout(context.Background(), oe.config.TimeoutDuration)
+	defer cancel()
+	if err := oe.client.export(ctx, request); err != nil {
+		glog.Errorf("Failed to export metric %q to OTLP endpoint %q: %v", m.name, oe.config.Endpoint, err)
+		exporters.RecordFailure("otlp", "metrics")
+	}
+}
+
+// toMetric converts OpenCensus view data to an OTLP metric. Distribution
+// aggregations (e.g. custom_plugin/execution_duration) are not supported yet.
+func toMetric(vd *view.Data) (metric, bool) {
+	m := metric{
+		name:        vd.View.Name,
+		description: vd.View.Description,
+		unit:        vd.View.Measure.Unit(),
+	}
+	_, isInt := vd.View.Measure.(*stats.Int64Measure)
+
+	for _, row := range vd.Rows {
+		p := dataPoint{
+			attributes: map[string]string{},
+			time:       vd.End,
+		}
+		for _, t := range row.Tags {
+			p.attributes[t.Key.Name()] = t.Value
+		}
+		switch data := row.Data.(type) {
+		case *view.LastValueData:
+			m.kind = gaugeKind
+			p.isInt, p.intValue, p.floatValue = isInt, int64(data.Value), data.Value
+		case *view.SumData:
+			m.kind = cumulativeSumKind
+			p.start = vd.Start
+			p.isInt, p.intValue, p.floatValue = isInt, int64(data.Value), data.Value
+			if exemplar, ok := metrics.LookupExemplar(vd.View.Name, row.Tags); ok {
+				p.exemplar = &exemplar
+			}
+		case *view.CountData:
+			m.kind = cumulativeSumKind
+			p.start = vd.Start
+			p.isInt, p.intValue = true, data.Value
+		default:
+			glog.V(4).Infof("Skipping unsupported aggregation %T for metric %q", row.Data, m.name)
+			return m, false
+		}
+		m.points = append(m.points, p)
+	}
+	return m, len(m.points) > 0
+}
+
+// ExportProblems does nothing.
+// OTLP exporter only exports metrics.
+func (oe *otlpExporter) ExportProblems(status *types.Status) {
+	return
+}
+
+// SyncProblems does nothing.
+// OTLP exporter only exports metrics.
+func (oe *otlpExporter) SyncProblems(status *types.Status) {
+	return
+}
+
+// NewExporterOrDie creates an exporter to export metrics to an OTLP receiver, panics if error occurs.
+func NewExporterOrDie(configPath string) types.Exporter {
+	oe := otlpExporter{}
+	err := exporters.LoadConfig(configPath, &oe.config)
+	if err != nil {
+		glog.Fatalf("Failed to load OTLP exporter config: %v", err)
+	}
+	if len(oe.config.ResourceAttributes) == 0 {
+		oe.config.ResourceAttributes = defaultResourceAttributes()
+	}
+
+	glog.Infof("Starting OTLP exporter %s", configPath)
+
+	oe.client, err = newMetricsClient(oe.config)
+	if err != nil {
+		glog.Fatalf("Failed to create OTLP client: %v", err)
+	}
+
+	metrics.RegisterViewExporter(exporterName, &oe, oe.config.ExportPeriodDuration)
+
+	if oe.config.ExportTraces {
+		oe.tracesClient, err = newTracesClient(oe.config)
+		if err != nil {
+			glog.Fatalf("Failed to create OTLP traces client: %v", err)
+		}
+		oe.spans = make(chan *trace.SpanData, spanQueueSize)
+		go oe.exportSpans(time.NewTicker(spanExportPeriod).C)
+		trace.RegisterExporter(&oe)
+	}
+
+	return &oe
+}
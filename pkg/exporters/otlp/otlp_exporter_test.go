@@ -0,0 +1,268 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlpexporter
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+
+	otlpconfig "k8s.io/node-problem-detector/pkg/exporters/otlp/config"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+func TestToMetric(t *testing.T) {
+	start := time.Unix(100, 0)
+	end := time.Unix(200, 0)
+	reasonKey, _ := tag.NewKey("reason")
+
+	testCases := []struct {
+		name     string
+		data     *view.Data
+		expected metric
+		ok       bool
+	}{
+		{
+			name: "int64 sum",
+			data: &view.Data{
+				View: &view.View{
+					Name:        "problem_counter",
+					Description: "Number of times a specific type of problem have occurred.",
+					Measure:     stats.Int64("problem_counter", "", "1"),
+					Aggregation: view.Sum(),
+				},
+				Start: start,
+				End:   end,
+				Rows: []*view.Row{
+					{Tags: []tag.Tag{{Key: reasonKey, Value: "OOMKilling"}}, Data: &view.SumData{Value: 3}},
+				},
+			},
+			expected: metric{
+				name:        "problem_counter",
+				description: "Number of times a specific type of problem have occurred.",
+				unit:        "1",
+				kind:        cumulativeSumKind,
+				points: []dataPoint{
+					{attributes: map[string]string{"reason": "OOMKilling"}, start: start, time: end, isInt: true, intValue: 3, floatValue: 3},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "float64 last value",
+			data: &view.Data{
+				View: &view.View{
+					Name:        "host/uptime",
+					Measure:     stats.Float64("host/uptime", "", "s"),
+					Aggregation: view.LastValue(),
+				},
+				Start: start,
+				End:   end,
+				Rows:  []*view.Row{{Data: &view.LastValueData{Value: 1.5}}},
+			},
+			expected: metric{
+				name: "host/uptime",
+				unit: "s",
+				kind: gaugeKind,
+				points: []dataPoint{
+					{attributes: map[string]string{}, time: end, intValue: 1, floatValue: 1.5},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "distribution is skipped",
+			data: &view.Data{
+				View: &view.View{
+					Name:        "latency",
+					Measure:     stats.Float64("latency", "", "ms"),
+					Aggregation: view.Distribution(1, 10),
+				},
+				Rows: []*view.Row{{Data: &view.DistributionData{}}},
+			},
+			ok: false,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			m, ok := toMetric(test.data)
+			assert.Equal(t, test.ok, ok)
+			if test.ok {
+				assert.Equal(t, test.expected, m)
+			}
+		})
+	}
+}
+
+func TestExemplar(t *testing.T) {
+	counter, err := metrics.NewInt64Metric("otlp_exemplar_test", "otlp_exemplar_test", "", "1", metrics.Sum, []string{"reason"})
+	assert.NoError(t, err)
+	exemplar := metrics.Exemplar{
+		Value:      1,
+		Timestamp:  time.Unix(150, 0),
+		Trace:      trace.SpanContext{TraceID: trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, SpanID: trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8}},
+		Attributes: map[string]string{"source": "kernel-monitor", "message": "task docker:7 blocked"},
+	}
+	counter.SetExemplar(map[string]string{"reason": "TaskHung"}, exemplar)
+
+	reasonKey, _ := tag.NewKey("reason")
+	m, ok := toMetric(&view.Data{
+		View: &view.View{Name: "otlp_exemplar_test", Measure: stats.Int64("otlp_exemplar_test", "", "1"), Aggregation: view.Sum()},
+		End:  time.Unix(200, 0),
+		Rows: []*view.Row{
+			{Tags: []tag.Tag{{Key: reasonKey, Value: "TaskHung"}}, Data: &view.SumData{Value: 3}},
+			{Tags: []tag.Tag{{Key: reasonKey, Value: "DockerHung"}}, Data: &view.SumData{Value: 1}},
+		},
+	})
+	assert.True(t, ok)
+	if assert.Len(t, m.points, 2) {
+		assert.Equal(t, &exemplar, m.points[0].exemplar)
+		assert.Nil(t, m.points[1].exemplar, "series without exemplar should have no exemplar")
+	}
+
+	request := encodeRequest(nil, scopeName, "v1", []metric{m})
+	for _, b := range [][]byte{[]byte("task docker:7 blocked"), exemplar.Trace.TraceID[:], exemplar.Trace.SpanID[:]} {
+		assert.True(t, bytes.Contains(request, b), "expected %q in the encoded request", b)
+	}
+}
+
+func TestEncodeRequest(t *testing.T) {
+	request := encodeRequest(map[string]string{"host.name": "node-1"}, scopeName, "v1",
+		[]metric{{name: "host/uptime", kind: gaugeKind, points: []dataPoint{{time: time.Unix(1, 0), floatValue: 1}}}})
+
+	// The request has a single ResourceMetrics (field 1, length delimited).
+	assert.Equal(t, byte(fieldRequestResourceMetrics<<3|wireBytes), request[0])
+	for _, s := range []string{"host.name", "node-1", scopeName, "host/uptime"} {
+		assert.True(t, bytes.Contains(request, []byte(s)), "expected %q in the encoded request", s)
+	}
+}
+
+func TestHTTPClientExport(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		received, _ = ioutil.ReadAll(r.Body)
+		if len(received) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	config := otlpconfig.OTLPExporterConfig{
+		Protocol: otlpconfig.ProtocolHTTP,
+		Endpoint: server.URL,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	client, err := newMetricsClient(config)
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.export(context.Background(), []byte("request")))
+	assert.Equal(t, []byte("request"), received)
+	assert.Error(t, client.export(context.Background(), nil))
+}
+
+func TestEncodeTraceRequest(t *testing.T) {
+	span := &trace.SpanData{
+		SpanContext: trace.SpanContext{
+			TraceID: trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			SpanID:  trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		Name:       "systemlogmonitor.DetectProblems",
+		StartTime:  time.Unix(1, 0),
+		EndTime:    time.Unix(2, 0),
+		Attributes: map[string]interface{}{"source": "kernel-monitor", "read_lag_ms": int64(15), "sampled": true},
+		Status:     trace.Status{Code: trace.StatusCodeUnknown, Message: "export failed"},
+	}
+	request := encodeTraceRequest(map[string]string{"host.name": "node-1"}, scopeName, "v1", []*trace.SpanData{span})
+
+	// The request has a single ResourceSpans (field 1, length delimited).
+	assert.Equal(t, byte(fieldRequestResourceSpans<<3|wireBytes), request[0])
+	for _, b := range [][]byte{[]byte("node-1"), []byte(scopeName), []byte(span.Name), []byte("read_lag_ms"),
+		[]byte("kernel-monitor"), []byte("export failed"), span.TraceID[:], span.SpanID[:]} {
+		assert.True(t, bytes.Contains(request, b), "expected %q in the encoded request", b)
+	}
+}
+
+// fakeClient records the exported requests.
+type fakeClient struct {
+	requests chan []byte
+}
+
+func (c *fakeClient) export(ctx context.Context, request []byte) error {
+	c.requests <- request
+	return nil
+}
+
+func TestExportSpans(t *testing.T) {
+	client := &fakeClient{requests: make(chan []byte, 10)}
+	oe := &otlpExporter{
+		config:       otlpconfig.OTLPExporterConfig{TimeoutDuration: time.Second},
+		tracesClient: client,
+		spans:        make(chan *trace.SpanData, spanQueueSize),
+	}
+	ticks := make(chan time.Time)
+	go oe.exportSpans(ticks)
+
+	oe.ExportSpan(&trace.SpanData{Name: "first"})
+	oe.ExportSpan(&trace.SpanData{Name: "second"})
+	// The queued spans are exported on a tick after they are received. A tick may come
+	// between the two spans, so that they are exported in separate requests.
+	var exported []byte
+	for !bytes.Contains(exported, []byte("first")) || !bytes.Contains(exported, []byte("second")) {
+		select {
+		case ticks <- time.Now():
+		case request := <-client.requests:
+			exported = append(exported, request...)
+		}
+	}
+	var request []byte
+
+	// A full batch is exported without waiting for the next tick.
+	for i := 0; i < spanBatchSize; i++ {
+		oe.ExportSpan(&trace.SpanData{Name: "batched"})
+	}
+	select {
+	case request = <-client.requests:
+		assert.Equal(t, spanBatchSize, bytes.Count(request, []byte("batched")))
+	case <-time.After(10 * time.Second):
+		t.Errorf("The full batch was not exported")
+	}
+}
+
+func TestApplyTracesEndpoint(t *testing.T) {
+	config := otlpconfig.OTLPExporterConfig{Protocol: otlpconfig.ProtocolHTTP, Endpoint: "https://collector:4318/v1/metrics", ExportTraces: true}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.Equal(t, "https://collector:4318/v1/traces", config.TracesEndpoint)
+
+	config = otlpconfig.OTLPExporterConfig{ExportTraces: true}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.Equal(t, "localhost:4317", config.TracesEndpoint)
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlpexporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"go.opencensus.io/trace"
+
+	"k8s.io/node-problem-detector/pkg/exporters"
+	"k8s.io/node-problem-detector/pkg/version"
+)
+
+// Field numbers of the OTLP trace messages, in addition to the common ones.
+const (
+	// ExportTraceServiceRequest
+	fieldRequestResourceSpans = 1
+	// ResourceSpans
+	fieldResourceSpansResource   = 1
+	fieldResourceSpansScopeSpans = 2
+	// ScopeSpans
+	fieldScopeSpansScope = 1
+	fieldScopeSpansSpans = 2
+	// Span
+	fieldSpanTraceID      = 1
+	fieldSpanSpanID       = 2
+	fieldSpanParentSpanID = 4
+	fieldSpanName         = 5
+	fieldSpanKind         = 6
+	fieldSpanStartTime    = 7
+	fieldSpanEndTime      = 8
+	fieldSpanAttributes   = 9
+	fieldSpanStatus       = 15
+	// Status
+	fieldStatusMessage = 2
+	fieldStatusCode    = 3
+	// AnyValue
+	fieldAnyValueBool = 2
+	fieldAnyValueInt  = 3
+
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+	statusCodeError  = 2
+)
+
+const (
+	// spanQueueSize is the number of ended spans waiting to be exported.
+	spanQueueSize = 1000
+	// spanBatchSize is the maximum number of spans exported in one request.
+	spanBatchSize = 512
+	// spanExportPeriod is the period at which the queued spans are exported.
+	spanExportPeriod = 5 * time.Second
+)
+
+// encodeTraceRequest encodes an ExportTraceServiceRequest with a single resource and
+// instrumentation scope.
+func encodeTraceRequest(resourceAttributes map[string]string, scopeName, scopeVersion string, spans []*trace.SpanData) []byte {
+	resource := proto.NewBuffer(nil)
+	encodeAttributes(resource, fieldResourceAttributes, resourceAttributes)
+
+	scope := proto.NewBuffer(nil)
+	encodeString(scope, fieldScopeName, scopeName)
+	encodeString(scope, fieldScopeVersion, scopeVersion)
+
+	scopeSpans := proto.NewBuffer(nil)
+	encodeMessage(scopeSpans, fieldScopeSpansScope, scope.Bytes())
+	for _, s := range spans {
+		encodeMessage(scopeSpans, fieldScopeSpansSpans, encodeSpan(s))
+	}
+
+	resourceSpans := proto.NewBuffer(nil)
+	encodeMessage(resourceSpans, fieldResourceSpansResource, resource.Bytes())
+	encodeMessage(resourceSpans, fieldResourceSpansScopeSpans, scopeSpans.Bytes())
+
+	request := proto.NewBuffer(nil)
+	encodeMessage(request, fieldRequestResourceSpans, resourceSpans.Bytes())
+	return request.Bytes()
+}
+
+func encodeSpan(s *trace.SpanData) []byte {
+	b := proto.NewBuffer(nil)
+	encodeMessage(b, fieldSpanTraceID, s.TraceID[:])
+	encodeMessage(b, fieldSpanSpanID, s.SpanID[:])
+	if s.ParentSpanID != (trace.SpanID{}) {
+		encodeMessage(b, fieldSpanParentSpanID, s.ParentSpanID[:])
+	}
+	encodeString(b, fieldSpanName, s.Name)
+	kind := spanKindInternal
+	switch s.SpanKind {
+	case trace.SpanKindServer:
+		kind = spanKindServer
+	case trace.SpanKindClient:
+		kind = spanKindClient
+	}
+	encodeVarint(b, fieldSpanKind, uint64(kind))
+	encodeFixed64(b, fieldSpanStartTime, uint64(s.StartTime.UnixNano()))
+	encodeFixed64(b, fieldSpanEndTime, uint64(s.EndTime.UnixNano()))
+	encodeSpanAttributes(b, s.Attributes)
+	// Only errors are set, OpenCensus does not tell unset from ok.
+	if s.Code != trace.StatusCodeOK {
+		status := proto.NewBuffer(nil)
+		encodeString(status, fieldStatusMessage, s.Message)
+		encodeVarint(status, fieldStatusCode, statusCodeError)
+		encodeMessage(b, fieldSpanStatus, status.Bytes())
+	}
+	return b.Bytes()
+}
+
+// encodeSpanAttributes encodes the string, bool and int64 attributes of a span as
+// repeated KeyValue. The order follows the map, which the receivers do not rely on.
+func encodeSpanAttributes(b *proto.Buffer, attributes map[string]interface{}) {
+	for k, v := range attributes {
+		value := proto.NewBuffer(nil)
+		switch v := v.(type) {
+		case string:
+			encodeTag(value, fieldAnyValueString, wireBytes)
+			value.EncodeStringBytes(v)
+		case bool:
+			var i uint64
+			if v {
+				i = 1
+			}
+			encodeVarint(value, fieldAnyValueBool, i)
+		case int64:
+			encodeVarint(value, fieldAnyValueInt, uint64(v))
+		default:
+			continue
+		}
+
+		kv := proto.NewBuffer(nil)
+		encodeString(kv, fieldKeyValueKey, k)
+		encodeMessage(kv, fieldKeyValueValue, value.Bytes())
+		encodeMessage(b, fieldSpanAttributes, kv.Bytes())
+	}
+}
+
+// ExportSpan implements trace.Exporter. It is called by OpenCensus when a sampled span
+// ends, and queues the span to be exported in batches. The span is dropped if too many
+// spans are waiting to be exported.
+func (oe *otlpExporter) ExportSpan(s *trace.SpanData) {
+	select {
+	case oe.spans <- s:
+	default:
+		exporters.RecordFailure("otlp", "traces")
+	}
+}
+
+// exportSpans exports the queued spans every span export period, or as soon as a batch
+// is full.
+func (oe *otlpExporter) exportSpans(ticks <-chan time.Time) {
+	var batch []*trace.SpanData
+	for {
+		select {
+		case s := <-oe.spans:
+			batch = append(batch, s)
+			if len(batch) < spanBatchSize {
+				continue
+			}
+		case <-ticks:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		oe.exportBatch(batch)
+		batch = nil
+	}
+}
+
+func (oe *otlpExporter) exportBatch(batch []*trace.SpanData) {
+	request := encodeTraceRequest(oe.config.ResourceAttributes, scopeName, version.Version(), batch)
+	ctx, cancel := context.WithTimeout(context.Background(), oe.config.TimeoutDuration)
+	defer cancel()
+	if err := oe.tracesClient.export(ctx, request); err != nil {
+		glog.Errorf("Failed to export %d spans to OTLP endpoint %q: %v", len(batch), oe.config.TracesEndpoint, err)
+		exporters.RecordFailure("otlp", "traces")
+	}
+}
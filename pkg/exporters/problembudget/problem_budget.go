@@ -0,0 +1,297 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package problembudget limits the number of transitions of each condition type whose
+// events are exported per day, to protect on-call from flapping hardware. Conditions are
+// always exported, so that the node conditions stay accurate. Beyond the budget, the
+// events reported with the transitions of the condition are collapsed into a periodic
+// summary event.
+package problembudget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+const (
+	// budgetWindow is the period transitions are counted over.
+	budgetWindow = 24 * time.Hour
+	// defaultSummaryPeriod is the default period of the summary events.
+	defaultSummaryPeriod = time.Hour
+	// SummaryReason is the reason of the summary events.
+	SummaryReason = "ProblemBudgetExceeded"
+)
+
+// Budget is the budget of some condition types.
+type Budget struct {
+	// Conditions are the condition types the budget applies to. Each condition type has
+	// its own budget.
+	Conditions []string `json:"conditions"`
+	// MaxTransitionsPerDay is the number of transitions of each condition type whose events
+	// are exported in the last 24 hours.
+	MaxTransitionsPerDay int `json:"maxTransitionsPerDay"`
+}
+
+// Config is the configuration of the problem budgets.
+type Config struct {
+	// Budgets are the budgets of condition types.
+	Budgets []*Budget `json:"budgets"`
+	// DefaultMaxTransitionsPerDay is the budget of the condition types not in any budget.
+	// Default to 0, which means unlimited.
+	DefaultMaxTransitionsPerDay int `json:"defaultMaxTransitionsPerDay"`
+	// SummaryPeriodString is the period at which suppressed events are summarized.
+	// Default to 1h.
+	SummaryPeriodString string        `json:"summaryPeriod"`
+	SummaryPeriod       time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() error {
+	c.SummaryPeriod = defaultSummaryPeriod
+	if c.SummaryPeriodString != "" {
+		var err error
+		if c.SummaryPeriod, err = time.ParseDuration(c.SummaryPeriodString); err != nil {
+			return fmt.Errorf("invalid summary period %q: %v", c.SummaryPeriodString, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *Config) Validate() error {
+	if c.SummaryPeriod <= 0 {
+		return fmt.Errorf("summary period %v must be positive", c.SummaryPeriod)
+	}
+	if c.DefaultMaxTransitionsPerDay < 0 {
+		return fmt.Errorf("default max transitions per day %d must not be negative", c.DefaultMaxTransitionsPerDay)
+	}
+	budgeted := map[string]bool{}
+	for _, budget := range c.Budgets {
+		if budget.MaxTransitionsPerDay <= 0 {
+			return fmt.Errorf("max transitions per day %d of conditions %v must be positive", budget.MaxTransitionsPerDay, budget.Conditions)
+		}
+		for _, condition := range budget.Conditions {
+			if budgeted[condition] {
+				return fmt.Errorf("condition %q is in more than one budget", condition)
+			}
+			budgeted[condition] = true
+		}
+	}
+	return nil
+}
+
+// LoadConfig loads the problem budget config from a file.
+func LoadConfig(configPath string) (*Config, error) {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	var config Config
+	if err := util.UnmarshalStrict(f, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return nil, fmt.Errorf("failed to apply configuration file %q: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", configPath, err)
+	}
+	return &config, nil
+}
+
+// WrapExporters limits all exporters in the list by the budgets. Each exporter counts
+// the transitions on its own.
+func WrapExporters(exporters []types.Exporter, config *Config) []types.Exporter {
+	wrapped := make([]types.Exporter, 0, len(exporters))
+	for _, exporter := range exporters {
+		wrapped = append(wrapped, NewExporter(exporter, config))
+	}
+	return wrapped
+}
+
+type key struct {
+	source    string
+	condition string
+}
+
+// state is the state of the budget of a condition type of a source.
+type state struct {
+	status types.ConditionStatus
+	// transitions are the times of the transitions in the last 24 hours.
+	transitions []time.Time
+	// suppressed is the number of events suppressed since the last summary.
+	suppressed int
+	// since is the time the first event was suppressed since the last summary.
+	since time.Time
+}
+
+// budgetedExporter is not thread-safe, the problem detector exports the problems one
+// at a time.
+type budgetedExporter struct {
+	exporter types.Exporter
+	config   *Config
+	clock    clock.Clock
+	// budgets is the budget of each condition type in a budget.
+	budgets map[string]int
+	states  map[key]*state
+	// lastSummary is the last time suppressed events were summarized.
+	lastSummary time.Time
+}
+
+// NewExporter limits the exporter by the budgets.
+func NewExporter(exporter types.Exporter, config *Config) types.Exporter {
+	return newExporter(exporter, config, clock.RealClock{})
+}
+
+func newExporter(exporter types.Exporter, config *Config, clock clock.Clock) *budgetedExporter {
+	be := &budgetedExporter{
+		exporter:    exporter,
+		config:      config,
+		clock:       clock,
+		budgets:     make(map[string]int),
+		states:      make(map[key]*state),
+		lastSummary: clock.Now(),
+	}
+	for _, budget := range config.Budgets {
+		for _, condition := range budget.Conditions {
+			be.budgets[condition] = budget.MaxTransitionsPerDay
+		}
+	}
+	return be
+}
+
+// ExportProblems exports the conditions, and the events unless the status carries a
+// transition of a condition over its budget.
+func (be *budgetedExporter) ExportProblems(status *types.Status) {
+	now := be.clock.Now()
+	var exceeded []*state
+	for _, condition := range status.Conditions {
+		s := be.state(key{source: status.Source, condition: condition.Type})
+		if !s.update(condition.Status) {
+			continue
+		}
+		s.transitions = append(s.transitions, now)
+		if budget := be.budget(condition.Type); budget > 0 && len(s.transitions) > budget {
+			exceeded = append(exceeded, s)
+		}
+	}
+	if len(exceeded) > 0 && len(status.Events) > 0 {
+		glog.V(3).Infof("Suppressing %d events of %s, the conditions are over their budget", len(status.Events), status.Source)
+		for _, s := range exceeded {
+			if s.suppressed == 0 {
+				s.since = now
+			}
+			s.suppressed += len(status.Events)
+		}
+		status = &types.Status{Source: status.Source, Conditions: status.Conditions}
+	}
+	be.exporter.ExportProblems(status)
+	be.summarize()
+}
+
+// SyncProblems syncs the status as is, and summarizes the suppressed events when the
+// summary period has passed.
+func (be *budgetedExporter) SyncProblems(status *types.Status) {
+	be.exporter.SyncProblems(status)
+	be.summarize()
+}
+
+// update records the status of the condition, and returns whether it is a transition.
+// The first status of a condition is a transition only when it is true.
+func (s *state) update(status types.ConditionStatus) bool {
+	last := s.status
+	s.status = status
+	if last == "" {
+		return status == types.True
+	}
+	return last != status
+}
+
+func (be *budgetedExporter) budget(condition string) int {
+	if budget, ok := be.budgets[condition]; ok {
+		return budget
+	}
+	return be.config.DefaultMaxTransitionsPerDay
+}
+
+func (be *budgetedExporter) state(k key) *state {
+	s, ok := be.states[k]
+	if !ok {
+		s = &state{}
+		be.states[k] = s
+	}
+	s.transitions = after(s.transitions, be.clock.Now().Add(-budgetWindow))
+	return s
+}
+
+func after(times []time.Time, start time.Time) []time.Time {
+	var kept []time.Time
+	for _, t := range times {
+		if t.After(start) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// summarize exports a summary event of each source with suppressed events when the
+// summary period has passed.
+func (be *budgetedExporter) summarize() {
+	now := be.clock.Now()
+	if now.Sub(be.lastSummary) < be.config.SummaryPeriod {
+		return
+	}
+	be.lastSummary = now
+
+	summaries := map[string][]string{}
+	for k, s := range be.states {
+		if s.suppressed == 0 {
+			continue
+		}
+		s.transitions = after(s.transitions, now.Add(-budgetWindow))
+		summaries[k.source] = append(summaries[k.source], fmt.Sprintf(
+			"%s transitioned %d times in the last 24h over its budget of %d, %d events suppressed since %s",
+			k.condition, len(s.transitions), be.budget(k.condition), s.suppressed, s.since.Format(time.RFC3339)))
+		s.suppressed = 0
+	}
+	var sources []string
+	for source := range summaries {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		sort.Strings(summaries[source])
+		be.exporter.ExportProblems(&types.Status{
+			Source: source,
+			Events: []types.Event{{
+				Severity:  types.Warn,
+				Timestamp: now,
+				Reason:    SummaryReason,
+				Message:   strings.Join(summaries[source], "; "),
+			}},
+		})
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problembudget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/exporters/memoryexporter"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestValidate(t *testing.T) {
+	for desc, test := range map[string]struct {
+		config Config
+		valid  bool
+	}{
+		"valid": {
+			config: Config{Budgets: []*Budget{{Conditions: []string{"KernelDeadlock"}, MaxTransitionsPerDay: 10}}},
+			valid:  true,
+		},
+		"non-positive budget": {
+			config: Config{Budgets: []*Budget{{Conditions: []string{"KernelDeadlock"}}}},
+		},
+		"negative default budget": {
+			config: Config{DefaultMaxTransitionsPerDay: -1},
+		},
+		"condition in more than one budget": {
+			config: Config{Budgets: []*Budget{
+				{Conditions: []string{"KernelDeadlock"}, MaxTransitionsPerDay: 10},
+				{Conditions: []string{"KernelDeadlock"}, MaxTransitionsPerDay: 5},
+			}},
+		},
+		"invalid summary period": {
+			config: Config{SummaryPeriodString: "-1h"},
+		},
+	} {
+		err := test.config.ApplyConfiguration()
+		if err == nil {
+			err = test.config.Validate()
+		}
+		assert.Equal(t, test.valid, err == nil, desc)
+	}
+}
+
+func TestExportProblems(t *testing.T) {
+	config := &Config{
+		Budgets:             []*Budget{{Conditions: []string{"KernelDeadlock"}, MaxTransitionsPerDay: 2}},
+		SummaryPeriodString: "1h",
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	fakeClock := clock.NewFakeClock(time.Now())
+	fake := memoryexporter.NewExporter()
+	exporter := newExporter(fake, config, fakeClock)
+
+	status := func(conditionStatus types.ConditionStatus) *types.Status {
+		return &types.Status{
+			Source:     "kernel-monitor",
+			Events:     []types.Event{{Severity: types.Warn, Reason: "DockerHung"}},
+			Conditions: []types.Condition{{Type: "KernelDeadlock", Status: conditionStatus}},
+		}
+	}
+
+	// The initial false condition is not a transition.
+	exporter.ExportProblems(status(types.False))
+	// 2 transitions are in the budget.
+	exporter.ExportProblems(status(types.True))
+	exporter.ExportProblems(status(types.False))
+	assert.Len(t, fake.Events("kernel-monitor"), 3)
+
+	// Events of the transitions over the budget are suppressed, the conditions are
+	// exported.
+	exporter.ExportProblems(status(types.True))
+	exporter.ExportProblems(status(types.False))
+	assert.Len(t, fake.Events("kernel-monitor"), 3)
+	condition, _ := fake.Condition("kernel-monitor", "KernelDeadlock")
+	assert.Equal(t, types.False, condition.Status)
+
+	// Events without transitions are not limited.
+	exporter.ExportProblems(status(types.False))
+	assert.Len(t, fake.Events("kernel-monitor"), 4)
+
+	// The suppressed events are summarized after the summary period.
+	fakeClock.Step(time.Hour)
+	exporter.SyncProblems(&types.Status{Source: "kernel-monitor"})
+	events := fake.Events("kernel-monitor")
+	assert.Len(t, events, 5)
+	assert.Equal(t, SummaryReason, events[4].Reason)
+	assert.Contains(t, events[4].Message, "KernelDeadlock transitioned 4 times in the last 24h over its budget of 2, 2 events suppressed")
+
+	// Nothing is summarized when no event is suppressed.
+	fakeClock.Step(time.Hour)
+	exporter.SyncProblems(&types.Status{Source: "kernel-monitor"})
+	assert.Len(t, fake.Events("kernel-monitor"), 5)
+
+	// The budget is available again after a day.
+	fakeClock.Step(24 * time.Hour)
+	exporter.ExportProblems(status(types.True))
+	assert.Len(t, fake.Events("kernel-monitor"), 6)
+}
+
+func TestUnlimitedConditions(t *testing.T) {
+	config := &Config{}
+	assert.NoError(t, config.ApplyConfiguration())
+	fake := memoryexporter.NewExporter()
+	exporter := newExporter(fake, config, clock.NewFakeClock(time.Now()))
+	for i := 0; i < 10; i++ {
+		conditionStatus := types.True
+		if i%2 == 1 {
+			conditionStatus = types.False
+		}
+		exporter.ExportProblems(&types.Status{
+			Source:     "kernel-monitor",
+			Events:     []types.Event{{Reason: "DockerHung"}},
+			Conditions: []types.Condition{{Type: "KernelDeadlock", Status: conditionStatus}},
+		})
+	}
+	assert.Len(t, fake.Events("kernel-monitor"), 10)
+}
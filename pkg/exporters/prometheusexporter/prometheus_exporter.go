@@ -27,6 +27,7 @@ import (
 
 	"k8s.io/node-problem-detector/cmd/options"
 	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/serving"
 )
 
 type prometheusExporter struct{}
@@ -45,7 +46,7 @@ func NewExporterOrDie(npdo *options.NodeProblemDetectorOptions) types.Exporter {
 	go func() {
 		mux := http.NewServeMux()
 		mux.Handle("/metrics", pe)
-		if err := http.ListenAndServe(addr, mux); err != nil {
+		if err := serving.ListenAndServe(addr, mux, npdo.Serving); err != nil {
 			glog.Fatalf("Failed to start Prometheus scrape endpoint: %v", err)
 		}
 	}()
@@ -58,3 +59,9 @@ func NewExporterOrDie(npdo *options.NodeProblemDetectorOptions) types.Exporter {
 func (pe *prometheusExporter) ExportProblems(status *types.Status) {
 	return
 }
+
+// SyncProblems does nothing.
+// Prometheus exporter only exports metrics.
+func (pe *prometheusExporter) SyncProblems(status *types.Status) {
+	return
+}
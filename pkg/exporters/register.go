@@ -19,15 +19,38 @@ package exporters
 import (
 	"fmt"
 
+	"github.com/golang/glog"
+
 	"k8s.io/node-problem-detector/pkg/types"
 )
 
+// APIVersion is the version of the exporter API, see the package documentation for the
+// compatibility guarantees.
+const APIVersion = "v1"
+
 var (
 	handlers = make(map[types.ExporterType]types.ExporterHandler)
+	// dryRun is whether node problem detector runs in dry run mode.
+	dryRun bool
 )
 
+// SetDryRun sets whether node problem detector runs in dry run mode. It is set before the
+// exporters are created.
+func SetDryRun(enabled bool) {
+	dryRun = enabled
+}
+
+// DryRun returns whether node problem detector runs in dry run mode, in which exporters
+// must not write to Kubernetes.
+func DryRun() bool {
+	return dryRun
+}
+
 // Register registers a exporter factory method, which will be used to create the exporter.
 func Register(exporterType types.ExporterType, handler types.ExporterHandler) {
+	if _, ok := handlers[exporterType]; ok {
+		glog.Warningf("Exporter %s is registered twice, the last registration is used", exporterType)
+	}
 	handlers[exporterType] = handler
 }
 
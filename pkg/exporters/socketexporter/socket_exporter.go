@@ -0,0 +1,371 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package socketexporter streams the problems as newline delimited JSON over a Unix
+// domain socket to local consumers, e.g. a node-local remediation agent.
+package socketexporter
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/cmd/options"
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	// exportKind marks the records of problem changes.
+	exportKind = "export"
+	// syncKind marks the records of the full state of a problem daemon.
+	syncKind = "sync"
+	// droppedKind marks the records telling how many records a slow consumer missed. They
+	// are followed by the full state of all problem daemons.
+	droppedKind = "dropped"
+
+	// clientBufferSize is the number of records waiting to be written to a consumer,
+	// beyond which the consumer misses records until it catches up.
+	clientBufferSize = 1000
+	// writeTimeout is the time a consumer has to read a record, after which it is
+	// disconnected.
+	writeTimeout = 10 * time.Second
+)
+
+// record is a line of the feed. The problems are written with the stable schema, so that
+// the consumers do not depend on the internal types.
+type record struct {
+	// Time is when the record was written.
+	Time time.Time `json:"time"`
+	// Kind is "export" for problem changes, "sync" for the full state of a problem
+	// daemon, or "dropped" for the number of records missed.
+	Kind    string                  `json:"kind"`
+	Report  *npdapiv1.ProblemReport `json:"report,omitempty"`
+	Dropped int                     `json:"dropped,omitempty"`
+}
+
+// client is a connected consumer.
+type client struct {
+	conn  net.Conn
+	lines chan []byte
+	// dropped is the number of records missed since the queue was full. The records are
+	// not queued again until the consumer is sent the full state. Guarded by the mutex of
+	// the exporter.
+	dropped int
+	// resync wakes up the writer of a client which missed records, once its queue is
+	// drained.
+	resync chan struct{}
+	// closed is closed when the consumer disconnects.
+	closed chan struct{}
+}
+
+type socketExporter struct {
+	// Mutex protects clients and conditions, so that a consumer connecting is sent the
+	// full state followed by all later records.
+	sync.Mutex
+	listener net.Listener
+	node     string
+	clients  map[*client]bool
+	// conditions are the latest conditions of each problem daemon, by source and type.
+	conditions map[string]map[string]types.Condition
+	now        func() time.Time
+	// stopping is closed on stop, after which no record is queued. writers waits for the
+	// writers to write the records queued before.
+	stopping chan struct{}
+	writers  sync.WaitGroup
+}
+
+// NewExporterOrDie creates the exporter streaming problems over the problem socket, panics
+// if error occurs. It returns nil when the problem socket is not set.
+func NewExporterOrDie(npdo *options.NodeProblemDetectorOptions) types.Exporter {
+	if npdo.ProblemSocket == "" {
+		return nil
+	}
+	// Remove the socket left by the last run.
+	if err := os.Remove(npdo.ProblemSocket); err != nil && !os.IsNotExist(err) {
+		glog.Fatalf("Failed to remove problem socket %q: %v", npdo.ProblemSocket, err)
+	}
+	listener, err := net.Listen("unix", npdo.ProblemSocket)
+	if err != nil {
+		glog.Fatalf("Failed to listen on problem socket %q: %v", npdo.ProblemSocket, err)
+	}
+	// The problems may reveal the state of the node, only root may consume them.
+	if err := os.Chmod(npdo.ProblemSocket, 0600); err != nil {
+		glog.Fatalf("Failed to restrict problem socket %q: %v", npdo.ProblemSocket, err)
+	}
+	se := newSocketExporter(listener, npdo.NodeName)
+	go se.serve()
+	return se
+}
+
+func newSocketExporter(listener net.Listener, node string) *socketExporter {
+	return &socketExporter{
+		listener:   listener,
+		node:       node,
+		clients:    make(map[*client]bool),
+		conditions: make(map[string]map[string]types.Condition),
+		now:        time.Now,
+		stopping:   make(chan struct{}),
+	}
+}
+
+// Stop stops accepting consumers, and disconnects the consumers once the records queued
+// to them are written.
+func (se *socketExporter) Stop() {
+	se.Lock()
+	select {
+	case <-se.stopping:
+	default:
+		close(se.stopping)
+		se.listener.Close()
+	}
+	se.Unlock()
+	se.writers.Wait()
+}
+
+// stopped returns whether the exporter is stopped. It must be called with the mutex held.
+func (se *socketExporter) stopped() bool {
+	select {
+	case <-se.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// serve accepts consumers until the listener is closed. Each consumer is sent the full
+// state of all problem daemons first, so that consumers reconnecting resync.
+func (se *socketExporter) serve() {
+	for {
+		conn, err := se.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			glog.Infof("Problem socket closed: %v", err)
+			return
+		}
+		c := &client{
+			conn:   conn,
+			lines:  make(chan []byte, clientBufferSize),
+			resync: make(chan struct{}, 1),
+			closed: make(chan struct{}),
+		}
+		se.Lock()
+		if se.stopped() {
+			se.Unlock()
+			conn.Close()
+			return
+		}
+		for _, line := range se.snapshot() {
+			c.lines <- line
+		}
+		se.clients[c] = true
+		se.writers.Add(1)
+		se.Unlock()
+		glog.V(2).Infof("Problem socket consumer connected")
+		go se.watch(c)
+		go se.write(c)
+	}
+}
+
+// ExportProblems streams the problem changes.
+func (se *socketExporter) ExportProblems(status *types.Status) {
+	se.Lock()
+	defer se.Unlock()
+	conditions := se.sourceConditions(status.Source)
+	for _, condition := range status.Conditions {
+		conditions[condition.Type] = condition
+	}
+	se.broadcast(exportKind, status)
+}
+
+// SyncProblems streams the full state of the problem daemon.
+func (se *socketExporter) SyncProblems(status *types.Status) {
+	se.Lock()
+	defer se.Unlock()
+	conditions := make(map[string]types.Condition)
+	for _, condition := range status.Conditions {
+		conditions[condition.Type] = condition
+	}
+	se.conditions[status.Source] = conditions
+	se.broadcast(syncKind, status)
+}
+
+func (se *socketExporter) sourceConditions(source string) map[string]types.Condition {
+	conditions, ok := se.conditions[source]
+	if !ok {
+		conditions = make(map[string]types.Condition)
+		se.conditions[source] = conditions
+	}
+	return conditions
+}
+
+// broadcast queues the record to every consumer. The problem daemons are never blocked by
+// a slow consumer: when its queue is full, it misses the records until it is sent the full
+// state again.
+func (se *socketExporter) broadcast(kind string, status *types.Status) {
+	if se.stopped() {
+		return
+	}
+	line, err := se.encode(record{Kind: kind, Report: npdapiv1.NewProblemReport(se.node, status)})
+	if err != nil {
+		glog.Errorf("Failed to encode problems of %q: %v", status.Source, err)
+		exporters.RecordFailure("problem-socket", "problems")
+		return
+	}
+	for c := range se.clients {
+		if c.dropped > 0 {
+			c.dropped++
+			continue
+		}
+		select {
+		case c.lines <- line:
+		default:
+			c.dropped = 1
+			exporters.RecordFailure("problem-socket", "problems")
+			select {
+			case c.resync <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// snapshot returns the records of the full state of all problem daemons.
+func (se *socketExporter) snapshot() [][]byte {
+	var sources []string
+	for source := range se.conditions {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	var lines [][]byte
+	for _, source := range sources {
+		status := &types.Status{Source: source}
+		var conditionTypes []string
+		for t := range se.conditions[source] {
+			conditionTypes = append(conditionTypes, t)
+		}
+		sort.Strings(conditionTypes)
+		for _, t := range conditionTypes {
+			status.Conditions = append(status.Conditions, se.conditions[source][t])
+		}
+		line, err := se.encode(record{Kind: syncKind, Report: npdapiv1.NewProblemReport(se.node, status)})
+		if err != nil {
+			glog.Errorf("Failed to encode problems of %q: %v", source, err)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (se *socketExporter) encode(r record) ([]byte, error) {
+	r.Time = se.now()
+	line, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// write writes the queued records to the consumer until it disconnects or is too slow to
+// read a record. Once a consumer which missed records drained its queue, it is sent the
+// number of records missed and the full state.
+func (se *socketExporter) write(c *client) {
+	defer se.writers.Done()
+	defer se.disconnect(c)
+	for {
+		select {
+		case line := <-c.lines:
+			if !se.send(c, line) {
+				return
+			}
+		case <-c.closed:
+			glog.V(2).Infof("Problem socket consumer disconnected")
+			return
+		case <-se.stopping:
+			// No record is queued after stopping, the queue is drained before
+			// disconnecting.
+			for {
+				select {
+				case line := <-c.lines:
+					if !se.send(c, line) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case <-c.resync:
+			// Records queued before the queue was full are sent first.
+			for drained := false; !drained; {
+				select {
+				case line := <-c.lines:
+					if !se.send(c, line) {
+						return
+					}
+				default:
+					drained = true
+				}
+			}
+			se.Lock()
+			lines := se.snapshot()
+			if line, err := se.encode(record{Kind: droppedKind, Dropped: c.dropped}); err == nil {
+				lines = append([][]byte{line}, lines...)
+			}
+			c.dropped = 0
+			se.Unlock()
+			for _, line := range lines {
+				if !se.send(c, line) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// watch discards what the consumer writes, and tells the writer when the consumer
+// disconnects, so that idle consumers are not kept until the next record.
+func (se *socketExporter) watch(c *client) {
+	io.Copy(ioutil.Discard, c.conn)
+	close(c.closed)
+}
+
+func (se *socketExporter) send(c *client, line []byte) bool {
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(line); err != nil {
+		glog.V(2).Infof("Problem socket consumer disconnected: %v", err)
+		return false
+	}
+	return true
+}
+
+func (se *socketExporter) disconnect(c *client) {
+	se.Lock()
+	defer se.Unlock()
+	delete(se.clients, c)
+	c.conn.Close()
+}
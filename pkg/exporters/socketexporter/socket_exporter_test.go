@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package socketexporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func newTestExporter(t *testing.T) (*socketExporter, string, func()) {
+	dir, err := ioutil.TempDir("", "problem-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "problems.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := newSocketExporter(listener, "test-node")
+	go se.serve()
+	return se, path, func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// connect connects a consumer, and returns the function reading its next record.
+func connect(t *testing.T, path string) (net.Conn, func() record) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	return conn, func() record {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r record
+		if err := json.Unmarshal(line, &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+}
+
+// waitForClients waits until the exporter has the number of consumers.
+func waitForClients(t *testing.T, se *socketExporter, n int) {
+	assert.Eventually(t, func() bool {
+		se.Lock()
+		defer se.Unlock()
+		return len(se.clients) == n
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStreamProblems(t *testing.T) {
+	se, path, cleanup := newTestExporter(t)
+	defer cleanup()
+
+	se.SyncProblems(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{
+		{Type: "KernelDeadlock", Status: types.False},
+		{Type: "ReadonlyFilesystem", Status: types.False},
+	}})
+	se.ExportProblems(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{
+		{Type: "KernelDeadlock", Status: types.True, Reason: "DockerHung"},
+	}})
+
+	// A consumer is sent the full state on connect.
+	conn, read := connect(t, path)
+	r := read()
+	assert.Equal(t, syncKind, r.Kind)
+	assert.Equal(t, []types.Condition{
+		{Type: "KernelDeadlock", Status: types.True, Reason: "DockerHung"},
+		{Type: "ReadonlyFilesystem", Status: types.False},
+	}, r.Report.ToStatus().Conditions)
+	assert.Equal(t, npdapiv1.APIVersion, r.Report.APIVersion)
+	assert.Equal(t, "test-node", r.Report.Node)
+
+	waitForClients(t, se, 1)
+	se.ExportProblems(&types.Status{Source: "kernel-monitor", Events: []types.Event{{Reason: "OOMKilling", Severity: types.Warn}}})
+	r = read()
+	assert.Equal(t, exportKind, r.Kind)
+	assert.Equal(t, "OOMKilling", r.Report.Events[0].Reason)
+
+	// A consumer reconnecting resyncs.
+	conn.Close()
+	waitForClients(t, se, 0)
+	conn, read = connect(t, path)
+	defer conn.Close()
+	r = read()
+	assert.Equal(t, syncKind, r.Kind)
+	assert.Len(t, r.Report.Conditions, 2)
+}
+
+func TestSlowConsumer(t *testing.T) {
+	se, path, cleanup := newTestExporter(t)
+	defer cleanup()
+	se.SyncProblems(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{{Type: "KernelDeadlock", Status: types.False}}})
+
+	conn, read := connect(t, path)
+	defer conn.Close()
+	waitForClients(t, se, 1)
+	assert.Equal(t, syncKind, read().Kind)
+
+	// The consumer does not read, the problems are never blocked.
+	events := 5 * clientBufferSize
+	for i := 0; i < events; i++ {
+		se.ExportProblems(&types.Status{Source: "kernel-monitor", Events: []types.Event{{Reason: "OOMKilling", Message: "Killed process"}}})
+	}
+	exported := 0
+	for {
+		r := read()
+		if r.Kind == exportKind {
+			exported++
+			continue
+		}
+		// The missed records are followed by the full state.
+		assert.Equal(t, droppedKind, r.Kind)
+		assert.Equal(t, events, exported+r.Dropped)
+		assert.Equal(t, syncKind, read().Kind)
+		break
+	}
+
+	// The consumer caught up.
+	se.ExportProblems(&types.Status{Source: "kernel-monitor", Events: []types.Event{{Reason: "TaskHung"}}})
+	r := read()
+	assert.Equal(t, exportKind, r.Kind)
+	assert.Equal(t, "TaskHung", r.Report.Events[0].Reason)
+}
+
+func TestStop(t *testing.T) {
+	se, path, cleanup := newTestExporter(t)
+	defer cleanup()
+
+	conn, read := connect(t, path)
+	defer conn.Close()
+	waitForClients(t, se, 1)
+	se.ExportProblems(&types.Status{Source: "kernel-monitor", Events: []types.Event{{Reason: "OOMKilling"}}})
+	se.Stop()
+
+	// The records queued before stopping are written, the consumer is then disconnected.
+	assert.Equal(t, "OOMKilling", read().Report.Events[0].Reason)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := bufio.NewReader(conn).ReadByte()
+	assert.Equal(t, io.EOF, err)
+	waitForClients(t, se, 0)
+
+	// Nothing is exported after stopping.
+	se.ExportProblems(&types.Status{Source: "kernel-monitor", Events: []types.Event{{Reason: "TaskHung"}}})
+	_, err = net.Dial("unix", path)
+	assert.Error(t, err)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package config
 
 import (
+	"fmt"
 	"time"
 
 	"k8s.io/node-problem-detector/pkg/exporters/stackdriver/gce"
@@ -37,6 +38,24 @@ type StackdriverExporterConfig struct {
 	MetadataFetchInterval       string       `json:"metadataFetchInterval"`
 	PanicOnMetadataFetchFailure bool         `json:"panicOnMetadataFetchFailure"`
 	CustomMetricPrefix          string       `json:"customMetricPrefix"`
+	// MetricsProjectID is the project metrics are written to. Default to the GCE metadata project.
+	MetricsProjectID string `json:"metricsProjectID"`
+	// Labels are static labels added to all metrics, in addition to instance_name.
+	// {projectID}, {zone}, {instanceID} and {instanceName} are replaced by the GCE metadata.
+	Labels map[string]string `json:"labels"`
+	// MetadataLabels are labels added to all metrics, whose values are read from the given
+	// paths of the GCE metadata server, e.g. instance/attributes/fleet.
+	MetadataLabels map[string]string `json:"metadataLabels"`
+	// MonitoredResource is the monitored resource metrics are written against. Default to
+	// the gce_instance of the GCE metadata.
+	MonitoredResource *MonitoredResource `json:"monitoredResource"`
+}
+
+// MonitoredResource is a monitored resource type and its labels. Placeholders in the label
+// values are replaced the same way as in StackdriverExporterConfig.Labels.
+type MonitoredResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
 }
 
 // ApplyConfiguration applies default configurations.
@@ -54,3 +73,19 @@ func (sec *StackdriverExporterConfig) ApplyConfiguration() {
 		sec.APIEndpoint = defaultEndpoint
 	}
 }
+
+// Validate verifies whether the settings are valid.
+func (sec *StackdriverExporterConfig) Validate() error {
+	for name := range sec.MetadataLabels {
+		if _, ok := sec.Labels[name]; ok {
+			return fmt.Errorf("label %q is both a static and a metadata label", name)
+		}
+		if sec.MetadataLabels[name] == "" {
+			return fmt.Errorf("metadata label %q has no metadata path", name)
+		}
+	}
+	if sec.MonitoredResource != nil && sec.MonitoredResource.Type == "" {
+		return fmt.Errorf("monitored resource type is empty")
+	}
+	return nil
+}
@@ -105,3 +105,58 @@ func TestApplyConfiguration(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    StackdriverExporterConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: StackdriverExporterConfig{},
+		},
+		{
+			name: "labels and monitored resource",
+			config: StackdriverExporterConfig{
+				Labels:            map[string]string{"zone": "{zone}"},
+				MetadataLabels:    map[string]string{"fleet": "instance/attributes/fleet"},
+				MonitoredResource: &MonitoredResource{Type: "generic_node", Labels: map[string]string{"node_id": "{instanceName}"}},
+			},
+		},
+		{
+			name: "label both static and from metadata",
+			config: StackdriverExporterConfig{
+				Labels:         map[string]string{"fleet": "a"},
+				MetadataLabels: map[string]string{"fleet": "instance/attributes/fleet"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "metadata label without path",
+			config: StackdriverExporterConfig{
+				MetadataLabels: map[string]string{"fleet": ""},
+			},
+			expectErr: true,
+		},
+		{
+			name: "monitored resource without type",
+			config: StackdriverExporterConfig{
+				MonitoredResource: &MonitoredResource{Labels: map[string]string{"node_id": "a"}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package gce
 
 import (
+	"strings"
+
 	"cloud.google.com/go/compute/metadata"
 	"github.com/golang/glog"
 )
@@ -35,6 +37,21 @@ func (md *Metadata) HasMissingField() bool {
 	return false
 }
 
+// Expand replaces {projectID}, {zone}, {instanceID} and {instanceName} in s by the metadata.
+func (md *Metadata) Expand(s string) string {
+	return strings.NewReplacer(
+		"{projectID}", md.ProjectID,
+		"{zone}", md.Zone,
+		"{instanceID}", md.InstanceID,
+		"{instanceName}", md.InstanceName,
+	).Replace(s)
+}
+
+// Get returns the value at the path of the GCE metadata server, e.g. instance/attributes/fleet.
+func Get(path string) (string, error) {
+	return metadata.Get(path)
+}
+
 func (md *Metadata) PopulateFromGCE() error {
 	var err error
 	glog.Info("Fetching GCE metadata from metadata server")
@@ -17,7 +17,7 @@ limitations under the License.
 package stackdriverexporter
 
 import (
-	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
@@ -33,7 +33,9 @@ import (
 	"github.com/avast/retry-go"
 	"k8s.io/node-problem-detector/pkg/exporters"
 	seconfig "k8s.io/node-problem-detector/pkg/exporters/stackdriver/config"
+	"k8s.io/node-problem-detector/pkg/exporters/stackdriver/gce"
 	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
 	"k8s.io/node-problem-detector/pkg/util/metrics"
 )
 
@@ -92,22 +94,71 @@ func getMetricTypeConversionFunction(customMetricPrefix string) func(*view.View)
 
 type stackdriverExporter struct {
 	config seconfig.StackdriverExporterConfig
+	// metadataLabels are the values of the metadata labels fetched from the metadata server.
+	metadataLabels map[string]string
+}
+
+// customMonitoredResource is a monitored resource from the config.
+type customMonitoredResource struct {
+	resType string
+	labels  map[string]string
+}
+
+func (r *customMonitoredResource) MonitoredResource() (string, map[string]string) {
+	return r.resType, r.labels
+}
+
+// monitoringLabels returns the labels added to all metrics.
+func (se *stackdriverExporter) monitoringLabels() map[string]string {
+	labels := map[string]string{"instance_name": se.config.GCEMetadata.InstanceName}
+	for name, value := range se.config.Labels {
+		labels[name] = se.config.GCEMetadata.Expand(value)
+	}
+	for name, value := range se.metadataLabels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// monitoredResource returns the monitored resource metrics are written against.
+func (se *stackdriverExporter) monitoredResource() monitoredres.Interface {
+	if se.config.MonitoredResource == nil {
+		return &monitoredres.GCEInstance{
+			ProjectID:  se.config.GCEMetadata.ProjectID,
+			InstanceID: se.config.GCEMetadata.InstanceID,
+			Zone:       se.config.GCEMetadata.Zone,
+		}
+	}
+	labels := make(map[string]string)
+	for name, value := range se.config.MonitoredResource.Labels {
+		labels[name] = se.config.GCEMetadata.Expand(value)
+	}
+	return &customMonitoredResource{resType: se.config.MonitoredResource.Type, labels: labels}
+}
+
+func (se *stackdriverExporter) projectID() string {
+	if se.config.MetricsProjectID != "" {
+		return se.config.MetricsProjectID
+	}
+	return se.config.GCEMetadata.ProjectID
 }
 
 func (se *stackdriverExporter) setupOpenCensusViewExporterOrDie() {
 	clientOption := option.WithEndpoint(se.config.APIEndpoint)
 
 	var globalLabels stackdriver.Labels
-	globalLabels.Set("instance_name", se.config.GCEMetadata.InstanceName, "The name of the VM instance")
+	for name, value := range se.monitoringLabels() {
+		description := "User-defined label"
+		if name == "instance_name" {
+			description = "The name of the VM instance"
+		}
+		globalLabels.Set(name, value, description)
+	}
 
 	viewExporter, err := stackdriver.NewExporter(stackdriver.Options{
-		ProjectID:               se.config.GCEMetadata.ProjectID,
+		ProjectID:               se.projectID(),
 		MonitoringClientOptions: []option.ClientOption{clientOption},
-		MonitoredResource: &monitoredres.GCEInstance{
-			ProjectID:  se.config.GCEMetadata.ProjectID,
-			InstanceID: se.config.GCEMetadata.InstanceID,
-			Zone:       se.config.GCEMetadata.Zone,
-		},
+		MonitoredResource:       se.monitoredResource(),
 		GetMetricType:           getMetricTypeConversionFunction(se.config.CustomMetricPrefix),
 		DefaultMonitoringLabels: &globalLabels,
 	})
@@ -120,8 +171,7 @@ func (se *stackdriverExporter) setupOpenCensusViewExporterOrDie() {
 		glog.Fatalf("Failed to parse ExportPeriod %q: %v", se.config.ExportPeriod, err)
 	}
 
-	view.SetReportingPeriod(exportPeriod)
-	view.RegisterExporter(viewExporter)
+	metrics.RegisterViewExporter(exporterName, viewExporter, exportPeriod)
 }
 
 func (se *stackdriverExporter) populateMetadataOrDie() {
@@ -156,12 +206,64 @@ func (se *stackdriverExporter) populateMetadataOrDie() {
 	}
 }
 
+// populateMetadataLabelsOrDie fetches the values of the metadata labels from the GCE
+// metadata server.
+func (se *stackdriverExporter) populateMetadataLabelsOrDie(fetch func(path string) (string, error)) {
+	if len(se.config.MetadataLabels) == 0 {
+		return
+	}
+
+	metadataFetchTimeout, err := time.ParseDuration(se.config.MetadataFetchTimeout)
+	if err != nil {
+		glog.Fatalf("Failed to parse MetadataFetchTimeout %q: %v", se.config.MetadataFetchTimeout, err)
+	}
+
+	metadataFetchInterval, err := time.ParseDuration(se.config.MetadataFetchInterval)
+	if err != nil {
+		glog.Fatalf("Failed to parse MetadataFetchInterval %q: %v", se.config.MetadataFetchInterval, err)
+	}
+
+	labels := make(map[string]string)
+	err = retry.Do(func() error {
+		for name, path := range se.config.MetadataLabels {
+			if _, ok := labels[name]; ok {
+				continue
+			}
+			value, err := fetch(path)
+			if err != nil {
+				return fmt.Errorf("failed to fetch metadata %q of label %q: %v", path, name, err)
+			}
+			labels[name] = value
+		}
+		return nil
+	},
+		retry.Delay(metadataFetchInterval),
+		retry.Attempts(uint(metadataFetchTimeout/metadataFetchInterval)),
+		retry.DelayType(retry.FixedDelay))
+	if err == nil {
+		glog.Infof("Using metadata labels: %v", labels)
+		se.metadataLabels = labels
+		return
+	}
+	if se.config.PanicOnMetadataFetchFailure {
+		glog.Fatalf("Failed to populate metadata labels: %v", err)
+	} else {
+		glog.Errorf("Failed to populate metadata labels, they are not added to metrics: %v", err)
+	}
+}
+
 // ExportProblems does nothing.
 // Stackdriver exporter only exports metrics.
 func (se *stackdriverExporter) ExportProblems(status *types.Status) {
 	return
 }
 
+// SyncProblems does nothing.
+// Stackdriver exporter only exports metrics.
+func (se *stackdriverExporter) SyncProblems(status *types.Status) {
+	return
+}
+
 type commandLineOptions struct {
 	configPath string
 }
@@ -188,15 +290,19 @@ func NewExporterOrDie(clo types.CommandLineOptions) types.Exporter {
 	if err != nil {
 		glog.Fatalf("Failed to read configuration file %q: %v", options.configPath, err)
 	}
-	err = json.Unmarshal(f, &se.config)
+	err = util.UnmarshalStrict(f, &se.config)
 	if err != nil {
 		glog.Fatalf("Failed to unmarshal configuration file %q: %v", options.configPath, err)
 	}
 	se.config.ApplyConfiguration()
+	if err := se.config.Validate(); err != nil {
+		glog.Fatalf("Failed to validate configuration file %q: %v", options.configPath, err)
+	}
 
 	glog.Infof("Starting Stackdriver exporter %s", options.configPath)
 
 	se.populateMetadataOrDie()
+	se.populateMetadataLabelsOrDie(gce.Get)
 	se.setupOpenCensusViewExporterOrDie()
 
 	return &se
@@ -1,3 +1,4 @@
+//go:build !disable_stackdriver_exporter
 // +build !disable_stackdriver_exporter
 
 /*
@@ -19,11 +20,15 @@ limitations under the License.
 package stackdriverexporter
 
 import (
+	"errors"
 	"testing"
 
+	monitoredres "contrib.go.opencensus.io/exporter/stackdriver/monitoredresource"
 	"github.com/stretchr/testify/assert"
 
 	"k8s.io/node-problem-detector/pkg/exporters"
+	seconfig "k8s.io/node-problem-detector/pkg/exporters/stackdriver/config"
+	"k8s.io/node-problem-detector/pkg/exporters/stackdriver/gce"
 )
 
 func TestRegistration(t *testing.T) {
@@ -31,3 +36,68 @@ func TestRegistration(t *testing.T) {
 		func() { exporters.GetExporterHandlerOrDie(exporterName) },
 		"Stackdriver exporter failed to register itself as an exporter.")
 }
+
+func TestLabelsAndMonitoredResource(t *testing.T) {
+	md := gce.Metadata{
+		ProjectID:    "some-gcp-project",
+		Zone:         "us-central1-a",
+		InstanceID:   "56781234",
+		InstanceName: "some-gce-instance",
+	}
+
+	se := &stackdriverExporter{config: seconfig.StackdriverExporterConfig{GCEMetadata: md}}
+	assert.Equal(t, map[string]string{"instance_name": "some-gce-instance"}, se.monitoringLabels())
+	assert.Equal(t, &monitoredres.GCEInstance{ProjectID: "some-gcp-project", InstanceID: "56781234", Zone: "us-central1-a"},
+		se.monitoredResource())
+	assert.Equal(t, "some-gcp-project", se.projectID())
+
+	se = &stackdriverExporter{
+		config: seconfig.StackdriverExporterConfig{
+			GCEMetadata:      md,
+			MetricsProjectID: "fleet-project",
+			Labels:           map[string]string{"zone": "{zone}", "team": "storage"},
+			MonitoredResource: &seconfig.MonitoredResource{
+				Type:   "generic_node",
+				Labels: map[string]string{"location": "{zone}", "namespace": "hybrid", "node_id": "{instanceName}"},
+			},
+		},
+		metadataLabels: map[string]string{"fleet": "blue"},
+	}
+	assert.Equal(t, map[string]string{
+		"instance_name": "some-gce-instance",
+		"zone":          "us-central1-a",
+		"team":          "storage",
+		"fleet":         "blue",
+	}, se.monitoringLabels())
+	resType, labels := se.monitoredResource().MonitoredResource()
+	assert.Equal(t, "generic_node", resType)
+	assert.Equal(t, map[string]string{"location": "us-central1-a", "namespace": "hybrid", "node_id": "some-gce-instance"}, labels)
+	assert.Equal(t, "fleet-project", se.projectID())
+}
+
+func TestPopulateMetadataLabels(t *testing.T) {
+	se := &stackdriverExporter{config: seconfig.StackdriverExporterConfig{
+		MetadataFetchTimeout:  "30ms",
+		MetadataFetchInterval: "10ms",
+		MetadataLabels:        map[string]string{"fleet": "instance/attributes/fleet"},
+	}}
+
+	// The metadata server fails once, then returns the value.
+	calls := 0
+	se.populateMetadataLabelsOrDie(func(path string) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errors.New("metadata server unavailable")
+		}
+		assert.Equal(t, "instance/attributes/fleet", path)
+		return "blue", nil
+	})
+	assert.Equal(t, map[string]string{"fleet": "blue"}, se.metadataLabels)
+
+	// Labels are dropped when the metadata server keeps failing.
+	se.metadataLabels = nil
+	se.populateMetadataLabelsOrDie(func(path string) (string, error) {
+		return "", errors.New("metadata server unavailable")
+	})
+	assert.Nil(t, se.metadataLabels)
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package suppression suppresses the problems of planned maintenance, e.g. kernel
+// upgrades or disk replacements, during maintenance windows, so that they do not flip
+// node conditions and page on-call. The suppressed problems are still counted in the
+// problem metrics, labeled as suppressed.
+package suppression
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+// defaultNodeLabelsRefreshPeriod is the default period at which the node labels are
+// refreshed.
+const defaultNodeLabelsRefreshPeriod = time.Minute
+
+// Window is a maintenance window suppressing some problems.
+type Window struct {
+	// Name is the name of the window, e.g. the maintenance ticket.
+	Name string `json:"name"`
+	// Start and End are the times the window starts and ends, in RFC 3339 format.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// NodeSelector is a label selector, e.g. "maintenance=kernel-upgrade", the node must
+	// match for the window to apply. Default to all nodes.
+	NodeSelector string `json:"nodeSelector,omitempty"`
+	// Conditions are regular expressions matching the condition types suppressed, e.g.
+	// "KernelDeadlock|ReadonlyFilesystem". Default to all condition types. Since events
+	// have no condition type, a window with conditions does not suppress events other
+	// than the transitions of its conditions.
+	Conditions []string `json:"conditions,omitempty"`
+	// Reasons are regular expressions matching the reasons of the problems suppressed.
+	// Default to all reasons.
+	Reasons []string `json:"reasons,omitempty"`
+
+	selector   labels.Selector
+	conditions []*regexp.Regexp
+	reasons    []*regexp.Regexp
+}
+
+// Config is the configuration of the maintenance windows.
+type Config struct {
+	// Windows are the maintenance windows.
+	Windows []*Window `json:"windows"`
+	// NodeLabelsRefreshPeriodString is the period at which the node labels are refreshed
+	// from the apiserver for the node selectors. Default to 1m.
+	NodeLabelsRefreshPeriodString string        `json:"nodeLabelsRefreshPeriod"`
+	NodeLabelsRefreshPeriod       time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() error {
+	c.NodeLabelsRefreshPeriod = defaultNodeLabelsRefreshPeriod
+	if c.NodeLabelsRefreshPeriodString != "" {
+		var err error
+		if c.NodeLabelsRefreshPeriod, err = time.ParseDuration(c.NodeLabelsRefreshPeriodString); err != nil {
+			return fmt.Errorf("invalid node labels refresh period %q: %v", c.NodeLabelsRefreshPeriodString, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid, and compiles the node selectors and
+// the regular expressions.
+func (c *Config) Validate() error {
+	if c.NodeLabelsRefreshPeriod <= 0 {
+		return fmt.Errorf("node labels refresh period %v must be positive", c.NodeLabelsRefreshPeriod)
+	}
+	for _, w := range c.Windows {
+		if w.Start.IsZero() || w.End.IsZero() {
+			return fmt.Errorf("window %q must set start and end", w.Name)
+		}
+		if !w.End.After(w.Start) {
+			return fmt.Errorf("window %q must end after it starts", w.Name)
+		}
+		var err error
+		if w.selector, err = labels.Parse(w.NodeSelector); err != nil {
+			return fmt.Errorf("invalid node selector %q of window %q: %v", w.NodeSelector, w.Name, err)
+		}
+		if w.conditions, err = compile(w.Conditions); err != nil {
+			return fmt.Errorf("invalid condition pattern of window %q: %v", w.Name, err)
+		}
+		if w.reasons, err = compile(w.Reasons); err != nil {
+			return fmt.Errorf("invalid reason pattern of window %q: %v", w.Name, err)
+		}
+	}
+	return nil
+}
+
+// compile compiles the patterns, which must match the whole string.
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		r, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// HasNodeSelectors returns whether a window selects nodes by labels.
+func (c *Config) HasNodeSelectors() bool {
+	for _, w := range c.Windows {
+		if w.NodeSelector != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadConfig loads the suppression config from a file.
+func LoadConfig(configPath string) (*Config, error) {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	var config Config
+	if err := util.UnmarshalStrict(f, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return nil, fmt.Errorf("failed to apply configuration file %q: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", configPath, err)
+	}
+	return &config, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeLabelsFunc returns the labels of the node.
+type NodeLabelsFunc func() (map[string]string, error)
+
+// Suppressor tells whether problems are suppressed by a maintenance window. It is
+// thread-safe.
+type Suppressor struct {
+	config     *Config
+	clock      clock.Clock
+	nodeLabels NodeLabelsFunc
+
+	mutex sync.Mutex
+	// labels are the last node labels, refreshed every refresh period.
+	labels    labels.Set
+	refreshed time.Time
+}
+
+// NewSuppressor creates a suppressor. nodeLabels may be nil when no window has a node
+// selector, the windows with node selectors never apply then.
+func NewSuppressor(config *Config, nodeLabels NodeLabelsFunc) *Suppressor {
+	return newSuppressor(config, nodeLabels, clock.RealClock{})
+}
+
+func newSuppressor(config *Config, nodeLabels NodeLabelsFunc, clock clock.Clock) *Suppressor {
+	if nodeLabels == nil && config.HasNodeSelectors() {
+		glog.Warning("The node labels are not available, the maintenance windows with node selectors never apply")
+	}
+	return &Suppressor{
+		config:     config,
+		clock:      clock,
+		nodeLabels: nodeLabels,
+	}
+}
+
+// Suppressed returns whether the problem of the condition type and reason is suppressed
+// by an active maintenance window. The problem type of events is empty.
+func (s *Suppressor) Suppressed(problemType, reason string) bool {
+	now := s.clock.Now()
+	for _, w := range s.config.Windows {
+		if now.Before(w.Start) || !now.Before(w.End) {
+			continue
+		}
+		if problemType == "" && len(w.conditions) > 0 {
+			continue
+		}
+		if !matchAny(w.conditions, problemType) || !matchAny(w.reasons, reason) {
+			continue
+		}
+		if w.NodeSelector != "" && !w.selector.Matches(s.currentLabels(now)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// currentLabels returns the node labels, refreshed when the refresh period has passed.
+// The last labels are kept when the refresh fails.
+func (s *Suppressor) currentLabels(now time.Time) labels.Set {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.nodeLabels == nil {
+		return nil
+	}
+	if !s.refreshed.IsZero() && now.Sub(s.refreshed) < s.config.NodeLabelsRefreshPeriod {
+		return s.labels
+	}
+	s.refreshed = now
+	nodeLabels, err := s.nodeLabels()
+	if err != nil {
+		glog.Errorf("Failed to refresh the node labels for the maintenance windows: %v", err)
+		return s.labels
+	}
+	s.labels = labels.Set(nodeLabels)
+	return s.labels
+}
+
+// WrapExporters suppresses the problems exported by all exporters in the list.
+func WrapExporters(exporters []types.Exporter, suppressor *Suppressor) []types.Exporter {
+	wrapped := make([]types.Exporter, 0, len(exporters))
+	for _, exporter := range exporters {
+		wrapped = append(wrapped, NewExporter(exporter, suppressor))
+	}
+	return wrapped
+}
+
+type key struct {
+	source    string
+	condition string
+}
+
+// suppressedExporter is not thread-safe, the problem detector exports the problems one
+// at a time.
+type suppressedExporter struct {
+	exporter   types.Exporter
+	suppressor *Suppressor
+	// exported are the last exported conditions, which suppressed conditions are held at.
+	exported map[key]types.Condition
+}
+
+// NewExporter suppresses the problems exported by the exporter.
+func NewExporter(exporter types.Exporter, suppressor *Suppressor) types.Exporter {
+	return &suppressedExporter{
+		exporter:   exporter,
+		suppressor: suppressor,
+		exported:   make(map[key]types.Condition),
+	}
+}
+
+// ExportProblems exports the status without the suppressed problems. Suppressed
+// conditions are held at their last exported state, or not exported if they have never
+// been, and the events of their transitions are dropped.
+func (se *suppressedExporter) ExportProblems(status *types.Status) {
+	filtered, held := se.filter(status)
+	for _, event := range status.Events {
+		if held[event.Reason] || se.suppressor.Suppressed("", event.Reason) {
+			glog.V(3).Infof("Suppressing event %s of %s in a maintenance window", event.Reason, status.Source)
+			continue
+		}
+		filtered.Events = append(filtered.Events, event)
+	}
+	if len(filtered.Events) == 0 && len(filtered.Conditions) == 0 {
+		return
+	}
+	se.exporter.ExportProblems(filtered)
+}
+
+// SyncProblems syncs the status without the suppressed problems, so that the conditions
+// held during a maintenance window are synced once it ends.
+func (se *suppressedExporter) SyncProblems(status *types.Status) {
+	filtered, _ := se.filter(status)
+	se.exporter.SyncProblems(filtered)
+}
+
+// filter returns a copy of the status with the conditions, and the reasons of the
+// suppressed conditions which changed.
+func (se *suppressedExporter) filter(status *types.Status) (*types.Status, map[string]bool) {
+	filtered := &types.Status{Source: status.Source, Trace: status.Trace}
+	held := map[string]bool{}
+	for _, condition := range status.Conditions {
+		k := key{source: status.Source, condition: condition.Type}
+		last, exported := se.exported[k]
+		if !se.suppressor.Suppressed(condition.Type, condition.Reason) {
+			se.exported[k] = condition
+			filtered.Conditions = append(filtered.Conditions, condition)
+			continue
+		}
+		if !exported || last.Status != condition.Status || last.Reason != condition.Reason {
+			glog.V(3).Infof("Holding condition %s of %s in a maintenance window", condition.Type, status.Source)
+			held[condition.Reason] = true
+		}
+		if exported {
+			filtered.Conditions = append(filtered.Conditions, last)
+		}
+	}
+	return filtered, held
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package suppression
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/exporters/memoryexporter"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+var (
+	testStart = time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	testEnd   = testStart.Add(4 * time.Hour)
+)
+
+func TestValidate(t *testing.T) {
+	for desc, test := range map[string]struct {
+		config Config
+		valid  bool
+	}{
+		"valid": {
+			config: Config{Windows: []*Window{{Start: testStart, End: testEnd, NodeSelector: "maintenance in (kernel,disk)", Reasons: []string{"Ext4.*"}}}},
+			valid:  true,
+		},
+		"no end": {
+			config: Config{Windows: []*Window{{Start: testStart}}},
+		},
+		"end before start": {
+			config: Config{Windows: []*Window{{Start: testEnd, End: testStart}}},
+		},
+		"invalid node selector": {
+			config: Config{Windows: []*Window{{Start: testStart, End: testEnd, NodeSelector: "maintenance in kernel"}}},
+		},
+		"invalid condition pattern": {
+			config: Config{Windows: []*Window{{Start: testStart, End: testEnd, Conditions: []string{"Kernel("}}}},
+		},
+		"invalid refresh period": {
+			config: Config{NodeLabelsRefreshPeriodString: "0s"},
+		},
+	} {
+		err := test.config.ApplyConfiguration()
+		if err == nil {
+			err = test.config.Validate()
+		}
+		assert.Equal(t, test.valid, err == nil, desc)
+	}
+}
+
+func newTestSuppressor(t *testing.T, config *Config, nodeLabels NodeLabelsFunc) (*Suppressor, *clock.FakeClock) {
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	fakeClock := clock.NewFakeClock(testStart.Add(-time.Hour))
+	return newSuppressor(config, nodeLabels, fakeClock), fakeClock
+}
+
+func TestSuppressed(t *testing.T) {
+	s, fakeClock := newTestSuppressor(t, &Config{Windows: []*Window{
+		{Start: testStart, End: testEnd, Conditions: []string{"KernelDeadlock"}},
+		{Start: testStart, End: testEnd, Reasons: []string{"Ext4Error|IOError"}},
+	}}, nil)
+
+	assert.False(t, s.Suppressed("KernelDeadlock", "DockerHung"), "before the window")
+	fakeClock.SetTime(testStart)
+	assert.True(t, s.Suppressed("KernelDeadlock", "DockerHung"))
+	assert.False(t, s.Suppressed("", "DockerHung"), "events do not match windows with conditions")
+	assert.True(t, s.Suppressed("", "Ext4Error"))
+	assert.True(t, s.Suppressed("ReadonlyFilesystem", "IOError"))
+	assert.False(t, s.Suppressed("", "Ext4Warning"), "reasons match the whole reason")
+	fakeClock.SetTime(testEnd)
+	assert.False(t, s.Suppressed("KernelDeadlock", "DockerHung"), "after the window")
+}
+
+func TestSuppressedByNodeSelector(t *testing.T) {
+	nodeLabels := map[string]string{"maintenance": "kernel-upgrade"}
+	var err error
+	requests := 0
+	s, fakeClock := newTestSuppressor(t, &Config{Windows: []*Window{
+		{Start: testStart, End: testEnd, NodeSelector: "maintenance=kernel-upgrade"},
+	}}, func() (map[string]string, error) {
+		requests++
+		return nodeLabels, err
+	})
+
+	fakeClock.SetTime(testStart)
+	assert.True(t, s.Suppressed("KernelDeadlock", "DockerHung"))
+	// The labels are refreshed every refresh period.
+	nodeLabels = map[string]string{}
+	assert.True(t, s.Suppressed("KernelDeadlock", "DockerHung"))
+	assert.Equal(t, 1, requests)
+	fakeClock.Step(time.Minute)
+	assert.False(t, s.Suppressed("KernelDeadlock", "DockerHung"))
+	assert.Equal(t, 2, requests)
+
+	// The last labels are kept when the refresh fails.
+	nodeLabels, err = nil, errors.New("apiserver unavailable")
+	fakeClock.Step(time.Minute)
+	assert.False(t, s.Suppressed("KernelDeadlock", "DockerHung"))
+	assert.Equal(t, 3, requests)
+
+	// Windows with node selectors never apply without node labels.
+	s, fakeClock = newTestSuppressor(t, &Config{Windows: []*Window{
+		{Start: testStart, End: testEnd, NodeSelector: "maintenance=kernel-upgrade"},
+	}}, nil)
+	fakeClock.SetTime(testStart)
+	assert.False(t, s.Suppressed("KernelDeadlock", "DockerHung"))
+}
+
+func TestExportProblems(t *testing.T) {
+	s, fakeClock := newTestSuppressor(t, &Config{Windows: []*Window{
+		{Start: testStart, End: testEnd, Conditions: []string{"KernelDeadlock"}},
+	}}, nil)
+	fake := memoryexporter.NewExporter()
+	exporter := NewExporter(fake, s)
+
+	status := func(conditionStatus types.ConditionStatus, reason string) *types.Status {
+		return &types.Status{
+			Source: "kernel-monitor",
+			Events: []types.Event{
+				{Severity: types.Info, Reason: reason},
+				{Severity: types.Warn, Reason: "TaskHung"},
+			},
+			Conditions: []types.Condition{
+				{Type: "KernelDeadlock", Status: conditionStatus, Reason: reason},
+				{Type: "ReadonlyFilesystem", Status: types.False, Reason: "FilesystemIsNotReadOnly"},
+			},
+		}
+	}
+
+	exporter.ExportProblems(status(types.False, "KernelHasNoDeadlock"))
+	assert.Len(t, fake.Events("kernel-monitor"), 2)
+
+	// The condition is held during the window, and the event of its transition is dropped.
+	fakeClock.SetTime(testStart)
+	exporter.ExportProblems(status(types.True, "DockerHung"))
+	condition, _ := fake.Condition("kernel-monitor", "KernelDeadlock")
+	assert.Equal(t, types.False, condition.Status)
+	events := fake.Events("kernel-monitor")
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, "TaskHung", events[2].Reason)
+	}
+
+	// The condition is synced once the window ends.
+	fakeClock.SetTime(testEnd)
+	exporter.SyncProblems(&types.Status{
+		Source:     "kernel-monitor",
+		Conditions: []types.Condition{{Type: "KernelDeadlock", Status: types.True, Reason: "DockerHung"}},
+	})
+	condition, _ = fake.Condition("kernel-monitor", "KernelDeadlock")
+	assert.Equal(t, types.True, condition.Status)
+}
+
+func TestExportNeverExportedCondition(t *testing.T) {
+	s, fakeClock := newTestSuppressor(t, &Config{Windows: []*Window{{Start: testStart, End: testEnd}}}, nil)
+	fake := memoryexporter.NewExporter()
+	exporter := NewExporter(fake, s)
+
+	// Nothing is exported when all problems are suppressed.
+	fakeClock.SetTime(testStart)
+	exporter.ExportProblems(&types.Status{
+		Source:     "kernel-monitor",
+		Events:     []types.Event{{Severity: types.Warn, Reason: "TaskHung"}},
+		Conditions: []types.Condition{{Type: "KernelDeadlock", Status: types.True, Reason: "DockerHung"}},
+	})
+	assert.Empty(t, fake.Exported())
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// JournaldTarget writes the problems to the local journal over its native protocol.
+	JournaldTarget = "journald"
+	// SyslogTarget writes the problems to syslog in the RFC 5424 format.
+	SyslogTarget = "syslog"
+)
+
+// facilities are the syslog facility codes by name.
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "daemon": 3, "auth": 4, "syslog": 5,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var (
+	defaultJournaldSocket = "/run/systemd/journal/socket"
+	defaultSyslogNetwork  = "unixgram"
+	defaultSyslogAddress  = "/dev/log"
+	defaultFacility       = "daemon"
+	defaultIdentifier     = "node-problem-detector"
+	defaultExportEvents   = true
+	defaultTimeout        = (5 * time.Second).String()
+)
+
+type SyslogExporterConfig struct {
+	// Target is where the problems are written: "journald" or "syslog". Default to
+	// "journald".
+	Target string `json:"target"`
+	// Network is the network of the address: "unixgram", "udp" or "tcp". Default to
+	// "unixgram".
+	Network string `json:"network"`
+	// Address is the address problems are written to. Default to the journal socket
+	// "/run/systemd/journal/socket" for journald, and "/dev/log" for syslog.
+	Address string `json:"address"`
+	// Facility is the syslog facility of the problems, e.g. "daemon" or "local0". Default
+	// to "daemon".
+	Facility string `json:"facility"`
+	// Identifier is the syslog identifier (the APP-NAME) of the problems. Default to
+	// "node-problem-detector".
+	Identifier string `json:"identifier"`
+	// ExportEvents writes the events, not only the condition transitions. Default to true.
+	ExportEvents *bool `json:"exportEvents,omitempty"`
+	// Timeout is the timeout of writing a problem.
+	Timeout string `json:"timeout"`
+
+	FacilityCode    int           `json:"-"`
+	TimeoutDuration time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *SyslogExporterConfig) ApplyConfiguration() error {
+	if c.Target == "" {
+		c.Target = JournaldTarget
+	}
+	if c.Network == "" {
+		c.Network = defaultSyslogNetwork
+	}
+	if c.Address == "" {
+		c.Address = defaultSyslogAddress
+		if c.Target == JournaldTarget {
+			c.Address = defaultJournaldSocket
+		}
+	}
+	if c.Facility == "" {
+		c.Facility = defaultFacility
+	}
+	if c.Identifier == "" {
+		c.Identifier = defaultIdentifier
+	}
+	if c.ExportEvents == nil {
+		c.ExportEvents = &defaultExportEvents
+	}
+	if c.Timeout == "" {
+		c.Timeout = defaultTimeout
+	}
+
+	c.FacilityCode = facilities[c.Facility]
+	var err error
+	c.TimeoutDuration, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to parse timeout %q: %v", c.Timeout, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *SyslogExporterConfig) Validate() error {
+	switch c.Target {
+	case JournaldTarget:
+		// The native protocol of the journal is only served on a datagram socket.
+		if c.Network != "unixgram" {
+			return fmt.Errorf("journald target requires network %q, got %q", "unixgram", c.Network)
+		}
+	case SyslogTarget:
+		if c.Network != "unixgram" && c.Network != "udp" && c.Network != "tcp" {
+			return fmt.Errorf("unsupported network %q, supported: %q, %q, %q", c.Network, "unixgram", "udp", "tcp")
+		}
+	default:
+		return fmt.Errorf("unsupported target %q, supported: %q, %q", c.Target, JournaldTarget, SyslogTarget)
+	}
+	if _, ok := facilities[c.Facility]; !ok {
+		return fmt.Errorf("unknown facility %q", c.Facility)
+	}
+	if c.TimeoutDuration <= 0 {
+		return fmt.Errorf("timeout %v must be positive", c.TimeoutDuration)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      SyslogExporterConfig
+		wantAddress string
+		wantError   bool
+	}{
+		{
+			name:        "default",
+			config:      SyslogExporterConfig{},
+			wantAddress: "/run/systemd/journal/socket",
+		},
+		{
+			name:        "syslog",
+			config:      SyslogExporterConfig{Target: SyslogTarget, Facility: "local0"},
+			wantAddress: "/dev/log",
+		},
+		{
+			name:        "remote syslog",
+			config:      SyslogExporterConfig{Target: SyslogTarget, Network: "tcp", Address: "127.0.0.1:514"},
+			wantAddress: "127.0.0.1:514",
+		},
+		{
+			name:      "journald over udp",
+			config:    SyslogExporterConfig{Target: JournaldTarget, Network: "udp", Address: "127.0.0.1:514"},
+			wantError: true,
+		},
+		{
+			name:      "unsupported target",
+			config:    SyslogExporterConfig{Target: "eventlog"},
+			wantError: true,
+		},
+		{
+			name:      "unknown facility",
+			config:    SyslogExporterConfig{Facility: "local8"},
+			wantError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.ApplyConfiguration(); err != nil {
+				t.Fatalf("Unexpected error applying config %+v: %v", test.config, err)
+			}
+			err := test.config.Validate()
+			if test.wantError && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.wantError && err != nil {
+				t.Errorf("Unexpected error for config %+v: %v", test.config, err)
+			}
+			if test.wantAddress != "" && test.config.Address != test.wantAddress {
+				t.Errorf("Expect address %q, got %q", test.wantAddress, test.config.Address)
+			}
+		})
+	}
+}
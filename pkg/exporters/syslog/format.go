@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslogexporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	syslogconfig "k8s.io/node-problem-detector/pkg/exporters/syslog/config"
+)
+
+// structuredDataID is the SD-ID of the structured data element of the syslog messages,
+// under the private enterprise number reserved for documentation (RFC 5612).
+const structuredDataID = "npd@32473"
+
+// journalEntry encodes the record in the native protocol of the journal. The fields are
+// upper cased and prefixed with "NPD_", e.g. "NPD_REASON", and NPD_REPORT is the v1
+// problem report as JSON.
+func journalEntry(r *record, config syslogconfig.SyslogExporterConfig) []byte {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", r.message)
+	writeJournalField(&b, "PRIORITY", strconv.Itoa(r.priority))
+	writeJournalField(&b, "SYSLOG_FACILITY", strconv.Itoa(config.FacilityCode))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", config.Identifier)
+	writeJournalField(&b, "NPD_KIND", r.kind)
+	writeJournalField(&b, "NPD_TIMESTAMP", r.timestamp.Format(time.RFC3339Nano))
+	for _, name := range sortedNames(r.fields) {
+		if r.fields[name] == "" {
+			continue
+		}
+		writeJournalField(&b, "NPD_"+journalFieldName(name), r.fields[name])
+	}
+	if r.report != nil {
+		report, err := json.Marshal(r.report)
+		if err != nil {
+			glog.Errorf("Failed to marshal problem report: %v", err)
+		} else {
+			writeJournalField(&b, "NPD_REPORT", string(report))
+		}
+	}
+	return b.Bytes()
+}
+
+// writeJournalField writes a field, in the binary form if the value spans lines.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName returns the name as a journal field name, which only has upper case
+// letters, digits and underscores.
+func journalFieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// syslogMessage formats the record as an RFC 5424 message, with the fields as structured
+// data, e.g. `[npd@32473 reason="OOMKilling" source="kernel-monitor"]`. Messages sent
+// over TCP are framed by octet counting (RFC 6587).
+func syslogMessage(r *record, config syslogconfig.SyslogExporterConfig, hostname string, pid int) []byte {
+	if hostname == "" {
+		hostname = "-"
+	}
+	var sd bytes.Buffer
+	sd.WriteString("[" + structuredDataID)
+	for _, name := range sortedNames(r.fields) {
+		if r.fields[name] == "" {
+			continue
+		}
+		fmt.Fprintf(&sd, " %s=\"%s\"", structuredDataName(name), structuredDataEscaper.Replace(r.fields[name]))
+	}
+	sd.WriteString("]")
+	message := fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		config.FacilityCode*8+r.priority,
+		r.timestamp.UTC().Format(time.RFC3339Nano),
+		hostname, config.Identifier, pid, r.kind, sd.String(), r.message)
+	if config.Network == "tcp" {
+		return []byte(fmt.Sprintf("%d %s", len(message), message))
+	}
+	return []byte(message)
+}
+
+// structuredDataEscaper escapes the characters RFC 5424 reserves in parameter values.
+var structuredDataEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// structuredDataName returns the name as a parameter name, which must not have '=', ' ',
+// ']' or '"', and has at most 32 characters.
+func structuredDataName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+func sortedNames(fields map[string]string) []string {
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package syslogexporter writes node problems to the local journal or syslog with
+// structured fields, so that the pipelines collecting the node logs pick them up without
+// Kubernetes access.
+package syslogexporter
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/exporters"
+	syslogconfig "k8s.io/node-problem-detector/pkg/exporters/syslog/config"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+func init() {
+	exporters.RegisterWithConfigFile(exporterName,
+		"Configuration for the syslog exporter, which writes problems to the local journal or syslog.", NewExporterOrDie)
+}
+
+const exporterName = "syslog"
+
+// The syslog severities the problems are written with.
+const (
+	priorityCritical = 2
+	priorityWarning  = 4
+	priorityInfo     = 6
+)
+
+// record is a problem to write.
+type record struct {
+	priority  int
+	timestamp time.Time
+	// kind is "event" or "condition".
+	kind    string
+	message string
+	// fields are the structured fields of the problem, by lower case name, e.g. "reason".
+	fields map[string]string
+	// report is the problem report of the single event or condition, the journal entries
+	// carry it in full.
+	report *npdapiv1.ProblemReport
+}
+
+// newRecord returns the record of a problem report with a single event or condition.
+func newRecord(report *npdapiv1.ProblemReport) *record {
+	if len(report.Events) > 0 {
+		event := report.Events[0]
+		fields := map[string]string{
+			"source":   report.Source,
+			"node":     report.Node,
+			"reason":   event.Reason,
+			"severity": event.Severity,
+		}
+		for key, value := range event.Annotations {
+			if _, ok := fields[key]; !ok {
+				fields[key] = value
+			}
+		}
+		return &record{
+			priority:  priority(types.Severity(event.Severity)),
+			timestamp: event.Timestamp,
+			kind:      "event",
+			message:   event.Reason + ": " + event.Message,
+			fields:    fields,
+			report:    report,
+		}
+	}
+	condition := report.Conditions[0]
+	p := priorityInfo
+	if condition.Status == string(types.True) {
+		p = priority(types.Severity(condition.Severity))
+	}
+	return &record{
+		priority:  p,
+		timestamp: condition.Transition,
+		kind:      "condition",
+		message:   "Condition " + condition.Type + " is now " + condition.Status + ", " + condition.Reason + ": " + condition.Message,
+		fields: map[string]string{
+			"source":    report.Source,
+			"node":      report.Node,
+			"condition": condition.Type,
+			"status":    condition.Status,
+			"reason":    condition.Reason,
+			"severity":  condition.Severity,
+		},
+		report: report,
+	}
+}
+
+type syslogExporter struct {
+	// Mutex protects conditions and conn, the exporter may be called by the periodic sync
+	// while exporting problems.
+	sync.Mutex
+	config   syslogconfig.SyslogExporterConfig
+	nodeName string
+	pid      int
+	// dial connects to the address of the config.
+	dial func() (net.Conn, error)
+	conn net.Conn
+	// conditions are the statuses of the conditions last seen, by source and type.
+	conditions map[string]types.ConditionStatus
+}
+
+// NewExporterOrDie creates an exporter writing problems to the journal or syslog, panics
+// if error occurs.
+func NewExporterOrDie(configPath string) types.Exporter {
+	config := syslogconfig.SyslogExporterConfig{}
+	if err := exporters.LoadConfig(configPath, &config); err != nil {
+		glog.Fatalf("Failed to load syslog exporter config: %v", err)
+	}
+
+	glog.Infof("Starting syslog exporter %s", configPath)
+	return newSyslogExporter(config, util.GetNodeName())
+}
+
+func newSyslogExporter(config syslogconfig.SyslogExporterConfig, nodeName string) *syslogExporter {
+	return &syslogExporter{
+		config:   config,
+		nodeName: nodeName,
+		pid:      os.Getpid(),
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout(config.Network, config.Address, config.TimeoutDuration)
+		},
+		conditions: make(map[string]types.ConditionStatus),
+	}
+}
+
+// ExportProblems writes the condition transitions, and the events if configured.
+func (se *syslogExporter) ExportProblems(status *types.Status) {
+	se.Lock()
+	defer se.Unlock()
+	if *se.config.ExportEvents {
+		for _, event := range status.Events {
+			se.write(newRecord(npdapiv1.NewProblemReport(se.nodeName, &types.Status{
+				Source: status.Source,
+				Events: []types.Event{event},
+				Node:   status.Node,
+			})))
+		}
+	}
+	se.exportConditions(status)
+}
+
+// SyncProblems writes the condition transitions missed by ExportProblems, if any.
+func (se *syslogExporter) SyncProblems(status *types.Status) {
+	se.Lock()
+	defer se.Unlock()
+	se.exportConditions(status)
+}
+
+// exportConditions writes the conditions whose status changed. A condition seen for the
+// first time is only written if it is True.
+func (se *syslogExporter) exportConditions(status *types.Status) {
+	for _, condition := range status.Conditions {
+		key := status.Source + "/" + condition.Type
+		last, seen := se.conditions[key]
+		se.conditions[key] = condition.Status
+		if last == condition.Status || (!seen && condition.Status != types.True) {
+			continue
+		}
+		se.write(newRecord(npdapiv1.NewProblemReport(se.nodeName, &types.Status{
+			Source:     status.Source,
+			Conditions: []types.Condition{condition},
+			Node:       status.Node,
+		})))
+	}
+}
+
+// priority returns the syslog severity of a problem. Problems without severity are
+// warnings.
+func priority(severity types.Severity) int {
+	switch severity {
+	case types.Critical:
+		return priorityCritical
+	case types.Info:
+		return priorityInfo
+	default:
+		return priorityWarning
+	}
+}
+
+// write writes the record, reconnecting once if the connection is broken, e.g. after the
+// journal restarted.
+func (se *syslogExporter) write(r *record) {
+	var data []byte
+	if se.config.Target == syslogconfig.JournaldTarget {
+		data = journalEntry(r, se.config)
+	} else {
+		data = syslogMessage(r, se.config, se.nodeName, se.pid)
+	}
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if se.conn == nil {
+			if se.conn, err = se.dial(); err != nil {
+				se.conn = nil
+				continue
+			}
+		}
+		if err = se.conn.SetWriteDeadline(time.Now().Add(se.config.TimeoutDuration)); err == nil {
+			if _, err = se.conn.Write(data); err == nil {
+				return
+			}
+		}
+		se.conn.Close()
+		se.conn = nil
+	}
+	glog.Errorf("Failed to write %s %q to %s: %v", r.kind, r.fields["reason"], se.config.Target, err)
+	exporters.RecordFailure(exporterName, r.kind+"s")
+}
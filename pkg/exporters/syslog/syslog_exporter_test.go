@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslogexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	syslogconfig "k8s.io/node-problem-detector/pkg/exporters/syslog/config"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// listen listens on a datagram socket, and returns the function reading the next entry.
+func listen(t *testing.T, network, address string) (net.PacketConn, func() string) {
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() string {
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestJournald(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := syslogconfig.SyslogExporterConfig{Address: filepath.Join(dir, "socket")}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	conn, read := listen(t, "unixgram", config.Address)
+	defer conn.Close()
+
+	se := newSyslogExporter(config, "node-1")
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	status := &types.Status{
+		Source: "kernel-monitor",
+		Events: []types.Event{{
+			Severity:    types.Warn,
+			Timestamp:   timestamp,
+			Reason:      "OOMKilling",
+			Message:     "Killed process 1234 (java)\ntotal-vm:1kB",
+			Annotations: map[string]string{"team": "runtime"},
+		}},
+	}
+	report, err := json.Marshal(npdapiv1.NewProblemReport("node-1", status))
+	assert.NoError(t, err)
+	se.ExportProblems(status)
+	// The message spans lines, it is written with its 51 bytes length.
+	assert.Equal(t, "MESSAGE\n\x33\x00\x00\x00\x00\x00\x00\x00OOMKilling: Killed process 1234 (java)\ntotal-vm:1kB\n"+
+		"PRIORITY=4\n"+
+		"SYSLOG_FACILITY=3\n"+
+		"SYSLOG_IDENTIFIER=node-problem-detector\n"+
+		"NPD_KIND=event\n"+
+		"NPD_TIMESTAMP=2026-01-02T03:04:05Z\n"+
+		"NPD_NODE=node-1\n"+
+		"NPD_REASON=OOMKilling\n"+
+		"NPD_SEVERITY=warn\n"+
+		"NPD_SOURCE=kernel-monitor\n"+
+		"NPD_TEAM=runtime\n"+
+		"NPD_REPORT="+string(report)+"\n", read())
+
+	// The journal restarted.
+	conn.Close()
+	os.Remove(config.Address)
+	conn, read = listen(t, "unixgram", config.Address)
+	defer conn.Close()
+	se.ExportProblems(&types.Status{
+		Source: "kernel-monitor",
+		Conditions: []types.Condition{{
+			Type: "KernelDeadlock", Status: types.True, Severity: types.Critical, Transition: timestamp,
+			Reason: "DockerHung", Message: "task docker:7 blocked for more than 120 seconds.",
+		}},
+	})
+	entry := read()
+	assert.True(t, strings.HasPrefix(entry, "MESSAGE=Condition KernelDeadlock is now True, DockerHung: task docker:7 blocked for more than 120 seconds.\nPRIORITY=2\n"), entry)
+	assert.Contains(t, entry, "NPD_CONDITION=KernelDeadlock\n")
+	assert.Contains(t, entry, "NPD_STATUS=True\n")
+}
+
+func TestSyslogConditions(t *testing.T) {
+	conn, read := listen(t, "udp", "127.0.0.1:0")
+	defer conn.Close()
+	config := syslogconfig.SyslogExporterConfig{Target: syslogconfig.SyslogTarget, Network: "udp", Address: conn.LocalAddr().String(), Facility: "local0"}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	se := newSyslogExporter(config, "node-1")
+	se.pid = 42
+
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	status := func(s types.ConditionStatus, message string) *types.Status {
+		return &types.Status{
+			Source:     "disk-monitor",
+			Conditions: []types.Condition{{Type: "DiskReadonly", Status: s, Transition: timestamp, Reason: "Readonly", Message: message}},
+		}
+	}
+	// A condition False on its first report is not written.
+	se.SyncProblems(status(types.False, "ok"))
+	se.ExportProblems(status(types.True, `mounted "ro" [sdb]`))
+	assert.Equal(t, `<132>1 2026-01-02T03:04:05Z node-1 node-problem-detector 42 condition `+
+		`[npd@32473 condition="DiskReadonly" node="node-1" reason="Readonly" source="disk-monitor" status="True"] `+
+		`Condition DiskReadonly is now True, Readonly: mounted "ro" [sdb]`, read())
+	// Unchanged conditions are not written again.
+	se.SyncProblems(status(types.True, `mounted "ro" [sdb]`))
+	se.ExportProblems(status(types.False, "ok"))
+	assert.True(t, strings.HasPrefix(read(), "<134>1 "), "recovered conditions are info")
+}
+
+func TestSyslogMessageEscaping(t *testing.T) {
+	config := syslogconfig.SyslogExporterConfig{Target: syslogconfig.SyslogTarget, Network: "tcp"}
+	assert.NoError(t, config.ApplyConfiguration())
+	r := &record{
+		priority:  priorityWarning,
+		timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		kind:      "event",
+		message:   "m",
+		fields:    map[string]string{"reason": `a"b\c]`, "team name": "x", "empty": ""},
+	}
+	message := `<28>1 2026-01-02T03:04:05Z - node-problem-detector 1 event [npd@32473 reason="a\"b\\c\]" team_name="x"] m`
+	assert.Equal(t, fmt.Sprintf("%d %s", len(message), message), string(syslogMessage(r, config, "", 1)))
+}
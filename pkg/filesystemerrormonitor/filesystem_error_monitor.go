@@ -0,0 +1,378 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesystemerrormonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	fstypes "k8s.io/node-problem-detector/pkg/filesystemerrormonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const FilesystemErrorMonitorName = "filesystem-error-monitor"
+
+const (
+	healthyReason   = "FilesystemIsHealthy"
+	healthyMessage  = "no filesystem errors are recorded"
+	errorsReason    = "FilesystemErrorsRecorded"
+	newErrorsReason = "FilesystemErrors"
+)
+
+func init() {
+	problemdaemon.Register(FilesystemErrorMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewFilesystemErrorMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type filesystemErrorMonitor struct {
+	configPath string
+	config     fstypes.FilesystemErrorConfig
+	// readCounts reads the cumulative error count of each filesystem, keyed by device.
+	readCounts func() (map[string]uint64, error)
+	// readMounts reads the mountpoint of each device.
+	readMounts func() (map[string]string, error)
+	// counts are the error counts of the last check, nil before the first check.
+	counts map[string]uint64
+	// condition is the condition of all filesystems, and instances are the conditions of
+	// the filesystems with errors, keyed by device.
+	condition   types.Condition
+	instances   map[string]*types.Condition
+	errorCounts metrics.Int64MetricInterface
+	statusChan  chan *types.Status
+	tomb        *tomb.Tomb
+}
+
+// NewFilesystemErrorMonitorOrDie creates a filesystem error monitor, panics if error occurs.
+func NewFilesystemErrorMonitorOrDie(configPath string) types.Monitor {
+	fem := filesystemErrorMonitor{
+		configPath: configPath,
+		instances:  make(map[string]*types.Condition),
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &fem.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = fem.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = fem.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, fem.config, err)
+	}
+	fem.readCounts = func() (map[string]uint64, error) {
+		return readCounters(fem.config.ErrorCounters)
+	}
+	fem.readMounts = func() (map[string]string, error) {
+		return readMounts(fem.config.MountsPath)
+	}
+
+	// A 1000 size channel should be big enough.
+	fem.statusChan = make(chan *types.Status, 1000)
+
+	if *fem.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(fem.config.ConditionType)
+		fem.errorCounts = errorCountsMetricOrDie()
+	}
+	return &fem
+}
+
+var (
+	errorCounts     metrics.Int64MetricInterface
+	errorCountsOnce sync.Once
+)
+
+// errorCountsMetricOrDie returns the metric of the error counts of each filesystem, panic
+// if error occurs. The metric is shared by all filesystem error monitors.
+func errorCountsMetricOrDie() metrics.Int64MetricInterface {
+	errorCountsOnce.Do(func() {
+		metric, err := metrics.NewInt64Metric(
+			metrics.FilesystemErrorCountID,
+			string(metrics.FilesystemErrorCountID),
+			"Cumulative number of errors recorded by each filesystem.",
+			"1",
+			metrics.LastValue,
+			[]string{"device", "mount_point"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.FilesystemErrorCountID, err)
+		}
+		errorCounts = metric
+	})
+	return errorCounts
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for the condition and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, errorsReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			conditionType, errorsReason, err)
+	}
+	for _, reason := range []string{errorsReason, newErrorsReason} {
+		err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+		}
+	}
+}
+
+func (fem *filesystemErrorMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start filesystem error monitor %s", fem.configPath)
+	problemdaemon.Go(fem, fem.monitorLoop)
+	return fem.statusChan, nil
+}
+
+func (fem *filesystemErrorMonitor) Stop() {
+	glog.Infof("Stop filesystem error monitor %s", fem.configPath)
+	fem.tomb.Stop()
+}
+
+func (fem *filesystemErrorMonitor) monitorLoop() {
+	defer fem.tomb.Done()
+
+	runTicker := time.NewTicker(fem.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	fem.initializeStatus()
+	if status := fem.check(time.Now()); status != nil {
+		fem.statusChan <- status
+	}
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := fem.check(now); status != nil {
+				fem.statusChan <- status
+			}
+		case <-fem.tomb.Stopping():
+			glog.Infof("Filesystem error monitor stopped: %s", fem.configPath)
+			return
+		}
+	}
+}
+
+func (fem *filesystemErrorMonitor) initializeStatus() {
+	fem.condition = types.Condition{
+		Type:       fem.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     healthyReason,
+		Message:    healthyMessage,
+	}
+	fem.statusChan <- &types.Status{
+		Source:     fem.config.Source,
+		Conditions: []types.Condition{fem.condition},
+	}
+}
+
+// check reads the error counts, and returns a new status if errors are recorded or the
+// conditions change. The error count of a filesystem persists until it is repaired, so
+// its condition is set as long as the count is above 0, and cleared when the count drops
+// to 0 or the filesystem is unmounted.
+func (fem *filesystemErrorMonitor) check(now time.Time) *types.Status {
+	counts, err := fem.readCounts()
+	if err != nil {
+		glog.Errorf("Failed to read filesystem error counts: %v", err)
+		return nil
+	}
+	mounts, err := fem.readMounts()
+	if err != nil {
+		glog.Errorf("Failed to read mounts, report filesystem errors without mountpoints: %v", err)
+		mounts = nil
+	}
+	fem.recordMetrics(counts, mounts)
+
+	var events []types.Event
+	changed := false
+	detected := 0
+	for _, device := range sortedDevices(counts) {
+		count := counts[device]
+		if count == 0 {
+			continue
+		}
+		if last, ok := fem.counts[device]; ok && count > last {
+			events = append(events, types.Event{
+				Severity:  types.Warn,
+				Timestamp: now,
+				Reason:    newErrorsReason,
+				Message:   fmt.Sprintf("%d new errors recorded on %s", count-last, describe(device, mounts)),
+			})
+		}
+		message := fmt.Sprintf("%d errors recorded on %s", count, describe(device, mounts))
+		condition, ok := fem.instances[device]
+		if !ok {
+			condition = &types.Condition{
+				Type:       instanceConditionType(fem.config.ConditionType, device),
+				Status:     types.True,
+				Transition: now,
+				Reason:     errorsReason,
+			}
+			fem.instances[device] = condition
+			detected++
+			events = append(events, util.GenerateConditionChangeEvent(condition.Type, types.True, errorsReason, now))
+		}
+		if condition.Message != message {
+			condition.Message = message
+			changed = true
+		}
+	}
+	// The conditions of the filesystems without errors are cleared, and not reported again.
+	var healed []types.Condition
+	for _, device := range sortedDevices(fem.counts) {
+		condition, ok := fem.instances[device]
+		if !ok || counts[device] > 0 {
+			continue
+		}
+		condition.Status = types.False
+		condition.Transition = now
+		condition.Reason = healthyReason
+		condition.Message = healthyMessage
+		healed = append(healed, *condition)
+		delete(fem.instances, device)
+		events = append(events, util.GenerateConditionChangeEvent(condition.Type, types.False, healthyReason, now))
+	}
+	fem.counts = counts
+
+	transitioned := fem.updateCondition(now)
+	if len(events) == 0 && !changed && !transitioned {
+		return nil
+	}
+	newErrors := len(events) - len(healed) - detected
+	if transitioned {
+		events = append(events, util.GenerateConditionChangeEvent(fem.condition.Type, fem.condition.Status, fem.condition.Reason, now))
+	}
+	conditions := append(fem.conditions(), healed...)
+	if *fem.config.EnableMetricsReporting {
+		fem.updateProblemMetrics(conditions, detected, newErrors)
+	}
+	return &types.Status{
+		Source:     fem.config.Source,
+		Events:     events,
+		Conditions: conditions,
+	}
+}
+
+// updateCondition updates the condition of all filesystems from the conditions of each
+// filesystem, and returns whether its status changed.
+func (fem *filesystemErrorMonitor) updateCondition(now time.Time) bool {
+	status, reason, message := types.False, healthyReason, healthyMessage
+	if len(fem.instances) > 0 {
+		var messages []string
+		for _, device := range sortedDevices(fem.counts) {
+			if condition, ok := fem.instances[device]; ok {
+				messages = append(messages, condition.Message)
+			}
+		}
+		status, reason, message = types.True, errorsReason, strings.Join(messages, "; ")
+	}
+	transitioned := status != fem.condition.Status
+	if transitioned {
+		fem.condition.Transition = now
+	}
+	fem.condition.Status = status
+	fem.condition.Reason = reason
+	fem.condition.Message = message
+	return transitioned
+}
+
+// conditions returns the condition of all filesystems, followed by the conditions of
+// each filesystem sorted by type.
+func (fem *filesystemErrorMonitor) conditions() []types.Condition {
+	conditions := []types.Condition{fem.condition}
+	for _, condition := range fem.instances {
+		conditions = append(conditions, *condition)
+	}
+	sort.Slice(conditions[1:], func(i, j int) bool {
+		return conditions[i+1].Type < conditions[j+1].Type
+	})
+	return conditions
+}
+
+// sortedDevices returns the devices of the map in order, so that the events are reported
+// in a stable order.
+func sortedDevices(counts map[string]uint64) []string {
+	var devices []string
+	for device := range counts {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+func instanceConditionType(conditionType, device string) string {
+	return conditionType + "[" + device + "]"
+}
+
+// describe returns the device with its mountpoint if it is known.
+func describe(device string, mounts map[string]string) string {
+	if mountPoint, ok := mounts[device]; ok {
+		return fmt.Sprintf("%s mounted at %s", device, mountPoint)
+	}
+	return device
+}
+
+func (fem *filesystemErrorMonitor) recordMetrics(counts map[string]uint64, mounts map[string]string) {
+	if fem.errorCounts == nil {
+		return
+	}
+	for device, count := range counts {
+		err := fem.errorCounts.Record(map[string]string{"device": device, "mount_point": mounts[device]}, int64(count))
+		if err != nil {
+			glog.Errorf("Failed to record errors of filesystem %q: %v", device, err)
+		}
+	}
+}
+
+// updateProblemMetrics counts the filesystems whose errors are detected and the increases
+// of error counts, and updates the problem gauges of the conditions.
+func (fem *filesystemErrorMonitor) updateProblemMetrics(conditions []types.Condition, detected, newErrors int) {
+	for reason, n := range map[string]int{errorsReason: detected, newErrorsReason: newErrors} {
+		if n == 0 {
+			continue
+		}
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, int64(n))
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", reason, err)
+		}
+	}
+	for _, condition := range conditions {
+		err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(condition.Type, errorsReason, condition.Status == types.True)
+		if err != nil {
+			glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+				condition.Type, errorsReason, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesystemerrormonitor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fstypes "k8s.io/node-problem-detector/pkg/filesystemerrormonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(FilesystemErrorMonitorName) },
+		"Filesystem error monitor failed to register itself as a problem daemon.")
+}
+
+func TestReadCounters(t *testing.T) {
+	sysfs, err := ioutil.TempDir("", "sysfs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(sysfs)
+
+	writeCount := func(path, count string) {
+		path = filepath.Join(sysfs, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(count), 0644))
+	}
+	writeCount("ext4/sda1/errors_count", "12\n")
+	writeCount("ext4/dm-0/errors_count", "0\n")
+	writeCount("xfs/sdb/errors/metadata", "3\n")
+
+	counts, err := readCounters([]string{
+		filepath.Join(sysfs, "ext4/*/errors_count"),
+		filepath.Join(sysfs, "xfs/*/errors/metadata"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"sda1": 12, "dm-0": 0, "sdb": 3}, counts)
+
+	writeCount("ext4/sdc/errors_count", "invalid\n")
+	_, err = readCounters([]string{filepath.Join(sysfs, "ext4/*/errors_count")})
+	assert.Error(t, err)
+}
+
+func TestReadMounts(t *testing.T) {
+	f, err := ioutil.TempFile("", "mounts")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`/dev/sda1 / ext4 rw,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sdb /var/lib/my\040data xfs rw,relatime 0 0
+/dev/sda1 /var/lib/kubelet ext4 rw,relatime 0 0
+`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	mounts, err := readMounts(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"sda1": "/", "sdb": "/var/lib/my data"}, mounts)
+}
+
+func newTestMonitor(t *testing.T) *filesystemErrorMonitor {
+	disabled := false
+	fem := &filesystemErrorMonitor{
+		config: fstypes.FilesystemErrorConfig{
+			EnableMetricsReporting: &disabled,
+		},
+		readMounts: func() (map[string]string, error) {
+			return map[string]string{"sda1": "/var/lib/kubelet"}, nil
+		},
+		instances:  make(map[string]*types.Condition),
+		statusChan: make(chan *types.Status, 1000),
+	}
+	assert.NoError(t, fem.config.ApplyConfiguration())
+	assert.NoError(t, fem.config.Validate())
+	fem.initializeStatus()
+	<-fem.statusChan
+	return fem
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		desc string
+		// last are the counts of the previous check, nil if there is no previous check.
+		last    map[string]uint64
+		current map[string]uint64
+		err     error
+		// conditions are the expected condition statuses, nil if no status is expected.
+		conditions map[string]types.ConditionStatus
+		message    string
+		events     []string
+	}{
+		{
+			desc:    "no errors",
+			current: map[string]uint64{"sda1": 0, "sdb": 0},
+		},
+		{
+			desc:    "errors recorded before the first check",
+			current: map[string]uint64{"sda1": 2, "sdb": 0},
+			conditions: map[string]types.ConditionStatus{
+				"FilesystemCorruptionProblem":       types.True,
+				"FilesystemCorruptionProblem[sda1]": types.True,
+			},
+			message: "2 errors recorded on sda1 mounted at /var/lib/kubelet",
+			events: []string{
+				"Node condition FilesystemCorruptionProblem[sda1] is now: True, reason: FilesystemErrorsRecorded",
+				"Node condition FilesystemCorruptionProblem is now: True, reason: FilesystemErrorsRecorded",
+			},
+		},
+		{
+			desc:    "unchanged counts are not reported again",
+			last:    map[string]uint64{"sda1": 2, "sdb": 0},
+			current: map[string]uint64{"sda1": 2, "sdb": 0},
+		},
+		{
+			desc:    "new errors are reported as events",
+			last:    map[string]uint64{"sda1": 2, "sdb": 0},
+			current: map[string]uint64{"sda1": 5, "sdb": 1},
+			conditions: map[string]types.ConditionStatus{
+				"FilesystemCorruptionProblem":       types.True,
+				"FilesystemCorruptionProblem[sda1]": types.True,
+				"FilesystemCorruptionProblem[sdb]":  types.True,
+			},
+			message: "5 errors recorded on sda1 mounted at /var/lib/kubelet; 1 errors recorded on sdb",
+			events: []string{
+				"3 new errors recorded on sda1 mounted at /var/lib/kubelet",
+				"1 new errors recorded on sdb",
+				"Node condition FilesystemCorruptionProblem[sdb] is now: True, reason: FilesystemErrorsRecorded",
+			},
+		},
+		{
+			desc:    "a lower count updates the message without an event",
+			last:    map[string]uint64{"sda1": 5},
+			current: map[string]uint64{"sda1": 3},
+			conditions: map[string]types.ConditionStatus{
+				"FilesystemCorruptionProblem":       types.True,
+				"FilesystemCorruptionProblem[sda1]": types.True,
+			},
+			message: "3 errors recorded on sda1 mounted at /var/lib/kubelet",
+		},
+		{
+			desc:    "repaired filesystem is cleared",
+			last:    map[string]uint64{"sda1": 2},
+			current: map[string]uint64{"sda1": 0},
+			conditions: map[string]types.ConditionStatus{
+				"FilesystemCorruptionProblem":       types.False,
+				"FilesystemCorruptionProblem[sda1]": types.False,
+			},
+			message: healthyMessage,
+			events: []string{
+				"Node condition FilesystemCorruptionProblem[sda1] is now: False, reason: FilesystemIsHealthy",
+				"Node condition FilesystemCorruptionProblem is now: False, reason: FilesystemIsHealthy",
+			},
+		},
+		{
+			desc:    "unmounted filesystem is cleared",
+			last:    map[string]uint64{"sda1": 2, "sdb": 1},
+			current: map[string]uint64{"sda1": 2},
+			conditions: map[string]types.ConditionStatus{
+				"FilesystemCorruptionProblem":       types.True,
+				"FilesystemCorruptionProblem[sda1]": types.True,
+				"FilesystemCorruptionProblem[sdb]":  types.False,
+			},
+			message: "2 errors recorded on sda1 mounted at /var/lib/kubelet",
+			events: []string{
+				"Node condition FilesystemCorruptionProblem[sdb] is now: False, reason: FilesystemIsHealthy",
+			},
+		},
+		{
+			desc: "read error keeps the conditions",
+			last: map[string]uint64{"sda1": 2},
+			err:  errors.New("sysfs unavailable"),
+		},
+	} {
+		fem := newTestMonitor(t)
+		if test.last != nil {
+			fem.readCounts = func() (map[string]uint64, error) { return test.last, nil }
+			fem.check(now)
+		}
+		fem.readCounts = func() (map[string]uint64, error) { return test.current, test.err }
+
+		status := fem.check(now)
+		if test.conditions == nil {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if !assert.NotNil(t, status, test.desc) {
+			continue
+		}
+		statuses := make(map[string]types.ConditionStatus)
+		for _, condition := range status.Conditions {
+			statuses[condition.Type] = condition.Status
+		}
+		assert.Equal(t, test.conditions, statuses, test.desc)
+		assert.Equal(t, test.message, status.Conditions[0].Message, test.desc)
+		var events []string
+		for _, event := range status.Events {
+			events = append(events, event.Message)
+		}
+		assert.Equal(t, test.events, events, test.desc)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesystemerrormonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	fstypes "k8s.io/node-problem-detector/pkg/filesystemerrormonitor/types"
+)
+
+// readCounters reads the cumulative error count of each filesystem from the sysfs files
+// matching the patterns, keyed by the device of the filesystem.
+func readCounters(patterns []string) (map[string]uint64, error) {
+	counts := make(map[string]uint64)
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		index := fstypes.DeviceIndex(pattern)
+		for _, path := range paths {
+			count, err := readCount(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					// The filesystem was unmounted after the glob.
+					continue
+				}
+				return nil, err
+			}
+			elements := strings.Split(path, "/")
+			if index >= len(elements) {
+				continue
+			}
+			counts[elements[index]] += count
+		}
+	}
+	return counts, nil
+}
+
+func readCount(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q: %v", path, err)
+	}
+	return count, nil
+}
+
+// readMounts reads the first mountpoint of each block device from the mount table, keyed
+// by the kernel name of the device, e.g. "dm-0" for "/dev/mapper/vg-root".
+func readMounts(mountsPath string) (map[string]string, error) {
+	f, err := os.Open(mountsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mounts := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		device := fields[0]
+		if resolved, err := filepath.EvalSymlinks(device); err == nil {
+			device = resolved
+		}
+		name := filepath.Base(device)
+		if _, ok := mounts[name]; !ok {
+			mounts[name] = unescapeMountPoint(fields[1])
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPoint unescapes the octal escapes of the space, tab, newline and backslash
+// characters in a mountpoint of the mount table.
+func unescapeMountPoint(s string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(s)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	defaultSource               = "filesystem-error-monitor"
+	defaultInvokeIntervalString = (60 * time.Second).String()
+	defaultErrorCounters        = []string{"/sys/fs/ext4/*/errors_count"}
+	defaultMountsPath           = "/proc/mounts"
+	defaultEnableMetrics        = true
+	defaultConditionType        = "FilesystemCorruptionProblem"
+)
+
+type FilesystemErrorConfig struct {
+	// Source is the source name of the filesystem error monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which the error counts are read.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// ErrorCounters are the glob patterns of the sysfs files with the cumulative error
+	// count of each filesystem. The path element matched by the first pattern element
+	// with a wildcard is the device of the filesystem, e.g. "sda1" of
+	// "/sys/fs/ext4/sda1/errors_count".
+	ErrorCounters []string `json:"errorCounters"`
+	// MountsPath is the mount table the mountpoints of the devices are read from.
+	MountsPath string `json:"mountsPath"`
+	// ConditionType is the type of the conditions. The condition of each filesystem is
+	// "<ConditionType>[<device>]". Default to "FilesystemCorruptionProblem".
+	ConditionType string `json:"conditionType"`
+	// EnableMetricsReporting describes whether to report problems and error counts as
+	// metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (fec *FilesystemErrorConfig) ApplyConfiguration() error {
+	if fec.Source == "" {
+		fec.Source = defaultSource
+	}
+	if fec.InvokeIntervalString == "" {
+		fec.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if len(fec.ErrorCounters) == 0 {
+		fec.ErrorCounters = defaultErrorCounters
+	}
+	if fec.MountsPath == "" {
+		fec.MountsPath = defaultMountsPath
+	}
+	if fec.ConditionType == "" {
+		fec.ConditionType = defaultConditionType
+	}
+	if fec.EnableMetricsReporting == nil {
+		fec.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	fec.InvokeInterval, err = time.ParseDuration(fec.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", fec.InvokeIntervalString, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (fec *FilesystemErrorConfig) Validate() error {
+	if fec.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", fec.InvokeInterval)
+	}
+	for _, pattern := range fec.ErrorCounters {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid error counter pattern %q: %v", pattern, err)
+		}
+		if DeviceIndex(pattern) < 0 {
+			return fmt.Errorf("error counter pattern %q has no wildcard matching the device", pattern)
+		}
+	}
+	return nil
+}
+
+// DeviceIndex returns the index of the first element of the pattern with a wildcard,
+// which matches the device, or -1 if there is none.
+func DeviceIndex(pattern string) int {
+	for i, element := range strings.Split(pattern, "/") {
+		if strings.ContainsAny(element, "*?[") {
+			return i
+		}
+	}
+	return -1
+}
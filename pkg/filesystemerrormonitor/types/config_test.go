@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    FilesystemErrorConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: FilesystemErrorConfig{},
+		},
+		{
+			name:   "custom error counters",
+			config: FilesystemErrorConfig{ErrorCounters: []string{"/sys/fs/ext4/*/errors_count", "/sys/fs/xfs/*/errors"}},
+		},
+		{
+			name:      "invalid invoke interval",
+			config:    FilesystemErrorConfig{InvokeIntervalString: "1 minute"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid error counter pattern",
+			config:    FilesystemErrorConfig{ErrorCounters: []string{"/sys/fs/ext4/[/errors_count"}},
+			expectErr: true,
+		},
+		{
+			name:      "error counter pattern without device",
+			config:    FilesystemErrorConfig{ErrorCounters: []string{"/sys/fs/ext4/sda1/errors_count"}},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
+
+func TestDeviceIndex(t *testing.T) {
+	for pattern, expected := range map[string]int{
+		"/sys/fs/ext4/*/errors_count":    4,
+		"/sys/fs/xfs/sd?/stats/errors":   4,
+		"/sys/fs/ext4/sda1/errors_count": -1,
+	} {
+		if actual := DeviceIndex(pattern); actual != expected {
+			t.Errorf("Expect device index %d of %q, got %d", expected, pattern, actual)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package flapdamping detects the conditions toggling too often, e.g. because of a
+// check oscillating around its threshold, and damps them so that they do not cause
+// alert storms. A flapping condition is either held in its problem state, or reported
+// with a separate flapping condition, until it is stable again.
+package flapdamping
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+// Mode is how flapping conditions are damped.
+type Mode string
+
+const (
+	// HoldMode holds a flapping condition True until it is stable.
+	HoldMode Mode = "hold"
+	// ConditionMode exports a flapping condition as is, and sets the separate
+	// <Condition>Flapping condition while it is flapping.
+	ConditionMode Mode = "condition"
+)
+
+const (
+	defaultMaxTransitions = 4
+	defaultWindow         = 10 * time.Minute
+	// checkPeriod is the period at which the stable conditions are released.
+	checkPeriod = 30 * time.Second
+
+	// FlappingReason and StableReason are the reasons of the flapping conditions.
+	FlappingReason = "ConditionFlapping"
+	StableReason   = "ConditionStable"
+)
+
+// Config is the configuration of the flap damping.
+type Config struct {
+	// Conditions are the condition types damped, including their instances, e.g.
+	// "DiskReadonly" for "DiskReadonly[sdb]". Default to all condition types.
+	Conditions []string `json:"conditions"`
+	// MaxTransitions is the number of transitions of a condition in the window beyond
+	// which it is flapping. Default to 4.
+	MaxTransitions int `json:"maxTransitions"`
+	// WindowString is the period the transitions are counted over. Default to 10m.
+	WindowString string        `json:"window"`
+	Window       time.Duration `json:"-"`
+	// StablePeriodString is how long a flapping condition must not transition to be
+	// stable again. Default to the window.
+	StablePeriodString string        `json:"stablePeriod"`
+	StablePeriod       time.Duration `json:"-"`
+	// Mode is "hold" (default) or "condition".
+	Mode Mode `json:"mode"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() error {
+	if c.MaxTransitions == 0 {
+		c.MaxTransitions = defaultMaxTransitions
+	}
+	if c.Mode == "" {
+		c.Mode = HoldMode
+	}
+	c.Window = defaultWindow
+	if c.WindowString != "" {
+		var err error
+		if c.Window, err = time.ParseDuration(c.WindowString); err != nil {
+			return fmt.Errorf("invalid window %q: %v", c.WindowString, err)
+		}
+	}
+	c.StablePeriod = c.Window
+	if c.StablePeriodString != "" {
+		var err error
+		if c.StablePeriod, err = time.ParseDuration(c.StablePeriodString); err != nil {
+			return fmt.Errorf("invalid stable period %q: %v", c.StablePeriodString, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *Config) Validate() error {
+	if c.MaxTransitions < 1 {
+		return fmt.Errorf("max transitions %d must be positive", c.MaxTransitions)
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("window %v must be positive", c.Window)
+	}
+	if c.StablePeriod <= 0 {
+		return fmt.Errorf("stable period %v must be positive", c.StablePeriod)
+	}
+	if c.Mode != HoldMode && c.Mode != ConditionMode {
+		return fmt.Errorf("mode %q must be %q or %q", c.Mode, HoldMode, ConditionMode)
+	}
+	for _, condition := range c.Conditions {
+		if condition == "" {
+			return fmt.Errorf("condition type must not be empty")
+		}
+	}
+	return nil
+}
+
+type key struct {
+	source    string
+	condition string
+}
+
+// state is the flap state of a condition type of a source.
+type state struct {
+	// last is the last condition reported by the source.
+	last types.Condition
+	// lastTrue is the last condition reported True.
+	lastTrue *types.Condition
+	// held is the condition exported while flapping in hold mode, the last True condition
+	// when it started flapping.
+	held *types.Condition
+	// transitions are the times of the transitions in the window.
+	transitions    []time.Time
+	lastTransition time.Time
+	flapping       bool
+	// flappingCondition is the <Condition>Flapping condition in condition mode, nil
+	// before the condition first flapped.
+	flappingCondition *types.Condition
+}
+
+// Damper damps the flapping conditions of the statuses. It is not thread-safe.
+type Damper struct {
+	config Config
+	// conditions are the damped condition types, nil for all.
+	conditions map[string]bool
+	states     map[key]*state
+	flapping   metrics.Int64MetricInterface
+}
+
+// NewDamper creates a damper from a config file.
+func NewDamper(configPath string) (*Damper, error) {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	var config Config
+	if err := util.UnmarshalStrict(f, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return nil, fmt.Errorf("failed to apply configuration file %q: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", configPath, err)
+	}
+
+	d := newDamper(config)
+	d.flapping, err = metrics.NewInt64Metric(
+		metrics.ConditionFlappingID,
+		string(metrics.ConditionFlappingID),
+		"Whether the condition of a type is flapping, 1 while it is damped and 0 otherwise.",
+		"1",
+		metrics.LastValue,
+		[]string{"type"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.ConditionFlappingID, err)
+	}
+	return d, nil
+}
+
+func newDamper(config Config) *Damper {
+	d := &Damper{
+		config: config,
+		states: make(map[key]*state),
+	}
+	if len(config.Conditions) > 0 {
+		d.conditions = make(map[string]bool)
+		for _, condition := range config.Conditions {
+			d.conditions[condition] = true
+		}
+	}
+	return d
+}
+
+// CheckPeriod returns the period at which Release should be called.
+func (d *Damper) CheckPeriod() time.Duration {
+	return checkPeriod
+}
+
+// Damp returns the status with its flapping conditions damped. The events are kept as
+// is.
+func (d *Damper) Damp(status *types.Status, now time.Time) *types.Status {
+	damped := *status
+	damped.Conditions = nil
+	for _, condition := range status.Conditions {
+		if !d.damped(condition.Type) {
+			damped.Conditions = append(damped.Conditions, condition)
+			continue
+		}
+		s, ok := d.states[key{source: status.Source, condition: condition.Type}]
+		if !ok {
+			s = &state{}
+			d.states[key{source: status.Source, condition: condition.Type}] = s
+		}
+		// The first status of a condition is a transition only when it is True.
+		if (ok && s.last.Status != condition.Status) || (!ok && condition.Status == types.True) {
+			s.transitions = append(s.transitions, now)
+			s.lastTransition = now
+		}
+		s.last = condition
+		if condition.Status == types.True {
+			c := condition
+			s.lastTrue = &c
+		}
+		s.transitions = after(s.transitions, now.Add(-d.config.Window))
+		if !s.flapping && len(s.transitions) > d.config.MaxTransitions {
+			d.startFlapping(condition.Type, s, now)
+		} else if s.flapping && now.Sub(s.lastTransition) >= d.config.StablePeriod {
+			d.stopFlapping(condition.Type, s, now)
+		}
+		damped.Conditions = append(damped.Conditions, d.conditionsOf(s)...)
+	}
+	return &damped
+}
+
+// Release returns the statuses releasing the flapping conditions which became stable,
+// one per source.
+func (d *Damper) Release(now time.Time) []*types.Status {
+	released := map[string]*types.Status{}
+	for k, s := range d.states {
+		if !s.flapping || now.Sub(s.lastTransition) < d.config.StablePeriod {
+			continue
+		}
+		d.stopFlapping(k.condition, s, now)
+		status, ok := released[k.source]
+		if !ok {
+			status = &types.Status{Source: k.source}
+			released[k.source] = status
+		}
+		status.Conditions = append(status.Conditions, d.conditionsOf(s)...)
+	}
+	var statuses []*types.Status
+	for _, status := range released {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Source < statuses[j].Source })
+	return statuses
+}
+
+// damped returns whether the condition type is damped. The condition types include
+// their instances.
+func (d *Damper) damped(conditionType string) bool {
+	if d.conditions == nil {
+		return true
+	}
+	if d.conditions[conditionType] {
+		return true
+	}
+	i := strings.Index(conditionType, "[")
+	return i > 0 && d.conditions[conditionType[:i]]
+}
+
+func (d *Damper) startFlapping(conditionType string, s *state, now time.Time) {
+	glog.Warningf("Condition %s is flapping, it transitioned %d times in the last %v", conditionType, len(s.transitions), d.config.Window)
+	s.flapping = true
+	if d.config.Mode == HoldMode {
+		held := *s.lastTrue
+		held.Message = fmt.Sprintf("%s (held while flapping)", held.Message)
+		s.held = &held
+	} else {
+		s.flappingCondition = &types.Condition{
+			Type:       flappingType(conditionType),
+			Status:     types.True,
+			Transition: now,
+			Reason:     FlappingReason,
+			Message: fmt.Sprintf("%s transitioned %d times in the last %v, it is flapping until it does not transition for %v",
+				conditionType, len(s.transitions), d.config.Window, d.config.StablePeriod),
+		}
+	}
+	d.record(conditionType, 1)
+}
+
+func (d *Damper) stopFlapping(conditionType string, s *state, now time.Time) {
+	glog.Infof("Condition %s is stable, it did not transition for %v", conditionType, d.config.StablePeriod)
+	s.flapping = false
+	s.held = nil
+	if d.config.Mode == ConditionMode {
+		s.flappingCondition = &types.Condition{
+			Type:       flappingType(conditionType),
+			Status:     types.False,
+			Transition: now,
+			Reason:     StableReason,
+			Message:    fmt.Sprintf("%s did not transition for %v", conditionType, d.config.StablePeriod),
+		}
+	}
+	d.record(conditionType, 0)
+}
+
+// conditionsOf returns the conditions exported for the state. In hold mode, a flapping
+// condition is held True. In condition mode, the condition is
+// exported as is, with its flapping condition once it flapped.
+func (d *Damper) conditionsOf(s *state) []types.Condition {
+	if d.config.Mode == HoldMode {
+		if s.flapping {
+			return []types.Condition{*s.held}
+		}
+		return []types.Condition{s.last}
+	}
+	if s.flappingCondition == nil {
+		return []types.Condition{s.last}
+	}
+	return []types.Condition{s.last, *s.flappingCondition}
+}
+
+func (d *Damper) record(conditionType string, value int64) {
+	if d.flapping == nil {
+		return
+	}
+	if err := d.flapping.Record(map[string]string{"type": conditionType}, value); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.ConditionFlappingID, err)
+	}
+}
+
+// flappingType returns the type of the flapping condition of the condition type, e.g.
+// "DiskReadonlyFlapping[sdb]" for "DiskReadonly[sdb]".
+func flappingType(conditionType string) string {
+	if i := strings.Index(conditionType, "["); i > 0 {
+		return conditionType[:i] + "Flapping" + conditionType[i:]
+	}
+	return conditionType + "Flapping"
+}
+
+func after(times []time.Time, start time.Time) []time.Time {
+	var kept []time.Time
+	for _, t := range times {
+		if t.After(start) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flapdamping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    Config
+		wantError bool
+	}{
+		{
+			name:   "default",
+			config: Config{},
+		},
+		{
+			name:   "condition mode",
+			config: Config{Conditions: []string{"KernelDeadlock"}, MaxTransitions: 2, WindowString: "5m", StablePeriodString: "30m", Mode: ConditionMode},
+		},
+		{
+			name:      "unknown mode",
+			config:    Config{Mode: "drop"},
+			wantError: true,
+		},
+		{
+			name:      "negative max transitions",
+			config:    Config{MaxTransitions: -1},
+			wantError: true,
+		},
+		{
+			name:      "negative window",
+			config:    Config{WindowString: "-1m"},
+			wantError: true,
+		},
+		{
+			name:      "empty condition",
+			config:    Config{Conditions: []string{""}},
+			wantError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.ApplyConfiguration(); err != nil {
+				t.Fatalf("Unexpected error applying config %+v: %v", test.config, err)
+			}
+			err := test.config.Validate()
+			if test.wantError && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.wantError && err != nil {
+				t.Errorf("Unexpected error for config %+v: %v", test.config, err)
+			}
+		})
+	}
+}
+
+func newTestDamper(t *testing.T, config Config) (*Damper, *metrics.FakeInt64Metric) {
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	d := newDamper(config)
+	flapping := metrics.NewFakeInt64Metric("flapping", metrics.LastValue, []string{"type"})
+	d.flapping = flapping
+	return d, flapping
+}
+
+func status(conditionType string, conditionStatus types.ConditionStatus, transition time.Time, reason string) *types.Status {
+	return &types.Status{
+		Source:     "kernel-monitor",
+		Conditions: []types.Condition{{Type: conditionType, Status: conditionStatus, Transition: transition, Reason: reason, Message: reason}},
+	}
+}
+
+func TestHoldMode(t *testing.T) {
+	d, flapping := newTestDamper(t, Config{MaxTransitions: 2, WindowString: "10m", StablePeriodString: "5m"})
+	start := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	// A condition first seen False is not a transition, and conditions are exported as is
+	// until they flap.
+	assert.Equal(t, status("KernelDeadlock", types.False, at(0), "KernelHasNoDeadlock"),
+		d.Damp(status("KernelDeadlock", types.False, at(0), "KernelHasNoDeadlock"), at(0)))
+	assert.Equal(t, status("KernelDeadlock", types.True, at(1), "DockerHung"),
+		d.Damp(status("KernelDeadlock", types.True, at(1), "DockerHung"), at(1)))
+	assert.Equal(t, status("KernelDeadlock", types.False, at(2), "KernelHasNoDeadlock"),
+		d.Damp(status("KernelDeadlock", types.False, at(2), "KernelHasNoDeadlock"), at(2)))
+
+	// The third transition in the window holds the condition True.
+	held := types.Condition{Type: "KernelDeadlock", Status: types.True, Transition: at(3), Reason: "ContainerdHung", Message: "ContainerdHung (held while flapping)"}
+	damped := d.Damp(status("KernelDeadlock", types.True, at(3), "ContainerdHung"), at(3))
+	assert.Equal(t, []types.Condition{held}, damped.Conditions)
+	assert.Equal(t, []metrics.Int64MetricRepresentation{{Name: "flapping", Labels: map[string]string{"type": "KernelDeadlock"}, Value: 1}}, flapping.ListMetrics())
+	damped = d.Damp(status("KernelDeadlock", types.False, at(4), "KernelHasNoDeadlock"), at(4))
+	assert.Equal(t, []types.Condition{held}, damped.Conditions)
+
+	// The condition is released when it did not transition for the stable period.
+	assert.Empty(t, d.Release(at(8)))
+	released := d.Release(at(9))
+	assert.Equal(t, []*types.Status{status("KernelDeadlock", types.False, at(4), "KernelHasNoDeadlock")}, released)
+	assert.Equal(t, int64(0), flapping.ListMetrics()[0].Value)
+}
+
+func TestConditionMode(t *testing.T) {
+	d, _ := newTestDamper(t, Config{Conditions: []string{"DiskReadonly"}, MaxTransitions: 1, WindowString: "10m", Mode: ConditionMode})
+	start := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+
+	// The condition types not configured are not damped.
+	for i := 0; i < 4; i++ {
+		conditionStatus := types.True
+		if i%2 == 1 {
+			conditionStatus = types.False
+		}
+		s := status("KernelDeadlock", conditionStatus, start, "")
+		assert.Equal(t, s, d.Damp(s, start))
+	}
+
+	d.Damp(status("DiskReadonly[sdb]", types.True, start, "DiskRemountedReadonly"), start)
+	damped := d.Damp(status("DiskReadonly[sdb]", types.False, start.Add(time.Minute), "DiskIsWritable"), start.Add(time.Minute))
+	if assert.Len(t, damped.Conditions, 2) {
+		assert.Equal(t, types.False, damped.Conditions[0].Status)
+		assert.Equal(t, types.Condition{
+			Type:       "DiskReadonlyFlapping[sdb]",
+			Status:     types.True,
+			Transition: start.Add(time.Minute),
+			Reason:     FlappingReason,
+			Message:    "DiskReadonly[sdb] transitioned 2 times in the last 10m0s, it is flapping until it does not transition for 10m0s",
+		}, damped.Conditions[1])
+	}
+
+	// The flapping condition stays False once the condition is stable.
+	released := d.Release(start.Add(11 * time.Minute))
+	if assert.Len(t, released, 1) && assert.Len(t, released[0].Conditions, 2) {
+		assert.Equal(t, types.False, released[0].Conditions[1].Status)
+		assert.Equal(t, StableReason, released[0].Conditions[1].Reason)
+	}
+	damped = d.Damp(status("DiskReadonly[sdb]", types.False, start.Add(time.Minute), "DiskIsWritable"), start.Add(12*time.Minute))
+	assert.Equal(t, released[0].Conditions, damped.Conditions)
+}
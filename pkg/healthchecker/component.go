@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/cmd/healthchecker/options"
+	"k8s.io/node-problem-detector/pkg/healthchecker/types"
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+// newComponentHealthChecker returns a health checker of the component configured in the
+// configuration file of the options.
+func newComponentHealthChecker(hco *options.HealthCheckerOptions) (types.HealthChecker, error) {
+	config, err := loadComponentConfig(hco.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	// The uptime of the systemd service protects the component from being repaired
+	// again before it could come up.
+	if hco.EnableRepair && config.SystemdService == "" {
+		return nil, fmt.Errorf("systemdService of component %q cannot be empty when repair is enabled", config.Name)
+	}
+	coolDownTime := hco.CoolDownTime
+	if config.RepairPolicy.CoolDownTimeString != "" {
+		coolDownTime = config.RepairPolicy.CoolDownTime
+	}
+	r := newRepairer(config)
+	return &healthChecker{
+		enableRepair:       hco.EnableRepair,
+		healthCheckTimeout: hco.HealthCheckTimeout,
+		coolDownTime:       coolDownTime,
+		healthCheckFunc:    getComponentCheckFunc(config, hco.HealthCheckTimeout),
+		healthyFunc:        r.healthy,
+		repairFunc:         r.repair,
+		uptimeFunc:         getUptimeFunc(config.SystemdService),
+	}, nil
+}
+
+// loadComponentConfig loads the configuration file of a component.
+func loadComponentConfig(path string) (types.ComponentConfig, error) {
+	var config types.ComponentConfig
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read configuration file %q: %v", path, err)
+	}
+	if err := util.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("failed to unmarshal configuration file %q: %v", path, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return config, fmt.Errorf("failed to apply configuration of %q: %v", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("failed to validate configuration of %q: %v", path, err)
+	}
+	return config, nil
+}
+
+// getComponentCheckFunc returns the health check function of the check of a component.
+func getComponentCheckFunc(config types.ComponentConfig, timeout time.Duration) func() bool {
+	check := config.Check
+	var checkFunc func() error
+	switch check.Type {
+	case types.SystemdCheck:
+		checkFunc = func() error {
+			_, err := execCommand(timeout, "systemctl", "is-active", "--quiet", config.SystemdService)
+			return err
+		}
+	case types.HTTPCheck:
+		checkFunc = func() error {
+			return checkHTTP(check.Endpoint, timeout)
+		}
+	case types.GRPCCheck:
+		checkFunc = func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return checkGRPC(ctx, check.Endpoint, check.Service)
+		}
+	case types.TCPCheck:
+		checkFunc = func() error {
+			conn, err := net.DialTimeout("tcp", check.Endpoint, timeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+	}
+	return func() bool {
+		if err := checkFunc(); err != nil {
+			glog.Infof("health-checker: %s check of %s failed: %v\n", check.Type, config.Name, err)
+			return false
+		}
+		return true
+	}
+}
+
+// checkHTTP checks that the endpoint responds with a 2xx status.
+func checkHTTP(endpoint string, timeout time.Duration) error {
+	httpClient := http.Client{Timeout: timeout}
+	response, err := httpClient.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status %q", response.Status)
+	}
+	return nil
+}
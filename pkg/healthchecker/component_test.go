@@ -0,0 +1,171 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"k8s.io/node-problem-detector/cmd/healthchecker/options"
+	"k8s.io/node-problem-detector/pkg/healthchecker/types"
+)
+
+func TestValidateComponentConfig(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		config      types.ComponentConfig
+		valid       bool
+	}{
+		{
+			description: "systemd check",
+			config:      types.ComponentConfig{Name: "kube-proxy", SystemdService: "kube-proxy", Check: types.CheckConfig{Type: types.SystemdCheck}},
+			valid:       true,
+		},
+		{
+			description: "systemd check without service",
+			config:      types.ComponentConfig{Name: "kube-proxy", Check: types.CheckConfig{Type: types.SystemdCheck}},
+		},
+		{
+			description: "http check",
+			config:      types.ComponentConfig{Name: "kube-proxy", Check: types.CheckConfig{Type: types.HTTPCheck, Endpoint: "http://127.0.0.1:10256/healthz"}},
+			valid:       true,
+		},
+		{
+			description: "http check without URL",
+			config:      types.ComponentConfig{Name: "kube-proxy", Check: types.CheckConfig{Type: types.HTTPCheck, Endpoint: "127.0.0.1:10256"}},
+		},
+		{
+			description: "grpc check",
+			config:      types.ComponentConfig{Name: "calico", Check: types.CheckConfig{Type: types.GRPCCheck, Endpoint: "127.0.0.1:9099", Service: "felix"}},
+			valid:       true,
+		},
+		{
+			description: "tcp check without port",
+			config:      types.ComponentConfig{Name: "calico", Check: types.CheckConfig{Type: types.TCPCheck, Endpoint: "127.0.0.1"}},
+		},
+		{
+			description: "service of a tcp check",
+			config:      types.ComponentConfig{Name: "calico", Check: types.CheckConfig{Type: types.TCPCheck, Endpoint: "127.0.0.1:9099", Service: "felix"}},
+		},
+		{
+			description: "name with a path separator",
+			config:      types.ComponentConfig{Name: "../kube-proxy", SystemdService: "kube-proxy", Check: types.CheckConfig{Type: types.SystemdCheck}},
+		},
+		{
+			description: "unknown check",
+			config:      types.ComponentConfig{Name: "calico", Check: types.CheckConfig{Type: "ping"}},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.NoError(t, tc.config.ApplyConfiguration())
+			if tc.valid {
+				assert.NoError(t, tc.config.Validate())
+			} else {
+				assert.Error(t, tc.config.Validate())
+			}
+		})
+	}
+}
+
+func TestRepoComponentConfigs(t *testing.T) {
+	paths, err := filepath.Glob("../../config/health-checker/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		_, err := NewHealthChecker(&options.HealthCheckerOptions{ConfigFile: path, EnableRepair: true})
+		assert.NoError(t, err, path)
+	}
+}
+
+func TestNewComponentHealthChecker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "component.json")
+	config := `{"name": "kube-proxy", "check": {"type": "http", "endpoint": "http://127.0.0.1:10256/healthz"}}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewHealthChecker(&options.HealthCheckerOptions{ConfigFile: path})
+	assert.NoError(t, err)
+	_, err = NewHealthChecker(&options.HealthCheckerOptions{ConfigFile: path, EnableRepair: true})
+	assert.Error(t, err, "repair requires the systemd service for its cool down")
+	_, err = NewHealthChecker(&options.HealthCheckerOptions{ConfigFile: filepath.Join(dir, "missing.json")})
+	assert.Error(t, err)
+}
+
+func TestComponentChecks(t *testing.T) {
+	healthy := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	check := getComponentCheckFunc(types.ComponentConfig{Name: "test", Check: types.CheckConfig{Type: types.HTTPCheck, Endpoint: server.URL}}, time.Second)
+	assert.True(t, check())
+	healthy = false
+	assert.False(t, check())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check = getComponentCheckFunc(types.ComponentConfig{Name: "test", Check: types.CheckConfig{Type: types.TCPCheck, Endpoint: listener.Addr().String()}}, time.Second)
+	assert.True(t, check())
+	listener.Close()
+	assert.False(t, check())
+}
+
+func TestGRPCCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server reports the "felix" service SERVING, and other services NOT_SERVING.
+	server := grpc.NewServer(grpc.CustomCodec(rawCodec{}), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		var request []byte
+		if err := stream.RecvMsg(&request); err != nil {
+			return err
+		}
+		response := []byte{1 << 3, 2}
+		if string(request) == "\x0a\x05felix" {
+			response[1] = grpcServing
+		}
+		return stream.SendMsg(&response)
+	}))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	config := types.ComponentConfig{Name: "calico", Check: types.CheckConfig{Type: types.GRPCCheck, Endpoint: listener.Addr().String(), Service: "felix"}}
+	assert.True(t, getComponentCheckFunc(config, 5*time.Second)())
+	config.Check.Service = "bird"
+	assert.False(t, getComponentCheckFunc(config, 5*time.Second)())
+}
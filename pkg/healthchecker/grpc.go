@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+const (
+	// grpcHealthCheckMethod is the method of the gRPC health checking protocol.
+	grpcHealthCheckMethod = "/grpc.health.v1.Health/Check"
+	// grpcServing is the SERVING status of the gRPC health checking protocol.
+	grpcServing = 1
+)
+
+// rawCodec passes the messages of a gRPC call through as bytes, so that the health
+// checking protocol is spoken without its generated code.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "raw"
+}
+
+func (c rawCodec) String() string {
+	return c.Name()
+}
+
+// checkGRPC checks that the service at the address reports SERVING through the gRPC
+// health checking protocol. An empty service checks the whole server.
+func checkGRPC(ctx context.Context, address, service string) error {
+	conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// HealthCheckRequest{service = 1}.
+	request := proto.NewBuffer(nil)
+	if service != "" {
+		request.EncodeVarint(1<<3 | proto.WireBytes)
+		request.EncodeStringBytes(service)
+	}
+	in := request.Bytes()
+	var out []byte
+	if err := conn.Invoke(ctx, grpcHealthCheckMethod, &in, &out, grpc.ForceCodec(rawCodec{})); err != nil {
+		return err
+	}
+	status, err := decodeHealthCheckResponse(out)
+	if err != nil {
+		return err
+	}
+	if status != grpcServing {
+		return fmt.Errorf("service %q is not serving, status %d", service, status)
+	}
+	return nil
+}
+
+// decodeHealthCheckResponse returns the status of a HealthCheckResponse{status = 1}.
+func decodeHealthCheckResponse(data []byte) (uint64, error) {
+	var status uint64
+	for len(data) > 0 {
+		key, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return 0, fmt.Errorf("malformed health check response")
+		}
+		if key != 1<<3|proto.WireVarint {
+			return 0, fmt.Errorf("unexpected field %d of type %d in health check response", key>>3, key&7)
+		}
+		data = data[n:]
+		if status, n = proto.DecodeVarint(data); n == 0 {
+			return 0, fmt.Errorf("malformed health check response")
+		}
+		data = data[n:]
+	}
+	return status, nil
+}
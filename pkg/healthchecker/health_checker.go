@@ -28,11 +28,14 @@ import (
 
 	"k8s.io/node-problem-detector/cmd/healthchecker/options"
 	"k8s.io/node-problem-detector/pkg/healthchecker/types"
+	"k8s.io/node-problem-detector/pkg/util/cri"
 )
 
 type healthChecker struct {
 	enableRepair    bool
 	healthCheckFunc func() bool
+	// healthyFunc is called when the component is healthy, if set.
+	healthyFunc func()
 	// The repair is "best-effort" and ignores the error from the underlying actions.
 	// The bash commands to kill the process will fail if the service is down and hence ignore.
 	repairFunc         func()
@@ -44,6 +47,9 @@ type healthChecker struct {
 
 // NewHealthChecker returns a new health checker configured with the given options.
 func NewHealthChecker(hco *options.HealthCheckerOptions) (types.HealthChecker, error) {
+	if hco.ConfigFile != "" {
+		return newComponentHealthChecker(hco)
+	}
 	hc := &healthChecker{
 		enableRepair:       hco.EnableRepair,
 		crictlPath:         hco.CriCtlPath,
@@ -114,7 +120,17 @@ func getHealthCheckFunc(hco *options.HealthCheckerOptions) func() bool {
 		}
 	case types.CRIComponent:
 		return func() bool {
-			if _, err := execCommand(hco.HealthCheckTimeout, hco.CriCtlPath, "--runtime-endpoint="+hco.CriSocketPath, "--image-endpoint="+hco.CriSocketPath, "pods"); err != nil {
+			endpoint, err := cri.ParseEndpoint(hco.CriSocketPath)
+			if err != nil {
+				glog.Infof("health-checker: %v\n", err)
+				return false
+			}
+			// Fail fast when the endpoint is not served, e.g. the socket is removed.
+			if err := cri.ProbeEndpoint(endpoint, hco.HealthCheckTimeout); err != nil {
+				glog.Infof("health-checker: cri endpoint %s is not served: %v\n", endpoint, err)
+				return false
+			}
+			if _, err := execCommand(hco.HealthCheckTimeout, hco.CriCtlPath, "--runtime-endpoint="+endpoint.String(), "--image-endpoint="+endpoint.String(), "pods"); err != nil {
 				return false
 			}
 			return true
@@ -128,6 +144,9 @@ func getHealthCheckFunc(hco *options.HealthCheckerOptions) func() bool {
 func (hc *healthChecker) CheckHealth() bool {
 	healthy := hc.healthCheckFunc()
 	if healthy {
+		if hc.healthyFunc != nil {
+			hc.healthyFunc()
+		}
 		return true
 	}
 	// The service is unhealthy.
@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/healthchecker/types"
+)
+
+// repairState is the state of the repairs of a component, persisted across restarts.
+type repairState struct {
+	// Attempts is the number of repairs attempted since the component was last healthy.
+	Attempts int `json:"attempts"`
+	// LastAttempt is the time of the last repair attempt.
+	LastAttempt time.Time `json:"lastAttempt"`
+	// Total is the number of repairs ever attempted.
+	Total int `json:"total"`
+}
+
+// repairer repairs a component following its repair policy.
+type repairer struct {
+	config types.ComponentConfig
+	now    func() time.Time
+	exec   func(command string, args ...string)
+}
+
+func newRepairer(config types.ComponentConfig) *repairer {
+	return &repairer{
+		config: config,
+		now:    time.Now,
+		exec: func(command string, args ...string) {
+			execCommand(types.CmdTimeout, command, args...)
+		},
+	}
+}
+
+// healthy resets the repair attempts once the component is healthy again.
+func (r *repairer) healthy() {
+	state, err := loadState(r.config.RepairPolicy.StateFile)
+	if err != nil {
+		glog.Errorf("health-checker: %v\n", err)
+		return
+	}
+	if state.Attempts == 0 {
+		return
+	}
+	state.Attempts = 0
+	if err := saveState(r.config.RepairPolicy.StateFile, state); err != nil {
+		glog.Errorf("health-checker: %v\n", err)
+	}
+}
+
+// repair attempts a repair, unless the repairs are exhausted or backing off. The attempt is
+// persisted before the repair, so that a repair killing the health checker still counts.
+func (r *repairer) repair() {
+	policy := r.config.RepairPolicy
+	state, err := loadState(policy.StateFile)
+	if err != nil {
+		glog.Errorf("health-checker: %v\n", err)
+		return
+	}
+	if policy.MaxAttempts > 0 && state.Attempts >= policy.MaxAttempts {
+		glog.Warningf("health-checker: %d repairs of %s exhausted\n", state.Attempts, r.config.Name)
+		return
+	}
+	now := r.now()
+	if state.Attempts > 0 {
+		if next := state.LastAttempt.Add(backoff(policy, state.Attempts)); now.Before(next) {
+			glog.Infof("health-checker: backing off the repair of %s until %v\n", r.config.Name, next)
+			return
+		}
+	}
+	state.Attempts++
+	state.Total++
+	state.LastAttempt = now
+	command, err := renderRepair(r.config, state.Attempts)
+	if err != nil {
+		glog.Errorf("health-checker: %v\n", err)
+		return
+	}
+	if err := saveState(policy.StateFile, state); err != nil {
+		glog.Errorf("health-checker: %v\n", err)
+		return
+	}
+	r.exec(command[0], command[1:]...)
+}
+
+// backoff returns the delay after the given number of repair attempts.
+func backoff(policy types.RepairPolicy, attempts int) time.Duration {
+	delay := policy.Backoff
+	for i := 1; i < attempts && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+	return delay
+}
+
+// renderRepair renders the repair command of the attempt.
+func renderRepair(config types.ComponentConfig, attempt int) ([]string, error) {
+	data := types.RepairTemplateData{Name: config.Name, SystemdService: config.SystemdService, Attempt: attempt}
+	var command []string
+	for _, arg := range config.Repair {
+		t, err := template.New("").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := t.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("failed to render repair argument %q: %v", arg, err)
+		}
+		command = append(command, b.String())
+	}
+	return command, nil
+}
+
+// Report reports the repairs of the component configured in the configuration file, and
+// returns whether there is a problem to report, with its message. The repair attempts are
+// reported once each, and the repairs are reported exhausted until the component is
+// healthy again.
+func Report(report, configFile string) (bool, string, error) {
+	config, err := loadComponentConfig(configFile)
+	if err != nil {
+		return false, "", err
+	}
+	policy := config.RepairPolicy
+	state, err := loadState(policy.StateFile)
+	if err != nil {
+		return false, "", err
+	}
+	switch report {
+	case types.RepairAttemptsReport:
+		reportedFile := policy.StateFile + ".reported"
+		reported, err := loadState(reportedFile)
+		if err != nil {
+			return false, "", err
+		}
+		if state.Total <= reported.Total {
+			return false, "", nil
+		}
+		if err := saveState(reportedFile, repairState{Total: state.Total}); err != nil {
+			return false, "", err
+		}
+		return true, fmt.Sprintf("%s was repaired at %s, attempt %d since it was last healthy",
+			config.Name, state.LastAttempt.Format(time.RFC3339), state.Attempts), nil
+	case types.RepairsExhaustedReport:
+		if policy.MaxAttempts == 0 || state.Attempts < policy.MaxAttempts {
+			return false, "", nil
+		}
+		return true, fmt.Sprintf("%s is still unhealthy after %d repair attempts", config.Name, state.Attempts), nil
+	}
+	return false, "", fmt.Errorf("unknown report %q", report)
+}
+
+// loadState loads a repair state, which is empty if it was never saved.
+func loadState(path string) (repairState, error) {
+	var state repairState
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read repair state %q: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to unmarshal repair state %q: %v", path, err)
+	}
+	return state, nil
+}
+
+// saveState saves a repair state atomically.
+func saveState(path string, state repairState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create the directory of repair state %q: %v", path, err)
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write repair state %q: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write repair state %q: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/healthchecker/types"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := types.RepairPolicy{Backoff: time.Minute, MaxBackoff: 5 * time.Minute}
+	assert.Equal(t, time.Minute, backoff(policy, 1))
+	assert.Equal(t, 2*time.Minute, backoff(policy, 2))
+	assert.Equal(t, 4*time.Minute, backoff(policy, 3))
+	assert.Equal(t, 5*time.Minute, backoff(policy, 4))
+	assert.Equal(t, time.Duration(0), backoff(types.RepairPolicy{MaxBackoff: time.Hour}, 3))
+}
+
+func TestRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := types.ComponentConfig{
+		Name:           "kube-proxy",
+		SystemdService: "kube-proxy",
+		Check:          types.CheckConfig{Type: types.SystemdCheck},
+		Repair:         []string{"systemctl", "restart", "{{ .SystemdService }}", "--attempt={{ .Attempt }}"},
+		RepairPolicy: types.RepairPolicy{
+			BackoffString: "1m",
+			MaxAttempts:   3,
+			StateFile:     filepath.Join(dir, "kube-proxy.json"),
+		},
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	configFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configFile, []byte(`{"name": "kube-proxy", "systemdService": "kube-proxy", "check": {"type": "systemd"},
+		"repairPolicy": {"maxAttempts": 3, "stateFile": "`+config.RepairPolicy.StateFile+`"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1000, 0)
+	var repairs [][]string
+	newTestRepairer := func(now time.Time) *repairer {
+		r := newRepairer(config)
+		r.now = func() time.Time { return now }
+		r.exec = func(command string, args ...string) {
+			repairs = append(repairs, append([]string{command}, args...))
+		}
+		return r
+	}
+	report := func(report string) (bool, string) {
+		problem, message, err := Report(report, configFile)
+		assert.NoError(t, err)
+		return problem, message
+	}
+
+	newTestRepairer(start).repair()
+	assert.Equal(t, [][]string{{"systemctl", "restart", "kube-proxy", "--attempt=1"}}, repairs)
+	problem, message := report(types.RepairAttemptsReport)
+	assert.True(t, problem)
+	assert.Equal(t, "kube-proxy was repaired at "+start.Format(time.RFC3339)+", attempt 1 since it was last healthy", message)
+	// Each attempt is reported once.
+	problem, _ = report(types.RepairAttemptsReport)
+	assert.False(t, problem)
+
+	// The second repair backs off for a minute, the third for two, persisted across
+	// restarts of the health checker.
+	newTestRepairer(start.Add(30 * time.Second)).repair()
+	assert.Len(t, repairs, 1)
+	newTestRepairer(start.Add(time.Minute)).repair()
+	newTestRepairer(start.Add(2 * time.Minute)).repair()
+	assert.Len(t, repairs, 2)
+	newTestRepairer(start.Add(3 * time.Minute)).repair()
+	assert.Len(t, repairs, 3)
+	problem, _ = report(types.RepairsExhaustedReport)
+	assert.True(t, problem)
+	newTestRepairer(start.Add(time.Hour)).repair()
+	assert.Len(t, repairs, 3, "the repairs are exhausted")
+
+	// The attempts are reset once the component is healthy again.
+	newTestRepairer(start.Add(time.Hour)).healthy()
+	problem, _ = report(types.RepairsExhaustedReport)
+	assert.False(t, problem)
+	newTestRepairer(start.Add(time.Hour)).repair()
+	assert.Equal(t, []string{"systemctl", "restart", "kube-proxy", "--attempt=1"}, repairs[3])
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// SystemdCheck checks that a systemd unit is active.
+	SystemdCheck = "systemd"
+	// HTTPCheck checks that a local HTTP endpoint responds with a 2xx status.
+	HTTPCheck = "http"
+	// GRPCCheck checks that a local endpoint serves the gRPC health checking protocol.
+	GRPCCheck = "grpc"
+	// TCPCheck checks that a local TCP port accepts connections.
+	TCPCheck = "tcp"
+)
+
+// CheckConfig describes how the health of a component is checked.
+type CheckConfig struct {
+	// Type is the type of the check: "systemd", "http", "grpc" or "tcp".
+	Type string `json:"type"`
+	// Endpoint is the URL of an http check, e.g. "http://127.0.0.1:10256/healthz", or the
+	// address of a grpc or tcp check, e.g. "127.0.0.1:9099". The systemd check checks the
+	// systemd service of the component.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Service is the service name sent in the request of a grpc check. Default to the
+	// health of the whole server.
+	Service string `json:"service,omitempty"`
+}
+
+// DefaultRepairStateDir is the directory the repair states of the components are persisted
+// in by default.
+var DefaultRepairStateDir = "/var/lib/node-problem-detector/health-checker"
+
+// defaultMaxBackoffString is the default maximum delay between two repairs.
+var defaultMaxBackoffString = (time.Hour).String()
+
+// RepairPolicy describes how often a component is repaired.
+type RepairPolicy struct {
+	// CoolDownTimeString is the time the systemd service must be up before the component
+	// is repaired, e.g. "2m". Default to the cooldown-time flag.
+	CoolDownTimeString string        `json:"coolDownTime,omitempty"`
+	CoolDownTime       time.Duration `json:"-"`
+	// BackoffString is the minimum delay between the first two repairs, e.g. "1m". The
+	// delay doubles after each repair, up to the maximum backoff. Default to no delay.
+	BackoffString string        `json:"backoff,omitempty"`
+	Backoff       time.Duration `json:"-"`
+	// MaxBackoffString is the maximum delay between two repairs. Default to "1h".
+	MaxBackoffString string        `json:"maxBackoff,omitempty"`
+	MaxBackoff       time.Duration `json:"-"`
+	// MaxAttempts is the number of repairs attempted until the component is healthy again,
+	// after which the repairs are exhausted. Default to no limit.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// StateFile is the file the repair attempts are persisted in across restarts. Default
+	// to the name of the component in DefaultRepairStateDir.
+	StateFile string `json:"stateFile,omitempty"`
+}
+
+// RepairTemplateData is the data the arguments of the repair command are rendered with.
+type RepairTemplateData struct {
+	// Name is the name of the component.
+	Name string
+	// SystemdService is the systemd unit running the component.
+	SystemdService string
+	// Attempt is the number of the repair attempt, starting at 1.
+	Attempt int
+}
+
+// ComponentConfig describes the health check and the repair of any component, e.g. a
+// systemd unit or a daemon serving a health endpoint.
+type ComponentConfig struct {
+	// Name is the name of the component, reported when it is unhealthy.
+	Name string `json:"name"`
+	// SystemdService is the systemd unit running the component. It is checked by the
+	// systemd check, and its uptime must exceed the cool down time before a repair.
+	SystemdService string `json:"systemdService,omitempty"`
+	// Check is the health check of the component.
+	Check CheckConfig `json:"check"`
+	// Repair is the command, with its arguments, repairing the component. The arguments are
+	// templates rendered with RepairTemplateData, e.g. "{{ .SystemdService }}". Default to
+	// kill the main process of the systemd service.
+	Repair []string `json:"repair,omitempty"`
+	// RepairPolicy describes how often the component is repaired.
+	RepairPolicy RepairPolicy `json:"repairPolicy"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (cc *ComponentConfig) ApplyConfiguration() error {
+	if len(cc.Repair) == 0 && cc.SystemdService != "" {
+		cc.Repair = []string{"systemctl", "kill", "--kill-who=main", cc.SystemdService}
+	}
+	policy := &cc.RepairPolicy
+	if policy.MaxBackoffString == "" {
+		policy.MaxBackoffString = defaultMaxBackoffString
+	}
+	if policy.StateFile == "" && cc.Name != "" {
+		policy.StateFile = filepath.Join(DefaultRepairStateDir, cc.Name+".json")
+	}
+
+	var err error
+	for _, duration := range []struct {
+		name   string
+		value  string
+		parsed *time.Duration
+	}{
+		{"coolDownTime", policy.CoolDownTimeString, &policy.CoolDownTime},
+		{"backoff", policy.BackoffString, &policy.Backoff},
+		{"maxBackoff", policy.MaxBackoffString, &policy.MaxBackoff},
+	} {
+		if duration.value == "" {
+			continue
+		}
+		if *duration.parsed, err = time.ParseDuration(duration.value); err != nil {
+			return fmt.Errorf("error in parsing %s %q: %v", duration.name, duration.value, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (cc *ComponentConfig) Validate() error {
+	if cc.Name == "" {
+		return fmt.Errorf("name of the component must be set")
+	}
+	// The name is the default repair state file in DefaultRepairStateDir.
+	if strings.ContainsAny(cc.Name, `/\`) || cc.Name == "." || cc.Name == ".." {
+		return fmt.Errorf("name of the component %q must not be a path", cc.Name)
+	}
+	switch cc.Check.Type {
+	case SystemdCheck:
+		if cc.SystemdService == "" {
+			return fmt.Errorf("systemd check of component %q requires systemdService", cc.Name)
+		}
+		if cc.Check.Endpoint != "" {
+			return fmt.Errorf("systemd check of component %q does not take an endpoint", cc.Name)
+		}
+	case HTTPCheck:
+		u, err := url.Parse(cc.Check.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint of component %q: %v", cc.Name, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoint %q of component %q is not an http(s) URL", cc.Check.Endpoint, cc.Name)
+		}
+	case GRPCCheck, TCPCheck:
+		if _, _, err := net.SplitHostPort(cc.Check.Endpoint); err != nil {
+			return fmt.Errorf("invalid endpoint of component %q: %v", cc.Name, err)
+		}
+	default:
+		return fmt.Errorf("unknown check type %q of component %q, expected one of %s, %s, %s or %s",
+			cc.Check.Type, cc.Name, SystemdCheck, HTTPCheck, GRPCCheck, TCPCheck)
+	}
+	if cc.Check.Service != "" && cc.Check.Type != GRPCCheck {
+		return fmt.Errorf("only the grpc check of component %q takes a service", cc.Name)
+	}
+	for _, arg := range cc.Repair {
+		if _, err := template.New("").Parse(arg); err != nil {
+			return fmt.Errorf("invalid repair argument %q of component %q: %v", arg, cc.Name, err)
+		}
+	}
+	policy := cc.RepairPolicy
+	if policy.CoolDownTime < 0 || policy.Backoff < 0 || policy.MaxBackoff < policy.Backoff {
+		return fmt.Errorf("repair policy of component %q should have non-negative cool down and backoff, below the max backoff", cc.Name)
+	}
+	if policy.MaxAttempts < 0 {
+		return fmt.Errorf("maxAttempts of component %q should not be negative", cc.Name)
+	}
+	return nil
+}
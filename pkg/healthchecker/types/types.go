@@ -23,13 +23,16 @@ const (
 	DefaultHealthCheckTimeout  = 10 * time.Second
 	CmdTimeout                 = 10 * time.Second
 	DefaultCriCtl              = "/usr/bin/crictl"
-	DefaultCriSocketPath       = "unix:///var/run/containerd/containerd.sock"
 	KubeletComponent           = "kubelet"
 	CRIComponent               = "cri"
 	DockerComponent            = "docker"
 	ContainerdService          = "containerd"
 	KubeletHealthCheckEndpoint = "http://127.0.0.1:10248/healthz"
 	UptimeTimeLayout           = "Mon 2006-01-02 15:04:05 UTC"
+	// RepairAttemptsReport reports each repair attempt of a component once.
+	RepairAttemptsReport = "repair-attempts"
+	// RepairsExhaustedReport reports the repairs of a component exhausted.
+	RepairsExhaustedReport = "repairs-exhausted"
 )
 
 type HealthChecker interface {
@@ -0,0 +1,283 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package healthscore combines selected conditions and metrics into a single 0-100
+// health score of the node, 100 being healthy.
+package healthscore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats/view"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+const (
+	maxScore            = 100
+	defaultUpdatePeriod = 30 * time.Second
+)
+
+// ConditionPenalty is the penalty of a condition.
+type ConditionPenalty struct {
+	// Type is the condition type. The instances of the condition, e.g. "DiskReadonly[sdb]",
+	// are penalized too.
+	Type string `json:"type"`
+	// Penalty is subtracted from the score while the condition is True.
+	Penalty float64 `json:"penalty"`
+}
+
+// MetricPenalty is the penalty of a metric.
+type MetricPenalty struct {
+	// Metric is the view name of a metric of node-problem-detector, e.g.
+	// "disk/avg_queue_length".
+	Metric string `json:"metric"`
+	// Tags select the rows of the metric. The worst selected row is penalized.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Threshold is the value at which the penalty starts.
+	Threshold float64 `json:"threshold"`
+	// Max is the value at which the full penalty applies. The penalty grows linearly
+	// from Threshold to Max. Max may be below Threshold for metrics which are worse when
+	// lower, e.g. free memory.
+	Max float64 `json:"max"`
+	// Penalty is the full penalty of the metric.
+	Penalty float64 `json:"penalty"`
+}
+
+// Config is the configuration of the health score.
+type Config struct {
+	Conditions []*ConditionPenalty `json:"conditions"`
+	Metrics    []*MetricPenalty    `json:"metrics"`
+	// Annotation is the node annotation the score is written to by the exporters which
+	// can annotate the node. Empty disables the annotation.
+	Annotation string `json:"annotation"`
+	// UpdatePeriodString is the period at which the score is updated when no status is
+	// reported. Default to 30s.
+	UpdatePeriodString string        `json:"updatePeriod"`
+	UpdatePeriod       time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() error {
+	c.UpdatePeriod = defaultUpdatePeriod
+	if c.UpdatePeriodString != "" {
+		var err error
+		if c.UpdatePeriod, err = time.ParseDuration(c.UpdatePeriodString); err != nil {
+			return fmt.Errorf("invalid update period %q: %v", c.UpdatePeriodString, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *Config) Validate() error {
+	if c.UpdatePeriod <= 0 {
+		return fmt.Errorf("update period %v must be positive", c.UpdatePeriod)
+	}
+	for _, condition := range c.Conditions {
+		if condition.Type == "" {
+			return fmt.Errorf("condition penalty %+v has no type", *condition)
+		}
+		if condition.Penalty < 0 {
+			return fmt.Errorf("penalty of condition %q must not be negative", condition.Type)
+		}
+	}
+	for _, metric := range c.Metrics {
+		if metric.Metric == "" {
+			return fmt.Errorf("metric penalty %+v has no metric", *metric)
+		}
+		if metric.Penalty < 0 {
+			return fmt.Errorf("penalty of metric %q must not be negative", metric.Metric)
+		}
+		if metric.Threshold == metric.Max {
+			return fmt.Errorf("threshold and max of metric %q must differ", metric.Metric)
+		}
+	}
+	return nil
+}
+
+// Scorer updates the health score from the latest conditions of all sources and the
+// metrics. It is not thread-safe.
+type Scorer struct {
+	config     Config
+	annotators []types.NodeAnnotator
+	// retrieve returns the rows of a metric view.
+	retrieve func(viewName string) ([]*view.Row, error)
+	score    metrics.Int64MetricInterface
+	// annotated is the score last written to the annotation, -1 if none is.
+	annotated int64
+}
+
+// NewScorer creates a scorer from a config file. The score is written to the node
+// annotation through the annotators.
+func NewScorer(configPath string, annotators []types.NodeAnnotator) (*Scorer, error) {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	var config Config
+	if err := util.UnmarshalStrict(f, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return nil, fmt.Errorf("failed to apply configuration file %q: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", configPath, err)
+	}
+
+	s := newScorer(config, annotators)
+	s.score, err = metrics.NewInt64Metric(
+		metrics.NodeHealthScoreID,
+		string(metrics.NodeHealthScoreID),
+		"Health score of the node from 0 to 100, combining the configured conditions and metrics. 100 is healthy.",
+		"1",
+		metrics.LastValue,
+		[]string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.NodeHealthScoreID, err)
+	}
+	return s, nil
+}
+
+func newScorer(config Config, annotators []types.NodeAnnotator) *Scorer {
+	return &Scorer{
+		config:     config,
+		annotators: annotators,
+		retrieve:   view.RetrieveData,
+		annotated:  -1,
+	}
+}
+
+// UpdatePeriod returns the period at which Update should be called when no status is
+// reported.
+func (s *Scorer) UpdatePeriod() time.Duration {
+	return s.config.UpdatePeriod
+}
+
+// Update updates the health score. The conditions are the latest conditions of all
+// sources, keyed by source and condition type.
+func (s *Scorer) Update(conditions map[string]map[string]types.Condition) {
+	score := s.compute(conditions)
+	if err := s.score.Record(map[string]string{}, score); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.NodeHealthScoreID, err)
+	}
+	if s.config.Annotation == "" || score == s.annotated {
+		return
+	}
+	annotations := map[string]string{s.config.Annotation: strconv.FormatInt(score, 10)}
+	for _, annotator := range s.annotators {
+		if err := annotator.AnnotateNode(annotations); err != nil {
+			// The annotation is written again on the next update.
+			glog.Errorf("Failed to annotate the node with health score %d: %v", score, err)
+			return
+		}
+	}
+	s.annotated = score
+}
+
+// compute returns the health score, which is 100 minus the penalties, at least 0.
+func (s *Scorer) compute(conditions map[string]map[string]types.Condition) int64 {
+	penalty := 0.0
+	for _, c := range s.config.Conditions {
+		if conditionTrue(conditions, c.Type) {
+			penalty += c.Penalty
+		}
+	}
+	for _, m := range s.config.Metrics {
+		penalty += s.metricPenalty(m)
+	}
+	return int64(math.Max(0, math.Round(maxScore-penalty)))
+}
+
+// conditionTrue returns whether the condition or any of its instances is True in any
+// source.
+func conditionTrue(conditions map[string]map[string]types.Condition, conditionType string) bool {
+	for _, sourceConditions := range conditions {
+		for _, condition := range sourceConditions {
+			if condition.Status != types.True {
+				continue
+			}
+			if condition.Type == conditionType || strings.HasPrefix(condition.Type, conditionType+"[") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// metricPenalty returns the penalty of the worst row of the metric selected by the tags.
+func (s *Scorer) metricPenalty(m *MetricPenalty) float64 {
+	rows, err := s.retrieve(m.Metric)
+	if err != nil {
+		glog.V(2).Infof("Failed to retrieve metric %q for the health score: %v", m.Metric, err)
+		return 0
+	}
+	worst := 0.0
+	for _, row := range rows {
+		if !matchTags(row, m.Tags) {
+			continue
+		}
+		value, ok := rowValue(row)
+		if !ok {
+			continue
+		}
+		worst = math.Max(worst, m.Penalty*severity(value, m.Threshold, m.Max))
+	}
+	return worst
+}
+
+// severity returns how far the value is from the threshold to the max, from 0 to 1.
+func severity(value, threshold, max float64) float64 {
+	return math.Min(1, math.Max(0, (value-threshold)/(max-threshold)))
+}
+
+func matchTags(row *view.Row, tags map[string]string) bool {
+	matched := 0
+	for _, tag := range row.Tags {
+		if value, ok := tags[tag.Key.Name()]; ok {
+			if value != tag.Value {
+				return false
+			}
+			matched++
+		}
+	}
+	return matched == len(tags)
+}
+
+// rowValue returns the value of a row: the last value, the sum, the count, or the mean
+// of a distribution.
+func rowValue(row *view.Row) (float64, bool) {
+	switch data := row.Data.(type) {
+	case *view.LastValueData:
+		return data.Value, true
+	case *view.SumData:
+		return data.Value, true
+	case *view.CountData:
+		return float64(data.Value), true
+	case *view.DistributionData:
+		return data.Mean, true
+	}
+	return 0, false
+}
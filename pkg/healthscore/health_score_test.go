@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+type fakeAnnotator struct {
+	annotations []map[string]string
+	err         error
+}
+
+func (f *fakeAnnotator) AnnotateNode(annotations map[string]string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.annotations = append(f.annotations, annotations)
+	return nil
+}
+
+func row(t *testing.T, tags map[string]string, data view.AggregationData) *view.Row {
+	r := &view.Row{Data: data}
+	for k, v := range tags {
+		key, err := tag.NewKey(k)
+		assert.NoError(t, err)
+		r.Tags = append(r.Tags, tag.Tag{Key: key, Value: v})
+	}
+	return r
+}
+
+func TestScore(t *testing.T) {
+	config := Config{
+		Conditions: []*ConditionPenalty{
+			{Type: "KernelDeadlock", Penalty: 60},
+			{Type: "DiskReadonly", Penalty: 30},
+		},
+		Metrics: []*MetricPenalty{
+			{Metric: "disk/avg_queue_length", Tags: map[string]string{"device_name": "sda"}, Threshold: 10, Max: 30, Penalty: 20},
+			{Metric: "memory/bytes_used", Tags: map[string]string{"state": "free"}, Threshold: 1000, Max: 0, Penalty: 40},
+			{Metric: "missing", Threshold: 0, Max: 1, Penalty: 100},
+		},
+		Annotation: "node-problem-detector.k8s.io/health-score",
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+
+	annotator := &fakeAnnotator{}
+	s := newScorer(config, []types.NodeAnnotator{annotator})
+	score := metrics.NewFakeInt64Metric("node/health_score", metrics.LastValue, []string{})
+	s.score = score
+	rows := map[string][]*view.Row{}
+	s.retrieve = func(viewName string) ([]*view.Row, error) {
+		r, ok := rows[viewName]
+		if !ok {
+			return nil, errors.New("no view")
+		}
+		return r, nil
+	}
+	conditions := map[string]map[string]types.Condition{
+		"kernel-monitor": {
+			"KernelDeadlock":    {Type: "KernelDeadlock", Status: types.False},
+			"DiskReadonly[sda]": {Type: "DiskReadonly[sda]", Status: types.False},
+		},
+	}
+
+	s.Update(conditions)
+	assert.Equal(t, []metrics.Int64MetricRepresentation{{Name: "node/health_score", Labels: map[string]string{}, Value: 100}},
+		score.ListMetrics())
+
+	// Half of the queue length penalty, a quarter of the free memory penalty.
+	rows["disk/avg_queue_length"] = []*view.Row{
+		row(t, map[string]string{"device_name": "sda"}, &view.LastValueData{Value: 20}),
+		row(t, map[string]string{"device_name": "sdb"}, &view.LastValueData{Value: 100}),
+	}
+	rows["memory/bytes_used"] = []*view.Row{
+		row(t, map[string]string{"state": "free"}, &view.LastValueData{Value: 750}),
+		row(t, map[string]string{"state": "used"}, &view.LastValueData{Value: 0}),
+	}
+	s.Update(conditions)
+	assert.Equal(t, int64(80), score.ListMetrics()[0].Value)
+
+	// An instance of a condition is penalized.
+	conditions["kernel-monitor"]["DiskReadonly[sda]"] = types.Condition{Type: "DiskReadonly[sda]", Status: types.True}
+	s.Update(conditions)
+	assert.Equal(t, int64(50), score.ListMetrics()[0].Value)
+
+	// The score is at least 0.
+	conditions["kernel-monitor"]["KernelDeadlock"] = types.Condition{Type: "KernelDeadlock", Status: types.True}
+	s.Update(conditions)
+	assert.Equal(t, int64(0), score.ListMetrics()[0].Value)
+
+	assert.Equal(t, []map[string]string{
+		{"node-problem-detector.k8s.io/health-score": "100"},
+		{"node-problem-detector.k8s.io/health-score": "80"},
+		{"node-problem-detector.k8s.io/health-score": "50"},
+		{"node-problem-detector.k8s.io/health-score": "0"},
+	}, annotator.annotations)
+
+	// The annotation is only written when the score changes, and retried on failures.
+	s.Update(conditions)
+	assert.Len(t, annotator.annotations, 4)
+	annotator.err = errors.New("conflict")
+	conditions["kernel-monitor"]["KernelDeadlock"] = types.Condition{Type: "KernelDeadlock", Status: types.False}
+	s.Update(conditions)
+	annotator.err = nil
+	s.Update(conditions)
+	assert.Equal(t, map[string]string{"node-problem-detector.k8s.io/health-score": "50"}, annotator.annotations[4])
+}
+
+func TestValidate(t *testing.T) {
+	for _, config := range []Config{
+		{UpdatePeriodString: "30 seconds"},
+		{Conditions: []*ConditionPenalty{{Penalty: 10}}},
+		{Conditions: []*ConditionPenalty{{Type: "KernelDeadlock", Penalty: -10}}},
+		{Metrics: []*MetricPenalty{{Threshold: 1, Max: 2, Penalty: 10}}},
+		{Metrics: []*MetricPenalty{{Metric: "disk/avg_queue_length", Threshold: 1, Max: 1, Penalty: 10}}},
+	} {
+		err := config.ApplyConfiguration()
+		if err == nil {
+			err = config.Validate()
+		}
+		assert.Error(t, err, "config %+v", config)
+	}
+}
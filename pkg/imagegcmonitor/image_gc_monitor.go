@@ -0,0 +1,322 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagegcmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/shirou/gopsutil/disk"
+
+	igmtypes "k8s.io/node-problem-detector/pkg/imagegcmonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers"
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const ImageGCMonitorName = "image-gc-monitor"
+
+const (
+	normalReason  = "ImageGCIsWorking"
+	normalMessage = "image garbage collection is working"
+	failingReason = "ImageGCFailing"
+)
+
+func init() {
+	problemdaemon.Register(ImageGCMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewImageGCMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+// gcAttempt is an image GC attempt whose effect on the imagefs usage is not evaluated yet.
+type gcAttempt struct {
+	timestamp time.Time
+	// usage is the imagefs usage in percent when the attempt was logged.
+	usage float64
+}
+
+// gcFailure is a failed or ineffective image GC attempt.
+type gcFailure struct {
+	timestamp time.Time
+	message   string
+}
+
+type imageGCMonitor struct {
+	configPath string
+	config     igmtypes.ImageGCConfig
+	watchers   []watchertypes.LogWatcher
+	// logCh merges the logs of all log watchers.
+	logCh chan *logtypes.Log
+	// diskUsage reads the usage of the filesystem of a path.
+	diskUsage func(path string) (*disk.UsageStat, error)
+	// usage is the last sampled imagefs usage in percent.
+	usage      float64
+	attempts   []gcAttempt
+	failures   []gcFailure
+	condition  types.Condition
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewImageGCMonitorOrDie creates an image GC monitor, panics if error occurs.
+func NewImageGCMonitorOrDie(configPath string) types.Monitor {
+	igm := imageGCMonitor{
+		configPath: configPath,
+		diskUsage:  disk.Usage,
+		logCh:      make(chan *logtypes.Log),
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &igm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = igm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = igm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, igm.config, err)
+	}
+	for _, config := range igm.config.LogWatchers {
+		igm.watchers = append(igm.watchers, logwatchers.GetLogWatcherOrDie(config))
+	}
+
+	// A 1000 size channel should be big enough.
+	igm.statusChan = make(chan *types.Status, 1000)
+
+	if *igm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(igm.config.ConditionType)
+	}
+	return &igm
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for the condition and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, failingReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			conditionType, failingReason, err)
+	}
+	err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(failingReason, 0)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", failingReason, err)
+	}
+}
+
+func (igm *imageGCMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start image GC monitor %s", igm.configPath)
+	for _, watcher := range igm.watchers {
+		logCh, err := watcher.Watch()
+		if err != nil {
+			return nil, err
+		}
+		problemdaemon.Go(igm, func() { igm.forwardLogs(logCh) })
+	}
+	problemdaemon.Go(igm, igm.monitorLoop)
+	return igm.statusChan, nil
+}
+
+func (igm *imageGCMonitor) Stop() {
+	glog.Infof("Stop image GC monitor %s", igm.configPath)
+	igm.tomb.Stop()
+}
+
+// forwardLogs forwards the logs of a log watcher to the merged log channel.
+func (igm *imageGCMonitor) forwardLogs(logCh <-chan *logtypes.Log) {
+	for {
+		select {
+		case log, ok := <-logCh:
+			if !ok {
+				glog.Errorf("Log channel closed: %s", igm.configPath)
+				return
+			}
+			select {
+			case igm.logCh <- log:
+			case <-igm.tomb.Stopping():
+				return
+			}
+		case <-igm.tomb.Stopping():
+			return
+		}
+	}
+}
+
+func (igm *imageGCMonitor) monitorLoop() {
+	defer igm.tomb.Done()
+
+	runTicker := time.NewTicker(igm.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	igm.sampleUsage()
+	igm.initializeStatus()
+
+	for {
+		select {
+		case log := <-igm.logCh:
+			if status := igm.handleLog(log, time.Now()); status != nil {
+				igm.statusChan <- status
+			}
+		case now := <-runTicker.C:
+			if status := igm.check(now); status != nil {
+				igm.statusChan <- status
+			}
+		case <-igm.tomb.Stopping():
+			for _, watcher := range igm.watchers {
+				watcher.Stop()
+			}
+			glog.Infof("Image GC monitor stopped: %s", igm.configPath)
+			return
+		}
+	}
+}
+
+func (igm *imageGCMonitor) initializeStatus() {
+	igm.condition = types.Condition{
+		Type:       igm.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     normalReason,
+		Message:    normalMessage,
+	}
+	igm.statusChan <- &types.Status{
+		Source:     igm.config.Source,
+		Conditions: []types.Condition{igm.condition},
+	}
+}
+
+// sampleUsage samples the imagefs usage. The last usage is kept if it can not be read.
+func (igm *imageGCMonitor) sampleUsage() {
+	usage, err := igm.diskUsage(igm.config.ImagefsPath)
+	if err != nil {
+		glog.Errorf("Failed to read the usage of imagefs %q: %v", igm.config.ImagefsPath, err)
+		return
+	}
+	igm.usage = usage.UsedPercent
+}
+
+// handleLog records the image GC attempt or failure in the log, and returns a new status
+// if the condition changes.
+func (igm *imageGCMonitor) handleLog(log *logtypes.Log, now time.Time) *types.Status {
+	switch {
+	case igm.config.FailurePatternRegexp.MatchString(log.Message):
+		glog.V(2).Infof("Image GC failure logged: %s", log.Message)
+		igm.failures = append(igm.failures, gcFailure{timestamp: log.Timestamp, message: log.Message})
+		return igm.evaluate(now)
+	case igm.config.AttemptPatternRegexp.MatchString(log.Message):
+		glog.V(2).Infof("Image GC attempt logged: %s", log.Message)
+		igm.sampleUsage()
+		igm.attempts = append(igm.attempts, gcAttempt{timestamp: now, usage: igm.usage})
+	}
+	return nil
+}
+
+// check samples the imagefs usage, evaluates the effect of the image GC attempts older
+// than the effect delay, and returns a new status if the condition changes.
+func (igm *imageGCMonitor) check(now time.Time) *types.Status {
+	igm.sampleUsage()
+
+	pending := igm.attempts[:0]
+	for _, attempt := range igm.attempts {
+		if now.Sub(attempt.timestamp) < igm.config.EffectDelay {
+			pending = append(pending, attempt)
+			continue
+		}
+		if attempt.usage-igm.usage < *igm.config.MinUsageDropPercent && igm.usage >= *igm.config.HighUsagePercent {
+			igm.failures = append(igm.failures, gcFailure{
+				timestamp: attempt.timestamp,
+				message: fmt.Sprintf("image GC did not free space, imagefs usage %.1f%% -> %.1f%% in %v",
+					attempt.usage, igm.usage, now.Sub(attempt.timestamp)),
+			})
+			continue
+		}
+		// The image GC works again, the earlier failures are forgotten.
+		igm.forgetFailures(attempt.timestamp)
+	}
+	igm.attempts = pending
+	return igm.evaluate(now)
+}
+
+// forgetFailures forgets the failures before the time.
+func (igm *imageGCMonitor) forgetFailures(before time.Time) {
+	failures := igm.failures[:0]
+	for _, failure := range igm.failures {
+		if !failure.timestamp.Before(before) {
+			failures = append(failures, failure)
+		}
+	}
+	igm.failures = failures
+}
+
+// evaluate returns a new status if the condition changes. Image GC is failing when the
+// failures within the failure window reach the threshold while the imagefs usage is high.
+func (igm *imageGCMonitor) evaluate(now time.Time) *types.Status {
+	igm.forgetFailures(now.Add(-igm.config.FailureWindow))
+
+	status, reason, message := types.False, normalReason, normalMessage
+	if len(igm.failures) >= *igm.config.FailureThreshold && igm.usage >= *igm.config.HighUsagePercent {
+		status, reason = types.True, failingReason
+		message = fmt.Sprintf("%d failed or ineffective image GC attempts in %v with imagefs usage at %.1f%%, last: %s",
+			len(igm.failures), igm.config.FailureWindow, igm.usage, igm.failures[len(igm.failures)-1].message)
+	}
+	if status == igm.condition.Status {
+		return nil
+	}
+
+	igm.condition.Transition = now
+	igm.condition.Status = status
+	igm.condition.Reason = reason
+	igm.condition.Message = message
+	events := []types.Event{util.GenerateConditionChangeEvent(igm.condition.Type, status, reason, now)}
+
+	if *igm.config.EnableMetricsReporting {
+		igm.updateProblemMetrics()
+	}
+	return &types.Status{
+		Source:     igm.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{igm.condition},
+	}
+}
+
+func (igm *imageGCMonitor) updateProblemMetrics() {
+	active := igm.condition.Status == types.True
+	if active {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(failingReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", failingReason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(igm.condition.Type, failingReason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			igm.condition.Type, failingReason, err)
+	}
+}
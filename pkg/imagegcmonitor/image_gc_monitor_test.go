@@ -0,0 +1,233 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagegcmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/stretchr/testify/assert"
+
+	igmtypes "k8s.io/node-problem-detector/pkg/imagegcmonitor/types"
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const attemptLog = "[imageGCManager]: Disk usage on image filesystem is at 90% which is over the high threshold (85%). Trying to free 1073741824 bytes"
+
+const failureLog = "Image garbage collection failed multiple times in a row: failed to garbage collect required amount of images"
+
+func newTestMonitor(t *testing.T, usage float64) *imageGCMonitor {
+	disabled, two := false, 2
+	config := igmtypes.ImageGCConfig{
+		LogWatchers:            []watchertypes.WatcherConfig{{Plugin: "journald"}},
+		FailureThreshold:       &two,
+		EnableMetricsReporting: &disabled,
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+
+	igm := &imageGCMonitor{
+		config: config,
+		diskUsage: func(path string) (*disk.UsageStat, error) {
+			return &disk.UsageStat{Path: path, UsedPercent: usage}, nil
+		},
+		statusChan: make(chan *types.Status, 10),
+	}
+	igm.sampleUsage()
+	igm.initializeStatus()
+	<-igm.statusChan
+	return igm
+}
+
+func TestHandleLog(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		desc     string
+		usage    float64
+		failures []gcFailure
+		log      string
+		// expected is the expected condition status, empty if no status is expected.
+		expected types.ConditionStatus
+		message  string
+		attempts int
+	}{
+		{
+			desc:     "attempt is recorded with the imagefs usage",
+			usage:    90,
+			log:      attemptLog,
+			attempts: 1,
+		},
+		{
+			desc:  "unrelated log is ignored",
+			usage: 90,
+			log:   "Pod sandbox changed, it will be killed and re-created.",
+		},
+		{
+			desc:  "failure below the threshold",
+			usage: 95,
+			log:   failureLog,
+		},
+		{
+			desc:     "failures reaching the threshold with high imagefs usage",
+			usage:    95,
+			failures: []gcFailure{{timestamp: now.Add(-time.Minute), message: failureLog}},
+			log:      failureLog,
+			expected: types.True,
+			message:  "2 failed or ineffective image GC attempts in 30m0s with imagefs usage at 95.0%, last: " + failureLog,
+		},
+		{
+			desc:     "failures are only reported while the imagefs usage is high",
+			usage:    50,
+			failures: []gcFailure{{timestamp: now.Add(-time.Minute), message: failureLog}},
+			log:      failureLog,
+		},
+	} {
+		igm := newTestMonitor(t, test.usage)
+		igm.failures = test.failures
+
+		status := igm.handleLog(&logtypes.Log{Timestamp: now, Message: test.log}, now)
+		if assert.Len(t, igm.attempts, test.attempts, test.desc) && test.attempts > 0 {
+			assert.Equal(t, test.usage, igm.attempts[0].usage, test.desc)
+		}
+		if test.expected == "" {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if assert.NotNil(t, status, test.desc) {
+			assert.Equal(t, test.expected, status.Conditions[0].Status, test.desc)
+			assert.Equal(t, failingReason, status.Conditions[0].Reason, test.desc)
+			assert.Equal(t, test.message, status.Conditions[0].Message, test.desc)
+			assert.Len(t, status.Events, 1, test.desc)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	start := time.Now()
+	for _, test := range []struct {
+		desc     string
+		usage    float64
+		attempts []gcAttempt
+		failures []gcFailure
+		violated bool
+		at       time.Duration
+		// expected is the expected condition status, empty if no status is expected.
+		expected types.ConditionStatus
+		message  string
+		// pending and failed are the numbers of attempts and failures left after the check.
+		pending int
+		failed  int
+	}{
+		{
+			desc:     "attempt within the effect delay is not evaluated",
+			usage:    90,
+			attempts: []gcAttempt{{timestamp: start, usage: 90}},
+			at:       time.Minute,
+			pending:  1,
+		},
+		{
+			desc:     "effective attempt",
+			usage:    80,
+			attempts: []gcAttempt{{timestamp: start, usage: 90}},
+			at:       5 * time.Minute,
+		},
+		{
+			desc:     "ineffective attempt below the threshold",
+			usage:    89.5,
+			attempts: []gcAttempt{{timestamp: start, usage: 90}},
+			at:       5 * time.Minute,
+			failed:   1,
+		},
+		{
+			desc:     "ineffective attempts reaching the threshold",
+			usage:    89.5,
+			attempts: []gcAttempt{{timestamp: start, usage: 90}},
+			failures: []gcFailure{{timestamp: start.Add(-10 * time.Minute), message: "image GC did not free space"}},
+			at:       5 * time.Minute,
+			expected: types.True,
+			message:  "2 failed or ineffective image GC attempts in 30m0s with imagefs usage at 89.5%, last: image GC did not free space, imagefs usage 90.0% -> 89.5% in 5m0s",
+			failed:   2,
+		},
+		{
+			desc:     "attempt freeing no space is not a failure below the high usage",
+			usage:    80,
+			attempts: []gcAttempt{{timestamp: start, usage: 80}},
+			failures: []gcFailure{{timestamp: start.Add(-10 * time.Minute), message: "image GC did not free space"}},
+			at:       5 * time.Minute,
+		},
+		{
+			desc:     "effective attempt clears the condition",
+			usage:    70,
+			attempts: []gcAttempt{{timestamp: start, usage: 90}},
+			failures: []gcFailure{
+				{timestamp: start.Add(-20 * time.Minute), message: "image GC did not free space"},
+				{timestamp: start.Add(-10 * time.Minute), message: "image GC did not free space"},
+			},
+			violated: true,
+			at:       5 * time.Minute,
+			expected: types.False,
+			message:  normalMessage,
+		},
+		{
+			desc:  "failures age out of the failure window",
+			usage: 95,
+			failures: []gcFailure{
+				{timestamp: start, message: failureLog},
+				{timestamp: start, message: failureLog},
+			},
+			violated: true,
+			at:       31 * time.Minute,
+			expected: types.False,
+			message:  normalMessage,
+		},
+		{
+			desc:  "condition stays while the failures are in the window",
+			usage: 95,
+			failures: []gcFailure{
+				{timestamp: start, message: failureLog},
+				{timestamp: start, message: failureLog},
+			},
+			violated: true,
+			at:       29 * time.Minute,
+			failed:   2,
+		},
+	} {
+		igm := newTestMonitor(t, test.usage)
+		igm.attempts = test.attempts
+		igm.failures = test.failures
+		if test.violated {
+			igm.condition.Status = types.True
+			igm.condition.Reason = failingReason
+		}
+
+		status := igm.check(start.Add(test.at))
+		assert.Len(t, igm.attempts, test.pending, test.desc)
+		assert.Len(t, igm.failures, test.failed, test.desc)
+		if test.expected == "" {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if assert.NotNil(t, status, test.desc) {
+			assert.Equal(t, test.expected, status.Conditions[0].Status, test.desc)
+			assert.Equal(t, test.message, status.Conditions[0].Message, test.desc)
+			assert.Len(t, status.Events, 1, test.desc)
+		}
+	}
+}
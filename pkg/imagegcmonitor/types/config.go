@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+)
+
+var (
+	defaultSource               = "image-gc-monitor"
+	defaultConditionType        = "ImageGCFailing"
+	defaultInvokeIntervalString = time.Minute.String()
+	defaultImagefsPath          = "/var/lib/containerd"
+	defaultAttemptPattern       = `Disk usage on image filesystem is at \d+% which is over the high threshold`
+	defaultFailurePattern       = `(?i)(image garbage collection failed|failed to garbage collect|garbage collection failed)`
+	defaultHighUsagePercent     = 85.0
+	defaultMinUsageDropPercent  = 1.0
+	defaultEffectDelayString    = (5 * time.Minute).String()
+	defaultFailureWindowString  = (30 * time.Minute).String()
+	defaultFailureThreshold     = 3
+	defaultEnableMetrics        = true
+)
+
+type ImageGCConfig struct {
+	// Source is the source name of the image GC monitor.
+	Source string `json:"source"`
+	// ConditionType is the type of the condition reporting failing image GC.
+	ConditionType string `json:"conditionType"`
+	// LogWatchers are the log watchers of the kubelet and container runtime logs, in
+	// which image GC attempts and failures are looked for.
+	LogWatchers []watchertypes.WatcherConfig `json:"logWatchers"`
+	// AttemptPattern is the regular expression matching the logs of image GC attempts.
+	AttemptPattern       string         `json:"attemptPattern"`
+	AttemptPatternRegexp *regexp.Regexp `json:"-"`
+	// FailurePattern is the regular expression matching the logs of image GC errors.
+	FailurePattern       string         `json:"failurePattern"`
+	FailurePatternRegexp *regexp.Regexp `json:"-"`
+	// ImagefsPath is a path on the filesystem of the container images.
+	ImagefsPath string `json:"imagefsPath"`
+	// InvokeIntervalString is the interval at which the imagefs usage is sampled.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// HighUsagePercent is the imagefs usage above which image GC is expected to free
+	// space. Failing image GC is only reported while the usage is above it.
+	HighUsagePercent *float64 `json:"highUsagePercent,omitempty"`
+	// MinUsageDropPercent is the drop of the imagefs usage in percentage points an image
+	// GC attempt is expected to achieve within EffectDelay.
+	MinUsageDropPercent *float64 `json:"minUsageDropPercent,omitempty"`
+	// EffectDelayString is the time after which the effect of an image GC attempt on the
+	// imagefs usage is evaluated.
+	EffectDelayString string        `json:"effectDelay"`
+	EffectDelay       time.Duration `json:"-"`
+	// FailureWindowString is the window in which failed and ineffective image GC attempts
+	// are counted.
+	FailureWindowString string        `json:"failureWindow"`
+	FailureWindow       time.Duration `json:"-"`
+	// FailureThreshold is the number of failed and ineffective image GC attempts within
+	// FailureWindow that sets the condition.
+	FailureThreshold *int `json:"failureThreshold,omitempty"`
+	// EnableMetricsReporting describes whether to count the image garbage collection
+	// failures and report the condition as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (ic *ImageGCConfig) ApplyConfiguration() error {
+	if ic.Source == "" {
+		ic.Source = defaultSource
+	}
+	if ic.ConditionType == "" {
+		ic.ConditionType = defaultConditionType
+	}
+	if ic.AttemptPattern == "" {
+		ic.AttemptPattern = defaultAttemptPattern
+	}
+	if ic.FailurePattern == "" {
+		ic.FailurePattern = defaultFailurePattern
+	}
+	if ic.ImagefsPath == "" {
+		ic.ImagefsPath = defaultImagefsPath
+	}
+	if ic.InvokeIntervalString == "" {
+		ic.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if ic.HighUsagePercent == nil {
+		ic.HighUsagePercent = &defaultHighUsagePercent
+	}
+	if ic.MinUsageDropPercent == nil {
+		ic.MinUsageDropPercent = &defaultMinUsageDropPercent
+	}
+	if ic.EffectDelayString == "" {
+		ic.EffectDelayString = defaultEffectDelayString
+	}
+	if ic.FailureWindowString == "" {
+		ic.FailureWindowString = defaultFailureWindowString
+	}
+	if ic.FailureThreshold == nil {
+		ic.FailureThreshold = &defaultFailureThreshold
+	}
+	if ic.EnableMetricsReporting == nil {
+		ic.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	ic.AttemptPatternRegexp, err = regexp.Compile(ic.AttemptPattern)
+	if err != nil {
+		return fmt.Errorf("error in compiling AttemptPattern %q: %v", ic.AttemptPattern, err)
+	}
+	ic.FailurePatternRegexp, err = regexp.Compile(ic.FailurePattern)
+	if err != nil {
+		return fmt.Errorf("error in compiling FailurePattern %q: %v", ic.FailurePattern, err)
+	}
+	ic.InvokeInterval, err = time.ParseDuration(ic.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", ic.InvokeIntervalString, err)
+	}
+	ic.EffectDelay, err = time.ParseDuration(ic.EffectDelayString)
+	if err != nil {
+		return fmt.Errorf("error in parsing EffectDelayString %q: %v", ic.EffectDelayString, err)
+	}
+	ic.FailureWindow, err = time.ParseDuration(ic.FailureWindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing FailureWindowString %q: %v", ic.FailureWindowString, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (ic *ImageGCConfig) Validate() error {
+	if len(ic.LogWatchers) == 0 {
+		return fmt.Errorf("at least one log watcher is required")
+	}
+	for _, watcher := range ic.LogWatchers {
+		if watcher.Plugin == "" {
+			return fmt.Errorf("log watcher %+v has no plugin", watcher)
+		}
+	}
+	if ic.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", ic.InvokeInterval)
+	}
+	if ic.EffectDelay <= time.Duration(0) {
+		return fmt.Errorf("EffectDelay %v must be above 0s", ic.EffectDelay)
+	}
+	if ic.FailureWindow <= time.Duration(0) {
+		return fmt.Errorf("FailureWindow %v must be above 0s", ic.FailureWindow)
+	}
+	if *ic.HighUsagePercent <= 0 || *ic.HighUsagePercent > 100 {
+		return fmt.Errorf("HighUsagePercent %v must be above 0 and at most 100", *ic.HighUsagePercent)
+	}
+	if *ic.MinUsageDropPercent < 0 {
+		return fmt.Errorf("MinUsageDropPercent %v must not be negative", *ic.MinUsageDropPercent)
+	}
+	if *ic.FailureThreshold < 1 {
+		return fmt.Errorf("FailureThreshold %d must be at least 1", *ic.FailureThreshold)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	journald := []watchertypes.WatcherConfig{{Plugin: "journald", PluginConfig: map[string]string{"source": "kubelet"}}}
+	zero, over, negative := 0, 101.0, -1.0
+	testCases := []struct {
+		name      string
+		config    ImageGCConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: ImageGCConfig{LogWatchers: journald},
+		},
+		{
+			name:      "no log watcher",
+			config:    ImageGCConfig{},
+			expectErr: true,
+		},
+		{
+			name:      "log watcher without plugin",
+			config:    ImageGCConfig{LogWatchers: []watchertypes.WatcherConfig{{LogPath: "/var/log/journal"}}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid failure pattern",
+			config:    ImageGCConfig{LogWatchers: journald, FailurePattern: "(GC failed"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid effect delay",
+			config:    ImageGCConfig{LogWatchers: journald, EffectDelayString: "5 minutes"},
+			expectErr: true,
+		},
+		{
+			name:      "high usage above 100%",
+			config:    ImageGCConfig{LogWatchers: journald, HighUsagePercent: &over},
+			expectErr: true,
+		},
+		{
+			name:      "negative usage drop",
+			config:    ImageGCConfig{LogWatchers: journald, MinUsageDropPercent: &negative},
+			expectErr: true,
+		},
+		{
+			name:      "zero failure threshold",
+			config:    ImageGCConfig{LogWatchers: journald, FailureThreshold: &zero},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package journal writes the problems exported to an append-only file on the host, and
+// replays the ones which were not delivered when node problem detector restarts, so that
+// the condition transitions are delivered at least once even when it crashes, e.g. while
+// the apiserver is unreachable. The problems are written with the v1 schema, including
+// the annotations of the events.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+const (
+	defaultPath         = "/var/lib/node-problem-detector/journal"
+	defaultMaxSizeBytes = 10 << 20
+	defaultMaxReplayAge = 24 * time.Hour
+	// checkPeriod is the period at which the delivered entries are acknowledged.
+	checkPeriod = 10 * time.Second
+)
+
+// Config is the configuration of the event journal.
+type Config struct {
+	// Path is the journal file. It must be on the host, so that it survives the restarts
+	// of the container. Default to /var/lib/node-problem-detector/journal.
+	Path string `json:"path"`
+	// MaxSizeBytes is the size of the journal file beyond which it is compacted. The
+	// oldest entries which were not delivered are dropped when they take more than half
+	// of it. Default to 10MiB.
+	MaxSizeBytes int64 `json:"maxSizeBytes"`
+	// MaxReplayAgeString is the age beyond which entries are not replayed any more.
+	// Default to 24h.
+	MaxReplayAgeString string        `json:"maxReplayAge"`
+	MaxReplayAge       time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() error {
+	if c.Path == "" {
+		c.Path = defaultPath
+	}
+	if c.MaxSizeBytes == 0 {
+		c.MaxSizeBytes = defaultMaxSizeBytes
+	}
+	c.MaxReplayAge = defaultMaxReplayAge
+	if c.MaxReplayAgeString != "" {
+		var err error
+		if c.MaxReplayAge, err = time.ParseDuration(c.MaxReplayAgeString); err != nil {
+			return fmt.Errorf("invalid max replay age %q: %v", c.MaxReplayAgeString, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *Config) Validate() error {
+	if !filepath.IsAbs(c.Path) {
+		return fmt.Errorf("path %q must be absolute", c.Path)
+	}
+	if c.MaxSizeBytes <= 0 {
+		return fmt.Errorf("max size %d must be positive", c.MaxSizeBytes)
+	}
+	if c.MaxReplayAge <= 0 {
+		return fmt.Errorf("max replay age %v must be positive", c.MaxReplayAge)
+	}
+	return nil
+}
+
+// record is a line of the journal file, either an entry or an acknowledgement. The
+// statuses are written with the stable schema, so that the journal survives upgrades.
+type record struct {
+	// Seq is the sequence number of an entry.
+	Seq  uint64    `json:"seq,omitempty"`
+	Time time.Time `json:"time"`
+	// Report is the status exported, only set for entries.
+	Report *npdapiv1.ProblemReport `json:"report,omitempty"`
+	// Ack acknowledges the entries up to the sequence number.
+	Ack uint64 `json:"ack,omitempty"`
+}
+
+// Entry is a status written to the journal.
+type Entry struct {
+	Seq    uint64
+	Status *types.Status
+}
+
+// entry is an entry which is not acknowledged yet.
+type entry struct {
+	Entry
+	time time.Time
+	// line is the encoded record of the entry.
+	line []byte
+	// exported is the time the entry was exported, zero before.
+	exported time.Time
+}
+
+// Journal is the event journal. It is not thread-safe.
+type Journal struct {
+	config   Config
+	nodeName string
+	// acknowledgers are the exporters delivering the problems asynchronously. An entry
+	// is acknowledged once all of them delivered it.
+	acknowledgers []types.AcknowledgingExporter
+	file          *os.File
+	size          int64
+	nextSeq       uint64
+	// pending are the entries which are not acknowledged, oldest first.
+	pending []*entry
+	// unacknowledged are the entries which were not acknowledged when the journal was
+	// opened.
+	unacknowledged []Entry
+	pendingEntries metrics.Int64MetricInterface
+	droppedEntries metrics.Int64MetricInterface
+}
+
+// Open opens the journal from a config file. The entries are acknowledged once the
+// acknowledgers delivered them, the other exporters deliver them when they are exported.
+func Open(configPath string, acknowledgers []types.AcknowledgingExporter) (*Journal, error) {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	var config Config
+	if err := util.UnmarshalStrict(f, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return nil, fmt.Errorf("failed to apply configuration file %q: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", configPath, err)
+	}
+
+	j := &Journal{config: config, nodeName: util.GetNodeName(), acknowledgers: acknowledgers}
+	j.pendingEntries, err = metrics.NewInt64Metric(
+		metrics.JournalPendingEntriesID,
+		string(metrics.JournalPendingEntriesID),
+		"Number of entries of the event journal which are not delivered yet.",
+		"1",
+		metrics.LastValue,
+		nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.JournalPendingEntriesID, err)
+	}
+	j.droppedEntries, err = metrics.NewInt64Metric(
+		metrics.JournalDroppedEntriesID,
+		string(metrics.JournalDroppedEntriesID),
+		"Number of entries of the event journal dropped before they were delivered, because the journal was full or they were too old to be replayed.",
+		"1",
+		metrics.Sum,
+		nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.JournalDroppedEntriesID, err)
+	}
+	if err := j.open(time.Now()); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// open reads the entries which were not acknowledged from the journal file, and compacts
+// it.
+func (j *Journal) open(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(j.config.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Open(j.config.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		err = j.read(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read journal %q: %v", j.config.Path, err)
+		}
+	}
+	j.nextSeq++
+
+	var expired int
+	for len(j.pending) > 0 && now.Sub(j.pending[0].time) > j.config.MaxReplayAge {
+		j.pending = j.pending[1:]
+		expired++
+	}
+	if expired > 0 {
+		glog.Warningf("Dropped %d journal entries older than %v", expired, j.config.MaxReplayAge)
+		j.recordDropped(expired)
+	}
+	for _, e := range j.pending {
+		j.unacknowledged = append(j.unacknowledged, e.Entry)
+	}
+	if err := j.compact(); err != nil {
+		return fmt.Errorf("failed to compact journal %q: %v", j.config.Path, err)
+	}
+	j.recordPending()
+	return nil
+}
+
+// read reads the records of the journal file. Invalid records, e.g. the last one written
+// partially before a crash, are skipped.
+func (j *Journal) read(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var rec record
+			if jsonErr := json.Unmarshal(line, &rec); jsonErr != nil {
+				glog.Warningf("Skipping invalid journal record %q: %v", line, jsonErr)
+			} else {
+				j.apply(rec, line)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// apply applies a record read from the journal file.
+func (j *Journal) apply(rec record, line []byte) {
+	if rec.Ack > 0 {
+		for len(j.pending) > 0 && j.pending[0].Seq <= rec.Ack {
+			j.pending = j.pending[1:]
+		}
+		if rec.Ack > j.nextSeq {
+			j.nextSeq = rec.Ack
+		}
+		return
+	}
+	if rec.Seq == 0 || rec.Report == nil || rec.Seq <= j.nextSeq {
+		return
+	}
+	j.nextSeq = rec.Seq
+	if rec.Report.APIVersion != npdapiv1.APIVersion {
+		glog.Warningf("Skipping journal entry %d of unsupported version %q", rec.Seq, rec.Report.APIVersion)
+		return
+	}
+	if line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	j.pending = append(j.pending, &entry{
+		Entry: Entry{Seq: rec.Seq, Status: rec.Report.ToStatus()},
+		time:  rec.Time,
+		line:  line,
+	})
+}
+
+// compact rewrites the journal file with the pending entries only, dropping the oldest
+// ones when they take more than half of the max size.
+func (j *Journal) compact() error {
+	var size int64
+	dropped := len(j.pending)
+	for dropped > 0 && size+int64(len(j.pending[dropped-1].line)) <= j.config.MaxSizeBytes/2 {
+		size += int64(len(j.pending[dropped-1].line))
+		dropped--
+	}
+	if dropped > 0 {
+		glog.Warningf("Event journal is full, dropped the %d oldest entries which were not delivered", dropped)
+		j.recordDropped(dropped)
+		j.pending = j.pending[dropped:]
+	}
+
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	tmp := j.config.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range j.pending {
+		w.Write(e.line)
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.config.Path); err != nil {
+		return err
+	}
+	j.file, err = os.OpenFile(j.config.Path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	j.size = size
+	return nil
+}
+
+// write appends a record to the journal file.
+func (j *Journal) write(line []byte, sync bool) error {
+	if j.file == nil {
+		return fmt.Errorf("journal %q is not open", j.config.Path)
+	}
+	if _, err := j.file.Write(line); err != nil {
+		return err
+	}
+	j.size += int64(len(line))
+	if sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+// Append writes the status to the journal before it is exported, and returns the
+// sequence number of its entry. It returns 0 if the status could not be written.
+func (j *Journal) Append(status *types.Status, now time.Time) uint64 {
+	rec := record{Seq: j.nextSeq, Time: now, Report: npdapiv1.NewProblemReport(j.nodeName, status)}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		glog.Errorf("Failed to encode journal entry of %s: %v", status.Source, err)
+		return 0
+	}
+	line = append(line, '\n')
+	if j.size+int64(len(line)) > j.config.MaxSizeBytes {
+		if err := j.compact(); err != nil {
+			glog.Errorf("Failed to compact journal %q: %v", j.config.Path, err)
+		}
+	}
+	// The entries are synced to the disk, so that they survive a crash of the node.
+	if err := j.write(line, true); err != nil {
+		glog.Errorf("Failed to write journal entry of %s: %v", status.Source, err)
+		return 0
+	}
+	j.pending = append(j.pending, &entry{
+		Entry: Entry{Seq: rec.Seq, Status: status},
+		time:  now,
+		line:  line,
+	})
+	j.nextSeq++
+	j.recordPending()
+	return rec.Seq
+}
+
+// Exported records that the entry was exported to all exporters.
+func (j *Journal) Exported(seq uint64, now time.Time) {
+	for i := len(j.pending) - 1; i >= 0; i-- {
+		if j.pending[i].Seq == seq {
+			j.pending[i].exported = now
+			return
+		}
+	}
+}
+
+// Unacknowledged returns the entries which were not acknowledged when the journal was
+// opened, oldest first. They are to be exported again.
+func (j *Journal) Unacknowledged() []Entry {
+	return j.unacknowledged
+}
+
+// CheckPeriod returns the period at which Acknowledge should be called.
+func (j *Journal) CheckPeriod() time.Duration {
+	return checkPeriod
+}
+
+// Acknowledge acknowledges the entries exported before all acknowledgers delivered the
+// problems they were exported.
+func (j *Journal) Acknowledge(now time.Time) {
+	delivered := now
+	for _, acknowledger := range j.acknowledgers {
+		if until := acknowledger.DeliveredUntil(); until.Before(delivered) {
+			delivered = until
+		}
+	}
+	var ack uint64
+	for len(j.pending) > 0 {
+		e := j.pending[0]
+		if e.exported.IsZero() || !e.exported.Before(delivered) {
+			break
+		}
+		ack = e.Seq
+		j.pending = j.pending[1:]
+	}
+	if ack == 0 {
+		return
+	}
+	j.recordPending()
+	line, err := json.Marshal(record{Time: now, Ack: ack})
+	if err != nil {
+		glog.Errorf("Failed to encode journal acknowledgement: %v", err)
+		return
+	}
+	// An acknowledgement lost in a crash only replays delivered entries again, it is not
+	// synced.
+	if err := j.write(append(line, '\n'), false); err != nil {
+		glog.Errorf("Failed to write journal acknowledgement: %v", err)
+	}
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+func (j *Journal) recordPending() {
+	if j.pendingEntries == nil {
+		return
+	}
+	if err := j.pendingEntries.Record(map[string]string{}, int64(len(j.pending))); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.JournalPendingEntriesID, err)
+	}
+}
+
+func (j *Journal) recordDropped(n int) {
+	if j.droppedEntries == nil {
+		return
+	}
+	if err := j.droppedEntries.Record(map[string]string{}, int64(n)); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.JournalDroppedEntriesID, err)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// fakeAcknowledger is an exporter which delivered the problems until a time.
+type fakeAcknowledger struct {
+	types.Exporter
+	delivered time.Time
+}
+
+func (f *fakeAcknowledger) DeliveredUntil() time.Time { return f.delivered }
+
+func newTestJournal(t *testing.T, dir string, config Config, acknowledgers ...types.AcknowledgingExporter) *Journal {
+	config.Path = filepath.Join(dir, "journal")
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	j := &Journal{config: config, acknowledgers: acknowledgers}
+	assert.NoError(t, j.open(time.Now()))
+	return j
+}
+
+func newTestStatus(reason string) *types.Status {
+	return &types.Status{
+		Source: "kernel-monitor",
+		Conditions: []types.Condition{{
+			Type:       "KernelDeadlock",
+			Status:     types.True,
+			Transition: time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC),
+			Reason:     reason,
+		}},
+	}
+}
+
+func reasons(entries []Entry) []string {
+	var r []string
+	for _, e := range entries {
+		r = append(r, e.Status.Conditions[0].Reason)
+	}
+	return r
+}
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	acknowledger := &fakeAcknowledger{}
+	j := newTestJournal(t, dir, Config{}, acknowledger)
+	assert.Empty(t, j.Unacknowledged())
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		seq := j.Append(newTestStatus(fmt.Sprintf("Reason%d", i)), now)
+		assert.Equal(t, uint64(i+1), seq)
+		j.Exported(seq, now.Add(time.Duration(i)*time.Second))
+	}
+	// The entries exported before the acknowledger delivered them are acknowledged.
+	acknowledger.delivered = now.Add(1500 * time.Millisecond)
+	j.Acknowledge(now.Add(time.Minute))
+	assert.Len(t, j.pending, 1)
+	assert.NoError(t, j.Close())
+
+	// The entries which were not acknowledged are replayed after a restart.
+	j = newTestJournal(t, dir, Config{}, acknowledger)
+	assert.Equal(t, []string{"Reason2"}, reasons(j.Unacknowledged()))
+	assert.Equal(t, uint64(4), j.Append(newTestStatus("Reason3"), now))
+	assert.NoError(t, j.Close())
+
+	j = newTestJournal(t, dir, Config{}, acknowledger)
+	assert.Equal(t, []string{"Reason2", "Reason3"}, reasons(j.Unacknowledged()))
+	for _, e := range j.Unacknowledged() {
+		j.Exported(e.Seq, now)
+	}
+	acknowledger.delivered = now.Add(time.Second)
+	j.Acknowledge(now.Add(time.Minute))
+	assert.NoError(t, j.Close())
+
+	j = newTestJournal(t, dir, Config{})
+	assert.Empty(t, j.Unacknowledged())
+	assert.NoError(t, j.Close())
+}
+
+func TestReplayAnnotations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	status := newTestStatus("Reason0")
+	status.Events = []types.Event{{
+		Severity:    types.Warn,
+		Timestamp:   time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC),
+		Reason:      "OOMKilling",
+		Message:     "Killed process 1234 (java)",
+		Annotations: map[string]string{"pid": "1234", "process": "java"},
+	}}
+	j := newTestJournal(t, dir, Config{})
+	j.Append(status, time.Now())
+	assert.NoError(t, j.Close())
+
+	// The annotations of the events are replayed with them.
+	j = newTestJournal(t, dir, Config{})
+	entries := j.Unacknowledged()
+	if assert.Len(t, entries, 1) && assert.Len(t, entries[0].Status.Events, 1) {
+		assert.Equal(t, status.Events[0], entries[0].Status.Events[0])
+	}
+	assert.NoError(t, j.Close())
+}
+
+func TestTruncatedRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j := newTestJournal(t, dir, Config{})
+	j.Append(newTestStatus("Reason0"), time.Now())
+	assert.NoError(t, j.Close())
+	// A record partially written before a crash is skipped.
+	f, err := os.OpenFile(filepath.Join(dir, "journal"), os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"time":"2020-06-01T02:00:00Z","report":{"apiV`)
+	assert.NoError(t, err)
+	f.Close()
+
+	j = newTestJournal(t, dir, Config{})
+	assert.Equal(t, []string{"Reason0"}, reasons(j.Unacknowledged()))
+	assert.Equal(t, uint64(2), j.Append(newTestStatus("Reason1"), time.Now()))
+	assert.NoError(t, j.Close())
+
+	j = newTestJournal(t, dir, Config{})
+	assert.Equal(t, []string{"Reason0", "Reason1"}, reasons(j.Unacknowledged()))
+	assert.NoError(t, j.Close())
+}
+
+func TestMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The oldest entries are dropped when the journal is full, so that the entries left
+	// take at most half of it.
+	now := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	j := newTestJournal(t, dir, Config{})
+	j.Append(newTestStatus("Reason0"), now)
+	line := int64(len(j.pending[0].line))
+	j.config.MaxSizeBytes = 4*line + 1
+	for i := 1; i < 5; i++ {
+		j.Append(newTestStatus(fmt.Sprintf("Reason%d", i)), now)
+	}
+	assert.Equal(t, []string{"Reason2", "Reason3", "Reason4"}, reasons(entries(j.pending)))
+	info, err := os.Stat(filepath.Join(dir, "journal"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3*line, info.Size())
+	assert.NoError(t, j.Close())
+}
+
+func TestMaxReplayAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j := newTestJournal(t, dir, Config{})
+	j.Append(newTestStatus("Reason0"), time.Now().Add(-2*time.Hour))
+	j.Append(newTestStatus("Reason1"), time.Now())
+	assert.NoError(t, j.Close())
+
+	j = newTestJournal(t, dir, Config{MaxReplayAgeString: "1h"})
+	assert.Equal(t, []string{"Reason1"}, reasons(j.Unacknowledged()))
+	assert.NoError(t, j.Close())
+}
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	for desc, test := range map[string]struct {
+		config  Config
+		wantErr bool
+	}{
+		"default":               {config: Config{}},
+		"relative path":         {config: Config{Path: "journal"}, wantErr: true},
+		"negative max size":     {config: Config{MaxSizeBytes: -1}, wantErr: true},
+		"invalid max age":       {config: Config{MaxReplayAgeString: "1d"}, wantErr: true},
+		"negative max age":      {config: Config{MaxReplayAgeString: "-1h"}, wantErr: true},
+		"custom path and sizes": {config: Config{Path: "/tmp/journal", MaxSizeBytes: 1 << 20, MaxReplayAgeString: "1h"}},
+	} {
+		err := test.config.ApplyConfiguration()
+		if err == nil {
+			err = test.config.Validate()
+		}
+		assert.Equal(t, test.wantErr, err != nil, "%s: %v", desc, err)
+	}
+}
+
+func entries(pending []*entry) []Entry {
+	var r []Entry
+	for _, e := range pending {
+		r = append(r, e.Entry)
+	}
+	return r
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kdumpmonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+
+	kmtypes "k8s.io/node-problem-detector/pkg/kdumpmonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const (
+	KdumpMonitorName = "kdump-monitor"
+
+	// crashReason is the reason of the event reporting the crash causing the current boot.
+	crashReason = "KernelCrash"
+	// frequentCrashReason is the reason of the condition when crashes recur.
+	frequentCrashReason = "FrequentKernelCrash"
+)
+
+func init() {
+	problemdaemon.Register(KdumpMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewKdumpMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+// crash is a crash dump saved by kdump.
+type crash struct {
+	// dir is the directory of the crash dump.
+	dir string
+	// time is when the crash dump was saved.
+	time time.Time
+}
+
+type kdumpMonitor struct {
+	configPath string
+	config     kmtypes.KdumpConfig
+	// bootTime returns the time the node booted.
+	bootTime   func() (time.Time, error)
+	condition  types.Condition
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewKdumpMonitorOrDie creates a kdump monitor, panics if error occurs.
+func NewKdumpMonitorOrDie(configPath string) types.Monitor {
+	km := kdumpMonitor{
+		configPath: configPath,
+		bootTime:   util.GetBootTime,
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &km.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = km.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = km.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, km.config, err)
+	}
+
+	// A 1000 size channel should be big enough.
+	km.statusChan = make(chan *types.Status, 1000)
+
+	if *km.config.EnableMetricsReporting {
+		km.initializeProblemMetricsOrDie()
+	}
+	return &km
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for all problems and set the value to 0,
+// panic if error occurs.
+func (km *kdumpMonitor) initializeProblemMetricsOrDie() {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(km.config.DefaultCondition.Type, frequentCrashReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			km.config.DefaultCondition.Type, frequentCrashReason, err)
+	}
+	for _, reason := range []string{crashReason, frequentCrashReason} {
+		err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+		}
+	}
+}
+
+func (km *kdumpMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start kdump monitor %s", km.configPath)
+	problemdaemon.Go(km, km.monitorLoop)
+	return km.statusChan, nil
+}
+
+func (km *kdumpMonitor) Stop() {
+	glog.Infof("Stop kdump monitor %s", km.configPath)
+	km.tomb.Stop()
+}
+
+func (km *kdumpMonitor) monitorLoop() {
+	defer km.tomb.Done()
+
+	runTicker := time.NewTicker(km.config.CheckInterval)
+	defer runTicker.Stop()
+
+	km.initializeStatus()
+	crashes := km.listCrashes()
+	if event := km.bootCrashEvent(crashes); event != nil {
+		km.statusChan <- &types.Status{
+			Source: km.config.Source,
+			Events: []types.Event{*event},
+		}
+	}
+	if status := km.checkRecurrence(crashes, time.Now()); status != nil {
+		km.statusChan <- status
+	}
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := km.checkRecurrence(km.listCrashes(), now); status != nil {
+				km.statusChan <- status
+			}
+		case <-km.tomb.Stopping():
+			glog.Infof("Kdump monitor stopped: %s", km.configPath)
+			return
+		}
+	}
+}
+
+func (km *kdumpMonitor) initializeStatus() {
+	km.condition = *km.config.DefaultCondition
+	km.condition.Status = types.False
+	km.condition.Transition = time.Now()
+	km.statusChan <- &types.Status{
+		Source:     km.config.Source,
+		Conditions: []types.Condition{km.condition},
+	}
+}
+
+// listCrashes lists the crash dumps in the crash directory, oldest first. The time of a
+// crash is the modification time of its kernel log, or of its directory without log.
+func (km *kdumpMonitor) listCrashes() []crash {
+	files, err := ioutil.ReadDir(km.config.CrashDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("Failed to list crash directory %q: %v", km.config.CrashDir, err)
+		}
+		return nil
+	}
+	var crashes []crash
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		c := crash{dir: filepath.Join(km.config.CrashDir, file.Name()), time: file.ModTime()}
+		if info, err := os.Stat(filepath.Join(c.dir, km.config.DmesgFile)); err == nil {
+			c.time = info.ModTime()
+		}
+		crashes = append(crashes, c)
+	}
+	sort.Slice(crashes, func(i, j int) bool { return crashes[i].time.Before(crashes[j].time) })
+	return crashes
+}
+
+// bootCrashEvent returns the event reporting the crash which caused the current boot, i.e.
+// the latest crash saved within the boot crash window before the boot. It returns nil if
+// the current boot is not caused by a crash.
+func (km *kdumpMonitor) bootCrashEvent(crashes []crash) *types.Event {
+	bootTime, err := km.bootTime()
+	if err != nil {
+		glog.Errorf("Failed to get boot time: %v", err)
+		return nil
+	}
+	for i := len(crashes) - 1; i >= 0; i-- {
+		c := crashes[i]
+		if c.time.After(bootTime) {
+			continue
+		}
+		if bootTime.Sub(c.time) > km.config.BootCrashWindow {
+			return nil
+		}
+		glog.Infof("Found crash %q causing the current boot", c.dir)
+		if *km.config.EnableMetricsReporting {
+			err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(crashReason, 1)
+			if err != nil {
+				glog.Errorf("Failed to update problem counter metrics for %q: %v", crashReason, err)
+			}
+		}
+		return &types.Event{
+			Severity:  types.Warn,
+			Timestamp: c.time,
+			Reason:    crashReason,
+			Message:   fmt.Sprintf("Kernel crashed before the node booted, dump saved to %s: %s", c.dir, km.panicReason(c)),
+		}
+	}
+	return nil
+}
+
+// panicReason extracts the panic reason from the kernel log of the crash.
+func (km *kdumpMonitor) panicReason(c crash) string {
+	f, err := os.Open(filepath.Join(c.dir, km.config.DmesgFile))
+	if err != nil {
+		return "no kernel log saved"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// Kernel log lines may be long, e.g. with many modules linked in.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, re := range km.config.PanicRegexps {
+			match := re.FindStringSubmatch(scanner.Text())
+			if match == nil {
+				continue
+			}
+			reason := match[0]
+			if len(match) > 1 {
+				reason = match[1]
+			}
+			if len(reason) > *km.config.MaxOutputLength {
+				reason = reason[:*km.config.MaxOutputLength]
+			}
+			return reason
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		glog.Errorf("Failed to read kernel log of crash %q: %v", c.dir, err)
+	}
+	return "unknown reason"
+}
+
+// checkRecurrence updates the condition with the number of crashes in the recurrence
+// window, and returns a new status if the condition changes.
+func (km *kdumpMonitor) checkRecurrence(crashes []crash, now time.Time) *types.Status {
+	var recent []crash
+	for _, c := range crashes {
+		if now.Sub(c.time) <= km.config.RecurrenceWindow {
+			recent = append(recent, c)
+		}
+	}
+
+	status, reason, message := types.False, km.config.DefaultCondition.Reason, km.config.DefaultCondition.Message
+	if len(recent) >= *km.config.RecurrenceThreshold {
+		status, reason = types.True, frequentCrashReason
+		message = fmt.Sprintf("Kernel crashed %d times in %v, latest dump saved to %s",
+			len(recent), km.config.RecurrenceWindow, recent[len(recent)-1].dir)
+	}
+	if km.condition.Status == status && km.condition.Reason == reason && km.condition.Message == message {
+		return nil
+	}
+
+	var events []types.Event
+	if km.condition.Status != status {
+		km.condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(km.condition.Type, status, reason, now))
+		if *km.config.EnableMetricsReporting {
+			km.updateProblemMetrics(status == types.True)
+		}
+	}
+	km.condition.Status = status
+	km.condition.Reason = reason
+	km.condition.Message = message
+	return &types.Status{
+		Source:     km.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{km.condition},
+	}
+}
+
+func (km *kdumpMonitor) updateProblemMetrics(active bool) {
+	if active {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(frequentCrashReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", frequentCrashReason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(km.config.DefaultCondition.Type, frequentCrashReason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			km.config.DefaultCondition.Type, frequentCrashReason, err)
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kdumpmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	kmtypes "k8s.io/node-problem-detector/pkg/kdumpmonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(KdumpMonitorName) },
+		"Kdump monitor failed to register itself as a problem daemon.")
+}
+
+func newTestMonitor(t *testing.T, crashDir string, bootTime time.Time) *kdumpMonitor {
+	disabled := false
+	km := &kdumpMonitor{
+		config: kmtypes.KdumpConfig{
+			CrashDir:               crashDir,
+			EnableMetricsReporting: &disabled,
+		},
+		bootTime: func() (time.Time, error) { return bootTime, nil },
+	}
+	assert.NoError(t, km.config.ApplyConfiguration())
+	assert.NoError(t, km.config.Validate())
+	km.condition = *km.config.DefaultCondition
+	km.condition.Status = types.False
+	return km
+}
+
+// addCrash saves a crash dump with the kernel log at the time.
+func addCrash(t *testing.T, crashDir, name, dmesg string, at time.Time) {
+	dir := filepath.Join(crashDir, name)
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	if dmesg != "" {
+		file := filepath.Join(dir, "vmcore-dmesg.txt")
+		assert.NoError(t, ioutil.WriteFile(file, []byte(dmesg), 0644))
+		assert.NoError(t, os.Chtimes(file, at, at))
+	}
+	assert.NoError(t, os.Chtimes(dir, at, at))
+}
+
+func TestBootCrashEvent(t *testing.T) {
+	bootTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	nullDeref := `[ 10.0] BUG: unable to handle kernel NULL pointer dereference at 0000000000000008
+[ 10.1] Oops: 0002 [#1] SMP PTI
+[ 10.2] Kernel panic - not syncing: Fatal exception in interrupt
+`
+	type savedCrash struct {
+		name  string
+		dmesg string
+		at    time.Time
+	}
+	for _, test := range []struct {
+		desc    string
+		crashes []savedCrash
+		// dir is the crash expected to be reported, empty if no event is expected.
+		dir    string
+		reason string
+	}{
+		{
+			desc: "no crash dump",
+		},
+		{
+			desc: "crash long before the boot",
+			crashes: []savedCrash{
+				{"old", "[ 1.0] Kernel panic - not syncing: Fatal exception\n", bootTime.Add(-48 * time.Hour)},
+			},
+		},
+		{
+			desc: "crash after the boot",
+			crashes: []savedCrash{
+				{"later", "[ 1.0] Kernel panic - not syncing: Fatal exception\n", bootTime.Add(10 * time.Minute)},
+			},
+		},
+		{
+			desc: "crash just before the boot",
+			crashes: []savedCrash{
+				{"new", nullDeref, bootTime.Add(-2 * time.Minute)},
+			},
+			dir: "new",
+			// The first line matching a panic pattern gives the reason.
+			reason: "BUG: unable to handle kernel NULL pointer dereference",
+		},
+		{
+			desc: "latest crash before the boot is reported",
+			crashes: []savedCrash{
+				{"first", "[ 1.0] Kernel panic - not syncing: Fatal exception\n", bootTime.Add(-30 * time.Minute)},
+				{"second", nullDeref, bootTime.Add(-2 * time.Minute)},
+				{"later", "[ 1.0] Kernel panic - not syncing: Fatal exception\n", bootTime.Add(10 * time.Minute)},
+			},
+			dir:    "second",
+			reason: "BUG: unable to handle kernel NULL pointer dereference",
+		},
+		{
+			desc: "crash without kernel log",
+			crashes: []savedCrash{
+				{"no-log", "", bootTime.Add(-2 * time.Minute)},
+			},
+			dir:    "no-log",
+			reason: "no kernel log saved",
+		},
+	} {
+		crashDir, err := ioutil.TempDir("", "kdump-monitor")
+		assert.NoError(t, err)
+		defer os.RemoveAll(crashDir)
+		for _, c := range test.crashes {
+			addCrash(t, crashDir, c.name, c.dmesg, c.at)
+		}
+		km := newTestMonitor(t, crashDir, bootTime)
+
+		event := km.bootCrashEvent(km.listCrashes())
+		if test.dir == "" {
+			assert.Nil(t, event, test.desc)
+			continue
+		}
+		if assert.NotNil(t, event, test.desc) {
+			assert.Equal(t, "KernelCrash", event.Reason, test.desc)
+			assert.Equal(t, types.Warn, event.Severity, test.desc)
+			assert.Contains(t, event.Message, filepath.Join(crashDir, test.dir), test.desc)
+			assert.Contains(t, event.Message, test.reason, test.desc)
+		}
+	}
+}
+
+func TestPanicReason(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		dmesg    string
+		expected string
+	}{
+		{
+			desc:     "panic message",
+			dmesg:    "[ 1.0] sysrq: Trigger a crash\n[ 1.1] Kernel panic - not syncing: sysrq triggered crash\n",
+			expected: "sysrq triggered crash",
+		},
+		{
+			desc:     "no line matching a panic pattern",
+			dmesg:    "[ 1.0] nothing to see\n",
+			expected: "unknown reason",
+		},
+		{
+			desc:     "no kernel log",
+			expected: "no kernel log saved",
+		},
+		{
+			desc:     "long reason is truncated",
+			dmesg:    "[ 1.0] Kernel panic - not syncing: " + strings.Repeat("x", 300) + "\n",
+			expected: strings.Repeat("x", 256),
+		},
+	} {
+		crashDir, err := ioutil.TempDir("", "kdump-monitor")
+		assert.NoError(t, err)
+		defer os.RemoveAll(crashDir)
+		addCrash(t, crashDir, "crash", test.dmesg, time.Now())
+		km := newTestMonitor(t, crashDir, time.Now())
+
+		assert.Equal(t, test.expected, km.panicReason(crash{dir: filepath.Join(crashDir, "crash")}), test.desc)
+	}
+}
+
+func TestCheckRecurrence(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		desc    string
+		initial types.ConditionStatus
+		crashes []crash
+		// expected is the expected condition status, empty if no status is expected.
+		expected types.ConditionStatus
+		reason   string
+		dir      string
+		events   int
+	}{
+		{
+			desc:    "no crash",
+			initial: types.False,
+		},
+		{
+			desc:    "one crash in the window",
+			initial: types.False,
+			crashes: []crash{
+				{dir: "/var/crash/1", time: now.Add(-10 * 24 * time.Hour)},
+				{dir: "/var/crash/2", time: now.Add(-24 * time.Hour)},
+			},
+		},
+		{
+			desc:    "crashes recur in the window",
+			initial: types.False,
+			crashes: []crash{
+				{dir: "/var/crash/1", time: now.Add(-24 * time.Hour)},
+				{dir: "/var/crash/2", time: now.Add(-time.Hour)},
+			},
+			expected: types.True,
+			reason:   "FrequentKernelCrash",
+			dir:      "/var/crash/2",
+			events:   1,
+		},
+		{
+			desc:    "another crash updates the message without an event",
+			initial: types.True,
+			crashes: []crash{
+				{dir: "/var/crash/1", time: now.Add(-24 * time.Hour)},
+				{dir: "/var/crash/2", time: now.Add(-time.Hour)},
+			},
+			expected: types.True,
+			reason:   "FrequentKernelCrash",
+			dir:      "/var/crash/2",
+		},
+		{
+			desc:    "crashes aged out of the window",
+			initial: types.True,
+			crashes: []crash{
+				{dir: "/var/crash/1", time: now.Add(-9 * 24 * time.Hour)},
+				{dir: "/var/crash/2", time: now.Add(-8 * 24 * time.Hour)},
+			},
+			expected: types.False,
+			reason:   "NoFrequentKernelCrash",
+			events:   1,
+		},
+	} {
+		km := newTestMonitor(t, "", now)
+		if test.initial == types.True {
+			km.condition.Status = types.True
+			km.condition.Reason = "FrequentKernelCrash"
+			km.condition.Message = "Kernel crashed 2 times in 168h0m0s, latest dump saved to /var/crash/1"
+		}
+
+		status := km.checkRecurrence(test.crashes, now)
+		if test.expected == "" {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if assert.NotNil(t, status, test.desc) {
+			assert.Equal(t, test.expected, status.Conditions[0].Status, test.desc)
+			assert.Equal(t, test.reason, status.Conditions[0].Reason, test.desc)
+			assert.Contains(t, status.Conditions[0].Message, test.dir, test.desc)
+			assert.Len(t, status.Events, test.events, test.desc)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+var (
+	defaultSource                 = "kdump-monitor"
+	defaultCrashDir               = "/var/crash"
+	defaultDmesgFile              = "vmcore-dmesg.txt"
+	defaultCheckIntervalString    = (1 * time.Hour).String()
+	defaultBootCrashWindowString  = (1 * time.Hour).String()
+	defaultRecurrenceWindowString = (7 * 24 * time.Hour).String()
+	defaultRecurrenceThreshold    = 2
+	defaultEnableMetrics          = true
+	defaultMaxOutputLength        = 256
+	defaultPanicPatterns          = []string{
+		`Kernel panic - not syncing: (.*)`,
+		`(BUG: .*)`,
+		`(Oops: .*)`,
+		`(general protection fault.*)`,
+	}
+	defaultCondition = types.Condition{
+		Type:    "FrequentKernelCrash",
+		Reason:  "NoFrequentKernelCrash",
+		Message: "kernel does not crash frequently",
+	}
+)
+
+type KdumpConfig struct {
+	// Source is the source name of the kdump monitor.
+	Source string `json:"source"`
+	// CrashDir is the directory kdump saves crash dumps to, one sub directory per crash.
+	CrashDir string `json:"crashDir"`
+	// DmesgFile is the name of the kernel log file saved in each crash directory.
+	DmesgFile string `json:"dmesgFile"`
+	// PanicPatterns match the kernel log lines giving the panic reason. The first capture
+	// group, or else the whole match, is the reason. The first matching line is used.
+	PanicPatterns []string         `json:"panicPatterns"`
+	PanicRegexps  []*regexp.Regexp `json:"-"`
+	// CheckIntervalString is the interval at which recurring crashes are checked.
+	CheckIntervalString string        `json:"checkInterval"`
+	CheckInterval       time.Duration `json:"-"`
+	// BootCrashWindowString is how long before the current boot a crash may be saved to
+	// be reported as the crash causing the boot.
+	BootCrashWindowString string        `json:"bootCrashWindow"`
+	BootCrashWindow       time.Duration `json:"-"`
+	// RecurrenceWindowString is the window in which RecurrenceThreshold crashes set the
+	// condition.
+	RecurrenceWindowString string        `json:"recurrenceWindow"`
+	RecurrenceWindow       time.Duration `json:"-"`
+	// RecurrenceThreshold is the number of crashes in the recurrence window setting the
+	// condition.
+	RecurrenceThreshold *int `json:"recurrenceThreshold,omitempty"`
+	// DefaultCondition is the default state of the recurring crash condition.
+	DefaultCondition *types.Condition `json:"condition,omitempty"`
+	// MaxOutputLength is the maximum length of the panic reason in messages.
+	MaxOutputLength *int `json:"maxOutputLength,omitempty"`
+	// EnableMetricsReporting describes whether to count the kernel crashes by reason and
+	// report the FrequentKernelCrash condition as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (kc *KdumpConfig) ApplyConfiguration() error {
+	if kc.Source == "" {
+		kc.Source = defaultSource
+	}
+	if kc.CrashDir == "" {
+		kc.CrashDir = defaultCrashDir
+	}
+	if kc.DmesgFile == "" {
+		kc.DmesgFile = defaultDmesgFile
+	}
+	if len(kc.PanicPatterns) == 0 {
+		kc.PanicPatterns = defaultPanicPatterns
+	}
+	if kc.CheckIntervalString == "" {
+		kc.CheckIntervalString = defaultCheckIntervalString
+	}
+	if kc.BootCrashWindowString == "" {
+		kc.BootCrashWindowString = defaultBootCrashWindowString
+	}
+	if kc.RecurrenceWindowString == "" {
+		kc.RecurrenceWindowString = defaultRecurrenceWindowString
+	}
+	if kc.RecurrenceThreshold == nil {
+		kc.RecurrenceThreshold = &defaultRecurrenceThreshold
+	}
+	if kc.DefaultCondition == nil {
+		condition := defaultCondition
+		kc.DefaultCondition = &condition
+	}
+	if kc.MaxOutputLength == nil {
+		kc.MaxOutputLength = &defaultMaxOutputLength
+	}
+	if kc.EnableMetricsReporting == nil {
+		kc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	kc.CheckInterval, err = time.ParseDuration(kc.CheckIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing CheckIntervalString %q: %v", kc.CheckIntervalString, err)
+	}
+	kc.BootCrashWindow, err = time.ParseDuration(kc.BootCrashWindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing BootCrashWindowString %q: %v", kc.BootCrashWindowString, err)
+	}
+	kc.RecurrenceWindow, err = time.ParseDuration(kc.RecurrenceWindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing RecurrenceWindowString %q: %v", kc.RecurrenceWindowString, err)
+	}
+	kc.PanicRegexps = nil
+	for _, pattern := range kc.PanicPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("error in compiling panic pattern %q: %v", pattern, err)
+		}
+		kc.PanicRegexps = append(kc.PanicRegexps, re)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (kc *KdumpConfig) Validate() error {
+	if kc.CheckInterval <= time.Duration(0) {
+		return fmt.Errorf("CheckInterval %v must be above 0s", kc.CheckInterval)
+	}
+	if kc.BootCrashWindow <= time.Duration(0) {
+		return fmt.Errorf("BootCrashWindow %v must be above 0s", kc.BootCrashWindow)
+	}
+	if kc.RecurrenceWindow <= time.Duration(0) {
+		return fmt.Errorf("RecurrenceWindow %v must be above 0s", kc.RecurrenceWindow)
+	}
+	if *kc.RecurrenceThreshold < 1 {
+		return fmt.Errorf("RecurrenceThreshold %d must be at least 1", *kc.RecurrenceThreshold)
+	}
+	if kc.DefaultCondition.Type == "" || kc.DefaultCondition.Reason == "" {
+		return fmt.Errorf("condition type and reason must not be empty: %+v", *kc.DefaultCondition)
+	}
+	return nil
+}
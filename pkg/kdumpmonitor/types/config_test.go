@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	zero := 0
+	testCases := []struct {
+		name      string
+		config    KdumpConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: KdumpConfig{},
+		},
+		{
+			name:      "invalid panic pattern",
+			config:    KdumpConfig{PanicPatterns: []string{"("}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid recurrence window",
+			config:    KdumpConfig{RecurrenceWindowString: "1 week"},
+			expectErr: true,
+		},
+		{
+			name:      "zero recurrence threshold",
+			config:    KdumpConfig{RecurrenceThreshold: &zero},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
+
+func TestDefaultConfiguration(t *testing.T) {
+	config := KdumpConfig{}
+	if err := config.ApplyConfiguration(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.CrashDir != "/var/crash" || config.DmesgFile != "vmcore-dmesg.txt" {
+		t.Errorf("Unexpected crash dump location %s/<crash>/%s", config.CrashDir, config.DmesgFile)
+	}
+	if len(config.PanicRegexps) != len(defaultPanicPatterns) {
+		t.Errorf("Expected %d panic regexps, got %d", len(defaultPanicPatterns), len(config.PanicRegexps))
+	}
+	if config.DefaultCondition.Type != "FrequentKernelCrash" {
+		t.Errorf("Unexpected default condition %+v", *config.DefaultCondition)
+	}
+}
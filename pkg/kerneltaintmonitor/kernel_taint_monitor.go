@@ -0,0 +1,314 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kerneltaintmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	kttypes "k8s.io/node-problem-detector/pkg/kerneltaintmonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const KernelTaintMonitorName = "kernel-taint-monitor"
+
+const (
+	healthyReason  = "KernelIsNotTainted"
+	taintedReason  = "KernelIsTainted"
+	newTaintReason = "KernelTaintAdded"
+)
+
+func init() {
+	problemdaemon.Register(KernelTaintMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewKernelTaintMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type kernelTaintMonitor struct {
+	configPath string
+	config     kttypes.KernelTaintConfig
+	// readMask reads the taint bitmask of the kernel.
+	readMask func() (uint64, error)
+	// mask is the taint bitmask of the last check, nil before the first check.
+	mask       *uint64
+	condition  types.Condition
+	taints     metrics.Int64MetricInterface
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewKernelTaintMonitorOrDie creates a kernel taint monitor, panics if error occurs.
+func NewKernelTaintMonitorOrDie(configPath string) types.Monitor {
+	ktm := kernelTaintMonitor{
+		configPath: configPath,
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &ktm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = ktm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = ktm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, ktm.config, err)
+	}
+	ktm.readMask = func() (uint64, error) {
+		return readTaintMask(ktm.config.TaintedPath)
+	}
+
+	// A 1000 size channel should be big enough.
+	ktm.statusChan = make(chan *types.Status, 1000)
+
+	if *ktm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(ktm.config.ConditionType)
+		ktm.taints = taintsMetricOrDie()
+	}
+	return &ktm
+}
+
+var (
+	taints     metrics.Int64MetricInterface
+	taintsOnce sync.Once
+)
+
+// taintsMetricOrDie returns the metric of the taint flags of the kernel, panic if error
+// occurs. The metric is shared by all kernel taint monitors.
+func taintsMetricOrDie() metrics.Int64MetricInterface {
+	taintsOnce.Do(func() {
+		metric, err := metrics.NewInt64Metric(
+			metrics.KernelTaintID,
+			string(metrics.KernelTaintID),
+			"Whether each taint flag of the kernel is set.",
+			"1",
+			metrics.LastValue,
+			[]string{"flag"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.KernelTaintID, err)
+		}
+		taints = metric
+	})
+	return taints
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for the condition and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, taintedReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			conditionType, taintedReason, err)
+	}
+	for _, reason := range []string{taintedReason, newTaintReason} {
+		err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+		}
+	}
+}
+
+func (ktm *kernelTaintMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start kernel taint monitor %s", ktm.configPath)
+	problemdaemon.Go(ktm, ktm.monitorLoop)
+	return ktm.statusChan, nil
+}
+
+func (ktm *kernelTaintMonitor) Stop() {
+	glog.Infof("Stop kernel taint monitor %s", ktm.configPath)
+	ktm.tomb.Stop()
+}
+
+func (ktm *kernelTaintMonitor) monitorLoop() {
+	defer ktm.tomb.Done()
+
+	runTicker := time.NewTicker(ktm.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	ktm.initializeStatus()
+	if status := ktm.check(time.Now()); status != nil {
+		ktm.statusChan <- status
+	}
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := ktm.check(now); status != nil {
+				ktm.statusChan <- status
+			}
+		case <-ktm.tomb.Stopping():
+			glog.Infof("Kernel taint monitor stopped: %s", ktm.configPath)
+			return
+		}
+	}
+}
+
+func (ktm *kernelTaintMonitor) initializeStatus() {
+	ktm.condition = types.Condition{
+		Type:       ktm.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     healthyReason,
+		Message:    ktm.healthyMessage(),
+	}
+	ktm.statusChan <- &types.Status{
+		Source:     ktm.config.Source,
+		Conditions: []types.Condition{ktm.condition},
+	}
+}
+
+func (ktm *kernelTaintMonitor) healthyMessage() string {
+	if len(ktm.config.ConditionTaints) == 0 {
+		return "kernel taints only report events"
+	}
+	return fmt.Sprintf("kernel is not tainted by %s", strings.Join(ktm.config.ConditionTaints, ", "))
+}
+
+// check reads the taint flags, and returns a new status if flags are set or the condition
+// changes. The flags of a running kernel are never cleared, so the condition is only
+// cleared by a reboot. The flags set before the first check only set the condition, the
+// flags set later are also reported as events.
+func (ktm *kernelTaintMonitor) check(now time.Time) *types.Status {
+	mask, err := ktm.readMask()
+	if err != nil {
+		glog.Errorf("Failed to read kernel taint flags: %v", err)
+		return nil
+	}
+	ktm.recordMetrics(mask)
+
+	var events []types.Event
+	if ktm.mask != nil {
+		if added := kttypes.DecodeTaints(mask &^ *ktm.mask); len(added) > 0 {
+			events = append(events, types.Event{
+				Severity:  types.Warn,
+				Timestamp: now,
+				Reason:    newTaintReason,
+				Message:   "kernel is tainted: " + describe(added),
+			})
+		}
+	}
+	ktm.mask = &mask
+
+	var conditionTaints []kttypes.Taint
+	for _, taint := range kttypes.DecodeTaints(mask) {
+		for _, flag := range ktm.config.ConditionTaints {
+			if taint.Flag == flag {
+				conditionTaints = append(conditionTaints, taint)
+			}
+		}
+	}
+	status, reason, message := types.False, healthyReason, ktm.healthyMessage()
+	if len(conditionTaints) > 0 {
+		status, reason, message = types.True, taintedReason, "kernel is tainted: "+describe(conditionTaints)
+	}
+	transitioned := status != ktm.condition.Status
+	if len(events) == 0 && !transitioned && message == ktm.condition.Message {
+		return nil
+	}
+	if transitioned {
+		ktm.condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(ktm.condition.Type, status, reason, now))
+	}
+	ktm.condition.Status = status
+	ktm.condition.Reason = reason
+	ktm.condition.Message = message
+
+	if *ktm.config.EnableMetricsReporting {
+		ktm.updateProblemMetrics(transitioned, len(events) > 0 && events[0].Reason == newTaintReason)
+	}
+	return &types.Status{
+		Source:     ktm.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{ktm.condition},
+	}
+}
+
+// describe returns the flags with their descriptions, e.g. "O (externally-built
+// (out-of-tree) module was loaded)".
+func describe(taints []kttypes.Taint) string {
+	var descriptions []string
+	for _, taint := range taints {
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", taint.Flag, taint.Description))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// readTaintMask reads the taint bitmask of the kernel, printed in decimal.
+func readTaintMask(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	mask, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q: %v", path, err)
+	}
+	return mask, nil
+}
+
+func (ktm *kernelTaintMonitor) recordMetrics(mask uint64) {
+	if ktm.taints == nil {
+		return
+	}
+	for _, taint := range kttypes.Taints {
+		var set int64
+		if mask&(1<<taint.Bit) != 0 {
+			set = 1
+		}
+		if err := ktm.taints.Record(map[string]string{"flag": taint.Flag}, set); err != nil {
+			glog.Errorf("Failed to record kernel taint flag %q: %v", taint.Flag, err)
+		}
+	}
+}
+
+func (ktm *kernelTaintMonitor) updateProblemMetrics(transitioned, added bool) {
+	active := ktm.condition.Status == types.True
+	if active && transitioned {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(taintedReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", taintedReason, err)
+		}
+	}
+	if added {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(newTaintReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", newTaintReason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(ktm.condition.Type, taintedReason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			ktm.condition.Type, taintedReason, err)
+	}
+}
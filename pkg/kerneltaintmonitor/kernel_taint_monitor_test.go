@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kerneltaintmonitor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	kttypes "k8s.io/node-problem-detector/pkg/kerneltaintmonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(KernelTaintMonitorName) },
+		"Kernel taint monitor failed to register itself as a problem daemon.")
+}
+
+func TestReadTaintMask(t *testing.T) {
+	f, err := ioutil.TempFile("", "tainted")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte("4096\n"), 0644))
+	mask, err := readTaintMask(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4096), mask)
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte("tainted\n"), 0644))
+	_, err = readTaintMask(f.Name())
+	assert.Error(t, err)
+}
+
+func newTestMonitor(t *testing.T) *kernelTaintMonitor {
+	disabled := false
+	ktm := &kernelTaintMonitor{
+		config: kttypes.KernelTaintConfig{
+			EnableMetricsReporting: &disabled,
+		},
+		statusChan: make(chan *types.Status, 1000),
+	}
+	assert.NoError(t, ktm.config.ApplyConfiguration())
+	assert.NoError(t, ktm.config.Validate())
+	ktm.initializeStatus()
+	<-ktm.statusChan
+	return ktm
+}
+
+func TestCheck(t *testing.T) {
+	const (
+		forced    = uint64(1 << 1)
+		mce       = uint64(1 << 4)
+		warning   = uint64(1 << 9)
+		outOfTree = uint64(1 << 12)
+		unsigned  = uint64(1 << 13)
+	)
+	for _, test := range []struct {
+		desc string
+		// checked is whether the mask was checked before, last is the mask then.
+		checked bool
+		last    uint64
+		current uint64
+		err     error
+		// expected is the expected condition status, empty if no status is expected.
+		expected types.ConditionStatus
+		message  string
+		events   []string
+	}{
+		{
+			desc: "untainted kernel",
+		},
+		{
+			desc:    "unsigned modules do not set the condition",
+			current: unsigned,
+		},
+		{
+			desc:     "flags set before the first check only set the condition",
+			current:  forced | outOfTree,
+			expected: types.True,
+			message:  "kernel is tainted: F (module was force loaded), O (externally-built (out-of-tree) module was loaded)",
+			events:   []string{taintedReason},
+		},
+		{
+			desc:    "unchanged flags are not reported again",
+			checked: true,
+			last:    outOfTree,
+			current: outOfTree,
+		},
+		{
+			desc:     "new flag setting the condition",
+			checked:  true,
+			last:     unsigned,
+			current:  unsigned | outOfTree,
+			expected: types.True,
+			message:  "kernel is tainted: O (externally-built (out-of-tree) module was loaded)",
+			events:   []string{newTaintReason, taintedReason},
+		},
+		{
+			desc:     "new flags while the condition is set update the message",
+			checked:  true,
+			last:     unsigned | outOfTree,
+			current:  unsigned | outOfTree | mce | warning,
+			expected: types.True,
+			message:  "kernel is tainted: M (processor reported a machine check exception), O (externally-built (out-of-tree) module was loaded)",
+			events:   []string{newTaintReason},
+		},
+		{
+			desc:     "new flag not setting the condition is only reported as an event",
+			checked:  true,
+			last:     0,
+			current:  warning,
+			expected: types.False,
+			events:   []string{newTaintReason},
+		},
+		{
+			desc:    "read error",
+			checked: true,
+			last:    outOfTree,
+			err:     errors.New("procfs unavailable"),
+		},
+	} {
+		ktm := newTestMonitor(t)
+		if test.checked {
+			ktm.readMask = func() (uint64, error) { return test.last, nil }
+			ktm.check(time.Now())
+		}
+		ktm.readMask = func() (uint64, error) { return test.current, test.err }
+
+		status := ktm.check(time.Now())
+		if test.expected == "" {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if !assert.NotNil(t, status, test.desc) {
+			continue
+		}
+		assert.Equal(t, test.expected, status.Conditions[0].Status, test.desc)
+		if test.message != "" {
+			assert.Equal(t, test.message, status.Conditions[0].Message, test.desc)
+		}
+		var reasons []string
+		for _, event := range status.Events {
+			reasons = append(reasons, event.Reason)
+		}
+		assert.Equal(t, test.events, reasons, test.desc)
+	}
+}
+
+func TestNewTaintEvent(t *testing.T) {
+	ktm := newTestMonitor(t)
+	ktm.readMask = func() (uint64, error) { return 0, nil }
+	ktm.check(time.Now())
+	ktm.readMask = func() (uint64, error) { return 1<<4 | 1<<9, nil }
+
+	now := time.Now()
+	status := ktm.check(now)
+	if assert.NotNil(t, status) && assert.NotEmpty(t, status.Events) {
+		assert.Equal(t, types.Event{
+			Severity:  types.Warn,
+			Timestamp: now,
+			Reason:    newTaintReason,
+			Message:   "kernel is tainted: M (processor reported a machine check exception), W (kernel issued warning)",
+		}, status.Events[0])
+	}
+}
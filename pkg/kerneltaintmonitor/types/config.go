@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	defaultSource               = "kernel-taint-monitor"
+	defaultInvokeIntervalString = (60 * time.Second).String()
+	defaultTaintedPath          = "/proc/sys/kernel/tainted"
+	defaultConditionTaints      = []string{"F", "R", "M", "O"}
+	defaultEnableMetrics        = true
+	defaultConditionType        = "KernelTainted"
+)
+
+type KernelTaintConfig struct {
+	// Source is the source name of the kernel taint monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which the taint flags are read.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// TaintedPath is the path of the taint bitmask of the kernel.
+	TaintedPath string `json:"taintedPath"`
+	// ConditionTaints are the letters of the taint flags setting the condition, e.g. "O"
+	// for out-of-tree modules. Default to force loaded (F) and force unloaded (R)
+	// modules, machine check exceptions (M) and out-of-tree modules (O). The other flags
+	// only report events.
+	ConditionTaints []string `json:"conditionTaints"`
+	// ConditionType is the type of the condition. Default to "KernelTainted".
+	ConditionType string `json:"conditionType"`
+	// EnableMetricsReporting describes whether to report problems and taint flags as
+	// metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (ktc *KernelTaintConfig) ApplyConfiguration() error {
+	if ktc.Source == "" {
+		ktc.Source = defaultSource
+	}
+	if ktc.InvokeIntervalString == "" {
+		ktc.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if ktc.TaintedPath == "" {
+		ktc.TaintedPath = defaultTaintedPath
+	}
+	if ktc.ConditionTaints == nil {
+		ktc.ConditionTaints = defaultConditionTaints
+	}
+	if ktc.ConditionType == "" {
+		ktc.ConditionType = defaultConditionType
+	}
+	if ktc.EnableMetricsReporting == nil {
+		ktc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	ktc.InvokeInterval, err = time.ParseDuration(ktc.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", ktc.InvokeIntervalString, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (ktc *KernelTaintConfig) Validate() error {
+	if ktc.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", ktc.InvokeInterval)
+	}
+	for _, flag := range ktc.ConditionTaints {
+		if !IsTaintFlag(flag) {
+			return fmt.Errorf("unknown taint flag %q", flag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    KernelTaintConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: KernelTaintConfig{},
+		},
+		{
+			name:   "only events",
+			config: KernelTaintConfig{ConditionTaints: []string{}},
+		},
+		{
+			name:      "invalid invoke interval",
+			config:    KernelTaintConfig{InvokeIntervalString: "1 minute"},
+			expectErr: true,
+		},
+		{
+			name:      "unknown taint flag",
+			config:    KernelTaintConfig{ConditionTaints: []string{"O", "Z"}},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
+
+func TestDecodeTaints(t *testing.T) {
+	for mask, expected := range map[uint64][]string{
+		0:               nil,
+		4096:            {"O"},
+		1<<4 | 1<<12:    {"M", "O"},
+		1<<13 | 1<<40:   {"E", "?"},
+		1<<0 | 1<<1 | 8: {"P", "F", "R"},
+	} {
+		var flags []string
+		for _, taint := range DecodeTaints(mask) {
+			flags = append(flags, taint.Flag)
+		}
+		if !reflect.DeepEqual(flags, expected) {
+			t.Errorf("Expect taint flags %v of %d, got %v", expected, mask, flags)
+		}
+	}
+}
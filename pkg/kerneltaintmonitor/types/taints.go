@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+)
+
+// Taint is a kernel taint flag, see
+// https://www.kernel.org/doc/html/latest/admin-guide/tainted-kernels.html.
+type Taint struct {
+	// Bit is the bit of the flag in /proc/sys/kernel/tainted.
+	Bit uint
+	// Flag is the letter of the flag in the kernel oops reports, e.g. "O".
+	Flag string
+	// Description tells why the kernel is tainted.
+	Description string
+}
+
+// Taints are the kernel taint flags, by bit.
+var Taints = []Taint{
+	{0, "P", "proprietary module was loaded"},
+	{1, "F", "module was force loaded"},
+	{2, "S", "kernel running on an out of specification system"},
+	{3, "R", "module was force unloaded"},
+	{4, "M", "processor reported a machine check exception"},
+	{5, "B", "bad page referenced or some unexpected page flags"},
+	{6, "U", "taint requested by userspace application"},
+	{7, "D", "kernel died recently, i.e. there was an OOPS or BUG"},
+	{8, "A", "ACPI table overridden by user"},
+	{9, "W", "kernel issued warning"},
+	{10, "C", "staging driver was loaded"},
+	{11, "I", "workaround for bug in platform firmware applied"},
+	{12, "O", "externally-built (out-of-tree) module was loaded"},
+	{13, "E", "unsigned module was loaded"},
+	{14, "L", "soft lockup occurred"},
+	{15, "K", "kernel has been live patched"},
+	{16, "X", "auxiliary taint, defined for and used by distros"},
+	{17, "T", "kernel was built with the struct randomization plugin"},
+	{18, "N", "an in-kernel test has been run"},
+}
+
+// IsTaintFlag returns whether the letter is a known taint flag.
+func IsTaintFlag(flag string) bool {
+	for _, t := range Taints {
+		if t.Flag == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeTaints returns the taint flags set in the bitmask of /proc/sys/kernel/tainted,
+// ordered by bit. Unknown bits are returned with the flag "?".
+func DecodeTaints(mask uint64) []Taint {
+	var taints []Taint
+	for bit := uint(0); bit < 64; bit++ {
+		if mask&(1<<bit) == 0 {
+			continue
+		}
+		if int(bit) < len(Taints) {
+			taints = append(taints, Taints[bit])
+			continue
+		}
+		taints = append(taints, Taint{Bit: bit, Flag: "?", Description: fmt.Sprintf("unknown taint bit %d", bit)})
+	}
+	return taints
+}
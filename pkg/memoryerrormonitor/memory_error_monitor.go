@@ -0,0 +1,315 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package memoryerrormonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	memtypes "k8s.io/node-problem-detector/pkg/memoryerrormonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const MemoryErrorMonitorName = "memory-error-monitor"
+
+const (
+	healthyReason   = "MemoryHardwareIsHealthy"
+	healthyMessage  = "memory error rates are below thresholds"
+	errorRateReason = "MemoryErrorRateHigh"
+)
+
+func init() {
+	problemdaemon.Register(MemoryErrorMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewMemoryErrorMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+// sample is the error counts of all DIMMs at a time.
+type sample struct {
+	time   time.Time
+	counts map[string]errorCounts
+}
+
+type memoryErrorMonitor struct {
+	configPath string
+	config     memtypes.MemoryErrorConfig
+	// readCounts reads the cumulative error counts of all DIMMs.
+	readCounts func() (map[string]errorCounts, error)
+	// samples are the samples in the rate window, oldest first. The first sample is the
+	// baseline the errors in the window are counted from.
+	samples    []sample
+	eccErrors  metrics.Int64MetricInterface
+	condition  types.Condition
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewMemoryErrorMonitorOrDie creates a memory error monitor, panics if error occurs.
+func NewMemoryErrorMonitorOrDie(configPath string) types.Monitor {
+	mem := memoryErrorMonitor{
+		configPath: configPath,
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &mem.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = mem.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = mem.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, mem.config, err)
+	}
+	mem.readCounts = mem.readAllCounts
+
+	// A 1000 size channel should be big enough.
+	mem.statusChan = make(chan *types.Status, 1000)
+
+	if *mem.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(mem.config.ConditionType)
+		mem.eccErrors = eccErrorsMetricOrDie()
+	}
+	return &mem
+}
+
+var (
+	eccErrors     metrics.Int64MetricInterface
+	eccErrorsOnce sync.Once
+)
+
+// eccErrorsMetricOrDie returns the metric of the ECC error counts of each DIMM, panic if
+// error occurs. The metric is shared by all memory error monitors.
+func eccErrorsMetricOrDie() metrics.Int64MetricInterface {
+	eccErrorsOnce.Do(func() {
+		metric, err := metrics.NewInt64Metric(
+			metrics.MemoryECCErrorCountID,
+			string(metrics.MemoryECCErrorCountID),
+			"Cumulative number of memory ECC errors of each DIMM since boot.",
+			"1",
+			metrics.LastValue,
+			[]string{"dimm", "type"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.MemoryECCErrorCountID, err)
+		}
+		eccErrors = metric
+	})
+	return eccErrors
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for the condition and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, errorRateReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			conditionType, errorRateReason, err)
+	}
+	err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(errorRateReason, 0)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", errorRateReason, err)
+	}
+}
+
+func (mem *memoryErrorMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start memory error monitor %s", mem.configPath)
+	problemdaemon.Go(mem, mem.monitorLoop)
+	return mem.statusChan, nil
+}
+
+func (mem *memoryErrorMonitor) Stop() {
+	glog.Infof("Stop memory error monitor %s", mem.configPath)
+	mem.tomb.Stop()
+}
+
+func (mem *memoryErrorMonitor) monitorLoop() {
+	defer mem.tomb.Done()
+
+	runTicker := time.NewTicker(mem.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	mem.initializeStatus()
+	// Take the first sample, errors are counted from it.
+	mem.check(time.Now())
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := mem.check(now); status != nil {
+				mem.statusChan <- status
+			}
+		case <-mem.tomb.Stopping():
+			glog.Infof("Memory error monitor stopped: %s", mem.configPath)
+			return
+		}
+	}
+}
+
+func (mem *memoryErrorMonitor) initializeStatus() {
+	mem.condition = types.Condition{
+		Type:       mem.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     healthyReason,
+		Message:    healthyMessage,
+	}
+	mem.statusChan <- &types.Status{
+		Source:     mem.config.Source,
+		Conditions: []types.Condition{mem.condition},
+	}
+}
+
+// readAllCounts reads the error counts from EDAC and mcelog, whichever are enabled.
+func (mem *memoryErrorMonitor) readAllCounts() (map[string]errorCounts, error) {
+	counts := make(map[string]errorCounts)
+	if mem.config.EdacEnabled() {
+		edac, err := readEdac(mem.config.EdacPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read EDAC error counts: %v", err)
+		}
+		for dimm, c := range edac {
+			counts[dimm] = c
+		}
+	}
+	if mem.config.McelogPath != "" {
+		mcelog, err := readMcelog(mem.config.McelogPath)
+		if err != nil {
+			return nil, err
+		}
+		for dimm, c := range mcelog {
+			counts[dimm] = c
+		}
+	}
+	return counts, nil
+}
+
+// check samples the error counts, and returns a new status if the condition changes.
+func (mem *memoryErrorMonitor) check(now time.Time) *types.Status {
+	counts, err := mem.readCounts()
+	if err != nil {
+		glog.Errorf("Failed to read memory error counts: %v", err)
+		return nil
+	}
+	mem.recordMetrics(counts)
+
+	mem.samples = append(mem.samples, sample{time: now, counts: counts})
+	// Keep the latest sample at or before the start of the window as the baseline.
+	windowStart := now.Add(-mem.config.RateWindow)
+	for len(mem.samples) > 1 && !mem.samples[1].time.After(windowStart) {
+		mem.samples = mem.samples[1:]
+	}
+	baseline := mem.samples[0].counts
+
+	var problems []string
+	for dimm, current := range counts {
+		last, ok := baseline[dimm]
+		if !ok {
+			continue
+		}
+		var dimmProblems []string
+		if n := increase(last.correctable, current.correctable); *mem.config.CorrectableThreshold > 0 && n >= *mem.config.CorrectableThreshold {
+			dimmProblems = append(dimmProblems, fmt.Sprintf("%d correctable errors", n))
+		}
+		if n := increase(last.uncorrectable, current.uncorrectable); *mem.config.UncorrectableThreshold > 0 && n >= *mem.config.UncorrectableThreshold {
+			dimmProblems = append(dimmProblems, fmt.Sprintf("%d uncorrectable errors", n))
+		}
+		if len(dimmProblems) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s in %v", dimm, strings.Join(dimmProblems, ", "), mem.config.RateWindow))
+		}
+	}
+	sort.Strings(problems)
+
+	status, reason, message := types.False, healthyReason, healthyMessage
+	if len(problems) > 0 {
+		status, reason, message = types.True, errorRateReason, strings.Join(problems, "; ")
+	}
+	if status == mem.condition.Status && message == mem.condition.Message {
+		return nil
+	}
+
+	var events []types.Event
+	if status != mem.condition.Status {
+		mem.condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(mem.condition.Type, status, reason, now))
+	}
+	mem.condition.Status = status
+	mem.condition.Reason = reason
+	mem.condition.Message = message
+
+	if *mem.config.EnableMetricsReporting {
+		mem.updateProblemMetrics(len(events) > 0)
+	}
+	return &types.Status{
+		Source:     mem.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{mem.condition},
+	}
+}
+
+// increase returns the increase of a counter, or 0 if the counter was reset.
+func increase(last, current uint64) uint64 {
+	if current < last {
+		return 0
+	}
+	return current - last
+}
+
+func (mem *memoryErrorMonitor) recordMetrics(counts map[string]errorCounts) {
+	if mem.eccErrors == nil {
+		return
+	}
+	for dimm, c := range counts {
+		for errorType, count := range map[string]uint64{"correctable": c.correctable, "uncorrectable": c.uncorrectable} {
+			err := mem.eccErrors.Record(map[string]string{"dimm": dimm, "type": errorType}, int64(count))
+			if err != nil {
+				glog.Errorf("Failed to record %s errors of DIMM %q: %v", errorType, dimm, err)
+			}
+		}
+	}
+}
+
+func (mem *memoryErrorMonitor) updateProblemMetrics(transitioned bool) {
+	active := mem.condition.Status == types.True
+	if active && transitioned {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(errorRateReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", errorRateReason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(mem.condition.Type, errorRateReason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			mem.condition.Type, errorRateReason, err)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package memoryerrormonitor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	memtypes "k8s.io/node-problem-detector/pkg/memoryerrormonitor/types"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(MemoryErrorMonitorName) },
+		"Memory error monitor failed to register itself as a problem daemon.")
+}
+
+func TestReadEdac(t *testing.T) {
+	edacPath, err := ioutil.TempDir("", "edac")
+	assert.NoError(t, err)
+	defer os.RemoveAll(edacPath)
+
+	writeDimm := func(dir, label, ce, ue string) {
+		dir = filepath.Join(edacPath, dir)
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dimm_label"), []byte(label), 0644))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dimm_ce_count"), []byte(ce), 0644))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dimm_ue_count"), []byte(ue), 0644))
+	}
+	writeDimm("mc0/dimm0", "CPU_SrcID#0_Ha#0_Chan#0_DIMM#0\n", "12\n", "0\n")
+	writeDimm("mc0/dimm1", "\n", "0\n", "1\n")
+	writeDimm("mc1/rank0", "", "3\n", "0\n")
+
+	counts, err := readEdac(edacPath)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]errorCounts{
+		"CPU_SrcID#0_Ha#0_Chan#0_DIMM#0": {correctable: 12},
+		"mc0/dimm1":                      {uncorrectable: 1},
+		"mc1/rank0":                      {correctable: 3},
+	}, counts)
+
+	writeDimm("mc1/rank1", "", "invalid\n", "0\n")
+	_, err = readEdac(edacPath)
+	assert.Error(t, err)
+}
+
+func TestParseMcelog(t *testing.T) {
+	output := `memory controller 0
+SOCKET 0 CHANNEL 0 DIMM 0
+corrected memory errors:
+	120 total
+	3 in 24h
+uncorrected memory errors:
+	0 total
+	0 in 24h
+
+SOCKET 1 CHANNEL 2 DIMM 1
+corrected memory errors:
+	0 total
+	0 in 24h
+uncorrected memory errors:
+	2 total
+	2 in 24h
+`
+	assert.Equal(t, map[string]errorCounts{
+		"socket0/channel0/dimm0": {correctable: 120},
+		"socket1/channel2/dimm1": {uncorrectable: 2},
+	}, parseMcelog(output))
+	assert.Empty(t, parseMcelog(""))
+}
+
+func newTestMonitor(t *testing.T, counts map[string]errorCounts, err error) *memoryErrorMonitor {
+	disabled := false
+	correctable := uint64(10)
+	mem := &memoryErrorMonitor{
+		config: memtypes.MemoryErrorConfig{
+			InvokeIntervalString:   "1m",
+			RateWindowString:       "10m",
+			CorrectableThreshold:   &correctable,
+			EnableMetricsReporting: &disabled,
+		},
+		readCounts: func() (map[string]errorCounts, error) { return counts, err },
+		statusChan: make(chan *types.Status, 1000),
+	}
+	assert.NoError(t, mem.config.ApplyConfiguration())
+	assert.NoError(t, mem.config.Validate())
+	mem.initializeStatus()
+	<-mem.statusChan
+	return mem
+}
+
+func TestCheck(t *testing.T) {
+	start := time.Now()
+	for _, test := range []struct {
+		desc string
+		// samples are the samples taken before the check.
+		samples []sample
+		// violated is the message of the condition before the check, empty if it is healthy.
+		violated string
+		counts   map[string]errorCounts
+		err      error
+		at       time.Duration
+		// expected is the expected message of the condition, empty if no status is expected.
+		expected string
+		events   int
+	}{
+		{
+			desc:   "errors before the first sample are not counted",
+			counts: map[string]errorCounts{"dimm0": {correctable: 100}},
+		},
+		{
+			desc:    "correctable errors below the threshold",
+			samples: []sample{{time: start, counts: map[string]errorCounts{"dimm0": {correctable: 100}}}},
+			counts:  map[string]errorCounts{"dimm0": {correctable: 109}},
+			at:      time.Minute,
+		},
+		{
+			desc:     "correctable errors reach the threshold",
+			samples:  []sample{{time: start, counts: map[string]errorCounts{"dimm0": {correctable: 100}}}},
+			counts:   map[string]errorCounts{"dimm0": {correctable: 110}},
+			at:       2 * time.Minute,
+			expected: "dimm0: 10 correctable errors in 10m0s",
+			events:   1,
+		},
+		{
+			desc:     "a single uncorrectable error reaches the default threshold",
+			samples:  []sample{{time: start, counts: map[string]errorCounts{"dimm0": {}}}},
+			counts:   map[string]errorCounts{"dimm0": {uncorrectable: 1}},
+			at:       time.Minute,
+			expected: "dimm0: 1 uncorrectable errors in 10m0s",
+			events:   1,
+		},
+		{
+			desc:     "both error types of a DIMM are reported together",
+			samples:  []sample{{time: start, counts: map[string]errorCounts{"dimm0": {}}}},
+			counts:   map[string]errorCounts{"dimm0": {correctable: 12, uncorrectable: 2}},
+			at:       time.Minute,
+			expected: "dimm0: 12 correctable errors, 2 uncorrectable errors in 10m0s",
+			events:   1,
+		},
+		{
+			desc: "an error on another DIMM updates the message without an event",
+			samples: []sample{
+				{time: start, counts: map[string]errorCounts{"dimm0": {correctable: 100}, "dimm1": {}}},
+			},
+			violated: "dimm0: 10 correctable errors in 10m0s",
+			counts:   map[string]errorCounts{"dimm0": {correctable: 110}, "dimm1": {uncorrectable: 1}},
+			at:       3 * time.Minute,
+			expected: "dimm0: 10 correctable errors in 10m0s; dimm1: 1 uncorrectable errors in 10m0s",
+		},
+		{
+			desc: "errors older than the window are not counted",
+			samples: []sample{
+				{time: start, counts: map[string]errorCounts{"dimm0": {correctable: 100}}},
+				{time: start.Add(2 * time.Minute), counts: map[string]errorCounts{"dimm0": {correctable: 110}}},
+			},
+			violated: "dimm0: 10 correctable errors in 10m0s",
+			counts:   map[string]errorCounts{"dimm0": {correctable: 110}},
+			at:       14 * time.Minute,
+			expected: healthyMessage,
+			events:   1,
+		},
+		{
+			desc:    "a counter reset is not counted as errors",
+			samples: []sample{{time: start, counts: map[string]errorCounts{"dimm0": {correctable: 100}}}},
+			counts:  map[string]errorCounts{"dimm0": {correctable: 20}},
+			at:      time.Minute,
+		},
+		{
+			desc:    "a DIMM missing from the baseline is not counted",
+			samples: []sample{{time: start, counts: map[string]errorCounts{"dimm0": {}}}},
+			counts:  map[string]errorCounts{"dimm0": {}, "dimm1": {uncorrectable: 5}},
+			at:      time.Minute,
+		},
+		{
+			desc:     "a read error keeps the condition",
+			samples:  []sample{{time: start, counts: map[string]errorCounts{"dimm0": {}}}},
+			violated: "dimm0: 1 uncorrectable errors in 10m0s",
+			err:      errors.New("edac unavailable"),
+			at:       time.Minute,
+		},
+	} {
+		mem := newTestMonitor(t, test.counts, test.err)
+		mem.samples = test.samples
+		if test.violated != "" {
+			mem.condition.Status = types.True
+			mem.condition.Reason = errorRateReason
+			mem.condition.Message = test.violated
+		}
+
+		status := mem.check(start.Add(test.at))
+		if test.expected == "" {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if assert.NotNil(t, status, test.desc) {
+			assert.Len(t, status.Events, test.events, test.desc)
+			assert.Equal(t, test.expected, status.Conditions[0].Message, test.desc)
+			if test.expected == healthyMessage {
+				assert.Equal(t, types.False, status.Conditions[0].Status, test.desc)
+				assert.Equal(t, healthyReason, status.Conditions[0].Reason, test.desc)
+			} else {
+				assert.Equal(t, types.True, status.Conditions[0].Status, test.desc)
+				assert.Equal(t, errorRateReason, status.Conditions[0].Reason, test.desc)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package memoryerrormonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// errorCounts is the cumulative number of memory errors of a DIMM.
+type errorCounts struct {
+	correctable   uint64
+	uncorrectable uint64
+}
+
+// readEdac reads the error counts of each DIMM from the EDAC memory controllers in sysfs,
+// keyed by the DIMM label, or by "<mc>/<dimm>" when the DIMM has no label. Memory
+// controllers exposing ranks instead of DIMMs are supported.
+func readEdac(edacPath string) (map[string]errorCounts, error) {
+	dirs, err := filepath.Glob(filepath.Join(edacPath, "mc[0-9]*", "dimm[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	ranks, err := filepath.Glob(filepath.Join(edacPath, "mc[0-9]*", "rank[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	dirs = append(dirs, ranks...)
+
+	counts := make(map[string]errorCounts)
+	for _, dir := range dirs {
+		var c errorCounts
+		if c.correctable, err = readCount(filepath.Join(dir, "dimm_ce_count")); err != nil {
+			return nil, err
+		}
+		if c.uncorrectable, err = readCount(filepath.Join(dir, "dimm_ue_count")); err != nil {
+			return nil, err
+		}
+		name := filepath.Join(filepath.Base(filepath.Dir(dir)), filepath.Base(dir))
+		if label, err := ioutil.ReadFile(filepath.Join(dir, "dimm_label")); err == nil && strings.TrimSpace(string(label)) != "" {
+			name = strings.TrimSpace(string(label))
+		}
+		counts[name] = c
+	}
+	return counts, nil
+}
+
+func readCount(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q: %v", path, err)
+	}
+	return count, nil
+}
+
+// readMcelog reads the error counts of each DIMM from the mcelog daemon.
+func readMcelog(mcelogPath string) (map[string]errorCounts, error) {
+	output, err := exec.Command(mcelogPath, "--client").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s --client: %v", mcelogPath, err)
+	}
+	return parseMcelog(string(output)), nil
+}
+
+var (
+	mcelogDimmRegexp  = regexp.MustCompile(`^SOCKET (\d+) CHANNEL (\d+) DIMM (\d+)`)
+	mcelogTotalRegexp = regexp.MustCompile(`^(\d+) total`)
+)
+
+// parseMcelog parses the memory error database printed by "mcelog --client", keyed by
+// "socket<s>/channel<c>/dimm<d>":
+//
+//	SOCKET 0 CHANNEL 1 DIMM 0
+//	corrected memory errors:
+//		3 total
+//		0 in 24h
+//	uncorrected memory errors:
+//		0 total
+//		0 in 24h
+func parseMcelog(output string) map[string]errorCounts {
+	counts := make(map[string]errorCounts)
+	var dimm string
+	var count *uint64
+	var c errorCounts
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := mcelogDimmRegexp.FindStringSubmatch(line); match != nil {
+			if dimm != "" {
+				counts[dimm] = c
+			}
+			dimm = fmt.Sprintf("socket%s/channel%s/dimm%s", match[1], match[2], match[3])
+			c, count = errorCounts{}, nil
+			continue
+		}
+		if dimm == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "corrected memory errors"):
+			count = &c.correctable
+		case strings.HasPrefix(line, "uncorrected memory errors"):
+			count = &c.uncorrectable
+		default:
+			if match := mcelogTotalRegexp.FindStringSubmatch(line); match != nil && count != nil {
+				*count, _ = strconv.ParseUint(match[1], 10, 64)
+				count = nil
+			}
+		}
+	}
+	if dimm != "" {
+		counts[dimm] = c
+	}
+	return counts
+}
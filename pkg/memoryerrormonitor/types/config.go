@@ -0,0 +1,123 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	defaultSource                 = "memory-error-monitor"
+	defaultInvokeIntervalString   = (60 * time.Second).String()
+	defaultRateWindowString       = (1 * time.Hour).String()
+	defaultEdacPath               = "/sys/devices/system/edac/mc"
+	defaultCorrectableThreshold   = uint64(100)
+	defaultUncorrectableThreshold = uint64(1)
+	defaultEnableMetrics          = true
+	defaultConditionType          = "MemoryHardwareProblem"
+)
+
+type MemoryErrorConfig struct {
+	// Source is the source name of the memory error monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which the error counts are read.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// RateWindowString is the window over which the errors of each DIMM are counted
+	// against the thresholds.
+	RateWindowString string        `json:"rateWindow"`
+	RateWindow       time.Duration `json:"-"`
+	// EdacPath is the EDAC memory controller directory in sysfs. Set to "-" to disable
+	// reading EDAC.
+	EdacPath string `json:"edacPath"`
+	// McelogPath is the path of the mcelog binary. When set, the errors per DIMM are also
+	// read from "mcelog --client", which needs the mcelog daemon running.
+	McelogPath string `json:"mcelogPath"`
+	// CorrectableThreshold is the number of correctable errors of a DIMM in the rate
+	// window setting the condition. 0 disables the threshold.
+	CorrectableThreshold *uint64 `json:"correctableThreshold,omitempty"`
+	// UncorrectableThreshold is the number of uncorrectable errors of a DIMM in the rate
+	// window setting the condition. 0 disables the threshold.
+	UncorrectableThreshold *uint64 `json:"uncorrectableThreshold,omitempty"`
+	// ConditionType is the type of the condition. Default to "MemoryHardwareProblem".
+	ConditionType string `json:"conditionType"`
+	// EnableMetricsReporting describes whether to report problems and error counts as
+	// metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (mec *MemoryErrorConfig) ApplyConfiguration() error {
+	if mec.Source == "" {
+		mec.Source = defaultSource
+	}
+	if mec.InvokeIntervalString == "" {
+		mec.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if mec.RateWindowString == "" {
+		mec.RateWindowString = defaultRateWindowString
+	}
+	if mec.EdacPath == "" {
+		mec.EdacPath = defaultEdacPath
+	}
+	if mec.CorrectableThreshold == nil {
+		mec.CorrectableThreshold = &defaultCorrectableThreshold
+	}
+	if mec.UncorrectableThreshold == nil {
+		mec.UncorrectableThreshold = &defaultUncorrectableThreshold
+	}
+	if mec.ConditionType == "" {
+		mec.ConditionType = defaultConditionType
+	}
+	if mec.EnableMetricsReporting == nil {
+		mec.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	mec.InvokeInterval, err = time.ParseDuration(mec.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", mec.InvokeIntervalString, err)
+	}
+	mec.RateWindow, err = time.ParseDuration(mec.RateWindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing RateWindowString %q: %v", mec.RateWindowString, err)
+	}
+	return nil
+}
+
+// EdacEnabled returns whether EDAC error counts are read.
+func (mec *MemoryErrorConfig) EdacEnabled() bool {
+	return mec.EdacPath != "-"
+}
+
+// Validate verifies whether the settings are valid.
+func (mec *MemoryErrorConfig) Validate() error {
+	if mec.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", mec.InvokeInterval)
+	}
+	if mec.RateWindow < mec.InvokeInterval {
+		return fmt.Errorf("RateWindow %v must not be less than InvokeInterval %v", mec.RateWindow, mec.InvokeInterval)
+	}
+	if !mec.EdacEnabled() && mec.McelogPath == "" {
+		return fmt.Errorf("neither EDAC nor mcelog is enabled")
+	}
+	if *mec.CorrectableThreshold == 0 && *mec.UncorrectableThreshold == 0 {
+		return fmt.Errorf("at least one of CorrectableThreshold and UncorrectableThreshold must be above 0")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	zero := uint64(0)
+	testCases := []struct {
+		name      string
+		config    MemoryErrorConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: MemoryErrorConfig{},
+		},
+		{
+			name:   "mcelog only",
+			config: MemoryErrorConfig{EdacPath: "-", McelogPath: "/usr/sbin/mcelog"},
+		},
+		{
+			name:      "no source",
+			config:    MemoryErrorConfig{EdacPath: "-"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid invoke interval",
+			config:    MemoryErrorConfig{InvokeIntervalString: "1 minute"},
+			expectErr: true,
+		},
+		{
+			name:      "rate window shorter than invoke interval",
+			config:    MemoryErrorConfig{InvokeIntervalString: "10m", RateWindowString: "5m"},
+			expectErr: true,
+		},
+		{
+			name:      "all thresholds disabled",
+			config:    MemoryErrorConfig{CorrectableThreshold: &zero, UncorrectableThreshold: &zero},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
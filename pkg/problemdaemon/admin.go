@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemdaemon
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/serving"
+)
+
+// MonitorState is the state of a problem daemon reported by the admin API.
+type MonitorState struct {
+	// Config is the config path identifying the problem daemon.
+	Config string `json:"config"`
+	// Controllable is whether the problem daemon supports the runtime operations.
+	Controllable bool `json:"controllable"`
+	// Paused is whether the problem daemon is paused.
+	Paused bool `json:"paused"`
+}
+
+// Lister lists problem daemons which are created and stopped at runtime, e.g. from the
+// configurations in ConfigMaps.
+type Lister interface {
+	// ProblemDaemons returns the running problem daemons by config path.
+	ProblemDaemons() map[string]types.Monitor
+}
+
+// adminHandler serves the admin API operating the problem daemons at runtime.
+type adminHandler struct {
+	problemDaemons map[string]types.Monitor
+	listers        []Lister
+}
+
+// NewAdminHandler returns the handler of the admin API, which operates the problem
+// daemons, and those of the listers at the time of the request, keyed by their config
+// path:
+//
+//	GET  /monitors                        lists the problem daemons.
+//	POST /monitors/pause?config=<path>    pauses the periodic checks.
+//	POST /monitors/resume?config=<path>   resumes the periodic checks.
+//	POST /monitors/trigger?config=<path>  runs the checks immediately.
+//	POST /monitors/reload?config=<path>   re-reads the configuration.
+func NewAdminHandler(problemDaemons map[string]types.Monitor, listers ...Lister) http.Handler {
+	h := &adminHandler{problemDaemons: problemDaemons, listers: listers}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/monitors", h.list)
+	mux.HandleFunc("/monitors/pause", h.operation(func(m types.ControllableMonitor) error {
+		m.Pause()
+		return nil
+	}))
+	mux.HandleFunc("/monitors/resume", h.operation(func(m types.ControllableMonitor) error {
+		m.Resume()
+		return nil
+	}))
+	mux.HandleFunc("/monitors/trigger", h.operation(func(m types.ControllableMonitor) error {
+		m.Trigger()
+		return nil
+	}))
+	mux.HandleFunc("/monitors/reload", h.operation(func(m types.ControllableMonitor) error {
+		return m.Reload()
+	}))
+	return mux
+}
+
+// StartAdminServerOrDie serves the admin API at the address in the background with the
+// TLS and authentication configuration, panic if the server fails.
+func StartAdminServerOrDie(address string, config serving.Config, problemDaemons map[string]types.Monitor, listers ...Lister) {
+	handler := NewAdminHandler(problemDaemons, listers...)
+	go func() {
+		err := serving.ListenAndServe(address, handler, config)
+		if err != nil {
+			glog.Fatalf("Failed to start admin server: %v", err)
+		}
+	}()
+}
+
+// all returns all the problem daemons by config path.
+func (h *adminHandler) all() map[string]types.Monitor {
+	all := make(map[string]types.Monitor, len(h.problemDaemons))
+	for config, m := range h.problemDaemons {
+		all[config] = m
+	}
+	for _, lister := range h.listers {
+		for config, m := range lister.ProblemDaemons() {
+			all[config] = m
+		}
+	}
+	return all
+}
+
+func state(config string, problemDaemon types.Monitor) MonitorState {
+	state := MonitorState{Config: config}
+	if m, ok := unwrap(problemDaemon).(types.ControllableMonitor); ok {
+		state.Controllable = true
+		state.Paused = m.Paused()
+	}
+	return state
+}
+
+func (h *adminHandler) list(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	states := []MonitorState{}
+	for config, problemDaemon := range h.all() {
+		states = append(states, state(config, problemDaemon))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Config < states[j].Config })
+	util.ReturnHTTPJson(w, states)
+}
+
+func (h *adminHandler) operation(do func(types.ControllableMonitor) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		config := r.URL.Query().Get("config")
+		problemDaemon, ok := h.all()[config]
+		if !ok {
+			http.Error(w, fmt.Sprintf("problem daemon %q not found", config), http.StatusNotFound)
+			return
+		}
+		m, ok := unwrap(problemDaemon).(types.ControllableMonitor)
+		if !ok {
+			http.Error(w, fmt.Sprintf("problem daemon %q does not support runtime operations", config), http.StatusNotImplemented)
+			return
+		}
+		glog.Infof("Admin API %s on problem daemon %q", r.URL.Path, config)
+		if err := do(m); err != nil {
+			util.ReturnHTTPError(w, err)
+			return
+		}
+		util.ReturnHTTPJson(w, state(config, problemDaemon))
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemdaemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+type fakeMonitor struct{}
+
+func (f *fakeMonitor) Start() (<-chan *types.Status, error) { return nil, nil }
+func (f *fakeMonitor) Stop()                                {}
+
+type fakeControllableMonitor struct {
+	fakeMonitor
+	paused    bool
+	triggered int
+	reloadErr error
+}
+
+func (f *fakeControllableMonitor) Pause()        { f.paused = true }
+func (f *fakeControllableMonitor) Resume()       { f.paused = false }
+func (f *fakeControllableMonitor) Paused() bool  { return f.paused }
+func (f *fakeControllableMonitor) Trigger()      { f.triggered++ }
+func (f *fakeControllableMonitor) Reload() error { return f.reloadErr }
+
+type fakeLister map[string]types.Monitor
+
+func (f fakeLister) ProblemDaemons() map[string]types.Monitor { return f }
+
+func TestAdminHandler(t *testing.T) {
+	plugin := &fakeControllableMonitor{}
+	broken := &fakeControllableMonitor{reloadErr: errors.New("invalid config")}
+	fromConfigMap := &fakeControllableMonitor{}
+	handler := NewAdminHandler(map[string]types.Monitor{
+		"/config/custom-plugin.json": plugin,
+		"/config/broken.json":        broken,
+		"/config/kernel.json":        &fakeMonitor{},
+	}, fakeLister{"/var/lib/npd/rules_plugin.json": fromConfigMap})
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := do(http.MethodPost, "/monitors/pause?config=/config/custom-plugin.json")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, plugin.paused)
+
+	w = do(http.MethodGet, "/monitors")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var states []MonitorState
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &states))
+	assert.Equal(t, []MonitorState{
+		{Config: "/config/broken.json", Controllable: true},
+		{Config: "/config/custom-plugin.json", Controllable: true, Paused: true},
+		{Config: "/config/kernel.json"},
+		{Config: "/var/lib/npd/rules_plugin.json", Controllable: true},
+	}, states)
+
+	testCases := []struct {
+		name   string
+		method string
+		target string
+		code   int
+	}{
+		{name: "resume", method: http.MethodPost, target: "/monitors/resume?config=/config/custom-plugin.json", code: http.StatusOK},
+		{name: "trigger", method: http.MethodPost, target: "/monitors/trigger?config=/config/custom-plugin.json", code: http.StatusOK},
+		{name: "reload", method: http.MethodPost, target: "/monitors/reload?config=/config/custom-plugin.json", code: http.StatusOK},
+		{name: "reload error", method: http.MethodPost, target: "/monitors/reload?config=/config/broken.json", code: http.StatusInternalServerError},
+		{name: "not controllable", method: http.MethodPost, target: "/monitors/trigger?config=/config/kernel.json", code: http.StatusNotImplemented},
+		{name: "unknown config", method: http.MethodPost, target: "/monitors/trigger?config=/config/unknown.json", code: http.StatusNotFound},
+		{name: "wrong method", method: http.MethodGet, target: "/monitors/trigger?config=/config/custom-plugin.json", code: http.StatusMethodNotAllowed},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.code, do(test.method, test.target).Code)
+		})
+	}
+	assert.False(t, plugin.paused)
+	assert.Equal(t, 1, plugin.triggered)
+
+	// The problem daemons of the listers are operated too.
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/monitors/trigger?config=/var/lib/npd/rules_plugin.json").Code)
+	assert.Equal(t, 1, fromConfigMap.triggered)
+}
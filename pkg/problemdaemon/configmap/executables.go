@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configmap
+
+import (
+	"encoding/json"
+	"fmt"
+
+	cpmtypes "k8s.io/node-problem-detector/pkg/custompluginmonitor/types"
+	memtypes "k8s.io/node-problem-detector/pkg/memoryerrormonitor/types"
+	scrubtypes "k8s.io/node-problem-detector/pkg/scrubmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// executables returns the paths of the commands run by the problem daemon of the
+// configuration, e.g. the plugins of a custom plugin monitor.
+func executables(daemonType types.ProblemDaemonType, data []byte) ([]string, error) {
+	var paths []string
+	switch daemonType {
+	case "custom-plugin-monitor":
+		var c cpmtypes.CustomPluginConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, err
+		}
+		for _, rule := range c.Rules {
+			paths = append(paths, rule.Path)
+			if v := rule.Verification; v != nil && v.Path != "" {
+				paths = append(paths, v.Path)
+			}
+		}
+	case "scrub-monitor":
+		var c scrubtypes.ScrubConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, err
+		}
+		for _, scrub := range c.Scrubs {
+			paths = append(paths, scrub.Path)
+		}
+	case "memory-error-monitor":
+		var c memtypes.MemoryErrorConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, err
+		}
+		if c.McelogPath != "" {
+			paths = append(paths, c.McelogPath)
+		}
+	}
+	return paths, nil
+}
+
+// checkEnv verifies that the custom plugins of the configuration are not passed
+// environment variables. They could make an allowed command run other code, e.g. with
+// LD_PRELOAD or PATH, or pass the content of any file on the host to it with secretEnv.
+// The rules directory is rejected too: every executable in it would be run, with the
+// environment variables of its rule metadata, without being checked.
+func checkEnv(daemonType types.ProblemDaemonType, data []byte) error {
+	if daemonType != "custom-plugin-monitor" {
+		return nil
+	}
+	var c cpmtypes.CustomPluginConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
+	}
+	if c.RulesDir != "" {
+		return fmt.Errorf("rulesDir %q is not allowed in ConfigMaps", c.RulesDir)
+	}
+	for _, rule := range c.Rules {
+		if len(rule.Env) > 0 || len(rule.SecretEnv) > 0 {
+			return fmt.Errorf("env and secretEnv of rule %q are not allowed in ConfigMaps", rule.Reason)
+		}
+	}
+	return nil
+}
+
+// checkExecutables verifies that the commands run by the problem daemon of the
+// configuration are allowed, and that they are run without environment variables from
+// the configuration. Anyone who can write the ConfigMaps could otherwise run any command
+// as root on the nodes.
+func (s *Source) checkExecutables(daemonType types.ProblemDaemonType, data []byte) error {
+	if err := checkEnv(daemonType, data); err != nil {
+		return err
+	}
+	paths, err := executables(daemonType, data)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if !s.allowedExecutables[path] {
+			return fmt.Errorf("command %q is not allowed, add it to --config-map-allowed-executables on the nodes", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configmap runs the problem daemons configured in labeled ConfigMaps, so that
+// their configurations can be managed centrally without mounting them on the nodes.
+package configmap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	clientset "k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"k8s.io/node-problem-detector/pkg/configvalidation"
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const (
+	// TypeAnnotation is the annotation of a ConfigMap setting the problem daemon type of
+	// its configurations, e.g. "system-log-monitor". Without it, the type is detected
+	// from each configuration like the validate subcommand does.
+	TypeAnnotation = "node-problem-detector.k8s.io/problem-daemon-type"
+	// relistDelay is the delay before the ConfigMaps are listed again after listing or
+	// watching them failed.
+	relistDelay = 10 * time.Second
+)
+
+// Client lists and watches the ConfigMaps carrying problem daemon configurations.
+type Client interface {
+	// List lists the ConfigMaps.
+	List() (*v1.ConfigMapList, error)
+	// Watch watches the changes of the ConfigMaps after the resource version.
+	Watch(resourceVersion string) (watch.Interface, error)
+}
+
+type configMapClient struct {
+	client   typedcorev1.ConfigMapInterface
+	selector string
+}
+
+// NewClient returns the client of the ConfigMaps in the namespace matching the label
+// selector.
+func NewClient(cs clientset.Interface, namespace, selector string) Client {
+	return &configMapClient{client: cs.CoreV1().ConfigMaps(namespace), selector: selector}
+}
+
+func (c *configMapClient) List() (*v1.ConfigMapList, error) {
+	return c.client.List(metav1.ListOptions{LabelSelector: c.selector})
+}
+
+func (c *configMapClient) Watch(resourceVersion string) (watch.Interface, error) {
+	return c.client.Watch(metav1.ListOptions{LabelSelector: c.selector, ResourceVersion: resourceVersion})
+}
+
+// daemon is a problem daemon created from a configuration in a ConfigMap.
+type daemon struct {
+	configMap string
+	data      string
+	path      string
+	monitor   types.Monitor
+	// stop stops forwarding the statuses of the problem daemon.
+	stop chan struct{}
+}
+
+// Source runs the problem daemons configured in ConfigMaps. Each key of the ConfigMaps is
+// the configuration of a problem daemon, which is written to a local file the problem
+// daemon is created from. The problem daemons are re-created when their configurations
+// change, and stopped when they are removed. A configuration which is invalid, or runs
+// commands which are not allowed, is skipped, and the problem daemon created from its
+// previous version keeps running.
+type Source struct {
+	client Client
+	// dir is the directory the configurations are written to.
+	dir string
+	// allowedExecutables are the paths of the commands the configurations may run, e.g.
+	// the plugins of custom plugin monitors.
+	allowedExecutables map[string]bool
+	create             func(daemonType types.ProblemDaemonType, configPath string) types.Monitor
+	validate           func(daemonType types.ProblemDaemonType, data []byte) error
+	// daemons are the problem daemons by "<ConfigMap>/<key>". They are only changed in
+	// the goroutine watching the ConfigMaps, and read by ProblemDaemons under the mutex.
+	daemons      map[string]*daemon
+	daemonsMutex sync.Mutex
+	statuses     chan *types.Status
+	tomb         *tomb.Tomb
+}
+
+// NewSourceOrDie creates the source of the problem daemons configured in the ConfigMaps
+// of the client, whose configurations are written to the directory and may only run the
+// allowed executables, panic if error occurs.
+func NewSourceOrDie(client Client, dir string, allowedExecutables []string) *Source {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		glog.Fatalf("Failed to create ConfigMap configuration directory %q: %v", dir, err)
+	}
+	allowed := make(map[string]bool)
+	for _, path := range allowedExecutables {
+		allowed[path] = true
+	}
+	return &Source{
+		client:             client,
+		dir:                dir,
+		allowedExecutables: allowed,
+		create: func(daemonType types.ProblemDaemonType, configPath string) types.Monitor {
+			return problemdaemon.Supervise(configPath, problemdaemon.GetProblemDaemonHandlerOrDie(daemonType).CreateProblemDaemonOrDie)
+		},
+		validate: func(daemonType types.ProblemDaemonType, data []byte) error {
+			return configvalidation.Validate(string(daemonType), data, true)
+		},
+		daemons: make(map[string]*daemon),
+		// A 1000 size channel should be big enough.
+		statuses: make(chan *types.Status, 1000),
+		tomb:     tomb.NewTomb(),
+	}
+}
+
+// Start starts watching the ConfigMaps. The statuses of all problem daemons are reported
+// on the returned channel.
+func (s *Source) Start() (<-chan *types.Status, error) {
+	glog.Info("Start watching problem daemon ConfigMaps")
+	go s.watchLoop()
+	return s.statuses, nil
+}
+
+// Stop stops watching the ConfigMaps and all problem daemons.
+func (s *Source) Stop() {
+	s.tomb.Stop()
+}
+
+func (s *Source) watchLoop() {
+	defer func() {
+		for id := range s.daemons {
+			s.remove(id)
+		}
+		s.tomb.Done()
+	}()
+	for s.listAndWatch() {
+		select {
+		case <-s.tomb.Stopping():
+			return
+		case <-time.After(relistDelay):
+		}
+	}
+}
+
+// listAndWatch syncs the problem daemons with the ConfigMaps, and keeps them in sync
+// until the watch ends. It returns false when the source is stopping.
+func (s *Source) listAndWatch() bool {
+	list, err := s.client.List()
+	if err != nil {
+		glog.Errorf("Failed to list problem daemon ConfigMaps: %v", err)
+		return true
+	}
+	listed := make(map[string]bool)
+	for i := range list.Items {
+		configMap := &list.Items[i]
+		listed[configMap.Name] = true
+		s.update(configMap)
+	}
+	for id, d := range s.daemons {
+		if !listed[d.configMap] {
+			s.remove(id)
+		}
+	}
+
+	w, err := s.client.Watch(list.ResourceVersion)
+	if err != nil {
+		glog.Errorf("Failed to watch problem daemon ConfigMaps: %v", err)
+		return true
+	}
+	defer w.Stop()
+	for {
+		select {
+		case <-s.tomb.Stopping():
+			return false
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return true
+			}
+			configMap, ok := event.Object.(*v1.ConfigMap)
+			if !ok {
+				glog.Errorf("Unexpected problem daemon ConfigMap watch event %v: %+v", event.Type, event.Object)
+				return true
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				s.update(configMap)
+			case watch.Deleted:
+				for id, d := range s.daemons {
+					if d.configMap == configMap.Name {
+						s.remove(id)
+					}
+				}
+			}
+		}
+	}
+}
+
+// update syncs the problem daemons with the configurations in the ConfigMap.
+func (s *Source) update(configMap *v1.ConfigMap) {
+	var keys []string
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.apply(configMap, key)
+	}
+	for id, d := range s.daemons {
+		if _, ok := configMap.Data[filepath.Base(id)]; d.configMap == configMap.Name && !ok {
+			s.remove(id)
+		}
+	}
+}
+
+// apply (re-)creates the problem daemon of a configuration in the ConfigMap, unless the
+// configuration did not change or is invalid.
+func (s *Source) apply(configMap *v1.ConfigMap, key string) {
+	id := configMap.Name + "/" + key
+	data := configMap.Data[key]
+	if d, ok := s.daemons[id]; ok && d.data == data {
+		return
+	}
+	daemonType := types.ProblemDaemonType(configMap.Annotations[TypeAnnotation])
+	if daemonType == "" {
+		daemonType = types.ProblemDaemonType(configvalidation.Detect(key, []byte(data)))
+	}
+	if !isRegistered(daemonType) {
+		glog.Errorf("Skipping configuration %q of unknown problem daemon type %q, set it with the %s annotation",
+			id, daemonType, TypeAnnotation)
+		return
+	}
+	if err := s.validate(daemonType, []byte(data)); err != nil {
+		glog.Errorf("Skipping invalid configuration %q of %s: %v", id, daemonType, err)
+		return
+	}
+	if err := s.checkExecutables(daemonType, []byte(data)); err != nil {
+		glog.Errorf("Skipping configuration %q of %s: %v", id, daemonType, err)
+		return
+	}
+	// ConfigMap names can not contain '_', so that the file names are unique.
+	path := filepath.Join(s.dir, configMap.Name+"_"+key)
+	if err := writeFile(path, data); err != nil {
+		glog.Errorf("Failed to write configuration %q: %v", id, err)
+		return
+	}
+	if _, ok := s.daemons[id]; ok {
+		glog.Infof("Re-creating %s from the changed configuration %q", daemonType, id)
+		s.stop(id)
+	} else {
+		glog.Infof("Creating %s from configuration %q", daemonType, id)
+	}
+
+	d := &daemon{
+		configMap: configMap.Name,
+		data:      data,
+		path:      path,
+		monitor:   s.create(daemonType, path),
+		stop:      make(chan struct{}),
+	}
+	s.daemonsMutex.Lock()
+	s.daemons[id] = d
+	s.daemonsMutex.Unlock()
+	ch, err := d.monitor.Start()
+	if err != nil {
+		glog.Errorf("Failed to start %s of configuration %q: %v", daemonType, id, err)
+		return
+	}
+	if ch != nil {
+		go s.forward(ch, d.stop)
+	}
+}
+
+// stop stops the problem daemon.
+func (s *Source) stop(id string) {
+	d := s.daemons[id]
+	close(d.stop)
+	d.monitor.Stop()
+	s.daemonsMutex.Lock()
+	delete(s.daemons, id)
+	s.daemonsMutex.Unlock()
+}
+
+// ProblemDaemons returns the running problem daemons by the path of their configuration
+// file, so that they can be operated with the admin API.
+func (s *Source) ProblemDaemons() map[string]types.Monitor {
+	s.daemonsMutex.Lock()
+	defer s.daemonsMutex.Unlock()
+	problemDaemons := make(map[string]types.Monitor, len(s.daemons))
+	for _, d := range s.daemons {
+		problemDaemons[d.path] = d.monitor
+	}
+	return problemDaemons
+}
+
+// remove stops the problem daemon of a configuration which was removed, and removes its
+// configuration file.
+func (s *Source) remove(id string) {
+	glog.Infof("Stopping the problem daemon of the removed configuration %q", id)
+	path := s.daemons[id].path
+	s.stop(id)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		glog.Errorf("Failed to remove configuration file %q: %v", path, err)
+	}
+}
+
+// forward forwards the statuses of a problem daemon until it is stopped.
+func (s *Source) forward(ch <-chan *types.Status, stop <-chan struct{}) {
+	for {
+		select {
+		case status, ok := <-ch:
+			if !ok {
+				return
+			}
+			select {
+			case s.statuses <- status:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func isRegistered(daemonType types.ProblemDaemonType) bool {
+	for _, name := range problemdaemon.GetProblemDaemonNames() {
+		if name == daemonType {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFile writes the file atomically, so that a problem daemon never reads a partial
+// configuration.
+func writeFile(path, data string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to rename %q to %q: %v", tmp.Name(), path, err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configmap
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const (
+	fakeDaemonType   = "fake-monitor"
+	pluginDaemonType = "custom-plugin-monitor"
+)
+
+func init() {
+	problemdaemon.Register(fakeDaemonType, types.ProblemDaemonHandler{})
+	problemdaemon.Register(pluginDaemonType, types.ProblemDaemonHandler{})
+}
+
+type fakeClient struct {
+	list    *v1.ConfigMapList
+	watcher *watch.FakeWatcher
+}
+
+func (c *fakeClient) List() (*v1.ConfigMapList, error) {
+	return c.list, nil
+}
+
+func (c *fakeClient) Watch(resourceVersion string) (watch.Interface, error) {
+	return c.watcher, nil
+}
+
+type fakeMonitor struct {
+	lock     *sync.Mutex
+	config   string
+	statuses chan *types.Status
+	stopped  bool
+}
+
+func (m *fakeMonitor) Start() (<-chan *types.Status, error) {
+	return m.statuses, nil
+}
+
+func (m *fakeMonitor) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.stopped = true
+}
+
+// fakeMonitors records the monitors created by the source.
+type fakeMonitors struct {
+	sync.Mutex
+	monitors []*fakeMonitor
+}
+
+func (f *fakeMonitors) create(daemonType types.ProblemDaemonType, configPath string) types.Monitor {
+	f.Lock()
+	defer f.Unlock()
+	config, _ := ioutil.ReadFile(configPath)
+	m := &fakeMonitor{lock: &f.Mutex, config: string(config), statuses: make(chan *types.Status)}
+	f.monitors = append(f.monitors, m)
+	return m
+}
+
+// running returns the configurations of the monitors which are not stopped.
+func (f *fakeMonitors) running() []string {
+	f.Lock()
+	defer f.Unlock()
+	var configs []string
+	for _, m := range f.monitors {
+		if !m.stopped {
+			configs = append(configs, m.config)
+		}
+	}
+	return configs
+}
+
+func newConfigMap(name string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{TypeAnnotation: fakeDaemonType},
+		},
+		Data: data,
+	}
+}
+
+func newTestSource(t *testing.T, client Client, monitors *fakeMonitors) (*Source, string) {
+	dir, err := ioutil.TempDir("", "configmap")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	return &Source{
+		client: client,
+		dir:    dir,
+		create: monitors.create,
+		validate: func(daemonType types.ProblemDaemonType, data []byte) error {
+			if string(data) == "invalid" {
+				return errors.New("invalid configuration")
+			}
+			return nil
+		},
+		daemons:  make(map[string]*daemon),
+		statuses: make(chan *types.Status, 1000),
+		tomb:     tomb.NewTomb(),
+	}, dir
+}
+
+func TestSource(t *testing.T) {
+	client := &fakeClient{
+		list: &v1.ConfigMapList{Items: []v1.ConfigMap{
+			*newConfigMap("rules", map[string]string{"a.json": "a1", "b.json": "b1"}),
+		}},
+		watcher: watch.NewFake(),
+	}
+	monitors := &fakeMonitors{}
+	s, dir := newTestSource(t, client, monitors)
+	defer os.RemoveAll(dir)
+	statuses, err := s.Start()
+	assert.NoError(t, err)
+
+	eventually := func(expected ...string) {
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual(expected, monitors.running())
+		}, time.Second, 10*time.Millisecond, "expected running monitors %v, got %v", expected, monitors.running())
+	}
+	eventually("a1", "b1")
+	config, err := ioutil.ReadFile(filepath.Join(dir, "rules_a.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", string(config))
+	// The monitors are listed by the path of their configuration file for the admin API.
+	var paths []string
+	for path := range s.ProblemDaemons() {
+		paths = append(paths, path)
+	}
+	assert.ElementsMatch(t, []string{filepath.Join(dir, "rules_a.json"), filepath.Join(dir, "rules_b.json")}, paths)
+
+	// The statuses of the monitors are forwarded.
+	monitors.Lock()
+	ch := monitors.monitors[0].statuses
+	monitors.Unlock()
+	status := &types.Status{Source: "a"}
+	ch <- status
+	assert.Equal(t, status, <-statuses)
+
+	// A changed configuration re-creates its monitor, an unchanged one is kept.
+	client.watcher.Modify(newConfigMap("rules", map[string]string{"a.json": "a2", "b.json": "b1"}))
+	eventually("b1", "a2")
+
+	// An invalid configuration keeps the running monitor.
+	client.watcher.Modify(newConfigMap("rules", map[string]string{"a.json": "invalid", "b.json": "b1"}))
+	client.watcher.Add(newConfigMap("more-rules", map[string]string{"c.json": "c1"}))
+	eventually("b1", "a2", "c1")
+
+	// A removed key stops its monitor and removes its configuration file.
+	client.watcher.Modify(newConfigMap("rules", map[string]string{"a.json": "a2"}))
+	eventually("a2", "c1")
+	_, err = os.Stat(filepath.Join(dir, "rules_b.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	// A deleted ConfigMap stops all its monitors.
+	client.watcher.Delete(newConfigMap("rules", nil))
+	eventually("c1")
+
+	s.Stop()
+	eventually()
+}
+
+func TestSourceSkipsUnknownType(t *testing.T) {
+	configMap := newConfigMap("rules", map[string]string{"a.json": "a1"})
+	configMap.Annotations[TypeAnnotation] = "unknown-monitor"
+	client := &fakeClient{
+		list:    &v1.ConfigMapList{Items: []v1.ConfigMap{*configMap}},
+		watcher: watch.NewFake(),
+	}
+	monitors := &fakeMonitors{}
+	s, dir := newTestSource(t, client, monitors)
+	defer os.RemoveAll(dir)
+	s.Start()
+	// The watch starts after the listed ConfigMaps are synced.
+	client.watcher.Add(newConfigMap("more-rules", map[string]string{"c.json": "c1"}))
+	assert.Eventually(t, func() bool { return len(monitors.running()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"c1"}, monitors.running())
+	s.Stop()
+}
+
+func TestSourceChecksExecutables(t *testing.T) {
+	plugin := func(path string) string {
+		return `{"plugin": "custom", "source": "custom-monitor", "rules": [{"type": "temporary", "reason": "Test", "path": "` + path + `"}]}`
+	}
+	withEnv := func(env string) string {
+		return `{"plugin": "custom", "source": "custom-monitor", "rules": [{"type": "temporary", "reason": "Test", "path": "/home/kubernetes/bin/log-counter", ` + env + `}]}`
+	}
+	configMap := newConfigMap("rules", map[string]string{
+		"allowed.json":    plugin("/home/kubernetes/bin/log-counter"),
+		"shell.json":      plugin("/bin/sh"),
+		"preload.json":    withEnv(`"env": {"LD_PRELOAD": "/tmp/hook.so"}`),
+		"credential.json": withEnv(`"secretEnv": {"TOKEN": "/var/lib/kubelet/kubeconfig"}, "args": ["$(TOKEN)"]`),
+		"rulesdir.json":   `{"plugin": "custom", "source": "custom-monitor", "rulesDir": "/tmp/plugins"}`,
+	})
+	configMap.Annotations[TypeAnnotation] = pluginDaemonType
+	client := &fakeClient{
+		list:    &v1.ConfigMapList{Items: []v1.ConfigMap{*configMap}},
+		watcher: watch.NewFake(),
+	}
+	monitors := &fakeMonitors{}
+	s, dir := newTestSource(t, client, monitors)
+	defer os.RemoveAll(dir)
+	s.allowedExecutables = map[string]bool{"/home/kubernetes/bin/log-counter": true}
+	s.update(configMap)
+	// Only the configuration running allowed commands without environment variables
+	// creates a monitor, the plugins of a rules directory are not allowed.
+	assert.Equal(t, []string{plugin("/home/kubernetes/bin/log-counter")}, monitors.running())
+}
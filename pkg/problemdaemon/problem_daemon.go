@@ -53,6 +53,16 @@ func GetProblemDaemonHandlerOrDie(problemDaemonType types.ProblemDaemonType) typ
 
 // NewProblemDaemons creates all problem daemons based on the configurations provided.
 func NewProblemDaemons(monitorConfigPaths types.ProblemDaemonConfigPathMap) []types.Monitor {
+	problemDaemons := []types.Monitor{}
+	for _, problemDaemon := range NewProblemDaemonsByConfig(monitorConfigPaths) {
+		problemDaemons = append(problemDaemons, problemDaemon)
+	}
+	return problemDaemons
+}
+
+// NewProblemDaemonsByConfig creates all problem daemons based on the configurations provided,
+// keyed by their config path. The problem daemons are supervised, and restarted when they crash.
+func NewProblemDaemonsByConfig(monitorConfigPaths types.ProblemDaemonConfigPathMap) map[string]types.Monitor {
 	problemDaemonMap := make(map[string]types.Monitor)
 	for problemDaemonType, configs := range monitorConfigPaths {
 		for _, config := range *configs {
@@ -61,13 +71,8 @@ func NewProblemDaemons(monitorConfigPaths types.ProblemDaemonConfigPathMap) []ty
 				glog.Warningf("Duplicated problem daemon configuration %q", config)
 				continue
 			}
-			problemDaemonMap[config] = handlers[problemDaemonType].CreateProblemDaemonOrDie(config)
+			problemDaemonMap[config] = Supervise(config, handlers[problemDaemonType].CreateProblemDaemonOrDie)
 		}
 	}
-
-	problemDaemons := []types.Monitor{}
-	for _, problemDaemon := range problemDaemonMap {
-		problemDaemons = append(problemDaemons, problemDaemon)
-	}
-	return problemDaemons
+	return problemDaemonMap
 }
@@ -0,0 +1,316 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemdaemon
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const (
+	// SupervisorSource is the source of the events of the problem daemon supervisor.
+	SupervisorSource = "problem-daemon-supervisor"
+	// MonitorCrashReason is the reason of the event reported when a problem daemon crashes.
+	MonitorCrashReason = "MonitorCrash"
+
+	// initialRestartBackoff is the delay before a crashed problem daemon is restarted. It
+	// doubles on each crash up to maxRestartBackoff.
+	initialRestartBackoff = 10 * time.Second
+	maxRestartBackoff     = 5 * time.Minute
+	// stableRunPeriod is how long a problem daemon must run without crashing for the
+	// backoff to be reset.
+	stableRunPeriod = 10 * time.Minute
+)
+
+var (
+	// supervisors are the supervisors of the running problem daemons, keyed by the
+	// problem daemon, so that the panics recovered by Go are reported to them.
+	supervisors     = make(map[types.Monitor]*supervisor)
+	supervisorsLock sync.Mutex
+
+	crashes     metrics.Int64MetricInterface
+	crashesOnce sync.Once
+)
+
+// Go runs f in a new goroutine of the problem daemon m. A panic can only be recovered in
+// the goroutine it happens in, so problem daemons start their goroutines with Go for the
+// supervisor to restart them when they panic, instead of the whole process crashing. The
+// panics of problem daemons which are not supervised crash the process as usual.
+func Go(m types.Monitor, f func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s := supervisorOf(m)
+				if s == nil {
+					panic(r)
+				}
+				s.crashed(m, r, debug.Stack())
+			}
+		}()
+		f()
+	}()
+}
+
+func supervisorOf(m types.Monitor) *supervisor {
+	supervisorsLock.Lock()
+	defer supervisorsLock.Unlock()
+	return supervisors[m]
+}
+
+// crash is a panic of a problem daemon.
+type crash struct {
+	monitor types.Monitor
+	value   interface{}
+}
+
+// supervisor runs a problem daemon, and re-creates it with backoff when it crashes. The
+// statuses of the problem daemon, and the events of its crashes, are reported on the
+// channel of the supervisor, so that the restarts are transparent to the problem
+// detector.
+type supervisor struct {
+	config string
+	create func(configPath string) types.Monitor
+	clock  clock.Clock
+
+	// monitor is the running problem daemon, nil while a crashed problem daemon waits
+	// for its restart.
+	monitor types.Monitor
+	lock    sync.Mutex
+
+	crashes  chan crash
+	statuses chan *types.Status
+	tomb     *tomb.Tomb
+
+	// backoff and started are only accessed in the supervising goroutine.
+	backoff time.Duration
+	started time.Time
+}
+
+// Supervise creates the problem daemon of the configuration with the create function, and
+// returns it wrapped in a supervisor, which restarts it when it crashes.
+func Supervise(config string, create func(configPath string) types.Monitor) types.Monitor {
+	return newSupervisor(config, create, clock.RealClock{})
+}
+
+func newSupervisor(config string, create func(configPath string) types.Monitor, clock clock.Clock) *supervisor {
+	s := &supervisor{
+		config: config,
+		create: create,
+		clock:  clock,
+		// Only the first crash of a problem daemon is handled.
+		crashes: make(chan crash, 1),
+		// A 1000 size channel should be big enough.
+		statuses: make(chan *types.Status, 1000),
+		tomb:     tomb.NewTomb(),
+		backoff:  initialRestartBackoff,
+	}
+	s.setMonitor(create(config))
+	return s
+}
+
+// Start starts the problem daemon. The error of the problem daemon failing to start is
+// returned, while a panic is handled as a crash.
+func (s *supervisor) Start() (<-chan *types.Status, error) {
+	ch, err := s.start()
+	if err != nil {
+		return nil, err
+	}
+	go s.superviseLoop(ch)
+	return s.statuses, nil
+}
+
+func (s *supervisor) Stop() {
+	s.tomb.Stop()
+	if m := s.getMonitor(); m != nil {
+		m.Stop()
+	}
+	s.setMonitor(nil)
+}
+
+func (s *supervisor) getMonitor() types.Monitor {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.monitor
+}
+
+// setMonitor replaces the problem daemon, registering the supervisor of the new one.
+func (s *supervisor) setMonitor(m types.Monitor) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	supervisorsLock.Lock()
+	defer supervisorsLock.Unlock()
+	if s.monitor != nil {
+		delete(supervisors, s.monitor)
+	}
+	s.monitor = m
+	if m != nil {
+		supervisors[m] = s
+	}
+}
+
+// start starts the problem daemon, reporting a panic as a crash.
+func (s *supervisor) start() (ch <-chan *types.Status, err error) {
+	m := s.getMonitor()
+	s.started = s.clock.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			s.crashed(m, r, debug.Stack())
+		}
+	}()
+	return m.Start()
+}
+
+// crashed reports a crash of the problem daemon to the supervising goroutine.
+func (s *supervisor) crashed(m types.Monitor, value interface{}, stack []byte) {
+	glog.Errorf("Problem daemon %q crashed: %v\n%s", s.config, value, stack)
+	select {
+	case s.crashes <- crash{monitor: m, value: value}:
+	default:
+	}
+}
+
+func (s *supervisor) superviseLoop(ch <-chan *types.Status) {
+	defer s.tomb.Done()
+
+	for {
+		select {
+		case status, ok := <-ch:
+			if !ok {
+				ch = nil
+				continue
+			}
+			if !s.report(status) {
+				return
+			}
+		case c := <-s.crashes:
+			if c.monitor != s.getMonitor() {
+				// The problem daemon was already restarted.
+				continue
+			}
+			var ok bool
+			if ch, ok = s.restart(c); !ok {
+				return
+			}
+		case <-s.tomb.Stopping():
+			return
+		}
+	}
+}
+
+// restart reports the crash, and re-creates the problem daemon after the backoff, until
+// it starts. It returns false if the supervisor is stopped meanwhile.
+func (s *supervisor) restart(c crash) (<-chan *types.Status, bool) {
+	s.setMonitor(nil)
+	go stopCrashed(s.config, c.monitor)
+	if s.clock.Since(s.started) >= stableRunPeriod {
+		s.backoff = initialRestartBackoff
+	}
+	value := c.value
+	for {
+		recordCrash(s.config)
+		if !s.report(&types.Status{
+			Source: SupervisorSource,
+			Events: []types.Event{{
+				Severity:  types.Warn,
+				Timestamp: s.clock.Now(),
+				Reason:    MonitorCrashReason,
+				Message:   fmt.Sprintf("Problem daemon %q crashed, restarting in %v: %v", s.config, s.backoff, value),
+			}},
+		}) {
+			return nil, false
+		}
+		select {
+		case <-s.clock.After(s.backoff):
+		case <-s.tomb.Stopping():
+			return nil, false
+		}
+		s.backoff *= 2
+		if s.backoff > maxRestartBackoff {
+			s.backoff = maxRestartBackoff
+		}
+
+		glog.Infof("Restarting problem daemon %q", s.config)
+		s.setMonitor(s.create(s.config))
+		ch, err := s.start()
+		if err == nil {
+			return ch, true
+		}
+		// The problem daemon which failed to start is not stopped, it never ran.
+		glog.Errorf("Failed to restart problem daemon %q: %v", s.config, err)
+		s.setMonitor(nil)
+		value = err
+	}
+}
+
+// report forwards the status. It returns false if the supervisor is stopped meanwhile.
+func (s *supervisor) report(status *types.Status) bool {
+	select {
+	case s.statuses <- status:
+		return true
+	case <-s.tomb.Stopping():
+		return false
+	}
+}
+
+// stopCrashed stops the crashed problem daemon to release its resources. It may panic
+// again, or never return if its goroutines are gone, so it is stopped in the background.
+func stopCrashed(config string, m types.Monitor) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Errorf("Failed to stop crashed problem daemon %q: %v", config, r)
+		}
+	}()
+	m.Stop()
+}
+
+// recordCrash counts a crash of the problem daemon of the configuration.
+func recordCrash(config string) {
+	crashesOnce.Do(func() {
+		metric, err := metrics.NewInt64Metric(
+			metrics.ProblemDaemonCrashCountID,
+			string(metrics.ProblemDaemonCrashCountID),
+			"Number of crashes of problem daemons, which are restarted with backoff.",
+			"1",
+			metrics.Sum,
+			[]string{"config"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.ProblemDaemonCrashCountID, err)
+		}
+		crashes = metric
+	})
+	if err := crashes.Record(map[string]string{"config": config}, 1); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.ProblemDaemonCrashCountID, err)
+	}
+}
+
+// unwrap returns the running problem daemon of a supervised problem daemon.
+func unwrap(m types.Monitor) types.Monitor {
+	if s, ok := m.(*supervisor); ok {
+		return s.getMonitor()
+	}
+	return m
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemdaemon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// crashingMonitor forwards the statuses sent to it, and panics when told to.
+type crashingMonitor struct {
+	panicInStart bool
+	startErr     error
+	statuses     chan *types.Status
+	panics       chan string
+	stopped      chan struct{}
+}
+
+func (m *crashingMonitor) Start() (<-chan *types.Status, error) {
+	if m.panicInStart {
+		panic("panic in start")
+	}
+	if m.startErr != nil {
+		return nil, m.startErr
+	}
+	Go(m, func() {
+		panic(<-m.panics)
+	})
+	return m.statuses, nil
+}
+
+func (m *crashingMonitor) Stop() {
+	close(m.stopped)
+}
+
+// newTestSupervisor returns a supervisor of the first monitor, which re-creates the
+// monitors sent to the returned channel.
+func newTestSupervisor(t *testing.T, first *crashingMonitor) (*supervisor, chan *crashingMonitor, *clock.FakeClock) {
+	monitors := make(chan *crashingMonitor, 10)
+	monitors <- first
+	fakeClock := clock.NewFakeClock(time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC))
+	s := newSupervisor("/config/test.json", func(configPath string) types.Monitor {
+		select {
+		case m := <-monitors:
+			return m
+		default:
+			t.Fatalf("Unexpected creation of monitor of %q", configPath)
+			return nil
+		}
+	}, fakeClock)
+	return s, monitors, fakeClock
+}
+
+func newCrashingMonitor() *crashingMonitor {
+	return &crashingMonitor{
+		statuses: make(chan *types.Status, 1),
+		panics:   make(chan string, 1),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func receive(t *testing.T, ch <-chan *types.Status) *types.Status {
+	select {
+	case status := <-ch:
+		return status
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for status")
+		return nil
+	}
+}
+
+// stepBackoff steps the clock by the backoff once the supervisor waits for it.
+func stepBackoff(t *testing.T, fakeClock *clock.FakeClock, backoff time.Duration) {
+	assert.Eventually(t, fakeClock.HasWaiters, 5*time.Second, time.Millisecond)
+	fakeClock.Step(backoff)
+}
+
+func assertCrashEvent(t *testing.T, status *types.Status, message string) {
+	assert.Equal(t, SupervisorSource, status.Source)
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, MonitorCrashReason, status.Events[0].Reason)
+		assert.Equal(t, types.Warn, status.Events[0].Severity)
+		assert.Contains(t, status.Events[0].Message, message)
+	}
+}
+
+func TestSupervisorRestartsCrashedMonitor(t *testing.T) {
+	first, second, third := newCrashingMonitor(), newCrashingMonitor(), newCrashingMonitor()
+	s, monitors, fakeClock := newTestSupervisor(t, first)
+
+	ch, err := s.Start()
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	first.statuses <- &types.Status{Source: "test"}
+	assert.Equal(t, "test", receive(t, ch).Source)
+
+	// The crashed monitor is stopped, and re-created after the backoff.
+	monitors <- second
+	first.panics <- "boom"
+	assertCrashEvent(t, receive(t, ch), "crashed, restarting in 10s: boom")
+	<-first.stopped
+	assert.Nil(t, unwrap(s))
+	stepBackoff(t, fakeClock, initialRestartBackoff)
+	second.statuses <- &types.Status{Source: "test"}
+	assert.Equal(t, "test", receive(t, ch).Source)
+	assert.Equal(t, second, unwrap(s))
+
+	// The backoff doubles on crashes in a row.
+	monitors <- third
+	second.panics <- "boom again"
+	assertCrashEvent(t, receive(t, ch), "crashed, restarting in 20s: boom again")
+	stepBackoff(t, fakeClock, 2*initialRestartBackoff)
+	assert.Eventually(t, func() bool { return unwrap(s) == third }, 5*time.Second, time.Millisecond)
+
+	// The statuses of the crashed monitors are no longer forwarded.
+	first.statuses <- &types.Status{Source: "stale"}
+	third.statuses <- &types.Status{Source: "test"}
+	assert.Equal(t, "test", receive(t, ch).Source)
+}
+
+func TestSupervisorPanicInStart(t *testing.T) {
+	first, second, third := newCrashingMonitor(), newCrashingMonitor(), newCrashingMonitor()
+	first.panicInStart = true
+	second.startErr = errors.New("start error")
+	s, monitors, fakeClock := newTestSupervisor(t, first)
+
+	ch, err := s.Start()
+	assert.NoError(t, err)
+	defer s.Stop()
+	assertCrashEvent(t, receive(t, ch), "panic in start")
+
+	// A monitor failing to restart is retried with backoff.
+	monitors <- second
+	stepBackoff(t, fakeClock, initialRestartBackoff)
+	assertCrashEvent(t, receive(t, ch), "restarting in 20s: start error")
+	monitors <- third
+	stepBackoff(t, fakeClock, 2*initialRestartBackoff)
+	third.statuses <- &types.Status{Source: "test"}
+	assert.Equal(t, "test", receive(t, ch).Source)
+}
+
+func TestSupervisorResetsBackoff(t *testing.T) {
+	first, second := newCrashingMonitor(), newCrashingMonitor()
+	s, monitors, fakeClock := newTestSupervisor(t, first)
+	s.backoff = maxRestartBackoff
+
+	ch, err := s.Start()
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	// The backoff is reset after the monitor ran long enough.
+	fakeClock.Step(stableRunPeriod)
+	monitors <- second
+	first.panics <- "boom"
+	assertCrashEvent(t, receive(t, ch), "restarting in 10s: boom")
+}
+
+func TestSupervisorStartError(t *testing.T) {
+	m := newCrashingMonitor()
+	m.startErr = errors.New("start error")
+	s, _, _ := newTestSupervisor(t, m)
+
+	_, err := s.Start()
+	assert.Equal(t, m.startErr, err)
+}
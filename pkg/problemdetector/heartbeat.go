@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemdetector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/liveness"
+)
+
+const (
+	// HeartbeatSource is the source of the heartbeat condition.
+	HeartbeatSource = "node-problem-detector"
+	// HeartbeatConditionType is the type of the heartbeat condition. Unlike other
+	// conditions, it is true when there is no problem, i.e. when node problem detector
+	// is healthy.
+	HeartbeatConditionType = "NPDHealthy"
+
+	healthyReason    = "NPDIsHealthy"
+	healthyMessage   = "node-problem-detector is healthy"
+	unhealthyReason  = "NPDIsUnhealthy"
+	unhealthyMessage = "node-problem-detector has stalled goroutines: %s"
+
+	problemDetectorLivenessName = "problem-detector"
+)
+
+// livenessTimeout is the time after which the Run goroutine is considered stalled
+// if it does not answer the ping of the heartbeat goroutine.
+func (p *problemDetector) livenessTimeout() time.Duration {
+	return 2 * p.heartbeatPeriod
+}
+
+// heartbeatLoop exports the heartbeat condition every heartbeat period.
+func (p *problemDetector) heartbeatLoop() {
+	ticker := time.NewTicker(p.heartbeatPeriod)
+	defer ticker.Stop()
+	p.heartbeat(time.Now())
+	for now := range ticker.C {
+		select {
+		case p.ping <- struct{}{}:
+		default:
+			// The last ping has not been handled yet.
+		}
+		p.heartbeat(now)
+	}
+}
+
+// heartbeat checks the liveness of the goroutines of node problem detector, and
+// exports the result as the heartbeat condition.
+func (p *problemDetector) heartbeat(now time.Time) {
+	condition := newHeartbeatCondition(p.heartbeatCondition, liveness.Stalled(now), now)
+	if condition.Status != types.True {
+		glog.Errorf("Node problem detector is unhealthy: %s", condition.Message)
+	}
+	p.heartbeatCondition = &condition
+
+	// The heartbeat is exported on every period, even if it does not change, so
+	// that exporters can refresh it.
+	p.exportProblems(&types.Status{
+		Source:     HeartbeatSource,
+		Conditions: []types.Condition{condition},
+	})
+}
+
+// newHeartbeatCondition generates the heartbeat condition from the stalled goroutines.
+// The transition time is only updated when the status changes.
+func newHeartbeatCondition(last *types.Condition, stalled []string, now time.Time) types.Condition {
+	condition := types.Condition{
+		Type:    HeartbeatConditionType,
+		Status:  types.True,
+		Reason:  healthyReason,
+		Message: healthyMessage,
+	}
+	if len(stalled) > 0 {
+		condition.Status = types.False
+		condition.Reason = unhealthyReason
+		condition.Message = fmt.Sprintf(unhealthyMessage, strings.Join(stalled, ", "))
+	}
+	if last != nil && last.Status == condition.Status {
+		condition.Transition = last.Transition
+	} else {
+		condition.Transition = now
+	}
+	return condition
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemdetector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/exporters/memoryexporter"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/liveness"
+)
+
+func TestNewHeartbeatCondition(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Minute)
+
+	healthy := newHeartbeatCondition(nil, nil, now)
+	assert.Equal(t, types.Condition{
+		Type:       HeartbeatConditionType,
+		Status:     types.True,
+		Transition: now,
+		Reason:     healthyReason,
+		Message:    healthyMessage,
+	}, healthy)
+
+	// The transition time is kept while the status does not change.
+	assert.Equal(t, now, newHeartbeatCondition(&healthy, nil, later).Transition)
+
+	unhealthy := newHeartbeatCondition(&healthy, []string{"a", "b"}, later)
+	assert.Equal(t, types.Condition{
+		Type:       HeartbeatConditionType,
+		Status:     types.False,
+		Transition: later,
+		Reason:     unhealthyReason,
+		Message:    "node-problem-detector has stalled goroutines: a, b",
+	}, unhealthy)
+}
+
+func TestHeartbeat(t *testing.T) {
+	exporter := memoryexporter.NewExporter()
+	p := NewProblemDetector(nil, []types.Exporter{exporter}, Options{HeartbeatPeriod: time.Minute}).(*problemDetector)
+
+	liveness.Beat(problemDetectorLivenessName, p.livenessTimeout())
+	defer liveness.Forget(problemDetectorLivenessName)
+
+	now := time.Now()
+	p.heartbeat(now)
+	p.heartbeat(now.Add(3 * time.Minute))
+
+	assert.Len(t, exporter.Exported(), 2)
+	assert.Equal(t, HeartbeatSource, exporter.Exported()[0].Source)
+	assert.Equal(t, types.True, exporter.Exported()[0].Conditions[0].Status)
+	// The Run goroutine did not answer the ping within the liveness timeout.
+	assert.Equal(t, types.False, exporter.Exported()[1].Conditions[0].Status)
+	assert.Contains(t, exporter.Exported()[1].Conditions[0].Message, problemDetectorLivenessName)
+}
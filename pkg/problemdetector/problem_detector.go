@@ -17,13 +17,28 @@ limitations under the License.
 package problemdetector
 
 import (
+	"context"
 	"fmt"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
+	"go.opencensus.io/trace"
 
+	"k8s.io/node-problem-detector/pkg/correlation"
+	"k8s.io/node-problem-detector/pkg/flapdamping"
+	"k8s.io/node-problem-detector/pkg/healthscore"
+	"k8s.io/node-problem-detector/pkg/journal"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	"k8s.io/node-problem-detector/pkg/problemsummary"
 	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/liveness"
 )
 
+// exportSpanName is the name of the spans tracing the export of a status by an exporter.
+const exportSpanName = "problemdetector.ExportProblems"
+
 // ProblemDetector collects statuses from all problem daemons and update the node condition and send node event.
 type ProblemDetector interface {
 	Run() error
@@ -32,14 +47,78 @@ type ProblemDetector interface {
 type problemDetector struct {
 	monitors  []types.Monitor
 	exporters []types.Exporter
+	// fullSyncPeriod is the period at which the full state of all problem daemons is
+	// synced to the exporters.
+	fullSyncPeriod time.Duration
+	// conditions is the latest exported conditions of each source, keyed by source and
+	// condition type. It is only accessed in the Run goroutine.
+	conditions map[string]map[string]types.Condition
+	// heartbeatPeriod is the period at which the heartbeat condition is exported. 0
+	// disables the heartbeat condition.
+	heartbeatPeriod time.Duration
+	// heartbeatCondition is the latest heartbeat condition. It is only accessed in the
+	// heartbeat goroutine.
+	heartbeatCondition *types.Condition
+	// ping is sent by the heartbeat goroutine to check that the Run goroutine is alive.
+	ping chan struct{}
+	// exportMutex makes sure that the exporters are not called concurrently by the Run
+	// goroutine and the heartbeat goroutine.
+	exportMutex sync.Mutex
+	// correlator derives conditions from the conditions of all sources. It is nil when
+	// no correlation rule is configured.
+	correlator *correlation.Correlator
+	// summarizer updates the problem summary metrics. It is nil when the summary is
+	// disabled. It is only accessed in the Run goroutine.
+	summarizer *problemsummary.Summarizer
+	// scorer updates the health score. It is nil when the health score is disabled. It
+	// is only accessed in the Run goroutine.
+	scorer *healthscore.Scorer
+	// damper damps the flapping conditions before they are exported. It is nil when flap
+	// damping is disabled. It is only accessed in the Run goroutine.
+	damper *flapdamping.Damper
+	// journal records the exported problems, so that the ones not delivered are exported
+	// again after a restart. It is nil when the event journal is disabled. It is only
+	// accessed in the Run goroutine.
+	journal *journal.Journal
+}
+
+// Options are the optional features of the problem detector. The zero value disables all
+// of them.
+type Options struct {
+	// FullSyncPeriod is the period at which the full state of all problem daemons is
+	// synced to the exporters. 0 disables the full sync.
+	FullSyncPeriod time.Duration
+	// HeartbeatPeriod is the period at which the heartbeat condition is exported. 0
+	// disables the heartbeat condition.
+	HeartbeatPeriod time.Duration
+	// Correlator derives conditions from the conditions of all sources.
+	Correlator *correlation.Correlator
+	// Summarizer updates the problem summary metrics.
+	Summarizer *problemsummary.Summarizer
+	// Scorer updates the health score.
+	Scorer *healthscore.Scorer
+	// Damper damps the flapping conditions before they are exported.
+	Damper *flapdamping.Damper
+	// Journal records the exported problems, so that the ones not delivered are exported
+	// again after a restart.
+	Journal *journal.Journal
 }
 
 // NewProblemDetector creates the problem detector. Currently we just directly passed in the problem daemons, but
 // in the future we may want to let the problem daemons register themselves.
-func NewProblemDetector(monitors []types.Monitor, exporters []types.Exporter) ProblemDetector {
+func NewProblemDetector(monitors []types.Monitor, exporters []types.Exporter, options Options) ProblemDetector {
 	return &problemDetector{
-		monitors:  monitors,
-		exporters: exporters,
+		monitors:        monitors,
+		exporters:       exporters,
+		fullSyncPeriod:  options.FullSyncPeriod,
+		conditions:      make(map[string]map[string]types.Condition),
+		heartbeatPeriod: options.HeartbeatPeriod,
+		ping:            make(chan struct{}, 1),
+		correlator:      options.Correlator,
+		summarizer:      options.Summarizer,
+		scorer:          options.Scorer,
+		damper:          options.Damper,
+		journal:         options.Journal,
 	}
 }
 
@@ -65,13 +144,173 @@ func (p *problemDetector) Run() error {
 	}
 	ch := groupChannel(chans)
 	glog.Info("Problem detector started")
+	p.replay()
 
+	// A nil channel blocks forever, which disables the full sync.
+	var syncCh <-chan time.Time
+	if p.fullSyncPeriod > 0 {
+		syncTicker := time.NewTicker(p.fullSyncPeriod)
+		defer syncTicker.Stop()
+		syncCh = syncTicker.C
+	}
+	var summaryCh <-chan time.Time
+	if p.summarizer != nil {
+		summaryTicker := time.NewTicker(p.summarizer.UpdatePeriod())
+		defer summaryTicker.Stop()
+		summaryCh = summaryTicker.C
+	}
+	var scoreCh <-chan time.Time
+	if p.scorer != nil {
+		scoreTicker := time.NewTicker(p.scorer.UpdatePeriod())
+		defer scoreTicker.Stop()
+		scoreCh = scoreTicker.C
+	}
+	var damperCh <-chan time.Time
+	if p.damper != nil {
+		damperTicker := time.NewTicker(p.damper.CheckPeriod())
+		defer damperTicker.Stop()
+		damperCh = damperTicker.C
+	}
+	var journalCh <-chan time.Time
+	if p.journal != nil {
+		journalTicker := time.NewTicker(p.journal.CheckPeriod())
+		defer journalTicker.Stop()
+		journalCh = journalTicker.C
+	}
+	if p.heartbeatPeriod > 0 {
+		liveness.Beat(problemDetectorLivenessName, p.livenessTimeout())
+		go p.heartbeatLoop()
+	}
 	for {
 		select {
 		case status := <-ch:
-			for _, exporter := range p.exporters {
-				exporter.ExportProblems(status)
+			p.handleStatus(status)
+		case <-syncCh:
+			p.fullSync()
+		case <-summaryCh:
+			p.summarizer.Update(p.conditions, nil, time.Now())
+		case <-scoreCh:
+			p.scorer.Update(p.conditions)
+		case now := <-damperCh:
+			for _, status := range p.damper.Release(now) {
+				p.exportChanges(status)
 			}
+		case now := <-journalCh:
+			p.journal.Acknowledge(now)
+		case <-p.ping:
+			liveness.Beat(problemDetectorLivenessName, p.livenessTimeout())
+		}
+	}
+}
+
+// replay exports again the problems of the journal which were not delivered before the
+// restart, oldest first.
+func (p *problemDetector) replay() {
+	if p.journal == nil {
+		return
+	}
+	entries := p.journal.Unacknowledged()
+	if len(entries) == 0 {
+		return
+	}
+	glog.Infof("Replaying %d problems which were not delivered before the restart", len(entries))
+	for _, e := range entries {
+		p.exportProblems(e.Status)
+		p.journal.Exported(e.Seq, time.Now())
+	}
+}
+
+// handleStatus damps the flapping conditions of the status, and exports its changes.
+func (p *problemDetector) handleStatus(status *types.Status) {
+	if p.damper != nil {
+		status = p.damper.Damp(status, time.Now())
+	}
+	p.exportChanges(status)
+}
+
+// exportChanges exports the changes in the status, and the changes of the conditions
+// derived from it.
+func (p *problemDetector) exportChanges(status *types.Status) {
+	deltas := []*types.Status{p.diff(status)}
+	if p.correlator != nil {
+		deltas = append(deltas, p.diff(p.correlator.Correlate(p.conditions, time.Now())))
+	}
+	for _, delta := range deltas {
+		if len(delta.Events) == 0 && len(delta.Conditions) == 0 {
+			continue
+		}
+		problemmetrics.GlobalProblemMetricsManager.SetExemplars(delta)
+		if p.journal == nil {
+			p.exportProblems(delta)
+			continue
+		}
+		seq := p.journal.Append(delta, time.Now())
+		p.exportProblems(delta)
+		p.journal.Exported(seq, time.Now())
+	}
+	if p.summarizer != nil {
+		p.summarizer.Update(p.conditions, status.Events, time.Now())
+	}
+	if p.scorer != nil {
+		p.scorer.Update(p.conditions)
+	}
+}
+
+// exportProblems exports the status to all exporters. When the detection of the status
+// is traced, each export is traced as part of it.
+func (p *problemDetector) exportProblems(status *types.Status) {
+	p.exportMutex.Lock()
+	defer p.exportMutex.Unlock()
+	for _, exporter := range p.exporters {
+		if !status.Trace.IsSampled() {
+			exporter.ExportProblems(status)
+			continue
+		}
+		_, span := trace.StartSpanWithRemoteParent(context.Background(), exportSpanName, status.Trace,
+			trace.WithSampler(trace.AlwaysSample()))
+		span.AddAttributes(
+			trace.StringAttribute("source", status.Source),
+			trace.StringAttribute("exporter", fmt.Sprintf("%T", exporter)),
+		)
+		exporter.ExportProblems(status)
+		span.End()
+	}
+}
+
+// diff records the conditions in the status, and returns a status which only contains
+// the events and the conditions changed since the last status of the same source.
+func (p *problemDetector) diff(status *types.Status) *types.Status {
+	delta := &types.Status{
+		Source: status.Source,
+		Events: status.Events,
+		Trace:  status.Trace,
+	}
+	last, ok := p.conditions[status.Source]
+	if !ok {
+		last = make(map[string]types.Condition)
+		p.conditions[status.Source] = last
+	}
+	for _, condition := range status.Conditions {
+		if old, ok := last[condition.Type]; ok && reflect.DeepEqual(old, condition) {
+			continue
+		}
+		last[condition.Type] = condition
+		delta.Conditions = append(delta.Conditions, condition)
+	}
+	return delta
+}
+
+// fullSync exports the latest conditions of all sources.
+func (p *problemDetector) fullSync() {
+	p.exportMutex.Lock()
+	defer p.exportMutex.Unlock()
+	for source, conditions := range p.conditions {
+		status := &types.Status{Source: source}
+		for _, condition := range conditions {
+			status.Conditions = append(status.Conditions, condition)
+		}
+		for _, exporter := range p.exporters {
+			exporter.SyncProblems(status)
 		}
 	}
 }
@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemdetector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+
+	"k8s.io/node-problem-detector/pkg/correlation"
+	"k8s.io/node-problem-detector/pkg/exporters/memoryexporter"
+	"k8s.io/node-problem-detector/pkg/flapdamping"
+	"k8s.io/node-problem-detector/pkg/journal"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestDiff(t *testing.T) {
+	now := time.Now()
+	healthy := types.Condition{Type: "KernelDeadlock", Status: types.False, Transition: now, Reason: "KernelHasNoDeadlock"}
+	deadlock := types.Condition{Type: "KernelDeadlock", Status: types.True, Transition: now.Add(time.Second), Reason: "DockerHung"}
+	readonly := types.Condition{Type: "ReadonlyFilesystem", Status: types.False, Transition: now, Reason: "FilesystemIsNotReadOnly"}
+	event := types.Event{Severity: types.Warn, Timestamp: now, Reason: "TaskHung"}
+
+	p := NewProblemDetector(nil, nil, Options{}).(*problemDetector)
+
+	// All conditions are new on the first status.
+	delta := p.diff(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{healthy, readonly}})
+	assert.Equal(t, []types.Condition{healthy, readonly}, delta.Conditions)
+
+	// Unchanged conditions are dropped, events are kept.
+	delta = p.diff(&types.Status{Source: "kernel-monitor", Events: []types.Event{event}, Conditions: []types.Condition{healthy, readonly}})
+	assert.Empty(t, delta.Conditions)
+	assert.Equal(t, []types.Event{event}, delta.Events)
+
+	// Only the changed condition is reported.
+	delta = p.diff(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{deadlock, readonly}})
+	assert.Equal(t, []types.Condition{deadlock}, delta.Conditions)
+
+	// Conditions are tracked per source.
+	delta = p.diff(&types.Status{Source: "docker-monitor", Conditions: []types.Condition{healthy}})
+	assert.Equal(t, []types.Condition{healthy}, delta.Conditions)
+}
+
+func TestFullSync(t *testing.T) {
+	condition := types.Condition{Type: "KernelDeadlock", Status: types.False, Reason: "KernelHasNoDeadlock"}
+	exporter := memoryexporter.NewExporter()
+	p := NewProblemDetector(nil, []types.Exporter{exporter}, Options{}).(*problemDetector)
+
+	p.diff(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{condition}})
+	p.fullSync()
+
+	assert.Equal(t, []*types.Status{{Source: "kernel-monitor", Conditions: []types.Condition{condition}}}, exporter.Synced())
+}
+
+func TestHandleStatusWithCorrelation(t *testing.T) {
+	f, err := ioutil.TempFile("", "condition-correlation")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"rules": [{"condition": "NodeDegraded", "expression": "KernelDeadlock"}]}`)
+	assert.NoError(t, err)
+	f.Close()
+	correlator, err := correlation.NewCorrelator(f.Name())
+	assert.NoError(t, err)
+
+	exporter := memoryexporter.NewExporter()
+	p := NewProblemDetector(nil, []types.Exporter{exporter}, Options{Correlator: correlator}).(*problemDetector)
+
+	healthy := types.Condition{Type: "KernelDeadlock", Status: types.False}
+	deadlock := types.Condition{Type: "KernelDeadlock", Status: types.True}
+
+	p.handleStatus(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{healthy}})
+	assert.Len(t, exporter.Exported(), 2)
+	assert.Equal(t, correlator.Source(), exporter.Exported()[1].Source)
+	assert.Equal(t, types.False, exporter.Exported()[1].Conditions[0].Status)
+
+	// The derived condition is not exported again if it does not change.
+	p.handleStatus(&types.Status{Source: "kernel-monitor", Events: []types.Event{{Reason: "TaskHung"}}, Conditions: []types.Condition{healthy}})
+	assert.Len(t, exporter.Exported(), 3)
+
+	p.handleStatus(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{deadlock}})
+	assert.Len(t, exporter.Exported(), 5)
+	assert.Equal(t, types.True, exporter.Exported()[4].Conditions[0].Status)
+}
+
+// spanRecorder records the ended sampled spans.
+type spanRecorder struct {
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.spans = append(r.spans, s)
+}
+
+func TestExportProblemsTracing(t *testing.T) {
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+
+	exporter := memoryexporter.NewExporter()
+	p := NewProblemDetector(nil, []types.Exporter{exporter}, Options{}).(*problemDetector)
+	event := types.Event{Severity: types.Warn, Reason: "TaskHung"}
+
+	// Statuses whose detection is not traced are exported without span.
+	p.handleStatus(&types.Status{Source: "kernel-monitor", Events: []types.Event{event}})
+	assert.Empty(t, recorder.spans)
+
+	_, detect := trace.StartSpan(context.Background(), "detect", trace.WithSampler(trace.AlwaysSample()))
+	p.handleStatus(&types.Status{Source: "kernel-monitor", Events: []types.Event{event}, Trace: detect.SpanContext()})
+	detect.End()
+	if assert.Len(t, recorder.spans, 2) {
+		export := recorder.spans[0]
+		assert.Equal(t, exportSpanName, export.Name)
+		assert.Equal(t, detect.SpanContext().TraceID, export.TraceID)
+		assert.Equal(t, detect.SpanContext().SpanID, export.ParentSpanID)
+		assert.Equal(t, "kernel-monitor", export.Attributes["source"])
+		assert.Equal(t, "*memoryexporter.Exporter", export.Attributes["exporter"])
+	}
+	assert.Equal(t, detect.SpanContext(), exporter.Exported()[1].Trace)
+}
+
+func TestHandleStatusWithFlapDamping(t *testing.T) {
+	f, err := ioutil.TempFile("", "flap-damping")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"maxTransitions": 1, "window": "1h"}`)
+	assert.NoError(t, err)
+	f.Close()
+	damper, err := flapdamping.NewDamper(f.Name())
+	assert.NoError(t, err)
+	exporter := memoryexporter.NewExporter()
+	p := NewProblemDetector(nil, []types.Exporter{exporter}, Options{Damper: damper}).(*problemDetector)
+
+	now := time.Now()
+	deadlock := types.Condition{Type: "KernelDeadlock", Status: types.True, Transition: now, Reason: "DockerHung"}
+	healthy := types.Condition{Type: "KernelDeadlock", Status: types.False, Transition: now, Reason: "KernelHasNoDeadlock"}
+	p.handleStatus(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{deadlock}})
+	// The condition flapping back to False is held True.
+	p.handleStatus(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{healthy}})
+	p.handleStatus(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{deadlock}})
+
+	exported := exporter.Exported()
+	if assert.Len(t, exported, 2) {
+		assert.Equal(t, []types.Condition{deadlock}, exported[0].Conditions)
+		assert.Equal(t, types.True, exported[1].Conditions[0].Status)
+		assert.Equal(t, "DockerHung", exported[1].Conditions[0].Reason)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "event-journal.json")
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte(`{"path": "`+filepath.Join(dir, "journal")+`"}`), 0644))
+	j, err := journal.Open(configPath, nil)
+	assert.NoError(t, err)
+	exporter := memoryexporter.NewExporter()
+	p := NewProblemDetector(nil, []types.Exporter{exporter}, Options{Journal: j}).(*problemDetector)
+
+	deadlock := types.Condition{Type: "KernelDeadlock", Status: types.True, Transition: time.Now().UTC(), Reason: "DockerHung"}
+	p.exportChanges(&types.Status{Source: "kernel-monitor", Conditions: []types.Condition{deadlock}})
+	assert.Len(t, exporter.Exported(), 1)
+	assert.NoError(t, j.Close())
+
+	// The status which was not acknowledged is exported again after a restart.
+	j, err = journal.Open(configPath, nil)
+	assert.NoError(t, err)
+	defer j.Close()
+	exporter = memoryexporter.NewExporter()
+	p = NewProblemDetector(nil, []types.Exporter{exporter}, Options{Journal: j}).(*problemDetector)
+	p.replay()
+	exported := exporter.Exported()
+	if assert.Len(t, exported, 1) {
+		assert.Equal(t, "kernel-monitor", exported[0].Source)
+		assert.True(t, deadlock.Transition.Equal(exported[0].Conditions[0].Transition))
+		assert.Equal(t, "DockerHung", exported[0].Conditions[0].Reason)
+	}
+}
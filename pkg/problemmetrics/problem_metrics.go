@@ -20,9 +20,13 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/golang/glog"
 
+	npdapiv1 "k8s.io/node-problem-detector/pkg/api/v1"
+	"k8s.io/node-problem-detector/pkg/types"
 	"k8s.io/node-problem-detector/pkg/util/metrics"
 )
 
@@ -38,14 +42,50 @@ func init() {
 // ProblemMetricsManager manages problem-converted metrics.
 // ProblemMetricsManager is thread-safe.
 type ProblemMetricsManager struct {
-	problemCounter           metrics.Int64MetricInterface
-	problemGauge             metrics.Int64MetricInterface
-	problemTypeToReason      map[string]string
+	problemCounter metrics.Int64MetricInterface
+	problemGauge   metrics.Int64MetricInterface
+	// problemTypeToTags are the tags of the last reason of each problem type, so that the
+	// gauge of the last reason is cleared with the tags it was set with.
+	problemTypeToTags        map[string]map[string]string
 	problemTypeToReasonMutex sync.Mutex
+	// reasonToOwnership and reasonToSeverity are the ownership and the severity of the
+	// problem reasons, which label their metrics.
+	reasonToOwnership      map[string]types.Ownership
+	reasonToSeverity       map[string]types.Severity
+	reasonToOwnershipMutex sync.RWMutex
+	// ruleLabels are the keys of the rule labels which label the metrics.
+	ruleLabels []string
+	// suppressed tells whether the problems of a type and reason are suppressed, nil when
+	// no problem is suppressed.
+	suppressed func(problemType, reason string) bool
 }
 
-func NewProblemMetricsManagerOrDie() *ProblemMetricsManager {
-	pmm := ProblemMetricsManager{}
+// SuppressedLabel is the metric label of the problems suppressed by a maintenance window.
+const SuppressedLabel = "suppressed"
+
+// reservedLabels are the labels of the problem metrics which rule labels can not use.
+var reservedLabels = []string{"type", "reason", types.TeamAnnotation, types.EscalationAnnotation, types.SeverityAnnotation, SuppressedLabel}
+
+// ValidateRuleLabels verifies whether the keys of the rule labels can label the problem
+// metrics.
+func ValidateRuleLabels(ruleLabels []string) error {
+	for _, key := range ruleLabels {
+		if err := (types.Ownership{Labels: map[string]string{key: ""}}).Validate(); err != nil {
+			return err
+		}
+		for _, reserved := range reservedLabels {
+			if key == reserved {
+				return fmt.Errorf("label %q is reserved by the problem metrics", key)
+			}
+		}
+	}
+	return nil
+}
+
+// NewProblemMetricsManagerOrDie creates the problem metrics, panic if error occurs. The
+// rule labels of the keys, e.g. "runbook", label the metrics of the problems of the rule.
+func NewProblemMetricsManagerOrDie(ruleLabels ...string) *ProblemMetricsManager {
+	pmm := ProblemMetricsManager{ruleLabels: ruleLabels}
 
 	var err error
 	pmm.problemCounter, err = metrics.NewInt64Metric(
@@ -54,7 +94,7 @@ func NewProblemMetricsManagerOrDie() *ProblemMetricsManager {
 		"Number of times a specific type of problem have occurred.",
 		"1",
 		metrics.Sum,
-		[]string{"reason"})
+		append([]string{"reason", types.TeamAnnotation, types.EscalationAnnotation, types.SeverityAnnotation, SuppressedLabel}, ruleLabels...))
 	if err != nil {
 		glog.Fatalf("Failed to create problem_counter metric: %v", err)
 	}
@@ -65,12 +105,14 @@ func NewProblemMetricsManagerOrDie() *ProblemMetricsManager {
 		"Whether a specific type of problem is affecting the node or not.",
 		"1",
 		metrics.LastValue,
-		[]string{"type", "reason"})
+		append([]string{"type", "reason", types.TeamAnnotation, types.EscalationAnnotation, types.SeverityAnnotation, SuppressedLabel}, ruleLabels...))
 	if err != nil {
 		glog.Fatalf("Failed to create problem_gauge metric: %v", err)
 	}
 
-	pmm.problemTypeToReason = make(map[string]string)
+	pmm.problemTypeToTags = make(map[string]map[string]string)
+	pmm.reasonToOwnership = make(map[string]types.Ownership)
+	pmm.reasonToSeverity = make(map[string]types.Severity)
 
 	return &pmm
 }
@@ -81,7 +123,125 @@ func (pmm *ProblemMetricsManager) IncrementProblemCounter(reason string, count i
 		return errors.New("problem counter is being incremented before initialized.")
 	}
 
-	return pmm.problemCounter.Record(map[string]string{"reason": reason}, count)
+	return pmm.problemCounter.Record(pmm.tags(map[string]string{"reason": reason}, "", reason), count)
+}
+
+// maxExemplarMessageLength is the maximum length of the messages of the exemplars, longer
+// messages are truncated. Back ends limit the size of exemplars, e.g. OpenMetrics limits
+// their labels to 128 characters.
+const maxExemplarMessageLength = 100
+
+// SetExemplars sets the events and the conditions becoming True of the status as the
+// exemplars of their problem counters, so that the increments of the counters link to
+// the problems counted, and to the trace of their detection when it is traced. The
+// attributes of the exemplars are the fields of the v1 problem reports, by JSON name.
+func (pmm *ProblemMetricsManager) SetExemplars(status *types.Status) {
+	if pmm.problemCounter == nil {
+		return
+	}
+	report := npdapiv1.NewProblemReport("", status)
+	for _, event := range report.Events {
+		pmm.setExemplar(status, event.Reason, event.Timestamp, exemplarAttributes(map[string]string{
+			"source":   report.Source,
+			"severity": event.Severity,
+			"message":  truncate(event.Message, maxExemplarMessageLength),
+		}))
+	}
+	for _, condition := range report.Conditions {
+		if condition.Status != string(types.True) {
+			continue
+		}
+		pmm.setExemplar(status, condition.Reason, condition.Transition, exemplarAttributes(map[string]string{
+			"source":   report.Source,
+			"type":     condition.Type,
+			"status":   condition.Status,
+			"severity": condition.Severity,
+			"message":  truncate(condition.Message, maxExemplarMessageLength),
+		}))
+	}
+}
+
+// exemplarAttributes returns the attributes without the empty ones.
+func exemplarAttributes(attributes map[string]string) map[string]string {
+	for name, value := range attributes {
+		if value == "" {
+			delete(attributes, name)
+		}
+	}
+	return attributes
+}
+
+func (pmm *ProblemMetricsManager) setExemplar(status *types.Status, reason string, timestamp time.Time, attributes map[string]string) {
+	pmm.problemCounter.SetExemplar(pmm.tags(map[string]string{"reason": reason}, "", reason), metrics.Exemplar{
+		Value:      1,
+		Timestamp:  timestamp,
+		Trace:      status.Trace,
+		Attributes: attributes,
+	})
+}
+
+// truncate truncates s to at most n runes.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// SetSuppressor sets the function telling whether the problems of a type and reason are
+// suppressed, which labels their metrics. The problem type of the problem counters is
+// empty.
+func (pmm *ProblemMetricsManager) SetSuppressor(suppressed func(problemType, reason string) bool) {
+	pmm.reasonToOwnershipMutex.Lock()
+	defer pmm.reasonToOwnershipMutex.Unlock()
+	pmm.suppressed = suppressed
+}
+
+// SetOwnership sets the ownership of the problems with the reason, which is added to the
+// labels of their metrics. An empty ownership is ignored.
+func (pmm *ProblemMetricsManager) SetOwnership(reason string, ownership types.Ownership) {
+	if ownership.IsZero() {
+		return
+	}
+	pmm.reasonToOwnershipMutex.Lock()
+	defer pmm.reasonToOwnershipMutex.Unlock()
+	pmm.reasonToOwnership[reason] = ownership
+}
+
+// SetSeverity sets the severity of the problems with the reason, which is added to the
+// labels of their metrics. An empty severity is ignored.
+func (pmm *ProblemMetricsManager) SetSeverity(reason string, severity types.Severity) {
+	if severity == "" {
+		return
+	}
+	pmm.reasonToOwnershipMutex.Lock()
+	defer pmm.reasonToOwnershipMutex.Unlock()
+	pmm.reasonToSeverity[reason] = severity
+}
+
+// tags adds the ownership, the severity and the suppression of the problem to the tags.
+func (pmm *ProblemMetricsManager) tags(tags map[string]string, problemType, reason string) map[string]string {
+	pmm.reasonToOwnershipMutex.RLock()
+	defer pmm.reasonToOwnershipMutex.RUnlock()
+	ownership := pmm.reasonToOwnership[reason]
+	if ownership.Team != "" {
+		tags[types.TeamAnnotation] = ownership.Team
+	}
+	if ownership.Escalation != "" {
+		tags[types.EscalationAnnotation] = ownership.Escalation
+	}
+	for _, key := range pmm.ruleLabels {
+		if value := ownership.Labels[key]; value != "" {
+			tags[key] = value
+		}
+	}
+	if severity := pmm.reasonToSeverity[reason]; severity != "" {
+		tags[types.SeverityAnnotation] = string(severity)
+	}
+	if pmm.suppressed != nil && pmm.suppressed(problemType, reason) {
+		tags[SuppressedLabel] = "true"
+	}
+	return tags
 }
 
 // SetProblemGauge sets the value of a problem gauge.
@@ -98,19 +258,20 @@ func (pmm *ProblemMetricsManager) SetProblemGauge(problemType string, reason str
 	// This behavior is consistent with the behavior of node condition in Kubernetes.
 	// However, problemGauges with different "type" and "reason" are considered as different
 	// metrics in Prometheus. So we need to clear the previous metrics explicitly.
-	if lastReason, ok := pmm.problemTypeToReason[problemType]; ok {
-		err := pmm.problemGauge.Record(map[string]string{"type": problemType, "reason": lastReason}, 0)
+	if lastTags, ok := pmm.problemTypeToTags[problemType]; ok {
+		err := pmm.problemGauge.Record(lastTags, 0)
 		if err != nil {
 			return fmt.Errorf("failed to clear previous reason %q for type %q: %v",
-				problemType, lastReason, err)
+				problemType, lastTags["reason"], err)
 		}
 	}
 
-	pmm.problemTypeToReason[problemType] = reason
+	tags := pmm.tags(map[string]string{"type": problemType, "reason": reason}, problemType, reason)
+	pmm.problemTypeToTags[problemType] = tags
 
 	var valueInt int64
 	if value {
 		valueInt = 1
 	}
-	return pmm.problemGauge.Record(map[string]string{"type": problemType, "reason": reason}, valueInt)
+	return pmm.problemGauge.Record(tags, valueInt)
 }
@@ -17,19 +17,22 @@ limitations under the License.
 package problemmetrics
 
 import (
+	"k8s.io/node-problem-detector/pkg/types"
 	"k8s.io/node-problem-detector/pkg/util/metrics"
 )
 
 // NewProblemMetricsManagerStub creates a ProblemMetricsManager stubbed by fake metrics.
 // The stubbed ProblemMetricsManager and fake metrics are returned.
-func NewProblemMetricsManagerStub() (*ProblemMetricsManager, *metrics.FakeInt64Metric, *metrics.FakeInt64Metric) {
-	fakeProblemCounter := metrics.NewFakeInt64Metric("problem_counter", metrics.Sum, []string{"reason"})
-	fakeProblemGauge := metrics.NewFakeInt64Metric("problem_gauge", metrics.LastValue, []string{"type", "reason"})
+func NewProblemMetricsManagerStub(ruleLabels ...string) (*ProblemMetricsManager, *metrics.FakeInt64Metric, *metrics.FakeInt64Metric) {
+	fakeProblemCounter := metrics.NewFakeInt64Metric("problem_counter", metrics.Sum, append([]string{"reason", types.TeamAnnotation, types.EscalationAnnotation, types.SeverityAnnotation, SuppressedLabel}, ruleLabels...))
+	fakeProblemGauge := metrics.NewFakeInt64Metric("problem_gauge", metrics.LastValue, append([]string{"type", "reason", types.TeamAnnotation, types.EscalationAnnotation, types.SeverityAnnotation, SuppressedLabel}, ruleLabels...))
 
-	pmm := ProblemMetricsManager{}
+	pmm := ProblemMetricsManager{ruleLabels: ruleLabels}
 	pmm.problemCounter = metrics.Int64MetricInterface(fakeProblemCounter)
 	pmm.problemGauge = metrics.Int64MetricInterface(fakeProblemGauge)
-	pmm.problemTypeToReason = make(map[string]string)
+	pmm.problemTypeToTags = make(map[string]map[string]string)
+	pmm.reasonToOwnership = make(map[string]types.Ownership)
+	pmm.reasonToSeverity = make(map[string]types.Severity)
 
 	return &pmm, fakeProblemCounter, fakeProblemGauge
 }
@@ -17,10 +17,14 @@ limitations under the License.
 package problemmetrics
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
 
+	"k8s.io/node-problem-detector/pkg/types"
 	"k8s.io/node-problem-detector/pkg/util/metrics"
 )
 
@@ -275,3 +279,195 @@ func TestSetProblemGauge(t *testing.T) {
 		})
 	}
 }
+
+func TestOwnership(t *testing.T) {
+	pmm, fakeProblemCounter, fakeProblemGauge := NewProblemMetricsManagerStub()
+	pmm.SetOwnership("ReasonFoo", types.Ownership{Team: "storage", Escalation: "#storage-oncall"})
+	pmm.SetOwnership("ReasonBar", types.Ownership{})
+
+	pmm.IncrementProblemCounter("ReasonFoo", 1)
+	pmm.IncrementProblemCounter("ReasonBar", 1)
+	pmm.SetProblemGauge("ProblemTypeA", "ReasonFoo", true)
+	pmm.SetProblemGauge("ProblemTypeA", "ReasonBar", true)
+
+	ownership := map[string]string{"team": "storage", "escalation": "#storage-oncall"}
+	expectedMetrics := []metrics.Int64MetricRepresentation{
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "ReasonFoo", "team": ownership["team"], "escalation": ownership["escalation"]},
+			Value:  1,
+		},
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "ReasonBar"},
+			Value:  1,
+		},
+		{
+			Name:   "problem_gauge",
+			Labels: map[string]string{"type": "ProblemTypeA", "reason": "ReasonFoo", "team": ownership["team"], "escalation": ownership["escalation"]},
+			Value:  0,
+		},
+		{
+			Name:   "problem_gauge",
+			Labels: map[string]string{"type": "ProblemTypeA", "reason": "ReasonBar"},
+			Value:  1,
+		},
+	}
+	gotMetrics := append(fakeProblemCounter.ListMetrics(), fakeProblemGauge.ListMetrics()...)
+	assert.ElementsMatch(t, expectedMetrics, gotMetrics,
+		"expected metrics: %+v, got: %+v", expectedMetrics, gotMetrics)
+}
+
+func TestRuleLabels(t *testing.T) {
+	pmm, fakeProblemCounter, fakeProblemGauge := NewProblemMetricsManagerStub("runbook")
+	pmm.SetOwnership("ReasonFoo", types.Ownership{
+		Team:   "storage",
+		Labels: map[string]string{"runbook": "https://runbooks/readonly-fs", "ticket_queue": "STORAGE"},
+	})
+
+	pmm.IncrementProblemCounter("ReasonFoo", 1)
+	pmm.SetProblemGauge("ProblemTypeA", "ReasonFoo", true)
+
+	// Only the rule labels of the configured keys label the metrics.
+	expectedMetrics := []metrics.Int64MetricRepresentation{
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "ReasonFoo", "team": "storage", "runbook": "https://runbooks/readonly-fs"},
+			Value:  1,
+		},
+		{
+			Name:   "problem_gauge",
+			Labels: map[string]string{"type": "ProblemTypeA", "reason": "ReasonFoo", "team": "storage", "runbook": "https://runbooks/readonly-fs"},
+			Value:  1,
+		},
+	}
+	gotMetrics := append(fakeProblemCounter.ListMetrics(), fakeProblemGauge.ListMetrics()...)
+	assert.ElementsMatch(t, expectedMetrics, gotMetrics,
+		"expected metrics: %+v, got: %+v", expectedMetrics, gotMetrics)
+}
+
+func TestValidateRuleLabels(t *testing.T) {
+	assert.NoError(t, ValidateRuleLabels(nil))
+	assert.NoError(t, ValidateRuleLabels([]string{"runbook", "ticket_queue"}))
+	assert.Error(t, ValidateRuleLabels([]string{"ticket-queue"}))
+	assert.Error(t, ValidateRuleLabels([]string{"reason"}))
+	assert.Error(t, ValidateRuleLabels([]string{"team"}))
+}
+
+func TestSeverity(t *testing.T) {
+	pmm, fakeProblemCounter, fakeProblemGauge := NewProblemMetricsManagerStub()
+	pmm.SetSeverity("ReasonFoo", types.Critical)
+	pmm.SetSeverity("ReasonBar", "")
+	pmm.SetOwnership("ReasonFoo", types.Ownership{Team: "storage"})
+
+	pmm.IncrementProblemCounter("ReasonFoo", 1)
+	pmm.IncrementProblemCounter("ReasonBar", 1)
+	pmm.SetProblemGauge("ProblemTypeA", "ReasonFoo", true)
+
+	expectedMetrics := []metrics.Int64MetricRepresentation{
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "ReasonFoo", "team": "storage", "severity": "critical"},
+			Value:  1,
+		},
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "ReasonBar"},
+			Value:  1,
+		},
+		{
+			Name:   "problem_gauge",
+			Labels: map[string]string{"type": "ProblemTypeA", "reason": "ReasonFoo", "team": "storage", "severity": "critical"},
+			Value:  1,
+		},
+	}
+	gotMetrics := append(fakeProblemCounter.ListMetrics(), fakeProblemGauge.ListMetrics()...)
+	assert.ElementsMatch(t, expectedMetrics, gotMetrics,
+		"expected metrics: %+v, got: %+v", expectedMetrics, gotMetrics)
+}
+
+func TestSuppressed(t *testing.T) {
+	pmm, fakeProblemCounter, fakeProblemGauge := NewProblemMetricsManagerStub()
+	suppressed := true
+	pmm.SetSuppressor(func(problemType, reason string) bool {
+		return suppressed && reason == "ReasonFoo"
+	})
+
+	pmm.IncrementProblemCounter("ReasonFoo", 1)
+	pmm.IncrementProblemCounter("ReasonBar", 1)
+	pmm.SetProblemGauge("ProblemTypeA", "ReasonFoo", true)
+	// The gauge set while suppressed is cleared once the maintenance window ends.
+	suppressed = false
+	pmm.SetProblemGauge("ProblemTypeA", "ReasonFoo", false)
+
+	expectedMetrics := []metrics.Int64MetricRepresentation{
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "ReasonFoo", "suppressed": "true"},
+			Value:  1,
+		},
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "ReasonBar"},
+			Value:  1,
+		},
+		{
+			Name:   "problem_gauge",
+			Labels: map[string]string{"type": "ProblemTypeA", "reason": "ReasonFoo", "suppressed": "true"},
+			Value:  0,
+		},
+		{
+			Name:   "problem_gauge",
+			Labels: map[string]string{"type": "ProblemTypeA", "reason": "ReasonFoo"},
+			Value:  0,
+		},
+	}
+	gotMetrics := append(fakeProblemCounter.ListMetrics(), fakeProblemGauge.ListMetrics()...)
+	assert.ElementsMatch(t, expectedMetrics, gotMetrics,
+		"expected metrics: %+v, got: %+v", expectedMetrics, gotMetrics)
+}
+
+func TestSetExemplars(t *testing.T) {
+	pmm, fakeProblemCounter, _ := NewProblemMetricsManagerStub()
+	pmm.SetOwnership("TaskHung", types.Ownership{Team: "node"})
+	pmm.IncrementProblemCounter("TaskHung", 1)
+	pmm.IncrementProblemCounter("DockerHung", 1)
+
+	timestamp := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	spanContext := trace.SpanContext{TraceID: trace.TraceID{1, 2, 3}, SpanID: trace.SpanID{4, 5, 6}}
+	pmm.SetExemplars(&types.Status{
+		Source: "kernel-monitor",
+		Events: []types.Event{{Reason: "TaskHung", Timestamp: timestamp, Message: strings.Repeat("x", 200)}},
+		Conditions: []types.Condition{
+			{Type: "KernelDeadlock", Status: types.True, Severity: types.Critical, Reason: "DockerHung", Transition: timestamp, Message: "docker hung"},
+			{Type: "ReadonlyFilesystem", Status: types.False, Reason: "FilesystemIsNotReadOnly", Transition: timestamp},
+		},
+		Trace: spanContext,
+	})
+
+	expectedMetrics := []metrics.Int64MetricRepresentation{
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "TaskHung", "team": "node"},
+			Value:  1,
+			Exemplar: &metrics.Exemplar{
+				Value:      1,
+				Timestamp:  timestamp,
+				Trace:      spanContext,
+				Attributes: map[string]string{"source": "kernel-monitor", "message": strings.Repeat("x", maxExemplarMessageLength)},
+			},
+		},
+		{
+			Name:   "problem_counter",
+			Labels: map[string]string{"reason": "DockerHung"},
+			Value:  1,
+			Exemplar: &metrics.Exemplar{
+				Value:      1,
+				Timestamp:  timestamp,
+				Trace:      spanContext,
+				Attributes: map[string]string{"source": "kernel-monitor", "type": "KernelDeadlock", "status": "True", "severity": "critical", "message": "docker hung"},
+			},
+		},
+	}
+	assert.ElementsMatch(t, expectedMetrics, fakeProblemCounter.ListMetrics())
+}
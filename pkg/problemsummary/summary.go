@@ -0,0 +1,377 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package problemsummary rolls the conditions and events of all problem daemons up
+// into a few metrics meant for fleet SLO dashboards.
+package problemsummary
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+const (
+	defaultSeverity     = "warning"
+	defaultUpdatePeriod = 30 * time.Second
+)
+
+// clearedDurationBounds are the bucket bounds of the durations of the cleared problems
+// in seconds, from a minute to a week.
+var clearedDurationBounds = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400, 259200, 604800}
+
+// Class assigns a severity and a category to conditions.
+type Class struct {
+	// Conditions are the condition types in the class.
+	Conditions []string `json:"conditions"`
+	// Severity is the severity of the conditions. Default to the default severity.
+	Severity string `json:"severity"`
+	// Category is the category of the conditions. Default to the source of the condition.
+	Category string `json:"category"`
+}
+
+// Config is the configuration of the summarizer.
+type Config struct {
+	// Classes assign severities and categories to condition types. Conditions not in any
+	// class get the default severity, and the source of the condition as category.
+	Classes []*Class `json:"classes"`
+	// DefaultSeverity is the severity of conditions not in any class. Default to "warning".
+	DefaultSeverity string `json:"defaultSeverity"`
+	// UpdatePeriodString is the period at which the metrics are updated when no status
+	// is reported. Default to 30s.
+	UpdatePeriodString string        `json:"updatePeriod"`
+	UpdatePeriod       time.Duration `json:"-"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (c *Config) ApplyConfiguration() error {
+	if c.DefaultSeverity == "" {
+		c.DefaultSeverity = defaultSeverity
+	}
+	c.UpdatePeriod = defaultUpdatePeriod
+	if c.UpdatePeriodString != "" {
+		var err error
+		if c.UpdatePeriod, err = time.ParseDuration(c.UpdatePeriodString); err != nil {
+			return fmt.Errorf("invalid update period %q: %v", c.UpdatePeriodString, err)
+		}
+	}
+	for _, class := range c.Classes {
+		if class.Severity == "" {
+			class.Severity = c.DefaultSeverity
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (c *Config) Validate() error {
+	if c.UpdatePeriod <= 0 {
+		return fmt.Errorf("update period %v must be positive", c.UpdatePeriod)
+	}
+	classified := map[string]bool{}
+	for _, class := range c.Classes {
+		for _, condition := range class.Conditions {
+			if classified[condition] {
+				return fmt.Errorf("condition %q is in more than one class", condition)
+			}
+			classified[condition] = true
+		}
+	}
+	return nil
+}
+
+// activeKey is the labels of the active problem count.
+type activeKey struct {
+	severity string
+	category string
+}
+
+// Summarizer updates the summary metrics from the latest conditions of all sources.
+// It is not thread-safe.
+type Summarizer struct {
+	config Config
+	// classes is the class of each classified condition type.
+	classes map[string]*Class
+
+	activeCount    metrics.Int64MetricInterface
+	timeSinceLast  metrics.Int64MetricInterface
+	activeSeconds  metrics.Int64MetricInterface
+	recordedActive map[activeKey]bool
+	// activeDuration and clearedDuration are the durations of the active and the cleared
+	// problems of each condition type.
+	activeDuration   metrics.Int64MetricInterface
+	clearedDuration  distribution
+	recordedDuration map[string]bool
+
+	// lastProblem is the last time a problem was seen. It is zero when no problem has
+	// been seen since node-problem-detector started.
+	lastProblem time.Time
+	// accounted is the time until which each active condition has been added to the
+	// problem seconds, keyed by source and condition type.
+	accounted map[string]map[string]time.Time
+	// remainders are the fractions of a second not yet added to the problem seconds of
+	// each condition type.
+	remainders map[string]time.Duration
+	// since is the transition of each active condition, keyed by source and condition
+	// type.
+	since map[string]map[string]time.Time
+}
+
+// distribution is a metric aggregating the measurements into a histogram.
+type distribution interface {
+	Record(tags map[string]string, measurement float64) error
+}
+
+// NewSummarizer creates a summarizer from a config file.
+func NewSummarizer(configPath string) (*Summarizer, error) {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	var config Config
+	if err := util.UnmarshalStrict(f, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		return nil, fmt.Errorf("failed to apply configuration file %q: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate configuration file %q: %v", configPath, err)
+	}
+
+	s := newSummarizer(config)
+	s.activeCount, err = metrics.NewInt64Metric(
+		metrics.ProblemActiveCountID,
+		string(metrics.ProblemActiveCountID),
+		"Number of permanent problems affecting the node, by severity and category.",
+		"1",
+		metrics.LastValue,
+		[]string{"severity", "category"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.ProblemActiveCountID, err)
+	}
+	s.timeSinceLast, err = metrics.NewInt64Metric(
+		metrics.ProblemTimeSinceLastID,
+		string(metrics.ProblemTimeSinceLastID),
+		"Seconds since a problem last affected the node, 0 while a permanent problem is active.",
+		"s",
+		metrics.LastValue,
+		[]string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.ProblemTimeSinceLastID, err)
+	}
+	s.activeSeconds, err = metrics.NewInt64Metric(
+		metrics.ProblemActiveSecondsID,
+		string(metrics.ProblemActiveSecondsID),
+		"Cumulative seconds permanent problems of a condition type have affected the node.",
+		"s",
+		metrics.Sum,
+		[]string{"type"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.ProblemActiveSecondsID, err)
+	}
+	s.activeDuration, err = metrics.NewInt64Metric(
+		metrics.ProblemActiveDurationID,
+		string(metrics.ProblemActiveDurationID),
+		"Seconds since the permanent problem of a condition type became active, 0 while it is not.",
+		"s",
+		metrics.LastValue,
+		[]string{"type"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.ProblemActiveDurationID, err)
+	}
+	s.clearedDuration, err = metrics.NewFloat64DistributionMetric(
+		metrics.ProblemClearedDurationID,
+		string(metrics.ProblemClearedDurationID),
+		"Durations of the permanent problems of a condition type, recorded when they clear.",
+		"s",
+		clearedDurationBounds,
+		[]string{"type"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric: %v", metrics.ProblemClearedDurationID, err)
+	}
+	return s, nil
+}
+
+func newSummarizer(config Config) *Summarizer {
+	s := &Summarizer{
+		config:         config,
+		classes:        make(map[string]*Class),
+		recordedActive: make(map[activeKey]bool),
+		accounted:      make(map[string]map[string]time.Time),
+		remainders:     make(map[string]time.Duration),
+		since:          make(map[string]map[string]time.Time),
+
+		recordedDuration: make(map[string]bool),
+	}
+	for _, class := range config.Classes {
+		for _, condition := range class.Conditions {
+			s.classes[condition] = class
+		}
+	}
+	return s
+}
+
+// UpdatePeriod returns the period at which Update should be called when no status is
+// reported.
+func (s *Summarizer) UpdatePeriod() time.Duration {
+	return s.config.UpdatePeriod
+}
+
+// Update updates the summary metrics. The conditions are the latest conditions of all
+// sources, keyed by source and condition type. The events are the events reported since
+// the last update.
+func (s *Summarizer) Update(conditions map[string]map[string]types.Condition, events []types.Event, now time.Time) {
+	for _, event := range events {
+		if event.Severity.IsProblem() && event.Timestamp.After(s.lastProblem) {
+			s.lastProblem = event.Timestamp
+		}
+	}
+
+	active := map[activeKey]int64{}
+	durations := map[string]int64{}
+	for source, sourceConditions := range conditions {
+		accounted, ok := s.accounted[source]
+		if !ok {
+			accounted = make(map[string]time.Time)
+			s.accounted[source] = accounted
+		}
+		since, ok := s.since[source]
+		if !ok {
+			since = make(map[string]time.Time)
+			s.since[source] = since
+		}
+		for _, condition := range sourceConditions {
+			if condition.Status != types.True {
+				if start, ok := since[condition.Type]; ok {
+					s.recordCleared(condition.Type, condition.Transition.Sub(start))
+					delete(since, condition.Type)
+				}
+				if from, ok := accounted[condition.Type]; ok {
+					// The problem ended at the transition of the condition.
+					s.addActiveSeconds(condition.Type, condition.Transition.Sub(from))
+					if condition.Transition.After(s.lastProblem) {
+						s.lastProblem = condition.Transition
+					}
+					delete(accounted, condition.Type)
+				}
+				continue
+			}
+			active[s.classify(source, condition.Type)]++
+			since[condition.Type] = condition.Transition
+			// The longest active problem of the condition type of all sources.
+			d := int64(now.Sub(condition.Transition).Seconds())
+			if d < 0 {
+				d = 0
+			}
+			if last, ok := durations[condition.Type]; !ok || d > last {
+				durations[condition.Type] = d
+			}
+			from, ok := accounted[condition.Type]
+			if !ok || condition.Transition.After(from) {
+				from = condition.Transition
+			}
+			s.addActiveSeconds(condition.Type, now.Sub(from))
+			accounted[condition.Type] = now
+			s.lastProblem = now
+		}
+	}
+
+	s.recordActive(active)
+	s.recordDurations(durations)
+	if !s.lastProblem.IsZero() {
+		s.record(s.timeSinceLast, metrics.ProblemTimeSinceLastID, map[string]string{},
+			int64(now.Sub(s.lastProblem).Seconds()))
+	}
+}
+
+// classify returns the severity and category of a condition.
+func (s *Summarizer) classify(source, conditionType string) activeKey {
+	key := activeKey{severity: s.config.DefaultSeverity, category: source}
+	if class, ok := s.classes[conditionType]; ok {
+		key.severity = class.Severity
+		if class.Category != "" {
+			key.category = class.Category
+		}
+	}
+	return key
+}
+
+// recordActive records the active problem counts, and resets the counts of the
+// severities and categories without active problems any more.
+func (s *Summarizer) recordActive(active map[activeKey]int64) {
+	for key := range s.recordedActive {
+		if _, ok := active[key]; !ok {
+			active[key] = 0
+		}
+	}
+	for key, count := range active {
+		s.record(s.activeCount, metrics.ProblemActiveCountID,
+			map[string]string{"severity": key.severity, "category": key.category}, count)
+		s.recordedActive[key] = true
+	}
+}
+
+// recordDurations records the durations of the active problems, and resets the durations
+// of the condition types without active problems any more.
+func (s *Summarizer) recordDurations(durations map[string]int64) {
+	for conditionType := range s.recordedDuration {
+		if _, ok := durations[conditionType]; !ok {
+			durations[conditionType] = 0
+		}
+	}
+	for conditionType, seconds := range durations {
+		s.record(s.activeDuration, metrics.ProblemActiveDurationID, map[string]string{"type": conditionType}, seconds)
+		s.recordedDuration[conditionType] = true
+	}
+}
+
+// recordCleared records the duration of a cleared problem.
+func (s *Summarizer) recordCleared(conditionType string, d time.Duration) {
+	if d < 0 {
+		return
+	}
+	tags := map[string]string{"type": conditionType}
+	if err := s.clearedDuration.Record(tags, d.Seconds()); err != nil {
+		glog.Errorf("Failed to update %s metric with tags %v: %v", metrics.ProblemClearedDurationID, tags, err)
+	}
+}
+
+// addActiveSeconds adds the duration to the problem seconds of the condition type. The
+// fractions of a second are carried over to the next addition.
+func (s *Summarizer) addActiveSeconds(conditionType string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	d += s.remainders[conditionType]
+	seconds := int64(d / time.Second)
+	s.remainders[conditionType] = d - time.Duration(seconds)*time.Second
+	if seconds > 0 {
+		s.record(s.activeSeconds, metrics.ProblemActiveSecondsID, map[string]string{"type": conditionType}, seconds)
+	}
+}
+
+func (s *Summarizer) record(metric metrics.Int64MetricInterface, id metrics.MetricID, tags map[string]string, value int64) {
+	if err := metric.Record(tags, value); err != nil {
+		glog.Errorf("Failed to update %s metric with tags %v: %v", id, tags, err)
+	}
+}
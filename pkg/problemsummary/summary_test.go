@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package problemsummary
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+func TestConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   Config
+		expected Config
+		isError  bool
+	}{
+		{
+			name:   "defaults",
+			config: Config{Classes: []*Class{{Conditions: []string{"KernelDeadlock"}}}},
+			expected: Config{
+				Classes:         []*Class{{Conditions: []string{"KernelDeadlock"}, Severity: "warning"}},
+				DefaultSeverity: "warning",
+				UpdatePeriod:    30 * time.Second,
+			},
+		},
+		{
+			name:   "update period",
+			config: Config{DefaultSeverity: "critical", UpdatePeriodString: "1m"},
+			expected: Config{
+				DefaultSeverity:    "critical",
+				UpdatePeriodString: "1m",
+				UpdatePeriod:       time.Minute,
+			},
+		},
+		{
+			name:    "invalid update period",
+			config:  Config{UpdatePeriodString: "1"},
+			isError: true,
+		},
+		{
+			name:    "negative update period",
+			config:  Config{UpdatePeriodString: "-1s"},
+			isError: true,
+		},
+		{
+			name: "condition in two classes",
+			config: Config{Classes: []*Class{
+				{Conditions: []string{"KernelDeadlock"}},
+				{Conditions: []string{"ReadonlyFilesystem", "KernelDeadlock"}},
+			}},
+			isError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.isError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, test.config)
+		})
+	}
+}
+
+func newFakeSummarizer(config Config) (*Summarizer, *metrics.FakeInt64Metric, *metrics.FakeInt64Metric, *metrics.FakeInt64Metric) {
+	config.ApplyConfiguration()
+	s := newSummarizer(config)
+	activeCount := metrics.NewFakeInt64Metric("active_count", metrics.LastValue, []string{"severity", "category"})
+	timeSinceLast := metrics.NewFakeInt64Metric("time_since_last", metrics.LastValue, []string{})
+	activeSeconds := metrics.NewFakeInt64Metric("active_seconds", metrics.Sum, []string{"type"})
+	s.activeCount = activeCount
+	s.timeSinceLast = timeSinceLast
+	s.activeSeconds = activeSeconds
+	s.activeDuration = metrics.NewFakeInt64Metric("active_duration", metrics.LastValue, []string{"type"})
+	s.clearedDuration = &fakeDistribution{}
+	return s, activeCount, timeSinceLast, activeSeconds
+}
+
+// fakeDistribution records the measurements of each condition type.
+type fakeDistribution struct {
+	measurements map[string][]float64
+}
+
+func (f *fakeDistribution) Record(tags map[string]string, measurement float64) error {
+	if f.measurements == nil {
+		f.measurements = map[string][]float64{}
+	}
+	f.measurements[tags["type"]] = append(f.measurements[tags["type"]], measurement)
+	return nil
+}
+
+func TestUpdate(t *testing.T) {
+	s, activeCount, timeSinceLast, activeSeconds := newFakeSummarizer(Config{
+		Classes: []*Class{{Conditions: []string{"KernelDeadlock"}, Severity: "critical", Category: "kernel"}},
+	})
+	start := time.Now()
+	condition := func(conditionType string, status types.ConditionStatus, transition time.Duration) types.Condition {
+		return types.Condition{Type: conditionType, Status: status, Transition: start.Add(transition)}
+	}
+
+	// No problem seen yet.
+	s.Update(map[string]map[string]types.Condition{
+		"kernel-monitor": {"KernelDeadlock": condition("KernelDeadlock", types.False, 0)},
+	}, nil, start)
+	assert.Empty(t, activeCount.ListMetrics())
+	assert.Empty(t, timeSinceLast.ListMetrics())
+	assert.Empty(t, activeSeconds.ListMetrics())
+
+	// Two problems become active.
+	conditions := map[string]map[string]types.Condition{
+		"kernel-monitor": {"KernelDeadlock": condition("KernelDeadlock", types.True, 10*time.Second)},
+		"docker-monitor": {"CorruptDockerOverlay2": condition("CorruptDockerOverlay2", types.True, 20*time.Second)},
+	}
+	s.Update(conditions, nil, start.Add(30*time.Second))
+	assert.ElementsMatch(t, []metrics.Int64MetricRepresentation{
+		{Name: "active_count", Labels: map[string]string{"severity": "critical", "category": "kernel"}, Value: 1},
+		{Name: "active_count", Labels: map[string]string{"severity": "warning", "category": "docker-monitor"}, Value: 1},
+	}, activeCount.ListMetrics())
+	assert.Equal(t, []metrics.Int64MetricRepresentation{
+		{Name: "time_since_last", Labels: map[string]string{}, Value: 0},
+	}, timeSinceLast.ListMetrics())
+	assert.ElementsMatch(t, []metrics.Int64MetricRepresentation{
+		{Name: "active_seconds", Labels: map[string]string{"type": "KernelDeadlock"}, Value: 20},
+		{Name: "active_seconds", Labels: map[string]string{"type": "CorruptDockerOverlay2"}, Value: 10},
+	}, activeSeconds.ListMetrics())
+
+	// The kernel deadlock clears, a warning event comes later.
+	conditions["kernel-monitor"]["KernelDeadlock"] = condition("KernelDeadlock", types.False, 40*time.Second)
+	conditions["docker-monitor"]["CorruptDockerOverlay2"] = condition("CorruptDockerOverlay2", types.False, 50*time.Second)
+	s.Update(conditions, []types.Event{{Severity: types.Warn, Timestamp: start.Add(55 * time.Second)}}, start.Add(60*time.Second))
+	assert.ElementsMatch(t, []metrics.Int64MetricRepresentation{
+		{Name: "active_count", Labels: map[string]string{"severity": "critical", "category": "kernel"}, Value: 0},
+		{Name: "active_count", Labels: map[string]string{"severity": "warning", "category": "docker-monitor"}, Value: 0},
+	}, activeCount.ListMetrics())
+	assert.Equal(t, []metrics.Int64MetricRepresentation{
+		{Name: "time_since_last", Labels: map[string]string{}, Value: 5},
+	}, timeSinceLast.ListMetrics())
+	assert.ElementsMatch(t, []metrics.Int64MetricRepresentation{
+		{Name: "active_seconds", Labels: map[string]string{"type": "KernelDeadlock"}, Value: 30},
+		{Name: "active_seconds", Labels: map[string]string{"type": "CorruptDockerOverlay2"}, Value: 30},
+	}, activeSeconds.ListMetrics())
+
+	// Info events are not problems.
+	s.Update(conditions, []types.Event{{Severity: types.Info, Timestamp: start.Add(90 * time.Second)}}, start.Add(100*time.Second))
+	assert.Equal(t, []metrics.Int64MetricRepresentation{
+		{Name: "time_since_last", Labels: map[string]string{}, Value: 45},
+	}, timeSinceLast.ListMetrics())
+}
+
+func TestAddActiveSecondsCarriesFractions(t *testing.T) {
+	s, _, _, activeSeconds := newFakeSummarizer(Config{})
+	for i := 0; i < 4; i++ {
+		s.addActiveSeconds("KernelDeadlock", 600*time.Millisecond)
+	}
+	assert.Equal(t, []metrics.Int64MetricRepresentation{
+		{Name: "active_seconds", Labels: map[string]string{"type": "KernelDeadlock"}, Value: 2},
+	}, activeSeconds.ListMetrics())
+}
+
+func TestConditionDurations(t *testing.T) {
+	s, _, _, _ := newFakeSummarizer(Config{})
+	activeDuration := s.activeDuration.(*metrics.FakeInt64Metric)
+	clearedDuration := s.clearedDuration.(*fakeDistribution)
+	start := time.Now()
+	condition := func(conditionType string, status types.ConditionStatus, transition time.Duration) types.Condition {
+		return types.Condition{Type: conditionType, Status: status, Transition: start.Add(transition)}
+	}
+
+	// The same condition type is active in two sources, the longest one is recorded.
+	conditions := map[string]map[string]types.Condition{
+		"kernel-monitor":  {"KernelDeadlock": condition("KernelDeadlock", types.True, 0)},
+		"abrt-monitor":    {"KernelDeadlock": condition("KernelDeadlock", types.True, 30*time.Second)},
+		"docker-monitor":  {"CorruptDockerOverlay2": condition("CorruptDockerOverlay2", types.False, 0)},
+		"custom-monitors": {},
+	}
+	s.Update(conditions, nil, start.Add(90*time.Second))
+	assert.Equal(t, []metrics.Int64MetricRepresentation{
+		{Name: "active_duration", Labels: map[string]string{"type": "KernelDeadlock"}, Value: 90},
+	}, activeDuration.ListMetrics())
+	assert.Empty(t, clearedDuration.measurements)
+
+	// The duration of each cleared problem is recorded once.
+	conditions["kernel-monitor"]["KernelDeadlock"] = condition("KernelDeadlock", types.False, 120*time.Second)
+	s.Update(conditions, nil, start.Add(150*time.Second))
+	s.Update(conditions, nil, start.Add(180*time.Second))
+	assert.Equal(t, map[string][]float64{"KernelDeadlock": {120}}, clearedDuration.measurements)
+	assert.Equal(t, []metrics.Int64MetricRepresentation{
+		{Name: "active_duration", Labels: map[string]string{"type": "KernelDeadlock"}, Value: 150},
+	}, activeDuration.ListMetrics())
+
+	// The duration is reset once no problem of the condition type is active.
+	conditions["abrt-monitor"]["KernelDeadlock"] = condition("KernelDeadlock", types.False, 200*time.Second)
+	s.Update(conditions, nil, start.Add(210*time.Second))
+	assert.Equal(t, map[string][]float64{"KernelDeadlock": {120, 170}}, clearedDuration.measurements)
+	assert.Equal(t, []metrics.Int64MetricRepresentation{
+		{Name: "active_duration", Labels: map[string]string{"type": "KernelDeadlock"}, Value: 0},
+	}, activeDuration.ListMetrics())
+}
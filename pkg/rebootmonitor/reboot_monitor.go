@@ -0,0 +1,315 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rebootmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	rtypes "k8s.io/node-problem-detector/pkg/rebootmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const RebootMonitorName = "reboot-monitor"
+
+const (
+	healthyReason          = "NoFrequentUnexpectedReboot"
+	healthyMessage         = "node is not rebooting unexpectedly frequently"
+	frequentRebootReason   = "FrequentUnexpectedReboot"
+	unexpectedRebootReason = "UnexpectedReboot"
+
+	// downtimeAnnotation is the event annotation carrying the downtime of the node.
+	downtimeAnnotation = "downtime"
+)
+
+func init() {
+	problemdaemon.Register(RebootMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewRebootMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type rebootMonitor struct {
+	configPath string
+	config     rtypes.RebootConfig
+	// bootTime returns the time the node booted.
+	bootTime func() (time.Time, error)
+	// state is the persisted state, nil if the current boot could not be recorded.
+	state      *state
+	condition  types.Condition
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewRebootMonitorOrDie creates a reboot monitor, panics if error occurs.
+func NewRebootMonitorOrDie(configPath string) types.Monitor {
+	rm := rebootMonitor{
+		configPath: configPath,
+		bootTime:   util.GetBootTime,
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &rm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = rm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = rm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, rm.config, err)
+	}
+
+	// A 1000 size channel should be big enough.
+	rm.statusChan = make(chan *types.Status, 1000)
+
+	if *rm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(rm.config.ConditionType)
+	}
+	return &rm
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for all problems and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, frequentRebootReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			conditionType, frequentRebootReason, err)
+	}
+	for _, reason := range []string{unexpectedRebootReason, frequentRebootReason} {
+		err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+		}
+	}
+}
+
+func (rm *rebootMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start reboot monitor %s", rm.configPath)
+	problemdaemon.Go(rm, rm.monitorLoop)
+	return rm.statusChan, nil
+}
+
+func (rm *rebootMonitor) Stop() {
+	glog.Infof("Stop reboot monitor %s", rm.configPath)
+	rm.tomb.Stop()
+}
+
+func (rm *rebootMonitor) monitorLoop() {
+	defer rm.tomb.Done()
+
+	runTicker := time.NewTicker(rm.config.CheckInterval)
+	defer runTicker.Stop()
+
+	rm.initializeStatus()
+	if event := rm.recordBoot(time.Now()); event != nil {
+		rm.statusChan <- &types.Status{
+			Source: rm.config.Source,
+			Events: []types.Event{*event},
+		}
+	}
+	if status := rm.check(time.Now()); status != nil {
+		rm.statusChan <- status
+	}
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := rm.check(now); status != nil {
+				rm.statusChan <- status
+			}
+		case <-rm.tomb.Stopping():
+			glog.Infof("Reboot monitor stopped: %s", rm.configPath)
+			return
+		}
+	}
+}
+
+func (rm *rebootMonitor) initializeStatus() {
+	rm.condition = types.Condition{
+		Type:       rm.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     healthyReason,
+		Message:    healthyMessage,
+	}
+	rm.statusChan <- &types.Status{
+		Source:     rm.config.Source,
+		Conditions: []types.Condition{rm.condition},
+	}
+}
+
+// recordBoot records the current boot if it is not recorded yet, and returns an event if
+// the node rebooted unexpectedly. A reboot is unexpected when wtmp has no shutdown record
+// since the previous boot. The downtime is measured from the last time the node was
+// recorded as up during the previous boot. When there is no previous boot record, or wtmp
+// cannot be read, the reboot is not classified.
+func (rm *rebootMonitor) recordBoot(now time.Time) *types.Event {
+	s := &state{}
+	if err := util.LoadState(rm.config.StatePath, s); err != nil {
+		glog.Errorf("Failed to load boot records from %q, start over: %v", rm.config.StatePath, err)
+		s = &state{}
+	}
+	bootID, err := util.ReadBootID(rm.config.BootIDPath)
+	if err != nil {
+		glog.Errorf("Failed to read boot id: %v", err)
+		return nil
+	}
+	bootTime, err := rm.bootTime()
+	if err != nil {
+		glog.Errorf("Failed to get boot time: %v", err)
+		return nil
+	}
+	rm.state = s
+	if s.BootID == bootID {
+		// Node problem detector restarted, the boot is already recorded.
+		return nil
+	}
+
+	previous := *s
+	s.BootID, s.BootTime, s.LastSeen = bootID, bootTime, now
+	var event *types.Event
+	if previous.BootID != "" {
+		event = rm.classifyReboot(previous, bootTime)
+	}
+	if event != nil {
+		s.UnexpectedReboots = append(s.UnexpectedReboots, bootTime)
+	}
+	if err := util.SaveState(rm.config.StatePath, s); err != nil {
+		glog.Errorf("Failed to save boot records to %q: %v", rm.config.StatePath, err)
+	}
+	glog.Infof("Recorded boot %q at %v", bootID, bootTime)
+
+	if event == nil {
+		return nil
+	}
+	if *rm.config.EnableMetricsReporting {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(unexpectedRebootReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", unexpectedRebootReason, err)
+		}
+	}
+	return event
+}
+
+// classifyReboot returns an event if the previous boot did not end with a graceful
+// shutdown.
+func (rm *rebootMonitor) classifyReboot(previous state, bootTime time.Time) *types.Event {
+	shutdowns, err := readShutdowns(rm.config.WtmpPath)
+	if err != nil {
+		glog.Warningf("Failed to read shutdown records, the reboot is not classified: %v", err)
+		return nil
+	}
+	for _, shutdown := range shutdowns {
+		if !shutdown.Before(previous.BootTime) && shutdown.Before(bootTime) {
+			glog.Infof("The previous boot %q was shut down gracefully at %v", previous.BootID, shutdown)
+			return nil
+		}
+	}
+
+	lastSeen := previous.LastSeen
+	if lastSeen.IsZero() {
+		lastSeen = previous.BootTime
+	}
+	downtime := bootTime.Sub(lastSeen)
+	if downtime < 0 {
+		downtime = 0
+	}
+	downtime = downtime.Round(time.Second)
+	return &types.Event{
+		Severity:  types.Warn,
+		Timestamp: bootTime,
+		Reason:    unexpectedRebootReason,
+		Message: fmt.Sprintf("Node rebooted unexpectedly, it was last seen up at %s and down for about %v",
+			lastSeen.UTC().Format(time.RFC3339), downtime),
+		Annotations: map[string]string{downtimeAnnotation: downtime.String()},
+	}
+}
+
+// check records the node as up, forgets the unexpected reboots aging out of the window,
+// and returns a new status if the condition changes. The condition is set when there are
+// at least RebootThreshold unexpected reboots in the reboot window.
+func (rm *rebootMonitor) check(now time.Time) *types.Status {
+	if rm.state == nil {
+		return nil
+	}
+	reboots := rm.state.UnexpectedReboots[:0]
+	for _, reboot := range rm.state.UnexpectedReboots {
+		if now.Sub(reboot) <= rm.config.RebootWindow {
+			reboots = append(reboots, reboot)
+		}
+	}
+	rm.state.UnexpectedReboots = reboots
+	rm.state.LastSeen = now
+	if err := util.SaveState(rm.config.StatePath, rm.state); err != nil {
+		glog.Errorf("Failed to save boot records to %q: %v", rm.config.StatePath, err)
+	}
+
+	status, reason, message := types.False, healthyReason, healthyMessage
+	if len(reboots) >= *rm.config.RebootThreshold {
+		status, reason = types.True, frequentRebootReason
+		message = fmt.Sprintf("Node rebooted unexpectedly %d times in %v, latest at %s",
+			len(reboots), rm.config.RebootWindow, reboots[len(reboots)-1].UTC().Format(time.RFC3339))
+	}
+	if rm.condition.Status == status && rm.condition.Message == message {
+		return nil
+	}
+
+	var events []types.Event
+	if rm.condition.Status != status {
+		rm.condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(rm.condition.Type, status, reason, now))
+		if *rm.config.EnableMetricsReporting {
+			rm.updateProblemMetrics(status == types.True)
+		}
+	}
+	rm.condition.Status = status
+	rm.condition.Reason = reason
+	rm.condition.Message = message
+	return &types.Status{
+		Source:     rm.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{rm.condition},
+	}
+}
+
+func (rm *rebootMonitor) updateProblemMetrics(active bool) {
+	if active {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(frequentRebootReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", frequentRebootReason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(rm.config.ConditionType, frequentRebootReason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			rm.config.ConditionType, frequentRebootReason, err)
+	}
+}
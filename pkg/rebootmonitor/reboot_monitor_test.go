@@ -0,0 +1,182 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rebootmonitor
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	rtypes "k8s.io/node-problem-detector/pkg/rebootmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(RebootMonitorName) },
+		"Reboot monitor failed to register itself as a problem daemon.")
+}
+
+// testNode simulates the boots of a node.
+type testNode struct {
+	t        *testing.T
+	dir      string
+	bootTime time.Time
+	// noWtmp is whether the node keeps no login records.
+	noWtmp bool
+}
+
+func newTestNode(t *testing.T) *testNode {
+	dir, err := ioutil.TempDir("", "reboot")
+	assert.NoError(t, err)
+	return &testNode{t: t, dir: dir}
+}
+
+// record appends a login record to wtmp.
+func (n *testNode) record(recordType int16, user string, at time.Time) {
+	if n.noWtmp {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(n.dir, "wtmp"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	assert.NoError(n.t, err)
+	defer f.Close()
+	r := utmpRecord{Type: recordType, Sec: int32(at.Unix())}
+	copy(r.User[:], user)
+	assert.NoError(n.t, binary.Write(f, binary.LittleEndian, &r))
+}
+
+func (n *testNode) shutdown(at time.Time) {
+	n.record(runLevel, shutdownUser, at)
+}
+
+// boot boots the node, and starts a reboot monitor, which records the boot.
+func (n *testNode) boot(bootID string, bootTime time.Time) (*rebootMonitor, *types.Event) {
+	assert.NoError(n.t, ioutil.WriteFile(filepath.Join(n.dir, "boot_id"), []byte(bootID+"\n"), 0644))
+	// The boot record of wtmp is not a shutdown record.
+	n.record(2, "reboot", bootTime)
+	n.bootTime = bootTime
+	disabled := false
+	threshold := 2
+	rm := &rebootMonitor{
+		config: rtypes.RebootConfig{
+			StatePath:              filepath.Join(n.dir, "state", "reboot-records.json"),
+			BootIDPath:             filepath.Join(n.dir, "boot_id"),
+			WtmpPath:               filepath.Join(n.dir, "wtmp"),
+			RebootWindowString:     "1h",
+			RebootThreshold:        &threshold,
+			EnableMetricsReporting: &disabled,
+		},
+		bootTime:   func() (time.Time, error) { return n.bootTime, nil },
+		statusChan: make(chan *types.Status, 1000),
+	}
+	assert.NoError(n.t, rm.config.ApplyConfiguration())
+	assert.NoError(n.t, rm.config.Validate())
+	rm.initializeStatus()
+	<-rm.statusChan
+	return rm, rm.recordBoot(bootTime.Add(time.Minute))
+}
+
+func TestUnexpectedReboot(t *testing.T) {
+	n := newTestNode(t)
+	defer os.RemoveAll(n.dir)
+	start := time.Unix(1600000000, 0)
+
+	// The first boot recorded is not classified.
+	rm, event := n.boot("boot-1", start)
+	assert.Nil(t, event)
+	assert.Nil(t, rm.check(start.Add(2*time.Minute)))
+
+	// A reboot after a graceful shutdown is expected.
+	n.shutdown(start.Add(3 * time.Minute))
+	rm, event = n.boot("boot-2", start.Add(5*time.Minute))
+	assert.Nil(t, event)
+	assert.Nil(t, rm.check(start.Add(10*time.Minute)))
+
+	// A reboot without a shutdown is unexpected, and the downtime is measured from the
+	// last time the node was seen up.
+	rm, event = n.boot("boot-3", start.Add(20*time.Minute))
+	assert.NotNil(t, event)
+	assert.Equal(t, "UnexpectedReboot", event.Reason)
+	assert.Equal(t, types.Warn, event.Severity)
+	assert.Equal(t, "Node rebooted unexpectedly, it was last seen up at 2020-09-13T12:36:40Z and down for about 10m0s", event.Message)
+	assert.Equal(t, map[string]string{"downtime": "10m0s"}, event.Annotations)
+	assert.Nil(t, rm.check(start.Add(21*time.Minute)))
+
+	// A restart of node problem detector does not record the boot again.
+	rm, event = n.boot("boot-3", start.Add(20*time.Minute))
+	assert.Nil(t, event)
+
+	// Recurring unexpected reboots set the condition.
+	rm, event = n.boot("boot-4", start.Add(30*time.Minute))
+	assert.NotNil(t, event)
+	assert.Equal(t, "Node rebooted unexpectedly, it was last seen up at 2020-09-13T12:47:40Z and down for about 9m0s", event.Message)
+	status := rm.check(start.Add(31 * time.Minute))
+	assert.NotNil(t, status)
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+	assert.Equal(t, "FrequentUnexpectedReboot", status.Conditions[0].Reason)
+	assert.Equal(t, "Node rebooted unexpectedly 2 times in 1h0m0s, latest at 2020-09-13T12:56:40Z", status.Conditions[0].Message)
+	assert.Len(t, status.Events, 1)
+
+	// The condition is cleared when the unexpected reboots age out of the window.
+	status = rm.check(start.Add(85 * time.Minute))
+	assert.NotNil(t, status)
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+	assert.Equal(t, "NoFrequentUnexpectedReboot", status.Conditions[0].Reason)
+}
+
+func TestUnclassifiedReboot(t *testing.T) {
+	n := newTestNode(t)
+	defer os.RemoveAll(n.dir)
+	start := time.Unix(1600000000, 0)
+
+	n.boot("boot-1", start)
+	// Without wtmp, graceful shutdowns cannot be told apart.
+	assert.NoError(t, os.Remove(filepath.Join(n.dir, "wtmp")))
+	n.noWtmp = true
+	_, event := n.boot("boot-2", start.Add(10*time.Minute))
+	assert.Nil(t, event)
+}
+
+func TestReadShutdowns(t *testing.T) {
+	n := newTestNode(t)
+	defer os.RemoveAll(n.dir)
+	first := time.Unix(1600000000, 0)
+	second := first.Add(time.Hour)
+
+	n.record(2, "reboot", first.Add(-time.Hour))
+	n.shutdown(first)
+	n.record(runLevel, "runlevel", first.Add(time.Minute))
+	n.shutdown(second)
+	// A partially written record is ignored.
+	f, err := os.OpenFile(filepath.Join(n.dir, "wtmp"), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{1, 0, 0})
+	assert.NoError(t, err)
+	f.Close()
+
+	shutdowns, err := readShutdowns(filepath.Join(n.dir, "wtmp"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(shutdowns))
+	assert.True(t, shutdowns[0].Equal(first))
+	assert.True(t, shutdowns[1].Equal(second))
+}
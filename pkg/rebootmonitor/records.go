@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rebootmonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+)
+
+// state is the state of the reboot monitor persisted across boots.
+type state struct {
+	// BootID is the id of the latest boot recorded.
+	BootID   string    `json:"bootID"`
+	BootTime time.Time `json:"bootTime"`
+	// LastSeen is the latest time the node was recorded as up during the boot.
+	LastSeen time.Time `json:"lastSeen"`
+	// UnexpectedReboots are the boot times of the unexpected reboots in the reboot
+	// window, oldest first.
+	UnexpectedReboots []time.Time `json:"unexpectedReboots,omitempty"`
+}
+
+const (
+	// runLevel is the type of the utmp records written on runlevel changes, including
+	// shutdowns.
+	runLevel = 1
+	// shutdownUser is the user of the runlevel records written on shutdowns.
+	shutdownUser = "shutdown"
+)
+
+// utmpRecord is a login record as written to wtmp by glibc on Linux. The time is 32 bits
+// on both 32 and 64 bits platforms.
+type utmpRecord struct {
+	Type    int16
+	_       [2]byte
+	Pid     int32
+	Line    [32]byte
+	ID      [4]byte
+	User    [32]byte
+	Host    [256]byte
+	Exit    [2]int16
+	Session int32
+	Sec     int32
+	Usec    int32
+	Addr    [4]int32
+	_       [20]byte
+}
+
+// readShutdowns returns the times of the graceful shutdowns recorded in the wtmp file,
+// oldest first.
+func readShutdowns(path string) ([]time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var shutdowns []time.Time
+	for {
+		var r utmpRecord
+		err := binary.Read(f, binary.LittleEndian, &r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// A partially written record is ignored.
+			return shutdowns, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		user := string(bytes.TrimRight(r.User[:], "\x00"))
+		if r.Type == runLevel && user == shutdownUser {
+			shutdowns = append(shutdowns, time.Unix(int64(r.Sec), int64(r.Usec)*int64(time.Microsecond)))
+		}
+	}
+}
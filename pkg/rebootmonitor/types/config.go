@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	defaultSource              = "reboot-monitor"
+	defaultConditionType       = "FrequentUnexpectedReboot"
+	defaultStatePath           = "/var/lib/node-problem-detector/reboot-records.json"
+	defaultBootIDPath          = "/proc/sys/kernel/random/boot_id"
+	defaultWtmpPath            = "/var/log/wtmp"
+	defaultCheckIntervalString = time.Minute.String()
+	defaultRebootWindowString  = (24 * time.Hour).String()
+	defaultRebootThreshold     = 3
+	defaultEnableMetrics       = true
+)
+
+type RebootConfig struct {
+	// Source is the source name of the reboot monitor.
+	Source string `json:"source"`
+	// ConditionType is the type of the condition set when the node reboots unexpectedly
+	// too often.
+	ConditionType string `json:"conditionType"`
+	// StatePath is the file the boot records are persisted to. It must be on the host, so
+	// that it survives reboots.
+	StatePath string `json:"statePath"`
+	// BootIDPath is the file with the unique id of the current boot.
+	BootIDPath string `json:"bootIDPath"`
+	// WtmpPath is the login records file, which has a shutdown record for every graceful
+	// shutdown.
+	WtmpPath string `json:"wtmpPath"`
+	// CheckIntervalString is the interval at which the node is recorded as up, and the
+	// unexpected reboots aging out of the window are checked.
+	CheckIntervalString string        `json:"checkInterval"`
+	CheckInterval       time.Duration `json:"-"`
+	// RebootWindowString is the window in which RebootThreshold unexpected reboots set
+	// the condition.
+	RebootWindowString string        `json:"rebootWindow"`
+	RebootWindow       time.Duration `json:"-"`
+	// RebootThreshold is the number of unexpected reboots in the reboot window setting the
+	// condition.
+	RebootThreshold *int `json:"rebootThreshold,omitempty"`
+	// EnableMetricsReporting describes whether to count the unexpected reboots and report
+	// the FrequentUnexpectedReboot condition as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (rc *RebootConfig) ApplyConfiguration() error {
+	if rc.Source == "" {
+		rc.Source = defaultSource
+	}
+	if rc.ConditionType == "" {
+		rc.ConditionType = defaultConditionType
+	}
+	if rc.StatePath == "" {
+		rc.StatePath = defaultStatePath
+	}
+	if rc.BootIDPath == "" {
+		rc.BootIDPath = defaultBootIDPath
+	}
+	if rc.WtmpPath == "" {
+		rc.WtmpPath = defaultWtmpPath
+	}
+	if rc.CheckIntervalString == "" {
+		rc.CheckIntervalString = defaultCheckIntervalString
+	}
+	if rc.RebootWindowString == "" {
+		rc.RebootWindowString = defaultRebootWindowString
+	}
+	if rc.RebootThreshold == nil {
+		rc.RebootThreshold = &defaultRebootThreshold
+	}
+	if rc.EnableMetricsReporting == nil {
+		rc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	rc.CheckInterval, err = time.ParseDuration(rc.CheckIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing CheckIntervalString %q: %v", rc.CheckIntervalString, err)
+	}
+	rc.RebootWindow, err = time.ParseDuration(rc.RebootWindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing RebootWindowString %q: %v", rc.RebootWindowString, err)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (rc *RebootConfig) Validate() error {
+	if rc.CheckInterval <= time.Duration(0) {
+		return fmt.Errorf("CheckInterval %v must be above 0s", rc.CheckInterval)
+	}
+	if rc.RebootWindow <= time.Duration(0) {
+		return fmt.Errorf("RebootWindow %v must be above 0s", rc.RebootWindow)
+	}
+	if *rc.RebootThreshold < 1 {
+		return fmt.Errorf("RebootThreshold %d must be at least 1", *rc.RebootThreshold)
+	}
+	return nil
+}
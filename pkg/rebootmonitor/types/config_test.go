@@ -0,0 +1,75 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	zero := 0
+	one := 1
+	testCases := []struct {
+		name      string
+		config    RebootConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: RebootConfig{},
+		},
+		{
+			name:   "custom threshold",
+			config: RebootConfig{RebootWindowString: "1h", RebootThreshold: &one},
+		},
+		{
+			name:      "invalid check interval",
+			config:    RebootConfig{CheckIntervalString: "one minute"},
+			expectErr: true,
+		},
+		{
+			name:      "zero check interval",
+			config:    RebootConfig{CheckIntervalString: "0s"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid reboot window",
+			config:    RebootConfig{RebootWindowString: "-1h"},
+			expectErr: true,
+		},
+		{
+			name:      "zero reboot threshold",
+			config:    RebootConfig{RebootThreshold: &zero},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
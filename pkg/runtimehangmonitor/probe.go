@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtimehangmonitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/node-problem-detector/pkg/util/cri"
+)
+
+// runtimeServices are the CRI runtime services by API version, newest first.
+var runtimeServices = []string{"runtime.v1.RuntimeService", "runtime.v1alpha2.RuntimeService"}
+
+// probedMethods are the methods of the runtime service called by each probe. Version is
+// served by the CRI shim alone, while Status reaches into the runtime, so that hangs of
+// both are caught.
+var probedMethods = []string{"Version", "Status"}
+
+// prober calls the CRI runtime service of an endpoint.
+type prober struct {
+	endpoint cri.Endpoint
+	timeout  time.Duration
+	// service is the runtime service served by the endpoint, found by the first call.
+	service string
+}
+
+// probe calls each probed method with the timeout, and returns the descriptions of the
+// calls which timed out. Calls failing otherwise, e.g. because the runtime is down, are
+// not timeouts: they are left to the health checker.
+func (p *prober) probe() []string {
+	var timeouts []string
+	for _, method := range probedMethods {
+		start := time.Now()
+		err := p.call(method)
+		if err == nil {
+			continue
+		}
+		if status.Code(err) == codes.DeadlineExceeded {
+			timeouts = append(timeouts, fmt.Sprintf("%s timed out after %v", method, time.Since(start).Round(time.Millisecond)))
+			continue
+		}
+		glog.Errorf("Failed to call CRI %s of %s: %v", method, p.endpoint, err)
+	}
+	return timeouts
+}
+
+// call calls the method of the runtime service. Requests are empty, and responses are
+// discarded, so that the CRI API is spoken without its generated code.
+func (p *prober) call(method string) error {
+	services := runtimeServices
+	if p.service != "" {
+		services = []string{p.service}
+	}
+	var err error
+	for _, service := range services {
+		if err = p.invoke(service, method); status.Code(err) != codes.Unimplemented {
+			if err == nil {
+				p.service = service
+			}
+			return err
+		}
+	}
+	return err
+}
+
+func (p *prober) invoke(service, method string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	// The dial does not block, so that a runtime which is down fails the call right away
+	// rather than timing out.
+	conn, err := grpc.DialContext(ctx, p.endpoint.Address, grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, p.endpoint.Protocol, address)
+		}))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Invoke(ctx, "/"+service+"/"+method, &empty.Empty{}, &empty.Empty{})
+}
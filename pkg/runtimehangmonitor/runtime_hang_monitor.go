@@ -0,0 +1,232 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtimehangmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	rhmtypes "k8s.io/node-problem-detector/pkg/runtimehangmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/cri"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const RuntimeHangMonitorName = "runtime-hang-monitor"
+
+const (
+	responsiveReason   = "RuntimeIsResponsive"
+	responsiveMessage  = "container runtime responds to CRI calls"
+	unresponsiveReason = "RuntimeCallsTimingOut"
+
+	// detectTimeout is the timeout of detecting the CRI endpoint.
+	detectTimeout = time.Second
+)
+
+func init() {
+	problemdaemon.Register(RuntimeHangMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewRuntimeHangMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type runtimeHangMonitor struct {
+	configPath string
+	config     rhmtypes.RuntimeHangConfig
+	// probe probes the runtime, and returns the descriptions of the CRI calls which
+	// timed out.
+	probe func() []string
+	// timeouts are the times of the timeouts in the window, oldest first.
+	timeouts []time.Time
+	// lastTimeout describes the last timeout.
+	lastTimeout string
+	condition   types.Condition
+	statusChan  chan *types.Status
+	tomb        *tomb.Tomb
+}
+
+// NewRuntimeHangMonitorOrDie creates a runtime hang monitor, panics if error occurs.
+func NewRuntimeHangMonitorOrDie(configPath string) types.Monitor {
+	rhm := runtimeHangMonitor{
+		configPath: configPath,
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &rhm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = rhm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = rhm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, rhm.config, err)
+	}
+
+	p := &prober{endpoint: rhm.config.ParsedEndpoint, timeout: rhm.config.Timeout}
+	rhm.probe = func() []string {
+		if p.endpoint.Address == "" {
+			e, err := cri.DetectEndpoint(detectTimeout)
+			if err != nil {
+				glog.Errorf("Failed to detect CRI endpoint, skip probing the runtime: %v", err)
+				return nil
+			}
+			glog.Infof("Probe the runtime at detected CRI endpoint %s", e)
+			p.endpoint = e
+		}
+		return p.probe()
+	}
+
+	// A 1000 size channel should be big enough.
+	rhm.statusChan = make(chan *types.Status, 1000)
+
+	if *rhm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(rhm.config.ConditionType)
+	}
+	return &rhm
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for the condition and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(conditionType string) {
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(conditionType, unresponsiveReason, false)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+			conditionType, unresponsiveReason, err)
+	}
+	err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(unresponsiveReason, 0)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", unresponsiveReason, err)
+	}
+}
+
+func (rhm *runtimeHangMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start runtime hang monitor %s", rhm.configPath)
+	problemdaemon.Go(rhm, rhm.monitorLoop)
+	return rhm.statusChan, nil
+}
+
+func (rhm *runtimeHangMonitor) Stop() {
+	glog.Infof("Stop runtime hang monitor %s", rhm.configPath)
+	rhm.tomb.Stop()
+}
+
+func (rhm *runtimeHangMonitor) monitorLoop() {
+	defer rhm.tomb.Done()
+
+	runTicker := time.NewTicker(rhm.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	rhm.initializeStatus()
+	if status := rhm.check(time.Now()); status != nil {
+		rhm.statusChan <- status
+	}
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := rhm.check(now); status != nil {
+				rhm.statusChan <- status
+			}
+		case <-rhm.tomb.Stopping():
+			glog.Infof("Runtime hang monitor stopped: %s", rhm.configPath)
+			return
+		}
+	}
+}
+
+func (rhm *runtimeHangMonitor) initializeStatus() {
+	rhm.condition = types.Condition{
+		Type:       rhm.config.ConditionType,
+		Status:     types.False,
+		Transition: time.Now(),
+		Reason:     responsiveReason,
+		Message:    responsiveMessage,
+	}
+	rhm.statusChan <- &types.Status{
+		Source:     rhm.config.Source,
+		Conditions: []types.Condition{rhm.condition},
+	}
+}
+
+// check probes the runtime, and returns a new status if the condition changes. The
+// condition is set while the number of timeouts in the window reaches the threshold.
+func (rhm *runtimeHangMonitor) check(now time.Time) *types.Status {
+	for _, timeout := range rhm.probe() {
+		glog.Warningf("Container runtime is unresponsive: %s", timeout)
+		rhm.timeouts = append(rhm.timeouts, now)
+		rhm.lastTimeout = timeout
+	}
+	expired := 0
+	for expired < len(rhm.timeouts) && now.Sub(rhm.timeouts[expired]) >= rhm.config.Window {
+		expired++
+	}
+	rhm.timeouts = rhm.timeouts[expired:]
+
+	status, reason, message := types.False, responsiveReason, responsiveMessage
+	if len(rhm.timeouts) >= *rhm.config.TimeoutThreshold {
+		status, reason = types.True, unresponsiveReason
+		message = fmt.Sprintf("%d CRI calls timed out in the last %v, last: %s", len(rhm.timeouts), rhm.config.Window, rhm.lastTimeout)
+	}
+	if status == rhm.condition.Status && message == rhm.condition.Message {
+		return nil
+	}
+
+	var events []types.Event
+	if status != rhm.condition.Status {
+		rhm.condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(rhm.condition.Type, status, reason, now))
+	}
+	rhm.condition.Status = status
+	rhm.condition.Reason = reason
+	rhm.condition.Message = message
+
+	if *rhm.config.EnableMetricsReporting {
+		rhm.updateProblemMetrics(len(events) > 0)
+	}
+	return &types.Status{
+		Source:     rhm.config.Source,
+		Events:     events,
+		Conditions: []types.Condition{rhm.condition},
+	}
+}
+
+func (rhm *runtimeHangMonitor) updateProblemMetrics(transitioned bool) {
+	active := rhm.condition.Status == types.True
+	if active && transitioned {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(unresponsiveReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", unresponsiveReason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(rhm.condition.Type, unresponsiveReason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			rhm.condition.Type, unresponsiveReason, err)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtimehangmonitor
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	rhmtypes "k8s.io/node-problem-detector/pkg/runtimehangmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/cri"
+)
+
+func newTestMonitor(t *testing.T, timeouts []string) *runtimeHangMonitor {
+	disabled := false
+	two := 2
+	config := rhmtypes.RuntimeHangConfig{
+		InvokeIntervalString:   "30s",
+		WindowString:           "2m",
+		TimeoutThreshold:       &two,
+		EnableMetricsReporting: &disabled,
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+
+	rhm := &runtimeHangMonitor{
+		config:     config,
+		probe:      func() []string { return timeouts },
+		statusChan: make(chan *types.Status, 10),
+	}
+	rhm.initializeStatus()
+	<-rhm.statusChan
+	return rhm
+}
+
+func TestCheck(t *testing.T) {
+	const (
+		statusTimeout  = "Status timed out after 5s"
+		versionTimeout = "Version timed out after 5s"
+	)
+	now := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		desc string
+		// timeouts are how long ago the timeouts in the window happened, and last describes
+		// the last of them.
+		timeouts []time.Duration
+		last     string
+		// violated is the message of the condition before the check, empty if it is not set.
+		violated string
+		// probed are the timeouts of the probe of the check.
+		probed []string
+		// expected is the expected message of the condition, empty if no status is expected.
+		expected  string
+		events    int
+		remaining int
+	}{
+		{
+			desc: "runtime responds",
+		},
+		{
+			desc:      "one timeout in the window is tolerated",
+			probed:    []string{statusTimeout},
+			remaining: 1,
+		},
+		{
+			desc:      "the second timeout in the window sets the condition",
+			timeouts:  []time.Duration{time.Minute},
+			last:      statusTimeout,
+			probed:    []string{versionTimeout},
+			expected:  "2 CRI calls timed out in the last 2m0s, last: Version timed out after 5s",
+			events:    1,
+			remaining: 2,
+		},
+		{
+			desc:      "timeouts of one probe are all counted",
+			probed:    []string{versionTimeout, statusTimeout},
+			expected:  "2 CRI calls timed out in the last 2m0s, last: Status timed out after 5s",
+			events:    1,
+			remaining: 2,
+		},
+		{
+			desc:      "another timeout updates the message without an event",
+			timeouts:  []time.Duration{90 * time.Second, time.Minute},
+			last:      statusTimeout,
+			violated:  "2 CRI calls timed out in the last 2m0s, last: Status timed out after 5s",
+			probed:    []string{versionTimeout},
+			expected:  "3 CRI calls timed out in the last 2m0s, last: Version timed out after 5s",
+			remaining: 3,
+		},
+		{
+			desc:      "the condition is kept while the timeouts are in the window",
+			timeouts:  []time.Duration{90 * time.Second, 30 * time.Second},
+			last:      versionTimeout,
+			violated:  "2 CRI calls timed out in the last 2m0s, last: Version timed out after 5s",
+			remaining: 2,
+		},
+		{
+			desc:      "the condition is cleared once a timeout leaves the window",
+			timeouts:  []time.Duration{2 * time.Minute, 30 * time.Second},
+			last:      versionTimeout,
+			violated:  "2 CRI calls timed out in the last 2m0s, last: Version timed out after 5s",
+			expected:  responsiveMessage,
+			events:    1,
+			remaining: 1,
+		},
+	} {
+		rhm := newTestMonitor(t, test.probed)
+		for _, ago := range test.timeouts {
+			rhm.timeouts = append(rhm.timeouts, now.Add(-ago))
+		}
+		rhm.lastTimeout = test.last
+		if test.violated != "" {
+			rhm.condition.Status = types.True
+			rhm.condition.Reason = unresponsiveReason
+			rhm.condition.Message = test.violated
+		}
+
+		status := rhm.check(now)
+		assert.Len(t, rhm.timeouts, test.remaining, test.desc)
+		if test.expected == "" {
+			assert.Nil(t, status, test.desc)
+			continue
+		}
+		if assert.NotNil(t, status, test.desc) {
+			assert.Equal(t, test.expected, status.Conditions[0].Message, test.desc)
+			if test.expected == responsiveMessage {
+				assert.Equal(t, types.False, status.Conditions[0].Status, test.desc)
+				assert.Equal(t, responsiveReason, status.Conditions[0].Reason, test.desc)
+			} else {
+				assert.Equal(t, types.True, status.Conditions[0].Status, test.desc)
+				assert.Equal(t, unresponsiveReason, status.Conditions[0].Reason, test.desc)
+			}
+			assert.Len(t, status.Events, test.events, test.desc)
+		}
+	}
+}
+
+// serveRuntime serves a fake runtime service on a unix socket, and returns its endpoint.
+func serveRuntime(t *testing.T, handler grpc.StreamHandler) (cri.Endpoint, func()) {
+	dir, err := ioutil.TempDir("", "runtime-hang-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "runtime.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.UnknownServiceHandler(handler))
+	go server.Serve(listener)
+	return cri.Endpoint{Protocol: cri.UnixProtocol, Address: socket}, func() {
+		server.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	// The runtime only serves v1alpha2, and hangs in Status.
+	var (
+		methods []string
+		lock    sync.Mutex
+	)
+	endpoint, stop := serveRuntime(t, func(_ interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		lock.Lock()
+		methods = append(methods, method)
+		lock.Unlock()
+		if !strings.HasPrefix(method, "/runtime.v1alpha2.") {
+			return status.Error(codes.Unimplemented, "unknown service")
+		}
+		var request empty.Empty
+		if err := stream.RecvMsg(&request); err != nil {
+			return err
+		}
+		if strings.HasSuffix(method, "/Status") {
+			<-stream.Context().Done()
+			return stream.Context().Err()
+		}
+		return stream.SendMsg(&empty.Empty{})
+	})
+	defer stop()
+
+	p := &prober{endpoint: endpoint, timeout: 200 * time.Millisecond}
+	timeouts := p.probe()
+	if assert.Len(t, timeouts, 1) {
+		assert.Contains(t, timeouts[0], "Status timed out after")
+	}
+	assert.Equal(t, "runtime.v1alpha2.RuntimeService", p.service)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{
+		"/runtime.v1.RuntimeService/Version",
+		"/runtime.v1alpha2.RuntimeService/Version",
+		"/runtime.v1alpha2.RuntimeService/Status",
+	}, methods)
+}
+
+func TestProbeRuntimeDown(t *testing.T) {
+	endpoint, stop := serveRuntime(t, func(_ interface{}, stream grpc.ServerStream) error {
+		return nil
+	})
+	stop()
+
+	// A runtime which is down is not a timeout.
+	p := &prober{endpoint: endpoint, timeout: 5 * time.Second}
+	start := time.Now()
+	assert.Empty(t, p.probe())
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
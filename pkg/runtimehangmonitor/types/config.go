@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/node-problem-detector/pkg/util/cri"
+)
+
+var (
+	defaultSource               = "runtime-hang-monitor"
+	defaultInvokeIntervalString = (30 * time.Second).String()
+	defaultTimeoutString        = (5 * time.Second).String()
+	defaultWindowString         = (5 * time.Minute).String()
+	defaultTimeoutThreshold     = 3
+	defaultEnableMetrics        = true
+	defaultConditionType        = "RuntimeUnresponsive"
+)
+
+type RuntimeHangConfig struct {
+	// Source is the source name of the runtime hang monitor.
+	Source string `json:"source"`
+	// Endpoint is the CRI endpoint of the container runtime, e.g.
+	// "unix:///run/containerd/containerd.sock". Default to the first default endpoint of
+	// the platform which is served. Only unix and tcp endpoints are supported.
+	Endpoint       string       `json:"endpoint"`
+	ParsedEndpoint cri.Endpoint `json:"-"`
+	// InvokeIntervalString is the interval at which the runtime is probed.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// TimeoutString is the timeout of each CRI call of a probe.
+	TimeoutString string        `json:"timeout"`
+	Timeout       time.Duration `json:"-"`
+	// WindowString is the sliding window the timeouts are counted in.
+	WindowString string        `json:"window"`
+	Window       time.Duration `json:"-"`
+	// TimeoutThreshold is the number of timeouts in the window at which the condition is
+	// set.
+	TimeoutThreshold *int `json:"timeoutThreshold,omitempty"`
+	// ConditionType is the type of the condition. Default to "RuntimeUnresponsive".
+	ConditionType string `json:"conditionType"`
+	// EnableMetricsReporting describes whether to count the RuntimeCallsTimingOut
+	// transitions and report the condition as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (rhc *RuntimeHangConfig) ApplyConfiguration() error {
+	if rhc.Source == "" {
+		rhc.Source = defaultSource
+	}
+	if rhc.InvokeIntervalString == "" {
+		rhc.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if rhc.TimeoutString == "" {
+		rhc.TimeoutString = defaultTimeoutString
+	}
+	if rhc.WindowString == "" {
+		rhc.WindowString = defaultWindowString
+	}
+	if rhc.TimeoutThreshold == nil {
+		rhc.TimeoutThreshold = &defaultTimeoutThreshold
+	}
+	if rhc.ConditionType == "" {
+		rhc.ConditionType = defaultConditionType
+	}
+	if rhc.EnableMetricsReporting == nil {
+		rhc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	rhc.InvokeInterval, err = time.ParseDuration(rhc.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", rhc.InvokeIntervalString, err)
+	}
+	rhc.Timeout, err = time.ParseDuration(rhc.TimeoutString)
+	if err != nil {
+		return fmt.Errorf("error in parsing TimeoutString %q: %v", rhc.TimeoutString, err)
+	}
+	rhc.Window, err = time.ParseDuration(rhc.WindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing WindowString %q: %v", rhc.WindowString, err)
+	}
+	if rhc.Endpoint != "" {
+		rhc.ParsedEndpoint, err = cri.ParseEndpoint(rhc.Endpoint)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (rhc *RuntimeHangConfig) Validate() error {
+	if rhc.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", rhc.InvokeInterval)
+	}
+	if rhc.Timeout <= time.Duration(0) || rhc.Timeout > rhc.InvokeInterval {
+		return fmt.Errorf("Timeout %v must be above 0s and not greater than InvokeInterval %v", rhc.Timeout, rhc.InvokeInterval)
+	}
+	if rhc.Window < rhc.InvokeInterval {
+		return fmt.Errorf("Window %v must not be less than InvokeInterval %v", rhc.Window, rhc.InvokeInterval)
+	}
+	if *rhc.TimeoutThreshold <= 0 {
+		return fmt.Errorf("TimeoutThreshold %d must be above 0", *rhc.TimeoutThreshold)
+	}
+	if rhc.Endpoint != "" && rhc.ParsedEndpoint.Protocol != cri.UnixProtocol && rhc.ParsedEndpoint.Protocol != cri.TCPProtocol {
+		return fmt.Errorf("Endpoint %q is not supported, only %s and %s endpoints are", rhc.Endpoint, cri.UnixProtocol, cri.TCPProtocol)
+	}
+	return nil
+}
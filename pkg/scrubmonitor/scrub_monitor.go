@@ -0,0 +1,340 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scrubmonitor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	smtypes "k8s.io/node-problem-detector/pkg/scrubmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const ScrubMonitorName = "scrub-monitor"
+
+func init() {
+	problemdaemon.Register(ScrubMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewScrubMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+// scrubResult is the result of a scrub run.
+type scrubResult struct {
+	scrub   *smtypes.Scrub
+	status  types.ConditionStatus
+	message string
+}
+
+type scrubMonitor struct {
+	configPath string
+	config     smtypes.ScrubConfig
+	// runScrub runs the scrub command, and returns its exit code and output.
+	runScrub func(ctx context.Context, scrub *smtypes.Scrub) (int, string, error)
+	// lastRun is the last time each scrub was started, keyed by scrub name.
+	lastRun map[string]time.Time
+	// running is the scrub currently running. Only one scrub runs at a time.
+	running    *smtypes.Scrub
+	cancel     context.CancelFunc
+	resultChan chan scrubResult
+	conditions []types.Condition
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewScrubMonitorOrDie creates a scrub monitor, panics if error occurs.
+func NewScrubMonitorOrDie(configPath string) types.Monitor {
+	sm := scrubMonitor{
+		configPath: configPath,
+		lastRun:    map[string]time.Time{},
+		resultChan: make(chan scrubResult, 1),
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &sm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = sm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = sm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, sm.config, err)
+	}
+	sm.runScrub = sm.execScrub
+
+	// A 1000 size channel should be big enough.
+	sm.statusChan = make(chan *types.Status, 1000)
+
+	if *sm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie(sm.config.Scrubs)
+	}
+	return &sm
+}
+
+// initializeProblemMetricsOrDie creates problem metrics for all scrubs and set the value to 0,
+// panic if error occurs.
+func initializeProblemMetricsOrDie(scrubs []*smtypes.Scrub) {
+	for _, scrub := range scrubs {
+		err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(scrub.Condition, scrub.Reason, false)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
+				scrub.Condition, scrub.Reason, err)
+		}
+		err = problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(scrub.Reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", scrub.Reason, err)
+		}
+	}
+}
+
+func (sm *scrubMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start scrub monitor %s", sm.configPath)
+	problemdaemon.Go(sm, sm.monitorLoop)
+	return sm.statusChan, nil
+}
+
+func (sm *scrubMonitor) Stop() {
+	glog.Infof("Stop scrub monitor %s", sm.configPath)
+	sm.tomb.Stop()
+}
+
+func (sm *scrubMonitor) monitorLoop() {
+	defer sm.tomb.Done()
+
+	runTicker := time.NewTicker(sm.config.CheckInterval)
+	defer runTicker.Stop()
+
+	sm.initializeStatus()
+	sm.schedule(time.Now())
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			sm.schedule(now)
+		case result := <-sm.resultChan:
+			sm.running, sm.cancel = nil, nil
+			if status := sm.handleResult(result, time.Now()); status != nil {
+				sm.statusChan <- status
+			}
+		case <-sm.tomb.Stopping():
+			if sm.cancel != nil {
+				sm.cancel()
+			}
+			glog.Infof("Scrub monitor stopped: %s", sm.configPath)
+			return
+		}
+	}
+}
+
+func (sm *scrubMonitor) initializeStatus() {
+	sm.conditions = make([]types.Condition, len(sm.config.DefaultConditions))
+	copy(sm.conditions, sm.config.DefaultConditions)
+	for i := range sm.conditions {
+		sm.conditions[i].Status = types.False
+		sm.conditions[i].Transition = time.Now()
+	}
+	sm.statusChan <- &types.Status{
+		Source:     sm.config.Source,
+		Conditions: sm.conditions,
+	}
+}
+
+// schedule starts the scrub which is due the longest, if no scrub is running and
+// scrubs may start at the time.
+func (sm *scrubMonitor) schedule(now time.Time) {
+	if sm.running != nil || !sm.config.InWindow(now) {
+		return
+	}
+	var next *smtypes.Scrub
+	for _, scrub := range sm.config.Scrubs {
+		lastRun, ok := sm.lastRun[scrub.Name]
+		if ok && now.Sub(lastRun) < scrub.Interval {
+			continue
+		}
+		if next == nil || lastRun.Before(sm.lastRun[next.Name]) {
+			next = scrub
+		}
+	}
+	if next == nil {
+		return
+	}
+
+	glog.Infof("Start scrub %q", next.Name)
+	sm.running = next
+	sm.lastRun[next.Name] = now
+	ctx, cancel := context.WithTimeout(context.Background(), next.Timeout)
+	sm.cancel = cancel
+	go func(scrub *smtypes.Scrub) {
+		defer cancel()
+		start := time.Now()
+		exitCode, output, err := sm.runScrub(ctx, scrub)
+		glog.Infof("Scrub %q finished in %v with exit code %d", scrub.Name, time.Since(start), exitCode)
+		result := sm.evaluate(scrub, exitCode, output, err)
+		select {
+		case sm.resultChan <- result:
+		case <-sm.tomb.Stopping():
+		}
+	}(next)
+}
+
+// execScrub runs the scrub command with the configured niceness.
+func (sm *scrubMonitor) execScrub(ctx context.Context, scrub *smtypes.Scrub) (int, string, error) {
+	var cmd *exec.Cmd
+	if *sm.config.Niceness > 0 {
+		args := append([]string{"-n", strconv.Itoa(*sm.config.Niceness), scrub.Path}, scrub.Args...)
+		cmd = exec.CommandContext(ctx, "nice", args...)
+	} else {
+		cmd = exec.CommandContext(ctx, scrub.Path, scrub.Args...)
+	}
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return -1, string(output), fmt.Errorf("timeout after %v", scrub.Timeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.Sys().(syscall.WaitStatus).ExitStatus(), string(output), nil
+	}
+	return 0, string(output), err
+}
+
+// evaluate decides the condition status from the scrub result. Corruption is found when
+// an output line matches the corruption pattern, or, without a pattern, when the scrub
+// exits with 1. Scrubs which fail to run, or exit with other codes, report Unknown.
+func (sm *scrubMonitor) evaluate(scrub *smtypes.Scrub, exitCode int, output string, err error) scrubResult {
+	result := scrubResult{scrub: scrub}
+	if err != nil {
+		result.status = types.Unknown
+		result.message = sm.truncate(fmt.Sprintf("scrub %q failed: %v", scrub.Name, err))
+		return result
+	}
+
+	if scrub.CorruptionPatternRegexp != nil {
+		var corruptions []string
+		for _, line := range strings.Split(output, "\n") {
+			if scrub.CorruptionPatternRegexp.MatchString(line) {
+				corruptions = append(corruptions, strings.TrimSpace(line))
+			}
+		}
+		if len(corruptions) > 0 {
+			result.status = types.True
+			result.message = sm.truncate(fmt.Sprintf("scrub %q found corruption: %s", scrub.Name, strings.Join(corruptions, "; ")))
+			return result
+		}
+		if exitCode == 0 {
+			result.status = types.False
+			return result
+		}
+	} else {
+		switch exitCode {
+		case 0:
+			result.status = types.False
+			return result
+		case 1:
+			result.status = types.True
+			result.message = sm.truncate(fmt.Sprintf("scrub %q found corruption: %s", scrub.Name, strings.TrimSpace(output)))
+			return result
+		}
+	}
+	result.status = types.Unknown
+	result.message = sm.truncate(fmt.Sprintf("scrub %q exited with %d: %s", scrub.Name, exitCode, strings.TrimSpace(output)))
+	return result
+}
+
+func (sm *scrubMonitor) truncate(message string) string {
+	if len(message) > *sm.config.MaxOutputLength {
+		return message[:*sm.config.MaxOutputLength]
+	}
+	return message
+}
+
+// handleResult updates the condition of the scrub, and returns a new status if the
+// condition changes.
+func (sm *scrubMonitor) handleResult(result scrubResult, now time.Time) *types.Status {
+	var condition *types.Condition
+	var defaultCondition types.Condition
+	for i := range sm.conditions {
+		if sm.conditions[i].Type == result.scrub.Condition {
+			condition = &sm.conditions[i]
+			defaultCondition = sm.config.DefaultConditions[i]
+			break
+		}
+	}
+	if condition == nil {
+		return nil
+	}
+
+	reason, message := result.scrub.Reason, result.message
+	if result.status != types.True {
+		reason = defaultCondition.Reason
+		if message == "" {
+			message = defaultCondition.Message
+		}
+	}
+	if condition.Status == result.status && condition.Reason == reason && condition.Message == message {
+		return nil
+	}
+
+	var events []types.Event
+	if condition.Status != result.status {
+		condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(condition.Type, result.status, reason, now))
+	}
+	condition.Status = result.status
+	condition.Reason = reason
+	condition.Message = message
+
+	if *sm.config.EnableMetricsReporting {
+		sm.updateProblemMetrics(result.scrub, condition, len(events) > 0)
+	}
+	return &types.Status{
+		Source:     sm.config.Source,
+		Events:     events,
+		Conditions: sm.conditions,
+	}
+}
+
+func (sm *scrubMonitor) updateProblemMetrics(scrub *smtypes.Scrub, condition *types.Condition, transitioned bool) {
+	active := condition.Status == types.True
+	if active && transitioned {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(scrub.Reason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", scrub.Reason, err)
+		}
+	}
+	err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(condition.Type, scrub.Reason, active)
+	if err != nil {
+		glog.Errorf("Failed to update problem gauge metrics for problem %q, reason %q: %v",
+			condition.Type, scrub.Reason, err)
+	}
+}
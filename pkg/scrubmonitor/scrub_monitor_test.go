@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scrubmonitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	smtypes "k8s.io/node-problem-detector/pkg/scrubmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+func newTestScrubMonitor(t *testing.T, scrubs ...*smtypes.Scrub) *scrubMonitor {
+	disableMetrics := false
+	sm := &scrubMonitor{
+		config: smtypes.ScrubConfig{
+			DefaultConditions: []types.Condition{
+				{Type: "BtrfsCorrupted", Reason: "NoBtrfsCorruption", Message: "btrfs has no corruption"},
+				{Type: "RaidCorrupted", Reason: "NoRaidMismatch", Message: "RAID has no mismatch"},
+			},
+			Scrubs:                 scrubs,
+			EnableMetricsReporting: &disableMetrics,
+		},
+		lastRun:    map[string]time.Time{},
+		resultChan: make(chan scrubResult, 1),
+		statusChan: make(chan *types.Status, 1000),
+		tomb:       tomb.NewTomb(),
+	}
+	assert.NoError(t, sm.config.ApplyConfiguration())
+	assert.NoError(t, sm.config.Validate())
+	sm.initializeStatus()
+	<-sm.statusChan
+	return sm
+}
+
+func TestEvaluate(t *testing.T) {
+	withPattern := &smtypes.Scrub{Name: "btrfs", Path: "btrfs", Condition: "BtrfsCorrupted",
+		Reason: "BtrfsScrubErrors", CorruptionPattern: `(csum|read)_errors: [1-9]`}
+	withoutPattern := &smtypes.Scrub{Name: "md", Path: "check-md", Condition: "RaidCorrupted", Reason: "RaidMismatch"}
+	sm := newTestScrubMonitor(t, withPattern, withoutPattern)
+
+	testCases := []struct {
+		name            string
+		scrub           *smtypes.Scrub
+		exitCode        int
+		output          string
+		err             error
+		expectedStatus  types.ConditionStatus
+		expectedMessage string
+	}{
+		{"pattern matches", withPattern, 3, "csum_errors: 0\nread_errors: 2\n", nil, types.True,
+			`scrub "btrfs" found corruption: read_errors: 2`},
+		{"pattern does not match", withPattern, 0, "csum_errors: 0\nread_errors: 0\n", nil, types.False, ""},
+		{"pattern does not match with failure", withPattern, 2, "ERROR: not a btrfs filesystem", nil, types.Unknown,
+			`scrub "btrfs" exited with 2: ERROR: not a btrfs filesystem`},
+		{"exit code 0", withoutPattern, 0, "", nil, types.False, ""},
+		{"exit code 1", withoutPattern, 1, "mismatch_cnt 128\n", nil, types.True,
+			`scrub "md" found corruption: mismatch_cnt 128`},
+		{"timeout", withoutPattern, -1, "", errors.New("timeout after 6h0m0s"), types.Unknown,
+			`scrub "md" failed: timeout after 6h0m0s`},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			result := sm.evaluate(test.scrub, test.exitCode, test.output, test.err)
+			assert.Equal(t, test.expectedStatus, result.status)
+			assert.Equal(t, test.expectedMessage, result.message)
+		})
+	}
+}
+
+func TestHandleResult(t *testing.T) {
+	scrub := &smtypes.Scrub{Name: "md", Path: "check-md", Condition: "RaidCorrupted", Reason: "RaidMismatch"}
+	sm := newTestScrubMonitor(t, scrub)
+	now := time.Now()
+
+	status := sm.handleResult(scrubResult{scrub: scrub, status: types.False}, now)
+	assert.Nil(t, status, "no change for clean scrub")
+
+	status = sm.handleResult(scrubResult{scrub: scrub, status: types.True, message: "mismatch"}, now)
+	assert.NotNil(t, status)
+	assert.Len(t, status.Events, 1)
+	assert.Equal(t, types.True, status.Conditions[1].Status)
+	assert.Equal(t, "RaidMismatch", status.Conditions[1].Reason)
+	assert.Equal(t, "mismatch", status.Conditions[1].Message)
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+
+	status = sm.handleResult(scrubResult{scrub: scrub, status: types.False}, now)
+	assert.NotNil(t, status)
+	assert.Len(t, status.Events, 1)
+	assert.Equal(t, types.False, status.Conditions[1].Status)
+	assert.Equal(t, "NoRaidMismatch", status.Conditions[1].Reason)
+	assert.Equal(t, "RAID has no mismatch", status.Conditions[1].Message)
+}
+
+func TestSchedule(t *testing.T) {
+	first := &smtypes.Scrub{Name: "btrfs", Path: "btrfs", Condition: "BtrfsCorrupted", IntervalString: "24h"}
+	second := &smtypes.Scrub{Name: "md", Path: "check-md", Condition: "RaidCorrupted", IntervalString: "24h"}
+	sm := newTestScrubMonitor(t, first, second)
+	sm.config.Windows = []*smtypes.Window{{StartString: "02:00", EndString: "05:00"}}
+	assert.NoError(t, sm.config.ApplyConfiguration())
+
+	var started []string
+	sm.runScrub = func(ctx context.Context, scrub *smtypes.Scrub) (int, string, error) {
+		started = append(started, scrub.Name)
+		return 0, "", nil
+	}
+	day := time.Date(2020, 3, 7, 0, 0, 0, 0, time.Local)
+
+	// Outside of the window.
+	sm.schedule(day.Add(time.Hour))
+	assert.Nil(t, sm.running)
+
+	// Only one scrub runs at a time.
+	sm.schedule(day.Add(2 * time.Hour))
+	assert.Equal(t, first, sm.running)
+	sm.schedule(day.Add(2*time.Hour + time.Minute))
+	result := <-sm.resultChan
+	assert.Equal(t, []string{"btrfs"}, started)
+	assert.Equal(t, first, result.scrub)
+	sm.running = nil
+
+	// The next scrub is the one which has not run.
+	sm.schedule(day.Add(2*time.Hour + 2*time.Minute))
+	<-sm.resultChan
+	sm.running = nil
+	assert.Equal(t, []string{"btrfs", "md"}, started)
+
+	// Scrubs are not run again before their interval.
+	sm.schedule(day.Add(3 * time.Hour))
+	assert.Nil(t, sm.running)
+	sm.schedule(day.Add(26*time.Hour + time.Minute))
+	<-sm.resultChan
+	assert.Equal(t, []string{"btrfs", "md", "btrfs"}, started)
+}
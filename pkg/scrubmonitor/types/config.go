@@ -0,0 +1,267 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+var (
+	defaultSource              = "scrub-monitor"
+	defaultCheckIntervalString = (1 * time.Minute).String()
+	defaultScrubIntervalString = (7 * 24 * time.Hour).String()
+	defaultScrubTimeoutString  = (6 * time.Hour).String()
+	defaultNiceness            = 19
+	defaultEnableMetrics       = true
+	defaultMaxOutputLength     = 256
+	clockFormat                = "15:04"
+	weekdays                   = map[string]time.Weekday{}
+)
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays[strings.ToLower(d.String()[:3])] = d
+	}
+}
+
+// Window is a recurring time window in local time during which scrubs may start.
+type Window struct {
+	// StartString is the start of the window, e.g. "02:00".
+	StartString string        `json:"start"`
+	Start       time.Duration `json:"-"`
+	// EndString is the end of the window, e.g. "05:00". A window ending before it
+	// starts spans midnight.
+	EndString string        `json:"end"`
+	End       time.Duration `json:"-"`
+	// Days are the days the window starts on, e.g. ["Sat", "Sun"]. Empty means
+	// every day.
+	Days   []string `json:"days"`
+	daySet map[time.Weekday]bool
+}
+
+// Scrub is a scrub or check command, and the condition it reports.
+type Scrub struct {
+	// Name identifies the scrub.
+	Name string `json:"name"`
+	// Path is the path of the command.
+	Path string `json:"path"`
+	// Args are the arguments of the command.
+	Args []string `json:"args"`
+	// IntervalString is the minimum interval between two runs of the scrub.
+	IntervalString string        `json:"interval"`
+	Interval       time.Duration `json:"-"`
+	// TimeoutString is the time after which the scrub is killed.
+	TimeoutString string        `json:"timeout"`
+	Timeout       time.Duration `json:"-"`
+	// Condition is the condition type set when corruption is found.
+	Condition string `json:"condition"`
+	// Reason is the condition reason set when corruption is found.
+	Reason string `json:"reason"`
+	// CorruptionPattern matches the output lines reporting corruption. When it is empty,
+	// corruption is reported by exit code 1.
+	CorruptionPattern       string         `json:"corruptionPattern"`
+	CorruptionPatternRegexp *regexp.Regexp `json:"-"`
+}
+
+type ScrubConfig struct {
+	// Source is the source name of the scrub monitor.
+	Source string `json:"source"`
+	// CheckIntervalString is the interval at which the monitor checks whether a scrub
+	// is due.
+	CheckIntervalString string        `json:"checkInterval"`
+	CheckInterval       time.Duration `json:"-"`
+	// Niceness is the niceness scrubs run with. 0 runs scrubs at normal priority.
+	Niceness *int `json:"niceness,omitempty"`
+	// MaxOutputLength is the maximum length of the scrub output used as condition message.
+	MaxOutputLength *int `json:"maxOutputLength,omitempty"`
+	// Windows are the time windows during which scrubs may start. Empty means any time.
+	Windows []*Window `json:"windows"`
+	// DefaultConditions are the default states of all the conditions scrubs report.
+	DefaultConditions []types.Condition `json:"conditions"`
+	// Scrubs are the scrubs to run.
+	Scrubs []*Scrub `json:"scrubs"`
+	// EnableMetricsReporting describes whether to count the corruption found by each scrub
+	// and report its condition as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (sc *ScrubConfig) ApplyConfiguration() error {
+	if sc.Source == "" {
+		sc.Source = defaultSource
+	}
+	if sc.CheckIntervalString == "" {
+		sc.CheckIntervalString = defaultCheckIntervalString
+	}
+	if sc.Niceness == nil {
+		sc.Niceness = &defaultNiceness
+	}
+	if sc.MaxOutputLength == nil {
+		sc.MaxOutputLength = &defaultMaxOutputLength
+	}
+	if sc.EnableMetricsReporting == nil {
+		sc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	sc.CheckInterval, err = time.ParseDuration(sc.CheckIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing CheckIntervalString %q: %v", sc.CheckIntervalString, err)
+	}
+	for _, window := range sc.Windows {
+		if err := window.applyConfiguration(); err != nil {
+			return err
+		}
+	}
+	for _, scrub := range sc.Scrubs {
+		if err := scrub.applyConfiguration(); err != nil {
+			return fmt.Errorf("error in scrub %q: %v", scrub.Name, err)
+		}
+	}
+	return nil
+}
+
+func (w *Window) applyConfiguration() error {
+	start, err := time.Parse(clockFormat, w.StartString)
+	if err != nil {
+		return fmt.Errorf("error in parsing window start %q: %v", w.StartString, err)
+	}
+	end, err := time.Parse(clockFormat, w.EndString)
+	if err != nil {
+		return fmt.Errorf("error in parsing window end %q: %v", w.EndString, err)
+	}
+	w.Start = time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+	w.End = time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute
+	w.daySet = map[time.Weekday]bool{}
+	for _, day := range w.Days {
+		d, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("unknown window day %q, expected one of Sun, Mon, Tue, Wed, Thu, Fri, Sat", day)
+		}
+		w.daySet[d] = true
+	}
+	return nil
+}
+
+func (s *Scrub) applyConfiguration() error {
+	if s.IntervalString == "" {
+		s.IntervalString = defaultScrubIntervalString
+	}
+	if s.TimeoutString == "" {
+		s.TimeoutString = defaultScrubTimeoutString
+	}
+
+	var err error
+	s.Interval, err = time.ParseDuration(s.IntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing IntervalString %q: %v", s.IntervalString, err)
+	}
+	s.Timeout, err = time.ParseDuration(s.TimeoutString)
+	if err != nil {
+		return fmt.Errorf("error in parsing TimeoutString %q: %v", s.TimeoutString, err)
+	}
+	if s.CorruptionPattern != "" {
+		s.CorruptionPatternRegexp, err = regexp.Compile(s.CorruptionPattern)
+		if err != nil {
+			return fmt.Errorf("error in compiling CorruptionPattern %q: %v", s.CorruptionPattern, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (sc *ScrubConfig) Validate() error {
+	if sc.CheckInterval <= time.Duration(0) {
+		return fmt.Errorf("CheckInterval %v must be above 0s", sc.CheckInterval)
+	}
+	if *sc.Niceness < 0 || *sc.Niceness > 19 {
+		return fmt.Errorf("Niceness %d must be between 0 and 19", *sc.Niceness)
+	}
+	for _, window := range sc.Windows {
+		if window.Start == window.End {
+			return fmt.Errorf("window %s-%s is empty", window.StartString, window.EndString)
+		}
+	}
+	names := map[string]bool{}
+	conditions := map[string]bool{}
+	for _, scrub := range sc.Scrubs {
+		if scrub.Name == "" || scrub.Path == "" {
+			return fmt.Errorf("scrub %+v must have a name and a path", *scrub)
+		}
+		if names[scrub.Name] {
+			return fmt.Errorf("duplicate scrub name %q", scrub.Name)
+		}
+		names[scrub.Name] = true
+		if conditions[scrub.Condition] {
+			return fmt.Errorf("condition %q is reported by more than one scrub", scrub.Condition)
+		}
+		conditions[scrub.Condition] = true
+		if scrub.Interval <= time.Duration(0) || scrub.Timeout <= time.Duration(0) {
+			return fmt.Errorf("interval %v and timeout %v of scrub %q must be above 0s",
+				scrub.Interval, scrub.Timeout, scrub.Name)
+		}
+		if !sc.hasDefaultCondition(scrub.Condition) {
+			return fmt.Errorf("condition %q of scrub %q does not have preset default condition",
+				scrub.Condition, scrub.Name)
+		}
+	}
+	return nil
+}
+
+func (sc *ScrubConfig) hasDefaultCondition(conditionType string) bool {
+	for _, condition := range sc.DefaultConditions {
+		if condition.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// InWindow returns whether scrubs may start at the time.
+func (sc *ScrubConfig) InWindow(t time.Time) bool {
+	if len(sc.Windows) == 0 {
+		return true
+	}
+	for _, window := range sc.Windows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains returns whether the time is in the window.
+func (w *Window) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.Start < w.End {
+		return w.onDay(t.Weekday()) && offset >= w.Start && offset < w.End
+	}
+	// The window spans midnight, it either started today or yesterday.
+	if offset >= w.Start {
+		return w.onDay(t.Weekday())
+	}
+	return offset < w.End && w.onDay((t.Weekday()+6)%7)
+}
+
+func (w *Window) onDay(day time.Weekday) bool {
+	return len(w.daySet) == 0 || w.daySet[day]
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestWindowContains(t *testing.T) {
+	// 2020-03-07 is a Saturday.
+	at := func(day int, clock string) time.Time {
+		c, _ := time.Parse(clockFormat, clock)
+		return time.Date(2020, 3, day, c.Hour(), c.Minute(), 0, 0, time.Local)
+	}
+	testCases := []struct {
+		name     string
+		window   Window
+		time     time.Time
+		expected bool
+	}{
+		{"inside", Window{StartString: "02:00", EndString: "05:00"}, at(7, "03:00"), true},
+		{"at start", Window{StartString: "02:00", EndString: "05:00"}, at(7, "02:00"), true},
+		{"at end", Window{StartString: "02:00", EndString: "05:00"}, at(7, "05:00"), false},
+		{"before", Window{StartString: "02:00", EndString: "05:00"}, at(7, "01:59"), false},
+		{"on day", Window{StartString: "02:00", EndString: "05:00", Days: []string{"Sat"}}, at(7, "03:00"), true},
+		{"not on day", Window{StartString: "02:00", EndString: "05:00", Days: []string{"sun"}}, at(7, "03:00"), false},
+		{"across midnight before midnight", Window{StartString: "22:00", EndString: "04:00", Days: []string{"Sat"}}, at(7, "23:00"), true},
+		{"across midnight after midnight", Window{StartString: "22:00", EndString: "04:00", Days: []string{"Sat"}}, at(8, "01:00"), true},
+		{"across midnight started on other day", Window{StartString: "22:00", EndString: "04:00", Days: []string{"Sat"}}, at(7, "01:00"), false},
+		{"across midnight outside", Window{StartString: "22:00", EndString: "04:00"}, at(7, "12:00"), false},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.NoError(t, test.window.applyConfiguration())
+			assert.Equal(t, test.expected, test.window.Contains(test.time))
+		})
+	}
+}
+
+func TestScrubConfigValidate(t *testing.T) {
+	newConfig := func() *ScrubConfig {
+		return &ScrubConfig{
+			DefaultConditions: []types.Condition{{Type: "FilesystemCorrupted", Reason: "NoCorruption"}},
+			Scrubs: []*Scrub{
+				{Name: "btrfs", Path: "/bin/btrfs", Condition: "FilesystemCorrupted", Reason: "BtrfsScrubErrors"},
+			},
+		}
+	}
+	testCases := []struct {
+		name    string
+		mutate  func(*ScrubConfig)
+		isError bool
+	}{
+		{"valid", func(*ScrubConfig) {}, false},
+		{"bad window", func(c *ScrubConfig) { c.Windows = []*Window{{StartString: "2am", EndString: "05:00"}} }, true},
+		{"bad day", func(c *ScrubConfig) {
+			c.Windows = []*Window{{StartString: "02:00", EndString: "05:00", Days: []string{"Someday"}}}
+		}, true},
+		{"empty window", func(c *ScrubConfig) { c.Windows = []*Window{{StartString: "02:00", EndString: "02:00"}} }, true},
+		{"missing default condition", func(c *ScrubConfig) { c.DefaultConditions = nil }, true},
+		{"missing path", func(c *ScrubConfig) { c.Scrubs[0].Path = "" }, true},
+		{"bad pattern", func(c *ScrubConfig) { c.Scrubs[0].CorruptionPattern = "(" }, true},
+		{"duplicate condition", func(c *ScrubConfig) {
+			c.Scrubs = append(c.Scrubs, &Scrub{Name: "md", Path: "/bin/cat", Condition: "FilesystemCorrupted"})
+		}, true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			config := newConfig()
+			test.mutate(config)
+			err := config.ApplyConfiguration()
+			if err == nil {
+				err = config.Validate()
+			}
+			assert.Equal(t, test.isError, err != nil, "error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securityhygienemonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// process is a process running on the node.
+type process struct {
+	pid  int
+	name string
+	// cmdline is the command line with the arguments separated by spaces.
+	cmdline string
+	uid     string
+	// startTime is the start time of the process in clock ticks since boot, which tells
+	// apart processes reusing the same pid.
+	startTime string
+}
+
+// listener is a socket listening for connections, or a bound UDP socket.
+type listener struct {
+	protocol string
+	address  string
+	port     int
+	inode    string
+}
+
+// readProcesses reads all processes from procfs. Processes exiting while they are read
+// are skipped.
+func readProcesses(procPath string) ([]process, error) {
+	dirs, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		return nil, err
+	}
+	var processes []process
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(dir.Name())
+		if err != nil || !dir.IsDir() {
+			continue
+		}
+		p, err := readProcess(procPath, pid)
+		if err != nil {
+			continue
+		}
+		processes = append(processes, p)
+	}
+	return processes, nil
+}
+
+func readProcess(procPath string, pid int) (process, error) {
+	p := process{pid: pid}
+	dir := filepath.Join(procPath, strconv.Itoa(pid))
+	stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return p, err
+	}
+	// The name in the stat may contain spaces and parentheses, so it is taken between the
+	// first "(" and the last ")".
+	start, end := strings.IndexByte(string(stat), '('), strings.LastIndexByte(string(stat), ')')
+	if start < 0 || end < start {
+		return p, fmt.Errorf("invalid stat of process %d: %q", pid, stat)
+	}
+	p.name = string(stat[start+1 : end])
+	// The start time is the 22nd field, the 20th after the name.
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return p, fmt.Errorf("invalid stat of process %d: %q", pid, stat)
+	}
+	p.startTime = fields[19]
+
+	cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return p, err
+	}
+	p.cmdline = strings.TrimSpace(strings.Replace(string(cmdline), "\x00", " ", -1))
+
+	status, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return p, err
+	}
+	defer status.Close()
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "Uid:" {
+			p.uid = fields[1]
+			break
+		}
+	}
+	return p, scanner.Err()
+}
+
+const (
+	tcpListenState      = "0A"
+	udpUnconnectedState = "07"
+)
+
+// readListeners reads the listening TCP sockets and the bound UDP sockets of the network
+// namespace of node problem detector.
+func readListeners(procPath string) ([]listener, error) {
+	var listeners []listener
+	for _, table := range []struct {
+		file     string
+		protocol string
+		state    string
+	}{
+		{file: "tcp", protocol: "tcp", state: tcpListenState},
+		{file: "tcp6", protocol: "tcp", state: tcpListenState},
+		{file: "udp", protocol: "udp", state: udpUnconnectedState},
+		{file: "udp6", protocol: "udp", state: udpUnconnectedState},
+	} {
+		l, err := readSocketTable(filepath.Join(procPath, "net", table.file), table.protocol, table.state)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// IPv6 may be disabled.
+				continue
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l...)
+	}
+	return listeners, nil
+}
+
+// readSocketTable reads the sockets in the state from a socket table, e.g. /proc/net/tcp.
+func readSocketTable(path, protocol, state string) ([]listener, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var listeners []listener
+	scanner := bufio.NewScanner(f)
+	// Skip the header.
+	scanner.Scan()
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		address, port, err := parseSocketAddress(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket in %q: %v", path, err)
+		}
+		listeners = append(listeners, listener{protocol: protocol, address: address, port: port, inode: fields[9]})
+	}
+	return listeners, scanner.Err()
+}
+
+// parseSocketAddress parses an address of a socket table, e.g. "0100007F:0016" is
+// 127.0.0.1:22. The address is in hex in the native byte order of each 32 bit word,
+// little endian is assumed.
+func parseSocketAddress(s string) (string, int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || (len(parts[0]) != 8 && len(parts[0]) != 32) {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port of address %q: %v", s, err)
+	}
+	var ip []byte
+	for i := 0; i < len(parts[0]); i += 8 {
+		word, err := strconv.ParseUint(parts[0][i:i+8], 16, 32)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid address %q: %v", s, err)
+		}
+		ip = append(ip, byte(word), byte(word>>8), byte(word>>16), byte(word>>24))
+	}
+	return net.IP(ip).String(), int(port), nil
+}
+
+// socketOwners maps the inodes of the sockets to the processes owning them. A socket
+// shared by several processes, e.g. after fork, is mapped to the one with the lowest pid.
+func socketOwners(procPath string, processes []process) map[string]process {
+	owners := make(map[string]process)
+	for _, p := range processes {
+		fdDir := filepath.Join(procPath, strconv.Itoa(p.pid), "fd")
+		fds, err := ioutil.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if owner, ok := owners[inode]; !ok || p.pid < owner.pid {
+				owners[inode] = p
+			}
+		}
+	}
+	return owners
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securityhygienemonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestReadProcesses(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+
+	writeFile(t, filepath.Join(procPath, "42/stat"),
+		"42 (my (evil) miner) S 1 42 42 0 -1 4194560 1000 0 0 0 10 5 0 0 20 0 1 0 123456 1000000 100 18446744073709551615\n")
+	writeFile(t, filepath.Join(procPath, "42/cmdline"), "/tmp/miner\x00-o\x00pool:3333\x00")
+	writeFile(t, filepath.Join(procPath, "42/status"), "Name:\tminer\nUid:\t1000\t1000\t1000\t1000\n")
+	// Kernel threads have an empty command line.
+	writeFile(t, filepath.Join(procPath, "2/stat"), "2 (kthreadd) S 0 0 0 0 -1 2129984 0 0 0 0 0 0 0 0 20 0 1 0 7 0 0 18446744073709551615\n")
+	writeFile(t, filepath.Join(procPath, "2/cmdline"), "")
+	writeFile(t, filepath.Join(procPath, "2/status"), "Name:\tkthreadd\nUid:\t0\t0\t0\t0\n")
+	// Processes exiting while they are read are skipped.
+	writeFile(t, filepath.Join(procPath, "7/stat"), "7 (exited) S 0 0 0 0 -1 2129984 0 0 0 0 0 0 0 0 20 0 1 0 8 0 0 18446744073709551615\n")
+	writeFile(t, filepath.Join(procPath, "self/stat"), "")
+	writeFile(t, filepath.Join(procPath, "meminfo"), "")
+
+	processes, err := readProcesses(procPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []process{
+		{pid: 2, name: "kthreadd", uid: "0", startTime: "7"},
+		{pid: 42, name: "my (evil) miner", cmdline: "/tmp/miner -o pool:3333", uid: "1000", startTime: "123456"},
+	}, processes)
+}
+
+func TestParseSocketAddress(t *testing.T) {
+	for _, test := range []struct {
+		address         string
+		expectedAddress string
+		expectedPort    int
+		expectErr       bool
+	}{
+		{address: "0100007F:0016", expectedAddress: "127.0.0.1", expectedPort: 22},
+		{address: "00000000:1F90", expectedAddress: "0.0.0.0", expectedPort: 8080},
+		{address: "00000000000000000000000000000000:0016", expectedAddress: "::", expectedPort: 22},
+		{address: "00000000000000000000000001000000:0CEA", expectedAddress: "::1", expectedPort: 3306},
+		{address: "0100007F", expectErr: true},
+		{address: "0100007F:XYZ", expectErr: true},
+	} {
+		address, port, err := parseSocketAddress(test.address)
+		if test.expectErr {
+			assert.Error(t, err, test.address)
+			continue
+		}
+		assert.NoError(t, err, test.address)
+		assert.Equal(t, test.expectedAddress, address, test.address)
+		assert.Equal(t, test.expectedPort, port, test.address)
+	}
+}
+
+func TestReadListeners(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+
+	writeFile(t, filepath.Join(procPath, "net/tcp"), `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0016 0100007F:A000 01 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1
+`)
+	writeFile(t, filepath.Join(procPath, "net/udp"), `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  10: 00000000:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 1003 2 0000000000000000 0
+`)
+	// IPv6 is disabled.
+	listeners, err := readListeners(procPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []listener{
+		{protocol: "tcp", address: "0.0.0.0", port: 22, inode: "1001"},
+		{protocol: "udp", address: "0.0.0.0", port: 53, inode: "1003"},
+	}, listeners)
+}
+
+func TestSocketOwners(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+
+	link := func(pid, fd, target string) {
+		dir := filepath.Join(procPath, pid, "fd")
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+		assert.NoError(t, os.Symlink(target, filepath.Join(dir, fd)))
+	}
+	link("100", "3", "socket:[1001]")
+	link("100", "4", "/var/log/sshd.log")
+	// The forked child shares the socket.
+	link("101", "3", "socket:[1001]")
+	link("200", "5", "socket:[1003]")
+
+	owners := socketOwners(procPath, []process{{pid: 101, name: "sshd"}, {pid: 100, name: "sshd"}, {pid: 200, name: "dnsmasq"}})
+	assert.Equal(t, map[string]process{
+		"1001": {pid: 100, name: "sshd"},
+		"1003": {pid: 200, name: "dnsmasq"},
+	}, owners)
+}
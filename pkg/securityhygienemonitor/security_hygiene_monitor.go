@@ -0,0 +1,301 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securityhygienemonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	shtypes "k8s.io/node-problem-detector/pkg/securityhygienemonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const SecurityHygieneMonitorName = "security-hygiene-monitor"
+
+const (
+	blockedProcessReason     = "BlockedProcess"
+	unexpectedListenerReason = "UnexpectedListener"
+	// maxCmdlineLength is the maximum length of the command lines in the events.
+	maxCmdlineLength = 256
+)
+
+func init() {
+	problemdaemon.Register(SecurityHygieneMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewSecurityHygieneMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type securityHygieneMonitor struct {
+	configPath string
+	config     shtypes.SecurityHygieneConfig
+	// readProcesses reads all processes of the node.
+	readProcesses func() ([]process, error)
+	// readListeners reads the listening sockets of the node.
+	readListeners func() ([]listener, error)
+	// socketOwners maps the socket inodes to the processes owning them.
+	socketOwners func([]process) map[string]process
+	// reported records the findings reported in the last check, so that they are only
+	// reported again after they disappear.
+	reported   map[string]bool
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewSecurityHygieneMonitorOrDie creates a security hygiene monitor, panics if error occurs.
+func NewSecurityHygieneMonitorOrDie(configPath string) types.Monitor {
+	shm := securityHygieneMonitor{
+		configPath: configPath,
+		reported:   map[string]bool{},
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &shm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = shm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = shm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, shm.config, err)
+	}
+	shm.readProcesses = func() ([]process, error) { return readProcesses(shm.config.ProcPath) }
+	shm.readListeners = func() ([]listener, error) { return readListeners(shm.config.ProcPath) }
+	shm.socketOwners = func(processes []process) map[string]process { return socketOwners(shm.config.ProcPath, processes) }
+
+	// A 1000 size channel should be big enough.
+	shm.statusChan = make(chan *types.Status, 1000)
+
+	if *shm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie()
+	}
+	return &shm
+}
+
+// initializeProblemMetricsOrDie creates the problem counters of the findings and set the
+// value to 0, panic if error occurs.
+func initializeProblemMetricsOrDie() {
+	for _, reason := range []string{blockedProcessReason, unexpectedListenerReason} {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+		if err != nil {
+			glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+		}
+	}
+}
+
+func (shm *securityHygieneMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start security hygiene monitor %s", shm.configPath)
+	problemdaemon.Go(shm, shm.monitorLoop)
+	return shm.statusChan, nil
+}
+
+func (shm *securityHygieneMonitor) Stop() {
+	glog.Infof("Stop security hygiene monitor %s", shm.configPath)
+	shm.tomb.Stop()
+}
+
+func (shm *securityHygieneMonitor) monitorLoop() {
+	defer shm.tomb.Done()
+
+	runTicker := time.NewTicker(shm.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	if status := shm.check(time.Now()); status != nil {
+		shm.statusChan <- status
+	}
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := shm.check(now); status != nil {
+				shm.statusChan <- status
+			}
+		case <-shm.tomb.Stopping():
+			glog.Infof("Security hygiene monitor stopped: %s", shm.configPath)
+			return
+		}
+	}
+}
+
+// finding is a blocked process or an unexpected listener.
+type finding struct {
+	// key identifies the finding across checks.
+	key   string
+	event types.Event
+}
+
+// check looks for blocked processes and unexpected listeners, and returns a status with
+// an event for each one which was not found in the last check.
+func (shm *securityHygieneMonitor) check(now time.Time) *types.Status {
+	processes, err := shm.readProcesses()
+	if err != nil {
+		glog.Errorf("Failed to read processes: %v", err)
+		return nil
+	}
+	findings := shm.blockedProcesses(processes, now)
+	if len(shm.config.SensitivePorts) > 0 {
+		listeners, err := shm.readListeners()
+		if err != nil {
+			glog.Errorf("Failed to read listening sockets: %v", err)
+		} else {
+			findings = append(findings, shm.unexpectedListeners(listeners, shm.socketOwners(processes), now)...)
+		}
+	}
+
+	reported := map[string]bool{}
+	var events []types.Event
+	for _, f := range findings {
+		reported[f.key] = true
+		if shm.reported[f.key] {
+			continue
+		}
+		glog.Warningf("Security hygiene problem found: %s", f.event.Message)
+		events = append(events, f.event)
+	}
+	shm.reported = reported
+	if len(events) == 0 {
+		return nil
+	}
+
+	if *shm.config.EnableMetricsReporting {
+		for _, event := range events {
+			err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(event.Reason, 1)
+			if err != nil {
+				glog.Errorf("Failed to update problem counter metrics for %q: %v", event.Reason, err)
+			}
+		}
+	}
+	return &types.Status{
+		Source: shm.config.Source,
+		Events: events,
+	}
+}
+
+// blockedProcesses returns the processes matching the blocklist.
+func (shm *securityHygieneMonitor) blockedProcesses(processes []process, now time.Time) []finding {
+	var findings []finding
+	for _, p := range processes {
+		for _, rule := range shm.config.BlockedProcesses {
+			if !rule.Matches(p.name, p.cmdline) {
+				continue
+			}
+			findings = append(findings, finding{
+				key: fmt.Sprintf("process/%d/%s", p.pid, p.startTime),
+				event: types.Event{
+					Severity:    types.Warn,
+					Timestamp:   now,
+					Reason:      blockedProcessReason,
+					Message:     fmt.Sprintf("blocked process %s is running: %s", describe(p), truncate(p.cmdline)),
+					Annotations: processAnnotations(p),
+				},
+			})
+			break
+		}
+	}
+	return findings
+}
+
+// unexpectedListeners returns the sockets listening on sensitive ports which are not
+// owned by the allowed processes. Sockets whose owner is unknown, e.g. because node
+// problem detector does not run in the host PID namespace, are reported as well.
+func (shm *securityHygieneMonitor) unexpectedListeners(listeners []listener, owners map[string]process, now time.Time) []finding {
+	var findings []finding
+	for _, l := range listeners {
+		port := shm.sensitivePort(l)
+		if port == nil {
+			continue
+		}
+		owner, ok := owners[l.inode]
+		if ok && allowed(port, owner) {
+			continue
+		}
+		address := fmt.Sprintf("%s %s", l.protocol, net.JoinHostPort(l.address, strconv.Itoa(l.port)))
+		f := finding{
+			key: fmt.Sprintf("listener/%s/%s", address, l.inode),
+			event: types.Event{
+				Severity:  types.Warn,
+				Timestamp: now,
+				Reason:    unexpectedListenerReason,
+			},
+		}
+		if ok {
+			f.event.Message = fmt.Sprintf("process %s is listening on sensitive port %s: %s", describe(owner), address, truncate(owner.cmdline))
+			f.event.Annotations = processAnnotations(owner)
+		} else {
+			f.event.Message = fmt.Sprintf("unknown process is listening on sensitive port %s", address)
+			f.event.Annotations = map[string]string{}
+		}
+		f.event.Annotations["protocol"] = l.protocol
+		f.event.Annotations["address"] = l.address
+		f.event.Annotations["port"] = strconv.Itoa(l.port)
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+func (shm *securityHygieneMonitor) sensitivePort(l listener) *shtypes.SensitivePort {
+	for _, port := range shm.config.SensitivePorts {
+		if port.Protocol == l.protocol && port.Port == l.port {
+			return port
+		}
+	}
+	return nil
+}
+
+func allowed(port *shtypes.SensitivePort, p process) bool {
+	for _, name := range port.AllowedProcesses {
+		if name == p.name {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns the name, pid and uid of the process.
+func describe(p process) string {
+	return fmt.Sprintf("%s (pid %d, uid %s)", p.name, p.pid, p.uid)
+}
+
+func processAnnotations(p process) map[string]string {
+	return map[string]string{
+		"process": p.name,
+		"pid":     strconv.Itoa(p.pid),
+		"uid":     p.uid,
+		"cmdline": truncate(p.cmdline),
+	}
+}
+
+func truncate(s string) string {
+	if len(s) <= maxCmdlineLength {
+		return s
+	}
+	return s[:maxCmdlineLength] + "..."
+}
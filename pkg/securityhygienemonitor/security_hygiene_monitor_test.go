@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securityhygienemonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	shtypes "k8s.io/node-problem-detector/pkg/securityhygienemonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(SecurityHygieneMonitorName) },
+		"Security hygiene monitor failed to register itself as a problem daemon.")
+}
+
+func TestCheck(t *testing.T) {
+	disabled := false
+	shm := &securityHygieneMonitor{
+		config: shtypes.SecurityHygieneConfig{
+			BlockedProcesses: []*shtypes.ProcessRule{{Name: "xmrig|minerd"}},
+			SensitivePorts: []*shtypes.SensitivePort{
+				{Port: 22, AllowedProcesses: []string{"sshd"}},
+				{Port: 2379},
+			},
+			EnableMetricsReporting: &disabled,
+		},
+		reported: map[string]bool{},
+	}
+	assert.NoError(t, shm.config.ApplyConfiguration())
+	assert.NoError(t, shm.config.Validate())
+
+	sshd := process{pid: 100, name: "sshd", cmdline: "/usr/sbin/sshd -D", uid: "0", startTime: "10"}
+	miner := process{pid: 200, name: "xmrig", cmdline: "/tmp/xmrig -o pool:3333", uid: "1000", startTime: "20"}
+	nc := process{pid: 300, name: "nc", cmdline: "nc -l -p 22", uid: "1000", startTime: "30"}
+	processes := []process{sshd}
+	listeners := []listener{{protocol: "tcp", address: "0.0.0.0", port: 22, inode: "1"}}
+	shm.readProcesses = func() ([]process, error) { return processes, nil }
+	shm.readListeners = func() ([]listener, error) { return listeners, nil }
+	shm.socketOwners = func([]process) map[string]process {
+		return map[string]process{"1": sshd, "2": nc}
+	}
+	now := time.Now()
+
+	// Allowed listeners are not reported.
+	assert.Nil(t, shm.check(now))
+
+	processes = []process{sshd, miner, nc}
+	listeners = []listener{
+		{protocol: "tcp", address: "0.0.0.0", port: 22, inode: "1"},
+		{protocol: "tcp", address: "::", port: 22, inode: "2"},
+		{protocol: "tcp", address: "127.0.0.1", port: 2379, inode: "3"},
+		{protocol: "udp", address: "0.0.0.0", port: 22, inode: "4"},
+	}
+	status := shm.check(now)
+	assert.Equal(t, &types.Status{
+		Source: "security-hygiene-monitor",
+		Events: []types.Event{
+			{
+				Severity:  types.Warn,
+				Timestamp: now,
+				Reason:    "BlockedProcess",
+				Message:   "blocked process xmrig (pid 200, uid 1000) is running: /tmp/xmrig -o pool:3333",
+				Annotations: map[string]string{
+					"process": "xmrig",
+					"pid":     "200",
+					"uid":     "1000",
+					"cmdline": "/tmp/xmrig -o pool:3333",
+				},
+			},
+			{
+				Severity:  types.Warn,
+				Timestamp: now,
+				Reason:    "UnexpectedListener",
+				Message:   "process nc (pid 300, uid 1000) is listening on sensitive port tcp [::]:22: nc -l -p 22",
+				Annotations: map[string]string{
+					"process":  "nc",
+					"pid":      "300",
+					"uid":      "1000",
+					"cmdline":  "nc -l -p 22",
+					"protocol": "tcp",
+					"address":  "::",
+					"port":     "22",
+				},
+			},
+			{
+				Severity:  types.Warn,
+				Timestamp: now,
+				Reason:    "UnexpectedListener",
+				Message:   "unknown process is listening on sensitive port tcp 127.0.0.1:2379",
+				Annotations: map[string]string{
+					"protocol": "tcp",
+					"address":  "127.0.0.1",
+					"port":     "2379",
+				},
+			},
+		},
+	}, status)
+
+	// Findings are only reported once.
+	assert.Nil(t, shm.check(now))
+
+	// Findings are reported again after they disappear.
+	processes = []process{sshd}
+	listeners = nil
+	assert.Nil(t, shm.check(now))
+	processes = []process{sshd, miner}
+	status = shm.check(now)
+	assert.Len(t, status.Events, 1)
+	assert.Equal(t, "BlockedProcess", status.Events[0].Reason)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	defaultSource               = "security-hygiene-monitor"
+	defaultInvokeIntervalString = (60 * time.Second).String()
+	defaultProcPath             = "/proc"
+	defaultEnableMetrics        = true
+)
+
+// ProcessRule matches processes by their name and command line. A process matches when
+// all patterns which are set match.
+type ProcessRule struct {
+	// Name is the regular expression matching the whole process name, i.e. the comm of
+	// the process.
+	Name string `json:"name,omitempty"`
+	// Cmdline is the regular expression matching part of the command line of the process,
+	// with the arguments separated by spaces.
+	Cmdline string `json:"cmdline,omitempty"`
+
+	nameRegexp    *regexp.Regexp
+	cmdlineRegexp *regexp.Regexp
+}
+
+// Matches returns whether the process with the name and command line matches the rule.
+func (r *ProcessRule) Matches(name, cmdline string) bool {
+	if r.nameRegexp != nil && !r.nameRegexp.MatchString(name) {
+		return false
+	}
+	if r.cmdlineRegexp != nil && !r.cmdlineRegexp.MatchString(cmdline) {
+		return false
+	}
+	return true
+}
+
+// SensitivePort is a port on which only the allowed processes may listen.
+type SensitivePort struct {
+	// Port is the port number.
+	Port int `json:"port"`
+	// Protocol is "tcp" or "udp". Default to "tcp".
+	Protocol string `json:"protocol,omitempty"`
+	// AllowedProcesses are the names of the processes allowed to listen on the port. No
+	// process is allowed when it is empty.
+	AllowedProcesses []string `json:"allowedProcesses,omitempty"`
+}
+
+type SecurityHygieneConfig struct {
+	// Source is the source name of the security hygiene monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which the processes and listeners are
+	// checked.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// ProcPath is the path of the procfs of the host. The network namespace of node
+	// problem detector is checked for listeners, so it should run in the host network.
+	ProcPath string `json:"procPath"`
+	// BlockedProcesses are the processes which should not run on the node.
+	BlockedProcesses []*ProcessRule `json:"blockedProcesses"`
+	// SensitivePorts are the ports only the allowed processes may listen on.
+	SensitivePorts []*SensitivePort `json:"sensitivePorts"`
+	// EnableMetricsReporting describes whether to count the blocked processes and the
+	// unexpected listeners as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (shc *SecurityHygieneConfig) ApplyConfiguration() error {
+	if shc.Source == "" {
+		shc.Source = defaultSource
+	}
+	if shc.InvokeIntervalString == "" {
+		shc.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if shc.ProcPath == "" {
+		shc.ProcPath = defaultProcPath
+	}
+	if shc.EnableMetricsReporting == nil {
+		shc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+	for _, port := range shc.SensitivePorts {
+		if port.Protocol == "" {
+			port.Protocol = "tcp"
+		}
+	}
+
+	var err error
+	shc.InvokeInterval, err = time.ParseDuration(shc.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", shc.InvokeIntervalString, err)
+	}
+	for _, rule := range shc.BlockedProcesses {
+		if rule.Name != "" {
+			if rule.nameRegexp, err = regexp.Compile("^(?:" + rule.Name + ")$"); err != nil {
+				return fmt.Errorf("error in parsing blocked process name %q: %v", rule.Name, err)
+			}
+		}
+		if rule.Cmdline != "" {
+			if rule.cmdlineRegexp, err = regexp.Compile(rule.Cmdline); err != nil {
+				return fmt.Errorf("error in parsing blocked process cmdline %q: %v", rule.Cmdline, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (shc *SecurityHygieneConfig) Validate() error {
+	if shc.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", shc.InvokeInterval)
+	}
+	if len(shc.BlockedProcesses) == 0 && len(shc.SensitivePorts) == 0 {
+		return fmt.Errorf("at least one of BlockedProcesses and SensitivePorts must be set")
+	}
+	for _, rule := range shc.BlockedProcesses {
+		if rule.Name == "" && rule.Cmdline == "" {
+			return fmt.Errorf("blocked process rule must set at least one of name and cmdline")
+		}
+	}
+	ports := make(map[string]bool)
+	for _, port := range shc.SensitivePorts {
+		if port.Port <= 0 || port.Port > 65535 {
+			return fmt.Errorf("sensitive port %d must be in [1, 65535]", port.Port)
+		}
+		if port.Protocol != "tcp" && port.Protocol != "udp" {
+			return fmt.Errorf("protocol %q of sensitive port %d must be tcp or udp", port.Protocol, port.Port)
+		}
+		key := fmt.Sprintf("%s/%d", port.Protocol, port.Port)
+		if ports[key] {
+			return fmt.Errorf("sensitive port %s is configured more than once", key)
+		}
+		ports[key] = true
+	}
+	return nil
+}
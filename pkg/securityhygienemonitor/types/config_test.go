@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    SecurityHygieneConfig
+		expectErr bool
+	}{
+		{
+			name: "blocked processes and sensitive ports",
+			config: SecurityHygieneConfig{
+				BlockedProcesses: []*ProcessRule{{Name: "xmrig|minerd"}, {Cmdline: "nc -l"}},
+				SensitivePorts:   []*SensitivePort{{Port: 22, AllowedProcesses: []string{"sshd"}}, {Port: 22, Protocol: "udp"}},
+			},
+		},
+		{
+			name:      "nothing to check",
+			config:    SecurityHygieneConfig{},
+			expectErr: true,
+		},
+		{
+			name: "invalid invoke interval",
+			config: SecurityHygieneConfig{
+				InvokeIntervalString: "1 minute",
+				SensitivePorts:       []*SensitivePort{{Port: 22}},
+			},
+			expectErr: true,
+		},
+		{
+			name:      "invalid process name",
+			config:    SecurityHygieneConfig{BlockedProcesses: []*ProcessRule{{Name: "xmrig("}}},
+			expectErr: true,
+		},
+		{
+			name:      "empty process rule",
+			config:    SecurityHygieneConfig{BlockedProcesses: []*ProcessRule{{}}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid port",
+			config:    SecurityHygieneConfig{SensitivePorts: []*SensitivePort{{Port: 70000}}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid protocol",
+			config:    SecurityHygieneConfig{SensitivePorts: []*SensitivePort{{Port: 22, Protocol: "sctp"}}},
+			expectErr: true,
+		},
+		{
+			name:      "duplicate port",
+			config:    SecurityHygieneConfig{SensitivePorts: []*SensitivePort{{Port: 22}, {Port: 22, Protocol: "tcp"}}},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
+
+func TestProcessRuleMatches(t *testing.T) {
+	config := SecurityHygieneConfig{
+		BlockedProcesses: []*ProcessRule{{Name: "xmrig|minerd"}, {Name: "nc", Cmdline: `\s-l`}},
+	}
+	if err := config.ApplyConfiguration(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, test := range []struct {
+		rule     *ProcessRule
+		name     string
+		cmdline  string
+		expected bool
+	}{
+		{rule: config.BlockedProcesses[0], name: "xmrig", cmdline: "/tmp/xmrig -o pool", expected: true},
+		{rule: config.BlockedProcesses[0], name: "xmrig2", cmdline: "/tmp/xmrig2", expected: false},
+		{rule: config.BlockedProcesses[1], name: "nc", cmdline: "nc -l 4444", expected: true},
+		{rule: config.BlockedProcesses[1], name: "nc", cmdline: "nc example.com 80", expected: false},
+		{rule: config.BlockedProcesses[1], name: "ncat", cmdline: "ncat -l 4444", expected: false},
+	} {
+		if actual := test.rule.Matches(test.name, test.cmdline); actual != test.expected {
+			t.Errorf("Expect %v for process %q %q and rule %+v, got %v", test.expected, test.name, test.cmdline, test.rule, actual)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicymonitor
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	selinux  = "SELinux"
+	apparmor = "AppArmor"
+
+	// socketQueueSize is the number of lines read from the audit socket waiting to be
+	// checked, beyond which lines are dropped.
+	socketQueueSize = 10000
+	// socketRetryPeriod is the period at which the audit socket is reconnected.
+	socketRetryPeriod = 10 * time.Second
+)
+
+// denial is an access denied by SELinux or AppArmor.
+type denial struct {
+	time time.Time
+	// module is "SELinux" or "AppArmor".
+	module string
+	comm   string
+	exe    string
+	// context is the SELinux source context or the AppArmor profile of the process.
+	context string
+	// access is the denied SELinux permissions or AppArmor operation.
+	access string
+	// target describes the object the access was denied to.
+	target string
+	// permissive is true when the denial was logged but not enforced.
+	permissive bool
+}
+
+// String describes the denied context, without the details varying between the
+// denials of the same policy, e.g. the pid.
+func (d *denial) String() string {
+	process := fmt.Sprintf("comm=%q", d.comm)
+	if d.comm == "" {
+		process = fmt.Sprintf("exe=%q", d.exe)
+	}
+	if d.module == selinux {
+		return fmt.Sprintf("SELinux denied { %s } for %s scontext=%s %s", d.access, process, d.context, d.target)
+	}
+	return fmt.Sprintf("AppArmor denied %s for %s profile=%q %s", d.access, process, d.context, d.target)
+}
+
+var (
+	// auditRegexp matches the AVC records of auditd, e.g.
+	//   type=AVC msg=audit(1591234567.123:456): avc:  denied  { write } for ...
+	// and of the kernel log, e.g.
+	//   audit: type=1400 audit(1591234567.123:457): apparmor="DENIED" operation="open" ...
+	auditRegexp       = regexp.MustCompile(`type=(?:AVC|1400) (?:msg=)?audit\((\d+)\.(\d+):\d+\):\s*(.*)$`)
+	selinuxRegexp     = regexp.MustCompile(`avc:\s+(denied|granted)\s+\{\s*([^}]*?)\s*\}`)
+	fieldRegexp       = regexp.MustCompile(`([\w-]+)=("[^"]*"|\S+)`)
+	encodedRegexp     = regexp.MustCompile(`^(?:[0-9A-F]{2})+$`)
+	encodedFieldNames = map[string]bool{"comm": true, "exe": true, "name": true, "path": true, "profile": true}
+)
+
+// parseDenial parses a SELinux or AppArmor denial from an audit record, returns nil if
+// the line is not a denial.
+func parseDenial(line string) *denial {
+	// The fields added by the enriched log format follow a group separator.
+	if i := strings.IndexByte(line, '\x1d'); i >= 0 {
+		line = line[:i]
+	}
+	match := auditRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	sec, _ := strconv.ParseInt(match[1], 10, 64)
+	msec, _ := strconv.ParseInt(match[2], 10, 64)
+	d := &denial{time: time.Unix(sec, msec*int64(time.Millisecond))}
+	body := match[3]
+	fields := parseFields(body)
+	d.comm, d.exe = fields["comm"], fields["exe"]
+
+	if m := selinuxRegexp.FindStringSubmatch(body); m != nil {
+		if m[1] != "denied" {
+			return nil
+		}
+		d.module = selinux
+		d.access = m[2]
+		d.context = fields["scontext"]
+		d.target = fmt.Sprintf("tcontext=%s tclass=%s", fields["tcontext"], fields["tclass"])
+		d.permissive = fields["permissive"] == "1"
+		return d
+	}
+	switch fields["apparmor"] {
+	case "DENIED":
+	case "ALLOWED":
+		// The profile is in complain mode.
+		d.permissive = true
+	default:
+		return nil
+	}
+	d.module = apparmor
+	d.access = fields["operation"]
+	d.context = fields["profile"]
+	if name, ok := fields["name"]; ok {
+		d.target = fmt.Sprintf("name=%q", name)
+	}
+	return d
+}
+
+// parseFields parses the key=value fields of an audit record. The quotes of the values
+// are removed, and the untrusted strings encoded in hex by auditd are decoded like
+// ausearch --interpret does.
+func parseFields(body string) map[string]string {
+	fields := make(map[string]string)
+	for _, m := range fieldRegexp.FindAllStringSubmatch(body, -1) {
+		key, value := m[1], m[2]
+		if _, ok := fields[key]; ok {
+			continue
+		}
+		if strings.HasPrefix(value, `"`) {
+			value = strings.Trim(value, `"`)
+		} else if encodedFieldNames[key] && encodedRegexp.MatchString(value) {
+			if decoded, err := hex.DecodeString(value); err == nil {
+				value = string(decoded)
+			}
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// lineReader reads the audit records logged since the last read.
+type lineReader interface {
+	readLines() ([]string, error)
+}
+
+// logReader reads the lines appended to an audit log since the last read. The log is
+// read from its end on the first read, so that the denials logged before are not
+// counted, and from its start after it is rotated.
+type logReader struct {
+	path string
+	// info is the file last read, nil before the first read.
+	info   os.FileInfo
+	offset int64
+}
+
+func (r *logReader) readLines() ([]string, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return nil, err
+	}
+	if r.info == nil {
+		r.info, r.offset = info, info.Size()
+		return nil, nil
+	}
+	if !os.SameFile(info, r.info) || info.Size() < r.offset {
+		glog.Infof("Audit log %s is rotated, reading it from the start", r.path)
+		r.offset = 0
+	}
+	r.info = info
+	if info.Size() == r.offset {
+		return nil, nil
+	}
+
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(r.offset, 0); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	// The last line may be partially written, it is read with the next lines.
+	end := strings.LastIndexByte(string(data), '\n')
+	if end < 0 {
+		return nil, nil
+	}
+	r.offset += int64(end + 1)
+	return strings.Split(string(data[:end]), "\n"), nil
+}
+
+// socketReader reads the lines written to the unix socket of the audispd af_unix plugin.
+// The lines are queued by a goroutine reading the socket, and reconnecting to it when
+// the connection fails.
+type socketReader struct {
+	path  string
+	lines chan string
+}
+
+func newSocketReader(path string) *socketReader {
+	return &socketReader{
+		path:  path,
+		lines: make(chan string, socketQueueSize),
+	}
+}
+
+func (r *socketReader) readLines() ([]string, error) {
+	var lines []string
+	for {
+		select {
+		case line := <-r.lines:
+			lines = append(lines, line)
+		default:
+			return lines, nil
+		}
+	}
+}
+
+// run reads the socket until stopping is closed.
+func (r *socketReader) run(stopping <-chan struct{}) {
+	for {
+		conn, err := net.Dial("unix", r.path)
+		if err != nil {
+			glog.Errorf("Failed to connect to audit socket %s: %v", r.path, err)
+		} else {
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-stopping:
+					conn.Close()
+				case <-done:
+				}
+			}()
+			r.scan(conn, stopping)
+			close(done)
+			conn.Close()
+		}
+		select {
+		case <-stopping:
+			return
+		case <-time.After(socketRetryPeriod):
+		}
+	}
+}
+
+func (r *socketReader) scan(conn net.Conn, stopping <-chan struct{}) {
+	dropped := 0
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		select {
+		case r.lines <- scanner.Text():
+		default:
+			dropped++
+			if dropped == 1 {
+				glog.Warningf("Dropping audit records, too many are waiting to be checked")
+			}
+		}
+	}
+	if dropped > 0 {
+		glog.Warningf("Dropped %d audit records read from %s", dropped, r.path)
+	}
+	select {
+	case <-stopping:
+		// The connection is closed on stop.
+		return
+	default:
+	}
+	if err := scanner.Err(); err != nil {
+		glog.Errorf("Failed to read audit socket %s: %v", r.path, err)
+	}
+}
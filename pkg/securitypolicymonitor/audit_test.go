@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicymonitor
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDenial(t *testing.T) {
+	testCases := []struct {
+		name string
+		line string
+		want *denial
+	}{
+		{
+			name: "selinux",
+			line: `type=AVC msg=audit(1591234567.250:456): avc:  denied  { read write } for  pid=1234 comm="kubelet" name="kubelet.conf" dev="sda1" ino=123 scontext=system_u:system_r:kubelet_t:s0 tcontext=system_u:object_r:etc_t:s0 tclass=file permissive=0`,
+			want: &denial{
+				time:    time.Unix(1591234567, 250*int64(time.Millisecond)),
+				module:  selinux,
+				comm:    "kubelet",
+				context: "system_u:system_r:kubelet_t:s0",
+				access:  "read write",
+				target:  "tcontext=system_u:object_r:etc_t:s0 tclass=file",
+			},
+		},
+		{
+			name: "selinux permissive with enriched fields",
+			line: "type=AVC msg=audit(1591234567.000:457): avc:  denied  { execute } for  pid=1 comm=\"runc\" scontext=system_u:system_r:container_runtime_t:s0 tcontext=system_u:object_r:tmp_t:s0 tclass=file permissive=1\x1dAUID=\"unset\"",
+			want: &denial{
+				time:       time.Unix(1591234567, 0),
+				module:     selinux,
+				comm:       "runc",
+				context:    "system_u:system_r:container_runtime_t:s0",
+				access:     "execute",
+				target:     "tcontext=system_u:object_r:tmp_t:s0 tclass=file",
+				permissive: true,
+			},
+		},
+		{
+			name: "apparmor in kernel log with hex encoded name",
+			line: `[  123.456789] audit: type=1400 audit(1591234567.500:458): apparmor="DENIED" operation="open" profile="cri-containerd.apparmor.d" name=2F746D702F6D792066696C65 pid=2345 comm="runc:[2:INIT]" requested_mask="r" denied_mask="r" fsuid=0 ouid=0`,
+			want: &denial{
+				time:    time.Unix(1591234567, 500*int64(time.Millisecond)),
+				module:  apparmor,
+				comm:    "runc:[2:INIT]",
+				context: "cri-containerd.apparmor.d",
+				access:  "open",
+				target:  `name="/tmp/my file"`,
+			},
+		},
+		{
+			name: "apparmor complain mode",
+			line: `type=AVC msg=audit(1591234567.000:459): apparmor="ALLOWED" operation="exec" profile="docker-default" name="/bin/sh" pid=1 comm=636F6E7461696E657264`,
+			want: &denial{
+				time:       time.Unix(1591234567, 0),
+				module:     apparmor,
+				comm:       "containerd",
+				context:    "docker-default",
+				access:     "exec",
+				target:     `name="/bin/sh"`,
+				permissive: true,
+			},
+		},
+		{
+			name: "selinux granted",
+			line: `type=AVC msg=audit(1591234567.000:460): avc:  granted  { setsecparam } for  pid=1 comm="load_policy" scontext=system_u:system_r:kernel_t:s0 tcontext=system_u:object_r:security_t:s0 tclass=security`,
+		},
+		{
+			name: "apparmor status",
+			line: `type=AVC msg=audit(1591234567.000:461): apparmor="STATUS" operation="profile_load" profile="unconfined" name="docker-default" pid=1 comm="apparmor_parser"`,
+		},
+		{
+			name: "other record",
+			line: `type=SYSCALL msg=audit(1591234567.000:456): arch=c000003e syscall=257 success=no exit=-13 comm="kubelet" exe="/usr/bin/kubelet"`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, parseDenial(test.line))
+		})
+	}
+}
+
+func TestLogReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	appendLines := func(data string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		assert.NoError(t, err)
+		_, err = f.WriteString(data)
+		assert.NoError(t, err)
+		f.Close()
+	}
+
+	r := &logReader{path: path}
+	_, err = r.readLines()
+	assert.Error(t, err, "audit log does not exist")
+
+	// The lines logged before the first read are skipped.
+	appendLines("old\n")
+	lines, err := r.readLines()
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+
+	// A partially written line is read once complete.
+	appendLines("line 1\nline 2\nline")
+	lines, err = r.readLines()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line 1", "line 2"}, lines)
+	appendLines(" 3\n")
+	lines, err = r.readLines()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line 3"}, lines)
+
+	// A rotated log is read from its start.
+	assert.NoError(t, os.Rename(path, path+".1"))
+	appendLines("line 4\n")
+	lines, err = r.readLines()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line 4"}, lines)
+}
+
+func TestSocketReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audispd_events")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	r := newSocketReader(path)
+	stopping := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		r.run(stopping)
+		close(stopped)
+	}()
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("line 1\nline 2\n"))
+	assert.NoError(t, err)
+
+	var lines []string
+	for i := 0; i < 100 && len(lines) < 2; i++ {
+		read, err := r.readLines()
+		assert.NoError(t, err)
+		lines = append(lines, read...)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, []string{"line 1", "line 2"}, lines)
+
+	close(stopping)
+	<-stopped
+	conn.Close()
+}
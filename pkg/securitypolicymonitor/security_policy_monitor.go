@@ -0,0 +1,218 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicymonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	sptypes "k8s.io/node-problem-detector/pkg/securitypolicymonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const SecurityPolicyMonitorName = "security-policy-monitor"
+
+const problemReason = "SecurityPolicyProblem"
+
+func init() {
+	problemdaemon.Register(SecurityPolicyMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewSecurityPolicyMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+type securityPolicyMonitor struct {
+	configPath string
+	config     sptypes.SecurityPolicyConfig
+	// reader reads the audit records from the audit log or the audit socket.
+	reader lineReader
+	// denials are the counted denials in the window, oldest first.
+	denials []*denial
+	// spiking records whether the problem of the denials in the window is reported, so
+	// that it is only reported again after the denials drop below the threshold.
+	spiking    bool
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewSecurityPolicyMonitorOrDie creates a security policy monitor, panics if error occurs.
+func NewSecurityPolicyMonitorOrDie(configPath string) types.Monitor {
+	spm := securityPolicyMonitor{
+		configPath: configPath,
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &spm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = spm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = spm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, spm.config, err)
+	}
+
+	// A 1000 size channel should be big enough.
+	spm.statusChan = make(chan *types.Status, 1000)
+
+	if *spm.config.EnableMetricsReporting {
+		initializeProblemMetricsOrDie()
+	}
+	return &spm
+}
+
+// initializeProblemMetricsOrDie creates the problem counter of the denial spikes and set
+// the value to 0, panic if error occurs.
+func initializeProblemMetricsOrDie() {
+	err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(problemReason, 0)
+	if err != nil {
+		glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", problemReason, err)
+	}
+}
+
+func (spm *securityPolicyMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start security policy monitor %s", spm.configPath)
+	if spm.config.AuditSocketPath != "" {
+		reader := newSocketReader(spm.config.AuditSocketPath)
+		problemdaemon.Go(spm, func() { reader.run(spm.tomb.Stopping()) })
+		spm.reader = reader
+	} else {
+		spm.reader = &logReader{path: spm.config.AuditLogPath}
+	}
+	problemdaemon.Go(spm, spm.monitorLoop)
+	return spm.statusChan, nil
+}
+
+func (spm *securityPolicyMonitor) Stop() {
+	glog.Infof("Stop security policy monitor %s", spm.configPath)
+	spm.tomb.Stop()
+}
+
+func (spm *securityPolicyMonitor) monitorLoop() {
+	defer spm.tomb.Done()
+
+	runTicker := time.NewTicker(spm.config.InvokeInterval)
+	defer runTicker.Stop()
+
+	// Read the audit log up to its end, the denials are counted from there.
+	spm.check(time.Now())
+
+	for {
+		select {
+		case now := <-runTicker.C:
+			if status := spm.check(now); status != nil {
+				spm.statusChan <- status
+			}
+		case <-spm.tomb.Stopping():
+			glog.Infof("Security policy monitor stopped: %s", spm.configPath)
+			return
+		}
+	}
+}
+
+// check reads the new denials, and returns a status with a problem event when the
+// denials in the window reach the threshold.
+func (spm *securityPolicyMonitor) check(now time.Time) *types.Status {
+	lines, err := spm.reader.readLines()
+	if err != nil {
+		glog.Errorf("Failed to read audit records: %v", err)
+	}
+	for _, line := range lines {
+		d := parseDenial(line)
+		if d == nil || (d.permissive && !spm.config.IncludePermissive) {
+			continue
+		}
+		if !spm.config.Matches(d.comm, d.exe, d.context) {
+			continue
+		}
+		glog.V(3).Infof("Counting denial %s", d)
+		spm.denials = append(spm.denials, d)
+	}
+	windowStart := now.Add(-spm.config.Window)
+	for len(spm.denials) > 0 && !spm.denials[0].time.After(windowStart) {
+		spm.denials = spm.denials[1:]
+	}
+
+	if len(spm.denials) < spm.config.Threshold {
+		spm.spiking = false
+		return nil
+	}
+	if spm.spiking {
+		return nil
+	}
+	spm.spiking = true
+	message := spm.message()
+	glog.Warningf("Security policy problem: %s", message)
+	if *spm.config.EnableMetricsReporting {
+		err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(problemReason, 1)
+		if err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", problemReason, err)
+		}
+	}
+	return &types.Status{
+		Source: spm.config.Source,
+		Events: []types.Event{{
+			Severity:  types.Warn,
+			Timestamp: now,
+			Reason:    problemReason,
+			Message:   message,
+		}},
+	}
+}
+
+// message describes the denials in the window, with the most denied contexts first.
+func (spm *securityPolicyMonitor) message() string {
+	counts := make(map[string]int)
+	for _, d := range spm.denials {
+		counts[d.String()]++
+	}
+	var contexts []string
+	for context := range counts {
+		contexts = append(contexts, context)
+	}
+	sort.Slice(contexts, func(i, j int) bool {
+		if counts[contexts[i]] != counts[contexts[j]] {
+			return counts[contexts[i]] > counts[contexts[j]]
+		}
+		return contexts[i] < contexts[j]
+	})
+	var described []string
+	for i, context := range contexts {
+		if i == spm.config.MaxContexts {
+			described = append(described, fmt.Sprintf("and %d more", len(contexts)-i))
+			break
+		}
+		described = append(described, fmt.Sprintf("%s (%d times)", context, counts[context]))
+	}
+	return fmt.Sprintf("%d SELinux/AppArmor denials of the kubelet or the container runtime in the last %v: %s",
+		len(spm.denials), spm.config.Window, strings.Join(described, "; "))
+}
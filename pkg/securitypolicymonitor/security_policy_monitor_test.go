@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitypolicymonitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	sptypes "k8s.io/node-problem-detector/pkg/securitypolicymonitor/types"
+)
+
+// fakeReader returns the lines set since the last read.
+type fakeReader struct {
+	lines []string
+}
+
+func (r *fakeReader) readLines() ([]string, error) {
+	lines := r.lines
+	r.lines = nil
+	return lines, nil
+}
+
+func selinuxDenial(t time.Time, comm, tclass string) string {
+	return fmt.Sprintf(`type=AVC msg=audit(%d.000:1): avc:  denied  { write } for  pid=1 comm="%s" scontext=system_u:system_r:container_runtime_t:s0 tcontext=system_u:object_r:var_lib_t:s0 tclass=%s permissive=0`,
+		t.Unix(), comm, tclass)
+}
+
+func TestCheck(t *testing.T) {
+	disabled := false
+	config := sptypes.SecurityPolicyConfig{
+		Threshold:              3,
+		WindowString:           "5m",
+		MaxContexts:            1,
+		EnableMetricsReporting: &disabled,
+	}
+	assert.NoError(t, config.ApplyConfiguration())
+	assert.NoError(t, config.Validate())
+	reader := &fakeReader{}
+	spm := &securityPolicyMonitor{config: config, reader: reader}
+
+	now := time.Unix(1591234567, 0)
+	reader.lines = []string{
+		selinuxDenial(now, "containerd", "dir"),
+		selinuxDenial(now, "containerd", "file"),
+		// Denials of other processes and other records are not counted.
+		selinuxDenial(now, "sshd", "file"),
+		`type=SYSCALL msg=audit(1591234567.000:1): arch=c000003e syscall=257 success=no exit=-13 comm="containerd"`,
+	}
+	assert.Nil(t, spm.check(now), "denials are below the threshold")
+
+	reader.lines = []string{selinuxDenial(now.Add(time.Minute), "kubelet", "dir")}
+	status := spm.check(now.Add(time.Minute))
+	if assert.NotNil(t, status) && assert.Len(t, status.Events, 1) {
+		assert.Equal(t, problemReason, status.Events[0].Reason)
+		assert.Equal(t, `3 SELinux/AppArmor denials of the kubelet or the container runtime in the last 5m0s: `+
+			`SELinux denied { write } for comm="containerd" scontext=system_u:system_r:container_runtime_t:s0 tcontext=system_u:object_r:var_lib_t:s0 tclass=dir (1 times); and 2 more`,
+			status.Events[0].Message)
+	}
+
+	reader.lines = []string{selinuxDenial(now.Add(2*time.Minute), "kubelet", "dir")}
+	assert.Nil(t, spm.check(now.Add(2*time.Minute)), "the spike is only reported once")
+
+	// The spike is reported again after the denials age out of the window.
+	assert.Nil(t, spm.check(now.Add(6*time.Minute)))
+	reader.lines = []string{
+		selinuxDenial(now.Add(6*time.Minute), "runc", "file"),
+		selinuxDenial(now.Add(6*time.Minute), "runc", "file"),
+	}
+	status = spm.check(now.Add(6 * time.Minute))
+	if assert.NotNil(t, status) && assert.Len(t, status.Events, 1) {
+		assert.Contains(t, status.Events[0].Message, `comm="runc"`)
+		assert.Contains(t, status.Events[0].Message, `(2 times); and 1 more`)
+	}
+}
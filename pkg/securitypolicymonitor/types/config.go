@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"time"
+)
+
+var (
+	defaultSource               = "security-policy-monitor"
+	defaultInvokeIntervalString = (30 * time.Second).String()
+	defaultAuditLogPath         = "/var/log/audit/audit.log"
+	defaultProcesses            = []string{"kubelet", "containerd", "containerd-shim.*", "dockerd", "docker-init", "crio", "conmon", "runc", "crun"}
+	defaultThreshold            = 10
+	defaultWindowString         = (5 * time.Minute).String()
+	defaultMaxContexts          = 5
+	defaultEnableMetrics        = true
+)
+
+type SecurityPolicyConfig struct {
+	// Source is the source name of the security policy monitor.
+	Source string `json:"source"`
+	// InvokeIntervalString is the interval at which the new denials are read.
+	InvokeIntervalString string        `json:"invokeInterval"`
+	InvokeInterval       time.Duration `json:"-"`
+	// AuditLogPath is the audit log the denials are read from, e.g. the auditd log or the
+	// kernel log on nodes without auditd.
+	AuditLogPath string `json:"auditLogPath"`
+	// AuditSocketPath is the unix socket of the audispd af_unix plugin, in string format.
+	// When set, the denials are read from the socket instead of the audit log.
+	AuditSocketPath string `json:"auditSocketPath"`
+	// Processes are the regular expressions matching the whole process name (comm),
+	// executable path or executable name of the denied processes counted. Default to the kubelet and the
+	// container runtimes.
+	Processes []string `json:"processes"`
+	// Contexts are the regular expressions matching part of the SELinux source context or
+	// the AppArmor profile of the denied processes counted, in addition to Processes.
+	Contexts []string `json:"contexts"`
+	// IncludePermissive describes whether to count the denials which are logged but not
+	// enforced, i.e. of permissive SELinux domains and AppArmor profiles in complain mode.
+	IncludePermissive bool `json:"includePermissive"`
+	// Threshold is the number of denials in the window reporting a problem.
+	Threshold int `json:"threshold"`
+	// WindowString is the window the denials are counted over.
+	WindowString string        `json:"window"`
+	Window       time.Duration `json:"-"`
+	// MaxContexts is the number of distinct denied contexts in the problem message.
+	MaxContexts int `json:"maxContexts"`
+	// EnableMetricsReporting describes whether to count the security policy problems as
+	// metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+
+	processRegexps []*regexp.Regexp
+	contextRegexps []*regexp.Regexp
+}
+
+// ApplyConfiguration applies default configurations.
+func (spc *SecurityPolicyConfig) ApplyConfiguration() error {
+	if spc.Source == "" {
+		spc.Source = defaultSource
+	}
+	if spc.InvokeIntervalString == "" {
+		spc.InvokeIntervalString = defaultInvokeIntervalString
+	}
+	if spc.AuditLogPath == "" {
+		spc.AuditLogPath = defaultAuditLogPath
+	}
+	if spc.Processes == nil {
+		spc.Processes = defaultProcesses
+	}
+	if spc.Threshold == 0 {
+		spc.Threshold = defaultThreshold
+	}
+	if spc.WindowString == "" {
+		spc.WindowString = defaultWindowString
+	}
+	if spc.MaxContexts == 0 {
+		spc.MaxContexts = defaultMaxContexts
+	}
+	if spc.EnableMetricsReporting == nil {
+		spc.EnableMetricsReporting = &defaultEnableMetrics
+	}
+
+	var err error
+	spc.InvokeInterval, err = time.ParseDuration(spc.InvokeIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing InvokeIntervalString %q: %v", spc.InvokeIntervalString, err)
+	}
+	spc.Window, err = time.ParseDuration(spc.WindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing WindowString %q: %v", spc.WindowString, err)
+	}
+	spc.processRegexps = nil
+	for _, process := range spc.Processes {
+		r, err := regexp.Compile("^(?:" + process + ")$")
+		if err != nil {
+			return fmt.Errorf("error in parsing process %q: %v", process, err)
+		}
+		spc.processRegexps = append(spc.processRegexps, r)
+	}
+	spc.contextRegexps = nil
+	for _, context := range spc.Contexts {
+		r, err := regexp.Compile(context)
+		if err != nil {
+			return fmt.Errorf("error in parsing context %q: %v", context, err)
+		}
+		spc.contextRegexps = append(spc.contextRegexps, r)
+	}
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (spc *SecurityPolicyConfig) Validate() error {
+	if spc.InvokeInterval <= time.Duration(0) {
+		return fmt.Errorf("InvokeInterval %v must be above 0s", spc.InvokeInterval)
+	}
+	if spc.Window < spc.InvokeInterval {
+		return fmt.Errorf("Window %v must not be less than InvokeInterval %v", spc.Window, spc.InvokeInterval)
+	}
+	if spc.Threshold < 1 {
+		return fmt.Errorf("Threshold %d must be positive", spc.Threshold)
+	}
+	if spc.MaxContexts < 1 {
+		return fmt.Errorf("MaxContexts %d must be positive", spc.MaxContexts)
+	}
+	if len(spc.Processes) == 0 && len(spc.Contexts) == 0 {
+		return fmt.Errorf("at least one of Processes and Contexts must be set")
+	}
+	return nil
+}
+
+// Matches returns whether the denials of the process with the name (comm), executable
+// and SELinux source context or AppArmor profile are counted.
+func (spc *SecurityPolicyConfig) Matches(comm, exe, context string) bool {
+	for _, r := range spc.processRegexps {
+		if (comm != "" && r.MatchString(comm)) || (exe != "" && (r.MatchString(exe) || r.MatchString(path.Base(exe)))) {
+			return true
+		}
+	}
+	for _, r := range spc.contextRegexps {
+		if context != "" && r.MatchString(context) {
+			return true
+		}
+	}
+	return false
+}
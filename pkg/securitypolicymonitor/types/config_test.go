@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    SecurityPolicyConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: SecurityPolicyConfig{},
+		},
+		{
+			name:   "contexts only",
+			config: SecurityPolicyConfig{Processes: []string{}, Contexts: []string{"container_runtime_t"}, AuditSocketPath: "/var/run/audispd_events"},
+		},
+		{
+			name:      "invalid process",
+			config:    SecurityPolicyConfig{Processes: []string{"kubelet("}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid context",
+			config:    SecurityPolicyConfig{Contexts: []string{"["}},
+			expectErr: true,
+		},
+		{
+			name:      "nothing matched",
+			config:    SecurityPolicyConfig{Processes: []string{}},
+			expectErr: true,
+		},
+		{
+			name:      "window shorter than invoke interval",
+			config:    SecurityPolicyConfig{InvokeIntervalString: "10m", WindowString: "5m"},
+			expectErr: true,
+		},
+		{
+			name:      "negative threshold",
+			config:    SecurityPolicyConfig{Threshold: -1},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	config := SecurityPolicyConfig{Contexts: []string{":container_runtime_t:"}}
+	if err := config.ApplyConfiguration(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, test := range []struct {
+		comm, exe, context string
+		want               bool
+	}{
+		{comm: "kubelet", want: true},
+		{comm: "containerd-shim", exe: "/usr/bin/containerd-shim-runc-v2", want: true},
+		{comm: "kube", exe: "/usr/local/bin/kubelet", want: true},
+		{comm: "sh", context: "system_u:system_r:container_runtime_t:s0", want: true},
+		{comm: "kubelet-helper", exe: "/usr/bin/kubelet-helper", context: "system_u:system_r:container_t:s0:c1,c2"},
+	} {
+		if got := config.Matches(test.comm, test.exe, test.context); got != test.want {
+			t.Errorf("Matches(%q, %q, %q) = %v, want %v", test.comm, test.exe, test.context, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selfmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	"k8s.io/node-problem-detector/pkg/problemmetrics"
+	smtypes "k8s.io/node-problem-detector/pkg/selfmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const (
+	SelfMonitorName = "self-monitor"
+
+	// heapLeakReason is the reason of the event reporting the monotonic growth of the heap.
+	heapLeakReason = "NPDHeapLeak"
+	// goroutineLeakReason is the reason of the event reporting the monotonic growth of the
+	// goroutine count.
+	goroutineLeakReason = "NPDGoroutineLeak"
+)
+
+func init() {
+	problemdaemon.Register(SelfMonitorName, types.ProblemDaemonHandler{
+		CreateProblemDaemonOrDie: NewSelfMonitorOrDie,
+		CmdOptionDescription:     "Set to config file paths."})
+}
+
+// sample is the heap size and the goroutine count of node problem detector at a time.
+type sample struct {
+	time       time.Time
+	heap       int64
+	goroutines int64
+}
+
+type selfMonitor struct {
+	configPath string
+	config     smtypes.SelfMonitorConfig
+	// readSample samples node problem detector.
+	readSample func(now time.Time) sample
+	// exit exits node problem detector with the message.
+	exit func(message string)
+	// samples are the samples in the current window, oldest first.
+	samples    []sample
+	statusChan chan *types.Status
+	tomb       *tomb.Tomb
+}
+
+// NewSelfMonitorOrDie creates a self monitor, panics if error occurs.
+func NewSelfMonitorOrDie(configPath string) types.Monitor {
+	sm := selfMonitor{
+		configPath: configPath,
+		readSample: readSample,
+		exit:       exit,
+		tomb:       tomb.NewTomb(),
+	}
+
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &sm.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	err = sm.config.ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = sm.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate %s configuration %+v: %v", configPath, sm.config, err)
+	}
+
+	// A 1000 size channel should be big enough.
+	sm.statusChan = make(chan *types.Status, 1000)
+
+	if *sm.config.EnableMetricsReporting {
+		for _, reason := range []string{heapLeakReason, goroutineLeakReason} {
+			err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 0)
+			if err != nil {
+				glog.Fatalf("Failed to initialize problem counter metrics for %q: %v", reason, err)
+			}
+		}
+	}
+	return &sm
+}
+
+func readSample(now time.Time) sample {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return sample{time: now, heap: int64(stats.HeapAlloc), goroutines: int64(runtime.NumGoroutine())}
+}
+
+// exit exits with the stacks of all goroutines, which show where the goroutines leak.
+func exit(message string) {
+	glog.Fatalf("Exiting so that node-problem-detector is restarted: %s", message)
+}
+
+func (sm *selfMonitor) Start() (<-chan *types.Status, error) {
+	glog.Infof("Start self monitor %s", sm.configPath)
+	problemdaemon.Go(sm, sm.monitorLoop)
+	return sm.statusChan, nil
+}
+
+func (sm *selfMonitor) Stop() {
+	glog.Infof("Stop self monitor %s", sm.configPath)
+	sm.tomb.Stop()
+}
+
+func (sm *selfMonitor) monitorLoop() {
+	defer sm.tomb.Done()
+
+	sampleTicker := time.NewTicker(sm.config.SampleInterval)
+	defer sampleTicker.Stop()
+
+	// A nil channel blocks forever, until a leak is reported with the restart enabled.
+	var restart <-chan time.Time
+	var restartMessage string
+	for {
+		select {
+		case now := <-sampleTicker.C:
+			status := sm.check(sm.readSample(now))
+			if status == nil {
+				continue
+			}
+			sm.statusChan <- status
+			if *sm.config.Restart && restart == nil {
+				restartMessage = status.Events[0].Message
+				glog.Warningf("Restarting node-problem-detector in %v: %s", sm.config.RestartDelay, restartMessage)
+				restart = time.After(sm.config.RestartDelay)
+			}
+		case <-restart:
+			sm.exit(restartMessage)
+			return
+		case <-sm.tomb.Stopping():
+			glog.Infof("Self monitor stopped: %s", sm.configPath)
+			return
+		}
+	}
+}
+
+// check records the sample, and returns a status with an event for each check whose value
+// grew monotonically above its limit over the window. The samples are cleared once a leak
+// is reported, so that it is only reported again after another window.
+func (sm *selfMonitor) check(s sample) *types.Status {
+	sm.samples = append(sm.samples, s)
+	start := s.time.Add(-sm.config.Window)
+	for len(sm.samples) > 0 && sm.samples[0].time.Before(start) {
+		sm.samples = sm.samples[1:]
+	}
+	// Wait until the window is observed in full.
+	if sm.samples[0].time.Sub(start) >= sm.config.SampleInterval {
+		return nil
+	}
+
+	var events []types.Event
+	if limit := sm.config.HeapGrowthLimit; limit > 0 {
+		if first, last, ok := sm.monotonicGrowth(start, func(s sample) int64 { return s.heap }); ok && last-first > limit {
+			events = append(events, sm.leakEvent(s.time, heapLeakReason, fmt.Sprintf(
+				"node-problem-detector heap grew monotonically from %s to %s over %v, above the limit of %s",
+				mebibytes(first), mebibytes(last), sm.config.Window, sm.config.HeapGrowthLimitString)))
+		}
+	}
+	if limit := int64(*sm.config.GoroutineGrowthLimit); limit > 0 {
+		if first, last, ok := sm.monotonicGrowth(start, func(s sample) int64 { return s.goroutines }); ok && last-first > limit {
+			events = append(events, sm.leakEvent(s.time, goroutineLeakReason, fmt.Sprintf(
+				"node-problem-detector goroutines grew monotonically from %d to %d over %v, above the limit of %d",
+				first, last, sm.config.Window, limit)))
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	sm.samples = nil
+	return &types.Status{Source: sm.config.Source, Events: events}
+}
+
+// monotonicGrowth splits the window starting at start into periods, and returns the lowest
+// values of the first and the last periods if the lowest value of each period is above the
+// one of the previous period.
+func (sm *selfMonitor) monotonicGrowth(start time.Time, value func(sample) int64) (first, last int64, ok bool) {
+	periods := *sm.config.Periods
+	period := sm.config.Window / time.Duration(periods)
+	lowest := make([]*int64, periods)
+	for _, s := range sm.samples {
+		i := int(s.time.Sub(start) / period)
+		if i >= periods {
+			i = periods - 1
+		}
+		if v := value(s); lowest[i] == nil || v < *lowest[i] {
+			lowest[i] = &v
+		}
+	}
+	for i := range lowest {
+		if lowest[i] == nil || (i > 0 && *lowest[i] <= *lowest[i-1]) {
+			return 0, 0, false
+		}
+	}
+	return *lowest[0], *lowest[periods-1], true
+}
+
+func (sm *selfMonitor) leakEvent(now time.Time, reason, message string) types.Event {
+	glog.Warning(message)
+	if *sm.config.EnableMetricsReporting {
+		if err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(reason, 1); err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", reason, err)
+		}
+	}
+	return types.Event{
+		Severity:  types.Warn,
+		Timestamp: now,
+		Reason:    reason,
+		Message:   message,
+	}
+}
+
+// mebibytes formats the bytes in MiB, e.g. "40.0MiB".
+func mebibytes(bytes int64) string {
+	return fmt.Sprintf("%.1fMiB", float64(bytes)/(1<<20))
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selfmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/problemdaemon"
+	smtypes "k8s.io/node-problem-detector/pkg/selfmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+func TestRegistration(t *testing.T) {
+	assert.NotPanics(t,
+		func() { problemdaemon.GetProblemDaemonHandlerOrDie(SelfMonitorName) },
+		"Self monitor failed to register itself as a problem daemon.")
+}
+
+func newTestMonitor(t *testing.T) *selfMonitor {
+	disabled := false
+	periods := 4
+	goroutineLimit := 100
+	sm := &selfMonitor{
+		config: smtypes.SelfMonitorConfig{
+			SampleIntervalString:   "1m",
+			WindowString:           "1h",
+			Periods:                &periods,
+			HeapGrowthLimitString:  "100Mi",
+			GoroutineGrowthLimit:   &goroutineLimit,
+			EnableMetricsReporting: &disabled,
+		},
+	}
+	assert.NoError(t, sm.config.ApplyConfiguration())
+	assert.NoError(t, sm.config.Validate())
+	return sm
+}
+
+func TestCheck(t *testing.T) {
+	start := time.Now()
+	steady := func(int) int64 { return 50 }
+	// sawtooth grows between the garbage collections, but is back to 40 after each.
+	sawtooth := func(m int) int64 { return 40 + int64(m%10)*20 }
+	// leaking grows by 3 after each garbage collection, 180 per hour.
+	leaking := func(m int) int64 { return 40 + int64(m)*3 + int64(m%10)*20 }
+	// slow grows by 1 after each garbage collection, 60 per hour.
+	slow := func(m int) int64 { return 40 + int64(m) + int64(m%10)*20 }
+	// burst has a burst of goroutines within the last period.
+	burst := func(m int) int64 {
+		if m > 50 && m < 55 {
+			return 1000
+		}
+		return 50
+	}
+	for _, test := range []struct {
+		desc       string
+		minutes    int
+		heap       func(minute int) int64
+		goroutines func(minute int) int64
+		// reasons are the reasons of the events expected.
+		reasons []string
+		message string
+	}{
+		{
+			desc:       "garbage collection cycles are not a leak",
+			minutes:    120,
+			heap:       sawtooth,
+			goroutines: steady,
+		},
+		{
+			desc:       "growth below the limit is not a leak",
+			minutes:    120,
+			heap:       slow,
+			goroutines: steady,
+		},
+		{
+			desc:       "a leak is only reported once the window is observed in full",
+			minutes:    30,
+			heap:       leaking,
+			goroutines: steady,
+		},
+		{
+			desc:       "heap leak",
+			minutes:    60,
+			heap:       leaking,
+			goroutines: steady,
+			reasons:    []string{heapLeakReason},
+			message:    "node-problem-detector heap grew monotonically from 40.0MiB to 190.0MiB over 1h0m0s, above the limit of 100Mi",
+		},
+		{
+			desc:       "a leak is only reported again after another window",
+			minutes:    90,
+			heap:       leaking,
+			goroutines: steady,
+			reasons:    []string{heapLeakReason},
+		},
+		{
+			desc:       "goroutine leak",
+			minutes:    60,
+			heap:       steady,
+			goroutines: leaking,
+			reasons:    []string{goroutineLeakReason},
+		},
+		{
+			desc:       "a burst of goroutines is not monotonic growth",
+			minutes:    120,
+			heap:       steady,
+			goroutines: burst,
+		},
+	} {
+		sm := newTestMonitor(t)
+		var events []types.Event
+		for m := 0; m <= test.minutes; m++ {
+			s := sample{time: start.Add(time.Duration(m) * time.Minute), heap: test.heap(m) << 20, goroutines: test.goroutines(m)}
+			if status := sm.check(s); status != nil {
+				events = append(events, status.Events...)
+			}
+		}
+
+		var reasons []string
+		for _, event := range events {
+			reasons = append(reasons, event.Reason)
+		}
+		assert.Equal(t, test.reasons, reasons, test.desc)
+		if len(events) > 0 {
+			assert.Equal(t, types.Warn, events[0].Severity, test.desc)
+			assert.Equal(t, start.Add(time.Hour), events[0].Timestamp, test.desc)
+		}
+		if test.message != "" {
+			assert.Equal(t, test.message, events[0].Message, test.desc)
+		}
+	}
+}
+
+func TestRestart(t *testing.T) {
+	sm := newTestMonitor(t)
+	restart := true
+	sm.config.Restart = &restart
+	sm.config.SampleInterval = time.Millisecond
+	sm.config.RestartDelay = 10 * time.Millisecond
+	sm.config.Window = 4 * time.Millisecond
+	m := 0
+	sm.readSample = func(now time.Time) sample {
+		m++
+		return sample{time: now, goroutines: int64(m) * 100}
+	}
+	exited := make(chan string, 1)
+	sm.exit = func(message string) { exited <- message }
+	sm.statusChan = make(chan *types.Status, 1000)
+	sm.tomb = tomb.NewTomb()
+
+	go sm.monitorLoop()
+	select {
+	case message := <-exited:
+		assert.Contains(t, message, "goroutines grew monotonically")
+	case <-time.After(10 * time.Second):
+		t.Fatal("node problem detector was not restarted")
+	}
+	status := <-sm.statusChan
+	assert.Equal(t, goroutineLeakReason, status.Events[0].Reason)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	defaultSource                 = "self-monitor"
+	defaultSampleIntervalString   = (1 * time.Minute).String()
+	defaultWindowString           = (6 * time.Hour).String()
+	defaultPeriods                = 4
+	defaultHeapGrowthLimitString  = "256Mi"
+	defaultGoroutineGrowthLimit   = 1000
+	defaultRestart                = false
+	defaultRestartDelayString     = (1 * time.Minute).String()
+	defaultEnableMetricsReporting = true
+)
+
+type SelfMonitorConfig struct {
+	// Source is the source name of the self monitor.
+	Source string `json:"source"`
+	// SampleIntervalString is the interval at which the heap size and the goroutine count
+	// of node problem detector are sampled.
+	SampleIntervalString string        `json:"sampleInterval"`
+	SampleInterval       time.Duration `json:"-"`
+	// WindowString is the window over which the growth is measured.
+	WindowString string        `json:"window"`
+	Window       time.Duration `json:"-"`
+	// Periods is the number of consecutive periods the window is split into. The growth is
+	// monotonic when the lowest sample of each period is above the one of the previous
+	// period, so that the garbage collection cycles and the bursts of work are ignored.
+	Periods *int `json:"periods,omitempty"`
+	// HeapGrowthLimitString is the maximum monotonic growth of the heap over the window,
+	// e.g. "256Mi". 0 disables the heap check.
+	HeapGrowthLimitString string `json:"heapGrowthLimit"`
+	HeapGrowthLimit       int64  `json:"-"`
+	// GoroutineGrowthLimit is the maximum monotonic growth of the goroutine count over the
+	// window. 0 disables the goroutine check.
+	GoroutineGrowthLimit *int `json:"goroutineGrowthLimit,omitempty"`
+	// Restart describes whether node problem detector exits after reporting a leak, so
+	// that its supervisor restarts it.
+	Restart *bool `json:"restart,omitempty"`
+	// RestartDelayString is how long node problem detector keeps running after reporting a
+	// leak before it exits, so that the leak is exported.
+	RestartDelayString string        `json:"restartDelay"`
+	RestartDelay       time.Duration `json:"-"`
+	// EnableMetricsReporting describes whether to count the heap and goroutine leaks of
+	// node-problem-detector as metrics or not.
+	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+}
+
+// ApplyConfiguration applies default configurations.
+func (sc *SelfMonitorConfig) ApplyConfiguration() error {
+	if sc.Source == "" {
+		sc.Source = defaultSource
+	}
+	if sc.SampleIntervalString == "" {
+		sc.SampleIntervalString = defaultSampleIntervalString
+	}
+	if sc.WindowString == "" {
+		sc.WindowString = defaultWindowString
+	}
+	if sc.Periods == nil {
+		sc.Periods = &defaultPeriods
+	}
+	if sc.HeapGrowthLimitString == "" {
+		sc.HeapGrowthLimitString = defaultHeapGrowthLimitString
+	}
+	if sc.GoroutineGrowthLimit == nil {
+		sc.GoroutineGrowthLimit = &defaultGoroutineGrowthLimit
+	}
+	if sc.Restart == nil {
+		sc.Restart = &defaultRestart
+	}
+	if sc.RestartDelayString == "" {
+		sc.RestartDelayString = defaultRestartDelayString
+	}
+	if sc.EnableMetricsReporting == nil {
+		sc.EnableMetricsReporting = &defaultEnableMetricsReporting
+	}
+
+	var err error
+	sc.SampleInterval, err = time.ParseDuration(sc.SampleIntervalString)
+	if err != nil {
+		return fmt.Errorf("error in parsing SampleIntervalString %q: %v", sc.SampleIntervalString, err)
+	}
+	sc.Window, err = time.ParseDuration(sc.WindowString)
+	if err != nil {
+		return fmt.Errorf("error in parsing WindowString %q: %v", sc.WindowString, err)
+	}
+	sc.RestartDelay, err = time.ParseDuration(sc.RestartDelayString)
+	if err != nil {
+		return fmt.Errorf("error in parsing RestartDelayString %q: %v", sc.RestartDelayString, err)
+	}
+	limit, err := resource.ParseQuantity(sc.HeapGrowthLimitString)
+	if err != nil {
+		return fmt.Errorf("error in parsing HeapGrowthLimitString %q: %v", sc.HeapGrowthLimitString, err)
+	}
+	sc.HeapGrowthLimit = limit.Value()
+	return nil
+}
+
+// Validate verifies whether the settings are valid.
+func (sc *SelfMonitorConfig) Validate() error {
+	if sc.SampleInterval <= time.Duration(0) {
+		return fmt.Errorf("SampleInterval %v must be above 0s", sc.SampleInterval)
+	}
+	if *sc.Periods < 2 {
+		return fmt.Errorf("Periods %d must be at least 2", *sc.Periods)
+	}
+	if sc.Window < time.Duration(*sc.Periods)*sc.SampleInterval {
+		return fmt.Errorf("Window %v must hold at least one sample every %v in each of the %d periods",
+			sc.Window, sc.SampleInterval, *sc.Periods)
+	}
+	if sc.HeapGrowthLimit < 0 {
+		return fmt.Errorf("HeapGrowthLimit %s must not be negative", sc.HeapGrowthLimitString)
+	}
+	if *sc.GoroutineGrowthLimit < 0 {
+		return fmt.Errorf("GoroutineGrowthLimit %d must not be negative", *sc.GoroutineGrowthLimit)
+	}
+	if sc.HeapGrowthLimit == 0 && *sc.GoroutineGrowthLimit == 0 {
+		return fmt.Errorf("at least one of HeapGrowthLimit and GoroutineGrowthLimit must be above 0")
+	}
+	if sc.RestartDelay < time.Duration(0) {
+		return fmt.Errorf("RestartDelay %v must not be negative", sc.RestartDelay)
+	}
+	return nil
+}
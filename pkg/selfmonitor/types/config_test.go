@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestApplyConfigurationAndValidate(t *testing.T) {
+	one := 1
+	zero := 0
+	testCases := []struct {
+		name      string
+		config    SelfMonitorConfig
+		expectErr bool
+	}{
+		{
+			name:   "default",
+			config: SelfMonitorConfig{},
+		},
+		{
+			name:   "goroutine check only",
+			config: SelfMonitorConfig{HeapGrowthLimitString: "0"},
+		},
+		{
+			name:      "no check",
+			config:    SelfMonitorConfig{HeapGrowthLimitString: "0", GoroutineGrowthLimit: &zero},
+			expectErr: true,
+		},
+		{
+			name:      "invalid heap growth limit",
+			config:    SelfMonitorConfig{HeapGrowthLimitString: "a lot"},
+			expectErr: true,
+		},
+		{
+			name:      "single period",
+			config:    SelfMonitorConfig{Periods: &one},
+			expectErr: true,
+		},
+		{
+			name:      "window shorter than the periods",
+			config:    SelfMonitorConfig{SampleIntervalString: "1m", WindowString: "3m"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.ApplyConfiguration()
+			if err == nil {
+				err = test.config.Validate()
+			}
+			if test.expectErr && err == nil {
+				t.Errorf("Expect error but got nil for config %+v", test.config)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("Unexpected error %v for config %+v", err, test.config)
+			}
+		})
+	}
+}
+
+func TestDefaultConfiguration(t *testing.T) {
+	config := SelfMonitorConfig{}
+	if err := config.ApplyConfiguration(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.HeapGrowthLimit != 256*1024*1024 {
+		t.Errorf("Unexpected heap growth limit %d", config.HeapGrowthLimit)
+	}
+	if *config.Restart {
+		t.Errorf("Node problem detector should not restart by default")
+	}
+}
@@ -17,7 +17,11 @@ limitations under the License.
 package systemlogmonitor
 
 import (
+	"fmt"
+	"net/url"
 	"regexp"
+	"text/template"
+	"time"
 
 	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	systemlogtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
@@ -44,6 +48,10 @@ type MonitorConfig struct {
 	Rules []systemlogtypes.Rule `json:"rules"`
 	// EnableMetricsReporting describes whether to report problems as metrics or not.
 	EnableMetricsReporting *bool `json:"metricsReporting,omitempty"`
+	// KubeletEndpoint is the base URL of the kubelet API, e.g. "http://127.0.0.1:10255",
+	// whose pod list resolves the pods of the problems with a "cgroup" capture group to
+	// their names and namespaces. Default to only attribute them to the pod UIDs.
+	KubeletEndpoint string `json:"kubeletEndpoint,omitempty"`
 }
 
 // ApplyConfiguration applies default configurations.
@@ -57,15 +65,164 @@ func (mc *MonitorConfig) ApplyDefaultConfiguration() {
 	if mc.WatcherConfig.Lookback == "" {
 		mc.WatcherConfig.Lookback = defaultLookback
 	}
+	for i, rule := range mc.Rules {
+		if rule.Type == systemlogtypes.Frequency && rule.ClearOccurrences == nil {
+			clearOccurrences := rule.Occurrences - 1
+			mc.Rules[i].ClearOccurrences = &clearOccurrences
+		}
+		if rule.Severity == "" {
+			continue
+		}
+		// Invalid severities are kept, so that ValidateRules reports them.
+		if severity, err := types.ParseSeverity(string(rule.Severity)); err == nil {
+			mc.Rules[i].Severity = severity
+		}
+	}
+}
+
+// knownArchitectures are the architectures rules may be restricted to.
+var knownArchitectures = map[string]bool{
+	"386":     true,
+	"amd64":   true,
+	"arm":     true,
+	"arm64":   true,
+	"ppc64le": true,
+	"riscv64": true,
+	"s390x":   true,
 }
 
-// ValidateRules verifies whether the regular expressions in the rules are valid.
-func (mc MonitorConfig) ValidateRules() error {
+// SelectArchitecture drops the rules which do not apply to the architecture.
+func (mc *MonitorConfig) SelectArchitecture(arch string) {
+	var rules []systemlogtypes.Rule
 	for _, rule := range mc.Rules {
+		if appliesTo(rule, arch) {
+			rules = append(rules, rule)
+		}
+	}
+	mc.Rules = rules
+}
+
+func appliesTo(rule systemlogtypes.Rule, arch string) bool {
+	if len(rule.Architectures) == 0 {
+		return true
+	}
+	for _, a := range rule.Architectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRules verifies whether the regular expressions and the templates in the rules, and
+// the lookback limits are valid. It compiles the field patterns of the rules.
+func (mc *MonitorConfig) ValidateRules() error {
+	if mc.MaxLookbackLines < 0 || mc.MaxLookbackBytes < 0 || mc.LookbackReplayRate < 0 {
+		return fmt.Errorf("lookback limits should not be negative")
+	}
+	if mc.KubeletEndpoint != "" {
+		if u, err := url.Parse(mc.KubeletEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid kubelet endpoint %q", mc.KubeletEndpoint)
+		}
+	}
+	for i := range mc.Rules {
+		rule := &mc.Rules[i]
 		_, err := regexp.Compile(rule.Pattern)
 		if err != nil {
 			return err
 		}
+		rule.FieldRegexps = nil
+		for field, pattern := range rule.Fields {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern for field %q: %v", field, err)
+			}
+			if rule.FieldRegexps == nil {
+				rule.FieldRegexps = make(map[string]*regexp.Regexp)
+			}
+			rule.FieldRegexps[field] = re
+		}
+		switch rule.Status {
+		case "", types.True:
+		case types.False:
+			if rule.Type != types.Perm {
+				return fmt.Errorf("rule %q heals a condition, but is not permanent", rule.Reason)
+			}
+		default:
+			return fmt.Errorf("invalid status %q of rule %q", rule.Status, rule.Reason)
+		}
+		if _, err := types.ParseSeverity(string(rule.Severity)); err != nil {
+			return fmt.Errorf("invalid severity of rule %q: %v", rule.Reason, err)
+		}
+		if err := rule.Ownership.Validate(); err != nil {
+			return fmt.Errorf("invalid ownership of rule %q: %v", rule.Reason, err)
+		}
+		if rule.SampleWindow != "" {
+			window, err := time.ParseDuration(rule.SampleWindow)
+			if err != nil {
+				return fmt.Errorf("invalid sample window of rule %q: %v", rule.Reason, err)
+			}
+			if window <= 0 {
+				return fmt.Errorf("sample window of rule %q should be positive", rule.Reason)
+			}
+			if rule.Type != types.Temp {
+				return fmt.Errorf("rule %q is sampled, but is not temporary", rule.Reason)
+			}
+		}
+		if err := mc.validateOccurrences(*rule); err != nil {
+			return err
+		}
+		for _, arch := range rule.Architectures {
+			if !knownArchitectures[arch] {
+				return fmt.Errorf("unknown architecture %q of rule %q", arch, rule.Reason)
+			}
+		}
+		for _, text := range []string{rule.Reason, rule.Message, rule.Instance} {
+			if _, err := template.New("").Parse(text); err != nil {
+				return fmt.Errorf("invalid template %q: %v", text, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateOccurrences verifies whether the occurrence thresholds of a rule are valid.
+func (mc MonitorConfig) validateOccurrences(rule systemlogtypes.Rule) error {
+	if rule.Occurrences < 0 {
+		return fmt.Errorf("occurrences of rule %q should not be negative", rule.Reason)
+	}
+	counted := rule.Occurrences > 1 || rule.OccurrenceWindow != ""
+	switch {
+	case rule.Type == systemlogtypes.Frequency:
+		if rule.Occurrences < 1 {
+			return fmt.Errorf("frequency rule %q should set occurrences", rule.Reason)
+		}
+		if rule.ClearOccurrences != nil && (*rule.ClearOccurrences < 0 || *rule.ClearOccurrences >= rule.Occurrences) {
+			return fmt.Errorf("clearOccurrences of frequency rule %q should be in [0, %d)", rule.Reason, rule.Occurrences)
+		}
+		if rule.Status != "" || rule.Instance != "" || isTemplate(rule.Reason) {
+			return fmt.Errorf("frequency rule %q should not set status, instance or a reason template", rule.Reason)
+		}
+		found := false
+		for _, condition := range mc.DefaultConditions {
+			found = found || condition.Type == rule.Condition
+		}
+		if !found {
+			return fmt.Errorf("condition %q of frequency rule %q is not in the conditions", rule.Condition, rule.Reason)
+		}
+	case rule.ClearOccurrences != nil:
+		return fmt.Errorf("rule %q clears a condition by occurrences, but is not a frequency rule", rule.Reason)
+	case !counted:
+		return nil
+	case rule.Type != types.Perm || rule.Status == types.False:
+		return fmt.Errorf("rule %q counts occurrences, but does not set a condition", rule.Reason)
+	}
+	window, err := time.ParseDuration(rule.OccurrenceWindow)
+	if err != nil {
+		return fmt.Errorf("invalid occurrence window of rule %q: %v", rule.Reason, err)
+	}
+	if window <= 0 {
+		return fmt.Errorf("occurrence window of rule %q should be positive", rule.Reason)
 	}
 	return nil
 }
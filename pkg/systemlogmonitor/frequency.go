@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"time"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	systemlogtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// hasFrequencyRules returns whether any rule is a frequency rule.
+func (l *logMonitor) hasFrequencyRules() bool {
+	for _, rule := range l.config.Rules {
+		if rule.Type == systemlogtypes.Frequency {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFrequency records a match of the i-th rule, a frequency rule, and returns the
+// status setting its condition when the rule matched often enough within its occurrence
+// window. It returns nil if the condition is not changed.
+func (l *logMonitor) matchFrequency(i int, rule systemlogtypes.Rule, logs []*logtypes.Log, groups map[string]string) *types.Status {
+	count := l.countOccurrence(i, rule, "", logs[len(logs)-1].Timestamp)
+	if count < rule.Occurrences || l.raisedBy(rule) {
+		return nil
+	}
+	raise := rule
+	raise.Type = types.Perm
+	return l.generateStatus(logs, raise, groups)
+}
+
+// checkFrequencies clears the conditions of the frequency rules which no longer match
+// often within their occurrence windows ending now, and returns the statuses clearing
+// them.
+func (l *logMonitor) checkFrequencies(now time.Time) []*types.Status {
+	var statuses []*types.Status
+	for i, rule := range l.config.Rules {
+		if rule.Type != systemlogtypes.Frequency || !l.raisedBy(rule) {
+			continue
+		}
+		// The occurrence window should be checked outside.
+		window, _ := time.ParseDuration(rule.OccurrenceWindow)
+		if l.occurrences.count(occurrenceKey(i, ""), now, window) > *rule.ClearOccurrences {
+			continue
+		}
+		// The condition is cleared with its default reason and message.
+		clear := systemlogtypes.Rule{Type: types.Perm, Condition: rule.Condition, Status: types.False, Ownership: rule.Ownership}
+		for _, condition := range l.config.DefaultConditions {
+			if condition.Type == rule.Condition {
+				clear.Reason = condition.Reason
+				clear.Message = condition.Message
+			}
+		}
+		statuses = append(statuses, l.generateStatus([]*logtypes.Log{{Timestamp: now}}, clear, nil))
+	}
+	return statuses
+}
+
+// raisedBy returns whether the condition of the frequency rule is set by the rule.
+func (l *logMonitor) raisedBy(rule systemlogtypes.Rule) bool {
+	for _, condition := range l.conditions {
+		if condition.Type == rule.Condition {
+			return condition.Status == types.True && condition.Reason == rule.Reason
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestFrequency(t *testing.T) {
+	restart := logtypes.Rule{
+		Type:             logtypes.Frequency,
+		Condition:        testConditionA,
+		Reason:           "FrequentKubeletRestart",
+		Pattern:          "Started Kubernetes kubelet.",
+		Occurrences:      3,
+		OccurrenceWindow: "10m",
+	}
+	l := &logMonitor{
+		config: MonitorConfig{
+			Source:            testSource,
+			DefaultConditions: []types.Condition{{Type: testConditionA, Status: types.False, Reason: "NoFrequentKubeletRestart", Message: "kubelet is functioning properly"}},
+			Rules:             []logtypes.Rule{restart},
+		},
+	}
+	disabled := false
+	l.config.EnableMetricsReporting = &disabled
+	(&l.config).ApplyDefaultConfiguration()
+	assert.NoError(t, l.config.ValidateRules())
+	assert.True(t, l.hasFrequencyRules())
+	l.conditions = initialConditions(l.config.DefaultConditions)
+	l.buffer = NewLogBuffer(l.config.BufferSize)
+
+	start := time.Unix(1000, 0)
+	match := func(offset time.Duration) []ruleMatch {
+		return l.parseLog(&logtypes.Log{Timestamp: start.Add(offset), Message: "Started Kubernetes kubelet."})
+	}
+
+	// The condition is set by the third occurrence within the window.
+	assert.Empty(t, match(0))
+	assert.Empty(t, match(time.Minute))
+	matches := match(2 * time.Minute)
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, logtypes.Frequency, matches[0].rule.Type)
+		assert.Len(t, matches[0].status.Events, 1)
+	}
+	assert.Equal(t, types.True, l.conditions[0].Status)
+	assert.Equal(t, "FrequentKubeletRestart", l.conditions[0].Reason)
+	assert.Equal(t, "Started Kubernetes kubelet. (3 occurrences within 10m)", l.conditions[0].Message)
+	// The condition is not set again by further occurrences.
+	assert.Empty(t, match(3*time.Minute))
+
+	// The condition stays set while the problem still occurs often.
+	assert.Empty(t, l.checkFrequencies(start.Add(10*time.Minute+30*time.Second)))
+	// The condition is cleared once the occurrences within the window fall to 2.
+	statuses := l.checkFrequencies(start.Add(11*time.Minute + 30*time.Second))
+	if assert.Len(t, statuses, 1) && assert.Len(t, statuses[0].Events, 1) {
+		assert.Equal(t, "Node condition "+testConditionA+" is now: False, reason: NoFrequentKubeletRestart",
+			statuses[0].Events[0].Message)
+	}
+	assert.Equal(t, types.False, l.conditions[0].Status)
+	assert.Equal(t, "kubelet is functioning properly", l.conditions[0].Message)
+	assert.Equal(t, start.Add(11*time.Minute+30*time.Second), l.conditions[0].Transition)
+	// The condition is not cleared again.
+	assert.Empty(t, l.checkFrequencies(start.Add(12*time.Minute)))
+}
+
+func TestValidateFrequencyRules(t *testing.T) {
+	config := MonitorConfig{
+		DefaultConditions: []types.Condition{{Type: testConditionA}},
+		Rules: []logtypes.Rule{{
+			Type: logtypes.Frequency, Condition: testConditionA, Reason: "FrequentKubeletRestart", Occurrences: 5, OccurrenceWindow: "20m",
+		}},
+	}
+	assert.NoError(t, config.ValidateRules())
+	config.ApplyDefaultConfiguration()
+	assert.Equal(t, 4, *config.Rules[0].ClearOccurrences)
+	clear := 5
+	config.Rules[0].ClearOccurrences = &clear
+	assert.Error(t, config.ValidateRules(), "clearing occurrences are below the threshold")
+	clear = 0
+	assert.NoError(t, config.ValidateRules())
+	config.Rules[0].OccurrenceWindow = ""
+	assert.Error(t, config.ValidateRules(), "occurrences are counted in a window")
+	config.Rules[0].OccurrenceWindow = "20m"
+	config.Rules[0].Instance = "{{ .unit }}"
+	assert.Error(t, config.ValidateRules(), "frequency rules have no instances")
+	config.Rules[0].Instance = ""
+	config.Rules[0].Condition = testConditionB
+	assert.Error(t, config.ValidateRules(), "the condition is cleared to its default")
+	config.Rules[0] = logtypes.Rule{Type: types.Perm, Condition: testConditionA, Reason: "KubeletRestart", ClearOccurrences: &clear}
+	assert.Error(t, config.ValidateRules(), "only frequency rules clear conditions by occurrences")
+}
@@ -29,6 +29,9 @@ type LogBuffer interface {
 	Push(*types.Log)
 	// Match with regular expression in the log buffer.
 	Match(string) []*types.Log
+	// MatchGroups is like Match, and also returns the values of the named capture groups
+	// of the regular expression taking part in the match.
+	MatchGroups(string) ([]*types.Log, map[string]string)
 	// String returns a concatenated string of the buffered logs.
 	String() string
 }
@@ -59,15 +62,30 @@ func (b *logBuffer) Push(log *types.Log) {
 	b.current++
 }
 
-// TODO(random-liu): Cache regexp if garbage collection becomes a problem someday.
 func (b *logBuffer) Match(expr string) []*types.Log {
+	logs, _ := b.MatchGroups(expr)
+	return logs
+}
+
+// TODO(random-liu): Cache regexp if garbage collection becomes a problem someday.
+func (b *logBuffer) MatchGroups(expr string) ([]*types.Log, map[string]string) {
 	// The expression should be checked outside, and it must match to the end.
 	reg := regexp.MustCompile(expr + `\z`)
 	log := b.String()
-	loc := reg.FindStringIndex(log)
+	loc := reg.FindStringSubmatchIndex(log)
 	if loc == nil {
 		// No match
-		return nil
+		return nil, nil
+	}
+	var groups map[string]string
+	for i, name := range reg.SubexpNames() {
+		if name == "" || loc[2*i] < 0 {
+			continue
+		}
+		if groups == nil {
+			groups = map[string]string{}
+		}
+		groups[name] = log[loc[2*i]:loc[2*i+1]]
 	}
 	// reverse index
 	s := len(log) - loc[0] - 1
@@ -83,7 +101,7 @@ func (b *logBuffer) Match(expr string) []*types.Log {
 	for i := 0; i < len(matched)/2; i++ {
 		matched[i], matched[len(matched)-i-1] = matched[len(matched)-i-1], matched[i]
 	}
-	return matched
+	return matched, groups
 }
 
 func (b *logBuffer) String() string {
@@ -108,3 +108,40 @@ func TestMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchGroups(t *testing.T) {
+	b := NewLogBuffer(4)
+	for _, log := range []string{"Buffer I/O error on dev sda1", "task java:123 blocked for more than 120 seconds."} {
+		b.Push(&types.Log{Message: log})
+	}
+	for c, test := range []struct {
+		expr     string
+		expected map[string]string
+	}{
+		{
+			expr:     `task (?P<task>\w+):(?P<pid>\d+) blocked for more than \d+ seconds\.`,
+			expected: map[string]string{"task": "java", "pid": "123"},
+		},
+		{
+			// Unnamed groups are not returned.
+			expr:     `task (\w+):\d+ blocked for more than (?P<seconds>\d+) seconds\.`,
+			expected: map[string]string{"seconds": "120"},
+		},
+		{
+			// Groups not taking part in the match are not returned.
+			expr:     `(?s)Buffer I/O error on dev (?P<device>\w+)(?P<flags> \w+)?\n.*`,
+			expected: map[string]string{"device": "sda1"},
+		},
+		{
+			expr: `task .*`,
+		},
+		{
+			expr: `(?P<device>sd[a-z]+)`,
+		},
+	} {
+		_, groups := b.MatchGroups(test.expr)
+		if !reflect.DeepEqual(test.expected, groups) {
+			t.Errorf("case %d: expected %v, got %v", c+1, test.expected, groups)
+		}
+	}
+}
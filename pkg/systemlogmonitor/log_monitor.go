@@ -17,11 +17,17 @@ limitations under the License.
 package systemlogmonitor
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"io/ioutil"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/golang/glog"
+	"go.opencensus.io/trace"
 
 	"k8s.io/node-problem-detector/pkg/problemdaemon"
 	"k8s.io/node-problem-detector/pkg/problemmetrics"
@@ -36,6 +42,12 @@ import (
 
 const SystemLogMonitorName = "system-log-monitor"
 
+// The names of the spans tracing the detection of problems in a log line.
+const (
+	detectSpanName = "systemlogmonitor.DetectProblems"
+	matchSpanName  = "systemlogmonitor.MatchRules"
+)
+
 func init() {
 	problemdaemon.Register(
 		SystemLogMonitorName,
@@ -53,6 +65,15 @@ type logMonitor struct {
 	logCh      <-chan *logtypes.Log
 	output     chan *types.Status
 	tomb       *tomb.Tomb
+	// metrics is nil when metrics reporting is disabled.
+	metrics *monitorMetrics
+	// sampler is nil when no rule is sampled.
+	sampler *sampler
+	// occurrences counts the matches of the rules with an occurrence threshold. It is
+	// created on the first match of such a rule.
+	occurrences *occurrenceCounter
+	// pods is nil when the pods are not resolved with the kubelet.
+	pods *podResolver
 }
 
 // NewLogMonitorOrDie create a new LogMonitor, panic if error occurs.
@@ -62,22 +83,15 @@ func NewLogMonitorOrDie(configPath string) types.Monitor {
 		tomb:       tomb.NewTomb(),
 	}
 
-	f, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
-	}
-	err = json.Unmarshal(f, &l.config)
-	if err != nil {
-		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
-	}
-	// Apply default configurations
-	(&l.config).ApplyDefaultConfiguration()
-	err = l.config.ValidateRules()
+	var err error
+	l.config, err = LoadConfig(configPath)
 	if err != nil {
-		glog.Fatalf("Failed to validate %s matching rules %+v: %v", l.configPath, l.config.Rules, err)
+		glog.Fatal(err)
 	}
+	l.config.SelectArchitecture(runtime.GOARCH)
 	glog.Infof("Finish parsing log monitor config file %s: %+v", l.configPath, l.config)
 
+	l.config.WatcherConfig.MetricsReporting = *l.config.EnableMetricsReporting
 	l.watcher = logwatchers.GetLogWatcherOrDie(l.config.WatcherConfig)
 	l.buffer = NewLogBuffer(l.config.BufferSize)
 	// A 1000 size channel should be big enough.
@@ -85,15 +99,49 @@ func NewLogMonitorOrDie(configPath string) types.Monitor {
 
 	if *l.config.EnableMetricsReporting {
 		initializeProblemMetricsOrDie(l.config.Rules)
+		l.metrics = internalMetricsOrDie()
+	}
+	if l.config.KubeletEndpoint != "" {
+		l.pods = newPodResolver(l.config.KubeletEndpoint)
+	}
+	for _, rule := range l.config.Rules {
+		if rule.SampleWindow != "" {
+			l.sampler = newSampler()
+			break
+		}
 	}
 	return l
 }
 
+// LoadConfig reads, applies and validates the log monitor configuration file.
+func LoadConfig(configPath string) (MonitorConfig, error) {
+	var config MonitorConfig
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return config, fmt.Errorf("failed to read configuration file %q: %v", configPath, err)
+	}
+	err = util.UnmarshalStrict(f, &config)
+	if err != nil {
+		return config, fmt.Errorf("failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	// Apply default configurations
+	(&config).ApplyDefaultConfiguration()
+	err = config.ValidateRules()
+	if err != nil {
+		return config, fmt.Errorf("failed to validate %s matching rules %+v: %v", configPath, config.Rules, err)
+	}
+	return config, nil
+}
+
 // initializeProblemMetricsOrDie creates problem metrics for all problems and set the value to 0,
 // panic if error occurs.
 func initializeProblemMetricsOrDie(rules []systemlogtypes.Rule) {
 	for _, rule := range rules {
-		if rule.Type == types.Perm {
+		// The reasons of reason templates are only known when the rule matches.
+		if isTemplate(rule.Reason) {
+			continue
+		}
+		if rule.Type == types.Perm || rule.Type == systemlogtypes.Frequency {
 			err := problemmetrics.GlobalProblemMetricsManager.SetProblemGauge(rule.Condition, rule.Reason, false)
 			if err != nil {
 				glog.Fatalf("Failed to initialize problem gauge metrics for problem %q, reason %q: %v",
@@ -114,7 +162,7 @@ func (l *logMonitor) Start() (<-chan *types.Status, error) {
 	if err != nil {
 		return nil, err
 	}
-	go l.monitorLoop()
+	problemdaemon.Go(l, l.monitorLoop)
 	return l.output, nil
 }
 
@@ -130,6 +178,12 @@ func (l *logMonitor) monitorLoop() {
 		l.tomb.Done()
 	}()
 	l.initializeStatus()
+	var flushCh <-chan time.Time
+	if l.sampler != nil || l.hasFrequencyRules() {
+		ticker := time.NewTicker(flushPeriod)
+		defer ticker.Stop()
+		flushCh = ticker.C
+	}
 	for {
 		select {
 		case log, ok := <-l.logCh:
@@ -137,7 +191,13 @@ func (l *logMonitor) monitorLoop() {
 				glog.Errorf("Log channel closed: %s", l.configPath)
 				return
 			}
-			l.parseLog(log)
+			l.handleLog(log, time.Now())
+		case now := <-flushCh:
+			l.flushSamples(now)
+			for _, status := range l.checkFrequencies(now) {
+				glog.Infof("New status generated: %+v", status)
+				l.output <- status
+			}
 		case <-l.tomb.Stopping():
 			l.watcher.Stop()
 			glog.Infof("Log monitor stopped: %s", l.configPath)
@@ -146,64 +206,183 @@ func (l *logMonitor) monitorLoop() {
 	}
 }
 
-// parseLog parses one log line.
-func (l *logMonitor) parseLog(log *logtypes.Log) {
+// handleLog matches a log line read by the watcher against the rules, and reports the
+// statuses generated. The detection is traced from reading the line to reporting the
+// statuses, and the export of the statuses is traced as part of it.
+func (l *logMonitor) handleLog(log *logtypes.Log, now time.Time) {
+	if log.Event != nil {
+		l.reportWatcherEvent(*log.Event)
+		return
+	}
+	ctx, span := trace.StartSpan(context.Background(), detectSpanName)
+	defer span.End()
+	if span.IsRecordingEvents() {
+		lag := now.Sub(log.Timestamp)
+		if lag < 0 {
+			lag = 0
+		}
+		span.AddAttributes(
+			trace.StringAttribute("source", l.config.Source),
+			trace.StringAttribute("log_timestamp", log.Timestamp.Format(time.RFC3339Nano)),
+			trace.Int64Attribute("read_lag_ms", int64(lag/time.Millisecond)),
+		)
+	}
+
+	l.recordLine(log, now)
+	l.flushSamples(now)
+	_, matchSpan := trace.StartSpan(ctx, matchSpanName)
+	matches := l.parseLog(log)
+	matchSpan.AddAttributes(trace.Int64Attribute("matches", int64(len(matches))))
+	matchSpan.End()
+	l.recordMatches(matches)
+	for _, match := range matches {
+		if !l.admit(match, now) {
+			continue
+		}
+		if span.SpanContext().IsSampled() {
+			match.status.Trace = span.SpanContext()
+		}
+		glog.Infof("New status generated: %+v", match.status)
+		l.output <- match.status
+	}
+}
+
+// reportWatcherEvent reports an event of the watcher, which is not matched against the
+// rules.
+func (l *logMonitor) reportWatcherEvent(event types.Event) {
+	if *l.config.EnableMetricsReporting {
+		if err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(event.Reason, 1); err != nil {
+			glog.Errorf("Failed to update problem counter metrics for %q: %v", event.Reason, err)
+		}
+	}
+	status := &types.Status{
+		Source:     l.config.Source,
+		Events:     []types.Event{event},
+		Conditions: l.conditions,
+	}
+	glog.Infof("New status generated: %+v", status)
+	l.output <- status
+}
+
+// ruleMatch is a rule matched by the logs, and the status it generated.
+type ruleMatch struct {
+	rule   systemlogtypes.Rule
+	logs   []*logtypes.Log
+	status *types.Status
+}
+
+// parseLog parses one log line, and returns the rules it matched.
+func (l *logMonitor) parseLog(log *logtypes.Log) []ruleMatch {
 	// Once there is new log, log monitor will push it into the log buffer and try
 	// to match each rule. If any rule is matched, log monitor will report a status.
 	l.buffer.Push(log)
-	for _, rule := range l.config.Rules {
-		matched := l.buffer.Match(rule.Pattern)
+	var matches []ruleMatch
+	for i, rule := range l.config.Rules {
+		if !matchFields(log, rule.FieldRegexps) {
+			continue
+		}
+		matched, groups := l.buffer.MatchGroups(rule.Pattern)
 		if len(matched) == 0 {
 			continue
 		}
-		status := l.generateStatus(matched, rule)
-		glog.Infof("New status generated: %+v", status)
-		l.output <- status
+		if rule.Type == systemlogtypes.Frequency {
+			if status := l.matchFrequency(i, rule, matched, groups); status != nil {
+				matches = append(matches, ruleMatch{rule: rule, logs: matched, status: status})
+			}
+			continue
+		}
+		if !l.reachesOccurrences(i, rule, renderTemplate(rule.Instance, groups), log.Timestamp) {
+			continue
+		}
+		matches = append(matches, ruleMatch{rule: rule, logs: matched, status: l.generateStatus(matched, rule, groups)})
+	}
+	return matches
+}
+
+// matchFields checks whether the structured fields of the log match all the compiled field
+// patterns of a rule.
+func matchFields(log *logtypes.Log, patterns map[string]*regexp.Regexp) bool {
+	for field, pattern := range patterns {
+		value, ok := log.Fields[field]
+		if !ok {
+			return false
+		}
+		if !pattern.MatchString(value) {
+			return false
+		}
 	}
+	return true
 }
 
-// generateStatus generates status from the logs.
-func (l *logMonitor) generateStatus(logs []*logtypes.Log, rule systemlogtypes.Rule) *types.Status {
+// generateStatus generates status from the logs, and the named capture groups of the
+// rule pattern matching them.
+func (l *logMonitor) generateStatus(logs []*logtypes.Log, rule systemlogtypes.Rule, groups map[string]string) *types.Status {
 	// We use the timestamp of the first log line as the timestamp of the status.
 	timestamp := logs[0].Timestamp
+	reason := renderTemplate(rule.Reason, groups)
 	message := generateMessage(logs)
+	if rule.Message != "" {
+		message = renderTemplate(rule.Message, groups)
+	}
+	if rule.Occurrences > 1 {
+		message = fmt.Sprintf("%s (%d occurrences within %s)", message, rule.Occurrences, rule.OccurrenceWindow)
+	}
+	annotations := rule.Ownership.Annotate(attributePod(groups, l.pods))
 	var events []types.Event
 	var changedConditions []*types.Condition
 	if rule.Type == types.Temp {
+		severity := rule.Severity
+		if severity == "" {
+			severity = types.Warn
+		}
 		// For temporary error only generate event
 		events = append(events, types.Event{
-			Severity:  types.Warn,
-			Timestamp: timestamp,
-			Reason:    rule.Reason,
-			Message:   message,
+			Severity:    severity,
+			Timestamp:   timestamp,
+			Reason:      reason,
+			Message:     message,
+			Annotations: annotations,
 		})
 	} else {
 		// For permanent error changes the condition
-		for i := range l.conditions {
-			condition := &l.conditions[i]
-			if condition.Type == rule.Condition {
-				// Update transition timestamp and message when the condition
-				// changes. Condition is considered to be changed only when
-				// status or reason changes.
-				if condition.Status == types.False || condition.Reason != rule.Reason {
-					condition.Transition = timestamp
-					condition.Message = message
-					events = append(events, util.GenerateConditionChangeEvent(
-						condition.Type,
-						types.True,
-						rule.Reason,
-						timestamp,
-					))
-				}
-				condition.Status = types.True
-				condition.Reason = rule.Reason
-				changedConditions = append(changedConditions, condition)
-				break
+		status := types.True
+		if rule.Status != "" {
+			status = rule.Status
+		}
+		instance := renderTemplate(rule.Instance, groups)
+		for _, condition := range l.ruleConditions(rule.Condition, instance, status == types.True) {
+			// A healed condition is not changed again.
+			if condition.Status == types.False && status == types.False {
+				continue
+			}
+			// Update transition timestamp and message when the condition
+			// changes. Condition is considered to be changed only when
+			// status or reason changes.
+			if condition.Status != status || condition.Reason != reason {
+				condition.Transition = timestamp
+				condition.Message = message
+				event := util.GenerateConditionChangeEvent(
+					condition.Type,
+					status,
+					reason,
+					timestamp,
+				)
+				event.Annotations = annotations
+				events = append(events, event)
 			}
+			condition.Status = status
+			condition.Reason = reason
+			condition.Severity = ""
+			if status == types.True {
+				condition.Severity = rule.Severity
+			}
+			changedConditions = append(changedConditions, condition)
 		}
 	}
 
 	if *l.config.EnableMetricsReporting {
+		problemmetrics.GlobalProblemMetricsManager.SetOwnership(reason, rule.Ownership)
+		problemmetrics.GlobalProblemMetricsManager.SetSeverity(reason, rule.Severity)
 		for _, event := range events {
 			err := problemmetrics.GlobalProblemMetricsManager.IncrementProblemCounter(event.Reason, 1)
 			if err != nil {
@@ -228,6 +407,46 @@ func (l *logMonitor) generateStatus(logs []*logtypes.Log, rule systemlogtypes.Ru
 	}
 }
 
+// ruleConditions returns the conditions a permanent rule changes. Without instance, it
+// is the condition of the type, and when healed also all its instances. Otherwise it is
+// the condition of the instance, which is created from the condition of the type when
+// it is set for the first time.
+func (l *logMonitor) ruleConditions(conditionType, instance string, set bool) []*types.Condition {
+	var conditions []*types.Condition
+	var base *types.Condition
+	instanceType := instanceConditionType(conditionType, instance)
+	for i := range l.conditions {
+		condition := &l.conditions[i]
+		switch {
+		case condition.Type == conditionType:
+			base = condition
+			if instance == "" {
+				conditions = append(conditions, condition)
+			}
+		case instance != "" && condition.Type == instanceType:
+			return []*types.Condition{condition}
+		case instance == "" && !set && strings.HasPrefix(condition.Type, conditionType+"["):
+			conditions = append(conditions, condition)
+		}
+	}
+	if instance == "" || !set || base == nil {
+		return conditions
+	}
+	condition := *base
+	condition.Type = instanceType
+	condition.Status = types.False
+	l.conditions = append(l.conditions, condition)
+	return []*types.Condition{&l.conditions[len(l.conditions)-1]}
+}
+
+// instanceConditionType returns the type of the condition of an instance.
+func instanceConditionType(conditionType, instance string) string {
+	if instance == "" {
+		return conditionType
+	}
+	return conditionType + "[" + instance + "]"
+}
+
 // initializeStatus initializes the internal condition and also reports it to the node problem detector.
 func (l *logMonitor) initializeStatus() {
 	// Initialize the default node conditions
@@ -257,3 +476,27 @@ func generateMessage(logs []*logtypes.Log) string {
 	}
 	return concatLogs(messages)
 }
+
+// isTemplate returns whether the reason or message of a rule is a template.
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// renderTemplate renders the reason or message template of a rule with the named
+// capture groups of its pattern. Groups not taking part in the match are empty.
+func renderTemplate(text string, groups map[string]string) string {
+	if !isTemplate(text) {
+		return text
+	}
+	// The template should be checked outside.
+	tmpl := template.Must(template.New("").Option("missingkey=zero").Parse(text))
+	var b strings.Builder
+	if groups == nil {
+		groups = map[string]string{}
+	}
+	if err := tmpl.Execute(&b, groups); err != nil {
+		glog.Errorf("Failed to render template %q with %v: %v", text, groups, err)
+		return text
+	}
+	return b.String()
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
 
 	"k8s.io/node-problem-detector/pkg/problemdaemon"
 	"k8s.io/node-problem-detector/pkg/problemmetrics"
@@ -144,7 +145,7 @@ func TestGenerateStatusForConditions(t *testing.T) {
 			conditions: append([]types.Condition{}, initConditions...),
 		}
 		(&l.config).ApplyDefaultConfiguration()
-		got := l.generateStatus(logs, test.rule)
+		got := l.generateStatus(logs, test.rule, nil)
 		if !reflect.DeepEqual(&test.expected, got) {
 			t.Errorf("case %d: expected status %+v, got %+v", c+1, test.expected, got)
 		}
@@ -395,7 +396,7 @@ func TestGenerateStatusForMetrics(t *testing.T) {
 			problemmetrics.GlobalProblemMetricsManager = fakePMM
 
 			for _, rule := range test.triggeredRules {
-				l.generateStatus([]*logtypes.Log{{}}, rule)
+				l.generateStatus([]*logtypes.Log{{}}, rule, nil)
 			}
 
 			gotMetrics := append(fakeProblemCounter.ListMetrics(), fakeProblemGauge.ListMetrics()...)
@@ -698,3 +699,308 @@ func TestInitializeProblemMetricsOrDie(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchFields(t *testing.T) {
+	log := &logtypes.Log{
+		Message: "test message",
+		Fields:  map[string]string{"level": "error", "stream": "stderr"},
+	}
+	for c, test := range []struct {
+		patterns map[string]string
+		matched  bool
+	}{
+		{patterns: nil, matched: true},
+		{patterns: map[string]string{"level": "error|fatal"}, matched: true},
+		{patterns: map[string]string{"level": "error", "stream": "stdout"}, matched: false},
+		{patterns: map[string]string{"unit": ".*"}, matched: false},
+	} {
+		config := MonitorConfig{Rules: []logtypes.Rule{{Fields: test.patterns}}}
+		assert.NoError(t, config.ValidateRules())
+		assert.Equal(t, test.matched, matchFields(log, config.Rules[0].FieldRegexps), "case %d", c+1)
+	}
+}
+
+func TestGenerateStatusWithCaptureGroups(t *testing.T) {
+	l := &logMonitor{
+		config: MonitorConfig{Source: testSource},
+		conditions: []types.Condition{{
+			Type:   testConditionA,
+			Status: types.False,
+		}},
+	}
+	(&l.config).ApplyDefaultConfiguration()
+	logs := []*logtypes.Log{{Timestamp: time.Unix(1000, 1000), Message: "Buffer I/O error on dev sda1"}}
+	groups := map[string]string{"device": "sda1"}
+
+	status := l.generateStatus(logs, logtypes.Rule{
+		Type:    types.Temp,
+		Reason:  "IOError",
+		Message: "I/O error on {{ .device }}{{ .missing }}",
+	}, groups)
+	assert.Equal(t, []types.Event{{
+		Severity:    types.Warn,
+		Timestamp:   time.Unix(1000, 1000),
+		Reason:      "IOError",
+		Message:     "I/O error on sda1",
+		Annotations: groups,
+	}}, status.Events)
+
+	status = l.generateStatus(logs, logtypes.Rule{
+		Type:      types.Perm,
+		Condition: testConditionA,
+		Reason:    "IOError{{ .device }}",
+	}, groups)
+	assert.Equal(t, "IOErrorsda1", status.Conditions[0].Reason)
+	assert.Equal(t, "Buffer I/O error on dev sda1", status.Conditions[0].Message)
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, "IOErrorsda1", status.Events[0].Reason)
+		assert.Equal(t, groups, status.Events[0].Annotations)
+	}
+}
+
+func TestGenerateStatusWithOwnership(t *testing.T) {
+	l := &logMonitor{
+		config: MonitorConfig{Source: testSource},
+		conditions: []types.Condition{{
+			Type:   testConditionA,
+			Status: types.False,
+		}},
+	}
+	(&l.config).ApplyDefaultConfiguration()
+	logs := []*logtypes.Log{{Timestamp: time.Unix(1000, 1000), Message: "Buffer I/O error on dev sda1"}}
+	groups := map[string]string{"device": "sda1"}
+	ownership := types.Ownership{Team: "storage", Escalation: "#storage-oncall"}
+	expected := map[string]string{"device": "sda1", "team": "storage", "escalation": "#storage-oncall"}
+
+	status := l.generateStatus(logs, logtypes.Rule{Type: types.Temp, Reason: "IOError", Ownership: ownership}, groups)
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, expected, status.Events[0].Annotations)
+	}
+	status = l.generateStatus(logs, logtypes.Rule{Type: types.Perm, Condition: testConditionA, Reason: "IOError", Ownership: ownership}, nil)
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, map[string]string{"team": "storage", "escalation": "#storage-oncall"}, status.Events[0].Annotations)
+	}
+	// The capture groups are not modified.
+	assert.Equal(t, map[string]string{"device": "sda1"}, groups)
+
+	// The labels of the rule are annotated, the team and escalation take precedence.
+	ownership.Labels = map[string]string{"runbook": "https://runbooks/io-error", "device": "sdb"}
+	status = l.generateStatus(logs, logtypes.Rule{Type: types.Temp, Reason: "IOError", Ownership: ownership}, groups)
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, map[string]string{"device": "sdb", "runbook": "https://runbooks/io-error", "team": "storage", "escalation": "#storage-oncall"}, status.Events[0].Annotations)
+	}
+}
+
+func TestValidateRuleTemplates(t *testing.T) {
+	config := MonitorConfig{Rules: []logtypes.Rule{{Reason: "IOError", Message: "I/O error on {{ .device }}"}}}
+	assert.NoError(t, config.ValidateRules())
+	config.Rules[0].Message = "I/O error on {{ .device"
+	assert.Error(t, config.ValidateRules())
+	config.Rules[0] = logtypes.Rule{Type: types.Temp, Reason: "IOError", Status: types.False}
+	assert.Error(t, config.ValidateRules(), "only permanent rules heal conditions")
+	config.Rules[0] = logtypes.Rule{Type: types.Perm, Reason: "IOError", Status: "Healed"}
+	assert.Error(t, config.ValidateRules())
+	config.Rules[0] = logtypes.Rule{Type: types.Temp, Reason: "IOError", SampleWindow: "1m"}
+	assert.NoError(t, config.ValidateRules())
+	config.Rules[0].SampleWindow = "0s"
+	assert.Error(t, config.ValidateRules())
+	config.Rules[0] = logtypes.Rule{Type: types.Perm, Reason: "IOError", SampleWindow: "1m"}
+	assert.Error(t, config.ValidateRules(), "only temporary rules are sampled")
+	config.Rules[0] = logtypes.Rule{Type: types.Perm, Reason: "SoftLockup", Occurrences: 3, OccurrenceWindow: "10m"}
+	assert.NoError(t, config.ValidateRules())
+	config.Rules[0].OccurrenceWindow = ""
+	assert.Error(t, config.ValidateRules(), "occurrences are counted in a window")
+	config.Rules[0] = logtypes.Rule{Type: types.Temp, Reason: "SoftLockup", Occurrences: 3, OccurrenceWindow: "10m"}
+	assert.Error(t, config.ValidateRules(), "only permanent rules count occurrences")
+	config.Rules[0] = logtypes.Rule{Type: types.Temp, Reason: "IOError", Severity: "warning"}
+	assert.NoError(t, config.ValidateRules())
+	config.ApplyDefaultConfiguration()
+	assert.Equal(t, types.Warn, config.Rules[0].Severity)
+	config.Rules[0].Severity = "fatal"
+	assert.Error(t, config.ValidateRules())
+	config.Rules[0] = logtypes.Rule{Type: types.Temp, Reason: "IOError", Ownership: types.Ownership{Labels: map[string]string{"runbook": "https://runbooks/io-error"}}}
+	assert.NoError(t, config.ValidateRules())
+	config.Rules[0].Labels = map[string]string{"ticket-queue": "STORAGE"}
+	assert.Error(t, config.ValidateRules(), "label keys are metric label names")
+	config.Rules[0].Labels = map[string]string{"team": "storage"}
+	assert.Error(t, config.ValidateRules(), "the team is not a label")
+}
+
+func TestSelectArchitecture(t *testing.T) {
+	config := MonitorConfig{Rules: []logtypes.Rule{
+		{Type: types.Temp, Reason: "OOMKilling"},
+		{Type: types.Temp, Reason: "SError", Architectures: []string{"arm64"}},
+		{Type: types.Temp, Reason: "HardwareError", Architectures: []string{"arm64", "riscv64"}},
+	}}
+	assert.NoError(t, config.ValidateRules())
+	config.Rules[1].Architectures = []string{"aarch64"}
+	assert.Error(t, config.ValidateRules(), "architectures are named as in GOARCH")
+	config.Rules[1].Architectures = []string{"arm64"}
+
+	amd64 := config
+	amd64.SelectArchitecture("amd64")
+	assert.Equal(t, config.Rules[:1], amd64.Rules)
+	riscv64 := config
+	riscv64.SelectArchitecture("riscv64")
+	assert.Equal(t, []logtypes.Rule{config.Rules[0], config.Rules[2]}, riscv64.Rules)
+	config.SelectArchitecture("arm64")
+	assert.Len(t, config.Rules, 3)
+}
+
+func TestGenerateStatusWithSeverity(t *testing.T) {
+	l := &logMonitor{
+		config: MonitorConfig{Source: testSource},
+		conditions: []types.Condition{{
+			Type:   testConditionA,
+			Status: types.False,
+		}},
+	}
+	(&l.config).ApplyDefaultConfiguration()
+	logs := []*logtypes.Log{{Timestamp: time.Unix(1000, 1000), Message: "Kernel panic"}}
+
+	status := l.generateStatus(logs, logtypes.Rule{Type: types.Temp, Reason: "Panic", Severity: types.Critical}, nil)
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, types.Critical, status.Events[0].Severity)
+	}
+	status = l.generateStatus(logs, logtypes.Rule{Type: types.Temp, Reason: "Panic"}, nil)
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, types.Warn, status.Events[0].Severity, "temporary problems are warnings by default")
+	}
+	status = l.generateStatus(logs, logtypes.Rule{Type: types.Perm, Condition: testConditionA, Reason: "Panic", Severity: types.Critical}, nil)
+	assert.Equal(t, types.Critical, status.Conditions[0].Severity)
+	status = l.generateStatus(logs, logtypes.Rule{Type: types.Perm, Condition: testConditionA, Reason: "Recovered", Status: types.False, Severity: types.Critical}, nil)
+	assert.Equal(t, types.Severity(""), status.Conditions[0].Severity, "healed conditions have no severity")
+}
+
+func TestGenerateStatusForInstances(t *testing.T) {
+	l := &logMonitor{
+		config: MonitorConfig{Source: testSource},
+		conditions: []types.Condition{{
+			Type:    "DiskReadonly",
+			Status:  types.False,
+			Reason:  "DiskIsWritable",
+			Message: "disk is writable",
+		}},
+	}
+	(&l.config).ApplyDefaultConfiguration()
+	logs := []*logtypes.Log{{Timestamp: time.Unix(1000, 1000), Message: "test message"}}
+	readonly := logtypes.Rule{Type: types.Perm, Condition: "DiskReadonly", Reason: "FilesystemIsReadOnly", Instance: "{{ .device }}"}
+	writable := logtypes.Rule{Type: types.Perm, Condition: "DiskReadonly", Reason: "DiskIsWritable", Status: types.False, Instance: "{{ .device }}"}
+	statuses := func() map[string]types.ConditionStatus {
+		s := map[string]types.ConditionStatus{}
+		for _, condition := range l.conditions {
+			s[condition.Type] = condition.Status
+		}
+		return s
+	}
+
+	status := l.generateStatus(logs, readonly, map[string]string{"device": "sda"})
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, "Node condition DiskReadonly[sda] is now: True, reason: FilesystemIsReadOnly", status.Events[0].Message)
+	}
+	l.generateStatus(logs, readonly, map[string]string{"device": "sdb"})
+	assert.Equal(t, map[string]types.ConditionStatus{
+		"DiskReadonly":      types.False,
+		"DiskReadonly[sda]": types.True,
+		"DiskReadonly[sdb]": types.True,
+	}, statuses())
+
+	// Healing one disk does not heal the other.
+	status = l.generateStatus(logs, writable, map[string]string{"device": "sdb"})
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, "Node condition DiskReadonly[sdb] is now: False, reason: DiskIsWritable", status.Events[0].Message)
+	}
+	assert.Equal(t, map[string]types.ConditionStatus{
+		"DiskReadonly":      types.False,
+		"DiskReadonly[sda]": types.True,
+		"DiskReadonly[sdb]": types.False,
+	}, statuses())
+
+	// Healing an unknown disk changes nothing.
+	status = l.generateStatus(logs, writable, map[string]string{"device": "sdc"})
+	assert.Empty(t, status.Events)
+
+	// Healing without instance heals all disks.
+	status = l.generateStatus(logs, writable, nil)
+	assert.Len(t, status.Events, 1)
+	assert.Equal(t, map[string]types.ConditionStatus{
+		"DiskReadonly":      types.False,
+		"DiskReadonly[sda]": types.False,
+		"DiskReadonly[sdb]": types.False,
+	}, statuses())
+}
+
+// spanRecorder records the ended sampled spans.
+type spanRecorder struct {
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.spans = append(r.spans, s)
+}
+
+func TestHandleLogTracing(t *testing.T) {
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.NeverSample()})
+
+	l := &logMonitor{
+		config: MonitorConfig{Source: testSource, Rules: []logtypes.Rule{
+			{Type: types.Temp, Reason: "TaskHung", Pattern: "task .* blocked"},
+		}},
+		output: make(chan *types.Status, 10),
+	}
+	disabled := false
+	l.config.EnableMetricsReporting = &disabled
+	(&l.config).ApplyDefaultConfiguration()
+	l.buffer = NewLogBuffer(l.config.BufferSize)
+
+	now := time.Unix(1000, 0)
+	l.handleLog(&logtypes.Log{Timestamp: now.Add(-1500 * time.Millisecond), Message: "task kworker blocked"}, now)
+	if !assert.Len(t, recorder.spans, 2) {
+		return
+	}
+	match, detect := recorder.spans[0], recorder.spans[1]
+	assert.Equal(t, matchSpanName, match.Name)
+	assert.Equal(t, int64(1), match.Attributes["matches"])
+	assert.Equal(t, detectSpanName, detect.Name)
+	assert.Equal(t, detect.SpanID, match.ParentSpanID)
+	assert.Equal(t, testSource, detect.Attributes["source"])
+	assert.Equal(t, int64(1500), detect.Attributes["read_lag_ms"])
+	if assert.Len(t, l.output, 1) {
+		assert.Equal(t, detect.SpanContext, (<-l.output).Trace)
+	}
+
+	// Statuses are not traced when the detection is not sampled.
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.NeverSample()})
+	l.handleLog(&logtypes.Log{Timestamp: now, Message: "task kworker blocked"}, now)
+	if assert.Len(t, l.output, 1) {
+		assert.False(t, (<-l.output).Trace.IsSampled())
+	}
+	assert.Len(t, recorder.spans, 2)
+}
+
+func TestHandleLogWatcherEvent(t *testing.T) {
+	l := &logMonitor{
+		config: MonitorConfig{Source: testSource, Rules: []logtypes.Rule{
+			{Type: types.Temp, Reason: "Anything", Pattern: ".*"},
+		}},
+		output: make(chan *types.Status, 10),
+	}
+	disabled := false
+	l.config.EnableMetricsReporting = &disabled
+	(&l.config).ApplyDefaultConfiguration()
+	l.buffer = NewLogBuffer(l.config.BufferSize)
+
+	now := time.Unix(1000, 0)
+	event := types.Event{Severity: types.Warn, Timestamp: now, Reason: "KmsgOverflow", Message: "2 messages dropped"}
+	// The event of the watcher is reported without matching the rules.
+	l.handleLog(&logtypes.Log{Timestamp: now, Event: &event}, now)
+	if assert.Len(t, l.output, 1) {
+		status := <-l.output
+		assert.Equal(t, testSource, status.Source)
+		assert.Equal(t, []types.Event{event}, status.Events)
+	}
+}
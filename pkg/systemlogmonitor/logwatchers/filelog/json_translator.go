@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+const (
+	// formatKey is the key of the log format in the plugin configuration. Supported
+	// formats are "regex" (the default) and "json". It is ignored when a preset is set.
+	formatKey = "format"
+	// jsonFormat parses each log line as a JSON object.
+	jsonFormat = "json"
+	// timestampFieldKey is the key of the timestamp field path in the plugin configuration.
+	// Nested fields are separated by '.', e.g. "metadata.time".
+	timestampFieldKey = "timestampField"
+	// messageFieldKey is the key of the message field path in the plugin configuration.
+	messageFieldKey = "messageField"
+
+	// unixTimestampFormat parses the timestamp as (fractional) seconds since epoch, as
+	// written by e.g. kubelet with --logging-format=json.
+	unixTimestampFormat = "unix"
+
+	defaultTimestampField      = "time"
+	defaultMessageField        = "msg"
+	defaultJSONTimestampFormat = time.RFC3339Nano
+)
+
+// logTranslator translates a log line into internal log type.
+type logTranslator interface {
+	translate(line string) (*logtypes.Log, error)
+}
+
+// newLogTranslatorOrDie creates the translator for the log format in the plugin configuration.
+func newLogTranslatorOrDie(pluginConfig map[string]string) logTranslator {
+	if preset, ok := pluginConfig[presetKey]; ok {
+		t, err := newPresetTranslator(preset)
+		if err != nil {
+			glog.Fatalf("Failed to create log translator: %v", err)
+		}
+		glog.Infof("Translating logs with preset %q", preset)
+		return t
+	}
+	if pluginConfig[formatKey] == jsonFormat {
+		return newJSONTranslator(pluginConfig)
+	}
+	return newTranslatorOrDie(pluginConfig)
+}
+
+// Translator translates log lines into internal log type.
+type Translator struct {
+	translator logTranslator
+}
+
+// NewTranslatorOrDie returns the translator of the log format in the plugin configuration,
+// panic if error occurs. It translates sample logs without watching a log file.
+func NewTranslatorOrDie(pluginConfig map[string]string) *Translator {
+	return &Translator{translator: newLogTranslatorOrDie(pluginConfig)}
+}
+
+// Translate translates a log line. It returns nil without error if the line does not
+// complete a log, e.g. the line is continued by the next lines.
+func (t *Translator) Translate(line string) (*logtypes.Log, error) {
+	return t.translator.translate(line)
+}
+
+// Flush returns the log being assembled from the lines translated so far, if any. It is
+// called after the last line.
+func (t *Translator) Flush() *logtypes.Log {
+	if m, ok := t.translator.(multilineTranslator); ok {
+		return m.flush()
+	}
+	return nil
+}
+
+// jsonTranslator translates JSON log line into internal log type. The fields other
+// than the timestamp and the message are exposed to the rules as log fields.
+type jsonTranslator struct {
+	timestampField  string
+	messageField    string
+	timestampFormat string
+}
+
+func newJSONTranslator(pluginConfig map[string]string) *jsonTranslator {
+	t := &jsonTranslator{
+		timestampField:  pluginConfig[timestampFieldKey],
+		messageField:    pluginConfig[messageFieldKey],
+		timestampFormat: pluginConfig[timestampFormatKey],
+	}
+	if t.timestampField == "" {
+		t.timestampField = defaultTimestampField
+	}
+	if t.messageField == "" {
+		t.messageField = defaultMessageField
+	}
+	if t.timestampFormat == "" {
+		t.timestampFormat = defaultJSONTimestampFormat
+	}
+	glog.Infof("Translating JSON logs with timestamp field %q (format %q) and message field %q",
+		t.timestampField, t.timestampFormat, t.messageField)
+	return t
+}
+
+// translate translates the JSON log line into internal type.
+func (t *jsonTranslator) translate(line string) (*logtypes.Log, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return nil, fmt.Errorf("failed to parse line %q as JSON: %v", line, err)
+	}
+	fields := map[string]string{}
+	flattenFields("", obj, fields)
+
+	rawTimestamp, ok := fields[t.timestampField]
+	if !ok {
+		return nil, fmt.Errorf("no timestamp field %q found in line %q", t.timestampField, line)
+	}
+	timestamp, err := t.parseTimestamp(rawTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	message, ok := fields[t.messageField]
+	if !ok {
+		return nil, fmt.Errorf("no message field %q found in line %q", t.messageField, line)
+	}
+	delete(fields, t.timestampField)
+	delete(fields, t.messageField)
+
+	return &logtypes.Log{
+		Timestamp: timestamp,
+		Message:   strings.TrimSuffix(message, "\n"),
+		Fields:    fields,
+	}, nil
+}
+
+func (t *jsonTranslator) parseTimestamp(raw string) (time.Time, error) {
+	if t.timestampFormat == unixTimestampFormat {
+		seconds, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse unix timestamp %q: %v", raw, err)
+		}
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	}
+	timestamp, err := time.ParseInLocation(t.timestampFormat, raw, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse timestamp %q: %v", raw, err)
+	}
+	return formalizeTimestamp(timestamp), nil
+}
+
+// flattenFields flattens a decoded JSON object into a map from '.' separated field
+// paths to string values.
+func flattenFields(prefix string, obj map[string]interface{}, fields map[string]string) {
+	for key, value := range obj {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenFields(path, v, fields)
+		case string:
+			fields[path] = v
+		case float64:
+			fields[path] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+			fields[path] = ""
+		default:
+			// Booleans and arrays are exposed in their JSON form.
+			raw, _ := json.Marshal(v)
+			fields[path] = string(raw)
+		}
+	}
+}
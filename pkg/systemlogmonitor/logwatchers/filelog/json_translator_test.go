@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filelog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+func TestJSONTranslate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config map[string]string
+		input  string
+		err    bool
+		log    *logtypes.Log
+	}{
+		{
+			name:   "containerd log with default fields",
+			config: map[string]string{"format": "json"},
+			input:  `{"time":"2020-02-01T17:58:34.5Z","level":"error","msg":"failed to pull image"}`,
+			log: &logtypes.Log{
+				Timestamp: time.Date(2020, 2, 1, 17, 58, 34, 500000000, time.UTC),
+				Message:   "failed to pull image",
+				Fields:    map[string]string{"level": "error"},
+			},
+		},
+		{
+			name: "kubelet log with unix timestamp",
+			config: map[string]string{
+				"format":          "json",
+				"timestampField":  "ts",
+				"timestampFormat": "unix",
+			},
+			input: `{"ts":1580579914.25,"v":0,"msg":"PLEG is not healthy"}`,
+			log: &logtypes.Log{
+				Timestamp: time.Unix(1580579914, 250000000),
+				Message:   "PLEG is not healthy",
+				Fields:    map[string]string{"v": "0"},
+			},
+		},
+		{
+			name: "nested fields",
+			config: map[string]string{
+				"format":         "json",
+				"timestampField": "meta.time",
+				"messageField":   "log",
+			},
+			input: `{"meta":{"time":"2020-02-01T17:58:34Z","pod":{"name":"foo"}},"log":"oops\n","stream":"stderr","ok":false}`,
+			log: &logtypes.Log{
+				Timestamp: time.Date(2020, 2, 1, 17, 58, 34, 0, time.UTC),
+				Message:   "oops",
+				Fields:    map[string]string{"meta.pod.name": "foo", "stream": "stderr", "ok": "false"},
+			},
+		},
+		{
+			name:   "not a JSON line",
+			config: map[string]string{"format": "json"},
+			input:  "May  1 12:23:45 hostname kernel: [0.000000] component: log message",
+			err:    true,
+		},
+		{
+			name:   "missing message field",
+			config: map[string]string{"format": "json"},
+			input:  `{"time":"2020-02-01T17:58:34Z"}`,
+			err:    true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			trans := newLogTranslatorOrDie(test.config)
+			log, err := trans.translate(test.input)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, test.log.Timestamp.Equal(log.Timestamp), "expected %v, got %v", test.log.Timestamp, log.Timestamp)
+			assert.Equal(t, test.log.Message, log.Message)
+			assert.Equal(t, test.log.Fields, log.Fields)
+		})
+	}
+}
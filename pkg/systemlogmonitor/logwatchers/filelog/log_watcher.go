@@ -29,6 +29,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/google/cadvisor/utils/tail"
 
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/lookback"
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
 	"k8s.io/node-problem-detector/pkg/util"
@@ -39,9 +40,10 @@ type filelogWatcher struct {
 	cfg        types.WatcherConfig
 	reader     *bufio.Reader
 	closer     io.Closer
-	translator *translator
+	translator logTranslator
 	logCh      chan *logtypes.Log
 	startTime  time.Time
+	throttle   *lookback.Throttle
 	tomb       *tomb.Tomb
 	clock      utilclock.Clock
 }
@@ -58,15 +60,17 @@ func NewSyslogWatcherOrDie(cfg types.WatcherConfig) types.LogWatcher {
 		glog.Fatalf("failed to get start time: %v", err)
 	}
 
-	return &filelogWatcher{
+	w := &filelogWatcher{
 		cfg:        cfg,
-		translator: newTranslatorOrDie(cfg.PluginConfig),
+		translator: newLogTranslatorOrDie(cfg.PluginConfig),
 		startTime:  startTime,
 		tomb:       tomb.NewTomb(),
 		// A capacity 1000 buffer should be enough
 		logCh: make(chan *logtypes.Log, 1000),
 		clock: utilclock.NewClock(),
 	}
+	w.throttle = lookback.NewThrottle(cfg, time.Now(), w.clock, w.tomb.Stopping())
+	return w
 }
 
 // Make sure NewSyslogWatcher is types.WatcherCreateFunc.
@@ -102,6 +106,7 @@ func (s *filelogWatcher) watchLoop() {
 		s.tomb.Done()
 	}()
 	var buffer bytes.Buffer
+	idle := false
 	for {
 		select {
 		case <-s.tomb.Stopping():
@@ -117,9 +122,17 @@ func (s *filelogWatcher) watchLoop() {
 		}
 		buffer.WriteString(line)
 		if err == io.EOF {
+			s.throttle.CatchUp(s.sendLog)
+			// A log spanning multiple lines is complete once no line follows it
+			// for a poll interval.
+			if idle {
+				s.flush()
+			}
+			idle = true
 			time.Sleep(watchPollInterval)
 			continue
 		}
+		idle = false
 		line = buffer.String()
 		buffer.Reset()
 		log, err := s.translator.translate(strings.TrimSuffix(line, "\n"))
@@ -127,15 +140,38 @@ func (s *filelogWatcher) watchLoop() {
 			glog.Warningf("Unable to parse line: %q, %v", line, err)
 			continue
 		}
-		// Discard messages before start time.
-		if log.Timestamp.Before(s.startTime) {
-			glog.V(5).Infof("Throwing away msg %q before start time: %v < %v", log.Message, log.Timestamp, s.startTime)
-			continue
+		if log != nil {
+			s.send(log)
 		}
-		s.logCh <- log
 	}
 }
 
+// flush sends the log being assembled by multi-line translators, if any.
+func (s *filelogWatcher) flush() {
+	m, ok := s.translator.(multilineTranslator)
+	if !ok {
+		return
+	}
+	if log := m.flush(); log != nil {
+		s.send(log)
+	}
+}
+
+// send sends the log to the log channel through the lookback throttle, unless it is
+// before the start time.
+func (s *filelogWatcher) send(log *logtypes.Log) {
+	// Discard messages before start time.
+	if log.Timestamp.Before(s.startTime) {
+		glog.V(5).Infof("Throwing away msg %q before start time: %v < %v", log.Message, log.Timestamp, s.startTime)
+		return
+	}
+	s.throttle.Add(log, s.sendLog)
+}
+
+func (s *filelogWatcher) sendLog(log *logtypes.Log) {
+	s.logCh <- log
+}
+
 // getLogReader returns log reader for filelog log. Note that getLogReader doesn't look back
 // to the rolled out logs.
 func getLogReader(path string) (io.ReadCloser, error) {
@@ -179,3 +179,37 @@ Jan  2 03:04:05 kernel: [2.000000] 3
 		}
 	}
 }
+
+func TestWatchMultiline(t *testing.T) {
+	f, err := ioutil.TempFile("", "log_watcher_test")
+	assert.NoError(t, err)
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	_, err = f.Write([]byte(`I0102 03:04:05.000000    1234 kubelet.go:100] 1
+E0102 03:04:06.000000    1234 kubelet.go:200] 2
+goroutine 1 [running]:
+main.main()
+`))
+	assert.NoError(t, err)
+
+	w := NewSyslogWatcherOrDie(types.WatcherConfig{
+		Plugin:       "filelog",
+		PluginConfig: map[string]string{"preset": "kubelet"},
+		LogPath:      f.Name(),
+	})
+	w.(*filelogWatcher).startTime = time.Time{}
+	logCh, err := w.Watch()
+	assert.NoError(t, err)
+	defer w.Stop()
+	// The last log is only complete after the log file stays idle for a poll interval.
+	for _, expected := range []string{"1", "2\ngoroutine 1 [running]:\nmain.main()"} {
+		select {
+		case got := <-logCh:
+			assert.Equal(t, expected, got.Message)
+		case <-time.After(30 * time.Second):
+			t.Errorf("timeout waiting for log %q", expected)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filelog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+const (
+	// presetKey is the key of the built-in log format preset in the plugin configuration.
+	// A preset replaces the other keys of the plugin configuration.
+	presetKey = "preset"
+	// kubeletPreset parses the klog format of kubelet and other Kubernetes components,
+	// e.g. "I0102 15:04:05.123456    1234 kubelet.go:1234] message". The lines without
+	// klog header, e.g. stack traces, continue the previous log.
+	kubeletPreset = "kubelet"
+	// containerdPreset parses the logfmt format of containerd, e.g.
+	// `time="2020-01-02T15:04:05.123456789Z" level=error msg="message"`.
+	containerdPreset = "containerd"
+	// criPreset parses the CRI container log format, e.g.
+	// "2020-01-02T15:04:05.123456789Z stdout F message". Partial lines are joined.
+	criPreset = "cri"
+
+	// maxLogLength is the maximum length of a log assembled from multiple lines, the
+	// lines beyond it are dropped.
+	maxLogLength = 64 * 1024
+)
+
+// multilineTranslator is implemented by the translators of the log formats whose logs may
+// span multiple lines. translate returns nil without error for the lines which do not
+// complete a log, and flush returns the log being assembled, if any.
+type multilineTranslator interface {
+	logTranslator
+	flush() *logtypes.Log
+}
+
+// newPresetTranslator creates the translator of the preset.
+func newPresetTranslator(preset string) (logTranslator, error) {
+	switch preset {
+	case kubeletPreset:
+		return &klogTranslator{}, nil
+	case containerdPreset:
+		return &logfmtTranslator{}, nil
+	case criPreset:
+		return &criTranslator{partial: make(map[string]*logtypes.Log)}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format preset %q, must be one of %s, %s and %s",
+			preset, kubeletPreset, containerdPreset, criPreset)
+	}
+}
+
+// appendLine appends a line to the message of the log being assembled, unless it grows
+// beyond the maximum length.
+func appendLine(log *logtypes.Log, separator, line string) {
+	if len(log.Message)+len(separator)+len(line) > maxLogLength {
+		return
+	}
+	log.Message += separator + line
+}
+
+var (
+	klogHeader = regexp.MustCompile(`^([IWEF])(\d{4} \d{2}:\d{2}:\d{2}\.\d{6})\s+(\d+) ([^ \]]+)\] ?(.*)$`)
+	klogLevels = map[string]string{"I": "info", "W": "warning", "E": "error", "F": "fatal"}
+)
+
+// klogTimestampFormat is the format of the klog timestamp, which has no year.
+const klogTimestampFormat = "0102 15:04:05.000000"
+
+// klogTranslator translates the klog format. The level, pid and source location of the
+// logs are exposed as the "level", "pid" and "source" fields.
+type klogTranslator struct {
+	// pending is the log being assembled, it is complete when the next log starts.
+	pending *logtypes.Log
+}
+
+func (t *klogTranslator) translate(line string) (*logtypes.Log, error) {
+	matches := klogHeader.FindStringSubmatch(line)
+	if matches == nil {
+		if t.pending == nil {
+			return nil, fmt.Errorf("no klog header found in line %q", line)
+		}
+		appendLine(t.pending, "\n", line)
+		return nil, nil
+	}
+	timestamp, err := time.ParseInLocation(klogTimestampFormat, matches[2], time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp %q: %v", matches[2], err)
+	}
+	previous := t.pending
+	t.pending = &logtypes.Log{
+		Timestamp: formalizeTimestamp(timestamp),
+		Message:   matches[5],
+		Fields: map[string]string{
+			"level":  klogLevels[matches[1]],
+			"pid":    matches[3],
+			"source": matches[4],
+		},
+	}
+	return previous, nil
+}
+
+func (t *klogTranslator) flush() *logtypes.Log {
+	log := t.pending
+	t.pending = nil
+	return log
+}
+
+// logfmtTranslator translates the logfmt format of containerd. The fields other than
+// "time" and "msg", e.g. "level", are exposed as log fields.
+type logfmtTranslator struct{}
+
+func (t *logfmtTranslator) translate(line string) (*logtypes.Log, error) {
+	fields, err := parseLogfmt(line)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse line %q as logfmt: %v", line, err)
+	}
+	raw, ok := fields["time"]
+	if !ok {
+		return nil, fmt.Errorf("no time found in line %q", line)
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp %q: %v", raw, err)
+	}
+	message, ok := fields["msg"]
+	if !ok {
+		return nil, fmt.Errorf("no msg found in line %q", line)
+	}
+	delete(fields, "time")
+	delete(fields, "msg")
+	return &logtypes.Log{Timestamp: timestamp, Message: message, Fields: fields}, nil
+}
+
+// parseLogfmt parses the space separated key=value pairs of a logfmt line. Quoted values
+// are unquoted, and keys without value have an empty value.
+func parseLogfmt(line string) (map[string]string, error) {
+	fields := map[string]string{}
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return fields, nil
+		}
+		end := strings.IndexAny(line, "= ")
+		if end < 0 {
+			fields[line] = ""
+			return fields, nil
+		}
+		key := line[:end]
+		if line[end] == ' ' {
+			fields[key] = ""
+			line = line[end:]
+			continue
+		}
+		line = line[end+1:]
+		if !strings.HasPrefix(line, `"`) {
+			end = strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			fields[key] = line[:end]
+			line = line[end:]
+			continue
+		}
+		// Find the closing quote, skipping the escaped characters.
+		end = 1
+		for end < len(line) && line[end] != '"' {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			return nil, fmt.Errorf("unterminated quoted value of %q", key)
+		}
+		value, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted value of %q: %v", key, err)
+		}
+		fields[key] = value
+		line = line[end+1:]
+	}
+}
+
+var criLine = regexp.MustCompile(`^(\S+) (stdout|stderr) (\S+) (.*)$`)
+
+// criPartialTag is the tag of the CRI log lines which are continued by the next line of
+// the same stream.
+const criPartialTag = "P"
+
+// criTranslator translates the CRI container log format. The stream is exposed as the
+// "stream" field.
+type criTranslator struct {
+	// partial are the logs being assembled from partial lines, keyed by stream.
+	partial map[string]*logtypes.Log
+}
+
+func (t *criTranslator) translate(line string) (*logtypes.Log, error) {
+	matches := criLine.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, fmt.Errorf("no CRI log found in line %q", line)
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, matches[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp %q: %v", matches[1], err)
+	}
+	stream, message := matches[2], matches[4]
+	// The tags are separated by ':', the first one tells partial lines apart.
+	partial := strings.SplitN(matches[3], ":", 2)[0] == criPartialTag
+
+	log, ok := t.partial[stream]
+	if ok {
+		appendLine(log, "", message)
+	} else {
+		log = &logtypes.Log{Timestamp: timestamp, Message: message, Fields: map[string]string{"stream": stream}}
+	}
+	if partial {
+		t.partial[stream] = log
+		return nil, nil
+	}
+	delete(t.partial, stream)
+	return log, nil
+}
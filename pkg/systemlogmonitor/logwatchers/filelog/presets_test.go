@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filelog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+func TestPresets(t *testing.T) {
+	year := time.Now().Year()
+	testCases := map[string]struct {
+		preset string
+		lines  []string
+		logs   []*logtypes.Log
+		// flushed is the log returned by flush after the last line.
+		flushed *logtypes.Log
+		errs    int
+	}{
+		"kubelet with continuation lines": {
+			preset: "kubelet",
+			lines: []string{
+				"I0102 15:04:05.123456    1234 kubelet.go:1234] Started kubelet",
+				"E0102 15:04:06.000000    1234 pod_workers.go:190] Error syncing pod",
+				"goroutine 1 [running]:",
+				"W0102 15:04:07.000000    1234 eviction.go:10] Memory pressure",
+			},
+			logs: []*logtypes.Log{
+				{
+					Timestamp: time.Date(year, time.January, 2, 15, 4, 5, 123456000, time.Local),
+					Message:   "Started kubelet",
+					Fields:    map[string]string{"level": "info", "pid": "1234", "source": "kubelet.go:1234"},
+				},
+				{
+					Timestamp: time.Date(year, time.January, 2, 15, 4, 6, 0, time.Local),
+					Message:   "Error syncing pod\ngoroutine 1 [running]:",
+					Fields:    map[string]string{"level": "error", "pid": "1234", "source": "pod_workers.go:190"},
+				},
+			},
+			flushed: &logtypes.Log{
+				Timestamp: time.Date(year, time.January, 2, 15, 4, 7, 0, time.Local),
+				Message:   "Memory pressure",
+				Fields:    map[string]string{"level": "warning", "pid": "1234", "source": "eviction.go:10"},
+			},
+		},
+		"kubelet continuation line without log": {
+			preset: "kubelet",
+			lines:  []string{"goroutine 1 [running]:"},
+			errs:   1,
+		},
+		"containerd": {
+			preset: "containerd",
+			lines: []string{
+				`time="2020-01-02T15:04:05.123456789Z" level=error msg="failed to pull image \"foo\"" error="not found"`,
+				`level=info msg="no time"`,
+			},
+			logs: []*logtypes.Log{
+				{
+					Timestamp: time.Date(2020, time.January, 2, 15, 4, 5, 123456789, time.UTC),
+					Message:   `failed to pull image "foo"`,
+					Fields:    map[string]string{"level": "error", "error": "not found"},
+				},
+			},
+			errs: 1,
+		},
+		"cri with partial lines": {
+			preset: "cri",
+			lines: []string{
+				"2020-01-02T15:04:05.000000000Z stdout P part 1,",
+				"2020-01-02T15:04:05.100000000Z stderr F error",
+				"2020-01-02T15:04:05.200000000Z stdout F  part 2",
+				"invalid",
+			},
+			logs: []*logtypes.Log{
+				{
+					Timestamp: time.Date(2020, time.January, 2, 15, 4, 5, 100000000, time.UTC),
+					Message:   "error",
+					Fields:    map[string]string{"stream": "stderr"},
+				},
+				{
+					Timestamp: time.Date(2020, time.January, 2, 15, 4, 5, 0, time.UTC),
+					Message:   "part 1, part 2",
+					Fields:    map[string]string{"stream": "stdout"},
+				},
+			},
+			errs: 1,
+		},
+	}
+	for desc, test := range testCases {
+		t.Run(desc, func(t *testing.T) {
+			trans := NewTranslatorOrDie(map[string]string{presetKey: test.preset})
+			var logs []*logtypes.Log
+			errs := 0
+			for _, line := range test.lines {
+				log, err := trans.Translate(line)
+				if err != nil {
+					errs++
+					continue
+				}
+				if log != nil {
+					logs = append(logs, log)
+				}
+			}
+			assert.Equal(t, test.logs, logs)
+			assert.Equal(t, test.errs, errs)
+			assert.Equal(t, test.flushed, trans.Flush())
+		})
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	fields, err := parseLogfmt(`a=1 b="x \"y\" z"  c d=`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": `x "y" z`, "c": "", "d": ""}, fields)
+
+	_, err = parseLogfmt(`a="unterminated`)
+	assert.Error(t, err)
+}
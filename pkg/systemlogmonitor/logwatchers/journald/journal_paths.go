@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journald
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The helpers in this file do not need libsystemd, so that they are built and tested
+// without the journald build tag.
+
+const (
+	// configSourceKey is the key of source configuration in the plugin configuration.
+	configSourceKey = "source"
+	// configNamespaceKey is the key of the journal namespace configuration in the plugin
+	// configuration.
+	configNamespaceKey = "namespace"
+	// configMachineIDKey is the key of the machine ID configuration in the plugin
+	// configuration.
+	configMachineIDKey = "machineID"
+	// configHostnameKey is the key of the hostname configuration in the plugin
+	// configuration.
+	configHostnameKey = "hostname"
+)
+
+// defaultJournalDirs are the directories of the persistent and the volatile journals,
+// which contain the journals of the namespaces.
+var defaultJournalDirs = []string{"/var/log/journal", "/run/log/journal"}
+
+// namespaceDir returns the directory of the journals of a namespace, written by
+// systemd-journald@<namespace>. It is named "<machine ID>.<namespace>" in the first of
+// the journal directories which has one. When the journal directory is shared by several
+// machines, the machine ID selects one of them.
+func namespaceDir(journalDirs []string, namespace, machineID string) (string, error) {
+	if strings.ContainsAny(namespace, "/.") {
+		return "", fmt.Errorf("invalid journal namespace %q", namespace)
+	}
+	suffix := "." + namespace
+	for _, journalDir := range journalDirs {
+		files, err := ioutil.ReadDir(journalDir)
+		if err != nil {
+			continue
+		}
+		var dirs []string
+		for _, f := range files {
+			if !f.IsDir() || !strings.HasSuffix(f.Name(), suffix) || f.Name() == suffix {
+				continue
+			}
+			if machineID != "" && f.Name() != machineID+suffix {
+				continue
+			}
+			dirs = append(dirs, f.Name())
+		}
+		switch len(dirs) {
+		case 0:
+			continue
+		case 1:
+			return filepath.Join(journalDir, dirs[0]), nil
+		default:
+			sort.Strings(dirs)
+			return "", fmt.Errorf("journal namespace %q of several machines %v found in %q, set %s to select one",
+				namespace, dirs, journalDir, configMachineIDKey)
+		}
+	}
+	return "", fmt.Errorf("journal namespace %q not found in %v", namespace, journalDirs)
+}
+
+// journalFilters returns the values of the journal fields which the watched entries must
+// match, by field.
+func journalFilters(pluginConfig map[string]string) (map[string]string, error) {
+	// Empty source is not allowed and treated as an error.
+	source := pluginConfig[configSourceKey]
+	if source == "" {
+		return nil, fmt.Errorf("failed to filter journal log, empty source is not allowed")
+	}
+	filters := map[string]string{"SYSLOG_IDENTIFIER": source}
+	// Remote journals contain the entries of many machines.
+	if machineID := pluginConfig[configMachineIDKey]; machineID != "" {
+		filters["_MACHINE_ID"] = machineID
+	}
+	if hostname := pluginConfig[configHostnameKey]; hostname != "" {
+		filters["_HOSTNAME"] = hostname
+	}
+	return filters, nil
+}
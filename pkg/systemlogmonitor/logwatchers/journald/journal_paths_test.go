@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journald
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "journald")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	persistent := filepath.Join(root, "persistent")
+	volatile := filepath.Join(root, "volatile")
+	remote := filepath.Join(root, "remote")
+	for _, dir := range []string{
+		filepath.Join(persistent, "m1"),
+		filepath.Join(persistent, "m1.audit"),
+		filepath.Join(volatile, "m1.audit"),
+		filepath.Join(volatile, "m1.kubelet"),
+		filepath.Join(remote, "m1.audit"),
+		filepath.Join(remote, "m2.audit"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	// A file is not a namespace directory.
+	if err := ioutil.WriteFile(filepath.Join(persistent, "m2.kubelet"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, test := range []struct {
+		dirs      []string
+		namespace string
+		machineID string
+		expected  string
+		expectErr bool
+	}{
+		{dirs: []string{persistent, volatile}, namespace: "audit", expected: filepath.Join(persistent, "m1.audit")},
+		// The volatile journals are read until the journals are flushed.
+		{dirs: []string{persistent, volatile}, namespace: "kubelet", expected: filepath.Join(volatile, "m1.kubelet")},
+		{dirs: []string{remote}, namespace: "audit", expectErr: true},
+		{dirs: []string{remote}, namespace: "audit", machineID: "m2", expected: filepath.Join(remote, "m2.audit")},
+		{dirs: []string{remote}, namespace: "audit", machineID: "m3", expectErr: true},
+		{dirs: []string{persistent, volatile}, namespace: "missing", expectErr: true},
+		{dirs: []string{persistent, filepath.Join(root, "missing")}, namespace: "audit", expected: filepath.Join(persistent, "m1.audit")},
+		{dirs: []string{persistent}, namespace: "../m1", expectErr: true},
+	} {
+		dir, err := namespaceDir(test.dirs, test.namespace, test.machineID)
+		if test.expectErr {
+			assert.Error(t, err, "namespace %q of machine %q in %v", test.namespace, test.machineID, test.dirs)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, dir)
+	}
+}
+
+func TestJournalFilters(t *testing.T) {
+	_, err := journalFilters(map[string]string{configHostnameKey: "node-1"})
+	assert.Error(t, err, "source is required")
+
+	filters, err := journalFilters(map[string]string{configSourceKey: "kernel"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"SYSLOG_IDENTIFIER": "kernel"}, filters)
+
+	filters, err = journalFilters(map[string]string{configSourceKey: "kernel", configMachineIDKey: "m1", configHostnameKey: "node-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"SYSLOG_IDENTIFIER": "kernel", "_MACHINE_ID": "m1", "_HOSTNAME": "node-1"}, filters)
+}
@@ -24,9 +24,11 @@ import (
 	"strings"
 	"time"
 
+	utilclock "code.cloudfoundry.org/clock"
 	"github.com/coreos/go-systemd/sdjournal"
 	"github.com/golang/glog"
 
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/lookback"
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
 	"k8s.io/node-problem-detector/pkg/util"
@@ -43,6 +45,7 @@ type journaldWatcher struct {
 	journal   *sdjournal.Journal
 	cfg       types.WatcherConfig
 	startTime time.Time
+	throttle  *lookback.Throttle
 	logCh     chan *logtypes.Log
 	tomb      *tomb.Tomb
 }
@@ -58,13 +61,15 @@ func NewJournaldWatcher(cfg types.WatcherConfig) types.LogWatcher {
 		glog.Fatalf("failed to get start time: %v", err)
 	}
 
-	return &journaldWatcher{
+	j := &journaldWatcher{
 		cfg:       cfg,
 		startTime: startTime,
 		tomb:      tomb.NewTomb(),
 		// A capacity 1000 buffer should be enough
 		logCh: make(chan *logtypes.Log, 1000),
 	}
+	j.throttle = lookback.NewThrottle(cfg, time.Now(), utilclock.NewClock(), j.tomb.Stopping())
+	return j
 }
 
 // Make sure NewJournaldWatcher is types.WatcherCreateFunc .
@@ -114,6 +119,7 @@ func (j *journaldWatcher) watchLoop() {
 		}
 		// If next reaches the end, wait for waitLogTimeout.
 		if n == 0 {
+			j.throttle.CatchUp(j.send)
 			j.journal.Wait(waitLogTimeout)
 			continue
 		}
@@ -130,20 +136,34 @@ func (j *journaldWatcher) watchLoop() {
 			continue
 		}
 
-		j.logCh <- translate(entry)
+		j.throttle.Add(translate(entry), j.send)
 	}
 }
 
-const (
-	// configSourceKey is the key of source configuration in the plugin configuration.
-	configSourceKey = "source"
-)
+func (j *journaldWatcher) send(log *logtypes.Log) {
+	j.logCh <- log
+}
 
 // getJournal returns a journal client.
 func getJournal(cfg types.WatcherConfig, startTime time.Time) (*sdjournal.Journal, error) {
+	filters, err := journalFilters(cfg.PluginConfig)
+	if err != nil {
+		return nil, err
+	}
+	logPath := cfg.LogPath
+	if namespace := cfg.PluginConfig[configNamespaceKey]; namespace != "" {
+		journalDirs := defaultJournalDirs
+		if logPath != "" {
+			journalDirs = []string{logPath}
+		}
+		logPath, err = namespaceDir(journalDirs, namespace, cfg.PluginConfig[configMachineIDKey])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var journal *sdjournal.Journal
-	var err error
-	if cfg.LogPath == "" {
+	if logPath == "" {
 		journal, err = sdjournal.NewJournal()
 		if err != nil {
 			return nil, fmt.Errorf("failed to create journal client from default log path: %v", err)
@@ -153,13 +173,13 @@ func getJournal(cfg types.WatcherConfig, startTime time.Time) (*sdjournal.Journa
 		// If the path doesn't exist, NewJournalFromDir will
 		// create it instead of returning error. So check the
 		// path existence ourselves.
-		if _, err = os.Stat(cfg.LogPath); err != nil {
-			return nil, fmt.Errorf("failed to stat the log path %q: %v", cfg.LogPath, err)
+		if _, err = os.Stat(logPath); err != nil {
+			return nil, fmt.Errorf("failed to stat the log path %q: %v", logPath, err)
 		}
 		// Get journal client from the log path.
-		journal, err = sdjournal.NewJournalFromDir(cfg.LogPath)
+		journal, err = sdjournal.NewJournalFromDir(logPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create journal client from path %q: %v", cfg.LogPath, err)
+			return nil, fmt.Errorf("failed to create journal client from path %q: %v", logPath, err)
 		}
 	}
 	// Seek journal client based on startTime.
@@ -172,18 +192,13 @@ func getJournal(cfg types.WatcherConfig, startTime time.Time) (*sdjournal.Journa
 	if err != nil {
 		return nil, fmt.Errorf("failed to seek journal at %v (now %v): %v", seekTime, now, err)
 	}
-	// Empty source is not allowed and treated as an error.
-	source := cfg.PluginConfig[configSourceKey]
-	if source == "" {
-		return nil, fmt.Errorf("failed to filter journal log, empty source is not allowed")
-	}
-	match := sdjournal.Match{
-		Field: sdjournal.SD_JOURNAL_FIELD_SYSLOG_IDENTIFIER,
-		Value: source,
-	}
-	err = journal.AddMatch(match.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to add log filter %#v: %v", match, err)
+	// Matches of different fields must all be satisfied.
+	for field, value := range filters {
+		match := sdjournal.Match{Field: field, Value: value}
+		err = journal.AddMatch(match.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to add log filter %#v: %v", match, err)
+		}
 	}
 	return journal, nil
 }
@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kmsg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/util"
+)
+
+const (
+	// procUptimePath is the path of the uptime of the node, which counts the time
+	// suspended.
+	procUptimePath = "/proc/uptime"
+	// reanchorInterval is the interval at which the kernel clock is re-anchored to the
+	// wall clock.
+	reanchorInterval = time.Minute
+	// maxClockSkew is the skew between the wall clock and the monotonic clock above which
+	// the kernel clock is re-anchored right away. It is also the maximum error tolerated
+	// in the timestamps, since the parser truncates the uptime to seconds.
+	maxClockSkew = 2 * time.Second
+)
+
+// processStart is the reference of the monotonic clock of the process.
+var processStart = time.Now()
+
+// clockAnchor corrects the timestamps of the kernel messages. The parser translates the
+// kernel timestamps, which are monotonic since boot and stop while the node is
+// suspended, to wall time with the boot time computed when /dev/kmsg was opened. The
+// translated timestamps are wildly wrong after a suspend, or after the wall clock jumps,
+// e.g. after the live migration of a virtual machine. clockAnchor re-reads the uptime
+// periodically, and whenever the wall clock and the monotonic clock diverge, to
+// re-anchor the kernel clock to the wall clock.
+type clockAnchor struct {
+	now        func() time.Time
+	monotonic  func() time.Duration
+	readUptime func() (time.Duration, error)
+	// parserUptime returns the uptime in seconds the parser computes the boot time with.
+	parserUptime func() (time.Duration, error)
+
+	// parserBoot is the boot time the parser translates the timestamps with.
+	parserBoot time.Time
+	// offset is the correction added to the timestamps of the parser.
+	offset time.Duration
+	// suspended is the time the node was suspended since the process started, which the
+	// uptime counts but the kernel timestamps do not.
+	suspended time.Duration
+	// lastWall, lastMonotonic and lastUptime are the clocks at the last anchoring.
+	lastWall      time.Time
+	lastMonotonic time.Duration
+	lastUptime    time.Duration
+}
+
+func newClockAnchor() *clockAnchor {
+	return &clockAnchor{
+		now:          time.Now,
+		monotonic:    func() time.Duration { return time.Since(processStart) },
+		readUptime:   readProcUptime,
+		parserUptime: util.GetUptimeDuration,
+	}
+}
+
+// readProcUptime returns the uptime in /proc/uptime, which is more precise than the
+// seconds of sysinfo.
+func readProcUptime() (time.Duration, error) {
+	data, err := ioutil.ReadFile(procUptimePath)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty %s", procUptimePath)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uptime %q: %v", fields[0], err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parserOpened records the boot time the parser computes when /dev/kmsg is opened, and
+// anchors the kernel clock.
+func (a *clockAnchor) parserOpened() {
+	if a == nil {
+		return
+	}
+	uptime, err := a.parserUptime()
+	if err != nil {
+		glog.Errorf("Failed to get uptime, kernel timestamps are not corrected: %v", err)
+		return
+	}
+	a.parserBoot = a.now().Round(0).Add(-uptime)
+	a.anchor()
+}
+
+// translate returns the corrected timestamp of a kernel message translated by the parser,
+// re-anchoring the kernel clock if needed.
+func (a *clockAnchor) translate(timestamp time.Time) time.Time {
+	if a == nil || a.parserBoot.IsZero() {
+		return timestamp
+	}
+	wall := a.now().Round(0).Sub(a.lastWall)
+	monotonic := a.monotonic() - a.lastMonotonic
+	if skew := wall - monotonic; monotonic >= reanchorInterval || skew > maxClockSkew || skew < -maxClockSkew {
+		a.anchor()
+	}
+	return timestamp.Add(a.offset)
+}
+
+// anchor re-reads the uptime and re-computes the offset of the timestamps. The uptime
+// advancing faster than the monotonic clock is the time the node was suspended.
+func (a *clockAnchor) anchor() {
+	uptime, err := a.readUptime()
+	if err != nil {
+		glog.Errorf("Failed to read uptime, keeping the kernel clock anchor: %v", err)
+		return
+	}
+	now := a.now().Round(0)
+	monotonic := a.monotonic()
+	if !a.lastWall.IsZero() {
+		if suspended := (uptime - a.lastUptime) - (monotonic - a.lastMonotonic); suspended > maxClockSkew {
+			glog.Infof("Node was suspended for %v, correcting kernel timestamps", suspended)
+			a.suspended += suspended
+		}
+	}
+	a.lastWall, a.lastMonotonic, a.lastUptime = now, monotonic, uptime
+
+	// The kernel clock reads the uptime without the time suspended.
+	boot := now.Add(-(uptime - a.suspended))
+	offset := boot.Sub(a.parserBoot)
+	if offset < maxClockSkew && offset > -maxClockSkew {
+		offset = 0
+	}
+	if offset != a.offset {
+		glog.Warningf("Kernel clock drifted from the wall clock, correcting kernel timestamps by %v", offset)
+		a.offset = offset
+	}
+}
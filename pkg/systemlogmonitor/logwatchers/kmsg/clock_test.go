@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kmsg
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClocks are the wall clock, the monotonic clock and the uptime of a node.
+type fakeClocks struct {
+	wall      time.Time
+	monotonic time.Duration
+	uptime    time.Duration
+	err       error
+}
+
+// run advances the clocks as the node runs.
+func (c *fakeClocks) run(d time.Duration) {
+	c.wall = c.wall.Add(d)
+	c.monotonic += d
+	c.uptime += d
+}
+
+func newTestClockAnchor(c *fakeClocks) *clockAnchor {
+	return &clockAnchor{
+		now:        func() time.Time { return c.wall },
+		monotonic:  func() time.Duration { return c.monotonic },
+		readUptime: func() (time.Duration, error) { return c.uptime, c.err },
+		// The parser truncates the uptime to seconds.
+		parserUptime: func() (time.Duration, error) { return c.uptime.Truncate(time.Second), nil },
+	}
+}
+
+func TestClockAnchor(t *testing.T) {
+	boot := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	c := &fakeClocks{wall: boot.Add(time.Hour + 500*time.Millisecond), uptime: time.Hour + 500*time.Millisecond}
+	a := newTestClockAnchor(c)
+	a.parserOpened()
+	// parserTimestamp is the timestamp the parser translates a message logged now to.
+	kernelClock := c.uptime
+	parserTimestamp := func() time.Time { return a.parserBoot.Add(kernelClock) }
+
+	// The truncation of the uptime by the parser is tolerated.
+	assert.Equal(t, parserTimestamp(), a.translate(parserTimestamp()))
+
+	// The kernel clock stops while the node is suspended, the uptime does not.
+	c.run(10 * time.Second)
+	kernelClock += 10 * time.Second
+	c.wall = c.wall.Add(8 * time.Hour)
+	c.uptime += 8 * time.Hour
+	assert.Equal(t, c.wall, a.translate(parserTimestamp()))
+	assert.Equal(t, 8*time.Hour, a.suspended)
+
+	// The wall clock jumps after the live migration of a virtual machine.
+	c.run(time.Second)
+	kernelClock += time.Second
+	c.wall = c.wall.Add(-time.Hour)
+	assert.Equal(t, c.wall, a.translate(parserTimestamp()))
+
+	// The anchor is kept when the uptime can not be read.
+	c.run(reanchorInterval)
+	kernelClock += reanchorInterval
+	c.err = errors.New("no uptime")
+	assert.Equal(t, c.wall, a.translate(parserTimestamp()))
+
+	// The suspended time is counted in the boot time of a parser reopened.
+	c.err = nil
+	a.parserOpened()
+	assert.Equal(t, c.wall, a.translate(parserTimestamp()))
+}
+
+func TestClockAnchorNil(t *testing.T) {
+	var a *clockAnchor
+	a.parserOpened()
+	now := time.Now()
+	assert.Equal(t, now, a.translate(now))
+}
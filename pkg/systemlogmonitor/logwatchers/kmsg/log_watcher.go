@@ -19,26 +19,78 @@ package kmsg
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	utilclock "code.cloudfoundry.org/clock"
 	"github.com/euank/go-kmsg-parser/kmsgparser"
 	"github.com/golang/glog"
 
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/lookback"
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	npdt "k8s.io/node-problem-detector/pkg/types"
 	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
 	"k8s.io/node-problem-detector/pkg/util/tomb"
 )
 
+const (
+	// OverflowReason is the reason of the event reported when kernel messages were
+	// dropped because the ring buffer was overrun before they were read.
+	OverflowReason = "KmsgOverflow"
+	// reopenDelay is the delay before /dev/kmsg is reopened after the parser stopped.
+	reopenDelay = time.Second
+	// catchUpDelay is the time without new message after which the lookback scan caught
+	// up with the end of the ring buffer.
+	catchUpDelay = time.Second
+)
+
+var (
+	droppedMessages     metrics.Int64MetricInterface
+	droppedMessagesOnce sync.Once
+)
+
+// droppedMessagesMetricOrDie returns the metric counting the kernel messages dropped
+// because the ring buffer was overrun, panic if error occurs.
+func droppedMessagesMetricOrDie() metrics.Int64MetricInterface {
+	droppedMessagesOnce.Do(func() {
+		metric, err := metrics.NewInt64Metric(
+			metrics.KmsgDroppedMessagesID,
+			string(metrics.KmsgDroppedMessagesID),
+			"Number of kernel messages dropped because the kmsg ring buffer was overrun before they were read.",
+			"1",
+			metrics.Sum,
+			[]string{})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.KmsgDroppedMessagesID, err)
+		}
+		droppedMessages = metric
+	})
+	return droppedMessages
+}
+
 type kernelLogWatcher struct {
 	cfg       types.WatcherConfig
 	startTime time.Time
+	throttle  *lookback.Throttle
 	logCh     chan *logtypes.Log
 	tomb      *tomb.Tomb
 
 	kmsgParser kmsgparser.Parser
+	newParser  func() (kmsgparser.Parser, error)
 	clock      utilclock.Clock
+	// anchor corrects the timestamps of the parser, nil to keep them.
+	anchor *clockAnchor
+
+	// lastSequence is the sequence number of the last message read, -1 before the first
+	// message is read.
+	lastSequence int
+	// skipUntil is the sequence number until which messages are skipped after /dev/kmsg
+	// is reopened, because they were already read. It is -1 when no message is skipped.
+	skipUntil int
+	// dropped is nil when metrics reporting is disabled.
+	dropped metrics.Int64MetricInterface
 }
 
 // NewKmsgWatcher creates a watcher which will read messages from /dev/kmsg
@@ -52,14 +104,23 @@ func NewKmsgWatcher(cfg types.WatcherConfig) types.LogWatcher {
 		glog.Fatalf("failed to get start time: %v", err)
 	}
 
-	return &kernelLogWatcher{
+	k := &kernelLogWatcher{
 		cfg:       cfg,
 		startTime: startTime,
 		tomb:      tomb.NewTomb(),
 		// Arbitrary capacity
-		logCh: make(chan *logtypes.Log, 100),
-		clock: utilclock.NewClock(),
+		logCh:        make(chan *logtypes.Log, 100),
+		newParser:    kmsgparser.NewParser,
+		clock:        utilclock.NewClock(),
+		anchor:       newClockAnchor(),
+		lastSequence: -1,
+		skipUntil:    -1,
 	}
+	if cfg.MetricsReporting {
+		k.dropped = droppedMessagesMetricOrDie()
+	}
+	k.throttle = lookback.NewThrottle(cfg, time.Now(), k.clock, k.tomb.Stopping())
+	return k
 }
 
 var _ types.WatcherCreateFunc = NewKmsgWatcher
@@ -67,12 +128,13 @@ var _ types.WatcherCreateFunc = NewKmsgWatcher
 func (k *kernelLogWatcher) Watch() (<-chan *logtypes.Log, error) {
 	if k.kmsgParser == nil {
 		// nil-check to make mocking easier
-		parser, err := kmsgparser.NewParser()
+		parser, err := k.newParser()
 		if err != nil {
 			return nil, fmt.Errorf("failed to create kmsg parser: %v", err)
 		}
 		k.kmsgParser = parser
 	}
+	k.anchor.parserOpened()
 
 	go k.watchLoop()
 	return k.logCh, nil
@@ -95,20 +157,48 @@ func (k *kernelLogWatcher) watchLoop() {
 		k.tomb.Done()
 	}()
 
+	// The ring buffer is read to the end when no message follows for a while. The
+	// timer is created once the lookback scan is throttled, and reset on each message.
+	var catchUpTimer utilclock.Timer
+	defer func() {
+		if catchUpTimer != nil {
+			catchUpTimer.Stop()
+		}
+	}()
 	for {
+		var caughtUp <-chan time.Time
+		if !k.throttle.Done() {
+			if catchUpTimer == nil {
+				catchUpTimer = k.clock.NewTimer(catchUpDelay)
+			} else {
+				resetTimer(catchUpTimer, catchUpDelay)
+			}
+			caughtUp = catchUpTimer.C()
+		}
 		select {
 		case <-k.tomb.Stopping():
 			glog.Infof("Stop watching kernel log")
 			return
+		case <-caughtUp:
+			k.throttle.CatchUp(k.send)
 		case msg, ok := <-kmsgs:
 			if !ok {
-				glog.Error("Kmsg channel closed")
-				return
+				glog.Error("Kmsg channel closed, reopening /dev/kmsg")
+				if !k.reopen() {
+					return
+				}
+				kmsgs = k.kmsgParser.Parse()
+				continue
 			}
 			glog.V(5).Infof("got kernel message: %+v", msg)
+			dropped := k.sequence(msg.SequenceNumber)
+			if dropped < 0 {
+				continue
+			}
 			if msg.Message == "" {
 				continue
 			}
+			msg.Timestamp = k.anchor.translate(msg.Timestamp)
 
 			// Discard messages before start time.
 			if msg.Timestamp.Before(k.startTime) {
@@ -116,10 +206,90 @@ func (k *kernelLogWatcher) watchLoop() {
 				continue
 			}
 
-			k.logCh <- &logtypes.Log{
+			if dropped > 0 {
+				k.reportOverflow(dropped, msg.Timestamp)
+			}
+
+			k.throttle.Add(&logtypes.Log{
 				Message:   strings.TrimSpace(msg.Message),
 				Timestamp: msg.Timestamp,
-			}
+			}, k.send)
 		}
 	}
 }
+
+func (k *kernelLogWatcher) send(log *logtypes.Log) {
+	k.logCh <- log
+}
+
+// resetTimer resets a timer which may have fired without being received from.
+func resetTimer(timer utilclock.Timer, d time.Duration) {
+	timer.Stop()
+	select {
+	case <-timer.C():
+	default:
+	}
+	timer.Reset(d)
+}
+
+// sequence records the sequence number of a message, and returns the number of messages
+// dropped before it, or -1 if the message was already read before /dev/kmsg was reopened.
+func (k *kernelLogWatcher) sequence(seq int) int {
+	if k.skipUntil >= 0 {
+		if seq <= k.skipUntil {
+			return -1
+		}
+		k.skipUntil = -1
+	}
+	dropped := 0
+	if k.lastSequence >= 0 && seq > k.lastSequence+1 {
+		dropped = seq - k.lastSequence - 1
+	}
+	k.lastSequence = seq
+	return dropped
+}
+
+// reportOverflow counts the dropped messages, and reports them with an event, whatever
+// the rules of the log monitor.
+func (k *kernelLogWatcher) reportOverflow(dropped int, timestamp time.Time) {
+	glog.Warningf("Kmsg ring buffer overrun, %d messages dropped", dropped)
+	if k.dropped != nil {
+		if err := k.dropped.Record(map[string]string{}, int64(dropped)); err != nil {
+			glog.Errorf("Failed to update %s metric: %v", metrics.KmsgDroppedMessagesID, err)
+		}
+	}
+	k.throttle.Add(&logtypes.Log{
+		Timestamp: timestamp,
+		Event: &npdt.Event{
+			Severity:  npdt.Warn,
+			Timestamp: timestamp,
+			Reason:    OverflowReason,
+			Message:   fmt.Sprintf("kmsg ring buffer overrun, %d messages dropped", dropped),
+		},
+	}, k.send)
+}
+
+// reopen reopens /dev/kmsg until it succeeds or the watcher is stopped, and returns
+// whether it succeeded. The messages already read are skipped after it is reopened.
+func (k *kernelLogWatcher) reopen() bool {
+	if err := k.kmsgParser.Close(); err != nil {
+		glog.Errorf("Failed to close kmsg parser: %v", err)
+	}
+	for {
+		select {
+		case <-k.tomb.Stopping():
+			glog.Infof("Stop watching kernel log")
+			return false
+		case <-k.clock.After(reopenDelay):
+		}
+		parser, err := k.newParser()
+		if err != nil {
+			glog.Errorf("Failed to reopen kmsg parser: %v", err)
+			continue
+		}
+		k.kmsgParser = parser
+		k.anchor.parserOpened()
+		k.skipUntil = k.lastSequence
+		return true
+	}
+}
@@ -25,9 +25,13 @@ import (
 
 	"time"
 
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/lookback"
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	npdt "k8s.io/node-problem-detector/pkg/types"
 	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
 )
 
 type mockKmsgParser struct {
@@ -47,6 +51,23 @@ func (m *mockKmsgParser) Parse() <-chan kmsgparser.Message {
 }
 func (m *mockKmsgParser) SeekEnd() error { return nil }
 
+// closingKmsgParser closes the message channel after sending the messages, like the
+// parser does when reading /dev/kmsg fails.
+type closingKmsgParser struct {
+	mockKmsgParser
+}
+
+func (m *closingKmsgParser) Parse() <-chan kmsgparser.Message {
+	c := make(chan kmsgparser.Message)
+	go func() {
+		defer close(c)
+		for _, msg := range m.kmsgs {
+			c <- msg
+		}
+	}()
+	return c
+}
+
 func TestWatch(t *testing.T) {
 	now := time.Date(time.Now().Year(), time.January, 2, 3, 4, 5, 0, time.Local)
 	fakeClock := fakeclock.NewFakeClock(now)
@@ -171,3 +192,56 @@ func TestWatch(t *testing.T) {
 		}
 	}
 }
+
+func TestOverflowAndReopen(t *testing.T) {
+	now := time.Now()
+	fakeClock := fakeclock.NewFakeClock(now)
+	dropped := metrics.NewFakeInt64Metric("dropped", metrics.Sum, []string{})
+	w := &kernelLogWatcher{
+		startTime: now,
+		throttle:  lookback.NewThrottle(types.WatcherConfig{}, now, fakeClock, nil),
+		tomb:      tomb.NewTomb(),
+		logCh:     make(chan *logtypes.Log, 100),
+		clock:     fakeClock,
+		kmsgParser: &closingKmsgParser{mockKmsgParser{kmsgs: []kmsgparser.Message{
+			{SequenceNumber: 1, Message: "1", Timestamp: now},
+			{SequenceNumber: 2, Message: "2", Timestamp: now.Add(time.Second)},
+			{SequenceNumber: 5, Message: "5", Timestamp: now.Add(2 * time.Second)},
+		}}},
+		// The messages already read are read again after /dev/kmsg is reopened.
+		newParser: func() (kmsgparser.Parser, error) {
+			return &mockKmsgParser{kmsgs: []kmsgparser.Message{
+				{SequenceNumber: 4, Message: "4", Timestamp: now.Add(time.Second)},
+				{SequenceNumber: 5, Message: "5", Timestamp: now.Add(2 * time.Second)},
+				{SequenceNumber: 6, Message: "6", Timestamp: now.Add(3 * time.Second)},
+			}}, nil
+		},
+		lastSequence: -1,
+		skipUntil:    -1,
+		dropped:      dropped,
+	}
+	logCh, err := w.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	expected := []logtypes.Log{
+		{Message: "1", Timestamp: now},
+		{Message: "2", Timestamp: now.Add(time.Second)},
+		{Timestamp: now.Add(2 * time.Second), Event: &npdt.Event{
+			Severity:  npdt.Warn,
+			Timestamp: now.Add(2 * time.Second),
+			Reason:    OverflowReason,
+			Message:   "kmsg ring buffer overrun, 2 messages dropped",
+		}},
+		{Message: "5", Timestamp: now.Add(2 * time.Second)},
+	}
+	for _, e := range expected {
+		assert.Equal(t, e, *<-logCh)
+	}
+	fakeClock.WaitForWatcherAndIncrement(reopenDelay)
+	assert.Equal(t, logtypes.Log{Message: "6", Timestamp: now.Add(3 * time.Second)}, *<-logCh)
+	assert.Equal(t, []metrics.Int64MetricRepresentation{{Name: "dropped", Labels: map[string]string{}, Value: 2}},
+		dropped.ListMetrics())
+}
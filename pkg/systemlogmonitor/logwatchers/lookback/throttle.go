@@ -0,0 +1,141 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lookback throttles the lookback scan of the log watchers, i.e. reading the logs
+// written before the watcher started, so that a large backlog does not cause a CPU spike
+// and a burst of events at startup.
+package lookback
+
+import (
+	"time"
+
+	utilclock "code.cloudfoundry.org/clock"
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+// Throttle throttles the lookback scan of a log watcher. When the scan is limited in lines
+// or bytes, its logs are held back until the watcher catches up with the end of the log,
+// and only the most recent ones within the limits are sent. The logs of the scan are sent
+// at the replay rate, if any.
+type Throttle struct {
+	maxLines int
+	maxBytes int
+	// interval is the interval between the logs of the scan, 0 if they are not rate limited.
+	interval time.Duration
+	// watchStart is the time the watcher started, the logs before it belong to the scan.
+	watchStart time.Time
+	clock      utilclock.Clock
+	stopping   <-chan struct{}
+
+	// done is whether the watcher caught up with the end of the log.
+	done bool
+	// held are the logs of the scan held back, oldest first, and bytes is the size of their
+	// messages.
+	held    []*logtypes.Log
+	bytes   int
+	dropped int
+}
+
+// NewThrottle creates the throttle of the lookback scan configured for a watcher started
+// at watchStart. The replay of the logs held back stops when stopping is closed.
+func NewThrottle(cfg types.WatcherConfig, watchStart time.Time, clock utilclock.Clock, stopping <-chan struct{}) *Throttle {
+	t := &Throttle{
+		maxLines:   cfg.MaxLookbackLines,
+		maxBytes:   cfg.MaxLookbackBytes,
+		watchStart: watchStart,
+		clock:      clock,
+		stopping:   stopping,
+	}
+	if cfg.LookbackReplayRate > 0 {
+		t.interval = time.Duration(float64(time.Second) / cfg.LookbackReplayRate)
+	}
+	// Without limits nothing is held back, and the scan does not need to catch up.
+	t.done = !t.holding()
+	return t
+}
+
+// holding returns whether the logs of the scan are held back.
+func (t *Throttle) holding() bool {
+	return t.maxLines > 0 || t.maxBytes > 0
+}
+
+// Done returns whether no log is held back until the watcher catches up.
+func (t *Throttle) Done() bool {
+	return t.done
+}
+
+// Add handles a log read by the watcher. The logs of the scan are held back or rate
+// limited, the logs after it are sent right away with send once the scan caught up.
+func (t *Throttle) Add(log *logtypes.Log, send func(*logtypes.Log)) {
+	if !log.Timestamp.Before(t.watchStart) {
+		t.CatchUp(send)
+		send(log)
+		return
+	}
+	if t.done {
+		if t.interval > 0 && !t.wait() {
+			return
+		}
+		send(log)
+		return
+	}
+	t.held = append(t.held, log)
+	t.bytes += len(log.Message)
+	for len(t.held) > 1 && t.overLimits() {
+		t.bytes -= len(t.held[0].Message)
+		t.held[0] = nil
+		t.held = t.held[1:]
+		t.dropped++
+	}
+}
+
+// overLimits returns whether the logs held back exceed the limits.
+func (t *Throttle) overLimits() bool {
+	return (t.maxLines > 0 && len(t.held) > t.maxLines) || (t.maxBytes > 0 && t.bytes > t.maxBytes)
+}
+
+// CatchUp ends the scan and sends the logs held back. Watchers call it when they reach the
+// end of the log, it does nothing after the scan ended.
+func (t *Throttle) CatchUp(send func(*logtypes.Log)) {
+	if t.done {
+		return
+	}
+	t.done = true
+	if t.dropped > 0 {
+		glog.Infof("Lookback scan limited to %d logs, %d older logs skipped", len(t.held), t.dropped)
+	}
+	held := t.held
+	t.held, t.bytes = nil, 0
+	for _, log := range held {
+		if t.interval > 0 && !t.wait() {
+			return
+		}
+		send(log)
+	}
+}
+
+// wait waits for the replay interval, and returns false if the watcher is stopping.
+func (t *Throttle) wait() bool {
+	select {
+	case <-t.clock.After(t.interval):
+		return true
+	case <-t.stopping:
+		return false
+	}
+}
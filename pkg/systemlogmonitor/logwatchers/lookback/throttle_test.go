@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lookback
+
+import (
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+func TestThrottle(t *testing.T) {
+	start := time.Now()
+	log := func(message string, offset time.Duration) *logtypes.Log {
+		return &logtypes.Log{Timestamp: start.Add(offset), Message: message}
+	}
+	testCases := map[string]struct {
+		cfg      types.WatcherConfig
+		catchUp  bool
+		expected []string
+	}{
+		"no limits": {
+			expected: []string{"old 1", "old 2", "old 3", "new"},
+		},
+		"line limit, caught up by a new log": {
+			cfg:      types.WatcherConfig{MaxLookbackLines: 2},
+			expected: []string{"old 2", "old 3", "new"},
+		},
+		"byte limit, caught up at the end of the log": {
+			cfg:      types.WatcherConfig{MaxLookbackBytes: 6},
+			catchUp:  true,
+			expected: []string{"old 3", "new"},
+		},
+		"the most recent log is kept beyond the byte limit": {
+			cfg:      types.WatcherConfig{MaxLookbackBytes: 1},
+			expected: []string{"old 3", "new"},
+		},
+	}
+	for desc, test := range testCases {
+		t.Run(desc, func(t *testing.T) {
+			throttle := NewThrottle(test.cfg, start, fakeclock.NewFakeClock(start), nil)
+			var sent []string
+			send := func(log *logtypes.Log) { sent = append(sent, log.Message) }
+			for i, message := range []string{"old 1", "old 2", "old 3"} {
+				throttle.Add(log(message, time.Duration(i-3)*time.Second), send)
+			}
+			if test.catchUp {
+				throttle.CatchUp(send)
+			}
+			throttle.Add(log("new", time.Second), send)
+			assert.Equal(t, test.expected, sent)
+			assert.True(t, throttle.Done())
+		})
+	}
+}
+
+func TestThrottleReplayRate(t *testing.T) {
+	start := time.Now()
+	clock := fakeclock.NewFakeClock(start)
+	stopping := make(chan struct{})
+	throttle := NewThrottle(types.WatcherConfig{MaxLookbackLines: 10, LookbackReplayRate: 2}, start, clock, stopping)
+	sent := make(chan string, 10)
+	send := func(log *logtypes.Log) { sent <- log.Message }
+	for _, message := range []string{"1", "2"} {
+		throttle.Add(&logtypes.Log{Timestamp: start.Add(-time.Second), Message: message}, send)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		throttle.CatchUp(send)
+	}()
+	for _, expected := range []string{"1", "2"} {
+		// The logs are replayed every half a second.
+		clock.WaitForWatcherAndIncrement(500 * time.Millisecond)
+		assert.Equal(t, expected, <-sent)
+	}
+	<-done
+
+	// The replay stops when the watcher is stopping.
+	throttle = NewThrottle(types.WatcherConfig{MaxLookbackLines: 10, LookbackReplayRate: 2}, start, clock, stopping)
+	throttle.Add(&logtypes.Log{Timestamp: start.Add(-time.Second), Message: "3"}, send)
+	close(stopping)
+	throttle.CatchUp(send)
+	assert.Empty(t, sent)
+}
@@ -40,10 +40,22 @@ type WatcherConfig struct {
 	LogPath string `json:"logPath,omitempty"`
 	// Lookback is the time log watcher looks up
 	Lookback string `json:"lookback,omitempty"`
+	// MaxLookbackLines limits the lookback scan, i.e. the logs written before the watcher
+	// started, to the most recent lines. 0 means no limit.
+	MaxLookbackLines int `json:"maxLookbackLines,omitempty"`
+	// MaxLookbackBytes limits the lookback scan to the most recent logs whose messages fit
+	// in the bytes. 0 means no limit.
+	MaxLookbackBytes int `json:"maxLookbackBytes,omitempty"`
+	// LookbackReplayRate is the maximum number of logs of the lookback scan sent per
+	// second. 0 means no limit.
+	LookbackReplayRate float64 `json:"lookbackReplayRate,omitempty"`
 	// Delay is the time duration log watcher delays after node boot time. This is
 	// useful when the log watcher needs to wait for some time until the node
 	// becomes stable.
 	Delay string `json:"delay,omitempty"`
+	// MetricsReporting is whether the watcher reports its own metrics, set by the log
+	// monitor from its metricsReporting.
+	MetricsReporting bool `json:"-"`
 }
 
 // WatcherCreateFunc is the create function of a log watcher.
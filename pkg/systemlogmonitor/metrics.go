@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+// monitorMetrics are the metrics of the internals of the log monitors, which show
+// whether node-problem-detector falls behind the logs.
+type monitorMetrics struct {
+	linesProcessed metrics.Int64MetricInterface
+	ruleMatches    metrics.Int64MetricInterface
+	readLag        metrics.Int64MetricInterface
+}
+
+var (
+	internalMetrics     *monitorMetrics
+	internalMetricsOnce sync.Once
+)
+
+// internalMetricsOrDie returns the metrics shared by all log monitors, panic if error
+// occurs.
+func internalMetricsOrDie() *monitorMetrics {
+	internalMetricsOnce.Do(func() {
+		m := &monitorMetrics{}
+		var err error
+		m.linesProcessed, err = metrics.NewInt64Metric(
+			metrics.SystemLogLinesProcessedID,
+			string(metrics.SystemLogLinesProcessedID),
+			"Number of log lines processed by the log watcher of a system log monitor.",
+			"1",
+			metrics.Sum,
+			[]string{"source", "watcher"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.SystemLogLinesProcessedID, err)
+		}
+		m.ruleMatches, err = metrics.NewInt64Metric(
+			metrics.SystemLogRuleMatchesID,
+			string(metrics.SystemLogRuleMatchesID),
+			"Number of times a rule of a system log monitor matched the logs.",
+			"1",
+			metrics.Sum,
+			[]string{"source", "reason"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.SystemLogRuleMatchesID, err)
+		}
+		m.readLag, err = metrics.NewInt64Metric(
+			metrics.SystemLogReadLagID,
+			string(metrics.SystemLogReadLagID),
+			"Seconds between the timestamp of the last log line processed by a system log monitor and the time it was processed.",
+			"s",
+			metrics.LastValue,
+			[]string{"source", "watcher"})
+		if err != nil {
+			glog.Fatalf("Failed to create %s metric: %v", metrics.SystemLogReadLagID, err)
+		}
+		internalMetrics = m
+	})
+	return internalMetrics
+}
+
+// recordLine records a log line read by the watcher.
+func (l *logMonitor) recordLine(log *logtypes.Log, now time.Time) {
+	if l.metrics == nil {
+		return
+	}
+	tags := map[string]string{"source": l.config.Source, "watcher": l.config.WatcherConfig.Plugin}
+	if err := l.metrics.linesProcessed.Record(tags, 1); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.SystemLogLinesProcessedID, err)
+	}
+	lag := now.Sub(log.Timestamp)
+	if lag < 0 {
+		lag = 0
+	}
+	if err := l.metrics.readLag.Record(tags, int64(lag/time.Second)); err != nil {
+		glog.Errorf("Failed to update %s metric: %v", metrics.SystemLogReadLagID, err)
+	}
+}
+
+// recordMatches records the rules matched by a log line.
+func (l *logMonitor) recordMatches(matches []ruleMatch) {
+	if l.metrics == nil {
+		return
+	}
+	for _, match := range matches {
+		tags := map[string]string{"source": l.config.Source, "reason": match.rule.Reason}
+		if err := l.metrics.ruleMatches.Record(tags, 1); err != nil {
+			glog.Errorf("Failed to update %s metric: %v", metrics.SystemLogRuleMatchesID, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+func TestInternalMetrics(t *testing.T) {
+	now := time.Now()
+	linesProcessed := metrics.NewFakeInt64Metric("lines_processed", metrics.Sum, []string{"source", "watcher"})
+	ruleMatches := metrics.NewFakeInt64Metric("rule_matches", metrics.Sum, []string{"source", "reason"})
+	readLag := metrics.NewFakeInt64Metric("read_lag", metrics.LastValue, []string{"source", "watcher"})
+	l := &logMonitor{
+		config: MonitorConfig{
+			WatcherConfig: watchertypes.WatcherConfig{Plugin: "kmsg"},
+			Source:        testSource,
+			Rules: []logtypes.Rule{
+				{Type: types.Temp, Reason: "Hung", Pattern: "task .* blocked"},
+				{Type: types.Temp, Reason: "OOM", Pattern: "Out of memory"},
+			},
+		},
+		buffer: NewLogBuffer(1),
+		metrics: &monitorMetrics{
+			linesProcessed: linesProcessed,
+			ruleMatches:    ruleMatches,
+			readLag:        readLag,
+		},
+	}
+	(&l.config).ApplyDefaultConfiguration()
+
+	for i, message := range []string{"task a blocked", "task b blocked", "unrelated"} {
+		log := &logtypes.Log{Timestamp: now.Add(time.Duration(i-10) * time.Second), Message: message}
+		l.recordLine(log, now)
+		l.recordMatches(l.parseLog(log))
+	}
+
+	watcherTags := map[string]string{"source": testSource, "watcher": "kmsg"}
+	assert.Equal(t, []metrics.Int64MetricRepresentation{{Name: "lines_processed", Labels: watcherTags, Value: 3}},
+		linesProcessed.ListMetrics())
+	assert.Equal(t, []metrics.Int64MetricRepresentation{{Name: "read_lag", Labels: watcherTags, Value: 8}},
+		readLag.ListMetrics())
+	assert.Equal(t, []metrics.Int64MetricRepresentation{
+		{Name: "rule_matches", Labels: map[string]string{"source": testSource, "reason": "Hung"}, Value: 2},
+	}, ruleMatches.ListMetrics())
+}
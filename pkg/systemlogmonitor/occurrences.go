@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"strconv"
+	"time"
+
+	systemlogtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+// occurrenceCounter counts the recent occurrences of problems in sliding windows.
+type occurrenceCounter struct {
+	// occurrences are the timestamps of the occurrences in the window, oldest first, by
+	// problem.
+	occurrences map[string][]time.Time
+}
+
+func newOccurrenceCounter() *occurrenceCounter {
+	return &occurrenceCounter{occurrences: make(map[string][]time.Time)}
+}
+
+// add records an occurrence of the problem, and returns the number of its occurrences in
+// the window ending at the occurrence.
+func (c *occurrenceCounter) add(problem string, timestamp time.Time, window time.Duration) int {
+	c.occurrences[problem] = append(c.occurrences[problem], timestamp)
+	return c.count(problem, timestamp, window)
+}
+
+// count returns the number of occurrences of the problem in the window ending now, and
+// forgets the older occurrences.
+func (c *occurrenceCounter) count(problem string, now time.Time, window time.Duration) int {
+	occurrences := c.occurrences[problem]
+	start := 0
+	for start < len(occurrences) && !occurrences[start].After(now.Add(-window)) {
+		start++
+	}
+	occurrences = occurrences[start:]
+	if len(occurrences) == 0 {
+		delete(c.occurrences, problem)
+		return 0
+	}
+	c.occurrences[problem] = occurrences
+	return len(occurrences)
+}
+
+// countOccurrence records a match of the i-th rule about the instance, and returns the
+// number of its matches within the occurrence window of the rule.
+func (l *logMonitor) countOccurrence(i int, rule systemlogtypes.Rule, instance string, timestamp time.Time) int {
+	if l.occurrences == nil {
+		l.occurrences = newOccurrenceCounter()
+	}
+	// The occurrence window should be checked outside.
+	window, _ := time.ParseDuration(rule.OccurrenceWindow)
+	return l.occurrences.add(occurrenceKey(i, instance), timestamp, window)
+}
+
+// reachesOccurrences records a match of the i-th rule about the instance, and returns
+// whether the rule matched often enough within its occurrence window to change the
+// condition. Rules without an occurrence threshold change it on every match.
+func (l *logMonitor) reachesOccurrences(i int, rule systemlogtypes.Rule, instance string, timestamp time.Time) bool {
+	if rule.Occurrences <= 1 {
+		return true
+	}
+	return l.countOccurrence(i, rule, instance, timestamp) >= rule.Occurrences
+}
+
+func occurrenceKey(i int, instance string) string {
+	return strconv.Itoa(i) + "/" + instance
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestOccurrences(t *testing.T) {
+	lockup := logtypes.Rule{
+		Type:             types.Perm,
+		Condition:        testConditionA,
+		Reason:           "FrequentSoftLockup",
+		Instance:         "{{ .cpu }}",
+		Pattern:          `BUG: soft lockup - CPU#(?P<cpu>\d+) stuck`,
+		Occurrences:      3,
+		OccurrenceWindow: "10m",
+	}
+	l := &logMonitor{
+		config:     MonitorConfig{Source: testSource, Rules: []logtypes.Rule{lockup}},
+		conditions: []types.Condition{{Type: testConditionA, Status: types.False}},
+	}
+	disabled := false
+	l.config.EnableMetricsReporting = &disabled
+	(&l.config).ApplyDefaultConfiguration()
+	l.buffer = NewLogBuffer(l.config.BufferSize)
+
+	start := time.Unix(1000, 0)
+	match := func(cpu string, offset time.Duration) []ruleMatch {
+		return l.parseLog(&logtypes.Log{Timestamp: start.Add(offset), Message: "BUG: soft lockup - CPU#" + cpu + " stuck"})
+	}
+
+	// The condition is only set by the third occurrence within the window.
+	assert.Empty(t, match("0", 0))
+	assert.Empty(t, match("0", 5*time.Minute))
+	// The occurrences are counted per instance.
+	assert.Empty(t, match("1", 6*time.Minute))
+	// The first occurrence is out of the window.
+	assert.Empty(t, match("0", 10*time.Minute))
+	matches := match("0", 11*time.Minute)
+	if assert.Len(t, matches, 1) && assert.Len(t, matches[0].status.Events, 1) {
+		assert.Equal(t, "Node condition "+testConditionA+"[0] is now: True, reason: FrequentSoftLockup",
+			matches[0].status.Events[0].Message)
+	}
+	assert.Equal(t, types.True, l.conditions[1].Status)
+	assert.Equal(t, "BUG: soft lockup - CPU#0 stuck (3 occurrences within 10m)", l.conditions[1].Message)
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// The capture group and the event annotations attributing a problem to a pod.
+const (
+	// cgroupGroup is the capture group of the cgroup a problem occurred in, e.g. the
+	// task_memcg of the OOM killer.
+	cgroupGroup            = "cgroup"
+	podUIDAnnotation       = "pod_uid"
+	podNameAnnotation      = "pod_name"
+	podNamespaceAnnotation = "pod_namespace"
+	containerIDAnnotation  = "container_id"
+)
+
+const (
+	// kubeletPodsPath is the path of the pod list of the kubelet.
+	kubeletPodsPath = "/pods"
+	// podsRequestTimeout is the timeout of the requests to the kubelet.
+	podsRequestTimeout = 5 * time.Second
+	// podsRefreshInterval is the minimum interval between two requests to the kubelet, so
+	// that a burst of problems in unknown cgroups does not flood the kubelet.
+	podsRefreshInterval = 10 * time.Second
+)
+
+var (
+	// podCgroupRegexp matches the pod UID in the cgroupfs, e.g. "pod<uid>", and systemd,
+	// e.g. "kubepods-burstable-pod<uid>.slice", cgroup drivers. The systemd driver
+	// replaces the dashes of the UID with underscores.
+	podCgroupRegexp = regexp.MustCompile(`^(?:kubepods(?:-[a-z]+)*-)?pod([0-9a-f_-]{36})(?:\.slice)?$`)
+	// containerCgroupRegexp matches the container ID of the cgroupfs, e.g. "<id>", and
+	// systemd, e.g. "cri-containerd-<id>.scope", cgroup drivers.
+	containerCgroupRegexp = regexp.MustCompile(`^(?:[a-z-]+-)?([0-9a-f]{64})(?:\.scope)?$`)
+)
+
+// parsePodCgroup returns the UID of the pod and the ID of the container of a cgroup path.
+// Both are empty if the cgroup does not belong to a pod.
+func parsePodCgroup(cgroup string) (podUID, containerID string) {
+	for _, dir := range strings.Split(cgroup, "/") {
+		if m := podCgroupRegexp.FindStringSubmatch(dir); m != nil {
+			podUID = strings.Replace(m[1], "_", "-", -1)
+			continue
+		}
+		if m := containerCgroupRegexp.FindStringSubmatch(dir); m != nil && podUID != "" {
+			containerID = m[1]
+		}
+	}
+	return podUID, containerID
+}
+
+// podRef is the name and namespace of a pod.
+type podRef struct {
+	name      string
+	namespace string
+}
+
+// podResolver resolves the UIDs of the pods to their names and namespaces with the pod
+// list of the kubelet.
+type podResolver struct {
+	client   *http.Client
+	endpoint string
+	pods     map[string]podRef
+	// refreshed is the last time the pod list was requested.
+	refreshed time.Time
+	now       func() time.Time
+}
+
+func newPodResolver(endpoint string) *podResolver {
+	return &podResolver{
+		client:   &http.Client{Timeout: podsRequestTimeout},
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		pods:     map[string]podRef{},
+		now:      time.Now,
+	}
+}
+
+// resolve returns the pod of the UID. The pod list is refreshed when the UID is unknown,
+// at most once per refresh interval.
+func (r *podResolver) resolve(uid string) (podRef, bool) {
+	if pod, ok := r.pods[uid]; ok {
+		return pod, true
+	}
+	now := r.now()
+	if now.Sub(r.refreshed) < podsRefreshInterval {
+		return podRef{}, false
+	}
+	r.refreshed = now
+	pods, err := r.listPods()
+	if err != nil {
+		glog.Errorf("Failed to list the pods of the kubelet: %v", err)
+		return podRef{}, false
+	}
+	// The pods deleted since the last refresh are kept, the problems of a deleted pod
+	// may still be in the logs.
+	for uid, pod := range pods {
+		r.pods[uid] = pod
+	}
+	pod, ok := r.pods[uid]
+	return pod, ok
+}
+
+func (r *podResolver) listPods() (map[string]podRef, error) {
+	resp, err := r.client.Get(r.endpoint + kubeletPodsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+				UID       string `json:"uid"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode the pod list: %v", err)
+	}
+	pods := map[string]podRef{}
+	for _, item := range list.Items {
+		pods[item.Metadata.UID] = podRef{name: item.Metadata.Name, namespace: item.Metadata.Namespace}
+	}
+	return pods, nil
+}
+
+// attributePod adds the pod and container of the cgroup capture group to the capture
+// groups, and the name and namespace of the pod when the resolver is set. The capture
+// groups are not modified.
+func attributePod(groups map[string]string, resolver *podResolver) map[string]string {
+	podUID, containerID := parsePodCgroup(groups[cgroupGroup])
+	if podUID == "" {
+		return groups
+	}
+	result := make(map[string]string, len(groups)+4)
+	for k, v := range groups {
+		result[k] = v
+	}
+	result[podUIDAnnotation] = podUID
+	if containerID != "" {
+		result[containerIDAnnotation] = containerID
+	}
+	if resolver == nil {
+		return result
+	}
+	if pod, ok := resolver.resolve(podUID); ok {
+		result[podNameAnnotation] = pod.name
+		result[podNamespaceAnnotation] = pod.namespace
+	}
+	return result
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	testPodUID      = "0c5a4e7e-3d4b-4a0e-9d6f-1b2c3d4e5f60"
+	testContainerID = "8b5f0d1c2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5"
+)
+
+func TestParsePodCgroup(t *testing.T) {
+	for _, test := range []struct {
+		cgroup      string
+		podUID      string
+		containerID string
+	}{
+		{
+			cgroup:      "/kubepods/burstable/pod" + testPodUID + "/" + testContainerID,
+			podUID:      testPodUID,
+			containerID: testContainerID,
+		},
+		{
+			cgroup:      "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0c5a4e7e_3d4b_4a0e_9d6f_1b2c3d4e5f60.slice/cri-containerd-" + testContainerID + ".scope",
+			podUID:      testPodUID,
+			containerID: testContainerID,
+		},
+		{
+			cgroup: "/kubepods.slice/kubepods-pod0c5a4e7e_3d4b_4a0e_9d6f_1b2c3d4e5f60.slice",
+			podUID: testPodUID,
+		},
+		{cgroup: "/system.slice/docker-" + testContainerID + ".scope"},
+		{cgroup: "/"},
+		{cgroup: ""},
+	} {
+		podUID, containerID := parsePodCgroup(test.cgroup)
+		assert.Equal(t, test.podUID, podUID, test.cgroup)
+		assert.Equal(t, test.containerID, containerID, test.cgroup)
+	}
+}
+
+func TestPodResolver(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, kubeletPodsPath, r.URL.Path)
+		fmt.Fprintf(w, `{"kind":"PodList","items":[{"metadata":{"name":"stress","namespace":"default","uid":%q}}]}`, testPodUID)
+	}))
+	defer server.Close()
+
+	now := time.Unix(1000, 0)
+	r := newPodResolver(server.URL + "/")
+	r.now = func() time.Time { return now }
+
+	pod, ok := r.resolve(testPodUID)
+	assert.True(t, ok)
+	assert.Equal(t, podRef{name: "stress", namespace: "default"}, pod)
+	_, ok = r.resolve(testPodUID)
+	assert.True(t, ok)
+	assert.Equal(t, 1, requests, "known pods are cached")
+
+	_, ok = r.resolve("unknown")
+	assert.False(t, ok)
+	assert.Equal(t, 1, requests, "the pod list is refreshed at most once per refresh interval")
+
+	now = now.Add(podsRefreshInterval)
+	_, ok = r.resolve("unknown")
+	assert.False(t, ok)
+	_, ok = r.resolve("unknown")
+	assert.False(t, ok)
+	assert.Equal(t, 2, requests)
+}
+
+func TestGenerateStatusWithPodAttribution(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"items":[{"metadata":{"name":"stress","namespace":"default","uid":%q}}]}`, testPodUID)
+	}))
+	defer server.Close()
+
+	l := &logMonitor{config: MonitorConfig{Source: testSource}}
+	(&l.config).ApplyDefaultConfiguration()
+	logs := []*logtypes.Log{{Timestamp: time.Unix(1000, 1000), Message: "oom-kill:constraint=CONSTRAINT_MEMCG"}}
+	rule := logtypes.Rule{Type: types.Temp, Reason: "OOMKilling"}
+	groups := map[string]string{
+		"process": "stress",
+		"cgroup":  "/kubepods/burstable/pod" + testPodUID + "/" + testContainerID,
+	}
+
+	status := l.generateStatus(logs, rule, groups)
+	assert.Equal(t, map[string]string{
+		"process":      "stress",
+		"cgroup":       groups["cgroup"],
+		"pod_uid":      testPodUID,
+		"container_id": testContainerID,
+	}, status.Events[0].Annotations)
+
+	l.pods = newPodResolver(server.URL)
+	status = l.generateStatus(logs, rule, groups)
+	assert.Equal(t, map[string]string{
+		"process":       "stress",
+		"cgroup":        groups["cgroup"],
+		"pod_uid":       testPodUID,
+		"container_id":  testContainerID,
+		"pod_name":      "stress",
+		"pod_namespace": "default",
+	}, status.Events[0].Annotations)
+	// The capture groups are not modified.
+	assert.Len(t, groups, 2)
+
+	// The problems out of the cgroups of pods are not attributed.
+	groups = map[string]string{"cgroup": "/system.slice/kubelet.service"}
+	status = l.generateStatus(logs, rule, groups)
+	assert.Equal(t, groups, status.Events[0].Annotations)
+}
+
+func TestValidateKubeletEndpoint(t *testing.T) {
+	config := MonitorConfig{KubeletEndpoint: "http://127.0.0.1:10255"}
+	assert.NoError(t, config.ValidateRules())
+	config.KubeletEndpoint = "127.0.0.1:10255"
+	assert.Error(t, config.ValidateRules())
+}
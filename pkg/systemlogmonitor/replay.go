@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/filelog"
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	systemlogtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// ReplayMatch is a rule matched while replaying logs.
+type ReplayMatch struct {
+	// Index is the index of the log completing the match.
+	Index int
+	// Rule is the matched rule.
+	Rule systemlogtypes.Rule
+	// Logs are the logs matching the rule.
+	Logs []*logtypes.Log
+	// Status is the status generated by the match. Its conditions are a snapshot at the
+	// time of the match.
+	Status *types.Status
+}
+
+// Replay replays the logs through the rules of the log monitor configuration, and returns
+// the matched rules and the final conditions. The default conditions are transitioned at
+// the timestamp of the first log. Problem metrics are not reported.
+func Replay(config MonitorConfig, logs []*logtypes.Log) ([]ReplayMatch, []types.Condition) {
+	disabled := false
+	config.EnableMetricsReporting = &disabled
+	l := &logMonitor{
+		config: config,
+		buffer: NewLogBuffer(config.BufferSize),
+	}
+	l.conditions = initialConditions(config.DefaultConditions)
+	if len(logs) > 0 {
+		for i := range l.conditions {
+			l.conditions[i].Transition = logs[0].Timestamp
+		}
+	}
+
+	var matches []ReplayMatch
+	for i, log := range logs {
+		// The frequency conditions are cleared as time goes by in the logs.
+		l.checkFrequencies(log.Timestamp)
+		for _, match := range l.parseLog(log) {
+			match.status.Conditions = append([]types.Condition(nil), match.status.Conditions...)
+			matches = append(matches, ReplayMatch{Index: i, Rule: match.rule, Logs: match.logs, Status: match.status})
+		}
+	}
+	return matches, l.conditions
+}
+
+// dmesgPrefix is the timestamp prefix of the kernel logs printed by dmesg.
+var dmesgPrefix = regexp.MustCompile(`^\[\s*\d+\.\d+\]\s?`)
+
+// ReadLogs reads sample logs in the format of the log watcher: filelog logs are translated
+// with the plugin configuration, journald logs are read in the journal export format
+// (journalctl -o export), and kmsg logs are read one message per line, optionally with the
+// dmesg timestamp prefix. Logs without timestamp are stamped with the start time, a
+// microsecond apart. Lines which can not be translated are returned as errors without
+// stopping the reading.
+func ReadLogs(config watchertypes.WatcherConfig, r io.Reader, start time.Time) ([]*logtypes.Log, []error) {
+	if config.Plugin == "journald" {
+		logs, err := readJournalExport(r)
+		if err != nil {
+			return logs, []error{err}
+		}
+		return logs, nil
+	}
+
+	var translator *filelog.Translator
+	if config.Plugin == "filelog" {
+		translator = filelog.NewTranslatorOrDie(config.PluginConfig)
+	}
+	var logs []*logtypes.Log
+	var errs []error
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if translator == nil {
+			message := dmesgPrefix.ReplaceAllString(line, "")
+			timestamp := start.Add(time.Duration(len(logs)) * time.Microsecond)
+			logs = append(logs, &logtypes.Log{Timestamp: timestamp, Message: message})
+			continue
+		}
+		log, err := translator.Translate(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %v", lineNumber, err))
+			continue
+		}
+		if log != nil {
+			logs = append(logs, log)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if translator != nil {
+		if log := translator.Flush(); log != nil {
+			logs = append(logs, log)
+		}
+	}
+	return logs, errs
+}
+
+// readJournalExport reads the entries in the journal export format, see
+// https://systemd.io/JOURNAL_EXPORT_FORMATS/. Entries without message are skipped.
+func readJournalExport(r io.Reader) ([]*logtypes.Log, error) {
+	var logs []*logtypes.Log
+	reader := bufio.NewReader(r)
+	fields := map[string]string{}
+	flush := func() error {
+		defer func() { fields = map[string]string{} }()
+		message, ok := fields["MESSAGE"]
+		if !ok {
+			return nil
+		}
+		usec, err := strconv.ParseInt(fields["__REALTIME_TIMESTAMP"], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid __REALTIME_TIMESTAMP of journal entry %q: %v", message, err)
+		}
+		logs = append(logs, &logtypes.Log{
+			Timestamp: time.Unix(0, usec*int64(time.Microsecond)),
+			Message:   strings.TrimSpace(message),
+		})
+		return nil
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return logs, flush()
+		}
+		if err != nil && err != io.EOF {
+			return logs, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if err := flush(); err != nil {
+				return logs, err
+			}
+			continue
+		}
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			fields[line[:i]] = line[i+1:]
+			continue
+		}
+		// A binary field: the name is followed by the 64-bit little endian size of the
+		// value, the value and a newline.
+		var size uint64
+		if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+			return logs, fmt.Errorf("failed to read size of binary field %q: %v", line, err)
+		}
+		value := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return logs, fmt.Errorf("failed to read binary field %q: %v", line, err)
+		}
+		fields[line] = string(bytes.TrimSuffix(value, []byte("\n")))
+	}
+}
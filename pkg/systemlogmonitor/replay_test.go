@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := MonitorConfig{
+		BufferSize: 10,
+		Source:     testSource,
+		DefaultConditions: []types.Condition{
+			{Type: testConditionA, Reason: "NoProblemA", Message: "no problem A"},
+		},
+		Rules: []logtypes.Rule{
+			{Type: types.Temp, Reason: "TempProblem", Pattern: "temp problem.*"},
+			{Type: types.Perm, Condition: testConditionA, Reason: "PermProblem", Pattern: "perm problem.*"},
+		},
+	}
+	logs := []*logtypes.Log{
+		{Timestamp: start, Message: "nothing"},
+		{Timestamp: start.Add(time.Second), Message: "temp problem 1"},
+		{Timestamp: start.Add(2 * time.Second), Message: "perm problem 1"},
+		{Timestamp: start.Add(3 * time.Second), Message: "perm problem 2"},
+	}
+
+	matches, conditions := Replay(config, logs)
+	assert.Len(t, matches, 3)
+	assert.Equal(t, 1, matches[0].Index)
+	assert.Equal(t, "TempProblem", matches[0].Rule.Reason)
+	assert.Equal(t, []types.Event{{Severity: types.Warn, Timestamp: start.Add(time.Second), Reason: "TempProblem", Message: "temp problem 1"}},
+		matches[0].Status.Events)
+	assert.Equal(t, types.False, matches[0].Status.Conditions[0].Status, "the conditions should be a snapshot")
+	assert.Equal(t, 2, matches[1].Index)
+	assert.Equal(t, types.True, matches[1].Status.Conditions[0].Status)
+	assert.Len(t, matches[1].Status.Events, 1, "the condition change should generate an event")
+	assert.Equal(t, 3, matches[2].Index)
+	assert.Empty(t, matches[2].Status.Events, "the unchanged condition should not generate an event")
+
+	assert.Equal(t, []types.Condition{{
+		Type:       testConditionA,
+		Status:     types.True,
+		Transition: start.Add(2 * time.Second),
+		Reason:     "PermProblem",
+		Message:    "perm problem 1",
+	}}, conditions)
+}
+
+func TestReadLogs(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("kmsg", func(t *testing.T) {
+		logs, errs := ReadLogs(watchertypes.WatcherConfig{Plugin: "kmsg"},
+			strings.NewReader("[  100.123456] first\nsecond\n"), start)
+		assert.Empty(t, errs)
+		assert.Equal(t, []*logtypes.Log{
+			{Timestamp: start, Message: "first"},
+			{Timestamp: start.Add(time.Microsecond), Message: "second"},
+		}, logs)
+	})
+
+	t.Run("filelog", func(t *testing.T) {
+		config := watchertypes.WatcherConfig{
+			Plugin: "filelog",
+			PluginConfig: map[string]string{
+				"timestamp":       "^.{15}",
+				"message":         "kernel: \\[.*\\] (.*)",
+				"timestampFormat": "Jan _2 15:04:05",
+			},
+		}
+		logs, errs := ReadLogs(config, strings.NewReader(
+			"Jan  2 03:04:05 node kernel: [1.0] first\nnot a log line\n"), start)
+		assert.Len(t, errs, 1)
+		assert.Contains(t, errs[0].Error(), "line 2")
+		assert.Len(t, logs, 1)
+		assert.Equal(t, "first", logs[0].Message)
+	})
+
+	t.Run("journald", func(t *testing.T) {
+		var export bytes.Buffer
+		export.WriteString("__REALTIME_TIMESTAMP=1577836800000000\nMESSAGE=first\n_PID=1\n\n")
+		export.WriteString("__REALTIME_TIMESTAMP=1577836801000000\nMESSAGE\n")
+		binary.Write(&export, binary.LittleEndian, uint64(len("second\nline")))
+		export.WriteString("second\nline\n\n")
+		export.WriteString("__REALTIME_TIMESTAMP=1577836802000000\n_PID=1\n\n")
+		export.WriteString("__REALTIME_TIMESTAMP=1577836803000000\nMESSAGE=last\n")
+
+		logs, errs := ReadLogs(watchertypes.WatcherConfig{Plugin: "journald"}, &export, start)
+		assert.Empty(t, errs)
+		assert.Len(t, logs, 3)
+		assert.Equal(t, []string{"first", "second\nline", "last"},
+			[]string{logs[0].Message, logs[1].Message, logs[2].Message})
+		assert.True(t, logs[1].Timestamp.Equal(start.Add(time.Second)))
+	})
+}
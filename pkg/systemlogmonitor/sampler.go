@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const (
+	// flushPeriod is the period at which the ended sample windows are reported, and the
+	// conditions of the frequency rules are checked.
+	flushPeriod = time.Second
+
+	// OccurrencesAnnotation is the event annotation carrying the number of occurrences
+	// of a sampled problem in its sample window.
+	OccurrencesAnnotation = "occurrences"
+	// FirstOccurrenceAnnotation is the event annotation carrying the timestamp of the
+	// first occurrence of a sampled problem in its sample window.
+	FirstOccurrenceAnnotation = "firstOccurrence"
+)
+
+// sampleWindow is the window opened by the first occurrence of a sampled problem.
+type sampleWindow struct {
+	end time.Time
+	// first is the timestamp of the first occurrence, which was reported.
+	first time.Time
+	// suppressed is the number of occurrences after the first one.
+	suppressed int
+	// last is the most recent suppressed occurrence.
+	last types.Event
+}
+
+// sampler bounds the events of problems matching at high frequency. The first occurrence
+// of a problem is reported right away and opens a sample window, in which the further
+// occurrences are only counted. When the window ends, the most recent occurrence is
+// reported with the total count of the window.
+type sampler struct {
+	// windows are keyed by event reason.
+	windows map[string]*sampleWindow
+}
+
+func newSampler() *sampler {
+	return &sampler{windows: make(map[string]*sampleWindow)}
+}
+
+// admit returns whether an occurrence of a problem should be reported now, and counts it
+// otherwise.
+func (s *sampler) admit(event types.Event, window time.Duration, now time.Time) bool {
+	w, ok := s.windows[event.Reason]
+	if !ok {
+		s.windows[event.Reason] = &sampleWindow{end: now.Add(window), first: event.Timestamp}
+		return true
+	}
+	w.suppressed++
+	w.last = event
+	return false
+}
+
+// flush ends the sample windows which are over, and returns the most recent occurrences
+// suppressed in them, oldest first.
+func (s *sampler) flush(now time.Time) []types.Event {
+	var events []types.Event
+	for reason, w := range s.windows {
+		if now.Before(w.end) {
+			continue
+		}
+		delete(s.windows, reason)
+		if w.suppressed == 0 {
+			continue
+		}
+		occurrences := w.suppressed + 1
+		event := w.last
+		event.Message = fmt.Sprintf("%s (%d occurrences since %s)", event.Message, occurrences, w.first.Format(time.RFC3339))
+		event.Annotations = make(map[string]string, len(w.last.Annotations)+2)
+		for k, v := range w.last.Annotations {
+			event.Annotations[k] = v
+		}
+		event.Annotations[OccurrencesAnnotation] = strconv.Itoa(occurrences)
+		event.Annotations[FirstOccurrenceAnnotation] = w.first.Format(time.RFC3339Nano)
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	return events
+}
+
+// admit returns whether the status generated by a match should be reported. Only the
+// matches of sampled rules may be suppressed. All occurrences are counted by the problem
+// metrics regardless.
+func (l *logMonitor) admit(match ruleMatch, now time.Time) bool {
+	if l.sampler == nil || match.rule.SampleWindow == "" || len(match.status.Events) == 0 {
+		return true
+	}
+	// The sample window should be checked outside.
+	window, _ := time.ParseDuration(match.rule.SampleWindow)
+	return l.sampler.admit(match.status.Events[0], window, now)
+}
+
+// flushSamples reports the most recent occurrences of the sample windows which are over.
+func (l *logMonitor) flushSamples(now time.Time) {
+	if l.sampler == nil {
+		return
+	}
+	events := l.sampler.flush(now)
+	if len(events) == 0 {
+		return
+	}
+	status := &types.Status{
+		Source:     l.config.Source,
+		Events:     events,
+		Conditions: l.conditions,
+	}
+	glog.Infof("New status generated: %+v", status)
+	l.output <- status
+}
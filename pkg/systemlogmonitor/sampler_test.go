@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestSampling(t *testing.T) {
+	sampled := logtypes.Rule{Type: types.Temp, Reason: "IOError", Pattern: "I/O error on (?P<device>sd[a-z]+)", SampleWindow: "1m"}
+	other := logtypes.Rule{Type: types.Temp, Reason: "TaskHung", Pattern: "task .* blocked"}
+	l := &logMonitor{
+		config:  MonitorConfig{Source: testSource, Rules: []logtypes.Rule{sampled, other}},
+		sampler: newSampler(),
+		output:  make(chan *types.Status, 100),
+	}
+	disabled := false
+	l.config.EnableMetricsReporting = &disabled
+	(&l.config).ApplyDefaultConfiguration()
+	l.buffer = NewLogBuffer(l.config.BufferSize)
+
+	start := time.Unix(1000, 0)
+	report := func(message string, offset time.Duration) []types.Event {
+		now := start.Add(offset)
+		l.flushSamples(now)
+		for _, match := range l.parseLog(&logtypes.Log{Timestamp: now, Message: message}) {
+			if l.admit(match, now) {
+				l.output <- match.status
+			}
+		}
+		var events []types.Event
+		for len(l.output) > 0 {
+			events = append(events, (<-l.output).Events...)
+		}
+		return events
+	}
+
+	// The first occurrence is reported right away.
+	events := report("I/O error on sda", 0)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "I/O error on sda", events[0].Message)
+	}
+	// The further occurrences in the window are only counted, the other rules are not
+	// sampled.
+	assert.Empty(t, report("I/O error on sdb", 10*time.Second))
+	assert.Empty(t, report("I/O error on sdc", 20*time.Second))
+	assert.Len(t, report("task kworker blocked", 30*time.Second), 1)
+	assert.Len(t, report("task kworker blocked", 31*time.Second), 1)
+
+	// The most recent occurrence is reported with the count when the window ends.
+	l.flushSamples(start.Add(59 * time.Second))
+	assert.Empty(t, l.output)
+	l.flushSamples(start.Add(time.Minute))
+	if assert.Len(t, l.output, 1) {
+		assert.Equal(t, []types.Event{{
+			Severity:  types.Warn,
+			Timestamp: start.Add(20 * time.Second),
+			Reason:    "IOError",
+			Message:   "I/O error on sdc (3 occurrences since " + start.Format(time.RFC3339) + ")",
+			Annotations: map[string]string{
+				"device":                  "sdc",
+				OccurrencesAnnotation:     "3",
+				FirstOccurrenceAnnotation: start.Format(time.RFC3339Nano),
+			},
+		}}, (<-l.output).Events)
+	}
+
+	// The next occurrence opens a new window, a window without further occurrences ends
+	// without report.
+	assert.Len(t, report("I/O error on sda", 2*time.Minute), 1)
+	l.flushSamples(start.Add(3 * time.Minute))
+	assert.Empty(t, l.output)
+	assert.Len(t, report("I/O error on sda", 3*time.Minute), 1)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package types
 
 import (
+	"regexp"
 	"time"
 
 	"k8s.io/node-problem-detector/pkg/types"
@@ -27,19 +28,77 @@ import (
 type Log struct {
 	Timestamp time.Time
 	Message   string
+	// Fields are the structured fields of the log, e.g. the fields of a JSON log line
+	// other than the timestamp and the message. Nested fields are flattened with '.'.
+	Fields map[string]string
+	// Event is an event the watcher reports itself, e.g. when the kmsg ring buffer was
+	// overrun. The log monitor reports it instead of matching the log against the rules.
+	Event *types.Event
 }
 
+// Frequency is the type of the rules counting the occurrences of a problem in a sliding
+// window, which set a condition while the problem occurs often, and clear it once the
+// problem occurs rarely again.
+const Frequency types.Type = "frequency"
+
 // Rule describes how log monitor should analyze the log.
 type Rule struct {
-	// Type is the type of matched problem.
+	// Type is the type of matched problem: "temporary", "permanent" or "frequency".
 	Type types.Type `json:"type"`
 	// Condition is the type of the condition the problem triggered. Notice that
 	// the Condition field should be set only when the problem is permanent, or
 	// else the field will be ignored.
 	Condition string `json:"condition"`
-	// Reason is the short reason of the problem.
+	// Status is the status a permanent problem sets the condition to. Default to True,
+	// False heals the condition.
+	Status types.ConditionStatus `json:"status,omitempty"`
+	// Instance is a template of the instance the permanent problem is about, referencing
+	// the named capture groups of the pattern, e.g. "{{ .device }}". The problem then
+	// sets the condition "<Condition>[<instance>]", so that the problems of different
+	// instances are set and healed independently. A heal without instance heals the
+	// condition and all its instances.
+	Instance string `json:"instance,omitempty"`
+	// Reason is the short reason of the problem. It may reference the named capture
+	// groups of the pattern, e.g. "{{ .device }}", as a text/template.
 	Reason string `json:"reason"`
+	// Message is the message of the problem as a text/template referencing the named
+	// capture groups of the pattern. Default to the matched logs.
+	Message string `json:"message,omitempty"`
 	// Pattern is the regular expression to match the problem in log.
-	// Notice that the pattern must match to the end of the line.
+	// Notice that the pattern must match to the end of the line. The named capture
+	// groups, e.g. "(?P<device>sd[a-z]+)", are attached to the events as annotations.
 	Pattern string `json:"pattern"`
+	// Fields maps structured log field names to regular expressions. When set, the rule
+	// only applies to logs whose fields all match the corresponding regular expression.
+	Fields map[string]string `json:"fields,omitempty"`
+	// FieldRegexps are the compiled regular expressions of Fields, set by the validation of
+	// the rules.
+	FieldRegexps map[string]*regexp.Regexp `json:"-"`
+	// Architectures are the CPU architectures the rule applies to, as in GOARCH, e.g.
+	// "arm64" or "riscv64", so that one config carries the rules of a mixed fleet.
+	// Default to all architectures.
+	Architectures []string `json:"architectures,omitempty"`
+	// SampleWindow is the window, e.g. "1m", in which a temporary problem is only reported
+	// once after its first occurrence. The further occurrences are counted, and the most
+	// recent one is reported with the total count when the window ends. Default to report
+	// every occurrence.
+	SampleWindow string `json:"sampleWindow,omitempty"`
+	// Occurrences is the number of matches within the occurrence window it takes a
+	// permanent or frequency problem to set its condition, e.g. 3 soft lockups within 10
+	// minutes. The matches are counted per instance. Default to set the condition on every
+	// match of a permanent problem.
+	Occurrences int `json:"occurrences,omitempty"`
+	// OccurrenceWindow is the sliding window, e.g. "10m", the occurrences are counted in.
+	OccurrenceWindow string `json:"occurrenceWindow,omitempty"`
+	// ClearOccurrences is the number of matches within the occurrence window at or below
+	// which a frequency problem clears its condition again. Default to one less than
+	// Occurrences.
+	ClearOccurrences *int `json:"clearOccurrences,omitempty"`
+	// Severity is the severity of the problem: "info", "warning" or "critical". It is the
+	// severity of the events of a temporary problem, default to "warning", and of the
+	// condition set by a permanent problem. It labels the problem metrics when set.
+	Severity types.Severity `json:"severity,omitempty"`
+	// Ownership is the team, escalation and labels of the rule, attached to its events
+	// as annotations and to its problem metrics as labels.
+	types.Ownership
 }
@@ -19,7 +19,6 @@ package systemstatsmonitor
 import (
 	"github.com/golang/glog"
 	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/load"
 
 	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
 	"k8s.io/node-problem-detector/pkg/util/metrics"
@@ -81,13 +80,13 @@ func (cc *cpuCollector) recordLoad() {
 		return
 	}
 
-	loadAvg, err := load.Avg()
+	runnable, err := runnableTaskCount()
 	if err != nil {
 		glog.Errorf("Failed to retrieve average CPU load: %v", err)
 		return
 	}
 
-	cc.mRunnableTaskCount.Record(map[string]string{}, loadAvg.Load1)
+	cc.mRunnableTaskCount.Record(map[string]string{}, runnable)
 }
 
 func (cc *cpuCollector) recordUsage() {
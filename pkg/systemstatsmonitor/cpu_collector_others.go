@@ -0,0 +1,33 @@
+// +build !windows
+
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"github.com/shirou/gopsutil/load"
+)
+
+// runnableTaskCount returns the average number of runnable tasks in the run-queue during the
+// last minute.
+func runnableTaskCount() (float64, error) {
+	loadAvg, err := load.Avg()
+	if err != nil {
+		return 0, err
+	}
+	return loadAvg.Load1, nil
+}
@@ -0,0 +1,39 @@
+// +build windows
+
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"fmt"
+
+	"github.com/shirou/gopsutil/cpu"
+)
+
+// runnableTaskCount returns the number of threads waiting in the processor queue, from the
+// System\Processor Queue Length performance counter. Windows has no load average, so the
+// count is sampled at collection time.
+func runnableTaskCount() (float64, error) {
+	systems, err := cpu.ProcInfo()
+	if err != nil {
+		return 0, err
+	}
+	if len(systems) == 0 {
+		return 0, fmt.Errorf("no processor queue length reported")
+	}
+	return float64(systems[0].ProcessorQueueLength), nil
+}
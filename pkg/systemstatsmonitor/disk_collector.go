@@ -17,8 +17,6 @@ limitations under the License.
 package systemstatsmonitor
 
 import (
-	"context"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -248,8 +246,8 @@ func (dc *diskCollector) collect() {
 		devices = append(devices, listAttachedBlockDevices()...)
 	}
 
-	// Fetch metrics from /proc, /sys.
-	ioCountersStats, err := disk.IOCounters(devices...)
+	// Fetch metrics from /proc, /sys, or the performance counters on Windows.
+	ioCountersStats, err := ioCounters(devices...)
 	if err != nil {
 		glog.Errorf("Failed to retrieve disk IO counters: %v", err)
 		return
@@ -282,22 +280,6 @@ func (dc *diskCollector) collect() {
 
 }
 
-// listRootBlockDevices lists all block devices that's not a slave or holder.
-func listRootBlockDevices(timeout time.Duration) []string {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	// "-d" prevents printing slave or holder devices. i.e. /dev/sda1, /dev/sda2...
-	// "-n" prevents printing the headings.
-	// "-p NAME" specifies to only print the device name.
-	cmd := exec.CommandContext(ctx, "lsblk", "-d", "-n", "-o", "NAME")
-	stdout, err := cmd.Output()
-	if err != nil {
-		glog.Errorf("Error calling lsblk")
-	}
-	return strings.Split(strings.TrimSpace(string(stdout)), "\n")
-}
-
 // listAttachedBlockDevices lists all currently attached block devices.
 func listAttachedBlockDevices() []string {
 	blks := []string{}
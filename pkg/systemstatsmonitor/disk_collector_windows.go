@@ -0,0 +1,102 @@
+// +build windows
+
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/StackExchange/wmi"
+	"github.com/shirou/gopsutil/disk"
+)
+
+// hundredNanosecondsPerMillisecond converts the timers in 100ns to milliseconds.
+const hundredNanosecondsPerMillisecond = 10000
+
+// win32_PerfRawData_PerfDisk_LogicalDisk is the LogicalDisk performance object. It is named
+// after the WMI class, whose names are case insensitive, so that it can be queried with
+// wmi.CreateQuery.
+type win32_PerfRawData_PerfDisk_LogicalDisk struct {
+	Name string
+	// DiskReadsPerSec and DiskWritesPerSec count the operations.
+	DiskReadsPerSec  uint32
+	DiskWritesPerSec uint32
+	// DiskReadBytesPerSec and DiskWriteBytesPerSec count the Bytes.
+	DiskReadBytesPerSec  uint64
+	DiskWriteBytesPerSec uint64
+	// AvgDisksecPerRead and AvgDisksecPerWrite count the time spent, in ticks of
+	// Frequency_PerfTime.
+	AvgDisksecPerRead  uint32
+	AvgDisksecPerWrite uint32
+	// PercentDiskTime counts the time the disk was busy, and AvgDiskQueueLength the time
+	// weighted by the number of requests, in 100ns.
+	PercentDiskTime    uint64
+	AvgDiskQueueLength uint64
+	Frequency_PerfTime uint64
+}
+
+// ioCounters returns the IO counters of the logical disks (e.g. "C:"), or of all logical disks
+// if none is given, from the raw LogicalDisk performance counters. The counters of the
+// merged operations are not available on Windows.
+func ioCounters(devices ...string) (map[string]disk.IOCountersStat, error) {
+	var dst []win32_PerfRawData_PerfDisk_LogicalDisk
+	if err := wmi.Query(wmi.CreateQuery(&dst, ""), &dst); err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, device := range devices {
+		wanted[device] = true
+	}
+	stats := make(map[string]disk.IOCountersStat)
+	for _, d := range dst {
+		// Skip the _Total instance and the volumes without a drive letter.
+		if !strings.HasSuffix(d.Name, ":") {
+			continue
+		}
+		if len(wanted) != 0 && !wanted[d.Name] {
+			continue
+		}
+		stats[d.Name] = disk.IOCountersStat{
+			Name:       d.Name,
+			ReadCount:  uint64(d.DiskReadsPerSec),
+			WriteCount: uint64(d.DiskWritesPerSec),
+			ReadBytes:  d.DiskReadBytesPerSec,
+			WriteBytes: d.DiskWriteBytesPerSec,
+			ReadTime:   ticksToMilliseconds(uint64(d.AvgDisksecPerRead), d.Frequency_PerfTime),
+			WriteTime:  ticksToMilliseconds(uint64(d.AvgDisksecPerWrite), d.Frequency_PerfTime),
+			IoTime:     d.PercentDiskTime / hundredNanosecondsPerMillisecond,
+			WeightedIO: d.AvgDiskQueueLength / hundredNanosecondsPerMillisecond,
+		}
+	}
+	return stats, nil
+}
+
+// ticksToMilliseconds converts the ticks of the performance counter with the frequency to
+// milliseconds.
+func ticksToMilliseconds(ticks, frequency uint64) uint64 {
+	if frequency == 0 {
+		return 0
+	}
+	return ticks * 1000 / frequency
+}
+
+// listRootBlockDevices lists the drives, since Windows has no block devices.
+func listRootBlockDevices(timeout time.Duration) []string {
+	return listAttachedBlockDevices()
+}
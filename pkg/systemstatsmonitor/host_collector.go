@@ -21,7 +21,6 @@ import (
 	"github.com/shirou/gopsutil/host"
 
 	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
-	"k8s.io/node-problem-detector/pkg/util"
 	"k8s.io/node-problem-detector/pkg/util/metrics"
 )
 
@@ -39,7 +38,7 @@ func NewHostCollectorOrDie(hostConfig *ssmtypes.HostStatsConfig) *hostCollector
 	}
 	hc.tags["kernel_version"] = kernelVersion
 
-	osVersion, err := util.GetOSVersion()
+	osVersion, err := getOSVersion()
 	if err != nil {
 		glog.Fatalf("Failed to retrieve OS version: %v", err)
 	}
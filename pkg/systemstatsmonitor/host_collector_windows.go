@@ -0,0 +1,35 @@
+// +build windows
+
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"fmt"
+
+	"github.com/shirou/gopsutil/host"
+)
+
+// getOSVersion returns the Windows edition and build, e.g.
+// "Microsoft Windows Server 2019 Datacenter 10.0.17763 Build 17763".
+func getOSVersion() (string, error) {
+	platform, _, version, err := host.PlatformInformation()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s", platform, version), nil
+}
@@ -24,3 +24,21 @@ const directionLabel = "direction"
 
 // stateLabel labels the state of disk/memory/cpu usage, e.g.: "free", "used".
 const stateLabel = "state"
+
+// mountPointLabel labels the mount point of a filesystem, e.g.: "/", "/var/lib/docker".
+const mountPointLabel = "mount_point"
+
+// errorTypeLabel labels the type of hardware or connection tracking errors, e.g.: "correctable", "drop".
+const errorTypeLabel = "type"
+
+// zoneLabel labels a thermal or power zone, e.g.: "thermal_zone0", "intel-rapl:0".
+const zoneLabel = "zone"
+
+// zoneTypeLabel labels the type of a thermal or power zone, e.g.: "x86_pkg_temp", "package-0".
+const zoneTypeLabel = "zone_type"
+
+// cpuLabel labels a CPU, e.g.: "cpu0".
+const cpuLabel = "cpu"
+
+// throttleLevelLabel labels the level CPUs are throttled at: "core" or "package".
+const throttleLevelLabel = "level"
@@ -0,0 +1,97 @@
+// +build windows
+
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"fmt"
+
+	"github.com/StackExchange/wmi"
+	"github.com/golang/glog"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// win32_PerfRawData_PerfOS_Memory is the Memory performance object, in Bytes. It is named
+// after the WMI class, whose names are case insensitive, so that it can be queried with
+// wmi.CreateQuery.
+type win32_PerfRawData_PerfOS_Memory struct {
+	CacheBytes                      uint64
+	FreeAndZeroPageListBytes        uint64
+	ModifiedPageListBytes           uint64
+	PoolNonpagedBytes               uint64
+	PoolPagedResidentBytes          uint64
+	StandbyCacheCoreBytes           uint64
+	StandbyCacheNormalPriorityBytes uint64
+	StandbyCacheReserveBytes        uint64
+}
+
+// collect records the memory usage from the Memory performance counters. The states are
+// mapped to the closest Linux states: the free and zeroed page lists are free, the standby
+// and modified page lists are cached, the kernel pools are slab, and the rest is used.
+// Windows does not track anonymous and unevictable memory, so they are not recorded.
+func (mc *memoryCollector) collect() {
+	if mc == nil {
+		return
+	}
+
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		glog.Errorf("Failed to retrieve memory stats: %v", err)
+		return
+	}
+	counters, err := queryPerfOSMemory()
+	if err != nil {
+		glog.Errorf("Failed to retrieve memory stats: %v", err)
+		return
+	}
+
+	standby := counters.StandbyCacheCoreBytes + counters.StandbyCacheNormalPriorityBytes + counters.StandbyCacheReserveBytes
+	cached := standby + counters.ModifiedPageListBytes
+	slab := counters.PoolNonpagedBytes + counters.PoolPagedResidentBytes
+
+	if mc.mBytesUsed != nil {
+		var memUsed uint64
+		if notUsed := counters.FreeAndZeroPageListBytes + cached + slab; vm.Total > notUsed {
+			memUsed = vm.Total - notUsed
+		}
+		mc.mBytesUsed.Record(map[string]string{stateLabel: "free"}, int64(counters.FreeAndZeroPageListBytes))
+		mc.mBytesUsed.Record(map[string]string{stateLabel: "used"}, int64(memUsed))
+		mc.mBytesUsed.Record(map[string]string{stateLabel: "cached"}, int64(cached))
+		mc.mBytesUsed.Record(map[string]string{stateLabel: "slab"}, int64(slab))
+	}
+
+	if mc.mDirtyUsed != nil {
+		mc.mDirtyUsed.Record(map[string]string{stateLabel: "dirty"}, int64(counters.ModifiedPageListBytes))
+	}
+
+	if mc.mPageCacheUsed != nil {
+		mc.mPageCacheUsed.Record(map[string]string{stateLabel: "active"}, int64(counters.CacheBytes))
+		mc.mPageCacheUsed.Record(map[string]string{stateLabel: "inactive"}, int64(standby))
+	}
+}
+
+func queryPerfOSMemory() (*win32_PerfRawData_PerfOS_Memory, error) {
+	var dst []win32_PerfRawData_PerfOS_Memory
+	if err := wmi.Query(wmi.CreateQuery(&dst, ""), &dst); err != nil {
+		return nil, err
+	}
+	if len(dst) == 0 {
+		return nil, fmt.Errorf("no memory performance counters reported")
+	}
+	return &dst[0], nil
+}
@@ -0,0 +1,358 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+const conntrackFullCondition = "ConntrackFull"
+
+// conntrackErrorTypes are the columns of /proc/net/stat/nf_conntrack counting the packets
+// the connection tracking failed to handle: "drop" when a new connection could not be
+// tracked because the table is full, "early_drop" when an unassured connection was evicted
+// to make room, and "insert_failed" when a connection could not be inserted.
+var conntrackErrorTypes = []string{"drop", "early_drop", "insert_failed"}
+
+// conntrackUsage is the usage of the connection tracking table.
+type conntrackUsage struct {
+	used uint64
+	max  uint64
+}
+
+// tcpSegments are the cumulative numbers of TCP segments sent since boot.
+type tcpSegments struct {
+	out           uint64
+	retransmitted uint64
+}
+
+type netCollector struct {
+	mConntrackEntries   *metrics.Int64Metric
+	mConntrackErrors    *metrics.Int64Metric
+	mTCPRetransmitRatio *metrics.Float64Metric
+
+	config *ssmtypes.NetStatsConfig
+
+	// procPath is the mount point of procfs.
+	procPath string
+
+	// lastErrors are the conntrack error counts of the last round, which the drops since
+	// the last round are counted from.
+	lastErrors map[string]uint64
+	// lastSegments are the TCP segment counts of the last round, which the retransmit
+	// ratio is computed from.
+	lastSegments *tcpSegments
+
+	// condition is the ConntrackFull condition, nil if it is disabled.
+	condition *types.Condition
+}
+
+// NewNetCollectorOrDie creates the collector of the connection tracking table usage and
+// errors, and the TCP retransmissions.
+func NewNetCollectorOrDie(netConfig *ssmtypes.NetStatsConfig) *netCollector {
+	nc := netCollector{
+		config:   netConfig,
+		procPath: "/proc",
+	}
+
+	var err error
+
+	nc.mConntrackEntries, err = metrics.NewInt64Metric(
+		metrics.NetConntrackEntriesID,
+		netConfig.MetricsConfigs[string(metrics.NetConntrackEntriesID)].DisplayName,
+		"Entries of the connection tracking table, by state",
+		"1",
+		metrics.LastValue,
+		[]string{stateLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.NetConntrackEntriesID, err)
+	}
+
+	// Use metrics.Sum aggregation method to ensure the metric is a counter/cumulative metric.
+	nc.mConntrackErrors, err = metrics.NewInt64Metric(
+		metrics.NetConntrackErrorsID,
+		netConfig.MetricsConfigs[string(metrics.NetConntrackErrorsID)].DisplayName,
+		"Cumulative number of packets the connection tracking failed to handle since boot, by type",
+		"1",
+		metrics.Sum,
+		[]string{errorTypeLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.NetConntrackErrorsID, err)
+	}
+
+	nc.mTCPRetransmitRatio, err = metrics.NewFloat64Metric(
+		metrics.NetTCPRetransmitRatioID,
+		netConfig.MetricsConfigs[string(metrics.NetTCPRetransmitRatioID)].DisplayName,
+		"Percentage of the TCP segments sent since the last collection which were retransmitted",
+		"%",
+		metrics.LastValue,
+		[]string{})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.NetTCPRetransmitRatioID, err)
+	}
+
+	if netConfig.HasConntrackCondition() {
+		nc.condition = &types.Condition{
+			Type:       conntrackFullCondition,
+			Status:     types.False,
+			Transition: time.Now(),
+			Reason:     "No" + conntrackFullCondition,
+			Message:    nc.normalMessage(),
+		}
+	}
+	return &nc
+}
+
+func (nc *netCollector) normalMessage() string {
+	return fmt.Sprintf("connection tracking table usage is below %v%%", nc.config.ConntrackFullThreshold)
+}
+
+// initialStatus returns the initial ConntrackFull condition, or nil if it is disabled.
+func (nc *netCollector) initialStatus() *types.Status {
+	if nc == nil || nc.condition == nil {
+		return nil
+	}
+	return &types.Status{
+		Source:     SystemStatsMonitorName,
+		Conditions: []types.Condition{*nc.condition},
+	}
+}
+
+// collect records the metrics, and returns a new status when the ConntrackFull condition
+// changes.
+func (nc *netCollector) collect() *types.Status {
+	if nc == nil {
+		return nil
+	}
+
+	var usage *conntrackUsage
+	u, err := readConntrackUsage(nc.procPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			glog.V(4).Infof("Connection tracking is not enabled: %v", err)
+		} else {
+			glog.Errorf("Failed to retrieve connection tracking table usage: %v", err)
+		}
+	} else {
+		usage = &u
+		if nc.mConntrackEntries != nil {
+			nc.mConntrackEntries.Record(map[string]string{stateLabel: "used"}, int64(u.used))
+			nc.mConntrackEntries.Record(map[string]string{stateLabel: "free"}, int64(u.max-u.used))
+		}
+	}
+
+	errors, err := readConntrackErrors(filepath.Join(nc.procPath, "net/stat/nf_conntrack"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("Failed to retrieve connection tracking errors: %v", err)
+		}
+	} else if nc.mConntrackErrors != nil {
+		// The errors since the last round are added to the counts, lastErrors is
+		// updated by updateCondition.
+		for errorType, count := range errors {
+			nc.mConntrackErrors.Record(map[string]string{errorTypeLabel: errorType}, int64(increase(nc.lastErrors[errorType], count)))
+		}
+	}
+
+	if nc.mTCPRetransmitRatio != nil {
+		segments, err := readTCPSegments(filepath.Join(nc.procPath, "net/snmp"))
+		if err != nil {
+			glog.Errorf("Failed to retrieve TCP segment counts: %v", err)
+		} else {
+			if last := nc.lastSegments; last != nil {
+				out := increase(last.out, segments.out)
+				retransmitted := increase(last.retransmitted, segments.retransmitted)
+				nc.mTCPRetransmitRatio.Record(map[string]string{}, percentage(retransmitted, out))
+			}
+			nc.lastSegments = &segments
+		}
+	}
+
+	return nc.updateCondition(usage, errors, time.Now())
+}
+
+// updateCondition evaluates the threshold and the drops since the last round, and returns
+// a new status if the ConntrackFull condition changes. The condition is kept when the
+// table usage was not collected.
+func (nc *netCollector) updateCondition(usage *conntrackUsage, errors map[string]uint64, now time.Time) *types.Status {
+	last := nc.lastErrors
+	if errors != nil {
+		nc.lastErrors = errors
+	}
+	if nc.condition == nil || usage == nil {
+		return nil
+	}
+
+	var problems []string
+	if p := percentage(usage.used, usage.max); p >= nc.config.ConntrackFullThreshold {
+		problems = append(problems, fmt.Sprintf("%d of %d connection tracking entries (%.1f%%) are in use, threshold is %v%%",
+			usage.used, usage.max, p, nc.config.ConntrackFullThreshold))
+	}
+	if last != nil && errors != nil {
+		var dropped uint64
+		for _, errorType := range []string{"drop", "early_drop"} {
+			dropped += increase(last[errorType], errors[errorType])
+		}
+		if dropped > 0 {
+			problems = append(problems, fmt.Sprintf("%d packets were dropped by connection tracking since the last collection", dropped))
+		}
+	}
+	problem := strings.Join(problems, ", ")
+	events, changed := updateCondition(nc.condition, problem, nc.normalMessage(), now)
+	if !changed {
+		return nil
+	}
+	return &types.Status{
+		Source:     SystemStatsMonitorName,
+		Events:     events,
+		Conditions: []types.Condition{*nc.condition},
+	}
+}
+
+// readConntrackUsage reads the number of entries and the size of the connection tracking
+// table. "nf_conntrack" replaces the "ip_conntrack" of old kernels.
+func readConntrackUsage(procPath string) (conntrackUsage, error) {
+	dir, prefix := filepath.Join(procPath, "sys/net/netfilter"), "nf_conntrack"
+	if _, err := os.Stat(filepath.Join(dir, prefix+"_count")); os.IsNotExist(err) {
+		dir, prefix = filepath.Join(procPath, "sys/net/ipv4/netfilter"), "ip_conntrack"
+	}
+	used, err := readUint(filepath.Join(dir, prefix+"_count"))
+	if err != nil {
+		return conntrackUsage{}, err
+	}
+	max, err := readUint(filepath.Join(dir, prefix+"_max"))
+	if err != nil {
+		return conntrackUsage{}, err
+	}
+	if used > max {
+		used = max
+	}
+	return conntrackUsage{used: used, max: max}, nil
+}
+
+// readConntrackErrors sums the error counts of all CPUs in /proc/net/stat/nf_conntrack,
+// whose first line names the columns, followed by a line of hexadecimal counts per CPU.
+// The columns differ between kernel versions, the missing ones are not reported.
+func readConntrackErrors(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseConntrackErrors(f)
+}
+
+func parseConntrackErrors(r io.Reader) (map[string]uint64, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("missing header: %v", scanner.Err())
+	}
+	columns := make(map[string]int)
+	for i, name := range strings.Fields(scanner.Text()) {
+		columns[name] = i
+	}
+	errors := make(map[string]uint64)
+	for _, errorType := range conntrackErrorTypes {
+		if _, ok := columns[errorType]; ok {
+			errors[errorType] = 0
+		}
+	}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for errorType := range errors {
+			i := columns[errorType]
+			if i >= len(fields) {
+				return nil, fmt.Errorf("missing column %q in %q", errorType, scanner.Text())
+			}
+			count, err := strconv.ParseUint(fields[i], 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s count %q: %v", errorType, fields[i], err)
+			}
+			errors[errorType] += count
+		}
+	}
+	return errors, scanner.Err()
+}
+
+// readTCPSegments reads the TCP segment counts from /proc/net/snmp, where the "Tcp:" line
+// naming the columns is followed by the "Tcp:" line of the values.
+func readTCPSegments(path string) (tcpSegments, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return tcpSegments{}, err
+	}
+	defer f.Close()
+	return parseTCPSegments(f)
+}
+
+func parseTCPSegments(r io.Reader) (tcpSegments, error) {
+	scanner := bufio.NewScanner(r)
+	var names []string
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "Tcp:" {
+			continue
+		}
+		if names == nil {
+			names = fields
+			continue
+		}
+		if len(fields) != len(names) {
+			return tcpSegments{}, fmt.Errorf("%d TCP values for %d columns", len(fields), len(names))
+		}
+		var segments tcpSegments
+		var err error
+		found := 0
+		for i, name := range names {
+			var value *uint64
+			switch name {
+			case "OutSegs":
+				value = &segments.out
+			case "RetransSegs":
+				value = &segments.retransmitted
+			default:
+				continue
+			}
+			*value, err = strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return tcpSegments{}, fmt.Errorf("invalid %s %q: %v", name, fields[i], err)
+			}
+			found++
+		}
+		if found != 2 {
+			return tcpSegments{}, fmt.Errorf("missing OutSegs or RetransSegs in %v", names)
+		}
+		return segments, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return tcpSegments{}, err
+	}
+	return tcpSegments{}, fmt.Errorf("missing TCP statistics")
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const conntrackStat = `entries  clashres found new invalid ignore delete chainlength insert insert_failed drop early_drop icmp_error  expect_new expect_create expect_delete search_restart
+00000100  00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000001 0000000a 00000002 00000000  00000000 00000000 00000000 00000000
+00000100  00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000010 00000000 00000000  00000000 00000000 00000000 00000000
+`
+
+const snmp = `Ip: Forwarding DefaultTTL InReceives
+Ip: 1 64 1000
+Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts InCsumErrors
+Tcp: 1 200 120000 -1 183 164 15 51 2 21723 21742 12 0 50 0
+Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti MemErrors
+Udp: 1 2 3 4 5 6 7 8 9
+`
+
+func TestParseNetStats(t *testing.T) {
+	errors, err := parseConntrackErrors(strings.NewReader(conntrackStat))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"drop": 26, "early_drop": 2, "insert_failed": 1}, errors)
+
+	// Old kernels do not count early drops.
+	errors, err = parseConntrackErrors(strings.NewReader("entries drop\n00000001 00000003\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"drop": 3}, errors)
+
+	_, err = parseConntrackErrors(strings.NewReader("entries drop\n00000001\n"))
+	assert.Error(t, err)
+
+	segments, err := parseTCPSegments(strings.NewReader(snmp))
+	assert.NoError(t, err)
+	assert.Equal(t, tcpSegments{out: 21742, retransmitted: 12}, segments)
+
+	_, err = parseTCPSegments(strings.NewReader("Ip: Forwarding\nIp: 1\n"))
+	assert.Error(t, err)
+}
+
+func TestConntrackFullCondition(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+	writeProcFile(t, procPath, "sys/net/netfilter/nf_conntrack_count", "100\n")
+	writeProcFile(t, procPath, "sys/net/netfilter/nf_conntrack_max", "1000\n")
+	writeProcFile(t, procPath, "net/stat/nf_conntrack", "entries drop early_drop\n00000064 00000000 00000000\n")
+	writeProcFile(t, procPath, "net/snmp", snmp)
+
+	nc := NewNetCollectorOrDie(&ssmtypes.NetStatsConfig{ConntrackFullThreshold: 90})
+	nc.procPath = procPath
+
+	status := nc.initialStatus()
+	if assert.NotNil(t, status) {
+		assert.Equal(t, conntrackFullCondition, status.Conditions[0].Type)
+		assert.Equal(t, types.False, status.Conditions[0].Status)
+	}
+	assert.Nil(t, nc.collect(), "condition should not change")
+
+	writeProcFile(t, procPath, "sys/net/netfilter/nf_conntrack_count", "950\n")
+	status = nc.collect()
+	if assert.NotNil(t, status) {
+		assert.Len(t, status.Events, 1)
+		assert.Equal(t, types.True, status.Conditions[0].Status)
+		assert.Equal(t, conntrackFullCondition, status.Conditions[0].Reason)
+		assert.Equal(t, "950 of 1000 connection tracking entries (95.0%) are in use, threshold is 90%", status.Conditions[0].Message)
+	}
+
+	// The table usage fell, but packets were dropped since the last collection.
+	writeProcFile(t, procPath, "sys/net/netfilter/nf_conntrack_count", "500\n")
+	writeProcFile(t, procPath, "net/stat/nf_conntrack", "entries drop early_drop\n00000064 00000005 00000002\n")
+	status = nc.collect()
+	if assert.NotNil(t, status) {
+		assert.Empty(t, status.Events)
+		assert.Equal(t, types.True, status.Conditions[0].Status)
+		assert.Equal(t, "7 packets were dropped by connection tracking since the last collection", status.Conditions[0].Message)
+	}
+
+	status = nc.collect()
+	if assert.NotNil(t, status) {
+		assert.Len(t, status.Events, 1)
+		assert.Equal(t, types.False, status.Conditions[0].Status)
+		assert.Equal(t, "NoConntrackFull", status.Conditions[0].Reason)
+	}
+
+	// The condition is kept when connection tracking is disabled.
+	os.RemoveAll(procPath + "/sys/net/netfilter")
+	assert.Nil(t, nc.collect())
+}
+
+func TestReadConntrackUsageOfOldKernels(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+	writeProcFile(t, procPath, "sys/net/ipv4/netfilter/ip_conntrack_count", "10\n")
+	writeProcFile(t, procPath, "sys/net/ipv4/netfilter/ip_conntrack_max", "100\n")
+
+	usage, err := readConntrackUsage(procPath)
+	assert.NoError(t, err)
+	assert.Equal(t, conntrackUsage{used: 10, max: 100}, usage)
+}
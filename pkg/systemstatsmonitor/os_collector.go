@@ -0,0 +1,416 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/shirou/gopsutil/disk"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+// pressureRule sets a condition when the usage of a resource is above a threshold.
+type pressureRule struct {
+	// resource is the name of the resource in condition messages.
+	resource string
+	// threshold is the usage percentage above which the condition is set.
+	threshold float64
+	// pressure returns why the resource is under pressure, or empty string if it is not.
+	// ok is false if the usage of the resource was not collected.
+	pressure func(stats *osStats, threshold float64) (message string, ok bool)
+}
+
+func (r pressureRule) normalMessage() string {
+	return fmt.Sprintf("%s usage is below %v%%", r.resource, r.threshold)
+}
+
+// osStats is the operating system resource usage collected in a round.
+type osStats struct {
+	fds    *fdUsage
+	inodes []inodeUsage
+	ports  *portUsage
+}
+
+type fdUsage struct {
+	used uint64
+	max  uint64
+}
+
+type inodeUsage struct {
+	device     string
+	mountPoint string
+	used       uint64
+	free       uint64
+}
+
+type portUsage struct {
+	used  uint64
+	total uint64
+}
+
+type osCollector struct {
+	mFileDescriptors *metrics.Int64Metric
+	mInodesUsed      *metrics.Int64Metric
+	mEphemeralPorts  *metrics.Int64Metric
+
+	config *ssmtypes.OSStatsConfig
+
+	// procPath is the mount point of procfs.
+	procPath string
+	// listInodeUsage lists the inode usage of all mounted filesystems.
+	listInodeUsage func() ([]inodeUsage, error)
+
+	rules      []pressureRule
+	conditions []types.Condition
+}
+
+func NewOSCollectorOrDie(osConfig *ssmtypes.OSStatsConfig) *osCollector {
+	oc := osCollector{
+		config:         osConfig,
+		procPath:       "/proc",
+		listInodeUsage: listInodeUsage,
+	}
+
+	var err error
+
+	oc.mFileDescriptors, err = metrics.NewInt64Metric(
+		metrics.OSFileDescriptorsID,
+		osConfig.MetricsConfigs[string(metrics.OSFileDescriptorsID)].DisplayName,
+		"System wide file descriptors, by state",
+		"1",
+		metrics.LastValue,
+		[]string{stateLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.OSFileDescriptorsID, err)
+	}
+
+	oc.mInodesUsed, err = metrics.NewInt64Metric(
+		metrics.OSInodesUsedID,
+		osConfig.MetricsConfigs[string(metrics.OSInodesUsedID)].DisplayName,
+		"Inodes of each mounted filesystem, by state",
+		"1",
+		metrics.LastValue,
+		[]string{deviceNameLabel, mountPointLabel, stateLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.OSInodesUsedID, err)
+	}
+
+	oc.mEphemeralPorts, err = metrics.NewInt64Metric(
+		metrics.OSEphemeralPortsID,
+		osConfig.MetricsConfigs[string(metrics.OSEphemeralPortsID)].DisplayName,
+		"Local ports in the ephemeral port range, by state",
+		"1",
+		metrics.LastValue,
+		[]string{stateLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.OSEphemeralPortsID, err)
+	}
+
+	oc.initializeConditions()
+	return &oc
+}
+
+// initializeConditions creates the enabled pressure conditions, which are False initially.
+func (oc *osCollector) initializeConditions() {
+	candidates := []struct {
+		conditionType string
+		rule          pressureRule
+	}{
+		{"FDPressure", pressureRule{"file descriptor", oc.config.FDPressureThreshold, fdPressure}},
+		{"InodePressure", pressureRule{"inode", oc.config.InodePressureThreshold, inodePressure}},
+		{"EphemeralPortPressure", pressureRule{"ephemeral port", oc.config.EphemeralPortPressureThreshold, ephemeralPortPressure}},
+	}
+	for _, c := range candidates {
+		if c.rule.threshold <= 0 {
+			continue
+		}
+		oc.rules = append(oc.rules, c.rule)
+		oc.conditions = append(oc.conditions, types.Condition{
+			Type:       c.conditionType,
+			Status:     types.False,
+			Transition: time.Now(),
+			Reason:     "No" + c.conditionType,
+			Message:    c.rule.normalMessage(),
+		})
+	}
+}
+
+// initialStatus returns the initial pressure conditions, or nil if no condition is enabled.
+func (oc *osCollector) initialStatus() *types.Status {
+	if oc == nil || len(oc.conditions) == 0 {
+		return nil
+	}
+	return &types.Status{
+		Source:     SystemStatsMonitorName,
+		Conditions: append([]types.Condition(nil), oc.conditions...),
+	}
+}
+
+// collect records the metrics, and returns a new status when a pressure condition changes.
+func (oc *osCollector) collect() *types.Status {
+	if oc == nil {
+		return nil
+	}
+
+	var stats osStats
+	fds, err := readFileNr(filepath.Join(oc.procPath, "sys/fs/file-nr"))
+	if err != nil {
+		glog.Errorf("Failed to retrieve file descriptor usage: %v", err)
+	} else {
+		stats.fds = &fds
+		if oc.mFileDescriptors != nil {
+			oc.mFileDescriptors.Record(map[string]string{stateLabel: "used"}, int64(fds.used))
+			oc.mFileDescriptors.Record(map[string]string{stateLabel: "free"}, int64(fds.max-fds.used))
+		}
+	}
+
+	stats.inodes, err = oc.listInodeUsage()
+	if err != nil {
+		glog.Errorf("Failed to retrieve inode usage: %v", err)
+	}
+	if oc.mInodesUsed != nil {
+		for _, inodes := range stats.inodes {
+			oc.mInodesUsed.Record(map[string]string{deviceNameLabel: inodes.device, mountPointLabel: inodes.mountPoint, stateLabel: "used"}, int64(inodes.used))
+			oc.mInodesUsed.Record(map[string]string{deviceNameLabel: inodes.device, mountPointLabel: inodes.mountPoint, stateLabel: "free"}, int64(inodes.free))
+		}
+	}
+
+	ports, err := readEphemeralPortUsage(oc.procPath)
+	if err != nil {
+		glog.Errorf("Failed to retrieve ephemeral port usage: %v", err)
+	} else {
+		stats.ports = &ports
+		if oc.mEphemeralPorts != nil {
+			oc.mEphemeralPorts.Record(map[string]string{stateLabel: "used"}, int64(ports.used))
+			oc.mEphemeralPorts.Record(map[string]string{stateLabel: "free"}, int64(ports.total-ports.used))
+		}
+	}
+
+	return oc.updateConditions(&stats, time.Now())
+}
+
+// updateConditions evaluates the pressure rules, and returns a new status if any condition
+// changes. A condition is kept when its resource usage could not be collected.
+func (oc *osCollector) updateConditions(stats *osStats, now time.Time) *types.Status {
+	var events []types.Event
+	changed := false
+	for i, rule := range oc.rules {
+		condition := &oc.conditions[i]
+		pressure, ok := rule.pressure(stats, rule.threshold)
+		if !ok {
+			continue
+		}
+		status, reason, message := types.False, "No"+condition.Type, rule.normalMessage()
+		if pressure != "" {
+			status, reason, message = types.True, condition.Type, pressure
+		}
+		if status != condition.Status {
+			condition.Transition = now
+			events = append(events, util.GenerateConditionChangeEvent(condition.Type, status, reason, now))
+		} else if message == condition.Message {
+			continue
+		}
+		condition.Status = status
+		condition.Reason = reason
+		condition.Message = message
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return &types.Status{
+		Source:     SystemStatsMonitorName,
+		Events:     events,
+		Conditions: append([]types.Condition(nil), oc.conditions...),
+	}
+}
+
+func percentage(used, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(total)
+}
+
+func fdPressure(stats *osStats, threshold float64) (string, bool) {
+	if stats.fds == nil {
+		return "", false
+	}
+	if p := percentage(stats.fds.used, stats.fds.max); p >= threshold {
+		return fmt.Sprintf("%d of %d file descriptors (%.1f%%) are in use, threshold is %v%%",
+			stats.fds.used, stats.fds.max, p, threshold), true
+	}
+	return "", true
+}
+
+func inodePressure(stats *osStats, threshold float64) (string, bool) {
+	if stats.inodes == nil {
+		return "", false
+	}
+	var pressures []string
+	for _, inodes := range stats.inodes {
+		if p := percentage(inodes.used, inodes.used+inodes.free); p >= threshold {
+			pressures = append(pressures, fmt.Sprintf("%s (%s) uses %.1f%% of inodes", inodes.mountPoint, inodes.device, p))
+		}
+	}
+	if len(pressures) == 0 {
+		return "", true
+	}
+	sort.Strings(pressures)
+	return fmt.Sprintf("%s, threshold is %v%%", strings.Join(pressures, ", "), threshold), true
+}
+
+func ephemeralPortPressure(stats *osStats, threshold float64) (string, bool) {
+	if stats.ports == nil {
+		return "", false
+	}
+	if p := percentage(stats.ports.used, stats.ports.total); p >= threshold {
+		return fmt.Sprintf("%d of %d ephemeral ports (%.1f%%) are in use, threshold is %v%%",
+			stats.ports.used, stats.ports.total, p, threshold), true
+	}
+	return "", true
+}
+
+// readFileNr reads the system wide file descriptor usage from /proc/sys/fs/file-nr, which
+// contains the number of allocated, allocated but unused, and maximum file descriptors.
+func readFileNr(path string) (fdUsage, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fdUsage{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return fdUsage{}, fmt.Errorf("unexpected content of %q: %q", path, string(data))
+	}
+	var values [3]uint64
+	for i, field := range fields {
+		values[i], err = strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return fdUsage{}, fmt.Errorf("failed to parse %q: %v", path, err)
+		}
+	}
+	return fdUsage{used: values[0] - values[1], max: values[2]}, nil
+}
+
+// listInodeUsage lists the inode usage of all mounted filesystems which have a fixed number
+// of inodes.
+func listInodeUsage() ([]inodeUsage, error) {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+	usages := []inodeUsage{}
+	for _, partition := range partitions {
+		usageStat, err := disk.Usage(partition.Mountpoint)
+		if err != nil {
+			glog.Errorf("Failed to retrieve inode usage for %q: %v", partition.Mountpoint, err)
+			continue
+		}
+		// Filesystems such as btrfs allocate inodes dynamically, and report no inodes.
+		if usageStat.InodesTotal == 0 {
+			continue
+		}
+		usages = append(usages, inodeUsage{
+			device:     strings.TrimPrefix(partition.Device, "/dev/"),
+			mountPoint: partition.Mountpoint,
+			used:       usageStat.InodesUsed,
+			free:       usageStat.InodesFree,
+		})
+	}
+	return usages, nil
+}
+
+// readEphemeralPortUsage counts the distinct local ports of TCP sockets in the local port
+// range, which is the range ephemeral ports are allocated from.
+func readEphemeralPortUsage(procPath string) (portUsage, error) {
+	rangePath := filepath.Join(procPath, "sys/net/ipv4/ip_local_port_range")
+	data, err := ioutil.ReadFile(rangePath)
+	if err != nil {
+		return portUsage{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return portUsage{}, fmt.Errorf("unexpected content of %q: %q", rangePath, string(data))
+	}
+	low, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return portUsage{}, fmt.Errorf("failed to parse %q: %v", rangePath, err)
+	}
+	high, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil || high < low {
+		return portUsage{}, fmt.Errorf("invalid local port range %q in %q", strings.TrimSpace(string(data)), rangePath)
+	}
+
+	ports := make(map[uint64]bool)
+	for _, file := range []string{"net/tcp", "net/tcp6"} {
+		f, err := os.Open(filepath.Join(procPath, file))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// IPv6 may be disabled.
+				continue
+			}
+			return portUsage{}, err
+		}
+		err = localPorts(f, low, high, ports)
+		f.Close()
+		if err != nil {
+			return portUsage{}, fmt.Errorf("failed to parse %q: %v", file, err)
+		}
+	}
+	return portUsage{used: uint64(len(ports)), total: high - low + 1}, nil
+}
+
+// localPorts adds the local ports in [low, high] of the sockets in a /proc/net/tcp{,6}
+// table to ports. Each line after the header is a socket, whose second field is the local
+// address in the format of "<hex address>:<hex port>".
+func localPorts(f io.Reader, low, high uint64, ports map[uint64]bool) error {
+	scanner := bufio.NewScanner(f)
+	// Skip the header.
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		i := strings.LastIndex(fields[1], ":")
+		if i < 0 {
+			return fmt.Errorf("invalid local address %q", fields[1])
+		}
+		port, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil {
+			return fmt.Errorf("invalid local address %q: %v", fields[1], err)
+		}
+		if port >= low && port <= high {
+			ports[port] = true
+		}
+	}
+	return scanner.Err()
+}
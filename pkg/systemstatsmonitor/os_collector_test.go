@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+const tcpTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:8000 0100007F:0016 01 00000000:00000000 00:00000000 00000000     0        0 2 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:8000 0200007F:0050 01 00000000:00000000 00:00000000 00000000     0        0 3 1 0000000000000000 20 4 30 10 -1
+   3: 0100007F:8001 0100007F:0016 06 00000000:00000000 00:00000000 00000000     0        0 0 3 0000000000000000
+`
+
+const tcp6Table = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:8002 00000000000000000000000001000000:0016 01 00000000:00000000 00:00000000 00000000     0        0 4 1 0000000000000000 20 4 30 10 -1
+`
+
+func writeProcFile(t *testing.T, procPath, name, content string) {
+	path := filepath.Join(procPath, name)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestReadFileNr(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+	path := filepath.Join(procPath, "file-nr")
+
+	writeProcFile(t, procPath, "file-nr", "2048\t48\t8192\n")
+	fds, err := readFileNr(path)
+	assert.NoError(t, err)
+	assert.Equal(t, fdUsage{used: 2000, max: 8192}, fds)
+
+	writeProcFile(t, procPath, "file-nr", "2048\n")
+	_, err = readFileNr(path)
+	assert.Error(t, err)
+}
+
+func TestReadEphemeralPortUsage(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+
+	// Ports 0x8000 to 0x8003.
+	writeProcFile(t, procPath, "sys/net/ipv4/ip_local_port_range", "32768\t32771\n")
+	writeProcFile(t, procPath, "net/tcp", tcpTable)
+
+	// Port 22 is not ephemeral, and port 0x8000 is counted once.
+	ports, err := readEphemeralPortUsage(procPath)
+	assert.NoError(t, err)
+	assert.Equal(t, portUsage{used: 2, total: 4}, ports)
+
+	writeProcFile(t, procPath, "net/tcp6", tcp6Table)
+	ports, err = readEphemeralPortUsage(procPath)
+	assert.NoError(t, err)
+	assert.Equal(t, portUsage{used: 3, total: 4}, ports)
+
+	writeProcFile(t, procPath, "sys/net/ipv4/ip_local_port_range", "32771\t32768\n")
+	_, err = readEphemeralPortUsage(procPath)
+	assert.Error(t, err)
+}
+
+func TestPressureConditions(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+	writeProcFile(t, procPath, "sys/fs/file-nr", "100\t0\t1000\n")
+	writeProcFile(t, procPath, "sys/net/ipv4/ip_local_port_range", "32768\t32771\n")
+	writeProcFile(t, procPath, "net/tcp", tcpTable)
+	inodes := []inodeUsage{
+		{device: "sda1", mountPoint: "/", used: 10, free: 90},
+		{device: "sdb", mountPoint: "/data", used: 50, free: 50},
+	}
+
+	oc := NewOSCollectorOrDie(&ssmtypes.OSStatsConfig{
+		FDPressureThreshold:    90,
+		InodePressureThreshold: 90,
+	})
+	oc.procPath = procPath
+	oc.listInodeUsage = func() ([]inodeUsage, error) { return inodes, nil }
+
+	status := oc.initialStatus()
+	if assert.NotNil(t, status) {
+		assert.Equal(t, SystemStatsMonitorName, status.Source)
+		assert.Len(t, status.Conditions, 2, "ephemeral port pressure is disabled")
+		assert.Equal(t, "FDPressure", status.Conditions[0].Type)
+		assert.Equal(t, "InodePressure", status.Conditions[1].Type)
+	}
+	assert.Nil(t, oc.collect(), "no condition should change")
+
+	inodes[1].used, inodes[1].free = 95, 5
+	status = oc.collect()
+	if assert.NotNil(t, status) {
+		assert.Len(t, status.Events, 1)
+		assert.Equal(t, types.False, status.Conditions[0].Status)
+		assert.Equal(t, types.True, status.Conditions[1].Status)
+		assert.Equal(t, "InodePressure", status.Conditions[1].Reason)
+		assert.True(t, strings.HasPrefix(status.Conditions[1].Message, "/data (sdb) uses 95.0% of inodes"),
+			status.Conditions[1].Message)
+	}
+
+	// The conditions are kept when the usage can not be collected.
+	oc.listInodeUsage = func() ([]inodeUsage, error) { return nil, os.ErrNotExist }
+	assert.Nil(t, oc.collect())
+
+	writeProcFile(t, procPath, "sys/fs/file-nr", "950\t0\t1000\n")
+	inodes[1].used, inodes[1].free = 50, 50
+	oc.listInodeUsage = func() ([]inodeUsage, error) { return inodes, nil }
+	status = oc.collect()
+	if assert.NotNil(t, status) {
+		assert.Len(t, status.Events, 2)
+		assert.Equal(t, types.True, status.Conditions[0].Status)
+		assert.Equal(t, "950 of 1000 file descriptors (95.0%) are in use, threshold is 90%", status.Conditions[0].Message)
+		assert.Equal(t, types.False, status.Conditions[1].Status)
+		assert.Equal(t, "NoInodePressure", status.Conditions[1].Reason)
+	}
+}
@@ -0,0 +1,419 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+const (
+	zombieProcessesCondition = "ZombieProcesses"
+	dStateProcessesCondition = "ProcessesStuckInDState"
+
+	zombieState          = "zombie"
+	uninterruptibleState = "uninterruptible"
+)
+
+// task is a thread read from /proc/<pid>/task/<tid>/stat.
+type task struct {
+	pid   int
+	tid   int
+	ppid  int
+	comm  string
+	state byte
+	// startTime is the time the task started after boot, in clock ticks. Together with
+	// the tid, it identifies the task across collections despite pid reuse.
+	startTime uint64
+}
+
+type taskKey struct {
+	tid       int
+	startTime uint64
+}
+
+// seenState is the state a task was seen in, and when it was first seen in it.
+type seenState struct {
+	state byte
+	since time.Time
+}
+
+// offender is a zombie process, or a task in uninterruptible sleep.
+type offender struct {
+	task
+	age time.Duration
+	// parent is the name of the parent of a zombie process, which fails to reap it.
+	parent string
+	// wchan is the kernel function a task in uninterruptible sleep waits in.
+	wchan string
+}
+
+type processCollector struct {
+	mCount     *metrics.Int64Metric
+	mOldestAge *metrics.Float64Metric
+
+	config *ssmtypes.ProcessStatsConfig
+
+	// procPath is the mount point of procfs.
+	procPath string
+
+	// seen are the tasks seen zombie or in uninterruptible sleep by the last collection.
+	seen map[taskKey]seenState
+
+	// zombieCondition and dStateCondition are nil when they are disabled.
+	zombieCondition *types.Condition
+	dStateCondition *types.Condition
+}
+
+// NewProcessCollectorOrDie creates the collector of the zombie processes and the processes
+// in uninterruptible sleep.
+func NewProcessCollectorOrDie(processConfig *ssmtypes.ProcessStatsConfig) *processCollector {
+	pc := processCollector{
+		config:   processConfig,
+		procPath: "/proc",
+		seen:     make(map[taskKey]seenState),
+	}
+
+	var err error
+
+	pc.mCount, err = metrics.NewInt64Metric(
+		metrics.ProcessCountID,
+		processConfig.MetricsConfigs[string(metrics.ProcessCountID)].DisplayName,
+		"Zombie processes and threads in uninterruptible sleep, by state",
+		"1",
+		metrics.LastValue,
+		[]string{stateLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.ProcessCountID, err)
+	}
+
+	pc.mOldestAge, err = metrics.NewFloat64Metric(
+		metrics.ProcessOldestAgeID,
+		processConfig.MetricsConfigs[string(metrics.ProcessOldestAgeID)].DisplayName,
+		"Time the oldest zombie process or thread in uninterruptible sleep has been seen in its state, by state",
+		"s",
+		metrics.LastValue,
+		[]string{stateLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.ProcessOldestAgeID, err)
+	}
+
+	now := time.Now()
+	if processConfig.ZombieThreshold > 0 {
+		pc.zombieCondition = &types.Condition{
+			Type:       zombieProcessesCondition,
+			Status:     types.False,
+			Transition: now,
+			Reason:     "No" + zombieProcessesCondition,
+			Message:    pc.zombieNormalMessage(),
+		}
+	}
+	if processConfig.DStateThreshold > 0 {
+		pc.dStateCondition = &types.Condition{
+			Type:       dStateProcessesCondition,
+			Status:     types.False,
+			Transition: now,
+			Reason:     "No" + dStateProcessesCondition,
+			Message:    pc.dStateNormalMessage(),
+		}
+	}
+	return &pc
+}
+
+func (pc *processCollector) zombieNormalMessage() string {
+	return fmt.Sprintf("fewer than %d zombie processes", pc.config.ZombieThreshold)
+}
+
+func (pc *processCollector) dStateNormalMessage() string {
+	return fmt.Sprintf("fewer than %d processes in uninterruptible sleep for %v", pc.config.DStateThreshold, pc.config.DStateDuration)
+}
+
+// conditions returns the enabled conditions.
+func (pc *processCollector) conditions() []types.Condition {
+	var conditions []types.Condition
+	for _, condition := range []*types.Condition{pc.zombieCondition, pc.dStateCondition} {
+		if condition != nil {
+			conditions = append(conditions, *condition)
+		}
+	}
+	return conditions
+}
+
+// initialStatus returns the initial process conditions, or nil if no condition is enabled.
+func (pc *processCollector) initialStatus() *types.Status {
+	if pc == nil || (pc.zombieCondition == nil && pc.dStateCondition == nil) {
+		return nil
+	}
+	return &types.Status{
+		Source:     SystemStatsMonitorName,
+		Conditions: pc.conditions(),
+	}
+}
+
+// collect records the metrics, and returns a new status when a process condition changes.
+func (pc *processCollector) collect() *types.Status {
+	if pc == nil {
+		return nil
+	}
+	tasks, err := readTasks(pc.procPath)
+	if err != nil {
+		glog.Errorf("Failed to retrieve the processes: %v", err)
+		return nil
+	}
+	return pc.update(tasks, time.Now())
+}
+
+// update tracks the ages of the zombie processes and the tasks in uninterruptible sleep,
+// records the metrics, and returns a new status if any condition changes.
+func (pc *processCollector) update(tasks []task, now time.Time) *types.Status {
+	names := make(map[int]string)
+	for _, t := range tasks {
+		if t.tid == t.pid {
+			names[t.pid] = t.comm
+		}
+	}
+
+	seen := make(map[taskKey]seenState)
+	var zombies, dState []offender
+	for _, t := range tasks {
+		// A zombie process is reported once, by its main thread.
+		if !(t.state == 'Z' && t.tid == t.pid) && t.state != 'D' {
+			continue
+		}
+		key := taskKey{tid: t.tid, startTime: t.startTime}
+		s, ok := pc.seen[key]
+		if !ok || s.state != t.state {
+			s = seenState{state: t.state, since: now}
+		}
+		seen[key] = s
+		o := offender{task: t, age: now.Sub(s.since)}
+		if t.state == 'Z' {
+			o.parent = names[t.ppid]
+			zombies = append(zombies, o)
+		} else {
+			dState = append(dState, o)
+		}
+	}
+	pc.seen = seen
+
+	for state, offenders := range map[string][]offender{zombieState: zombies, uninterruptibleState: dState} {
+		if pc.mCount != nil {
+			pc.mCount.Record(map[string]string{stateLabel: state}, int64(len(offenders)))
+		}
+		if pc.mOldestAge != nil {
+			var oldest time.Duration
+			for _, o := range offenders {
+				if o.age > oldest {
+					oldest = o.age
+				}
+			}
+			pc.mOldestAge.Record(map[string]string{stateLabel: state}, oldest.Seconds())
+		}
+	}
+
+	var stuck []offender
+	for _, o := range dState {
+		if o.age >= pc.config.DStateDuration {
+			stuck = append(stuck, o)
+		}
+	}
+
+	var events []types.Event
+	changed := false
+	if pc.zombieCondition != nil {
+		problem := ""
+		if len(zombies) >= pc.config.ZombieThreshold {
+			problem = fmt.Sprintf("%d zombie processes, threshold is %d: %s",
+				len(zombies), pc.config.ZombieThreshold, pc.describe(zombies))
+		}
+		if event, ok := updateCondition(pc.zombieCondition, problem, pc.zombieNormalMessage(), now); ok {
+			events = append(events, event...)
+			changed = true
+		}
+	}
+	if pc.dStateCondition != nil {
+		problem := ""
+		if len(stuck) >= pc.config.DStateThreshold {
+			problem = fmt.Sprintf("%d processes in uninterruptible sleep for %v, threshold is %d: %s",
+				len(stuck), pc.config.DStateDuration, pc.config.DStateThreshold, pc.describe(stuck))
+		}
+		if event, ok := updateCondition(pc.dStateCondition, problem, pc.dStateNormalMessage(), now); ok {
+			events = append(events, event...)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return &types.Status{
+		Source:     SystemStatsMonitorName,
+		Events:     events,
+		Conditions: pc.conditions(),
+	}
+}
+
+// describe lists the oldest offenders, up to MaxListedProcesses of them.
+func (pc *processCollector) describe(offenders []offender) string {
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].age != offenders[j].age {
+			return offenders[i].age > offenders[j].age
+		}
+		return offenders[i].tid < offenders[j].tid
+	})
+	var descriptions []string
+	for i, o := range offenders {
+		if i == pc.config.MaxListedProcesses {
+			descriptions = append(descriptions, fmt.Sprintf("and %d more", len(offenders)-i))
+			break
+		}
+		descriptions = append(descriptions, pc.describeOffender(o))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func (pc *processCollector) describeOffender(o offender) string {
+	id := fmt.Sprintf("pid %d", o.pid)
+	if o.tid != o.pid {
+		id += fmt.Sprintf(", tid %d", o.tid)
+	}
+	if o.state == 'Z' {
+		parent := o.parent
+		if parent == "" {
+			parent = "unknown"
+		}
+		id += fmt.Sprintf(", parent %s pid %d", parent, o.ppid)
+	}
+	description := fmt.Sprintf("%s (%s)", o.comm, id)
+	if o.state == 'D' {
+		if wchan := readWchan(pc.procPath, o.task); wchan != "" {
+			description += " in " + wchan
+		}
+	}
+	return fmt.Sprintf("%s for %v", description, o.age.Round(time.Second))
+}
+
+// updateCondition sets the condition to True with the problem message, or to False if
+// the problem is empty. It returns the condition change events, and whether the condition
+// changed.
+func updateCondition(condition *types.Condition, problem, normalMessage string, now time.Time) ([]types.Event, bool) {
+	status, reason, message := types.False, "No"+condition.Type, normalMessage
+	if problem != "" {
+		status, reason, message = types.True, condition.Type, problem
+	}
+	var events []types.Event
+	if status != condition.Status {
+		condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(condition.Type, status, reason, now))
+	} else if message == condition.Message {
+		return nil, false
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+	return events, true
+}
+
+// readTasks reads the threads of all processes. Processes and threads which exit while
+// they are read are skipped.
+func readTasks(procPath string) ([]task, error) {
+	paths, err := filepath.Glob(filepath.Join(procPath, "[0-9]*", "task", "[0-9]*", "stat"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no process found in %q", procPath)
+	}
+	var tasks []task
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			glog.V(4).Infof("Failed to read %q: %v", path, err)
+			continue
+		}
+		t, err := parseTaskStat(string(data))
+		if err != nil {
+			glog.Errorf("Failed to parse %q: %v", path, err)
+			continue
+		}
+		t.pid, err = strconv.Atoi(filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(path)))))
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// parseTaskStat parses the stat file of a task, in the format of
+// "<tid> (<comm>) <state> <ppid> ...", where the start time is the 22nd field. The comm
+// may contain spaces and parentheses, so it ends at the last parenthesis.
+func parseTaskStat(stat string) (task, error) {
+	open := strings.IndexByte(stat, '(')
+	end := strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return task{}, fmt.Errorf("invalid stat %q", stat)
+	}
+	tid, err := strconv.Atoi(strings.TrimSpace(stat[:open]))
+	if err != nil {
+		return task{}, fmt.Errorf("invalid tid in stat %q: %v", stat, err)
+	}
+	fields := strings.Fields(stat[end+1:])
+	// The fields after the comm start with the 3rd field, the state.
+	if len(fields) < 20 || len(fields[0]) != 1 {
+		return task{}, fmt.Errorf("invalid stat %q", stat)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return task{}, fmt.Errorf("invalid ppid in stat %q: %v", stat, err)
+	}
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return task{}, fmt.Errorf("invalid start time in stat %q: %v", stat, err)
+	}
+	return task{
+		tid:       tid,
+		ppid:      ppid,
+		comm:      stat[open+1 : end],
+		state:     fields[0][0],
+		startTime: startTime,
+	}, nil
+}
+
+// readWchan reads the kernel function the task waits in, empty if it is unknown.
+func readWchan(procPath string, t task) string {
+	data, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(t.pid), "task", strconv.Itoa(t.tid), "wchan"))
+	if err != nil {
+		return ""
+	}
+	wchan := strings.TrimSpace(string(data))
+	if wchan == "0" {
+		return ""
+	}
+	return wchan
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// taskStat returns the content of /proc/<pid>/task/<tid>/stat.
+func taskStat(tid int, comm string, state byte, ppid int, startTime uint64) string {
+	return fmt.Sprintf("%d (%s) %c %d 1 1 0 -1 4194560 100 0 0 0 5 3 0 0 20 0 1 0 %d 1000 100 18446744073709551615\n",
+		tid, comm, state, ppid, startTime)
+}
+
+func TestReadTasks(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+
+	writeProcFile(t, procPath, "10/task/10/stat", taskStat(10, "containerd-shim", 'S', 1, 100))
+	writeProcFile(t, procPath, "20/task/20/stat", taskStat(20, "my (app)", 'Z', 10, 200))
+	writeProcFile(t, procPath, "30/task/30/stat", taskStat(30, "kubelet", 'S', 1, 300))
+	writeProcFile(t, procPath, "30/task/31/stat", taskStat(31, "kubelet", 'D', 1, 310))
+	writeProcFile(t, procPath, "30/task/31/wchan", "nfs_wait_bit_killable")
+	writeProcFile(t, procPath, "40/task/40/stat", "40 (broken")
+
+	tasks, err := readTasks(procPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []task{
+		{pid: 10, tid: 10, ppid: 1, comm: "containerd-shim", state: 'S', startTime: 100},
+		{pid: 20, tid: 20, ppid: 10, comm: "my (app)", state: 'Z', startTime: 200},
+		{pid: 30, tid: 30, ppid: 1, comm: "kubelet", state: 'S', startTime: 300},
+		{pid: 30, tid: 31, ppid: 1, comm: "kubelet", state: 'D', startTime: 310},
+	}, tasks)
+	assert.Equal(t, "nfs_wait_bit_killable", readWchan(procPath, tasks[3]))
+	assert.Equal(t, "", readWchan(procPath, tasks[2]))
+
+	_, err = readTasks(procPath + "/none")
+	assert.Error(t, err)
+}
+
+func TestProcessConditions(t *testing.T) {
+	procPath, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(procPath)
+	writeProcFile(t, procPath, "30/task/31/wchan", "nfs_wait_bit_killable")
+
+	pc := NewProcessCollectorOrDie(&ssmtypes.ProcessStatsConfig{
+		ZombieThreshold:    2,
+		DStateThreshold:    1,
+		DStateDuration:     2 * time.Minute,
+		MaxListedProcesses: 1,
+	})
+	pc.procPath = procPath
+
+	status := pc.initialStatus()
+	if assert.NotNil(t, status) {
+		assert.Len(t, status.Conditions, 2)
+		assert.Equal(t, zombieProcessesCondition, status.Conditions[0].Type)
+		assert.Equal(t, dStateProcessesCondition, status.Conditions[1].Type)
+	}
+
+	shim := task{pid: 10, tid: 10, ppid: 1, comm: "containerd-shim", state: 'S', startTime: 100}
+	zombie := func(pid int, startTime uint64) task {
+		return task{pid: pid, tid: pid, ppid: 10, comm: "app", state: 'Z', startTime: startTime}
+	}
+	blocked := task{pid: 30, tid: 31, ppid: 1, comm: "kubelet", state: 'D', startTime: 310}
+	start := time.Now()
+
+	assert.Nil(t, pc.update([]task{shim, zombie(20, 200), blocked}, start), "no condition should change")
+
+	status = pc.update([]task{shim, zombie(20, 200), zombie(21, 210), blocked}, start.Add(time.Minute))
+	if assert.NotNil(t, status) {
+		assert.Len(t, status.Events, 1)
+		assert.Equal(t, types.True, status.Conditions[0].Status)
+		assert.Equal(t, zombieProcessesCondition, status.Conditions[0].Reason)
+		assert.Equal(t, "2 zombie processes, threshold is 2: app (pid 20, parent containerd-shim pid 10) for 1m0s, and 1 more",
+			status.Conditions[0].Message)
+		assert.Equal(t, types.False, status.Conditions[1].Status)
+	}
+
+	// The thread has been in uninterruptible sleep for 2 minutes, and the zombie reaped
+	// and its pid reused by another zombie is new.
+	status = pc.update([]task{shim, zombie(20, 250), blocked}, start.Add(2*time.Minute))
+	if assert.NotNil(t, status) {
+		assert.Len(t, status.Events, 2)
+		assert.Equal(t, types.False, status.Conditions[0].Status)
+		assert.Equal(t, types.True, status.Conditions[1].Status)
+		assert.Equal(t, "1 processes in uninterruptible sleep for 2m0s, threshold is 1: kubelet (pid 30, tid 31) in nfs_wait_bit_killable for 2m0s",
+			status.Conditions[1].Message)
+	}
+
+	// The thread woke up, its age is reset.
+	blocked.state = 'S'
+	assert.NotNil(t, pc.update([]task{shim, blocked}, start.Add(3*time.Minute)))
+	blocked.state = 'D'
+	status = pc.update([]task{shim, blocked}, start.Add(4*time.Minute))
+	assert.Nil(t, status, "the thread is not stuck anymore")
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+// edacDeviceErrors is the cumulative number of errors of an EDAC device block, e.g. the L2
+// cache of a CPU cluster.
+type edacDeviceErrors struct {
+	// device is "<controller>/<instance>/<block>", or "<controller>/<instance>" for
+	// instances without blocks.
+	device        string
+	correctable   uint64
+	uncorrectable uint64
+}
+
+// bootErrors is the state of the errors the firmware recorded before the last boot, e.g.
+// an SError which reset an ARM64 server.
+type bootErrors struct {
+	correctable   bool
+	uncorrectable bool
+}
+
+type rasCollector struct {
+	mHardwareErrors *metrics.Int64Metric
+	mBootErrors     *metrics.Int64Metric
+
+	// edacPath is the EDAC directory in sysfs.
+	edacPath string
+	// bertPath is the data of the ACPI Boot Error Record Table in sysfs.
+	bertPath string
+}
+
+// NewRASCollectorOrDie creates the collector of the hardware errors reported by the RAS
+// (reliability, availability and serviceability) features outside the machine check
+// architecture of x86, i.e. the EDAC devices of the CPU caches and interconnects, and the
+// firmware error records of ARM64 servers.
+func NewRASCollectorOrDie(rasConfig *ssmtypes.RASStatsConfig) *rasCollector {
+	rc := rasCollector{
+		edacPath: "/sys/devices/system/edac",
+		bertPath: "/sys/firmware/acpi/tables/data/BERT",
+	}
+
+	var err error
+
+	rc.mHardwareErrors, err = metrics.NewInt64Metric(
+		metrics.RASHardwareErrorCountID,
+		rasConfig.MetricsConfigs[string(metrics.RASHardwareErrorCountID)].DisplayName,
+		"Cumulative number of hardware errors of each EDAC device since boot, by type",
+		"1",
+		metrics.LastValue,
+		[]string{deviceNameLabel, errorTypeLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.RASHardwareErrorCountID, err)
+	}
+
+	rc.mBootErrors, err = metrics.NewInt64Metric(
+		metrics.RASBootErrorsID,
+		rasConfig.MetricsConfigs[string(metrics.RASBootErrorsID)].DisplayName,
+		"Whether the firmware recorded hardware errors before the last boot, by type",
+		"1",
+		metrics.LastValue,
+		[]string{errorTypeLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.RASBootErrorsID, err)
+	}
+
+	return &rc
+}
+
+func (rc *rasCollector) collect() {
+	if rc == nil {
+		return
+	}
+
+	devices, err := readEdacDevices(rc.edacPath)
+	if err != nil {
+		glog.Errorf("Failed to retrieve EDAC device errors: %v", err)
+	}
+	if rc.mHardwareErrors != nil {
+		for _, d := range devices {
+			rc.mHardwareErrors.Record(map[string]string{deviceNameLabel: d.device, errorTypeLabel: "correctable"}, int64(d.correctable))
+			rc.mHardwareErrors.Record(map[string]string{deviceNameLabel: d.device, errorTypeLabel: "uncorrectable"}, int64(d.uncorrectable))
+		}
+	}
+
+	boot, ok, err := readBootErrors(rc.bertPath)
+	if err != nil {
+		glog.Errorf("Failed to retrieve boot error records: %v", err)
+	}
+	if ok && rc.mBootErrors != nil {
+		rc.mBootErrors.Record(map[string]string{errorTypeLabel: "correctable"}, boolToInt64(boot.correctable))
+		rc.mBootErrors.Record(map[string]string{errorTypeLabel: "uncorrectable"}, boolToInt64(boot.uncorrectable))
+	}
+}
+
+func boolToInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// readEdacDevices reads the error counts of the EDAC devices, laid out in sysfs as
+// "<controller>/<instance>/<block>/{ce,ue}_count". The counts of an instance are read
+// when it has no blocks. The memory controllers and PCI are left to the memory error
+// monitor and the kernel log.
+func readEdacDevices(edacPath string) ([]edacDeviceErrors, error) {
+	instances, err := filepath.Glob(filepath.Join(edacPath, "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var devices []edacDeviceErrors
+	for _, instance := range instances {
+		controller := filepath.Base(filepath.Dir(instance))
+		if controller == "mc" || controller == "pci" {
+			continue
+		}
+		blocks, err := filepath.Glob(filepath.Join(instance, "*", "ce_count"))
+		if err != nil {
+			return nil, err
+		}
+		dirs := []string{instance}
+		if len(blocks) > 0 {
+			dirs = nil
+			for _, block := range blocks {
+				dirs = append(dirs, filepath.Dir(block))
+			}
+		}
+		for _, dir := range dirs {
+			// The controllers also contain files, e.g. the polling settings.
+			if _, err := os.Stat(filepath.Join(dir, "ce_count")); err != nil {
+				continue
+			}
+			rel, err := filepath.Rel(edacPath, dir)
+			if err != nil {
+				return nil, err
+			}
+			d := edacDeviceErrors{device: filepath.ToSlash(rel)}
+			if d.correctable, err = readUint(filepath.Join(dir, "ce_count")); err != nil {
+				return nil, err
+			}
+			if d.uncorrectable, err = readUint(filepath.Join(dir, "ue_count")); err != nil {
+				return nil, err
+			}
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q: %v", path, err)
+	}
+	return count, nil
+}
+
+// The bits of the block status of an ACPI generic error status block.
+const (
+	uncorrectableValid = 1 << 0
+	correctableValid   = 1 << 1
+)
+
+// readBootErrors reads the errors the firmware recorded before the last boot from the
+// ACPI Boot Error Record Table, whose data is a generic error status block starting with
+// the 32-bit block status. ok is false when the firmware has no such table.
+func readBootErrors(bertPath string) (boot bootErrors, ok bool, err error) {
+	data, err := ioutil.ReadFile(bertPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return bootErrors{}, false, nil
+		}
+		return bootErrors{}, false, err
+	}
+	if len(data) < 4 {
+		return bootErrors{}, false, fmt.Errorf("boot error region %q is too short: %d bytes", bertPath, len(data))
+	}
+	status := binary.LittleEndian.Uint32(data[:4])
+	return bootErrors{
+		correctable:   status&correctableValid != 0,
+		uncorrectable: status&uncorrectableValid != 0,
+	}, true, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadEdacDevices(t *testing.T) {
+	edacPath, err := ioutil.TempDir("", "edac")
+	assert.NoError(t, err)
+	defer os.RemoveAll(edacPath)
+
+	// The memory controllers are left to the memory error monitor.
+	writeProcFile(t, edacPath, "mc/mc0/ce_count", "5\n")
+	writeProcFile(t, edacPath, "mc/mc0/ue_count", "0\n")
+	// The L1 and L2 caches of a CPU, and an instance without blocks.
+	writeProcFile(t, edacPath, "cpu_cache/cpu0/L1/ce_count", "3\n")
+	writeProcFile(t, edacPath, "cpu_cache/cpu0/L1/ue_count", "0\n")
+	writeProcFile(t, edacPath, "cpu_cache/cpu0/L2/ce_count", "0\n")
+	writeProcFile(t, edacPath, "cpu_cache/cpu0/L2/ue_count", "1\n")
+	writeProcFile(t, edacPath, "cpu_cache/poll_msec", "1000\n")
+	writeProcFile(t, edacPath, "soc/ccache0/ce_count", "7\n")
+	writeProcFile(t, edacPath, "soc/ccache0/ue_count", "0\n")
+
+	devices, err := readEdacDevices(edacPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []edacDeviceErrors{
+		{device: "cpu_cache/cpu0/L1", correctable: 3},
+		{device: "cpu_cache/cpu0/L2", uncorrectable: 1},
+		{device: "soc/ccache0", correctable: 7},
+	}, devices)
+
+	writeProcFile(t, edacPath, "soc/ccache0/ue_count", "invalid\n")
+	_, err = readEdacDevices(edacPath)
+	assert.Error(t, err)
+}
+
+func TestReadBootErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bert")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bertPath := filepath.Join(dir, "BERT")
+
+	_, ok, err := readBootErrors(bertPath)
+	assert.NoError(t, err)
+	assert.False(t, ok, "the firmware has no boot error record table")
+
+	// An uncorrectable error with one error data entry.
+	assert.NoError(t, ioutil.WriteFile(bertPath, []byte{0x11, 0, 0, 0, 0, 0, 0, 0}, 0644))
+	boot, ok, err := readBootErrors(bertPath)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, bootErrors{uncorrectable: true}, boot)
+
+	assert.NoError(t, ioutil.WriteFile(bertPath, []byte{0, 0, 0, 0}, 0644))
+	boot, ok, err = readBootErrors(bertPath)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, bootErrors{}, boot)
+
+	assert.NoError(t, ioutil.WriteFile(bertPath, []byte{0x2}, 0644))
+	_, _, err = readBootErrors(bertPath)
+	assert.Error(t, err)
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package systemstatsmonitor
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"time"
 
@@ -26,6 +25,8 @@ import (
 	"k8s.io/node-problem-detector/pkg/problemdaemon"
 	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
 	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/liveness"
 	"k8s.io/node-problem-detector/pkg/util/tomb"
 )
 
@@ -38,13 +39,19 @@ func init() {
 }
 
 type systemStatsMonitor struct {
-	configPath      string
-	config          ssmtypes.SystemStatsConfig
-	cpuCollector    *cpuCollector
-	diskCollector   *diskCollector
-	hostCollector   *hostCollector
-	memoryCollector *memoryCollector
-	tomb            *tomb.Tomb
+	configPath       string
+	config           ssmtypes.SystemStatsConfig
+	cpuCollector     *cpuCollector
+	diskCollector    *diskCollector
+	hostCollector    *hostCollector
+	memoryCollector  *memoryCollector
+	netCollector     *netCollector
+	osCollector      *osCollector
+	processCollector *processCollector
+	rasCollector     *rasCollector
+	thermalCollector *thermalCollector
+	statusChan       chan *types.Status
+	tomb             *tomb.Tomb
 }
 
 // NewSystemStatsMonitorOrDie creates a system stats monitor.
@@ -59,7 +66,7 @@ func NewSystemStatsMonitorOrDie(configPath string) types.Monitor {
 	if err != nil {
 		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
 	}
-	err = json.Unmarshal(f, &ssm.config)
+	err = util.UnmarshalStrict(f, &ssm.config)
 	if err != nil {
 		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
 	}
@@ -86,13 +93,33 @@ func NewSystemStatsMonitorOrDie(configPath string) types.Monitor {
 	if len(ssm.config.MemoryConfig.MetricsConfigs) > 0 {
 		ssm.memoryCollector = NewMemoryCollectorOrDie(&ssm.config.MemoryConfig)
 	}
+	if len(ssm.config.NetConfig.MetricsConfigs) > 0 || ssm.config.NetConfig.HasConntrackCondition() {
+		ssm.netCollector = NewNetCollectorOrDie(&ssm.config.NetConfig)
+	}
+	if len(ssm.config.OSConfig.MetricsConfigs) > 0 || ssm.config.OSConfig.HasPressureConditions() {
+		ssm.osCollector = NewOSCollectorOrDie(&ssm.config.OSConfig)
+	}
+	if len(ssm.config.ProcessConfig.MetricsConfigs) > 0 || ssm.config.ProcessConfig.HasProcessConditions() {
+		ssm.processCollector = NewProcessCollectorOrDie(&ssm.config.ProcessConfig)
+	}
+	if len(ssm.config.RASConfig.MetricsConfigs) > 0 {
+		ssm.rasCollector = NewRASCollectorOrDie(&ssm.config.RASConfig)
+	}
+	if len(ssm.config.ThermalConfig.MetricsConfigs) > 0 || ssm.config.ThermalConfig.HasThrottlingCondition() {
+		ssm.thermalCollector = NewThermalCollectorOrDie(&ssm.config.ThermalConfig)
+	}
+	if ssm.config.NetConfig.HasConntrackCondition() || ssm.config.OSConfig.HasPressureConditions() ||
+		ssm.config.ProcessConfig.HasProcessConditions() || ssm.config.ThermalConfig.HasThrottlingCondition() {
+		// A 1000 size channel should be big enough.
+		ssm.statusChan = make(chan *types.Status, 1000)
+	}
 	return &ssm
 }
 
 func (ssm *systemStatsMonitor) Start() (<-chan *types.Status, error) {
 	glog.Infof("Start system stats monitor %s", ssm.configPath)
-	go ssm.monitorLoop()
-	return nil, nil
+	problemdaemon.Go(ssm, ssm.monitorLoop)
+	return ssm.statusChan, nil
 }
 
 func (ssm *systemStatsMonitor) monitorLoop() {
@@ -101,24 +128,31 @@ func (ssm *systemStatsMonitor) monitorLoop() {
 	runTicker := time.NewTicker(ssm.config.InvokeInterval)
 	defer runTicker.Stop()
 
+	if status := ssm.netCollector.initialStatus(); status != nil {
+		ssm.statusChan <- status
+	}
+	if status := ssm.osCollector.initialStatus(); status != nil {
+		ssm.statusChan <- status
+	}
+	if status := ssm.processCollector.initialStatus(); status != nil {
+		ssm.statusChan <- status
+	}
+	if status := ssm.thermalCollector.initialStatus(); status != nil {
+		ssm.statusChan <- status
+	}
+
 	select {
 	case <-ssm.tomb.Stopping():
 		glog.Infof("System stats monitor stopped: %s", ssm.configPath)
 		return
 	default:
-		ssm.cpuCollector.collect()
-		ssm.diskCollector.collect()
-		ssm.hostCollector.collect()
-		ssm.memoryCollector.collect()
+		ssm.collect()
 	}
 
 	for {
 		select {
 		case <-runTicker.C:
-			ssm.cpuCollector.collect()
-			ssm.diskCollector.collect()
-			ssm.hostCollector.collect()
-			ssm.memoryCollector.collect()
+			ssm.collect()
 		case <-ssm.tomb.Stopping():
 			glog.Infof("System stats monitor stopped: %s", ssm.configPath)
 			return
@@ -126,7 +160,34 @@ func (ssm *systemStatsMonitor) monitorLoop() {
 	}
 }
 
+func (ssm *systemStatsMonitor) collect() {
+	ssm.cpuCollector.collect()
+	ssm.diskCollector.collect()
+	ssm.hostCollector.collect()
+	ssm.memoryCollector.collect()
+	ssm.rasCollector.collect()
+	if status := ssm.netCollector.collect(); status != nil {
+		ssm.statusChan <- status
+	}
+	if status := ssm.osCollector.collect(); status != nil {
+		ssm.statusChan <- status
+	}
+	if status := ssm.processCollector.collect(); status != nil {
+		ssm.statusChan <- status
+	}
+	if status := ssm.thermalCollector.collect(); status != nil {
+		ssm.statusChan <- status
+	}
+	// Collection is considered stalled if it misses two rounds.
+	liveness.Beat(ssm.livenessName(), 3*ssm.config.InvokeInterval)
+}
+
+func (ssm *systemStatsMonitor) livenessName() string {
+	return SystemStatsMonitorName + ":" + ssm.configPath
+}
+
 func (ssm *systemStatsMonitor) Stop() {
 	glog.Infof("Stop system stats monitor %s", ssm.configPath)
 	ssm.tomb.Stop()
+	liveness.Forget(ssm.livenessName())
 }
@@ -0,0 +1,430 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/metrics"
+)
+
+const (
+	thermalThrottlingCondition = "ThermalThrottling"
+	noThermalThrottlingReason  = "NoThermalThrottling"
+)
+
+// zoneTemperature is the temperature of a thermal zone.
+type zoneTemperature struct {
+	zone     string
+	zoneType string
+	// celsius is the temperature in degrees Celsius.
+	celsius float64
+}
+
+// cpuThrottles is the cumulative number of times a CPU was throttled since boot.
+type cpuThrottles struct {
+	core    uint64
+	pkg     uint64
+	hasCore bool
+	hasPkg  bool
+}
+
+// cpuFrequency is the frequency of a CPU, in Hz.
+type cpuFrequency struct {
+	current uint64
+	max     uint64
+}
+
+// raplEnergy is the energy counter of a RAPL power zone.
+type raplEnergy struct {
+	zoneType string
+	// energy is the energy consumed in microjoules, which wraps around at maxEnergy.
+	energy    uint64
+	maxEnergy uint64
+	time      time.Time
+}
+
+// thermalStats is the thermal state collected in a round.
+type thermalStats struct {
+	// zones is nil if the temperatures were not collected.
+	zones []zoneTemperature
+	// throttles are the throttle counts of each CPU, nil if they were not collected.
+	throttles map[string]cpuThrottles
+}
+
+type thermalCollector struct {
+	mZoneTemperature *metrics.Float64Metric
+	mCPUThrottles    *metrics.Int64Metric
+	mCPUFrequency    *metrics.Int64Metric
+	mRAPLPower       *metrics.Float64Metric
+
+	config *ssmtypes.ThermalStatsConfig
+
+	// sysPath is the mount point of sysfs.
+	sysPath string
+
+	// lastThrottles are the throttle counts of the last round, which the throttling
+	// since the last round is counted from.
+	lastThrottles map[string]cpuThrottles
+	// lastEnergy are the RAPL energy counters of the last round, which the power is
+	// computed from.
+	lastEnergy map[string]raplEnergy
+
+	// condition is the ThermalThrottling condition, nil if it is disabled.
+	condition *types.Condition
+}
+
+// NewThermalCollectorOrDie creates the collector of the temperatures of the thermal zones,
+// the CPU frequency and throttling, and the RAPL power readings.
+func NewThermalCollectorOrDie(thermalConfig *ssmtypes.ThermalStatsConfig) *thermalCollector {
+	tc := thermalCollector{
+		config:  thermalConfig,
+		sysPath: "/sys",
+	}
+
+	var err error
+
+	tc.mZoneTemperature, err = metrics.NewFloat64Metric(
+		metrics.ThermalZoneTempID,
+		thermalConfig.MetricsConfigs[string(metrics.ThermalZoneTempID)].DisplayName,
+		"Temperature of each thermal zone",
+		"Cel",
+		metrics.LastValue,
+		[]string{zoneLabel, zoneTypeLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.ThermalZoneTempID, err)
+	}
+
+	tc.mCPUThrottles, err = metrics.NewInt64Metric(
+		metrics.ThermalCPUThrottlesID,
+		thermalConfig.MetricsConfigs[string(metrics.ThermalCPUThrottlesID)].DisplayName,
+		"Cumulative number of times each CPU was throttled for its temperature since boot, by level",
+		"1",
+		metrics.LastValue,
+		[]string{cpuLabel, throttleLevelLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.ThermalCPUThrottlesID, err)
+	}
+
+	tc.mCPUFrequency, err = metrics.NewInt64Metric(
+		metrics.ThermalCPUFrequencyID,
+		thermalConfig.MetricsConfigs[string(metrics.ThermalCPUFrequencyID)].DisplayName,
+		"Frequency of each CPU, by state",
+		"Hz",
+		metrics.LastValue,
+		[]string{cpuLabel, stateLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.ThermalCPUFrequencyID, err)
+	}
+
+	tc.mRAPLPower, err = metrics.NewFloat64Metric(
+		metrics.ThermalRAPLPowerID,
+		thermalConfig.MetricsConfigs[string(metrics.ThermalRAPLPowerID)].DisplayName,
+		"Average power of each RAPL power zone since the last collection",
+		"W",
+		metrics.LastValue,
+		[]string{zoneLabel, zoneTypeLabel})
+	if err != nil {
+		glog.Fatalf("Error initializing metric for %q: %v", metrics.ThermalRAPLPowerID, err)
+	}
+
+	if thermalConfig.HasThrottlingCondition() {
+		tc.condition = &types.Condition{
+			Type:       thermalThrottlingCondition,
+			Status:     types.False,
+			Transition: time.Now(),
+			Reason:     noThermalThrottlingReason,
+			Message:    tc.normalMessage(),
+		}
+	}
+	return &tc
+}
+
+func (tc *thermalCollector) normalMessage() string {
+	var limits []string
+	if tc.config.TemperatureThreshold > 0 {
+		limits = append(limits, fmt.Sprintf("thermal zones are below %v°C", tc.config.TemperatureThreshold))
+	}
+	if tc.config.ThrottleCountThreshold > 0 {
+		limits = append(limits, fmt.Sprintf("CPUs were throttled less than %d times since the last collection", tc.config.ThrottleCountThreshold))
+	}
+	return strings.Join(limits, ", ")
+}
+
+// initialStatus returns the initial ThermalThrottling condition, or nil if it is disabled.
+func (tc *thermalCollector) initialStatus() *types.Status {
+	if tc == nil || tc.condition == nil {
+		return nil
+	}
+	return &types.Status{
+		Source:     SystemStatsMonitorName,
+		Conditions: []types.Condition{*tc.condition},
+	}
+}
+
+// collect records the metrics, and returns a new status when the ThermalThrottling
+// condition changes.
+func (tc *thermalCollector) collect() *types.Status {
+	if tc == nil {
+		return nil
+	}
+	now := time.Now()
+
+	var stats thermalStats
+	zones, err := readThermalZones(filepath.Join(tc.sysPath, "class/thermal"))
+	if err != nil {
+		glog.Errorf("Failed to retrieve thermal zone temperatures: %v", err)
+	} else {
+		stats.zones = zones
+		if tc.mZoneTemperature != nil {
+			for _, z := range zones {
+				tc.mZoneTemperature.Record(map[string]string{zoneLabel: z.zone, zoneTypeLabel: z.zoneType}, z.celsius)
+			}
+		}
+	}
+
+	cpuPath := filepath.Join(tc.sysPath, "devices/system/cpu")
+	throttles, err := readCPUThrottles(cpuPath)
+	if err != nil {
+		glog.Errorf("Failed to retrieve CPU throttle counts: %v", err)
+	} else {
+		stats.throttles = throttles
+		if tc.mCPUThrottles != nil {
+			for cpu, t := range throttles {
+				if t.hasCore {
+					tc.mCPUThrottles.Record(map[string]string{cpuLabel: cpu, throttleLevelLabel: "core"}, int64(t.core))
+				}
+				if t.hasPkg {
+					tc.mCPUThrottles.Record(map[string]string{cpuLabel: cpu, throttleLevelLabel: "package"}, int64(t.pkg))
+				}
+			}
+		}
+	}
+
+	if tc.mCPUFrequency != nil {
+		frequencies, err := readCPUFrequencies(cpuPath)
+		if err != nil {
+			glog.Errorf("Failed to retrieve CPU frequencies: %v", err)
+		}
+		for cpu, f := range frequencies {
+			tc.mCPUFrequency.Record(map[string]string{cpuLabel: cpu, stateLabel: "current"}, int64(f.current))
+			tc.mCPUFrequency.Record(map[string]string{cpuLabel: cpu, stateLabel: "max"}, int64(f.max))
+		}
+	}
+
+	if tc.mRAPLPower != nil {
+		energy, err := readRAPLEnergy(filepath.Join(tc.sysPath, "class/powercap"), now)
+		if err != nil {
+			glog.Errorf("Failed to retrieve RAPL energy counters: %v", err)
+		} else {
+			for zone, power := range raplPower(tc.lastEnergy, energy) {
+				tc.mRAPLPower.Record(map[string]string{zoneLabel: zone, zoneTypeLabel: energy[zone].zoneType}, power)
+			}
+			tc.lastEnergy = energy
+		}
+	}
+
+	return tc.updateCondition(&stats, now)
+}
+
+// updateCondition evaluates the thresholds, and returns a new status if the
+// ThermalThrottling condition changes. The condition is kept when neither the
+// temperatures nor the throttle counts were collected.
+func (tc *thermalCollector) updateCondition(stats *thermalStats, now time.Time) *types.Status {
+	last := tc.lastThrottles
+	if stats.throttles != nil {
+		tc.lastThrottles = stats.throttles
+	}
+	if tc.condition == nil || (stats.zones == nil && stats.throttles == nil) {
+		return nil
+	}
+
+	var problems []string
+	if tc.config.TemperatureThreshold > 0 {
+		for _, z := range stats.zones {
+			if z.celsius >= tc.config.TemperatureThreshold {
+				problems = append(problems, fmt.Sprintf("%s (%s) is at %.1f°C", z.zone, z.zoneType, z.celsius))
+			}
+		}
+	}
+	if tc.config.ThrottleCountThreshold > 0 && last != nil {
+		for cpu, t := range stats.throttles {
+			l, ok := last[cpu]
+			if !ok {
+				continue
+			}
+			if n := increase(l.core, t.core) + increase(l.pkg, t.pkg); n >= tc.config.ThrottleCountThreshold {
+				problems = append(problems, fmt.Sprintf("%s was throttled %d times", cpu, n))
+			}
+		}
+	}
+	sort.Strings(problems)
+
+	status, reason, message := types.False, noThermalThrottlingReason, tc.normalMessage()
+	if len(problems) > 0 {
+		status, reason, message = types.True, thermalThrottlingCondition, strings.Join(problems, ", ")
+	}
+	var events []types.Event
+	if status != tc.condition.Status {
+		tc.condition.Transition = now
+		events = append(events, util.GenerateConditionChangeEvent(tc.condition.Type, status, reason, now))
+	} else if message == tc.condition.Message {
+		return nil
+	}
+	tc.condition.Status = status
+	tc.condition.Reason = reason
+	tc.condition.Message = message
+	return &types.Status{
+		Source:     SystemStatsMonitorName,
+		Events:     events,
+		Conditions: []types.Condition{*tc.condition},
+	}
+}
+
+// increase returns the increase of a counter, or 0 if the counter was reset.
+func increase(last, current uint64) uint64 {
+	if current < last {
+		return 0
+	}
+	return current - last
+}
+
+// readThermalZones reads the temperatures of the thermal zones in /sys/class/thermal.
+// Zones whose sensor can not be read, e.g. because it is powered off, are skipped.
+func readThermalZones(thermalPath string) ([]zoneTemperature, error) {
+	dirs, err := filepath.Glob(filepath.Join(thermalPath, "thermal_zone[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	zones := []zoneTemperature{}
+	for _, dir := range dirs {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "temp"))
+		if err != nil {
+			glog.V(4).Infof("Failed to read the temperature of %q: %v", dir, err)
+			continue
+		}
+		milliCelsius, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the temperature of %q: %v", dir, err)
+		}
+		zoneType, _ := ioutil.ReadFile(filepath.Join(dir, "type"))
+		zones = append(zones, zoneTemperature{
+			zone:     filepath.Base(dir),
+			zoneType: strings.TrimSpace(string(zoneType)),
+			celsius:  float64(milliCelsius) / 1000,
+		})
+	}
+	return zones, nil
+}
+
+// readCPUThrottles reads the throttle counts of each CPU from
+// /sys/devices/system/cpu/cpu*/thermal_throttle, which only x86 CPUs have.
+func readCPUThrottles(cpuPath string) (map[string]cpuThrottles, error) {
+	dirs, err := filepath.Glob(filepath.Join(cpuPath, "cpu[0-9]*", "thermal_throttle"))
+	if err != nil {
+		return nil, err
+	}
+	throttles := make(map[string]cpuThrottles)
+	for _, dir := range dirs {
+		var t cpuThrottles
+		if t.core, err = readUint(filepath.Join(dir, "core_throttle_count")); err == nil {
+			t.hasCore = true
+		}
+		if t.pkg, err = readUint(filepath.Join(dir, "package_throttle_count")); err == nil {
+			t.hasPkg = true
+		}
+		if t.hasCore || t.hasPkg {
+			throttles[filepath.Base(filepath.Dir(dir))] = t
+		}
+	}
+	return throttles, nil
+}
+
+// readCPUFrequencies reads the current and maximum frequency of each CPU from cpufreq,
+// which reports them in kHz.
+func readCPUFrequencies(cpuPath string) (map[string]cpuFrequency, error) {
+	dirs, err := filepath.Glob(filepath.Join(cpuPath, "cpu[0-9]*", "cpufreq"))
+	if err != nil {
+		return nil, err
+	}
+	frequencies := make(map[string]cpuFrequency)
+	for _, dir := range dirs {
+		current, err := readUint(filepath.Join(dir, "scaling_cur_freq"))
+		if err != nil {
+			return frequencies, err
+		}
+		max, err := readUint(filepath.Join(dir, "cpuinfo_max_freq"))
+		if err != nil {
+			return frequencies, err
+		}
+		frequencies[filepath.Base(filepath.Dir(dir))] = cpuFrequency{current: current * 1000, max: max * 1000}
+	}
+	return frequencies, nil
+}
+
+// readRAPLEnergy reads the energy counters of the RAPL power zones and their subzones in
+// /sys/class/powercap, e.g. "intel-rapl:0" for a package and "intel-rapl:0:0" for its
+// cores.
+func readRAPLEnergy(powercapPath string, now time.Time) (map[string]raplEnergy, error) {
+	dirs, err := filepath.Glob(filepath.Join(powercapPath, "intel-rapl:*"))
+	if err != nil {
+		return nil, err
+	}
+	energy := make(map[string]raplEnergy)
+	for _, dir := range dirs {
+		e := raplEnergy{time: now}
+		if e.energy, err = readUint(filepath.Join(dir, "energy_uj")); err != nil {
+			return nil, err
+		}
+		if e.maxEnergy, err = readUint(filepath.Join(dir, "max_energy_range_uj")); err != nil {
+			return nil, err
+		}
+		name, _ := ioutil.ReadFile(filepath.Join(dir, "name"))
+		e.zoneType = strings.TrimSpace(string(name))
+		energy[filepath.Base(dir)] = e
+	}
+	return energy, nil
+}
+
+// raplPower returns the average power of each zone in watts between two readings of the
+// energy counters, which wrap around at their maximum.
+func raplPower(last, current map[string]raplEnergy) map[string]float64 {
+	power := make(map[string]float64)
+	for zone, c := range current {
+		l, ok := last[zone]
+		if !ok || !c.time.After(l.time) {
+			continue
+		}
+		consumed := c.energy - l.energy
+		if c.energy < l.energy {
+			consumed = c.maxEnergy - l.energy + c.energy
+		}
+		power[zone] = float64(consumed) / 1e6 / c.time.Sub(l.time).Seconds()
+	}
+	return power
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemstatsmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	ssmtypes "k8s.io/node-problem-detector/pkg/systemstatsmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestReadThermalSysfs(t *testing.T) {
+	sysPath, err := ioutil.TempDir("", "sys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(sysPath)
+
+	writeProcFile(t, sysPath, "class/thermal/thermal_zone0/type", "x86_pkg_temp\n")
+	writeProcFile(t, sysPath, "class/thermal/thermal_zone0/temp", "85500\n")
+	writeProcFile(t, sysPath, "class/thermal/thermal_zone1/type", "acpitz\n")
+	writeProcFile(t, sysPath, "class/thermal/cooling_device0/type", "Processor\n")
+	writeProcFile(t, sysPath, "devices/system/cpu/cpu0/thermal_throttle/core_throttle_count", "3\n")
+	writeProcFile(t, sysPath, "devices/system/cpu/cpu0/thermal_throttle/package_throttle_count", "10\n")
+	writeProcFile(t, sysPath, "devices/system/cpu/cpu0/cpufreq/scaling_cur_freq", "800000\n")
+	writeProcFile(t, sysPath, "devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq", "3600000\n")
+	writeProcFile(t, sysPath, "devices/system/cpu/cpu1/thermal_throttle/core_throttle_count", "0\n")
+
+	// The sensor of thermal_zone1 can not be read.
+	zones, err := readThermalZones(sysPath + "/class/thermal")
+	assert.NoError(t, err)
+	assert.Equal(t, []zoneTemperature{{zone: "thermal_zone0", zoneType: "x86_pkg_temp", celsius: 85.5}}, zones)
+
+	throttles, err := readCPUThrottles(sysPath + "/devices/system/cpu")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]cpuThrottles{
+		"cpu0": {core: 3, pkg: 10, hasCore: true, hasPkg: true},
+		"cpu1": {hasCore: true},
+	}, throttles)
+
+	frequencies, err := readCPUFrequencies(sysPath + "/devices/system/cpu")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]cpuFrequency{"cpu0": {current: 800000000, max: 3600000000}}, frequencies)
+
+	writeProcFile(t, sysPath, "class/thermal/thermal_zone0/temp", "hot\n")
+	_, err = readThermalZones(sysPath + "/class/thermal")
+	assert.Error(t, err)
+}
+
+func TestRAPLPower(t *testing.T) {
+	sysPath, err := ioutil.TempDir("", "sys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(sysPath)
+
+	writeProcFile(t, sysPath, "intel-rapl:0/name", "package-0\n")
+	writeProcFile(t, sysPath, "intel-rapl:0/energy_uj", "1000000\n")
+	writeProcFile(t, sysPath, "intel-rapl:0/max_energy_range_uj", "262143328850\n")
+	writeProcFile(t, sysPath, "intel-rapl:0:0/name", "core\n")
+	writeProcFile(t, sysPath, "intel-rapl:0:0/energy_uj", "262143000000\n")
+	writeProcFile(t, sysPath, "intel-rapl:0:0/max_energy_range_uj", "262143328850\n")
+
+	start := time.Now()
+	last, err := readRAPLEnergy(sysPath, start)
+	assert.NoError(t, err)
+	assert.Equal(t, "package-0", last["intel-rapl:0"].zoneType)
+	assert.Empty(t, raplPower(nil, last), "the power needs two readings")
+
+	// The counter of the cores wraps around.
+	writeProcFile(t, sysPath, "intel-rapl:0/energy_uj", "21000000\n")
+	writeProcFile(t, sysPath, "intel-rapl:0:0/energy_uj", "9671150\n")
+	current, err := readRAPLEnergy(sysPath, start.Add(10*time.Second))
+	assert.NoError(t, err)
+	power := raplPower(last, current)
+	assert.InDelta(t, 2.0, power["intel-rapl:0"], 1e-9)
+	assert.InDelta(t, 1.0, power["intel-rapl:0:0"], 1e-9)
+}
+
+func TestThermalThrottlingCondition(t *testing.T) {
+	tc := NewThermalCollectorOrDie(&ssmtypes.ThermalStatsConfig{TemperatureThreshold: 90, ThrottleCountThreshold: 5})
+	assert.Equal(t, types.False, tc.initialStatus().Conditions[0].Status)
+	now := time.Now()
+
+	zones := []zoneTemperature{{zone: "thermal_zone0", zoneType: "x86_pkg_temp", celsius: 70}}
+	assert.Nil(t, tc.updateCondition(&thermalStats{zones: zones, throttles: map[string]cpuThrottles{"cpu0": {core: 100}}}, now))
+
+	// The throttling is counted since the last collection.
+	status := tc.updateCondition(&thermalStats{zones: zones, throttles: map[string]cpuThrottles{"cpu0": {core: 103, pkg: 2}}}, now)
+	if assert.NotNil(t, status) {
+		assert.Equal(t, types.True, status.Conditions[0].Status)
+		assert.Equal(t, "cpu0 was throttled 5 times", status.Conditions[0].Message)
+		assert.Len(t, status.Events, 1)
+	}
+
+	// The condition is kept when nothing was collected.
+	assert.Nil(t, tc.updateCondition(&thermalStats{}, now))
+
+	zones[0].celsius = 95
+	status = tc.updateCondition(&thermalStats{zones: zones, throttles: map[string]cpuThrottles{"cpu0": {core: 103, pkg: 2}}}, now)
+	if assert.NotNil(t, status) {
+		assert.Equal(t, types.True, status.Conditions[0].Status)
+		assert.Equal(t, "thermal_zone0 (x86_pkg_temp) is at 95.0°C", status.Conditions[0].Message)
+		assert.Empty(t, status.Events)
+	}
+
+	zones[0].celsius = 80
+	status = tc.updateCondition(&thermalStats{zones: zones, throttles: map[string]cpuThrottles{"cpu0": {core: 104, pkg: 2}}}, now)
+	if assert.NotNil(t, status) {
+		assert.Equal(t, types.False, status.Conditions[0].Status)
+		assert.Equal(t, noThermalThrottlingReason, status.Conditions[0].Reason)
+	}
+}
@@ -24,6 +24,8 @@ import (
 var (
 	defaultInvokeIntervalString = (60 * time.Second).String()
 	defaultlsblkTimeoutString   = (5 * time.Second).String()
+	defaultDStateDurationString = (2 * time.Minute).String()
+	defaultMaxListedProcesses   = 5
 )
 
 type MetricConfig struct {
@@ -50,13 +52,90 @@ type MemoryStatsConfig struct {
 	MetricsConfigs map[string]MetricConfig `json:"metricsConfigs"`
 }
 
+type NetStatsConfig struct {
+	MetricsConfigs map[string]MetricConfig `json:"metricsConfigs"`
+	// ConntrackFullThreshold is the percentage of the connection tracking table in use
+	// above which the ConntrackFull condition is set. 0 disables the condition.
+	ConntrackFullThreshold float64 `json:"conntrackFullThreshold"`
+}
+
+// HasConntrackCondition returns whether the ConntrackFull condition is enabled.
+func (nsc *NetStatsConfig) HasConntrackCondition() bool {
+	return nsc.ConntrackFullThreshold > 0
+}
+
+type OSStatsConfig struct {
+	MetricsConfigs map[string]MetricConfig `json:"metricsConfigs"`
+	// FDPressureThreshold is the percentage of the system wide file descriptor limit in
+	// use above which the FDPressure condition is set. 0 disables the condition.
+	FDPressureThreshold float64 `json:"fdPressureThreshold"`
+	// InodePressureThreshold is the percentage of the inodes of any mounted filesystem in
+	// use above which the InodePressure condition is set. 0 disables the condition.
+	InodePressureThreshold float64 `json:"inodePressureThreshold"`
+	// EphemeralPortPressureThreshold is the percentage of the local port range in use
+	// above which the EphemeralPortPressure condition is set. 0 disables the condition.
+	EphemeralPortPressureThreshold float64 `json:"ephemeralPortPressureThreshold"`
+}
+
+// HasPressureConditions returns whether any pressure condition is enabled.
+func (osc *OSStatsConfig) HasPressureConditions() bool {
+	return osc.FDPressureThreshold > 0 || osc.InodePressureThreshold > 0 || osc.EphemeralPortPressureThreshold > 0
+}
+
+type ProcessStatsConfig struct {
+	MetricsConfigs map[string]MetricConfig `json:"metricsConfigs"`
+	// ZombieThreshold is the number of zombie processes at or above which the
+	// ZombieProcesses condition is set. 0 disables the condition.
+	ZombieThreshold int `json:"zombieThreshold"`
+	// DStateThreshold is the number of processes stuck in uninterruptible sleep at or
+	// above which the ProcessesStuckInDState condition is set. 0 disables the condition.
+	DStateThreshold int `json:"dStateThreshold"`
+	// DStateDurationString is the time a process must have been seen in uninterruptible
+	// sleep by every collection to be considered stuck.
+	DStateDurationString string        `json:"dStateDuration"`
+	DStateDuration       time.Duration `json:"-"`
+	// MaxListedProcesses is the number of the oldest offending processes listed in the
+	// condition messages.
+	MaxListedProcesses int `json:"maxListedProcesses"`
+}
+
+// HasProcessConditions returns whether any process condition is enabled.
+func (psc *ProcessStatsConfig) HasProcessConditions() bool {
+	return psc.ZombieThreshold > 0 || psc.DStateThreshold > 0
+}
+
+type RASStatsConfig struct {
+	MetricsConfigs map[string]MetricConfig `json:"metricsConfigs"`
+}
+
+type ThermalStatsConfig struct {
+	MetricsConfigs map[string]MetricConfig `json:"metricsConfigs"`
+	// TemperatureThreshold is the temperature of any thermal zone, in degrees Celsius, at
+	// or above which the ThermalThrottling condition is set. 0 disables the threshold.
+	TemperatureThreshold float64 `json:"temperatureThreshold"`
+	// ThrottleCountThreshold is the number of times the CPUs were throttled since the last
+	// collection at or above which the ThermalThrottling condition is set. 0 disables the
+	// threshold.
+	ThrottleCountThreshold uint64 `json:"throttleCountThreshold"`
+}
+
+// HasThrottlingCondition returns whether the ThermalThrottling condition is enabled.
+func (tsc *ThermalStatsConfig) HasThrottlingCondition() bool {
+	return tsc.TemperatureThreshold > 0 || tsc.ThrottleCountThreshold > 0
+}
+
 type SystemStatsConfig struct {
-	CPUConfig            CPUStatsConfig    `json:"cpu"`
-	DiskConfig           DiskStatsConfig   `json:"disk"`
-	HostConfig           HostStatsConfig   `json:"host"`
-	MemoryConfig         MemoryStatsConfig `json:"memory"`
-	InvokeIntervalString string            `json:"invokeInterval"`
-	InvokeInterval       time.Duration     `json:"-"`
+	CPUConfig            CPUStatsConfig     `json:"cpu"`
+	DiskConfig           DiskStatsConfig    `json:"disk"`
+	HostConfig           HostStatsConfig    `json:"host"`
+	MemoryConfig         MemoryStatsConfig  `json:"memory"`
+	NetConfig            NetStatsConfig     `json:"net"`
+	OSConfig             OSStatsConfig      `json:"os"`
+	ProcessConfig        ProcessStatsConfig `json:"process"`
+	RASConfig            RASStatsConfig     `json:"ras"`
+	ThermalConfig        ThermalStatsConfig `json:"thermal"`
+	InvokeIntervalString string             `json:"invokeInterval"`
+	InvokeInterval       time.Duration      `json:"-"`
 }
 
 // ApplyConfiguration applies default configurations.
@@ -67,6 +146,12 @@ func (ssc *SystemStatsConfig) ApplyConfiguration() error {
 	if ssc.DiskConfig.LsblkTimeoutString == "" {
 		ssc.DiskConfig.LsblkTimeoutString = defaultlsblkTimeoutString
 	}
+	if ssc.ProcessConfig.DStateDurationString == "" {
+		ssc.ProcessConfig.DStateDurationString = defaultDStateDurationString
+	}
+	if ssc.ProcessConfig.MaxListedProcesses == 0 {
+		ssc.ProcessConfig.MaxListedProcesses = defaultMaxListedProcesses
+	}
 
 	var err error
 	ssc.InvokeInterval, err = time.ParseDuration(ssc.InvokeIntervalString)
@@ -77,6 +162,10 @@ func (ssc *SystemStatsConfig) ApplyConfiguration() error {
 	if err != nil {
 		return fmt.Errorf("error in parsing LsblkTimeoutString %q: %v", ssc.DiskConfig.LsblkTimeoutString, err)
 	}
+	ssc.ProcessConfig.DStateDuration, err = time.ParseDuration(ssc.ProcessConfig.DStateDurationString)
+	if err != nil {
+		return fmt.Errorf("error in parsing DStateDurationString %q: %v", ssc.ProcessConfig.DStateDurationString, err)
+	}
 
 	return nil
 }
@@ -92,6 +181,29 @@ func (ssc *SystemStatsConfig) Validate() error {
 	if ssc.DiskConfig.LsblkTimeout > ssc.InvokeInterval {
 		return fmt.Errorf("LsblkTimeout %v must be shorter than ssc.InvokeInterval %v", ssc.DiskConfig.LsblkTimeout, ssc.InvokeInterval)
 	}
+	for name, threshold := range map[string]float64{
+		"FDPressureThreshold":            ssc.OSConfig.FDPressureThreshold,
+		"InodePressureThreshold":         ssc.OSConfig.InodePressureThreshold,
+		"EphemeralPortPressureThreshold": ssc.OSConfig.EphemeralPortPressureThreshold,
+		"ConntrackFullThreshold":         ssc.NetConfig.ConntrackFullThreshold,
+	} {
+		if threshold < 0 || threshold > 100 {
+			return fmt.Errorf("%s %v must be a percentage in [0, 100]", name, threshold)
+		}
+	}
+	if ssc.ProcessConfig.ZombieThreshold < 0 || ssc.ProcessConfig.DStateThreshold < 0 {
+		return fmt.Errorf("ZombieThreshold %d and DStateThreshold %d must not be negative",
+			ssc.ProcessConfig.ZombieThreshold, ssc.ProcessConfig.DStateThreshold)
+	}
+	if ssc.ProcessConfig.DStateDuration < 0 {
+		return fmt.Errorf("DStateDuration %v must not be negative", ssc.ProcessConfig.DStateDuration)
+	}
+	if ssc.ProcessConfig.MaxListedProcesses < 0 {
+		return fmt.Errorf("MaxListedProcesses %d must not be negative", ssc.ProcessConfig.MaxListedProcesses)
+	}
+	if ssc.ThermalConfig.TemperatureThreshold < 0 {
+		return fmt.Errorf("TemperatureThreshold %v must not be negative", ssc.ThermalConfig.TemperatureThreshold)
+	}
 
 	return nil
 }
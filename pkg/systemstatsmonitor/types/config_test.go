@@ -43,6 +43,11 @@ func TestApplyConfiguration(t *testing.T) {
 					LsblkTimeout:       5 * time.Second,
 					LsblkTimeoutString: "5s",
 				},
+				ProcessConfig: ProcessStatsConfig{
+					DStateDurationString: "2m0s",
+					DStateDuration:       2 * time.Minute,
+					MaxListedProcesses:   5,
+				},
 				InvokeIntervalString: "60s",
 				InvokeInterval:       60 * time.Second,
 			},
@@ -58,6 +63,11 @@ func TestApplyConfiguration(t *testing.T) {
 					LsblkTimeout:       5 * time.Second,
 					LsblkTimeoutString: "5s",
 				},
+				ProcessConfig: ProcessStatsConfig{
+					DStateDurationString: "2m0s",
+					DStateDuration:       2 * time.Minute,
+					MaxListedProcesses:   5,
+				},
 				InvokeIntervalString: "1m0s",
 				InvokeInterval:       60 * time.Second,
 			},
@@ -138,6 +148,92 @@ func TestValidate(t *testing.T) {
 			},
 			isError: true,
 		},
+		{
+			name: "pressure-thresholds",
+			config: SystemStatsConfig{
+				OSConfig: OSStatsConfig{
+					FDPressureThreshold:            80,
+					InodePressureThreshold:         90,
+					EphemeralPortPressureThreshold: 100,
+				},
+			},
+			isError: false,
+		},
+		{
+			name: "pressure-threshold-above-100",
+			config: SystemStatsConfig{
+				OSConfig: OSStatsConfig{
+					InodePressureThreshold: 101,
+				},
+			},
+			isError: true,
+		},
+		{
+			name: "negative-pressure-threshold",
+			config: SystemStatsConfig{
+				OSConfig: OSStatsConfig{
+					FDPressureThreshold: -1,
+				},
+			},
+			isError: true,
+		},
+		{
+			name: "conntrack-threshold-above-100",
+			config: SystemStatsConfig{
+				NetConfig: NetStatsConfig{
+					ConntrackFullThreshold: 120,
+				},
+			},
+			isError: true,
+		},
+		{
+			name: "thermal-thresholds",
+			config: SystemStatsConfig{
+				ThermalConfig: ThermalStatsConfig{
+					TemperatureThreshold:   95,
+					ThrottleCountThreshold: 10,
+				},
+			},
+			isError: false,
+		},
+		{
+			name: "process-thresholds",
+			config: SystemStatsConfig{
+				ProcessConfig: ProcessStatsConfig{
+					ZombieThreshold:      50,
+					DStateThreshold:      1,
+					DStateDurationString: "5m",
+				},
+			},
+			isError: false,
+		},
+		{
+			name: "negative-zombie-threshold",
+			config: SystemStatsConfig{
+				ProcessConfig: ProcessStatsConfig{
+					ZombieThreshold: -1,
+				},
+			},
+			isError: true,
+		},
+		{
+			name: "negative-d-state-duration",
+			config: SystemStatsConfig{
+				ProcessConfig: ProcessStatsConfig{
+					DStateDurationString: "-1m",
+				},
+			},
+			isError: true,
+		},
+		{
+			name: "negative-temperature-threshold",
+			config: SystemStatsConfig{
+				ThermalConfig: ThermalStatsConfig{
+					TemperatureThreshold: -1,
+				},
+			},
+			isError: true,
+		},
 	}
 
 	for _, test := range testCases {
@@ -17,9 +17,12 @@ limitations under the License.
 package types
 
 import (
+	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/spf13/pflag"
+	"go.opencensus.io/trace"
 )
 
 // The following types are used internally in problem detector. In the future this could be the
@@ -28,9 +31,9 @@ import (
 // 1) The kubernetes api packages are too heavy.
 // 2) We want to make the interface independent with kubernetes api change.
 
-// Severity is the severity of the problem event. Now we only have 2 severity levels: Info and Warn,
-// which are corresponding to the current kubernetes event types. We may want to add more severity
-// levels in the future.
+// Severity is the severity of the problem event. Info and Warn correspond to the kubernetes event
+// types, Critical marks the problems which need immediate attention, so that exporters can route
+// them differently.
 type Severity string
 
 const (
@@ -38,8 +41,36 @@ const (
 	Info Severity = "info"
 	// Warn is translated to a warning event.
 	Warn Severity = "warn"
+	// Critical is translated to a warning event, and marked as critical by the exporters
+	// which can tell it apart, e.g. with an annotation or a metric label.
+	Critical Severity = "critical"
 )
 
+// SeverityAnnotation is the event annotation and metric label carrying the severity of
+// critical problems.
+const SeverityAnnotation = "severity"
+
+// ParseSeverity parses the severity of a rule. An empty severity defaults to Warn, and
+// "warning" is accepted for Warn.
+func ParseSeverity(severity string) (Severity, error) {
+	switch severity {
+	case "", string(Warn), "warning":
+		return Warn, nil
+	case string(Info):
+		return Info, nil
+	case string(Critical):
+		return Critical, nil
+	default:
+		return "", fmt.Errorf("invalid severity %q, must be one of info, warning and critical", severity)
+	}
+}
+
+// IsProblem returns whether events of the severity report problems, i.e. are Warn or
+// Critical.
+func (s Severity) IsProblem() bool {
+	return s == Warn || s == Critical
+}
+
 // ConditionStatus is the status of the condition.
 type ConditionStatus string
 
@@ -65,6 +96,9 @@ type Condition struct {
 	Reason string `json:"reason"`
 	// Message is a human readable message of why node goes into this condition.
 	Message string `json:"message"`
+	// Severity is the severity of the problem while the condition is True. Empty when the
+	// monitor does not classify its problems.
+	Severity Severity `json:"severity,omitempty"`
 }
 
 // Event is the event used internally by node problem detector.
@@ -77,6 +111,72 @@ type Event struct {
 	Reason string `json:"reason"`
 	// Message is a human readable message of why the event is generated.
 	Message string `json:"message"`
+	// Annotations are structured details of the event, e.g. the named capture groups of
+	// the log pattern matching the problem.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Ownership is the optional ownership metadata of a rule, so that downstream systems can
+// route the alerts on its problems without a separate mapping.
+type Ownership struct {
+	// Team is the team owning the rule.
+	Team string `json:"team,omitempty"`
+	// Escalation is where the problems of the rule are escalated to, e.g. a pager service
+	// or a chat channel.
+	Escalation string `json:"escalation,omitempty"`
+	// Labels are arbitrary labels of the rule, e.g. a "runbook" URL or a "ticket_queue",
+	// which route the alerts on its problems in large organizations.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// The event annotations and metric labels carrying the ownership of the problems.
+const (
+	TeamAnnotation       = "team"
+	EscalationAnnotation = "escalation"
+)
+
+// labelKeyRegexp matches the valid label keys, which are valid metric label names.
+var labelKeyRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// IsZero returns whether the ownership is empty.
+func (o Ownership) IsZero() bool {
+	return o.Team == "" && o.Escalation == "" && len(o.Labels) == 0
+}
+
+// Validate verifies whether the label keys are valid metric label names, and do not
+// override the team and the escalation.
+func (o Ownership) Validate() error {
+	for key := range o.Labels {
+		if !labelKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid label key %q, must match %s", key, labelKeyRegexp)
+		}
+		if key == TeamAnnotation || key == EscalationAnnotation {
+			return fmt.Errorf("label key %q is reserved, set %q instead", key, key)
+		}
+	}
+	return nil
+}
+
+// Annotate returns the annotations with the ownership added, which takes precedence over
+// annotations of the same keys. The annotations passed in are not modified.
+func (o Ownership) Annotate(annotations map[string]string) map[string]string {
+	if o.IsZero() {
+		return annotations
+	}
+	result := make(map[string]string, len(annotations)+len(o.Labels)+2)
+	for k, v := range annotations {
+		result[k] = v
+	}
+	for k, v := range o.Labels {
+		result[k] = v
+	}
+	if o.Team != "" {
+		result[TeamAnnotation] = o.Team
+	}
+	if o.Escalation != "" {
+		result[EscalationAnnotation] = o.Escalation
+	}
+	return result
 }
 
 // Status is the status other problem daemons should report to node problem detector.
@@ -89,6 +189,12 @@ type Status struct {
 	// Conditions are the permanent node conditions. The problem daemon should always report the
 	// newest node conditions in this field.
 	Conditions []Condition `json:"conditions"`
+	// Node is the metadata of the node selected for the enrichment of problems, e.g. its
+	// topology zone, by name. It is only set when the node enrichment is configured.
+	Node map[string]string `json:"node,omitempty"`
+	// Trace is the span context of the detection of the status. It is only set when the
+	// detection is traced, so that exporting the status is traced as part of it.
+	Trace trace.SpanContext `json:"-"`
 }
 
 // Type is the type of the problem.
@@ -111,10 +217,64 @@ type Monitor interface {
 	Stop()
 }
 
+// ControllableMonitor is implemented by monitors which can be operated at runtime
+// through the admin API.
+type ControllableMonitor interface {
+	Monitor
+	// Pause stops the periodic checks until Resume is called. The conditions are kept.
+	Pause()
+	// Resume restarts the periodic checks.
+	Resume()
+	// Paused returns whether the monitor is paused.
+	Paused() bool
+	// Trigger runs all checks immediately, even when the monitor is paused.
+	Trigger()
+	// Reload re-reads the configuration of the monitor. The current configuration is
+	// kept if the new one is invalid.
+	Reload() error
+}
+
 // Exporter exports machine health data to certain control plane.
 type Exporter interface {
-	// Export problems to the control plane.
+	// ExportProblems exports problem changes to the control plane. The status only carries
+	// the new events and the conditions changed since the last export of the same source.
 	ExportProblems(*Status)
+	// SyncProblems exports the full latest state of a problem daemon to the control plane.
+	// It is called periodically so that exporters can recover from lost changes. The status
+	// carries all conditions of the source and no events.
+	SyncProblems(*Status)
+}
+
+// PushExporter is implemented by exporters which may push problems to a remote back end,
+// so that their egress can be limited.
+type PushExporter interface {
+	Exporter
+	// PushesProblems returns whether the exporter pushes problems to a remote back end.
+	PushesProblems() bool
+}
+
+// StoppableExporter is implemented by exporters which need to flush the pending problems
+// or release resources when node problem detector terminates.
+type StoppableExporter interface {
+	Exporter
+	// Stop flushes the pending problems and releases the resources of the exporter. No
+	// problem is exported after Stop is called.
+	Stop()
+}
+
+// AcknowledgingExporter is implemented by exporters which deliver the problems
+// asynchronously, so that the problems exported are known to be delivered.
+type AcknowledgingExporter interface {
+	Exporter
+	// DeliveredUntil returns the time before which all problems exported were
+	// delivered, i.e. the problems whose ExportProblems returned before it.
+	DeliveredUntil() time.Time
+}
+
+// NodeAnnotator is implemented by exporters which can annotate the node.
+type NodeAnnotator interface {
+	// AnnotateNode sets or updates the annotations of the node.
+	AnnotateNode(annotations map[string]string) error
 }
 
 // ProblemDaemonType is the type of the problem daemon.
@@ -0,0 +1,63 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "monitor", "state.json")
+
+	type state struct {
+		BootID string `json:"bootID"`
+	}
+	// A state which was never saved is left unchanged.
+	s := state{BootID: "unknown"}
+	assert.NoError(t, LoadState(path, &s))
+	assert.Equal(t, "unknown", s.BootID)
+
+	assert.NoError(t, SaveState(path, state{BootID: "b1"}))
+	assert.NoError(t, LoadState(path, &s))
+	assert.Equal(t, "b1", s.BootID)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	assert.Error(t, LoadState(path, &s))
+}
+
+func TestReadBootID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boot-id")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "boot_id")
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("b1\n"), 0644))
+	bootID, err := ReadBootID(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "b1", bootID)
+
+	_, err = ReadBootID(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
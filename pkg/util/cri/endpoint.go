@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cri parses, validates and probes the endpoints of container runtimes
+// implementing the Container Runtime Interface (CRI).
+package cri
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// UnixProtocol is the protocol of endpoints on unix domain sockets.
+	UnixProtocol = "unix"
+	// NpipeProtocol is the protocol of endpoints on Windows named pipes.
+	NpipeProtocol = "npipe"
+	// TCPProtocol is the protocol of endpoints on TCP.
+	TCPProtocol = "tcp"
+
+	// npipePrefix is the prefix of the named pipe paths, with slashes instead of backslashes.
+	npipePrefix = "//./pipe/"
+)
+
+// Endpoint is a parsed CRI endpoint.
+type Endpoint struct {
+	// Protocol is one of UnixProtocol, NpipeProtocol and TCPProtocol.
+	Protocol string
+	// Address is the socket path for unix, the pipe path (e.g. "//./pipe/containerd-containerd")
+	// for npipe, and "host:port" for tcp.
+	Address string
+}
+
+// String returns the endpoint in the URL format accepted by the kubelet and crictl, e.g.
+// "unix:///run/containerd/containerd.sock".
+func (e Endpoint) String() string {
+	return e.Protocol + "://" + e.Address
+}
+
+// ParseEndpoint parses and validates a CRI endpoint. Endpoints are URLs with the unix, npipe
+// or tcp scheme. For compatibility with old kubelet flags, absolute socket paths are parsed
+// as unix endpoints, and named pipe paths (e.g. `\\.\pipe\containerd-containerd`) as npipe
+// endpoints.
+func ParseEndpoint(endpoint string) (Endpoint, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return Endpoint{}, fmt.Errorf("CRI endpoint is empty")
+	}
+
+	var e Endpoint
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		e = Endpoint{Protocol: strings.ToLower(endpoint[:i]), Address: endpoint[i+len("://"):]}
+	} else if strings.HasPrefix(npipePath(endpoint), npipePrefix) {
+		e = Endpoint{Protocol: NpipeProtocol, Address: endpoint}
+	} else if strings.HasPrefix(endpoint, "/") {
+		e = Endpoint{Protocol: UnixProtocol, Address: endpoint}
+	} else {
+		return Endpoint{}, fmt.Errorf("CRI endpoint %q is neither a URL nor an absolute path", endpoint)
+	}
+
+	switch e.Protocol {
+	case UnixProtocol:
+		if !strings.HasPrefix(e.Address, "/") {
+			return Endpoint{}, fmt.Errorf("unix CRI endpoint %q must be an absolute socket path", endpoint)
+		}
+	case NpipeProtocol:
+		e.Address = npipePath(e.Address)
+		if !strings.HasPrefix(e.Address, npipePrefix) || len(e.Address) == len(npipePrefix) {
+			return Endpoint{}, fmt.Errorf("npipe CRI endpoint %q must be a named pipe path like %s<name>", endpoint, npipePrefix)
+		}
+	case TCPProtocol:
+		host, port, err := net.SplitHostPort(e.Address)
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("invalid tcp CRI endpoint %q: %v", endpoint, err)
+		}
+		if port == "" {
+			return Endpoint{}, fmt.Errorf("tcp CRI endpoint %q has no port", endpoint)
+		}
+		e.Address = net.JoinHostPort(host, port)
+	default:
+		return Endpoint{}, fmt.Errorf("CRI endpoint %q has unsupported protocol %q, supported: %s, %s, %s",
+			endpoint, e.Protocol, UnixProtocol, NpipeProtocol, TCPProtocol)
+	}
+	return e, nil
+}
+
+// npipePath converts the backslashes of a named pipe path to slashes.
+func npipePath(path string) string {
+	return strings.Replace(path, `\`, "/", -1)
+}
+
+// ProbeEndpoint checks whether the endpoint is served, i.e. the unix socket exists and
+// accepts connections, the named pipe exists, or the TCP address accepts connections.
+func ProbeEndpoint(e Endpoint, timeout time.Duration) error {
+	switch e.Protocol {
+	case UnixProtocol:
+		info, err := os.Stat(e.Address)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s is not a unix socket", e.Address)
+		}
+		return dial(UnixProtocol, e.Address, timeout)
+	case TCPProtocol:
+		return dial(TCPProtocol, e.Address, timeout)
+	case NpipeProtocol:
+		return probeNamedPipe(e.Address)
+	default:
+		return fmt.Errorf("unsupported protocol %q", e.Protocol)
+	}
+}
+
+func dial(network, address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// DetectEndpoint returns the first of the default endpoints of the platform which is
+// served, see ProbeEndpoint.
+func DetectEndpoint(timeout time.Duration) (Endpoint, error) {
+	var errs []string
+	for _, endpoint := range DefaultEndpoints {
+		e, err := ParseEndpoint(endpoint)
+		if err != nil {
+			return Endpoint{}, err
+		}
+		if err := ProbeEndpoint(e, timeout); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", endpoint, err))
+			continue
+		}
+		return e, nil
+	}
+	return Endpoint{}, fmt.Errorf("no CRI endpoint is served: %s", strings.Join(errs, "; "))
+}
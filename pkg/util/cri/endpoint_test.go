@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cri
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	testCases := []struct {
+		endpoint  string
+		expected  Endpoint
+		expectErr bool
+	}{
+		{
+			endpoint: "unix:///run/containerd/containerd.sock",
+			expected: Endpoint{Protocol: UnixProtocol, Address: "/run/containerd/containerd.sock"},
+		},
+		{
+			endpoint: " UNIX:///run/crio/crio.sock\n",
+			expected: Endpoint{Protocol: UnixProtocol, Address: "/run/crio/crio.sock"},
+		},
+		{
+			endpoint: "/var/run/dockershim.sock",
+			expected: Endpoint{Protocol: UnixProtocol, Address: "/var/run/dockershim.sock"},
+		},
+		{
+			endpoint: "npipe:////./pipe/containerd-containerd",
+			expected: Endpoint{Protocol: NpipeProtocol, Address: "//./pipe/containerd-containerd"},
+		},
+		{
+			endpoint: `npipe://\\.\pipe\containerd-containerd`,
+			expected: Endpoint{Protocol: NpipeProtocol, Address: "//./pipe/containerd-containerd"},
+		},
+		{
+			endpoint: `\\.\pipe\cri-dockerd`,
+			expected: Endpoint{Protocol: NpipeProtocol, Address: "//./pipe/cri-dockerd"},
+		},
+		{
+			endpoint: "tcp://127.0.0.1:3735",
+			expected: Endpoint{Protocol: TCPProtocol, Address: "127.0.0.1:3735"},
+		},
+		{
+			endpoint: "tcp://[::1]:3735",
+			expected: Endpoint{Protocol: TCPProtocol, Address: "[::1]:3735"},
+		},
+		{endpoint: "", expectErr: true},
+		{endpoint: "containerd.sock", expectErr: true},
+		{endpoint: "unix://containerd.sock", expectErr: true},
+		{endpoint: "npipe:////./pipe/", expectErr: true},
+		{endpoint: "npipe:///tmp/pipe", expectErr: true},
+		{endpoint: "tcp://127.0.0.1", expectErr: true},
+		{endpoint: "tcp://127.0.0.1:", expectErr: true},
+		{endpoint: "http://127.0.0.1:3735", expectErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.endpoint, func(t *testing.T) {
+			e, err := ParseEndpoint(test.endpoint)
+			if test.expectErr {
+				assert.Error(t, err, "got endpoint %+v", e)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, e)
+			// The string form is parsed to the same endpoint.
+			parsed, err := ParseEndpoint(e.String())
+			assert.NoError(t, err)
+			assert.Equal(t, e, parsed)
+		})
+	}
+}
+
+func TestProbeEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cri")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "cri.sock")
+	unixListener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	defer unixListener.Close()
+	assert.NoError(t, ProbeEndpoint(Endpoint{Protocol: UnixProtocol, Address: socket}, time.Second))
+
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	assert.Error(t, ProbeEndpoint(Endpoint{Protocol: UnixProtocol, Address: file}, time.Second),
+		"a regular file is not a socket")
+	assert.Error(t, ProbeEndpoint(Endpoint{Protocol: UnixProtocol, Address: filepath.Join(dir, "missing.sock")}, time.Second))
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := tcpListener.Addr().String()
+	assert.NoError(t, ProbeEndpoint(Endpoint{Protocol: TCPProtocol, Address: address}, time.Second))
+	tcpListener.Close()
+	assert.Error(t, ProbeEndpoint(Endpoint{Protocol: TCPProtocol, Address: address}, time.Second))
+}
+
+func TestDefaultEndpoints(t *testing.T) {
+	for _, endpoint := range DefaultEndpoints {
+		_, err := ParseEndpoint(endpoint)
+		assert.NoError(t, err, "default endpoint %q should be valid", endpoint)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cri
+
+import (
+	"os"
+	"strings"
+)
+
+// DefaultEndpoints are the endpoints of the common container runtimes on the platform,
+// in the order they are detected.
+var DefaultEndpoints = []string{
+	"npipe:////./pipe/containerd-containerd",
+	"npipe:////./pipe/cri-dockerd",
+}
+
+// probeNamedPipe checks whether the named pipe exists. Connecting to it is left to the
+// CRI client, which needs to be built with named pipe support.
+func probeNamedPipe(path string) error {
+	_, err := os.Stat(strings.Replace(path, "/", `\`, -1))
+	return err
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package liveness tracks whether the long running goroutines of node problem
+// detector are still making progress.
+package liveness
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type beat struct {
+	last    time.Time
+	timeout time.Duration
+}
+
+var (
+	beats      = map[string]beat{}
+	beatsMutex sync.Mutex
+)
+
+// Beat records that the goroutine with the name is alive. The goroutine is
+// considered stalled if it does not beat again within the timeout.
+func Beat(name string, timeout time.Duration) {
+	beatsMutex.Lock()
+	defer beatsMutex.Unlock()
+	beats[name] = beat{last: time.Now(), timeout: timeout}
+}
+
+// Forget stops tracking the goroutine with the name, e.g. when it is stopped.
+func Forget(name string) {
+	beatsMutex.Lock()
+	defer beatsMutex.Unlock()
+	delete(beats, name)
+}
+
+// Stalled returns the sorted names of the goroutines which did not beat within
+// their timeout.
+func Stalled(now time.Time) []string {
+	beatsMutex.Lock()
+	defer beatsMutex.Unlock()
+	var stalled []string
+	for name, b := range beats {
+		if now.Sub(b.last) > b.timeout {
+			stalled = append(stalled, name)
+		}
+	}
+	sort.Strings(stalled)
+	return stalled
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package liveness
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStalled(t *testing.T) {
+	Beat("b", time.Minute)
+	Beat("a", time.Minute)
+	Beat("c", time.Hour)
+	defer Forget("a")
+	defer Forget("b")
+	defer Forget("c")
+
+	assert.Empty(t, Stalled(time.Now()))
+	assert.Equal(t, []string{"a", "b"}, Stalled(time.Now().Add(2*time.Minute)))
+
+	Forget("b")
+	assert.Equal(t, []string{"a"}, Stalled(time.Now().Add(2*time.Minute)))
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// Exemplar is an example of the measurements of a metric series, which links the series
+// to the problem behind them, e.g. a spike of a problem counter to the event counted.
+// OpenCensus only keeps exemplars of distributions, so the latest exemplar of each series
+// is kept here for the exporters whose back ends support exemplars.
+type Exemplar struct {
+	// Value is the value of the measurement.
+	Value float64
+	// Timestamp is the time of the measurement.
+	Timestamp time.Time
+	// Trace is the span context of the detection of the problem, if it was traced.
+	Trace trace.SpanContext
+	// Attributes describe the problem, e.g. its source and message.
+	Attributes map[string]string
+}
+
+var (
+	exemplars      = make(map[string]Exemplar)
+	exemplarsMutex sync.RWMutex
+)
+
+// exemplarKey returns the key of a metric series. Tags without value are ignored, as
+// OpenCensus may drop them from the rows.
+func exemplarKey(viewName string, tags map[string]string) string {
+	var pairs []string
+	for k, v := range tags {
+		if v != "" {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+	sort.Strings(pairs)
+	return viewName + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// setExemplar sets the latest exemplar of the series of the view with the tags.
+func setExemplar(viewName string, tags map[string]string, exemplar Exemplar) {
+	exemplarsMutex.Lock()
+	defer exemplarsMutex.Unlock()
+	exemplars[exemplarKey(viewName, tags)] = exemplar
+}
+
+// LookupExemplar returns the latest exemplar of the series of the view with the tags of a
+// view row, if any.
+func LookupExemplar(viewName string, tags []tag.Tag) (Exemplar, bool) {
+	tagMap := make(map[string]string, len(tags))
+	for _, t := range tags {
+		tagMap[t.Key.Name()] = t.Value
+	}
+	exemplarsMutex.RLock()
+	defer exemplarsMutex.RUnlock()
+	exemplar, ok := exemplars[exemplarKey(viewName, tagMap)]
+	return exemplar, ok
+}
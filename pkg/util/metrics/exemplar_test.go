@@ -0,0 +1,45 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/tag"
+)
+
+func TestExemplar(t *testing.T) {
+	metric, err := NewInt64Metric("exemplar_test", "exemplar_test", "", "1", Sum, []string{"reason", "team"})
+	assert.NoError(t, err)
+	reasonKey, _ := tag.NewKey("reason")
+	teamKey, _ := tag.NewKey("team")
+
+	exemplar := Exemplar{Value: 1, Timestamp: time.Unix(100, 0), Attributes: map[string]string{"source": "kernel-monitor"}}
+	// Tags without value are not part of the series.
+	metric.SetExemplar(map[string]string{"reason": "TaskHung", "team": ""}, exemplar)
+
+	got, ok := LookupExemplar("exemplar_test", []tag.Tag{{Key: reasonKey, Value: "TaskHung"}})
+	assert.True(t, ok)
+	assert.Equal(t, exemplar, got)
+
+	_, ok = LookupExemplar("exemplar_test", []tag.Tag{{Key: reasonKey, Value: "TaskHung"}, {Key: teamKey, Value: "node"}})
+	assert.False(t, ok, "series with other tags should have no exemplar")
+	_, ok = LookupExemplar("other_metric", []tag.Tag{{Key: reasonKey, Value: "TaskHung"}})
+	assert.False(t, ok, "other metrics should have no exemplar")
+}
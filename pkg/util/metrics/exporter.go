@@ -0,0 +1,76 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats/view"
+)
+
+var (
+	reportingPeriodMutex sync.Mutex
+	// reportingPeriods are the reporting periods requested by the view exporters, keyed
+	// by the exporter name.
+	reportingPeriods = map[string]time.Duration{}
+)
+
+// RegisterViewExporter registers an OpenCensus view exporter, which requests the views to
+// be reported every period. The reporting period is global to OpenCensus, so metric
+// exporters must register through here instead of setting it themselves: the shortest
+// period requested by the exporters is used, and a warning is logged when they request
+// different periods.
+func RegisterViewExporter(name string, exporter view.Exporter, period time.Duration) {
+	reportingPeriodMutex.Lock()
+	defer reportingPeriodMutex.Unlock()
+
+	reportingPeriods[name] = period
+	shortest := period
+	for other, otherPeriod := range reportingPeriods {
+		if otherPeriod != period {
+			glog.Warningf("The %s exporter requests a reporting period of %v, but the %s exporter requests %v; the metrics are reported to both every %v",
+				name, period, other, otherPeriod, minDuration(period, otherPeriod))
+		}
+		shortest = minDuration(shortest, otherPeriod)
+	}
+	view.SetReportingPeriod(shortest)
+	view.RegisterExporter(exporter)
+}
+
+// ReportingPeriod returns the reporting period of the view exporters, or 0 when no
+// exporter is registered.
+func ReportingPeriod() time.Duration {
+	reportingPeriodMutex.Lock()
+	defer reportingPeriodMutex.Unlock()
+
+	var shortest time.Duration
+	for _, period := range reportingPeriods {
+		if shortest == 0 || period < shortest {
+			shortest = period
+		}
+	}
+	return shortest
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats/view"
+)
+
+type fakeViewExporter struct {
+	name string
+}
+
+func (fakeViewExporter) ExportView(*view.Data) {}
+
+func TestRegisterViewExporter(t *testing.T) {
+	first, second := &fakeViewExporter{name: "first"}, &fakeViewExporter{name: "second"}
+	defer func() {
+		view.UnregisterExporter(first)
+		view.UnregisterExporter(second)
+		reportingPeriods = map[string]time.Duration{}
+	}()
+
+	RegisterViewExporter("first", first, time.Minute)
+	assert.Equal(t, time.Minute, ReportingPeriod())
+	// A later exporter does not lengthen the period of an earlier one.
+	RegisterViewExporter("second", second, 2*time.Minute)
+	assert.Equal(t, time.Minute, ReportingPeriod())
+	RegisterViewExporter("second", second, 30*time.Second)
+	assert.Equal(t, 30*time.Second, ReportingPeriod())
+}
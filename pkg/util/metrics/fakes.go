@@ -25,6 +25,8 @@ import (
 type Int64MetricInterface interface {
 	// Record records a measurement for the metric, with provided tags as metric labels.
 	Record(tags map[string]string, measurement int64) error
+	// SetExemplar sets the exemplar of the series of the metric with the tags.
+	SetExemplar(tags map[string]string, exemplar Exemplar)
 }
 
 // FakeInt64Metric implements Int64MetricInterface.
@@ -91,6 +93,16 @@ func (fake *FakeInt64Metric) Record(tags map[string]string, measurement int64) e
 	return nil
 }
 
+// SetExemplar sets the exemplar of the metric with the tags, if it was recorded.
+func (fake *FakeInt64Metric) SetExemplar(tags map[string]string, exemplar Exemplar) {
+	for index, existingMetric := range fake.metrics {
+		if reflect.DeepEqual(existingMetric.Labels, tags) {
+			fake.metrics[index].Exemplar = &exemplar
+			return
+		}
+	}
+}
+
 // ListMetrics returns a snapshot of the current metrics.
 func (fake *FakeInt64Metric) ListMetrics() []Int64MetricRepresentation {
 	return fake.metrics
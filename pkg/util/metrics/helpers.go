@@ -17,11 +17,13 @@ package metrics
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"sync"
 
 	pcm "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
 )
 
@@ -44,6 +46,16 @@ const (
 	Sum Aggregation = "Sum"
 )
 
+// registerView registers the view of a metric. The view of a metric re-created with other
+// tags, e.g. the problem metrics re-created with the rule labels, replaces the earlier
+// one, which would otherwise be kept with its tags.
+func registerView(v *view.View) {
+	if existing := view.Find(v.Name); existing != nil && !reflect.DeepEqual(existing.TagKeys, v.TagKeys) {
+		view.Unregister(existing)
+	}
+	view.Register(v)
+}
+
 func getTagKeysFromNames(tagNames []string) ([]tag.Key, error) {
 	tagMapMutex.Lock()
 	defer tagMapMutex.Unlock()
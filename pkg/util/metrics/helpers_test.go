@@ -18,6 +18,9 @@ package metrics
 import (
 	"io/ioutil"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats/view"
 )
 
 // TestPrometheusMetricsParsingAndMatching verifies the behavior of ParsePrometheusMetrics() and GetFloat64Metric().
@@ -150,3 +153,15 @@ func TestPrometheusMetricsParsingAndMatching(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterViewWithOtherTags(t *testing.T) {
+	_, err := NewInt64Metric("", "test_reregistered_metric", "", "1", Sum, []string{"reason"})
+	assert.NoError(t, err)
+	_, err = NewInt64Metric("", "test_reregistered_metric", "", "1", Sum, []string{"reason", "runbook"})
+	assert.NoError(t, err)
+
+	v := view.Find("test_reregistered_metric")
+	if assert.NotNil(t, v) {
+		assert.Len(t, v.TagKeys, 2, "the view is replaced with the new tags")
+	}
+}
@@ -38,6 +38,50 @@ const (
 	MemoryPageCacheUsedID   MetricID = "memory/page_cache_used"
 	MemoryUnevictableUsedID MetricID = "memory/unevictable_used"
 	MemoryDirtyUsedID       MetricID = "memory/dirty_used"
+	NetConntrackEntriesID   MetricID = "net/conntrack_entries"
+	NetConntrackErrorsID    MetricID = "net/conntrack_error_count"
+	NetTCPRetransmitRatioID MetricID = "net/tcp_retransmit_ratio"
+	OSFileDescriptorsID     MetricID = "os/file_descriptors"
+	OSInodesUsedID          MetricID = "os/inodes_used"
+	OSEphemeralPortsID      MetricID = "os/ephemeral_ports"
+	ProcessCountID          MetricID = "process/count"
+	ProcessOldestAgeID      MetricID = "process/oldest_age"
+	RASHardwareErrorCountID MetricID = "ras/hardware_error_count"
+	RASBootErrorsID         MetricID = "ras/boot_errors"
+	ThermalZoneTempID       MetricID = "thermal/zone_temperature"
+	ThermalCPUThrottlesID   MetricID = "thermal/cpu_throttle_count"
+	ThermalCPUFrequencyID   MetricID = "thermal/cpu_frequency"
+	ThermalRAPLPowerID      MetricID = "thermal/rapl_power"
+
+	CustomPluginChecksDeferredID MetricID = "custom_plugin/checks_deferred"
+	MemoryECCErrorCountID        MetricID = "memory/ecc_error_count"
+
+	ProblemActiveCountID     MetricID = "problem/active_count"
+	ProblemTimeSinceLastID   MetricID = "problem/time_since_last"
+	ProblemActiveSecondsID   MetricID = "problem/active_seconds"
+	ProblemActiveDurationID  MetricID = "problem/active_duration"
+	ProblemClearedDurationID MetricID = "problem/cleared_duration"
+
+	ConditionFlappingID MetricID = "condition/flapping"
+
+	JournalPendingEntriesID MetricID = "journal/pending_entries"
+	JournalDroppedEntriesID MetricID = "journal/dropped_entries"
+
+	SystemLogLinesProcessedID       MetricID = "system_log_monitor/lines_processed"
+	SystemLogRuleMatchesID          MetricID = "system_log_monitor/rule_matches"
+	SystemLogReadLagID              MetricID = "system_log_monitor/read_lag"
+	KmsgDroppedMessagesID           MetricID = "system_log_monitor/kmsg_dropped_messages"
+	CustomPluginExecutionDurationID MetricID = "custom_plugin/execution_duration"
+	CustomPluginOutputValueID       MetricID = "custom_plugin/output_value"
+	ExporterFailuresID              MetricID = "exporter/failures"
+	NodeHealthScoreID               MetricID = "node/health_score"
+	FilesystemErrorCountID          MetricID = "filesystem/error_count"
+	KernelTaintID                   MetricID = "kernel/taint"
+	ClusterNodesID                  MetricID = "cluster/nodes"
+	ClusterUnhealthyNodesID         MetricID = "cluster/unhealthy_nodes"
+	ClusterConditionNodesID         MetricID = "cluster/condition_nodes"
+	ProblemDaemonCrashCountID       MetricID = "problem_daemon/crash_count"
+	CertificateExpirySecondsID      MetricID = "certificate/expiry_seconds"
 )
 
 var MetricMap MetricMapping
@@ -37,23 +37,12 @@ type Float64MetricRepresentation struct {
 
 // Float64Metric represents an float64 metric.
 type Float64Metric struct {
-	name    string
-	measure *stats.Float64Measure
+	name     string
+	measures []*stats.Float64Measure
 }
 
 // NewFloat64Metric create a Float64Metric metrics, returns nil when viewName is empty.
 func NewFloat64Metric(metricID MetricID, viewName string, description string, unit string, aggregation Aggregation, tagNames []string) (*Float64Metric, error) {
-	if viewName == "" {
-		return nil, nil
-	}
-
-	MetricMap.AddMapping(metricID, viewName)
-
-	tagKeys, err := getTagKeysFromNames(tagNames)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create metric %q because of tag creation failure: %v", viewName, err)
-	}
-
 	var aggregationMethod *view.Aggregation
 	switch aggregation {
 	case LastValue:
@@ -63,18 +52,44 @@ func NewFloat64Metric(metricID MetricID, viewName string, description string, un
 	default:
 		return nil, fmt.Errorf("unknown aggregation option %q", aggregation)
 	}
+	return newFloat64Metric(metricID, viewName, description, unit, aggregationMethod, tagNames)
+}
+
+// NewFloat64DistributionMetric create a Float64Metric metrics aggregating the measurements
+// into a histogram with the bucket bounds, returns nil when viewName is empty.
+func NewFloat64DistributionMetric(metricID MetricID, viewName string, description string, unit string, bounds []float64, tagNames []string) (*Float64Metric, error) {
+	return newFloat64Metric(metricID, viewName, description, unit, view.Distribution(bounds...), tagNames)
+}
 
-	measure := stats.Float64(viewName, description, unit)
-	newView := &view.View{
-		Name:        viewName,
-		Measure:     measure,
-		Description: description,
-		Aggregation: aggregationMethod,
-		TagKeys:     tagKeys,
+func newFloat64Metric(metricID MetricID, viewName string, description string, unit string, aggregationMethod *view.Aggregation, tagNames []string) (*Float64Metric, error) {
+	if viewName == "" {
+		return nil, nil
+	}
+
+	names := viewNames(metricID, viewName)
+	// Only the primary name is mapped back to the metric ID, so that exporters
+	// which translate metric IDs (e.g. Stackdriver) do not export aliases twice.
+	MetricMap.AddMapping(metricID, names[0])
+
+	tagKeys, err := getTagKeysFromNames(tagNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric %q because of tag creation failure: %v", viewName, err)
+	}
+
+	metric := Float64Metric{name: names[0]}
+	for _, name := range names {
+		measure := stats.Float64(name, description, unit)
+		newView := &view.View{
+			Name:        name,
+			Measure:     measure,
+			Description: description,
+			Aggregation: aggregationMethod,
+			TagKeys:     tagKeys,
+		}
+		registerView(newView)
+		metric.measures = append(metric.measures, measure)
 	}
-	view.Register(newView)
 
-	metric := Float64Metric{viewName, measure}
 	return &metric, nil
 }
 
@@ -93,8 +108,12 @@ func (metric *Float64Metric) Record(tags map[string]string, measurement float64)
 		mutators = append(mutators, tag.Upsert(tagKey, tagValue))
 	}
 
+	var measurements []stats.Measurement
+	for _, measure := range metric.measures {
+		measurements = append(measurements, measure.M(measurement))
+	}
 	return stats.RecordWithTags(
 		context.Background(),
 		mutators,
-		metric.measure.M(measurement))
+		measurements...)
 }
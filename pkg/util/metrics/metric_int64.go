@@ -33,12 +33,14 @@ type Int64MetricRepresentation struct {
 	Labels map[string]string
 	// Value is the value of the metric.
 	Value int64
+	// Exemplar is the exemplar set for the metric, if any.
+	Exemplar *Exemplar
 }
 
 // Int64Metric represents an int64 metric.
 type Int64Metric struct {
-	name    string
-	measure *stats.Int64Measure
+	name     string
+	measures []*stats.Int64Measure
 }
 
 // NewInt64Metric create a Int64Metric metric, returns nil when viewName is empty.
@@ -47,7 +49,10 @@ func NewInt64Metric(metricID MetricID, viewName string, description string, unit
 		return nil, nil
 	}
 
-	MetricMap.AddMapping(metricID, viewName)
+	names := viewNames(metricID, viewName)
+	// Only the primary name is mapped back to the metric ID, so that exporters
+	// which translate metric IDs (e.g. Stackdriver) do not export aliases twice.
+	MetricMap.AddMapping(metricID, names[0])
 
 	tagKeys, err := getTagKeysFromNames(tagNames)
 	if err != nil {
@@ -64,17 +69,20 @@ func NewInt64Metric(metricID MetricID, viewName string, description string, unit
 		return nil, fmt.Errorf("unknown aggregation option %q", aggregation)
 	}
 
-	measure := stats.Int64(viewName, description, unit)
-	newView := &view.View{
-		Name:        viewName,
-		Measure:     measure,
-		Description: description,
-		Aggregation: aggregationMethod,
-		TagKeys:     tagKeys,
+	metric := Int64Metric{name: names[0]}
+	for _, name := range names {
+		measure := stats.Int64(name, description, unit)
+		newView := &view.View{
+			Name:        name,
+			Measure:     measure,
+			Description: description,
+			Aggregation: aggregationMethod,
+			TagKeys:     tagKeys,
+		}
+		registerView(newView)
+		metric.measures = append(metric.measures, measure)
 	}
-	view.Register(newView)
 
-	metric := Int64Metric{viewName, measure}
 	return &metric, nil
 }
 
@@ -93,8 +101,20 @@ func (metric *Int64Metric) Record(tags map[string]string, measurement int64) err
 		mutators = append(mutators, tag.Upsert(tagKey, tagValue))
 	}
 
+	var measurements []stats.Measurement
+	for _, measure := range metric.measures {
+		measurements = append(measurements, measure.M(measurement))
+	}
 	return stats.RecordWithTags(
 		context.Background(),
 		mutators,
-		metric.measure.M(measurement))
+		measurements...)
+}
+
+// SetExemplar sets the exemplar of the series of the metric with the tags, which the
+// exporters supporting exemplars export along with the series.
+func (metric *Int64Metric) SetExemplar(tags map[string]string, exemplar Exemplar) {
+	for _, measure := range metric.measures {
+		setExemplar(measure.Name(), tags, exemplar)
+	}
 }
@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package metrics
+
+import (
+	"fmt"
+	"sync"
+)
+
+// NamingScheme decides which names NPD metrics are exported under.
+type NamingScheme string
+
+const (
+	// LegacyNaming exports metrics under their original (v1) names.
+	LegacyNaming NamingScheme = "legacy"
+	// V2Naming exports metrics under the cleaned up v2 names only.
+	V2Naming NamingScheme = "v2"
+	// CompatNaming exports metrics under both the v2 names and the legacy names.
+	// It is intended to be used while dashboards and alerts are migrated.
+	CompatNaming NamingScheme = "compat"
+)
+
+// v2MetricNames maps metric IDs to their v2 names. Metrics whose name does not
+// change in v2 are not listed.
+var v2MetricNames = map[MetricID]string{
+	ProblemCounterID:  "problem/count",
+	ProblemGaugeID:    "problem/state",
+	DiskWeightedIOID:  "disk/weighted_io_time",
+	DiskAvgQueueLenID: "disk/avg_queue_length",
+	DiskOpsBytesID:    "disk/operation_bytes",
+}
+
+var (
+	namingScheme      = LegacyNaming
+	namingSchemeMutex sync.RWMutex
+)
+
+// SetNamingScheme sets the naming scheme used by all metrics created afterwards.
+func SetNamingScheme(scheme NamingScheme) error {
+	switch scheme {
+	case LegacyNaming, V2Naming, CompatNaming:
+	default:
+		return fmt.Errorf("unknown metric naming scheme %q, supported: %q, %q, %q",
+			scheme, LegacyNaming, V2Naming, CompatNaming)
+	}
+	namingSchemeMutex.Lock()
+	defer namingSchemeMutex.Unlock()
+	namingScheme = scheme
+	return nil
+}
+
+// GetNamingScheme returns the current naming scheme.
+func GetNamingScheme() NamingScheme {
+	namingSchemeMutex.RLock()
+	defer namingSchemeMutex.RUnlock()
+	return namingScheme
+}
+
+// viewNames returns the view names a metric should be registered under. The
+// first name is the primary name, the rest are deprecated aliases.
+//
+// A view name that differs from the metric ID has been customized by the user
+// (e.g. via displayName in the system stats monitor config), and is kept as is.
+func viewNames(metricID MetricID, viewName string) []string {
+	v2Name, ok := v2MetricNames[metricID]
+	if !ok || viewName != string(metricID) {
+		return []string{viewName}
+	}
+	switch GetNamingScheme() {
+	case V2Naming:
+		return []string{v2Name}
+	case CompatNaming:
+		return []string{v2Name, viewName}
+	default:
+		return []string{viewName}
+	}
+}
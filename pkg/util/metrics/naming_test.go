@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewNames(t *testing.T) {
+	defer SetNamingScheme(LegacyNaming)
+
+	testCases := []struct {
+		name     string
+		scheme   NamingScheme
+		metricID MetricID
+		viewName string
+		expected []string
+	}{
+		{
+			name:     "legacy naming keeps the original name",
+			scheme:   LegacyNaming,
+			metricID: ProblemCounterID,
+			viewName: "problem_counter",
+			expected: []string{"problem_counter"},
+		},
+		{
+			name:     "v2 naming renames the metric",
+			scheme:   V2Naming,
+			metricID: ProblemCounterID,
+			viewName: "problem_counter",
+			expected: []string{"problem/count"},
+		},
+		{
+			name:     "compat naming exports both names",
+			scheme:   CompatNaming,
+			metricID: DiskAvgQueueLenID,
+			viewName: "disk/avg_queue_len",
+			expected: []string{"disk/avg_queue_length", "disk/avg_queue_len"},
+		},
+		{
+			name:     "metric without v2 name is unchanged",
+			scheme:   CompatNaming,
+			metricID: HostUptimeID,
+			viewName: "host/uptime",
+			expected: []string{"host/uptime"},
+		},
+		{
+			name:     "user customized name is unchanged",
+			scheme:   V2Naming,
+			metricID: DiskAvgQueueLenID,
+			viewName: "my_queue_len",
+			expected: []string{"my_queue_len"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.NoError(t, SetNamingScheme(test.scheme))
+			assert.Equal(t, test.expected, viewNames(test.metricID, test.viewName))
+		})
+	}
+}
+
+func TestSetNamingSchemeRejectsUnknownScheme(t *testing.T) {
+	assert.Error(t, SetNamingScheme("v3"))
+	assert.Equal(t, LegacyNaming, GetNamingScheme())
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import "sync"
+
+var (
+	nodeName      string
+	nodeNameMutex sync.RWMutex
+)
+
+// SetNodeName sets the name of the node node problem detector runs on, so that problem
+// daemons can pass it to the checks they run.
+func SetNodeName(name string) {
+	nodeNameMutex.Lock()
+	defer nodeNameMutex.Unlock()
+	nodeName = name
+}
+
+// GetNodeName returns the name of the node node problem detector runs on, or empty string
+// if it is not set.
+func GetNodeName() string {
+	nodeNameMutex.RLock()
+	defer nodeNameMutex.RUnlock()
+	return nodeName
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nodeidentity discovers the name and UID of the node node problem detector runs
+// on, with providers tried in a configured order of precedence.
+package nodeidentity
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// The names of the providers.
+const (
+	// OverrideProvider identifies the node with the --hostname-override flag.
+	OverrideProvider = "override"
+	// EnvProvider identifies the node with the NODE_NAME and NODE_UID environment
+	// variables, usually set with the downward API.
+	EnvProvider = "env"
+	// HostnameProvider identifies the node with the hostname of the machine.
+	HostnameProvider = "hostname"
+	// CloudMetadataProvider identifies the node with the instance name in the GCE metadata
+	// server, or the private DNS name in the AWS instance metadata service.
+	CloudMetadataProvider = "cloud-metadata"
+	// KubeletProvider identifies the node with the node name in the kubelet summary API.
+	KubeletProvider = "kubelet"
+)
+
+// DefaultProviders are the providers tried when none is configured, which identify the node
+// the way node problem detector always has.
+var DefaultProviders = []string{OverrideProvider, EnvProvider, HostnameProvider}
+
+const (
+	// NodeNameEnv and NodeUIDEnv are the environment variables read by the env provider.
+	NodeNameEnv = "NODE_NAME"
+	NodeUIDEnv  = "NODE_UID"
+
+	// requestTimeout is the timeout of the requests to the metadata servers and the kubelet.
+	requestTimeout = 5 * time.Second
+)
+
+// errNotAvailable is returned by the providers which have no identity for the node, so that
+// the next provider is tried.
+var errNotAvailable = errors.New("identity not available")
+
+// Identity is the identity of a node.
+type Identity struct {
+	// Name is the name of the node object.
+	Name string
+	// UID is the UID of the node object, or empty if the provider does not know it.
+	UID string
+	// Provider is the name of the provider which identified the node.
+	Provider string
+}
+
+// Provider discovers the identity of the node.
+type Provider interface {
+	// Name returns the name of the provider.
+	Name() string
+	// Identify returns the identity of the node. It returns errNotAvailable if the provider
+	// has no identity for the node.
+	Identify() (Identity, error)
+}
+
+// Config configures the providers.
+type Config struct {
+	// HostnameOverride is the node name used by the override provider.
+	HostnameOverride string
+	// KubeletEndpoint is the base URL of the kubelet API used by the kubelet provider.
+	KubeletEndpoint string
+}
+
+// NewProviders creates the named providers in the order of precedence. It returns an error if
+// a provider is unknown or repeated.
+func NewProviders(names []string, config Config) ([]Provider, error) {
+	if len(names) == 0 {
+		names = DefaultProviders
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	seen := make(map[string]bool)
+	var providers []Provider
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			return nil, fmt.Errorf("node identity provider %q is repeated", name)
+		}
+		seen[name] = true
+		switch name {
+		case OverrideProvider:
+			providers = append(providers, &overrideProvider{name: config.HostnameOverride})
+		case EnvProvider:
+			providers = append(providers, &envProvider{getenv: os.Getenv})
+		case HostnameProvider:
+			providers = append(providers, &hostnameProvider{hostname: os.Hostname})
+		case CloudMetadataProvider:
+			providers = append(providers, &cloudMetadataProvider{client: client, gceURL: gceMetadataURL, awsURL: awsMetadataURL})
+		case KubeletProvider:
+			if config.KubeletEndpoint == "" {
+				return nil, fmt.Errorf("node identity provider %q requires the kubelet endpoint", name)
+			}
+			providers = append(providers, &kubeletProvider{client: client, endpoint: strings.TrimSuffix(config.KubeletEndpoint, "/")})
+		default:
+			return nil, fmt.Errorf("unknown node identity provider %q, supported providers are %s, %s, %s, %s and %s",
+				name, OverrideProvider, EnvProvider, HostnameProvider, CloudMetadataProvider, KubeletProvider)
+		}
+	}
+	return providers, nil
+}
+
+// Identify returns the identity of the first provider which identifies the node. Providers
+// failing to identify the node are skipped, but an invalid node name is an error instead of
+// falling through, so that conditions are never patched onto the wrong node.
+func Identify(providers []Provider) (Identity, error) {
+	var failures []string
+	for _, p := range providers {
+		identity, err := p.Identify()
+		if err == errNotAvailable {
+			glog.V(2).Infof("Node identity provider %q has no identity for the node", p.Name())
+			continue
+		}
+		if err != nil {
+			glog.Warningf("Node identity provider %q failed to identify the node: %v", p.Name(), err)
+			failures = append(failures, fmt.Sprintf("%s: %v", p.Name(), err))
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(identity.Name); len(errs) != 0 {
+			return Identity{}, fmt.Errorf("node identity provider %q returned invalid node name %q: %s",
+				p.Name(), identity.Name, strings.Join(errs, ", "))
+		}
+		identity.Provider = p.Name()
+		return identity, nil
+	}
+	if len(failures) != 0 {
+		return Identity{}, fmt.Errorf("no node identity provider identified the node: %s", strings.Join(failures, "; "))
+	}
+	return Identity{}, fmt.Errorf("no node identity provider identified the node")
+}
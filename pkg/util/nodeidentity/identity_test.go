@@ -0,0 +1,140 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeidentity
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentify(t *testing.T) {
+	env := map[string]string{NodeNameEnv: "node-env", NodeUIDEnv: "uid-1"}
+	fromEnv := &envProvider{getenv: func(key string) string { return env[key] }}
+	noEnv := &envProvider{getenv: func(string) string { return "" }}
+	hostname := &hostnameProvider{hostname: func() (string, error) { return "Node-Host\n", nil }}
+	brokenHostname := &hostnameProvider{hostname: func() (string, error) { return "", fmt.Errorf("broken") }}
+
+	for desc, test := range map[string]struct {
+		providers []Provider
+		expected  Identity
+		expectErr bool
+	}{
+		"first provider wins": {
+			providers: []Provider{&overrideProvider{name: "node-override"}, fromEnv, hostname},
+			expected:  Identity{Name: "node-override", Provider: OverrideProvider},
+		},
+		"unavailable providers are skipped": {
+			providers: []Provider{&overrideProvider{}, noEnv, hostname},
+			expected:  Identity{Name: "node-host", Provider: HostnameProvider},
+		},
+		"env provider sets the uid": {
+			providers: []Provider{fromEnv, hostname},
+			expected:  Identity{Name: "node-env", UID: "uid-1", Provider: EnvProvider},
+		},
+		"failed providers are skipped": {
+			providers: []Provider{brokenHostname, fromEnv},
+			expected:  Identity{Name: "node-env", UID: "uid-1", Provider: EnvProvider},
+		},
+		"invalid name is an error": {
+			providers: []Provider{&overrideProvider{name: "Node_1"}, fromEnv},
+			expectErr: true,
+		},
+		"no provider identifies the node": {
+			providers: []Provider{&overrideProvider{}, brokenHostname},
+			expectErr: true,
+		},
+	} {
+		identity, err := Identify(test.providers)
+		if test.expectErr {
+			assert.Error(t, err, desc)
+			continue
+		}
+		assert.NoError(t, err, desc)
+		assert.Equal(t, test.expected, identity, desc)
+	}
+}
+
+func TestNewProviders(t *testing.T) {
+	providers, err := NewProviders(nil, Config{})
+	assert.NoError(t, err)
+	var names []string
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	assert.Equal(t, DefaultProviders, names)
+
+	_, err = NewProviders([]string{EnvProvider, "dns"}, Config{})
+	assert.Error(t, err, "unknown provider")
+	_, err = NewProviders([]string{EnvProvider, HostnameProvider, EnvProvider}, Config{})
+	assert.Error(t, err, "repeated provider")
+	_, err = NewProviders([]string{KubeletProvider}, Config{})
+	assert.Error(t, err, "kubelet provider without endpoint")
+}
+
+func TestCloudMetadataProvider(t *testing.T) {
+	gce := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "gce-instance")
+	}))
+	defer gce.Close()
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ip-10-0-0-1.ec2.internal\n")
+	}))
+	defer aws.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer down.Close()
+
+	p := &cloudMetadataProvider{client: http.DefaultClient, gceURL: gce.URL, awsURL: aws.URL}
+	identity, err := p.Identify()
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{Name: "gce-instance"}, identity)
+
+	p.gceURL = down.URL
+	identity, err = p.Identify()
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{Name: "ip-10-0-0-1.ec2.internal"}, identity)
+
+	p.awsURL = down.URL
+	_, err = p.Identify()
+	assert.Error(t, err)
+}
+
+func TestKubeletProvider(t *testing.T) {
+	kubelet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != kubeletSummaryPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"node": {"nodeName": "node-kubelet", "cpu": {}}, "pods": []}`)
+	}))
+	defer kubelet.Close()
+
+	providers, err := NewProviders([]string{KubeletProvider}, Config{KubeletEndpoint: kubelet.URL + "/"})
+	assert.NoError(t, err)
+	identity, err := Identify(providers)
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{Name: "node-kubelet", Provider: KubeletProvider}, identity)
+}
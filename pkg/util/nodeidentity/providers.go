@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeidentity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	// gceMetadataURL is the URL of the instance name in the GCE metadata server.
+	gceMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/name"
+	// awsMetadataURL is the URL of the private DNS name in the AWS instance metadata service,
+	// which is the node name given by the AWS cloud provider.
+	awsMetadataURL = "http://169.254.169.254/latest/meta-data/local-hostname"
+	// kubeletSummaryPath is the path of the summary API of the kubelet.
+	kubeletSummaryPath = "/stats/summary"
+)
+
+type overrideProvider struct {
+	name string
+}
+
+func (p *overrideProvider) Name() string { return OverrideProvider }
+
+func (p *overrideProvider) Identify() (Identity, error) {
+	if p.name == "" {
+		return Identity{}, errNotAvailable
+	}
+	return Identity{Name: p.name}, nil
+}
+
+type envProvider struct {
+	getenv func(string) string
+}
+
+func (p *envProvider) Name() string { return EnvProvider }
+
+func (p *envProvider) Identify() (Identity, error) {
+	name := p.getenv(NodeNameEnv)
+	if name == "" {
+		return Identity{}, errNotAvailable
+	}
+	return Identity{Name: name, UID: p.getenv(NodeUIDEnv)}, nil
+}
+
+type hostnameProvider struct {
+	hostname func() (string, error)
+}
+
+func (p *hostnameProvider) Name() string { return HostnameProvider }
+
+// Identify returns the hostname lowercased, the same way the kubelet names the node by
+// default.
+func (p *hostnameProvider) Identify() (Identity, error) {
+	hostname, err := p.hostname()
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to get host name: %v", err)
+	}
+	return Identity{Name: strings.ToLower(strings.TrimSpace(hostname))}, nil
+}
+
+type cloudMetadataProvider struct {
+	client *http.Client
+	gceURL string
+	awsURL string
+}
+
+func (p *cloudMetadataProvider) Name() string { return CloudMetadataProvider }
+
+// Identify tries the GCE metadata server first, then the AWS instance metadata service.
+func (p *cloudMetadataProvider) Identify() (Identity, error) {
+	name, gceErr := get(p.client, p.gceURL, map[string]string{"Metadata-Flavor": "Google"})
+	if gceErr == nil {
+		return Identity{Name: name}, nil
+	}
+	name, awsErr := get(p.client, p.awsURL, nil)
+	if awsErr == nil {
+		return Identity{Name: name}, nil
+	}
+	return Identity{}, fmt.Errorf("failed to query the GCE metadata server (%v) and the AWS instance metadata service (%v)", gceErr, awsErr)
+}
+
+type kubeletProvider struct {
+	client   *http.Client
+	endpoint string
+}
+
+func (p *kubeletProvider) Name() string { return KubeletProvider }
+
+func (p *kubeletProvider) Identify() (Identity, error) {
+	body, err := get(p.client, p.endpoint+kubeletSummaryPath, nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	var summary struct {
+		Node struct {
+			NodeName string `json:"nodeName"`
+		} `json:"node"`
+	}
+	if err := json.Unmarshal([]byte(body), &summary); err != nil {
+		return Identity{}, fmt.Errorf("failed to decode the kubelet summary: %v", err)
+	}
+	if summary.Node.NodeName == "" {
+		return Identity{}, fmt.Errorf("the kubelet summary has no node name")
+	}
+	return Identity{Name: summary.Node.NodeName}, nil
+}
+
+// get returns the trimmed body of a successful GET request to the URL.
+func get(client *http.Client, url string, headers map[string]string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	value := strings.TrimSpace(string(body))
+	if value == "" {
+		return "", fmt.Errorf("GET %s returned an empty body", url)
+	}
+	return value, nil
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package serving serves the HTTP endpoints of node-problem-detector with TLS and
+// authentication, so that they can be exposed on the node network.
+package serving
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Config is the TLS and authentication configuration of the HTTP endpoints.
+type Config struct {
+	// CertFile is the path to the serving certificate. Empty serves plain HTTP.
+	CertFile string
+	// KeyFile is the path to the private key of the serving certificate.
+	KeyFile string
+	// ClientCAFile is the path to the CA bundle verifying client certificates. Clients
+	// presenting a certificate signed by it are authenticated.
+	ClientCAFile string
+	// TokenFile is the path to the file of the accepted bearer tokens, one per line.
+	TokenFile string
+	// BasicAuthFile is the path to the file of the accepted "user:password" credentials,
+	// one per line.
+	BasicAuthFile string
+}
+
+// Validate validates the configuration.
+func (c Config) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("the certificate file and the private key file must be set together")
+	}
+	if c.CertFile == "" && c.Authenticates() {
+		return fmt.Errorf("authentication requires TLS, so that credentials are not sent in plain text")
+	}
+	return nil
+}
+
+// Authenticates returns whether clients must authenticate.
+func (c Config) Authenticates() bool {
+	return c.ClientCAFile != "" || c.TokenFile != "" || c.BasicAuthFile != ""
+}
+
+// ListenAndServe serves the handler at the address with the TLS and authentication
+// configuration. Requests to the public paths, e.g. health checks of liveness probes, are
+// not authenticated.
+func ListenAndServe(addr string, handler http.Handler, config Config, publicPaths ...string) error {
+	if config.CertFile == "" {
+		return http.ListenAndServe(addr, handler)
+	}
+	tlsConfig, err := newTLSConfig(config, len(publicPaths) == 0)
+	if err != nil {
+		return err
+	}
+	handler, err = newAuthHandler(handler, config, publicPaths)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig}
+	// The certificate is loaded by the TLS configuration.
+	return server.ListenAndServeTLS("", "")
+}
+
+// newTLSConfig returns the TLS configuration serving the certificate. Without other
+// authentication, client certificates are required by the handshake unless some paths
+// are public.
+func newTLSConfig(config Config, requireClientCert bool) (*tls.Config, error) {
+	certs := &certificateLoader{certFile: config.CertFile, keyFile: config.KeyFile}
+	if err := certs.load(); err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+	}
+	if config.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file %q: %v", config.ClientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in client CA file %q", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert && config.TokenFile == "" && config.BasicAuthFile == "" {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certificateLoader loads the serving certificate, and reloads it when its files change,
+// so that the certificate can be rotated without restarting node-problem-detector.
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+
+	sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// load loads the certificate if its files changed since it was last loaded.
+func (l *certificateLoader) load() error {
+	modTime, err := latestModTime(l.certFile, l.keyFile)
+	if err != nil {
+		return err
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.cert != nil && modTime.Equal(l.modTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %q and key %q: %v", l.certFile, l.keyFile, err)
+	}
+	l.cert = &cert
+	l.modTime = modTime
+	return nil
+}
+
+func (l *certificateLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	// A certificate which fails to load, e.g. while only one of the files is updated, is
+	// retried on the next handshake and the current one is kept meanwhile.
+	if err := l.load(); err != nil {
+		glog.Errorf("Failed to reload serving certificate, keep serving the current one: %v", err)
+	}
+	l.Lock()
+	defer l.Unlock()
+	return l.cert, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// authHandler authenticates the requests to the handler.
+type authHandler struct {
+	handler     http.Handler
+	publicPaths map[string]bool
+	// clientCert authenticates clients with verified certificates.
+	clientCert bool
+	tokens     []string
+	// users are the passwords by user name.
+	users map[string]string
+}
+
+// newAuthHandler returns the handler authenticating the requests, or the handler itself
+// if clients need not authenticate.
+func newAuthHandler(handler http.Handler, config Config, publicPaths []string) (http.Handler, error) {
+	if !config.Authenticates() {
+		return handler, nil
+	}
+	h := &authHandler{
+		handler:     handler,
+		publicPaths: make(map[string]bool),
+		clientCert:  config.ClientCAFile != "",
+		users:       make(map[string]string),
+	}
+	for _, path := range publicPaths {
+		h.publicPaths[path] = true
+	}
+	if config.TokenFile != "" {
+		lines, err := readLines(config.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token file %q: %v", config.TokenFile, err)
+		}
+		h.tokens = lines
+	}
+	if config.BasicAuthFile != "" {
+		lines, err := readLines(config.BasicAuthFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read basic auth file %q: %v", config.BasicAuthFile, err)
+		}
+		for i, line := range lines {
+			user := strings.SplitN(line, ":", 2)
+			if len(user) != 2 || user[0] == "" || user[1] == "" {
+				return nil, fmt.Errorf("entry %d of basic auth file %q is not \"user:password\"", i+1, config.BasicAuthFile)
+			}
+			h.users[user[0]] = user[1]
+		}
+	}
+	return h, nil
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.publicPaths[r.URL.Path] || h.authenticated(r) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	if len(h.users) != 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="node-problem-detector"`)
+	} else if len(h.tokens) != 0 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+func (h *authHandler) authenticated(r *http.Request) bool {
+	if h.clientCert && r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+		return true
+	}
+	if user, password, ok := r.BasicAuth(); ok {
+		expected, found := h.users[user]
+		// The password is compared even for unknown users, so that the time taken does
+		// not tell which users exist.
+		return constantTimeEqual(password, expected) && found
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != r.Header.Get("Authorization") {
+		for _, expected := range h.tokens {
+			if constantTimeEqual(token, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// readLines reads the non-empty lines of the file, skipping comments starting with '#'.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serving
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    Config
+		expectErr bool
+	}{
+		{name: "plain HTTP", config: Config{}},
+		{name: "TLS", config: Config{CertFile: "cert", KeyFile: "key"}},
+		{name: "TLS with token", config: Config{CertFile: "cert", KeyFile: "key", TokenFile: "tokens"}},
+		{name: "certificate without key", config: Config{CertFile: "cert"}, expectErr: true},
+		{name: "basic auth without TLS", config: Config{BasicAuthFile: "users"}, expectErr: true},
+		{name: "client CA without TLS", config: Config{ClientCAFile: "ca"}, expectErr: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			assert.Equal(t, test.expectErr, err != nil, "unexpected error: %v", err)
+		})
+	}
+}
+
+func writeFile(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write %q: %v", path, err)
+	}
+	return path
+}
+
+func TestAuthHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serving")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := Config{
+		TokenFile:     writeFile(t, dir, "tokens", "# scrapers\ntoken-a\n\ntoken-b\n"),
+		BasicAuthFile: writeFile(t, dir, "users", "prometheus:secret\n"),
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler, err := newAuthHandler(ok, config, []string{"/healthz"})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		path           string
+		authorize      func(r *http.Request)
+		expectedStatus int
+	}{
+		{name: "no credentials", path: "/metrics", expectedStatus: http.StatusUnauthorized},
+		{name: "public path", path: "/healthz", expectedStatus: http.StatusOK},
+		{
+			name:           "token",
+			path:           "/metrics",
+			authorize:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-b") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong token",
+			path:           "/metrics",
+			authorize:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-c") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "comment as token",
+			path:           "/metrics",
+			authorize:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer # scrapers") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "basic auth",
+			path:           "/metrics",
+			authorize:      func(r *http.Request) { r.SetBasicAuth("prometheus", "secret") },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong password",
+			path:           "/metrics",
+			authorize:      func(r *http.Request) { r.SetBasicAuth("prometheus", "token-a") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown user",
+			path:           "/metrics",
+			authorize:      func(r *http.Request) { r.SetBasicAuth("grafana", "secret") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", test.path, nil)
+			if test.authorize != nil {
+				test.authorize(r)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, test.expectedStatus, w.Code)
+		})
+	}
+
+	_, err = newAuthHandler(ok, Config{BasicAuthFile: writeFile(t, dir, "invalid", "prometheus\n")}, nil)
+	assert.Error(t, err)
+}
+
+// newCertificate returns a certificate and its key in PEM, signed by the parent, or
+// self-signed if the parent is nil.
+func newCertificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parentCert, parentKey := template, interface{}(key)
+	if parent != nil {
+		parentCert, parentKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	assert.NoError(t, err)
+	cert.Leaf, err = x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, certPEM, keyPEM
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serving")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, caPEM, _ := newCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	_, serverPEM, serverKeyPEM := newCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node-problem-detector"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	client, _, _ := newCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "prometheus"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+	config := Config{
+		CertFile:     writeFile(t, dir, "server.crt", serverPEM),
+		KeyFile:      writeFile(t, dir, "server.key", serverKeyPEM),
+		ClientCAFile: writeFile(t, dir, "ca.crt", caPEM),
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler, err := newAuthHandler(ok, config, []string{"/healthz"})
+	assert.NoError(t, err)
+	tlsConfig, err := newTLSConfig(config, false)
+	assert.NoError(t, err)
+	// httptest would serve its own certificate, serve the handler with the TLS
+	// configuration instead.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+	url := "https://" + listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	get := func(path string, certs ...tls.Certificate) int {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := c.Get(url + path)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, get("/metrics", client))
+	assert.Equal(t, http.StatusUnauthorized, get("/metrics"))
+	assert.Equal(t, http.StatusOK, get("/healthz"))
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// UnmarshalStrict unmarshals a JSON configuration into v like json.Unmarshal, and also
+// rejects the fields unknown to v, so that a misspelled field does not silently fall back
+// to its default. The unknown fields are reported with their paths, e.g. "rules[2].patern",
+// and the known field they most likely misspell.
+func UnmarshalStrict(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var unknown []string
+	findUnknownFields(reflect.TypeOf(v), raw, "", &unknown)
+	if len(unknown) > 0 {
+		return fmt.Errorf("%s", strings.Join(unknown, "; "))
+	}
+	return nil
+}
+
+// findUnknownFields appends the errors of the fields of the decoded JSON value unknown to
+// the type.
+func findUnknownFields(t reflect.Type, raw interface{}, path string, unknown *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// Types decoding themselves may accept any field.
+	ptr := reflect.PtrTo(t)
+	if ptr.Implements(jsonUnmarshalerType) || ptr.Implements(textUnmarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for _, key := range sortedKeys(obj) {
+			field, ok := lookupField(fields, key)
+			if !ok {
+				message := fmt.Sprintf("unknown field %q", joinPath(path, key))
+				if suggestion := closestField(fields, key); suggestion != "" {
+					message += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				*unknown = append(*unknown, message)
+				continue
+			}
+			findUnknownFields(field, obj[key], joinPath(path, key), unknown)
+		}
+	case reflect.Map:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, key := range sortedKeys(obj) {
+			findUnknownFields(t.Elem(), obj[key], joinPath(path, key), unknown)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := raw.([]interface{})
+		if !ok {
+			return
+		}
+		for i, elem := range arr {
+			findUnknownFields(t.Elem(), elem, fmt.Sprintf("%s[%d]", path, i), unknown)
+		}
+	}
+}
+
+// jsonFields returns the types of the JSON fields of a struct by their names, including
+// the fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	// The fields of the struct take precedence over the embedded ones.
+	for _, ft := range embedded {
+		for name, t := range jsonFields(ft) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = t
+			}
+		}
+	}
+	return fields
+}
+
+// lookupField looks up the field of a JSON key, which matches case-insensitively like
+// json.Unmarshal does.
+func lookupField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// closestField returns the field name closest to the unknown key, or an empty string if
+// none is close enough to be a likely misspelling.
+func closestField(fields map[string]reflect.Type, key string) string {
+	closest, closestDistance := "", 1+len(key)/4
+	for _, name := range sortedKeys(fields) {
+		distance := editDistance(strings.ToLower(key), strings.ToLower(name))
+		if distance <= closestDistance && (closest == "" || distance < closestDistance) {
+			closest, closestDistance = name, distance
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// sortedKeys returns the keys of a map in order, so that errors are reported in a stable
+// order.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
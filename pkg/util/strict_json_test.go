@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+type strictEmbedded struct {
+	Lookback string `json:"lookback"`
+}
+
+type strictRule struct {
+	Pattern string `json:"pattern"`
+}
+
+type strictConfig struct {
+	strictEmbedded
+	Source   string                 `json:"source"`
+	Rules    []strictRule           `json:"rules"`
+	Devices  map[string]*strictRule `json:"devices"`
+	Since    time.Time              `json:"since"`
+	Extra    map[string]string      `json:"extra"`
+	Internal string                 `json:"-"`
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	testCases := map[string]struct {
+		data string
+		err  string
+	}{
+		"known fields": {
+			data: `{"lookback": "5m", "Source": "foo", "rules": [{"pattern": "a"}], "devices": {"sda": {"pattern": "b"}},
+				"since": "2020-01-01T00:00:00Z", "extra": {"any": "thing"}}`,
+		},
+		"misspelled fields": {
+			data: `{"lookbak": "5m", "rules": [{"pattern": "a"}, {"patern": "b"}], "devices": {"sda": {"pattren": "c"}}}`,
+			err:  `unknown field "devices.sda.pattren", did you mean "pattern"?; unknown field "lookbak", did you mean "lookback"?; unknown field "rules[1].patern", did you mean "pattern"?`,
+		},
+		"unknown field without suggestion": {
+			data: `{"internal": "x"}`,
+			err:  `unknown field "internal"`,
+		},
+		"type error": {
+			data: `{"rules": "a"}`,
+			err:  "json: cannot unmarshal string into Go struct field strictConfig.rules of type []util.strictRule",
+		},
+	}
+	for desc, test := range testCases {
+		t.Run(desc, func(t *testing.T) {
+			var config strictConfig
+			err := UnmarshalStrict([]byte(test.data), &config)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
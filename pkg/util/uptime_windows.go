@@ -0,0 +1,34 @@
+// +build windows
+
+/*
+Copyright 2020 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shirou/gopsutil/host"
+)
+
+func GetUptimeDuration() (time.Duration, error) {
+	uptime, err := host.Uptime()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get system uptime: %v", err)
+	}
+	return time.Duration(uptime) * time.Second, nil
+}